@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/fidelity"
+)
+
+// runCompare compares the banner Shodan or Censys indexed for a real host
+// to what the local spoof serves
+func runCompare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	source := fs.String("source", "shodan", "banner source: shodan or censys")
+	ip := fs.String("ip", "", "IP address of the real host")
+	port := fs.Int("port", 80, "port of the real host")
+	local := fs.String("local", "", "URL of the local spoof (default http://127.0.0.1:<port>/)")
+	shodanKey := fs.String("shodan-key", os.Getenv("SHODAN_API_KEY"), "Shodan API key")
+	censysID := fs.String("censys-id", os.Getenv("CENSYS_API_ID"), "Censys API ID")
+	censysSecret := fs.String("censys-secret", os.Getenv("CENSYS_API_SECRET"), "Censys API secret")
+	fs.Parse(args)
+
+	if *ip == "" {
+		log.Fatalf("-ip is required")
+	}
+	if *local == "" {
+		*local = fmt.Sprintf("http://127.0.0.1:%d/", *port)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	// The APIs are sent credentials, so their certificates are verified
+	apiClient := &http.Client{Timeout: 30 * time.Second}
+
+	// The spoof's own listener is probed as a scanner would, accepting its
+	// self-signed certificate and not following redirects
+	localClient := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var want *fidelity.Banner
+	var err error
+	switch *source {
+	case "shodan":
+		want, err = fidelity.FetchShodan(ctx, apiClient, *shodanKey, *ip, *port)
+	case "censys":
+		want, err = fidelity.FetchCensys(ctx, apiClient, *censysID, *censysSecret, *ip, *port)
+	default:
+		log.Fatalf("Unknown source %q", *source)
+	}
+	if err != nil {
+		log.Fatalf("Failed to fetch reference banner: %v", err)
+	}
+
+	got, err := fidelity.FetchLocal(ctx, localClient, *local)
+	if err != nil {
+		log.Fatalf("Failed to fetch local banner: %v", err)
+	}
+
+	report := fidelity.Compare(want, got)
+
+	fmt.Printf("Fidelity: %.0f%% (%d of %d fields match)\n\n",
+		report.Score()*100, report.Compared-len(report.Differences), report.Compared)
+
+	if len(report.Differences) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "FIELD\t%s\tSPOOF\n", *source)
+	for _, d := range report.Differences {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", d.Field, orAbsent(d.Want), orAbsent(d.Got))
+	}
+	tw.Flush()
+}
+
+func orAbsent(v string) string {
+	if v == "" {
+		return "<absent>"
+	}
+	return v
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/conformance"
+	"github.com/davidthuman/service-spoof/internal/fidelity"
+)
+
+// runConformance runs the conformance corpus of each service profile against
+// the running spoof and reports the assertions its responses fail
+func runConformance(args []string) {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the config file")
+	corpusDir := fs.String("corpus", "./conformance", "directory of conformance corpora")
+	host := fs.String("host", "127.0.0.1", "host the spoof is running on")
+	services := fs.String("services", "", "comma-separated services to check (default all with a corpus)")
+	timeout := fs.Duration("timeout", time.Minute, "time allowed for each service")
+	verbose := fs.Bool("v", false, "print the assertions that fail")
+	fs.Parse(args)
+
+	cfg := mustLoadConfig(*configPath)
+
+	corpora, err := conformance.LoadDir(*corpusDir)
+	if err != nil {
+		log.Fatalf("Failed to load corpora: %v", err)
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(*services, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			selected[name] = true
+		}
+	}
+
+	enabled := cfg.GetEnabledServices()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tCASES\tFAILED\tRESULT")
+	failed := 0
+	for _, corpus := range corpora {
+		if len(selected) > 0 && !selected[corpus.Profile] {
+			continue
+		}
+		delete(selected, corpus.Profile)
+
+		i := 0
+		for i < len(enabled) && enabled[i].Name != corpus.Profile {
+			i++
+		}
+		if i == len(enabled) || !enabled[i].SpeaksHTTP() || len(enabled[i].Ports) == 0 {
+			fmt.Fprintf(tw, "%s\t%d\t-\tSKIPPED\n", corpus.Profile, len(corpus.Cases))
+			continue
+		}
+		svc := &enabled[i]
+
+		vhost := "localhost"
+		if len(svc.Hosts) > 0 {
+			vhost = svc.Hosts[0]
+		}
+		target := fidelity.Target{
+			Addr: net.JoinHostPort(*host, strconv.Itoa(svc.Ports[0])),
+			TLS:  cfg.GetTls(svc).CertFilePath != "",
+			Host: vhost,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		result, err := conformance.Run(ctx, target, corpus)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to check service %s: %v", svc.Name, err)
+			fmt.Fprintf(tw, "%s\t%d\t-\tERROR\n", svc.Name, len(corpus.Cases))
+			failed++
+			continue
+		}
+
+		status := "PASS"
+		if n := result.Failed(); n > 0 {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", svc.Name, result.Cases, result.Failed(), status)
+		if *verbose {
+			for _, f := range result.Failures {
+				fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", f.Case, f.Assertion, f.Want, orAbsent(f.Got))
+			}
+		}
+	}
+	for name := range selected {
+		log.Printf("Service %s has no corpus", name)
+		failed++
+	}
+	tw.Flush()
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/selftest"
+)
+
+// runDetect runs known honeypot-detection heuristics against a running
+// instance and reports which checks it fails
+func runDetect(args []string) {
+	fs := flag.NewFlagSet("detect", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the configuration file")
+	host := fs.String("host", "127.0.0.1", "host the spoof is running on")
+	fs.Parse(args)
+
+	cfg := mustLoadConfig(*configPath)
+
+	checker := selftest.NewChecker(cfg)
+	checker.SetHost(*host)
+
+	detections := checker.RunDetection(context.Background())
+	sort.SliceStable(detections, func(i, j int) bool {
+		if detections[i].Port != detections[j].Port {
+			return detections[i].Port < detections[j].Port
+		}
+		return detections[i].Address < detections[j].Address
+	})
+
+	failed := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LISTENER\tCHECK\tRESULT\tDETAIL")
+	for _, d := range detections {
+		result := "PASS"
+		if !d.Passed {
+			result = "FAIL"
+			failed++
+		}
+		listener := config.ListenAddr{IP: d.Address, Port: d.Port}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", listener, d.Check, result, d.Detail)
+	}
+	tw.Flush()
+
+	if failed > 0 {
+		fmt.Printf("\n%d of %d checks failed\n", failed, len(detections))
+		os.Exit(1)
+	}
+}
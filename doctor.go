@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/doctor"
+)
+
+// runDoctor checks that the spoof would start cleanly, for provisioning
+// pipelines to run before starting it. It exits non-zero if any check fails.
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the config file")
+	migrations := fs.String("migrations", "./migrations", "path to the migrations directory")
+	certWarning := fs.Duration("cert-warning", 30*24*time.Hour, "warn about certificates expiring within this long")
+	geoipMaxAge := fs.Duration("geoip-max-age", 30*24*time.Hour, "warn about GeoIP databases older than this, 0 to disable")
+	skipPorts := fs.Bool("skip-ports", false, "skip binding listeners, for running beside a live instance")
+	strict := fs.Bool("strict", false, "exit non-zero on warnings too")
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	fs.Parse(args)
+
+	checks := doctor.Run(doctor.Options{
+		ConfigPath:     *configPath,
+		MigrationsPath: *migrations,
+		CertWarning:    *certWarning,
+		GeoIPMaxAge:    *geoipMaxAge,
+		SkipPorts:      *skipPorts,
+	})
+	failed := doctor.Failed(checks, *strict)
+
+	if *asJSON {
+		err := json.NewEncoder(os.Stdout).Encode(struct {
+			OK     bool           `json:"ok"`
+			Checks []doctor.Check `json:"checks"`
+		}{!failed, checks})
+		if err != nil {
+			log.Fatalf("Failed to encode results: %v", err)
+		}
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CHECK\tTARGET\tRESULT\tDETAIL")
+		for _, c := range checks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Name, c.Target, strings.ToUpper(string(c.Status)), c.Detail)
+		}
+		tw.Flush()
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
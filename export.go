@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/pcap"
+	"github.com/davidthuman/service-spoof/internal/sink"
+)
+
+// Formats requests can be exported in
+const (
+	exportJSON  = "json"
+	exportJSONL = "jsonl"
+	exportCSV   = "csv"
+	exportPcap  = "pcap"
+)
+
+// runExport writes the requests logged in the database to a file, oldest
+// first: as a JSON array, JSON lines, CSV, or a PCAP of synthetic TCP
+// connections for Wireshark or Zeek
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the config file")
+	filter := logFilterFlags(fs, 0, 0)
+	format := fs.String("format", exportJSON, "output format, json, jsonl, csv, or pcap")
+	output := fs.String("o", "-", "file to write, - for stdout")
+	fields := fs.String("fields", "", "comma-separated fields for jsonl and csv, all if empty")
+	serverIP := fs.String("server", "", "address requests were sent to for pcap, defaults to 192.0.2.1 or 2001:db8::1")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-spoof export [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var selected []string
+	if *fields != "" {
+		selected = strings.Split(*fields, ",")
+	}
+	var server netip.Addr
+	if *serverIP != "" {
+		addr, err := netip.ParseAddr(*serverIP)
+		if err != nil {
+			log.Fatalf("Invalid server address %q", *serverIP)
+		}
+		server = addr.Unmap()
+	}
+
+	var write func(w io.Writer, logs []database.RequestLog) error
+	switch *format {
+	case exportJSON:
+		write = func(w io.Writer, logs []database.RequestLog) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(logs)
+		}
+	case exportJSONL:
+		write = func(w io.Writer, logs []database.RequestLog) error {
+			s, err := sink.NewJSON(w, selected)
+			if err != nil {
+				return err
+			}
+			for i := range logs {
+				if err := s.Write(&logs[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case exportCSV:
+		if selected == nil {
+			selected = database.EnvVars
+		}
+		write = func(w io.Writer, logs []database.RequestLog) error {
+			return writeCSV(w, logs, selected)
+		}
+	case exportPcap:
+		write = func(w io.Writer, logs []database.RequestLog) error {
+			pw, err := pcap.NewWriter(w)
+			if err != nil {
+				return err
+			}
+			for i := range logs {
+				if err := pw.WriteLog(&logs[i], server); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	default:
+		log.Fatalf("Unknown export format %q", *format)
+	}
+
+	f := filter()
+	f.Order = database.OrderOldest
+	logs := queryLogs(*configPath, f)
+
+	out := os.Stdout
+	if *output != "-" {
+		var err error
+		if out, err = os.Create(*output); err != nil {
+			log.Fatalf("Failed to create %s: %v", *output, err)
+		}
+	}
+	bw := bufio.NewWriter(out)
+	if err := write(bw, logs); err != nil {
+		log.Fatalf("Failed to export request logs: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		log.Fatalf("Failed to export request logs: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatalf("Failed to export request logs: %v", err)
+	}
+	if *output != "-" {
+		fmt.Fprintf(os.Stderr, "Exported %d requests to %s\n", len(logs), *output)
+	}
+}
+
+// writeCSV writes request logs as CSV with a header row of their fields,
+// named as in expressions. Timestamps are RFC 3339, headers are their JSON,
+// and tags are comma-separated.
+func writeCSV(w io.Writer, logs []database.RequestLog, fields []string) error {
+	known := make(map[string]bool, len(database.EnvVars))
+	for _, name := range database.EnvVars {
+		known[name] = true
+	}
+	for _, name := range fields {
+		if !known[name] {
+			return fmt.Errorf("unknown field %q", name)
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(fields)
+	row := make([]string, len(fields))
+	for i := range logs {
+		l := &logs[i]
+		env := l.Env()
+		for j, name := range fields {
+			switch name {
+			case "timestamp":
+				row[j] = l.Timestamp.UTC().Format(time.RFC3339)
+			case "headers":
+				row[j] = l.Headers
+			case "tags":
+				row[j] = strings.Join(l.Tags, ",")
+			default:
+				row[j] = fmt.Sprint(env[name])
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
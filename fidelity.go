@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/fidelity"
+)
+
+// containerName matches characters Docker does not allow in container names
+var containerName = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// runFidelity runs the software each service spoofs in a Docker container,
+// replays the probe corpus against both, and records the fidelity score, so
+// that a scheduled run catches changes that make the spoof less realistic
+func runFidelity(args []string) {
+	fs := flag.NewFlagSet("fidelity", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the config file")
+	migrations := fs.String("migrations", "./migrations", "path to the migrations directory")
+	host := fs.String("host", "127.0.0.1", "host the spoof is running on")
+	services := fs.String("services", "", "comma-separated services to compare (default all with a reference)")
+	dockerHost := fs.String("docker", dockerHostDefault(), "Docker daemon address")
+	maxDrop := fs.Float64("max-drop", 0.05, "fall in score from the previous run counted as a regression")
+	timeout := fs.Duration("timeout", 10*time.Minute, "time allowed for each service, including pulling images")
+	verbose := fs.Bool("v", false, "print the fields that differ")
+	fs.Parse(args)
+
+	cfg := mustLoadConfig(*configPath)
+
+	db, err := database.Open(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := db.RunMigrations(*migrations); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+	logger := database.NewRequestLogger(db)
+
+	docker, err := fidelity.NewDocker(*dockerHost)
+	if err != nil {
+		log.Fatalf("Failed to create Docker client: %v", err)
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(*services, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			selected[name] = true
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tIMAGE\tSCORE\tPREVIOUS\tRESULT")
+	failed := 0
+	for _, svc := range cfg.GetEnabledServices() {
+		if len(selected) > 0 && !selected[svc.Name] {
+			continue
+		}
+		ref := fidelity.ReferenceFor(svc.Type, svc.Headers["Server"])
+		if !svc.SpeaksHTTP() || ref == nil || len(svc.Ports) == 0 {
+			if selected[svc.Name] {
+				log.Printf("Service %s has no reference to compare to", svc.Name)
+				failed++
+			}
+			continue
+		}
+		delete(selected, svc.Name)
+
+		run, err := compareToReference(cfg, &svc, ref, docker, *host, *timeout)
+		if err != nil {
+			log.Printf("Failed to compare service %s: %v", svc.Name, err)
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\tERROR\n", svc.Name, ref.Image)
+			failed++
+			continue
+		}
+		previous, err := logger.GetLastFidelityRun(svc.Name, ref.Image)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			log.Fatalf("Failed to get previous fidelity run: %v", err)
+		}
+		if err := logger.SaveFidelityRun(run); err != nil {
+			log.Fatalf("Failed to save fidelity run: %v", err)
+		}
+
+		result, prevScore := "OK", "-"
+		if previous != nil {
+			prevScore = fmt.Sprintf("%.1f%%", previous.Score*100)
+			if previous.Score-run.Score > *maxDrop {
+				result = "REGRESSED"
+				failed++
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%s\t%s\n", svc.Name, ref.Image, run.Score*100, prevScore, result)
+		if *verbose {
+			for _, d := range run.Differences {
+				fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t\n", d.Probe, d.Field, orAbsent(d.Want), orAbsent(d.Got))
+			}
+		}
+	}
+	for name := range selected {
+		log.Printf("Service %s is not enabled", name)
+		failed++
+	}
+	tw.Flush()
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// compareToReference starts the reference for a service and replays the
+// corpus against both
+func compareToReference(cfg *config.Config, svc *config.ServiceConfig, ref *fidelity.Reference,
+	docker *fidelity.Docker, host string, timeout time.Duration) (*database.FidelityRun, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	name := "service-spoof-fidelity-" + containerName.ReplaceAllString(svc.Name, "-")
+	container, stop, err := docker.Start(ctx, name, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	// Both are addressed by the same Host, one the service answers to
+	vhost := "localhost"
+	if len(svc.Hosts) > 0 {
+		vhost = svc.Hosts[0]
+	}
+	reference := fidelity.Target{Addr: container.Addr, Host: vhost}
+	spoof := fidelity.Target{
+		Addr: net.JoinHostPort(host, strconv.Itoa(svc.Ports[0])),
+		TLS:  cfg.GetTls(svc).CertFilePath != "",
+		Host: vhost,
+	}
+
+	result, err := fidelity.Run(ctx, fidelity.Corpus, reference, spoof)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &database.FidelityRun{
+		Timestamp:   time.Now(),
+		ServiceName: svc.Name,
+		Image:       ref.Image,
+		Score:       result.Score(),
+		Probes:      len(result.Probes),
+		Compared:    result.Compared(),
+	}
+	for _, p := range result.Probes {
+		for _, d := range p.Report.Differences {
+			run.Differences = append(run.Differences, database.FidelityDifference{
+				Probe: p.Probe, Field: d.Field, Want: d.Want, Got: d.Got,
+			})
+		}
+	}
+	return run, nil
+}
+
+// dockerHostDefault returns the Docker daemon named by DOCKER_HOST, or the
+// local socket
+func dockerHostDefault() string {
+	if h := os.Getenv("DOCKER_HOST"); h != "" {
+		return h
+	}
+	return fidelity.DefaultDockerHost
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+// runFingerprints inspects the JA4 or JA3 fingerprints of a running instance
+// through its admin API: the in-memory store of recent connections, and the
+// fingerprints logged most often in the database
+func runFingerprints(args []string) {
+	fs := flag.NewFlagSet("fingerprints", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the config file")
+	kind := fs.String("type", "ja4", "fingerprint type, ja4, ja3, or ja4h")
+	host := fs.String("host", "127.0.0.1", "host the admin API is running on")
+	window := fs.Duration("window", 24*time.Hour, "lookback window for top")
+	limit := fs.Int("limit", 20, "maximum number of fingerprints for top, 0 for all")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-spoof fingerprints [flags] list | search QUERY | clear | top")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg := mustLoadConfig(*configPath)
+	if !cfg.Admin.Enabled {
+		log.Fatalf("The admin API is not enabled in %s", *configPath)
+	}
+	base := fmt.Sprintf("http://%s:%d", *host, cfg.Admin.Port)
+
+	call := func(method, path string, v any) {
+		req, err := http.NewRequest(method, base+path, nil)
+		if err != nil {
+			log.Fatalf("Failed to create request: %v", err)
+		}
+		if cfg.Admin.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+cfg.Admin.Token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			log.Fatalf("Failed to reach admin API: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			log.Fatalf("Admin API returned %s: %s", resp.Status, body)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			log.Fatalf("Failed to decode admin API response: %v", err)
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	switch fs.Arg(0) {
+	case "list", "search":
+		query := ""
+		if fs.Arg(0) == "search" {
+			if fs.NArg() < 2 {
+				fs.Usage()
+				os.Exit(2)
+			}
+			query = fs.Arg(1)
+		}
+		var entries []fingerprint.Entry
+		call(http.MethodGet, "/api/fingerprints?type="+url.QueryEscape(*kind)+"&q="+url.QueryEscape(query), &entries)
+		fmt.Fprintln(tw, "FINGERPRINT\tCOUNT\tFIRST SEEN\tLAST SEEN\tLAST SOURCE")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", e.Fingerprint, e.Count,
+				e.FirstSeen.Format(time.RFC3339), e.LastSeen.Format(time.RFC3339), e.LastSource)
+		}
+	case "clear":
+		var result map[string]int
+		call(http.MethodDelete, "/api/fingerprints?type="+url.QueryEscape(*kind), &result)
+		fmt.Fprintf(tw, "Cleared %d fingerprints\n", result["cleared"])
+	case "top":
+		var counts []database.FingerprintCount
+		call(http.MethodGet, fmt.Sprintf("/api/fingerprints/top?type=%s&window=%s&limit=%d", url.QueryEscape(*kind), *window, *limit), &counts)
+		fmt.Fprintln(tw, "FINGERPRINT\tREQUESTS\tSOURCES")
+		for _, c := range counts {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", c.Fingerprint, c.Requests, c.Sources)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// runRefingerprint recomputes the TLS fingerprints of logged requests from
+// the ClientHellos stored in the database, so that fixes and changes to the
+// fingerprint specs apply to past captures
+func runRefingerprint(args []string) {
+	fs := flag.NewFlagSet("refingerprint", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the config file")
+	dryRun := fs.Bool("dry-run", false, "report the requests that would change without updating them")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-spoof refingerprint [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg := mustLoadConfig(*configPath)
+
+	db, err := database.Open(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	results, err := database.NewRequestLogger(db).Refingerprint(context.Background(), *dryRun)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HELLO\tJA4\tJA3\tREQUESTS")
+	var hellos, requests, failed int64
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			failed++
+			fmt.Fprintf(tw, "%s\t%s\t\t\n", r.Hash[:12], r.Error)
+		case r.Requests > 0:
+			hellos++
+			requests += r.Requests
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", r.Hash[:12], r.JA4, r.JA3, r.Requests)
+		}
+	}
+	tw.Flush()
+
+	verb := "Updated"
+	if *dryRun {
+		verb = "Would update"
+	}
+	fmt.Printf("%s %d requests from %d of %d stored hellos", verb, requests, hellos, len(results))
+	if failed > 0 {
+		fmt.Printf(", %d could not be parsed", failed)
+	}
+	fmt.Println()
+}
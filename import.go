@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/importer"
+)
+
+// runImport converts scan output, a browser recording, or an API description
+// of a real host into service profiles and prints them as a config.yaml
+// services snippet
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "nmap", "input format: nmap, zgrab, har, or openapi")
+	input := fs.String("input", "", "path to the input file")
+	templateDir := fs.String("template-dir", "./services/imported", "directory to write response templates to")
+	output := fs.String("output", "", "file to write the services snippet to (default stdout)")
+	fs.Parse(args)
+
+	if *input == "" {
+		log.Fatalf("-input is required")
+	}
+
+	f, err := os.Open(*input)
+	if err != nil {
+		log.Fatalf("Failed to open input: %v", err)
+	}
+	defer f.Close()
+
+	var services []config.ServiceConfig
+	switch *format {
+	case "nmap":
+		services, err = importer.ParseNmap(f)
+	case "zgrab":
+		services, err = importer.ParseZgrab(f, *templateDir)
+	case "har":
+		services, err = importer.ParseHAR(f, *templateDir)
+	case "openapi":
+		services, err = importer.ParseOpenAPI(f, *templateDir)
+	default:
+		log.Fatalf("Unknown format %q", *format)
+	}
+	if err != nil {
+		log.Fatalf("Failed to import %s output: %v", *format, err)
+	}
+
+	writeServices(services, *output)
+}
+
+// writeServices writes generated services as YAML to a file or stdout
+func writeServices(services []config.ServiceConfig, output string) {
+	out, err := importer.MarshalServices(services)
+	if err != nil {
+		log.Fatalf("Failed to generate config: %v", err)
+	}
+
+	if output == "" {
+		os.Stdout.Write(out)
+		return
+	}
+
+	if err := os.WriteFile(output, out, 0644); err != nil {
+		log.Fatalf("Failed to write %s: %v", output, err)
+	}
+	log.Printf("Wrote %d services to %s", len(services), output)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/davidthuman/service-spoof/internal/bootstrap"
+)
+
+// starterFiles are the templates and migrations init writes beside the
+// starter config
+//
+//go:embed migrations/*.sql services/*/*
+var starterFiles embed.FS
+
+// runInit lays out a new deployment in a directory, ready to start the spoof
+// from
+func runInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	hostname := fs.String("hostname", "", "hostname the self-signed certificate is issued for, the machine's by default")
+	force := fs.Bool("force", false, "overwrite files already there")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-spoof init [flags] [DIR]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+	if *hostname == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			h = "localhost"
+		}
+		*hostname = h
+	}
+
+	steps, err := bootstrap.Run(bootstrap.Options{
+		Dir:      dir,
+		Files:    starterFiles,
+		Hostname: *hostname,
+		Force:    *force,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize %s: %v", dir, err)
+	}
+
+	for _, step := range steps {
+		action := "kept"
+		if step.Created {
+			action = "created"
+		}
+		fmt.Printf("%-8s %s\n", action, step.Path)
+	}
+	fmt.Printf("\nRun service-spoof from %s to start the spoof\n", dir)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/certs"
+)
+
+// certificateStatus is a served certificate with the time it has left
+type certificateStatus struct {
+	certs.Certificate
+	ExpiresInDays float64 `json:"expires_in_days"`
+	Expired       bool    `json:"expired"`
+}
+
+// handleCertificates serves every certificate the listeners present, soonest
+// to expire first
+func (s *Server) handleCertificates(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	certificates := s.stats.Certificates()
+
+	result := make([]certificateStatus, len(certificates))
+	for i, cert := range certificates {
+		left := cert.ExpiresIn(now)
+		result[i] = certificateStatus{
+			Certificate:   cert,
+			ExpiresInDays: float64(left.Round(time.Hour)) / float64(24*time.Hour),
+			Expired:       left < 0,
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].NotAfter.Before(result[j].NotAfter) })
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/textdiff"
+)
+
+// handleConfigHistory serves every configuration the honeypot has run with,
+// most recently loaded first. Request logs carry the ID of the configuration
+// that answered them as config_id.
+func (s *Server) handleConfigHistory(w http.ResponseWriter, r *http.Request) {
+	history, err := s.logger.GetConfigHistory()
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// handleConfigSnapshot serves the redacted YAML snapshot of a configuration
+func (s *Server) handleConfigSnapshot(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid id: %q", r.PathValue("id")))
+		return
+	}
+
+	snapshot, ok := s.configSnapshot(w, id)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, snapshot)
+}
+
+// handleConfigDiff serves a unified diff between two configuration
+// snapshots.
+//
+// Query parameters:
+//   - from: ID of the old configuration, defaults to the one loaded before to
+//   - to: ID of the new configuration, defaults to the most recently loaded
+func (s *Server) handleConfigDiff(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	from, ok := intParam(w, q.Get("from"), "from")
+	if !ok {
+		return
+	}
+	to, ok := intParam(w, q.Get("to"), "to")
+	if !ok {
+		return
+	}
+
+	if from == 0 || to == 0 {
+		history, err := s.logger.GetConfigHistory()
+		if err != nil {
+			writeDatabaseError(w, err)
+			return
+		}
+		if to == 0 && len(history) > 0 {
+			to = int(history[0].ID)
+		}
+		if from == 0 {
+			for i, g := range history {
+				if int(g.ID) == to && i+1 < len(history) {
+					from = int(history[i+1].ID)
+					break
+				}
+			}
+		}
+		if from == 0 || to == 0 {
+			writeError(w, http.StatusNotFound, "no earlier configuration to compare")
+			return
+		}
+	}
+
+	old, ok := s.configSnapshot(w, int64(from))
+	if !ok {
+		return
+	}
+	cur, ok := s.configSnapshot(w, int64(to))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-diff")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, textdiff.Unified(
+		fmt.Sprintf("config/%d", from),
+		fmt.Sprintf("config/%d", to),
+		old, cur,
+	))
+}
+
+// configSnapshot looks up a configuration snapshot, writing an error
+// response if it cannot
+func (s *Server) configSnapshot(w http.ResponseWriter, id int64) (string, bool) {
+	snapshot, err := s.logger.GetConfigSnapshot(id)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no configuration with id %d", id))
+		return "", false
+	}
+	if err != nil {
+		writeDatabaseError(w, err)
+		return "", false
+	}
+	return snapshot, true
+}
@@ -0,0 +1,20 @@
+package api
+
+import "net/http"
+
+// handleFidelity serves the runs of the fidelity subcommand, most recent
+// first, optionally only those of the service named by the service parameter
+func (s *Server) handleFidelity(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, ok := intParam(w, q.Get("limit"), "limit")
+	if !ok {
+		return
+	}
+
+	runs, err := s.logger.GetFidelityRuns(q.Get("service"), limit)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+// defaultFingerprintWindow is used when no window query parameter is given
+const defaultFingerprintWindow = 24 * time.Hour
+
+// SetFingerprints serves the in-memory JA4 fingerprint store
+func (s *Server) SetFingerprints(store *fingerprint.Store) {
+	s.fingerprints = store
+}
+
+// SetJA3Fingerprints serves the in-memory JA3 fingerprint store
+func (s *Server) SetJA3Fingerprints(store *fingerprint.Store) {
+	s.ja3 = store
+}
+
+// fingerprintType returns the fingerprint type named by the type query
+// parameter, ja4 by default, writing an error response if it is unknown
+func fingerprintType(w http.ResponseWriter, r *http.Request) (string, bool) {
+	kind := r.URL.Query().Get("type")
+	if kind == "" {
+		return "ja4", true
+	}
+	if _, ok := database.FingerprintColumns[kind]; !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid type: %q", kind))
+		return "", false
+	}
+	return kind, true
+}
+
+// fingerprintStore returns the in-memory store of the requested fingerprint
+// type, writing an error response if there is none
+func (s *Server) fingerprintStore(w http.ResponseWriter, r *http.Request) (*fingerprint.Store, bool) {
+	kind, ok := fingerprintType(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	// JA4H fingerprints are only kept in the database
+	var store *fingerprint.Store
+	switch kind {
+	case "ja4":
+		store = s.fingerprints
+	case "ja3":
+		store = s.ja3
+	}
+	if store == nil {
+		writeError(w, http.StatusNotFound, "fingerprint store unavailable")
+		return nil, false
+	}
+	return store, true
+}
+
+// handleFingerprints serves an in-memory fingerprint store, most seen first.
+//
+// Query parameters:
+//   - type: ja4 or ja3, defaults to ja4; ja4h has no in-memory store
+//   - q: only include fingerprints containing this substring
+func (s *Server) handleFingerprints(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.fingerprintStore(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, store.Search(r.URL.Query().Get("q")))
+}
+
+// handleClearFingerprints empties an in-memory fingerprint store, selected
+// by the type query parameter
+func (s *Server) handleClearFingerprints(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.fingerprintStore(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"cleared": store.Clear()})
+}
+
+// handleTopFingerprints serves the fingerprints logged most often in a time
+// window.
+//
+// Query parameters:
+//   - type: ja4, ja3, or ja4h, defaults to ja4
+//   - window: lookback duration (e.g. 1h, 24h, 168h), defaults to 24h
+//   - limit: maximum number of fingerprints, defaults to all
+func (s *Server) handleTopFingerprints(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	kind, ok := fingerprintType(w, r)
+	if !ok {
+		return
+	}
+
+	window := defaultFingerprintWindow
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid window: %q", v))
+			return
+		}
+		window = d
+	}
+
+	limit, ok := intParam(w, q.Get("limit"), "limit")
+	if !ok {
+		return
+	}
+
+	counts, err := s.logger.GetTopFingerprints(kind, time.Now().Add(-window), limit)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, counts)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/reputation"
+)
+
+// defaultIOCWindow is used when no window query parameter is given
+const defaultIOCWindow = 24 * time.Hour
+
+// handleIOCs serves deduplicated indicators for a time window.
+//
+// Query parameters:
+//   - window: lookback duration (e.g. 1h, 24h, 168h), defaults to 24h
+//   - type: comma separated IOC types to include (ip, url, hash, ja4)
+//   - flag: comma separated source flags every request must carry (tor,
+//     datacenter, proxy)
+//   - exclude_scanners: leave out requests from known research scanners
+//   - format: json (default), csv, or plain (one value per line)
+func (s *Server) handleIOCs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	window := defaultIOCWindow
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid window: %q", v))
+			return
+		}
+		window = d
+	}
+
+	types := make(map[string]bool)
+	if v := q.Get("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			switch t {
+			case database.IOCTypeIP, database.IOCTypeURL, database.IOCTypeHash, database.IOCTypeJA4:
+				types[t] = true
+			default:
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid type: %q", t))
+				return
+			}
+		}
+	}
+
+	var require reputation.Flags
+	if v := q.Get("flag"); v != "" {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			switch f {
+			case "tor":
+				require.Tor = true
+			case "datacenter":
+				require.Datacenter = true
+			case "proxy":
+				require.Proxy = true
+			default:
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid flag: %q", f))
+				return
+			}
+		}
+	}
+
+	excludeScanners, ok := boolParam(w, q.Get("exclude_scanners"), "exclude_scanners")
+	if !ok {
+		return
+	}
+
+	iocs, err := s.logger.GetIOCs(time.Now().Add(-window), require, excludeScanners)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	// Filter by requested types
+	if len(types) > 0 {
+		filtered := make([]database.IOC, 0, len(iocs))
+		for _, ioc := range iocs {
+			if types[ioc.Type] {
+				filtered = append(filtered, ioc)
+			}
+		}
+		iocs = filtered
+	}
+
+	switch q.Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, iocs)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"type", "value", "count", "first_seen", "last_seen", "tor", "datacenter", "proxy"})
+		for _, ioc := range iocs {
+			cw.Write([]string{
+				ioc.Type,
+				ioc.Value,
+				fmt.Sprint(ioc.Count),
+				ioc.FirstSeen.UTC().Format(time.RFC3339),
+				ioc.LastSeen.UTC().Format(time.RFC3339),
+				fmt.Sprint(ioc.Flags.Tor),
+				fmt.Sprint(ioc.Flags.Datacenter),
+				fmt.Sprint(ioc.Flags.Proxy),
+			})
+		}
+		cw.Flush()
+	case "plain":
+		// Plain output is meant for direct firewall/EDR ingestion, so only
+		// the values are written
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, ioc := range iocs {
+			fmt.Fprintln(w, ioc.Value)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid format: %q", q.Get("format")))
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/middleware"
+)
+
+// handleListeners serves per-listener connection statistics keyed by listen
+// address
+func (s *Server) handleListeners(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.stats.ListenerStats())
+}
+
+// handleStats serves what each listener has answered since startup, the
+// busiest first. active=true leaves out listeners that have answered nothing.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats := s.stats.Stats()
+	if r.URL.Query().Get("active") == "true" {
+		active := make([]middleware.PortStats, 0, len(stats))
+		for _, st := range stats {
+			if st.Requests > 0 {
+				active = append(active, st)
+			}
+		}
+		stats = active
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleMetrics serves per-listener connection statistics in the Prometheus
+// text exposition format, labelled by address and port, and the expiry of
+// every served certificate
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	stats := s.stats.ListenerStats()
+
+	addrs := make([]string, 0, len(stats))
+	for addr := range stats {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	metrics := []struct {
+		name  string
+		kind  string
+		help  string
+		value func(middleware.ListenerStats) float64
+	}{
+		{"servicespoof_listener_active_connections", "gauge", "Open connections.",
+			func(st middleware.ListenerStats) float64 { return float64(st.ActiveConns) }},
+		{"servicespoof_listener_max_connections", "gauge", "Configured connection limit, 0 for none.",
+			func(st middleware.ListenerStats) float64 { return float64(st.MaxConns) }},
+		{"servicespoof_listener_accepted_total", "counter", "Accepted connections.",
+			func(st middleware.ListenerStats) float64 { return float64(st.Accepted) }},
+		{"servicespoof_listener_accepts_per_second", "gauge", "Accepted connections per second over the last minute.",
+			func(st middleware.ListenerStats) float64 { return st.AcceptsPerSecond }},
+		{"servicespoof_listener_rejected_total", "counter", "Connections closed for exceeding the connection limit.",
+			func(st middleware.ListenerStats) float64 { return float64(st.Rejected) }},
+		{"servicespoof_listener_handshake_failures_total", "counter", "Failed TLS handshakes.",
+			func(st middleware.ListenerStats) float64 { return float64(st.HandshakeFailures) }},
+		{"servicespoof_listener_timeouts_total", "counter", "Connection reads and writes that timed out.",
+			func(st middleware.ListenerStats) float64 { return float64(st.Timeouts) }},
+	}
+
+	var b strings.Builder
+	for _, metric := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", metric.name, metric.kind)
+		for _, addr := range addrs {
+			host, port, _ := net.SplitHostPort(addr)
+			fmt.Fprintf(&b, "%s{address=\"%s\",port=\"%s\"} %g\n", metric.name, host, port, metric.value(stats[addr]))
+		}
+	}
+
+	const notAfter = "servicespoof_certificate_not_after_seconds"
+	fmt.Fprintf(&b, "# HELP %s Expiry of a served certificate as a Unix timestamp.\n", notAfter)
+	fmt.Fprintf(&b, "# TYPE %s gauge\n", notAfter)
+	for _, cert := range s.stats.Certificates() {
+		fmt.Fprintf(&b, "%s{path=%q,subject=%q} %d\n", notAfter, cert.Path, cert.Subject, cert.NotAfter.Unix())
+	}
+
+	if ws, ok := s.logger.WriterStats(); ok {
+		fmt.Fprintf(&b, "# HELP servicespoof_log_queue_length Request logs waiting to be written.\n")
+		fmt.Fprintf(&b, "# TYPE servicespoof_log_queue_length gauge\n")
+		fmt.Fprintf(&b, "servicespoof_log_queue_length %d\n", ws.Queued)
+		fmt.Fprintf(&b, "# HELP servicespoof_log_queue_capacity Request logs the queue holds.\n")
+		fmt.Fprintf(&b, "# TYPE servicespoof_log_queue_capacity gauge\n")
+		fmt.Fprintf(&b, "servicespoof_log_queue_capacity %d\n", ws.Capacity)
+		fmt.Fprintf(&b, "# HELP servicespoof_log_queue_dropped_total Request logs dropped or timed out while the queue was full.\n")
+		fmt.Fprintf(&b, "# TYPE servicespoof_log_queue_dropped_total counter\n")
+		fmt.Fprintf(&b, "servicespoof_log_queue_dropped_total %d\n", ws.Dropped)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+const (
+	// defaultLogLimit and maxLogLimit bound the requests /api/logs returns
+	defaultLogLimit = 100
+	maxLogLimit     = 1000
+
+	// defaultStatsWindow is used when no window query parameter is given
+	defaultStatsWindow = 24 * time.Hour
+)
+
+// handleLogs serves logged requests, newest first by default.
+//
+// Query parameters:
+//   - source_ip, ja4, ja3, ja4h, service, method, path, country, tag: only
+//     include requests matching each exactly
+//   - port: only include requests to this server port
+//   - path_prefix: only include requests for paths starting with this
+//   - status: only include requests answered with this status code
+//   - since, until: RFC 3339 time range
+//   - window: lookback duration (e.g. 1h), instead of since
+//   - order: newest or oldest first
+//   - cursor: only include requests after the one with this ID in the order,
+//     for paging by the ID of the last request of the previous page
+//   - limit: maximum number of requests, defaults to 100 and at most 1000
+//   - offset: number of requests to skip, for paging
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	f, ok := logFilter(w, r.URL.Query(), defaultLogLimit, maxLogLimit)
+	if !ok {
+		return
+	}
+
+	logs, err := s.logger.Query(f)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, logs)
+}
+
+// logFilter parses the query parameters selecting logged requests, writing
+// an error response and returning false if one is invalid. A limit of 0 is
+// defaultLimit, and limits are at most maxLimit.
+func logFilter(w http.ResponseWriter, q url.Values, defaultLimit, maxLimit int) (database.LogFilter, bool) {
+	f := database.LogFilter{
+		JA4:        q.Get("ja4"),
+		JA3:        q.Get("ja3"),
+		JA4H:       q.Get("ja4h"),
+		Service:    q.Get("service"),
+		Method:     q.Get("method"),
+		Path:       q.Get("path"),
+		PathPrefix: q.Get("path_prefix"),
+		Country:    q.Get("country"),
+		Tag:        q.Get("tag"),
+		Order:      q.Get("order"),
+	}
+	if f.Order != "" && f.Order != database.OrderNewest && f.Order != database.OrderOldest {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid order: %q", f.Order))
+		return f, false
+	}
+
+	// Source IPs are stored in canonical form
+	if v := q.Get("source_ip"); v != "" {
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid source_ip: %q", v))
+			return f, false
+		}
+		f.SourceIP = addr.Unmap().WithZone("").String()
+	}
+
+	if v := q.Get("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil || status < 100 || status > 599 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid status: %q", v))
+			return f, false
+		}
+		f.Status = status
+	}
+
+	if v := q.Get("port"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil || port < 1 || port > 65535 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid port: %q", v))
+			return f, false
+		}
+		f.Port = port
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || cursor < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid cursor: %q", v))
+			return f, false
+		}
+		f.Cursor = cursor
+	}
+
+	var ok bool
+	if f.Since, ok = timeParam(w, q.Get("since"), "since"); !ok {
+		return f, false
+	}
+	if f.Until, ok = timeParam(w, q.Get("until"), "until"); !ok {
+		return f, false
+	}
+	if v := q.Get("window"); v != "" {
+		window, ok := windowParam(w, v, 0)
+		if !ok {
+			return f, false
+		}
+		f.Since = time.Now().Add(-window)
+	}
+
+	if f.Limit, ok = intParam(w, q.Get("limit"), "limit"); !ok {
+		return f, false
+	}
+	if f.Limit == 0 {
+		f.Limit = defaultLimit
+	}
+	f.Limit = min(f.Limit, maxLimit)
+	if f.Offset, ok = intParam(w, q.Get("offset"), "offset"); !ok {
+		return f, false
+	}
+
+	return f, true
+}
+
+// handleTopPaths serves the paths requested most often in a time window.
+//
+// Query parameters:
+//   - window: lookback duration (e.g. 1h, 24h, 168h), defaults to 24h
+//   - service: only count requests to this service
+//   - limit: maximum number of paths, defaults to all
+func (s *Server) handleTopPaths(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	window, ok := windowParam(w, q.Get("window"), defaultStatsWindow)
+	if !ok {
+		return
+	}
+	limit, ok := intParam(w, q.Get("limit"), "limit")
+	if !ok {
+		return
+	}
+
+	counts, err := s.logger.GetTopPaths(time.Now().Add(-window), q.Get("service"), limit)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, counts)
+}
+
+// handleServices serves the requests each service answered in a time window,
+// busiest first.
+//
+// Query parameters:
+//   - window: lookback duration (e.g. 1h, 24h, 168h), defaults to 24h
+func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
+	window, ok := windowParam(w, r.URL.Query().Get("window"), defaultStatsWindow)
+	if !ok {
+		return
+	}
+
+	services, err := s.logger.GetServiceActivity(time.Now().Add(-window))
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, services)
+}
+
+// windowParam parses an optional lookback duration query parameter, writing
+// an error response if it is invalid
+func windowParam(w http.ResponseWriter, v string, def time.Duration) (time.Duration, bool) {
+	if v == "" {
+		return def, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid window: %q", v))
+		return 0, false
+	}
+	return d, true
+}
+
+// timeParam parses an optional RFC 3339 time query parameter, writing an
+// error response if it is invalid
+func timeParam(w http.ResponseWriter, v, name string) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %q", name, v))
+		return time.Time{}, false
+	}
+	return t, true
+}
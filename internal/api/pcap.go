@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/pcap"
+)
+
+const (
+	// defaultPcapLimit and maxPcapLimit bound the requests /api/logs/pcap
+	// exports
+	defaultPcapLimit = 10000
+	maxPcapLimit     = 100000
+)
+
+// handleLogsPcap serves logged requests as a libpcap file for Wireshark or
+// Zeek, each reconstructed as a TCP connection of its own, oldest first by
+// default.
+//
+// Query parameters are those of /api/logs, with a limit that defaults to
+// 10000 and is at most 100000, and:
+//   - server: address requests were sent to, defaults to 192.0.2.1 or
+//     2001:db8::1 since it is not logged
+func (s *Server) handleLogsPcap(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, ok := logFilter(w, q, defaultPcapLimit, maxPcapLimit)
+	if !ok {
+		return
+	}
+	if f.Order == "" {
+		f.Order = database.OrderOldest
+	}
+
+	var server netip.Addr
+	if v := q.Get("server"); v != "" {
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid server: %q", v))
+			return
+		}
+		server = addr.Unmap()
+	}
+
+	logs, err := s.logger.Query(f)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "service-spoof-"+time.Now().UTC().Format("20060102T150405Z")+".pcap"))
+	pw, err := pcap.NewWriter(w)
+	if err != nil {
+		apiLog.Error("failed to export pcap", "err", err)
+		return
+	}
+	for i := range logs {
+		if err := pw.WriteLog(&logs[i], server); err != nil {
+			apiLog.Error("failed to export pcap", "err", err)
+			return
+		}
+	}
+}
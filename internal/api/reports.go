@@ -0,0 +1,179 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+// maxReportBytes bounds the size of a report saved through the API
+const maxReportBytes = 64 << 10
+
+// Where a report was defined
+const (
+	reportSourceConfig = "config"
+	reportSourceAPI    = "api"
+)
+
+// report is a saved query and where it was defined
+type report struct {
+	config.ReportConfig
+	Source string `json:"source"`
+}
+
+// reportResult is the rows a report returned
+type reportResult struct {
+	Name string `json:"name"`
+	*database.ReportResult
+}
+
+// findReport returns the report of a name, from the configuration or saved
+// through the API, or nil if there is none
+func (s *Server) findReport(name string) (*report, error) {
+	for _, r := range s.config.Reports {
+		if r.Name == name {
+			return &report{ReportConfig: r, Source: reportSourceConfig}, nil
+		}
+	}
+	saved, err := s.logger.GetReport(name)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report{ReportConfig: *saved, Source: reportSourceAPI}, nil
+}
+
+// handleReports serves the reports defined in the configuration, then those
+// saved through the API
+func (s *Server) handleReports(w http.ResponseWriter, r *http.Request) {
+	saved, err := s.logger.GetReports()
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	reports := make([]report, 0, len(s.config.Reports)+len(saved))
+	for _, rc := range s.config.Reports {
+		reports = append(reports, report{ReportConfig: rc, Source: reportSourceConfig})
+	}
+	for _, rc := range saved {
+		reports = append(reports, report{ReportConfig: rc, Source: reportSourceAPI})
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// handleSaveReport saves a report posted as JSON, replacing any saved under
+// the same name. Reports defined in the configuration cannot be replaced.
+func (s *Server) handleSaveReport(w http.ResponseWriter, r *http.Request) {
+	var rc config.ReportConfig
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReportBytes)).Decode(&rc); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid report: %v", err))
+		return
+	}
+	if err := rc.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid report: %v", err))
+		return
+	}
+	for _, c := range s.config.Reports {
+		if c.Name == rc.Name {
+			writeError(w, http.StatusConflict, fmt.Sprintf("report %s is defined in the configuration", rc.Name))
+			return
+		}
+	}
+	if err := s.logger.CheckReport(rc.Query); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid report: %v", err))
+		return
+	}
+
+	if err := s.logger.SaveReport(&rc); err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, report{ReportConfig: rc, Source: reportSourceAPI})
+}
+
+// handleDeleteReport deletes a report saved through the API
+func (s *Server) handleDeleteReport(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	for _, c := range s.config.Reports {
+		if c.Name == name {
+			writeError(w, http.StatusConflict, fmt.Sprintf("report %s is defined in the configuration", name))
+			return
+		}
+	}
+
+	err := s.logger.DeleteReport(name)
+	if errors.Is(err, database.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no report %s", name))
+		return
+	}
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRunReport runs a report and serves the rows it returned.
+//
+// Query parameters are the report's declared parameters; any other is
+// rejected. Parameters not given take their defaults, or are NULL.
+func (s *Server) handleRunReport(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	rep, err := s.findReport(name)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	if rep == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no report %s", name))
+		return
+	}
+
+	q := r.URL.Query()
+	declared := make(map[string]bool, len(rep.Params))
+	args := make([]any, 0, len(rep.Params))
+	for i := range rep.Params {
+		p := &rep.Params[i]
+		declared[p.Name] = true
+
+		v := q.Get(p.Name)
+		if v == "" {
+			v = p.Default
+		}
+		if v == "" {
+			if p.Required {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("%s is required", p.Name))
+				return
+			}
+			args = append(args, sql.Named(p.Name, nil))
+			continue
+		}
+		value, err := p.Parse(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		args = append(args, sql.Named(p.Name, value))
+	}
+	for param := range q {
+		if !declared[param] {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown parameter %s", param))
+			return
+		}
+	}
+
+	result, err := s.logger.RunReport(r.Context(), rep.Query, args...)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reportResult{Name: rep.Name, ReportResult: result})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+// handleScans serves scan events active in a time window, each listing the
+// ports one source hit in order and how quickly, most recent first.
+//
+// Query parameters:
+//   - window: lookback duration (e.g. 1h, 24h, 168h), defaults to 24h
+//   - pattern: only include fast (SYN-scan-like) or slow scans
+//   - limit: maximum number of scan events, defaults to all
+func (s *Server) handleScans(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	window := defaultSessionWindow
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid window: %q", v))
+			return
+		}
+		window = d
+	}
+
+	pattern := q.Get("pattern")
+	switch pattern {
+	case "", database.ScanPatternFast, database.ScanPatternSlow:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid pattern: %q", pattern))
+		return
+	}
+
+	limit, ok := intParam(w, q.Get("limit"), "limit")
+	if !ok {
+		return
+	}
+
+	events, err := s.logger.GetScanEvents(time.Now().Add(-window), pattern, limit)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
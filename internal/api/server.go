@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/certs"
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/dashboard"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+	"github.com/davidthuman/service-spoof/internal/logging"
+	"github.com/davidthuman/service-spoof/internal/middleware"
+	"github.com/davidthuman/service-spoof/internal/ssrf"
+)
+
+// apiLog logs the admin API
+var apiLog = logging.Logger("api")
+
+// StatsSource provides listener statistics keyed by listen address, what
+// each listener has answered, and the certificates the listeners serve
+type StatsSource interface {
+	ListenerStats() map[string]middleware.ListenerStats
+	Stats() []middleware.PortStats
+	Certificates() []certs.Certificate
+}
+
+// Server serves the internal admin API on a separate port
+type Server struct {
+	config *config.AdminConfig
+	logger *database.RequestLogger
+	stats  StatsSource
+	server *http.Server
+
+	fingerprints *fingerprint.Store
+	ja3          *fingerprint.Store
+	ssrf         *ssrf.Catcher
+}
+
+// NewServer creates a new admin API server
+func NewServer(cfg *config.AdminConfig, logger *database.RequestLogger, stats StatsSource) *Server {
+	s := &Server{
+		config: cfg,
+		logger: logger,
+		stats:  stats,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/certificates", s.handleCertificates)
+	mux.HandleFunc("GET /api/config/diff", s.handleConfigDiff)
+	mux.HandleFunc("GET /api/config/history", s.handleConfigHistory)
+	mux.HandleFunc("GET /api/config/history/{id}", s.handleConfigSnapshot)
+	mux.HandleFunc("GET /api/fidelity", s.handleFidelity)
+	mux.HandleFunc("GET /api/fingerprints", s.handleFingerprints)
+	mux.HandleFunc("DELETE /api/fingerprints", s.handleClearFingerprints)
+	mux.HandleFunc("GET /api/fingerprints/top", s.handleTopFingerprints)
+	mux.HandleFunc("GET /api/iocs", s.handleIOCs)
+	mux.HandleFunc("GET /api/listeners", s.handleListeners)
+	mux.HandleFunc("GET /api/logs", s.handleLogs)
+	mux.HandleFunc("GET /api/logs/pcap", s.handleLogsPcap)
+	mux.HandleFunc("GET /api/reports", s.handleReports)
+	mux.HandleFunc("POST /api/reports", s.handleSaveReport)
+	mux.HandleFunc("GET /api/reports/{name}", s.handleRunReport)
+	mux.HandleFunc("DELETE /api/reports/{name}", s.handleDeleteReport)
+	mux.HandleFunc("GET /api/scans", s.handleScans)
+	mux.HandleFunc("GET /api/services", s.handleServices)
+	mux.HandleFunc("GET /api/sessions", s.handleSessions)
+	mux.HandleFunc("GET /api/ssrf", s.handleSSRFHits)
+	mux.HandleFunc("POST /api/ssrf/callbacks", s.handleSSRFCallback)
+	mux.HandleFunc("GET /api/stats", s.handleStats)
+	mux.HandleFunc("GET /api/stats/top-paths", s.handleTopPaths)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.Handle("GET /dashboard/", dashboard.New(logger))
+	if cfg.Pprof {
+		// Profiles are bounded by the write timeout, so CPU profiles and
+		// traces must be shorter than it
+		mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+		mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	}
+
+	s.server = &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           s.authenticate(mux),
+		ReadHeaderTimeout: config.DefaultTimeouts.ReadHeaderTimeout,
+		ReadTimeout:       config.DefaultTimeouts.ReadTimeout,
+		WriteTimeout:      config.DefaultTimeouts.WriteTimeout,
+		IdleTimeout:       config.DefaultTimeouts.IdleTimeout,
+	}
+
+	return s
+}
+
+// Start starts the admin API server and blocks until it is shut down
+func (s *Server) Start(ctx context.Context) error {
+	apiLog.Info("starting admin API", "port", s.config.Port)
+
+	err := s.server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("admin API on port %d failed: %w", s.config.Port, err)
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down the admin API server
+func (s *Server) Shutdown(ctx context.Context) error {
+	apiLog.Info("shutting down admin API", "port", s.config.Port)
+	return s.server.Shutdown(ctx)
+}
+
+// authenticate requires the token on every request when one is configured,
+// as a bearer token or, so browsers can open the dashboard, as the password
+// of HTTP basic authentication with any username
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.Token != "" {
+			got := r.Header.Get("Authorization")
+			if _, password, ok := r.BasicAuth(); ok {
+				got = "Bearer " + password
+			}
+			want := "Bearer " + s.config.Token
+			if subtle.ConstantTimeCompare([]byte(want), []byte(got)) != 1 {
+				if strings.HasPrefix(r.URL.Path, "/dashboard") {
+					w.Header().Set("WWW-Authenticate", `Basic realm="service-spoof"`)
+				}
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		apiLog.Error("failed to encode admin API response", "err", err)
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// writeDatabaseError writes a JSON error response for a failed database
+// query. Queries that failed on a lock are worth retrying shortly, so they
+// are answered 503 with a Retry-After rather than 500.
+func writeDatabaseError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrLocked) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultSessionWindow is used when no window query parameter is given
+const defaultSessionWindow = 24 * time.Hour
+
+// handleSessions serves sessions active in a time window, highest
+// interaction score first.
+//
+// Query parameters:
+//   - window: lookback duration (e.g. 1h, 24h, 168h), defaults to 24h
+//   - min_score: only include sessions scoring at least this, defaults to 0
+//   - limit: maximum number of sessions, defaults to all
+//   - exclude_scanners: leave out sessions from known research scanners
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	window := defaultSessionWindow
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid window: %q", v))
+			return
+		}
+		window = d
+	}
+
+	minScore, ok := intParam(w, q.Get("min_score"), "min_score")
+	if !ok {
+		return
+	}
+	limit, ok := intParam(w, q.Get("limit"), "limit")
+	if !ok {
+		return
+	}
+
+	excludeScanners, ok := boolParam(w, q.Get("exclude_scanners"), "exclude_scanners")
+	if !ok {
+		return
+	}
+
+	sessions, err := s.logger.GetSessions(time.Now().Add(-window), minScore, limit, excludeScanners)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// intParam parses an optional non-negative integer query parameter, writing
+// an error response if it is invalid
+func intParam(w http.ResponseWriter, v, name string) (int, bool) {
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %q", name, v))
+		return 0, false
+	}
+	return n, true
+}
+
+// boolParam parses an optional boolean query parameter, writing an error
+// response if it is invalid
+func boolParam(w http.ResponseWriter, v, name string) (bool, bool) {
+	if v == "" {
+		return false, true
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: %q", name, v))
+		return false, false
+	}
+	return b, true
+}
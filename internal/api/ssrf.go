@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/ssrf"
+)
+
+// defaultSSRFWindow is used when no window query parameter is given
+const defaultSSRFWindow = 24 * time.Hour
+
+// maxCallbackBytes bounds the size of a reported callback
+const maxCallbackBytes = 64 << 10
+
+// SetSSRFCatcher correlates reported callbacks with the tokens the catcher
+// handed out
+func (s *Server) SetSSRFCatcher(catcher *ssrf.Catcher) {
+	s.ssrf = catcher
+}
+
+// handleSSRFHits serves the requests the SSRF catcher handed a token to,
+// most recent first, with the callbacks seen for each.
+//
+// Query parameters:
+//   - window: lookback duration (e.g. 1h, 24h, 168h), defaults to 24h
+//   - limit: maximum number of hits, defaults to all
+//   - callbacks: true to only include hits with callbacks
+func (s *Server) handleSSRFHits(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	window := defaultSSRFWindow
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid window: %q", v))
+			return
+		}
+		window = d
+	}
+
+	limit, ok := intParam(w, q.Get("limit"), "limit")
+	if !ok {
+		return
+	}
+	withCallbacks, ok := boolParam(w, q.Get("callbacks"), "callbacks")
+	if !ok {
+		return
+	}
+
+	hits, err := s.logger.GetSSRFHits(time.Now().Add(-window), limit, withCallbacks)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, hits)
+}
+
+// handleSSRFCallback records a callback reported by an outbound callback
+// catcher, such as a DNS or HTTP interaction server, and answers with the
+// hit its token was handed out to. The token is taken from the token field,
+// or found in data, such as a queried DNS name or requested URL.
+func (s *Server) handleSSRFCallback(w http.ResponseWriter, r *http.Request) {
+	if s.ssrf == nil {
+		writeError(w, http.StatusNotFound, "SSRF catcher disabled")
+		return
+	}
+
+	var cb ssrf.Callback
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCallbackBytes)).Decode(&cb); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid callback: %v", err))
+		return
+	}
+	if cb.Token == "" && cb.Data == "" {
+		writeError(w, http.StatusBadRequest, "token or data is required")
+		return
+	}
+
+	hit, err := s.ssrf.Correlate(r.Context(), &cb)
+	if err != nil {
+		writeDatabaseError(w, err)
+		return
+	}
+	if hit == nil {
+		writeError(w, http.StatusNotFound, "no handed out token found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, hit)
+}
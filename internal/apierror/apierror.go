@@ -0,0 +1,169 @@
+// Package apierror renders the JSON error bodies of web frameworks, so API
+// scanners see errors consistent with the framework a service claims to run
+package apierror
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// Format writes errors as a framework does
+type Format struct {
+	framework string
+}
+
+// New returns the error format of a framework, or nil for a nil config
+func New(cfg *config.APIConfig) *Format {
+	if cfg == nil {
+		return nil
+	}
+	return &Format{framework: cfg.Framework}
+}
+
+// Framework returns the framework whose errors are written
+func (f *Format) Framework() string {
+	return f.framework
+}
+
+// NotFound answers a request for a path no route matches
+func (f *Format) NotFound(w http.ResponseWriter, r *http.Request) {
+	switch f.framework {
+	case config.FrameworkExpress:
+		f.write(w, http.StatusNotFound, nestError{
+			Message:    fmt.Sprintf("Cannot %s %s", r.Method, r.URL.Path),
+			Error:      "Not Found",
+			StatusCode: http.StatusNotFound,
+		})
+	case config.FrameworkLaravel:
+		f.write(w, http.StatusNotFound, laravelError{
+			Message: fmt.Sprintf("The route %s could not be found.", strings.TrimPrefix(r.URL.Path, "/")),
+		})
+	default:
+		f.Status(w, r, http.StatusNotFound)
+	}
+}
+
+// MethodNotAllowed answers a request whose path is routed only for other
+// methods. Express has no 405 and answers it as not found.
+func (f *Format) MethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed []string) {
+	if f.framework == config.FrameworkExpress {
+		f.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	switch f.framework {
+	case config.FrameworkLaravel:
+		f.write(w, http.StatusMethodNotAllowed, laravelError{
+			Message: fmt.Sprintf("The %s method is not supported for route %s. Supported methods: %s.",
+				r.Method, strings.TrimPrefix(r.URL.Path, "/"), strings.Join(allowed, ", ")),
+		})
+	case config.FrameworkDjango:
+		f.write(w, http.StatusMethodNotAllowed, djangoError{Detail: fmt.Sprintf("Method %q not allowed.", r.Method)})
+	default:
+		f.Status(w, r, http.StatusMethodNotAllowed)
+	}
+}
+
+// Status answers a request with the framework's generic error for a status
+func (f *Format) Status(w http.ResponseWriter, r *http.Request, status int) {
+	switch f.framework {
+	case config.FrameworkExpress:
+		f.write(w, status, nestStatus{StatusCode: status, Message: http.StatusText(status)})
+	case config.FrameworkSpring:
+		f.write(w, status, springError{
+			Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05.000-07:00"),
+			Status:    status,
+			Error:     http.StatusText(status),
+			Path:      r.URL.Path,
+		})
+	case config.FrameworkLaravel:
+		message := http.StatusText(status)
+		if status >= 500 {
+			message = "Server Error"
+		}
+		f.write(w, status, laravelError{Message: message})
+	case config.FrameworkDjango:
+		f.write(w, status, djangoError{Detail: djangoDetail(status)})
+	}
+}
+
+// write writes an error body as the framework serializes it
+func (f *Format) write(w http.ResponseWriter, status int, body any) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(body)
+
+	contentType := "application/json"
+	if f.framework == config.FrameworkExpress {
+		contentType = "application/json; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+	w.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// nestError is the body of NestJS errors, the usual JSON API on Express
+type nestError struct {
+	Message    any    `json:"message"`
+	Error      string `json:"error"`
+	StatusCode int    `json:"statusCode"`
+}
+
+// nestStatus is the body of NestJS errors thrown with only a status
+type nestStatus struct {
+	StatusCode int    `json:"statusCode"`
+	Message    string `json:"message"`
+}
+
+// springError is the body of Spring Boot's whitelabel JSON errors
+type springError struct {
+	Timestamp string `json:"timestamp"`
+	Status    int    `json:"status"`
+	Error     string `json:"error"`
+	Path      string `json:"path"`
+}
+
+// laravelError is the body of Laravel's JSON exception responses
+type laravelError struct {
+	Message string              `json:"message"`
+	Errors  map[string][]string `json:"errors,omitempty"`
+}
+
+// djangoError is the body of Django REST framework exception responses
+type djangoError struct {
+	Detail string `json:"detail"`
+}
+
+// djangoDetail returns Django REST framework's default detail for a status
+func djangoDetail(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "Malformed request."
+	case http.StatusUnauthorized:
+		return "Authentication credentials were not provided."
+	case http.StatusForbidden:
+		return "You do not have permission to perform this action."
+	case http.StatusNotFound:
+		return "Not found."
+	case http.StatusNotAcceptable:
+		return "Could not satisfy the request Accept header."
+	case http.StatusUnsupportedMediaType:
+		return "Unsupported media type in request."
+	case http.StatusTooManyRequests:
+		return "Request was throttled."
+	case http.StatusInternalServerError:
+		return "A server error occurred."
+	case http.StatusServiceUnavailable:
+		return "Service temporarily unavailable, try again later."
+	}
+	return http.StatusText(status) + "."
+}
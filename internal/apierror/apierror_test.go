@@ -0,0 +1,85 @@
+package apierror
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		framework string
+		status    int
+		body      string
+	}{
+		{config.FrameworkExpress, 404, `{"message":"Cannot POST /api/users","error":"Not Found","statusCode":404}`},
+		{config.FrameworkSpring, 405, `"status":405,"error":"Method Not Allowed","path":"/api/users"}`},
+		{config.FrameworkLaravel, 405, `{"message":"The POST method is not supported for route api/users. Supported methods: GET, HEAD."}`},
+		{config.FrameworkDjango, 405, `{"detail":"Method \"POST\" not allowed."}`},
+	}
+
+	for _, tc := range cases {
+		f := New(&config.APIConfig{Framework: tc.framework})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/users", nil)
+		f.MethodNotAllowed(w, r, []string{"GET", "HEAD"})
+
+		if w.Code != tc.status {
+			t.Fatalf("%s: Expected status %d, got %d", tc.framework, tc.status, w.Code)
+		}
+		if !strings.HasSuffix(w.Body.String(), tc.body) {
+			t.Fatalf("%s: Expected body ending %s, got %s", tc.framework, tc.body, w.Body.String())
+		}
+		if tc.status == 405 && w.Header().Get("Allow") != "GET, HEAD" {
+			t.Fatalf("%s: Expected Allow header, got %q", tc.framework, w.Header().Get("Allow"))
+		}
+	}
+
+	if New(nil) != nil {
+		t.Fatalf("Expected no format without api config")
+	}
+}
+
+func TestFormat_Validate(t *testing.T) {
+	cases := []struct {
+		framework   string
+		contentType string
+		body        string
+		status      int
+		expected    string
+	}{
+		{config.FrameworkExpress, "application/json", `{"email":"a@b.test"}`, 400,
+			`{"message":["password should not be empty"],"error":"Bad Request","statusCode":400}`},
+		{config.FrameworkExpress, "application/json", `{"email":}`, 400,
+			`{"message":"Unexpected token } in JSON at position 9","error":"Bad Request","statusCode":400}`},
+		{config.FrameworkLaravel, "application/json", `{"email":}`, 422,
+			`{"message":"The email field is required. (and 1 more error)","errors":{"email":["The email field is required."],"password":["The password field is required."]}}`},
+		{config.FrameworkDjango, "application/x-www-form-urlencoded", "email=&password=x", 400,
+			`{"email":["This field is required."]}`},
+		{config.FrameworkDjango, "application/json", "{\n\"email\": ", 400,
+			`{"detail":"JSON parse error - Expecting value: line 2 column 10 (char 11)"}`},
+	}
+
+	for _, tc := range cases {
+		f := New(&config.APIConfig{Framework: tc.framework})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", tc.contentType)
+		if !f.Validate(w, r, []string{"email", "password"}) {
+			t.Fatalf("%s: Expected %q to fail validation", tc.framework, tc.body)
+		}
+		if w.Code != tc.status || w.Body.String() != tc.expected {
+			t.Fatalf("%s: Expected %d %s, got %d %s", tc.framework, tc.status, tc.expected, w.Code, w.Body.String())
+		}
+	}
+
+	f := New(&config.APIConfig{Framework: config.FrameworkSpring})
+	r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email":"a@b.test","password":"x"}`))
+	r.Header.Set("Content-Type", "application/json")
+	if f.Validate(httptest.NewRecorder(), r, []string{"email", "password"}) {
+		t.Fatalf("Expected a complete body to pass validation")
+	}
+}
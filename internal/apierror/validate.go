@@ -0,0 +1,184 @@
+package apierror
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// maxBody bounds how much of a request body is read for validation
+const maxBody = 1 << 20
+
+// fieldErrors are validation messages by field, serialized in field order as
+// the frameworks do
+type fieldErrors []fieldError
+
+type fieldError struct {
+	field    string
+	messages []string
+}
+
+func (fe fieldErrors) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range fe {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(e.field)
+		messages, _ := json.Marshal(e.messages)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(messages)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// laravelValidation is the body of Laravel's validation errors
+type laravelValidation struct {
+	Message string      `json:"message"`
+	Errors  fieldErrors `json:"errors"`
+}
+
+// Validate checks a request body carries the required fields, answering it
+// with the framework's parse or validation error if not. It reports whether
+// it answered the request. The body is left readable.
+func (f *Format) Validate(w http.ResponseWriter, r *http.Request, required []string) bool {
+	if f == nil || len(required) == 0 || r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return false
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	fields, err := bodyFields(r.Header.Get("Content-Type"), body)
+	if err != nil && f.framework != config.FrameworkLaravel {
+		f.parseError(w, r, body, err)
+		return true
+	}
+
+	missing := make([]string, 0)
+	for _, field := range required {
+		if !fields[field] {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) == 0 {
+		return false
+	}
+
+	switch f.framework {
+	case config.FrameworkExpress:
+		messages := make([]string, len(missing))
+		for i, field := range missing {
+			messages[i] = field + " should not be empty"
+		}
+		f.write(w, http.StatusBadRequest, nestError{Message: messages, Error: "Bad Request", StatusCode: http.StatusBadRequest})
+	case config.FrameworkLaravel:
+		errs := make(fieldErrors, len(missing))
+		for i, field := range missing {
+			errs[i] = fieldError{field, []string{fmt.Sprintf("The %s field is required.", strings.ReplaceAll(field, "_", " "))}}
+		}
+		message := errs[0].messages[0]
+		if n := len(errs) - 1; n == 1 {
+			message += " (and 1 more error)"
+		} else if n > 1 {
+			message += fmt.Sprintf(" (and %d more errors)", n)
+		}
+		f.write(w, http.StatusUnprocessableEntity, laravelValidation{Message: message, Errors: errs})
+	case config.FrameworkDjango:
+		errs := make(fieldErrors, len(missing))
+		for i, field := range missing {
+			errs[i] = fieldError{field, []string{"This field is required."}}
+		}
+		f.write(w, http.StatusBadRequest, errs)
+	default:
+		f.Status(w, r, http.StatusBadRequest)
+	}
+	return true
+}
+
+// parseError answers a request whose JSON body does not parse
+func (f *Format) parseError(w http.ResponseWriter, r *http.Request, body []byte, err error) {
+	// The offending byte, or the end of the body if it was cut short
+	offset := len(body)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) && !strings.HasPrefix(syntaxErr.Error(), "unexpected end") &&
+		int(syntaxErr.Offset) <= len(body) && syntaxErr.Offset > 0 {
+		offset = int(syntaxErr.Offset) - 1
+	}
+
+	switch f.framework {
+	case config.FrameworkExpress:
+		message := "Unexpected end of JSON input"
+		if offset < len(body) {
+			message = fmt.Sprintf("Unexpected token %c in JSON at position %d", body[offset], offset)
+		}
+		f.write(w, http.StatusBadRequest, nestError{Message: message, Error: "Bad Request", StatusCode: http.StatusBadRequest})
+	case config.FrameworkDjango:
+		line := bytes.Count(body[:offset], []byte("\n")) + 1
+		column := offset - bytes.LastIndexByte(body[:offset], '\n')
+		f.write(w, http.StatusBadRequest, djangoError{
+			Detail: fmt.Sprintf("JSON parse error - Expecting value: line %d column %d (char %d)", line, column, offset),
+		})
+	default:
+		f.Status(w, r, http.StatusBadRequest)
+	}
+}
+
+// bodyFields returns the non-empty fields of a JSON object, form, or
+// multipart body. Only JSON bodies fail to parse, since frameworks read
+// malformed forms as empty.
+func bodyFields(contentType string, body []byte) (map[string]bool, error) {
+	fields := make(map[string]bool)
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if len(bytes.TrimSpace(body)) == 0 {
+			return fields, nil
+		}
+		var object map[string]any
+		if err := json.Unmarshal(body, &object); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				return fields, nil
+			}
+			return fields, err
+		}
+		for k, v := range object {
+			if v != nil && v != "" {
+				fields[k] = true
+			}
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		values, _ := url.ParseQuery(string(body))
+		for k, v := range values {
+			if len(v) > 0 && v[0] != "" {
+				fields[k] = true
+			}
+		}
+	case mediaType == "multipart/form-data":
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			if value, _ := io.ReadAll(io.LimitReader(part, 1)); len(value) > 0 || part.FileName() != "" {
+				fields[part.FormName()] = true
+			}
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,347 @@
+package audit
+
+import (
+	"crypto/tls"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/profile"
+	"github.com/davidthuman/service-spoof/internal/templates"
+)
+
+// Finding severities
+const (
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// Finding is a contradiction in the configured profiles that a scanner
+// comparing banners could notice
+type Finding struct {
+	Severity string
+	Service  string
+	Message  string
+}
+
+func (f Finding) String() string {
+	if f.Service == "" {
+		return fmt.Sprintf("%s: %s", f.Severity, f.Message)
+	}
+	return fmt.Sprintf("%s: service %s: %s", f.Severity, f.Service, f.Message)
+}
+
+// vendor describes how a web server identifies itself in headers and pages
+type vendor struct {
+	name    string
+	header  []string
+	markers []*regexp.Regexp
+	version *regexp.Regexp
+}
+
+var vendors = []vendor{
+	{
+		name:   "apache",
+		header: []string{"apache"},
+		markers: []*regexp.Regexp{
+			regexp.MustCompile(`Apache/\d`),
+			regexp.MustCompile(`Apache Server at `),
+			regexp.MustCompile(`Apache HTTP Server`),
+		},
+		version: regexp.MustCompile(`Apache/(\d+(?:\.\d+)*)`),
+	},
+	{
+		name:   "nginx",
+		header: []string{"nginx", "openresty"},
+		markers: []*regexp.Regexp{
+			regexp.MustCompile(`nginx/\d`),
+			regexp.MustCompile(`<center>nginx</center>`),
+			regexp.MustCompile(`Welcome to nginx`),
+		},
+		version: regexp.MustCompile(`nginx/(\d+(?:\.\d+)*)`),
+	},
+	{
+		name:   "iis",
+		header: []string{"microsoft-iis"},
+		markers: []*regexp.Regexp{
+			regexp.MustCompile(`Microsoft-IIS/\d`),
+			regexp.MustCompile(`IIS Windows Server`),
+			regexp.MustCompile(`Internet Information Services`),
+		},
+		version: regexp.MustCompile(`Microsoft-IIS/(\d+(?:\.\d+)*)`),
+	},
+}
+
+// typeVendors lists the Server header vendors consistent with each service
+// type. Types not listed may run behind any server.
+var typeVendors = map[string][]string{
+	"apache2":   {"apache"},
+	"nginx":     {"nginx"},
+	"iis":       {"iis"},
+	"wordpress": {"apache", "nginx"},
+}
+
+// Run cross-checks every enabled service's Server headers, X-Powered-By
+// headers, and template contents against each other, and checks that the
+// TLS certificates load
+func Run(cfg *config.Config) []Finding {
+	findings := make([]Finding, 0)
+
+	// Services whose templates cannot be read are reported per template
+	dir, err := templates.Open(cfg.Templates.GetRoot())
+	if err != nil {
+		findings = append(findings, Finding{Severity: SeverityError, Message: err.Error()})
+	}
+	defer dir.Close()
+
+	for _, svc := range cfg.GetEnabledServices() {
+		findings = append(findings, auditService(&svc, dir)...)
+	}
+	findings = append(findings, auditPorts(cfg)...)
+	findings = append(findings, auditTLS(cfg)...)
+
+	return findings
+}
+
+// Failed reports whether findings should stop startup. Errors always do,
+// warnings only in strict mode.
+func Failed(findings []Finding, strict bool) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError || strict {
+			return true
+		}
+	}
+	return false
+}
+
+// auditService checks a single service for internal contradictions, reading
+// its templates from dir
+func auditService(svc *config.ServiceConfig, dir *templates.Dir) []Finding {
+	findings := make([]Finding, 0)
+	add := func(severity, format string, args ...any) {
+		findings = append(findings, Finding{Severity: severity, Service: svc.Name, Message: fmt.Sprintf(format, args...)})
+	}
+
+	server := svc.Headers["Server"]
+	serverVendor := headerVendor(server)
+
+	if allowed, ok := typeVendors[svc.Type]; ok && serverVendor != nil && !contains(allowed, serverVendor.name) {
+		add(SeverityError, "Server header %q contradicts service type %s", server, svc.Type)
+	}
+
+	if p := profile.New(svc.Type, svc.ProfileVersion); p != nil && server != "" && !p.Consistent(server) {
+		add(SeverityError, "Server header %q contradicts profileVersion %s, %s", server, svc.ProfileVersion, p.Server())
+	}
+
+	if poweredBy := svc.Headers["X-Powered-By"]; strings.Contains(poweredBy, "ASP.NET") && serverVendor != nil && serverVendor.name != "iis" {
+		add(SeverityWarning, "X-Powered-By %q is unusual behind Server %q", poweredBy, server)
+	}
+
+	servedWith := make(map[string]string)
+	for _, ep := range svc.Endpoints {
+		epServer := server
+		if s, ok := ep.Headers["Server"]; ok {
+			epServer = s
+			if epVendor := headerVendor(s); serverVendor != nil && epVendor != nil && epVendor.name != serverVendor.name {
+				add(SeverityError, "endpoint %s %s Server header %q contradicts service Server header %q", ep.Method, ep.Path, s, server)
+			}
+		}
+		if ep.Template != "" {
+			servedWith[ep.Template] = epServer
+		}
+	}
+	if svc.BadRequest != nil && svc.BadRequest.Template != "" {
+		servedWith[svc.BadRequest.Template] = server
+	}
+	if svc.ServerError != nil && svc.ServerError.Template != "" {
+		servedWith[svc.ServerError.Template] = server
+	}
+
+	paths := make([]string, 0, len(servedWith))
+	for path := range servedWith {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		content, err := dir.ReadFile(path)
+		if err != nil {
+			add(SeverityError, "template %s: %v", path, err)
+			continue
+		}
+		for _, f := range auditTemplate(path, string(content), servedWith[path]) {
+			add(f.Severity, "%s", f.Message)
+		}
+	}
+
+	return findings
+}
+
+// auditTemplate checks a template's vendor signatures against the Server
+// header it is served with
+func auditTemplate(path, content, server string) []Finding {
+	findings := make([]Finding, 0)
+	serverVendor := headerVendor(server)
+
+	for _, v := range vendors {
+		if !v.matches(content) {
+			continue
+		}
+
+		if serverVendor == nil {
+			if server != "" {
+				findings = append(findings, Finding{Severity: SeverityWarning,
+					Message: fmt.Sprintf("template %s looks like %s but Server header is %q", path, v.name, server)})
+			}
+			continue
+		}
+		if v.name != serverVendor.name {
+			findings = append(findings, Finding{Severity: SeverityError,
+				Message: fmt.Sprintf("template %s looks like %s but Server header is %q", path, v.name, server)})
+			continue
+		}
+
+		// Same vendor, so versions quoted in the page must match the header
+		want := v.version.FindStringSubmatch(server)
+		for _, got := range v.version.FindAllStringSubmatch(content, -1) {
+			if want != nil && got[1] != want[1] {
+				findings = append(findings, Finding{Severity: SeverityWarning,
+					Message: fmt.Sprintf("template %s mentions %s but Server header is %q", path, got[0], server)})
+				break
+			}
+		}
+	}
+
+	return findings
+}
+
+// auditPorts warns about listeners shared by services claiming different
+// vendors, since only the first service on a listener answers
+func auditPorts(cfg *config.Config) []Finding {
+	findings := make([]Finding, 0)
+
+	listenerMap := cfg.GetServicesByListener()
+	addrs := make([]config.ListenAddr, 0, len(listenerMap))
+	for addr := range listenerMap {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].Port != addrs[j].Port {
+			return addrs[i].Port < addrs[j].Port
+		}
+		return addrs[i].IP < addrs[j].IP
+	})
+
+	for _, addr := range addrs {
+		svcs := listenerMap[addr]
+		first := headerVendor(svcs[0].Headers["Server"])
+		for _, svc := range svcs[1:] {
+			other := headerVendor(svc.Headers["Server"])
+			if first != nil && other != nil && first.name != other.name {
+				findings = append(findings, Finding{Severity: SeverityWarning, Service: svc.Name,
+					Message: fmt.Sprintf("shares %s with %s but claims a different server (%s vs %s)", describe(addr), svcs[0].Name, other.name, first.name)})
+			}
+		}
+	}
+
+	return findings
+}
+
+// auditTLS checks that the global certificate and key and those of services
+// with their own TLS identity load, and that each personality's certificate
+// covers its hostname
+func auditTLS(cfg *config.Config) []Finding {
+	findings := make([]Finding, 0)
+
+	if f := auditCert(&cfg.Tls); f != nil {
+		findings = append(findings, *f)
+	}
+
+	// Services of one personality share its certificate, so each is checked once
+	checked := map[string]bool{cfg.Tls.CertFilePath: true}
+	for _, svc := range cfg.GetEnabledServices() {
+		if svc.Tls == nil || checked[svc.Tls.CertFilePath] {
+			continue
+		}
+		checked[svc.Tls.CertFilePath] = true
+		if f := auditCert(svc.Tls); f != nil {
+			f.Service = svc.Name
+			findings = append(findings, *f)
+		}
+	}
+
+	for _, p := range cfg.Personalities {
+		if !p.Enabled || p.Hostname == "" {
+			continue
+		}
+		certCfg := cfg.Tls
+		if p.Tls != nil {
+			certCfg = *p.Tls
+		}
+		if certCfg.CertFilePath == "" {
+			continue
+		}
+		cert, err := tls.LoadX509KeyPair(certCfg.CertFilePath, certCfg.KeyFilePath)
+		if err != nil || cert.Leaf == nil {
+			continue
+		}
+		if err := cert.Leaf.VerifyHostname(p.Hostname); err != nil {
+			findings = append(findings, Finding{Severity: SeverityWarning, Service: p.Name,
+				Message: fmt.Sprintf("tls certificate %s does not cover personality hostname %s", certCfg.CertFilePath, p.Hostname)})
+		}
+	}
+
+	return findings
+}
+
+// auditCert checks that a certificate and key load
+func auditCert(cfg *config.TlsConfig) *Finding {
+	if cfg.CertFilePath == "" {
+		return nil
+	}
+	if _, err := tls.LoadX509KeyPair(cfg.CertFilePath, cfg.KeyFilePath); err != nil {
+		return &Finding{Severity: SeverityError, Message: fmt.Sprintf("tls certificate: %v", err)}
+	}
+	return nil
+}
+
+// describe names a listener the way findings refer to it
+func describe(addr config.ListenAddr) string {
+	if addr.IP == "" {
+		return fmt.Sprintf("port %d", addr.Port)
+	}
+	return fmt.Sprintf("port %d on %s", addr.Port, addr.IP)
+}
+
+// headerVendor returns the vendor a Server header names, or nil
+func headerVendor(server string) *vendor {
+	lower := strings.ToLower(server)
+	for i := range vendors {
+		for _, h := range vendors[i].header {
+			if strings.Contains(lower, h) {
+				return &vendors[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (v *vendor) matches(content string) bool {
+	for _, m := range v.markers {
+		if m.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
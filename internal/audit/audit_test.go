@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	iisPage := filepath.Join(dir, "iis.html")
+	nginxPage := filepath.Join(dir, "nginx.html")
+	os.WriteFile(iisPage, []byte("<title>IIS Windows Server</title>"), 0644)
+	os.WriteFile(nginxPage, []byte("<hr><center>nginx/1.18.0</center>"), 0644)
+
+	cfg := &config.Config{
+		Templates: config.TemplatesConfig{Root: dir},
+		Services: []config.ServiceConfig{
+			{
+				Name:    "web",
+				Type:    "nginx",
+				Enabled: true,
+				Ports:   []int{80},
+				Headers: map[string]string{"Server": "nginx/1.25.3"},
+				Endpoints: []config.EndpointConfig{
+					{Path: "/", Method: "GET", Status: 200, Template: iisPage},
+					{Path: "/*", Method: "*", Status: 404, Template: nginxPage},
+				},
+			},
+		},
+	}
+
+	findings := Run(cfg)
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %d: %v", len(findings), findings)
+	}
+	if findings[0].Severity != SeverityError || !strings.Contains(findings[0].Message, "looks like iis") {
+		t.Fatalf("Expected IIS template error, got %s", findings[0])
+	}
+	if findings[1].Severity != SeverityWarning || !strings.Contains(findings[1].Message, "nginx/1.18.0") {
+		t.Fatalf("Expected version mismatch warning, got %s", findings[1])
+	}
+	if !Failed(findings, false) {
+		t.Fatalf("Expected errors to fail the audit")
+	}
+}
+
+func TestRun_Consistent(t *testing.T) {
+	cfg := &config.Config{
+		Services: []config.ServiceConfig{
+			{
+				Name:      "apache",
+				Type:      "apache2",
+				Enabled:   true,
+				Ports:     []int{80},
+				Headers:   map[string]string{"Server": "Apache/2.4.63 (Unix)"},
+				Endpoints: []config.EndpointConfig{{Path: "/*", Method: "*", Status: 404}},
+			},
+		},
+	}
+
+	if findings := Run(cfg); len(findings) != 0 {
+		t.Fatalf("Expected no findings, got %v", findings)
+	}
+}
+
+func TestRun_ProfileVersion(t *testing.T) {
+	cfg := &config.Config{
+		Services: []config.ServiceConfig{
+			{
+				Name:           "web",
+				Type:           "nginx",
+				Enabled:        true,
+				Ports:          []int{80},
+				ProfileVersion: "1.24",
+				Headers:        map[string]string{"Server": "nginx/1.18.0"},
+				Endpoints:      []config.EndpointConfig{{Path: "/*", Method: "*", Status: 404}},
+			},
+		},
+	}
+
+	findings := Run(cfg)
+	if len(findings) != 1 || !strings.Contains(findings[0].Message, "contradicts profileVersion") {
+		t.Fatalf("Expected a profileVersion finding, got %v", findings)
+	}
+
+	cfg.Services[0].Headers["Server"] = "nginx/1.24.0 (Ubuntu)"
+	if findings := Run(cfg); len(findings) != 0 {
+		t.Fatalf("Expected no findings, got %v", findings)
+	}
+}
@@ -0,0 +1,187 @@
+// Package bootstrap lays out a new deployment in a directory: a commented
+// starter config, the templates and migrations it uses, a self-signed
+// certificate, and a migrated database, so a working spoof takes one command.
+// Files already there are kept, so running it again only fills in what is
+// missing.
+package bootstrap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	_ "embed"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+// starterConfig is the config written to new deployments
+//
+//go:embed config.yaml
+var starterConfig []byte
+
+// certValidity is how long generated certificates are valid for
+const certValidity = 365 * 24 * time.Hour
+
+// Options configures a bootstrap
+type Options struct {
+	// Dir is the directory the deployment is laid out in
+	Dir string
+
+	// Files holds the templates and migrations written beside the config,
+	// under services/ and migrations/
+	Files fs.FS
+
+	// Hostname names the self-signed certificate
+	Hostname string
+
+	// Force overwrites files already there
+	Force bool
+}
+
+// Step records what a bootstrap did with a file
+type Step struct {
+	Path    string
+	Created bool
+}
+
+// Run lays out a deployment, returning what it did with each file
+func Run(opts Options) ([]Step, error) {
+	var steps []Step
+	write := func(name string, data []byte, perm os.FileMode) error {
+		path := filepath.Join(opts.Dir, name)
+		created, err := writeFile(path, data, perm, opts.Force)
+		if err != nil {
+			return err
+		}
+		steps = append(steps, Step{Path: path, Created: created})
+		return nil
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", opts.Dir, err)
+	}
+	if err := write("config.yaml", starterConfig, 0644); err != nil {
+		return nil, err
+	}
+
+	err := fs.WalkDir(opts.Files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(opts.Files, name)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		return write(filepath.FromSlash(name), data, 0644)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.LoadConfig(filepath.Join(opts.Dir, "config.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Keep a key pair already there together, rather than replacing half of it
+	certPath, keyPath := resolve(opts.Dir, cfg.Tls.CertFilePath), resolve(opts.Dir, cfg.Tls.KeyFilePath)
+	if opts.Force || !exists(certPath) || !exists(keyPath) {
+		certPEM, keyPEM, err := selfSigned(opts.Hostname, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", certPath, err)
+		}
+		if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", keyPath, err)
+		}
+		steps = append(steps, Step{Path: certPath, Created: true}, Step{Path: keyPath, Created: true})
+	} else {
+		steps = append(steps, Step{Path: certPath}, Step{Path: keyPath})
+	}
+
+	dbPath := resolve(opts.Dir, cfg.Database.Path)
+	created := !exists(dbPath)
+	db, err := database.New(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+	if err := db.RunMigrations(filepath.Join(opts.Dir, "migrations")); err != nil {
+		return nil, err
+	}
+	steps = append(steps, Step{Path: dbPath, Created: created})
+
+	return steps, nil
+}
+
+// writeFile writes a file unless it exists and force is off, reporting
+// whether it did
+func writeFile(path string, data []byte, perm os.FileMode, force bool) (bool, error) {
+	if !force && exists(path) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// selfSigned generates a certificate and key for a hostname, PEM-encoded
+func selfSigned(hostname string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// resolve returns a path from the config relative to the deployment directory
+func resolve(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, fs.ErrNotExist)
+}
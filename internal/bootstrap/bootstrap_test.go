@@ -0,0 +1,65 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/davidthuman/service-spoof/internal/certs"
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestRun(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "spoof")
+	files := fstest.MapFS{
+		"migrations/000001_initial_schema.up.sql":   {Data: []byte("CREATE TABLE request_logs (id INTEGER PRIMARY KEY);")},
+		"migrations/000001_initial_schema.down.sql": {Data: []byte("DROP TABLE request_logs;")},
+		"services/nginx/index.html":                 {Data: []byte("<h1>Welcome to nginx!</h1>")},
+	}
+	opts := Options{Dir: dir, Files: files, Hostname: "www.example.com"}
+
+	steps, err := Run(opts)
+	if err != nil {
+		t.Fatalf("Failed to bootstrap: %v", err)
+	}
+	for _, step := range steps {
+		if !step.Created {
+			t.Fatalf("Expected %s to be created", step.Path)
+		}
+	}
+
+	if _, err := config.LoadConfig(filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatalf("Expected the starter config to load: %v", err)
+	}
+	cert, err := certs.Load(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatalf("Expected the certificate to load: %v", err)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "www.example.com" {
+		t.Fatalf("Expected a certificate for www.example.com, got %v", cert.DNSNames)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "key.pem")); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the key to be readable by its owner only, got %v %v", info, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data", "service-spoof.db")); err != nil {
+		t.Fatalf("Expected the database to be created: %v", err)
+	}
+
+	// Running again keeps what is there
+	if err := os.WriteFile(filepath.Join(dir, "services/nginx/index.html"), []byte("edited"), 0644); err != nil {
+		t.Fatalf("Failed to edit template: %v", err)
+	}
+	steps, err = Run(opts)
+	if err != nil {
+		t.Fatalf("Failed to bootstrap again: %v", err)
+	}
+	for _, step := range steps {
+		if step.Created {
+			t.Fatalf("Expected %s to be kept", step.Path)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "services/nginx/index.html")); string(data) != "edited" {
+		t.Fatalf("Expected the edited template to be kept, got %q", data)
+	}
+}
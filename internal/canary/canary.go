@@ -0,0 +1,57 @@
+// Package canary marks requests to canary endpoints, fake paths such as
+// /backup.zip or /.env that nothing legitimate requests, so that touching
+// one raises an alert the moment it is logged
+package canary
+
+import (
+	"context"
+	"slices"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// TagCanary tags requests to canary endpoints
+const TagCanary = "canary"
+
+// Token is the canary of an endpoint
+type Token struct {
+	// Name identifies the canary in request logs and alerts
+	Name string
+
+	// Alerts are the alert destinations notified, every one if empty
+	Alerts []string
+}
+
+// NewToken returns the canary of an endpoint, or nil if it is not a canary
+// endpoint. Canaries without a name are named after their path.
+func NewToken(ep *config.EndpointConfig) *Token {
+	if ep.Type != config.EndpointTypeCanary {
+		return nil
+	}
+	t := &Token{Name: ep.Path}
+	if ep.Canary != nil {
+		if ep.Canary.Name != "" {
+			t.Name = ep.Canary.Name
+		}
+		t.Alerts = ep.Canary.Alerts
+	}
+	return t
+}
+
+// Notifies reports whether an alert destination is notified of the canary
+func (t *Token) Notifies(destination string) bool {
+	return len(t.Alerts) == 0 || slices.Contains(t.Alerts, destination)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context marking its request as touching t
+func NewContext(ctx context.Context, t *Token) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the canary the request touched, or nil
+func FromContext(ctx context.Context) *Token {
+	t, _ := ctx.Value(contextKey{}).(*Token)
+	return t
+}
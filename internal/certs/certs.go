@@ -0,0 +1,111 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/logging"
+)
+
+// certsLog logs the certificates that need replacing
+var certsLog = logging.Logger("certs")
+
+// DefaultWarning is how long before expiry certificates are alerted on when
+// no warning is configured
+const DefaultWarning = 30 * 24 * time.Hour
+
+// Certificate describes a certificate the spoof serves, as loaded when it
+// started
+type Certificate struct {
+	Path      string    `json:"path"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dns_names"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	Listeners []string  `json:"listeners"`
+}
+
+// Load reads the leaf of a certificate and key pair
+func Load(certFile, keyFile string) (*Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate %s: %w", certFile, err)
+	}
+	leaf := pair.Leaf
+	return &Certificate{
+		Path:      certFile,
+		Subject:   leaf.Subject.String(),
+		Issuer:    leaf.Issuer.String(),
+		DNSNames:  leaf.DNSNames,
+		NotBefore: leaf.NotBefore,
+		NotAfter:  leaf.NotAfter,
+	}, nil
+}
+
+// ExpiresIn returns how long the certificate is valid for after now, which
+// is negative once it has expired
+func (c Certificate) ExpiresIn(now time.Time) time.Duration {
+	return c.NotAfter.Sub(now)
+}
+
+// Monitor alerts on certificates that are expired, not yet valid, or
+// expiring within the warning period. An expired certificate on a spoofed
+// HTTPS service is both suspicious and fails every TLS capture.
+type Monitor struct {
+	certs   []Certificate
+	warning time.Duration
+}
+
+// NewMonitor creates a monitor for certs, warning the given period before
+// they expire. A warning of 0 uses DefaultWarning.
+func NewMonitor(certs []Certificate, warning time.Duration) *Monitor {
+	if warning <= 0 {
+		warning = DefaultWarning
+	}
+	sorted := append([]Certificate(nil), certs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].NotAfter.Before(sorted[j].NotAfter) })
+	return &Monitor{certs: sorted, warning: warning}
+}
+
+// Check returns an alert for every certificate not comfortably valid at now
+func (m *Monitor) Check(now time.Time) []string {
+	alerts := make([]string, 0)
+	for _, c := range m.certs {
+		left := c.ExpiresIn(now)
+		switch {
+		case now.Before(c.NotBefore):
+			alerts = append(alerts, fmt.Sprintf("certificate %s (%s) is not valid until %s",
+				c.Path, c.Subject, c.NotBefore.UTC().Format(time.RFC3339)))
+		case left < 0:
+			alerts = append(alerts, fmt.Sprintf("certificate %s (%s) expired %s ago",
+				c.Path, c.Subject, (-left).Round(time.Hour)))
+		case left < m.warning:
+			alerts = append(alerts, fmt.Sprintf("certificate %s (%s) expires in %s at %s",
+				c.Path, c.Subject, left.Round(time.Hour), c.NotAfter.UTC().Format(time.RFC3339)))
+		}
+	}
+	return alerts
+}
+
+// Start checks the certificates now and then on the given interval until
+// ctx is cancelled, logging an alert for each that needs replacing
+func (m *Monitor) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, alert := range m.Check(time.Now()) {
+			certsLog.Warn("ALERT certificate", "alert", alert)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	notAfter := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "spoof.test"},
+		DNSNames:     []string{"spoof.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	cert, err := Load(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	if cert.Subject != "CN=spoof.test" || !cert.NotAfter.Equal(notAfter) {
+		t.Fatalf("Expected CN=spoof.test until %s, got %s until %s", notAfter, cert.Subject, cert.NotAfter)
+	}
+
+	if _, err := Load(certFile, filepath.Join(dir, "missing.pem")); err == nil {
+		t.Fatalf("Expected an error for a missing key")
+	}
+}
+
+func TestMonitor_Check(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	monitor := NewMonitor([]Certificate{
+		{Path: "valid.pem", NotBefore: now.AddDate(0, -1, 0), NotAfter: now.AddDate(0, 6, 0)},
+		{Path: "expiring.pem", NotBefore: now.AddDate(0, -1, 0), NotAfter: now.AddDate(0, 0, 10)},
+		{Path: "expired.pem", NotBefore: now.AddDate(0, -3, 0), NotAfter: now.AddDate(0, 0, -1)},
+		{Path: "future.pem", NotBefore: now.AddDate(0, 0, 1), NotAfter: now.AddDate(1, 0, 0)},
+	}, 0)
+
+	alerts := monitor.Check(now)
+	if len(alerts) != 3 {
+		t.Fatalf("Expected 3 alerts, got %q", alerts)
+	}
+	for i, want := range []string{"expired.pem (", "expiring.pem (", "future.pem ("} {
+		if !strings.Contains(alerts[i], want) {
+			t.Fatalf("Expected alert %d about %s, got %q", i, want, alerts[i])
+		}
+	}
+}
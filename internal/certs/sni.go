@@ -0,0 +1,102 @@
+package certs
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Pair is the files of a certificate and its key
+type Pair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// DirPairs returns the certificates in dir, each <name>.crt or <name>.pem
+// with its key in <name>.key, sorted by name. Files without a key, such as
+// chains or the keys themselves, are skipped.
+func DirPairs(dir string) ([]Pair, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate directory %s: %w", dir, err)
+	}
+
+	var pairs []Pair
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".crt" && ext != ".pem") {
+			continue
+		}
+		keyFile := filepath.Join(dir, strings.TrimSuffix(entry.Name(), ext)+".key")
+		if _, err := os.Stat(keyFile); err != nil {
+			continue
+		}
+		pairs = append(pairs, Pair{CertFile: filepath.Join(dir, entry.Name()), KeyFile: keyFile})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].CertFile < pairs[j].CertFile })
+	return pairs, nil
+}
+
+// Selector picks the certificate presented to each TLS client by the server
+// name it asks for, so one listener can pass for many hosts
+type Selector struct {
+	fallback  *tls.Certificate
+	exact     map[string][]*tls.Certificate
+	wildcards map[string][]*tls.Certificate
+}
+
+// NewSelector creates a selector of certs, the first of which is presented
+// to clients asking for a name none of them covers, or for none at all.
+// Certificates earlier in the list win names they share with later ones.
+func NewSelector(certs []tls.Certificate) (*Selector, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates to select from")
+	}
+	s := &Selector{
+		fallback:  &certs[0],
+		exact:     make(map[string][]*tls.Certificate),
+		wildcards: make(map[string][]*tls.Certificate),
+	}
+	for i := range certs {
+		cert := &certs[i]
+		if cert.Leaf == nil {
+			return nil, fmt.Errorf("certificate %d has no parsed leaf", i)
+		}
+		for _, name := range cert.Leaf.DNSNames {
+			name = strings.ToLower(name)
+			if suffix, ok := strings.CutPrefix(name, "*."); ok {
+				s.wildcards[suffix] = append(s.wildcards[suffix], cert)
+			} else {
+				s.exact[name] = append(s.exact[name], cert)
+			}
+		}
+	}
+	return s, nil
+}
+
+// GetCertificate returns the certificate whose names match the client's
+// SNI, exact names before wildcards, preferring one the client supports the
+// key of. Clients asking for a name no certificate covers get the fallback.
+func (s *Selector) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" {
+		return s.fallback, nil
+	}
+
+	candidates := s.exact[name]
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		candidates = append(candidates[:len(candidates):len(candidates)], s.wildcards[parent]...)
+	}
+	for _, cert := range candidates {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert, nil
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0], nil
+	}
+	return s.fallback, nil
+}
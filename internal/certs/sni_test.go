@@ -0,0 +1,100 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePair writes a self-signed certificate for names to dir as
+// <file>.crt and <file>.key
+func writePair(t *testing.T, dir, file string, names ...string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, file+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, file+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+}
+
+func TestSelector_GetCertificate(t *testing.T) {
+	dir := t.TempDir()
+	writePair(t, dir, "default", "spoof.test")
+	writePair(t, dir, "mail", "mail.example.com", "*.corp.example.com")
+	writePair(t, dir, "vpn", "vpn.corp.example.com")
+	if err := os.WriteFile(filepath.Join(dir, "chain.pem"), nil, 0600); err != nil {
+		t.Fatalf("Failed to write chain: %v", err)
+	}
+
+	pairs, err := DirPairs(dir)
+	if err != nil {
+		t.Fatalf("Failed to list certificates: %v", err)
+	}
+	if len(pairs) != 3 || pairs[0].CertFile != filepath.Join(dir, "default.crt") || pairs[0].KeyFile != filepath.Join(dir, "default.key") {
+		t.Fatalf("Expected the three pairs with keys, got %+v", pairs)
+	}
+
+	var certificates []tls.Certificate
+	for _, pair := range pairs {
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", pair.CertFile, err)
+		}
+		certificates = append(certificates, cert)
+	}
+	selector, err := NewSelector(certificates)
+	if err != nil {
+		t.Fatalf("Failed to create selector: %v", err)
+	}
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{"", "spoof.test"},
+		{"unknown.example.org", "spoof.test"},
+		{"MAIL.example.com.", "mail.example.com"},
+		{"intranet.corp.example.com", "mail.example.com"},
+		{"vpn.corp.example.com", "vpn.corp.example.com"},
+		{"a.b.corp.example.com", "spoof.test"},
+	}
+	for _, tt := range tests {
+		cert, err := selector.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+		if err != nil {
+			t.Fatalf("Failed to select a certificate for %q: %v", tt.serverName, err)
+		}
+		if got := cert.Leaf.Subject.CommonName; got != tt.want {
+			t.Fatalf("Expected %q to get the certificate of %s, got %s", tt.serverName, tt.want, got)
+		}
+	}
+}
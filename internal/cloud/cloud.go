@@ -0,0 +1,129 @@
+// Package cloud makes services look hosted behind a cloud provider's load
+// balancer or CDN, so a spoof deployed in AWS or Azure carries the
+// fingerprints of its hosting environment: the headers and stickiness
+// cookies the front end adds to every response, and the error pages it
+// answers with itself when its backend fails.
+package cloud
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// Front is a cloud provider's front end
+type Front struct {
+	profile string
+	pop     string
+
+	// edge is the CloudFront edge server named in Via, and affinity the
+	// instance an Azure ARRAffinity cookie pins clients to. Both stay the
+	// same for the life of the process, as for a real deployment.
+	edge     string
+	affinity string
+}
+
+// New creates the front end of a profile, or returns nil for none
+func New(cfg *config.CloudConfig, profile string) *Front {
+	if profile == "" {
+		return nil
+	}
+	return &Front{
+		profile:  profile,
+		pop:      cfg.GetPop(),
+		edge:     hex.EncodeToString(random(16)),
+		affinity: hex.EncodeToString(random(32)),
+	}
+}
+
+// Profile returns the profile the front end mimics
+func (f *Front) Profile() string {
+	return f.profile
+}
+
+// Header adds the headers and cookies the front end adds to a response with
+// the given status. requestID is the ID CloudFront gives the request.
+func (f *Front) Header(h http.Header, r *http.Request, status int, requestID string) {
+	switch f.profile {
+	case config.CloudAWSALB:
+		// Stickiness cookies are reissued on every response
+		v := base64.StdEncoding.EncodeToString(random(96))
+		expires := time.Now().Add(7 * 24 * time.Hour).UTC().Format(http.TimeFormat)
+		h.Add("Set-Cookie", "AWSALB="+v+"; Expires="+expires+"; Path=/")
+		h.Add("Set-Cookie", "AWSALBCORS="+v+"; Expires="+expires+"; Path=/; SameSite=None; Secure")
+	case config.CloudAWSELB:
+		if _, err := r.Cookie("AWSELB"); err != nil {
+			v := strings.ToUpper(hex.EncodeToString(random(68)))
+			h.Add("Set-Cookie", "AWSELB="+v+";PATH=/;MAX-AGE=3600")
+		}
+	case config.CloudAWSCloudFront:
+		cache := "Miss from cloudfront"
+		if status >= 400 {
+			cache = "Error from cloudfront"
+		}
+		h.Set("X-Cache", cache)
+		h.Set("Via", "1.1 "+f.edge+".cloudfront.net (CloudFront)")
+		h.Set("X-Amz-Cf-Pop", f.pop)
+		h.Set("X-Amz-Cf-Id", requestID)
+	case config.CloudAzureAppService:
+		if _, err := r.Cookie("ARRAffinity"); err != nil {
+			domain := r.Host
+			if host, _, err := net.SplitHostPort(domain); err == nil {
+				domain = host
+			}
+			h.Add("Set-Cookie", "ARRAffinity="+f.affinity+";Path=/;HttpOnly;Secure;Domain="+domain)
+			h.Add("Set-Cookie", "ARRAffinitySameSite="+f.affinity+";Path=/;HttpOnly;SameSite=None;Secure;Domain="+domain)
+		}
+	}
+}
+
+// RequestID returns a new CloudFront request ID, or "" for other profiles
+func (f *Front) RequestID() string {
+	if f.profile != config.CloudAWSCloudFront {
+		return ""
+	}
+	return base64.URLEncoding.EncodeToString(random(40))
+}
+
+// ErrorPage writes the page the front end answers a status with in place of
+// its backend's, with only the front end's headers, reporting whether it has
+// one. Front ends generate their own pages only for the gateway errors of a
+// backend they cannot reach.
+func (f *Front) ErrorPage(w http.ResponseWriter, r *http.Request, status int, requestID string) bool {
+	page, ok := pages[f.profile][status]
+	if !ok {
+		return false
+	}
+	body := page.body
+	if f.profile == config.CloudAWSCloudFront {
+		body = strings.ReplaceAll(body, "{request_id}", requestID)
+	}
+
+	h := w.Header()
+	clear(h)
+	f.Header(h, r, status, requestID)
+	if page.server != "" {
+		h.Set("Server", page.server)
+	}
+	if body != "" {
+		h.Set("Content-Type", page.contentType)
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+	return true
+}
+
+// random returns n random bytes
+func random(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
@@ -0,0 +1,124 @@
+package cloud
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// page is an error page a front end generates itself
+type page struct {
+	server      string
+	contentType string
+	body        string
+}
+
+// albPage is an Application Load Balancer's error page for a status
+func albPage(status int) page {
+	title := http.StatusText(status)
+	if status == http.StatusGatewayTimeout {
+		title = "Gateway Time-out"
+	}
+	body := strings.Join([]string{
+		"<html>",
+		"<head><title>" + strconv.Itoa(status) + " " + title + "</title></head>",
+		"<body>",
+		"<center><h1>" + strconv.Itoa(status) + " " + title + "</h1></center>",
+		"</body>",
+		"</html>",
+		"",
+	}, "\r\n")
+	return page{server: "awselb/2.0", contentType: "text/html", body: body}
+}
+
+// cloudFrontPage is CloudFront's error page for a status, explaining why it
+// could not reach the origin. {request_id} is replaced with the request's ID.
+func cloudFrontPage(status int, reason string) page {
+	return page{server: "CloudFront", contentType: "text/html", body: `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN" "http://www.w3.org/TR/html4/loose.dtd">
+<HTML><HEAD><META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=iso-8859-1">
+<TITLE>ERROR: The request could not be satisfied</TITLE>
+</HEAD><BODY>
+<H1>` + strconv.Itoa(status) + ` ERROR</H1>
+<H2>The request could not be satisfied.</H2>
+<HR noshade size="1px">
+` + reason + `
+We can't connect to the server for this app or website at this time. There might be too much traffic or a configuration error. Try again later, or contact the app or website owner.
+<BR clear="all">
+If you provide content to customers through CloudFront, you can find steps to troubleshoot and help prevent this error by reviewing the CloudFront documentation.
+<BR clear="all">
+<HR noshade size="1px">
+<PRE>
+Generated by cloudfront (CloudFront)
+Request ID: {request_id}
+</PRE>
+<ADDRESS>
+</ADDRESS>
+</BODY></HTML>`}
+}
+
+// arrBadGateway is the page Azure's Application Request Routing front ends
+// answer with when an App Service instance gives an invalid response
+const arrBadGateway = `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=iso-8859-1"/>
+<title>502 - Web server received an invalid response while acting as a gateway or proxy server.</title>
+<style type="text/css">
+<!--
+body{margin:0;font-size:.7em;font-family:Verdana, Arial, Helvetica, sans-serif;background:#EEEEEE;}
+fieldset{padding:0 15px 10px 15px;} 
+h1{font-size:2.4em;margin:0;color:#FFF;}
+h2{font-size:1.7em;margin:0;color:#CC0000;} 
+h3{font-size:1.2em;margin:10px 0 0 0;color:#000000;} 
+#header{width:96%;margin:0 0 0 0;padding:6px 2% 6px 2%;font-family:"trebuchet MS", Verdana, sans-serif;color:#FFF;
+background-color:#555555;}
+#content{margin:0 0 0 2%;position:relative;}
+.content-container{background:#FFF;width:96%;margin-top:8px;padding:10px;position:relative;}
+-->
+</style>
+</head>
+<body>
+<div id="header"><h1>Server Error</h1></div>
+<div id="content">
+ <div class="content-container"><fieldset>
+  <h2>502 - Web server received an invalid response while acting as a gateway or proxy server.</h2>
+  <h3>There is a problem with the page you are looking for, and it cannot be displayed. When the Web server (while acting as a gateway or proxy) contacted the upstream content server, it received an invalid response from the content server.</h3>
+ </fieldset></div>
+</div>
+</body>
+</html>
+`
+
+// httpSysUnavailable is the page HTTP.sys answers with when an App Service
+// application is stopped or its pool is down
+const httpSysUnavailable = "<!DOCTYPE HTML PUBLIC \"-//W3C//DTD HTML 4.01//EN\"\"http://www.w3.org/TR/html4/strict.dtd\">\r\n" +
+	"<HTML><HEAD><TITLE>Service Unavailable</TITLE>\r\n" +
+	"<META HTTP-EQUIV=\"Content-Type\" Content=\"text/html; charset=us-ascii\"></HEAD>\r\n" +
+	"<BODY><h2>Service Unavailable</h2>\r\n" +
+	"<hr><p>HTTP Error 503. The service is unavailable.</p>\r\n" +
+	"</BODY></HTML>\r\n"
+
+// pages are the error pages each front end generates, by status. A classic
+// load balancer answers with an empty body.
+var pages = map[string]map[int]page{
+	config.CloudAWSALB: {
+		http.StatusBadGateway:         albPage(http.StatusBadGateway),
+		http.StatusServiceUnavailable: albPage(http.StatusServiceUnavailable),
+		http.StatusGatewayTimeout:     albPage(http.StatusGatewayTimeout),
+	},
+	config.CloudAWSELB: {
+		http.StatusBadGateway:         {},
+		http.StatusServiceUnavailable: {},
+		http.StatusGatewayTimeout:     {},
+	},
+	config.CloudAWSCloudFront: {
+		http.StatusBadGateway:     cloudFrontPage(http.StatusBadGateway, "CloudFront wasn't able to connect to the origin."),
+		http.StatusGatewayTimeout: cloudFrontPage(http.StatusGatewayTimeout, "CloudFront attempted to establish a connection with the origin, but either the attempt failed or the origin closed the connection."),
+	},
+	config.CloudAzureAppService: {
+		http.StatusBadGateway:         {server: "Microsoft-IIS/10.0", contentType: "text/html", body: arrBadGateway},
+		http.StatusServiceUnavailable: {server: "Microsoft-HTTPAPI/2.0", contentType: "text/html; charset=us-ascii", body: httpSysUnavailable},
+	},
+}
@@ -0,0 +1,112 @@
+// Package cms gives CMS services a REST API with state. Each source sees the
+// site's seeded objects plus whatever it created, edited, or deleted through
+// the API, for as long as its session lasts, so an attacker who creates a
+// post or an administrator finds it there on the next request.
+package cms
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/logging"
+)
+
+// cmsLog logs the content clients change
+var cmsLog = logging.Logger("cms")
+
+const (
+	// maxSites bounds the sources whose state is kept at once
+	maxSites = 10000
+
+	// maxObjects bounds the posts and users a source may create
+	maxObjects = 200
+
+	// maxBody bounds how much of a request body is read
+	maxBody = 1 << 20
+)
+
+// Store keeps the state each source has built up through a CMS service's API
+type Store struct {
+	users   []string
+	timeout time.Duration
+
+	mu        sync.Mutex
+	sites     map[string]*site
+	lastSweep time.Time
+}
+
+// New creates the store of a service, or nil if its CMS API is disabled
+func New(cfg *config.ServiceConfig) *Store {
+	if cfg.CMS == nil || !cfg.CMS.Enabled {
+		return nil
+	}
+	users := cfg.CMS.Users
+	if len(users) == 0 {
+		users = []string{"admin"}
+	}
+	return &Store{
+		users:   users,
+		timeout: database.SessionIdleTimeout,
+		sites:   make(map[string]*site),
+	}
+}
+
+// Handle answers a request for the CMS API, reporting whether it did
+func (s *Store) Handle(w http.ResponseWriter, r *http.Request) bool {
+	if s == nil {
+		return false
+	}
+	route, ok := restRoute(r)
+	if !ok {
+		return false
+	}
+
+	st := s.site(database.SourceIP(r.RemoteAddr))
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.serve(w, r, route)
+}
+
+// site returns the state of a source, starting it from the seeded objects
+// the first time and after its session expires
+func (s *Store) site(src string) *site {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute || len(s.sites) >= maxSites {
+		s.sweep(now)
+	}
+
+	st, ok := s.sites[src]
+	if !ok || now.Sub(st.lastSeen) > s.timeout {
+		st = newSite(s.users, now)
+		s.sites[src] = st
+	}
+	st.lastSeen = now
+	return st
+}
+
+// sweep forgets sources whose session has expired, and the least recently
+// seen ones while the store is full
+func (s *Store) sweep(now time.Time) {
+	s.lastSweep = now
+	for src, st := range s.sites {
+		if now.Sub(st.lastSeen) > s.timeout {
+			delete(s.sites, src)
+		}
+	}
+	for len(s.sites) >= maxSites {
+		var oldest string
+		for src, st := range s.sites {
+			if oldest == "" || st.lastSeen.Before(s.sites[oldest].lastSeen) {
+				oldest = src
+			}
+		}
+		cmsLog.Warn("CMS state full, forgetting site", "site", oldest)
+		delete(s.sites, oldest)
+	}
+}
@@ -0,0 +1,81 @@
+package cms
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestStore_Handle(t *testing.T) {
+	store := New(&config.ServiceConfig{Type: "wordpress", CMS: &config.CMSConfig{Enabled: true}})
+
+	send := func(source, method, target, body string, auth bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.RemoteAddr = source + ":40000"
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if auth {
+			r.SetBasicAuth("admin", "hunter2")
+		}
+		w := httptest.NewRecorder()
+		if !store.Handle(w, r) {
+			t.Fatalf("Expected %s %s to be handled", method, target)
+		}
+		return w
+	}
+	titles := func(w *httptest.ResponseRecorder) []string {
+		var posts []struct {
+			Title struct{ Rendered string } `json:"title"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &posts); err != nil {
+			t.Fatalf("Failed to parse posts: %v", err)
+		}
+		names := make([]string, len(posts))
+		for i, p := range posts {
+			names[i] = p.Title.Rendered
+		}
+		return names
+	}
+
+	if w := send("203.0.113.7", "POST", "/wp-json/wp/v2/posts", `{"title":"pwned"}`, false); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "rest_cannot_create") {
+		t.Fatalf("Expected rest_cannot_create without credentials, got %d %s", w.Code, w.Body)
+	}
+
+	w := send("203.0.113.7", "POST", "/wp-json/wp/v2/posts", `{"title":"pwned","content":"<script>x</script>","status":"publish"}`, true)
+	if w.Code != http.StatusCreated || w.Header().Get("Location") == "" {
+		t.Fatalf("Expected post to be created, got %d %s", w.Code, w.Body)
+	}
+
+	if got := titles(send("203.0.113.7", "GET", "/wp-json/wp/v2/posts", "", false)); len(got) != 2 || got[0] != "pwned" {
+		t.Fatalf("Expected the created post listed first, got %v", got)
+	}
+	if got := titles(send("198.51.100.9", "GET", "/?rest_route=/wp/v2/posts", "", false)); len(got) != 1 || got[0] != "Hello world!" {
+		t.Fatalf("Expected another source to see only the first post, got %v", got)
+	}
+
+	w = send("203.0.113.7", "POST", "/wp-json/wp/v2/users", `{"username":"backdoor","email":"x@example.com","password":"p","roles":["administrator"]}`, true)
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"roles":["administrator"]`) {
+		t.Fatalf("Expected administrator to be created, got %d %s", w.Code, w.Body)
+	}
+	if w := send("203.0.113.7", "GET", "/wp-json/wp/v2/users", "", false); w.Header().Get("X-WP-Total") != "2" || strings.Contains(w.Body.String(), "x@example.com") {
+		t.Fatalf("Expected 2 users without emails, got %s %s", w.Header().Get("X-WP-Total"), w.Body)
+	}
+	if w := send("203.0.113.7", "DELETE", "/wp-json/wp/v2/users/2", "", true); w.Code != http.StatusNotImplemented {
+		t.Fatalf("Expected users not to be trashed, got %d", w.Code)
+	}
+	if w := send("203.0.113.7", "DELETE", "/wp-json/wp/v2/users/2?force=true", "", true); w.Code != http.StatusOK {
+		t.Fatalf("Expected user to be deleted, got %d %s", w.Code, w.Body)
+	}
+	if w := send("203.0.113.7", "GET", "/wp-json/wp/v2/users/2", "", false); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected deleted user to be gone, got %d", w.Code)
+	}
+
+	if store.Handle(httptest.NewRecorder(), httptest.NewRequest("GET", "/wp-login.php", nil)) {
+		t.Fatalf("Expected paths outside the API to be left to the service")
+	}
+}
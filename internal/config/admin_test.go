@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_PprofRequiresToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	base := `database:
+  path: ./spoof.db
+services:
+  - name: web
+    type: generic
+    enabled: true
+    ports: [8080]
+    endpoints:
+      - path: /
+        method: GET
+        status: 200
+admin:
+  enabled: true
+  port: 9000
+  pprof: true
+`
+
+	os.WriteFile(path, []byte(base), 0644)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "admin.pprof requires admin.token") {
+		t.Fatalf("Expected pprof without a token to be rejected, got %v", err)
+	}
+
+	os.WriteFile(path, []byte(base+"  token: changeme\n"), 0644)
+	if _, err := LoadConfig(path); err != nil {
+		t.Fatalf("Expected pprof with a token to load, got %v", err)
+	}
+}
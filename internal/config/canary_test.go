@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_CanaryRequiresLogging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	// A canary whose requests are not logged would never alert, whether the
+	// endpoint or its service turns logging off
+	configs := map[string]string{
+		"endpoint": `database:
+  path: ./spoof.db
+services:
+  - name: web
+    type: generic
+    enabled: true
+    ports: [8080]
+    endpoints:
+      - path: /backup.zip
+        method: GET
+        status: 404
+        type: canary
+        logging:
+          enabled: false
+`,
+		"service": `database:
+  path: ./spoof.db
+services:
+  - name: web
+    type: generic
+    enabled: true
+    ports: [8080]
+    logging:
+      enabled: false
+    endpoints:
+      - path: /backup.zip
+        method: GET
+        status: 404
+        type: canary
+`,
+	}
+	for name, yaml := range configs {
+		os.WriteFile(path, []byte(yaml), 0644)
+		_, err := LoadConfig(path)
+		if err == nil || !strings.Contains(err.Error(), "requires logging") {
+			t.Fatalf("Expected a canary with logging disabled on its %s to be rejected, got %v", name, err)
+		}
+	}
+}
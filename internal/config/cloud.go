@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Cloud front ends a deployment can mimic
+const (
+	// CloudNone disables the global profile for a service
+	CloudNone = "none"
+
+	CloudAWSALB          = "aws-alb"
+	CloudAWSELB          = "aws-elb"
+	CloudAWSCloudFront   = "aws-cloudfront"
+	CloudAzureAppService = "azure-app-service"
+)
+
+// DefaultCloudFrontPop is the CloudFront edge location named when cloud.pop
+// is not set
+const DefaultCloudFrontPop = "IAD89-C1"
+
+// cloudFrontPop matches CloudFront edge location codes, such as FRA56-P1
+var cloudFrontPop = regexp.MustCompile(`^[A-Z]{3}[0-9]{1,3}-[A-Z][0-9]{1,2}$`)
+
+// CloudConfig makes services look hosted behind a cloud provider's load
+// balancer or CDN: its headers and cookies are added to every response, and
+// its own error pages replace the gateway errors it would generate
+type CloudConfig struct {
+	// Profile is CloudAWSALB, CloudAWSELB, CloudAWSCloudFront, or
+	// CloudAzureAppService, or empty for none. Personalities and services
+	// may set their own.
+	Profile string `yaml:"profile,omitempty"`
+
+	// Pop is the CloudFront edge location responses claim to come from
+	Pop string `yaml:"pop,omitempty"`
+}
+
+// GetPop returns the CloudFront edge location responses claim to come from
+func (c *CloudConfig) GetPop() string {
+	if c.Pop == "" {
+		return DefaultCloudFrontPop
+	}
+	return c.Pop
+}
+
+// GetCloud returns the cloud front end of a service: its own, or the global
+// one. It is empty for none.
+func (c *Config) GetCloud(svc *ServiceConfig) string {
+	profile := c.Cloud.Profile
+	if svc != nil && svc.Cloud != "" {
+		profile = svc.Cloud
+	}
+	if profile == CloudNone {
+		return ""
+	}
+	return profile
+}
+
+// validateCloud checks that a cloud profile is known
+func validateCloud(profile string) error {
+	switch profile {
+	case "", CloudNone, CloudAWSALB, CloudAWSELB, CloudAWSCloudFront, CloudAzureAppService:
+		return nil
+	}
+	return fmt.Errorf("unknown cloud profile %q", profile)
+}
+
+// validate checks the profile and edge location
+func (c *CloudConfig) validate() error {
+	if c.Profile == CloudNone {
+		return fmt.Errorf("profile: %q only applies to services", CloudNone)
+	}
+	if err := validateCloud(c.Profile); err != nil {
+		return fmt.Errorf("profile: %w", err)
+	}
+	if c.Pop != "" && !cloudFrontPop.MatchString(c.Pop) {
+		return fmt.Errorf("pop: %q is not an edge location such as FRA56-P1", c.Pop)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestEndpointConfig_GetWhen(t *testing.T) {
+	tests := []struct {
+		ep   EndpointConfig
+		want string
+	}{
+		{EndpointConfig{}, ""},
+		{EndpointConfig{When: `path == "/"`}, `path == "/"`},
+		{EndpointConfig{Countries: []string{"de", "AT"}}, `country in ["DE", "AT"]`},
+		{EndpointConfig{Countries: []string{"!US"}, ASNs: []int{64500, 64501}},
+			`country != "" && !(country in ["US"]) && asn in [64500, 64501]`},
+		{EndpointConfig{Countries: []string{"DE", "!AT"}, When: `a || b`},
+			`country in ["DE"] && !(country in ["AT"]) && (a || b)`},
+	}
+	for _, tt := range tests {
+		if got := tt.ep.GetWhen(); got != tt.want {
+			t.Fatalf("Expected %q for %+v, got %q", tt.want, tt.ep, got)
+		}
+	}
+}
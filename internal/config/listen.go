@@ -0,0 +1,346 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Address families services listen on
+const (
+	FamilyDual = "dual"
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// ListenAddr is an address and port services listen on. An empty IP listens
+// on all addresses of Family, or of both families if it is empty.
+type ListenAddr struct {
+	IP     string
+	Port   int
+	Family string
+}
+
+func (a ListenAddr) String() string {
+	return net.JoinHostPort(a.Host(), strconv.Itoa(a.Port))
+}
+
+// Host returns the IP to listen on, which is the unspecified address of the
+// family when listening on all addresses of a single family
+func (a ListenAddr) Host() string {
+	if a.IP != "" {
+		return a.IP
+	}
+	switch a.Family {
+	case FamilyIPv4:
+		return "0.0.0.0"
+	case FamilyIPv6:
+		return "::"
+	}
+	return ""
+}
+
+// Network returns the network to listen on. IPv6-only listeners do not
+// accept IPv4 clients as v4-mapped addresses.
+func (a ListenAddr) Network() string {
+	switch a.Family {
+	case FamilyIPv4:
+		return "tcp4"
+	case FamilyIPv6:
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// families returns the address families a listener accepts clients from
+func (a ListenAddr) families() (v4, v6 bool) {
+	if a.IP != "" {
+		ip, err := netip.ParseAddr(a.IP)
+		if err != nil {
+			return false, false
+		}
+		return ip.Unmap().Is4(), !ip.Unmap().Is4()
+	}
+	switch a.Family {
+	case FamilyIPv4:
+		return true, false
+	case FamilyIPv6:
+		return false, true
+	}
+	return true, true
+}
+
+// AddressList is a list of IP addresses and interface names to bind, given
+// as a single string or a list
+type AddressList []string
+
+// UnmarshalYAML accepts a single address or a list of them
+func (a *AddressList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var items []string
+	if err := unmarshal(&items); err != nil {
+		var single string
+		if err := unmarshal(&single); err != nil {
+			return err
+		}
+		items = []string{single}
+	}
+	*a = items
+	return nil
+}
+
+// resolve returns the IPs the list binds in a family, with interface names
+// replaced by the addresses assigned to the interface. Link-local IPv6
+// addresses are skipped, since they cannot be bound without a zone.
+func (a AddressList) resolve(family string) ([]string, error) {
+	ips := make([]string, 0, len(a))
+	seen := make(map[string]bool)
+	add := func(ip netip.Addr) {
+		if s := ip.String(); !seen[s] {
+			seen[s] = true
+			ips = append(ips, s)
+		}
+	}
+
+	for _, entry := range a {
+		if ip, err := netip.ParseAddr(entry); err == nil {
+			if ip.IsUnspecified() {
+				return nil, fmt.Errorf("%s is not a specific address; use family to bind all addresses of one family", entry)
+			}
+			add(ip.Unmap())
+			continue
+		}
+
+		iface, err := net.InterfaceByName(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP address nor an interface", entry)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get addresses of interface %s: %w", entry, err)
+		}
+		found := false
+		for _, addr := range addrs {
+			prefix, err := netip.ParsePrefix(addr.String())
+			if err != nil {
+				continue
+			}
+			ip := prefix.Addr().Unmap()
+			if ip.IsLinkLocalUnicast() || (family == FamilyIPv4 && !ip.Is4()) || (family == FamilyIPv6 && ip.Is4()) {
+				continue
+			}
+			add(ip)
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("interface %s has no addresses to bind", entry)
+		}
+	}
+	return ips, nil
+}
+
+// ListenAddrs returns the addresses a service listens on for a port: its
+// address, each of its bind addresses, or all addresses of its family. The
+// family of a service bound to an address is implied by the address.
+func (s *ServiceConfig) ListenAddrs(port int) []ListenAddr {
+	if s.Address != "" {
+		return []ListenAddr{{IP: s.Address, Port: port}}
+	}
+
+	ips, _ := s.BindAddress.resolve(s.Family)
+	if len(ips) == 0 {
+		addr := ListenAddr{Port: port}
+		if s.Family != FamilyDual {
+			addr.Family = s.Family
+		}
+		return []ListenAddr{addr}
+	}
+
+	addrs := make([]ListenAddr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ListenAddr{IP: ip, Port: port}
+	}
+	return addrs
+}
+
+// applyBindAddress binds services with neither an address nor bind addresses
+// of their own to the global bind addresses
+func (c *Config) applyBindAddress() {
+	if len(c.BindAddress) == 0 {
+		return
+	}
+	for i := range c.Services {
+		svc := &c.Services[i]
+		if svc.Address == "" && len(svc.BindAddress) == 0 {
+			svc.BindAddress = c.BindAddress
+		}
+	}
+}
+
+// GetServicesByListener creates a mapping of listen addresses to services,
+// so services aliased to different IPs can share a port. The default service
+// of a listener comes first, followed by its virtual hosts in config order.
+func (c *Config) GetServicesByListener() map[ListenAddr][]ServiceConfig {
+	listeners := make(map[ListenAddr][]ServiceConfig)
+	for _, svc := range c.GetEnabledServices() {
+		for _, port := range svc.Ports {
+			for _, addr := range svc.ListenAddrs(port) {
+				listeners[addr] = append(listeners[addr], svc)
+			}
+		}
+	}
+	for _, svcs := range listeners {
+		sort.SliceStable(svcs, func(i, j int) bool { return svcs[i].Default && !svcs[j].Default })
+	}
+	return listeners
+}
+
+// GetTls returns the TLS identity a service presents, which is its own if it
+// configures one and the global one otherwise
+func (c *Config) GetTls(svc *ServiceConfig) TlsConfig {
+	if svc.Tls != nil {
+		return *svc.Tls
+	}
+	return c.Tls
+}
+
+// validateListeners checks service addresses and families, and rejects
+// ports bound both on all addresses and on a specific one of the same family,
+// which the OS does not allow
+func (c *Config) validateListeners() error {
+	if _, err := c.BindAddress.resolve(""); err != nil {
+		return fmt.Errorf("bindAddress: %w", err)
+	}
+
+	for i, svc := range c.Services {
+		if svc.Address != "" && net.ParseIP(svc.Address) == nil {
+			return fmt.Errorf("service[%d]: invalid address %q", i, svc.Address)
+		}
+		if err := validateFamily(svc.Family); err != nil {
+			return fmt.Errorf("service[%d].family: %w", i, err)
+		}
+		if svc.Address != "" && len(svc.BindAddress) > 0 {
+			return fmt.Errorf("service[%d]: address and bindAddress cannot both be set", i)
+		}
+		ips, err := svc.BindAddress.resolve(svc.Family)
+		if err != nil {
+			return fmt.Errorf("service[%d].bindAddress: %w", i, err)
+		}
+		for _, ip := range ips {
+			if svc.Family != "" && svc.Family != FamilyDual && (net.ParseIP(ip).To4() != nil) != (svc.Family == FamilyIPv4) {
+				return fmt.Errorf("service[%d]: bind address %s is not %s", i, ip, svc.Family)
+			}
+		}
+		if svc.Address != "" && svc.Family != "" && svc.Family != FamilyDual {
+			v4 := net.ParseIP(svc.Address).To4() != nil
+			if v4 != (svc.Family == FamilyIPv4) {
+				return fmt.Errorf("service[%d]: address %s is not %s", i, svc.Address, svc.Family)
+			}
+		}
+		if svc.Tls != nil && (svc.Tls.CertFilePath == "" || svc.Tls.KeyFilePath == "") {
+			return fmt.Errorf("service[%d]: tls requires certFilePath and keyFilePath", i)
+		}
+		if svc.Tls != nil {
+			if err := svc.Tls.validate(); err != nil {
+				return fmt.Errorf("service[%d]: tls.%w", i, err)
+			}
+		}
+		for j, host := range svc.Hosts {
+			if err := validateHost(host); err != nil {
+				return fmt.Errorf("service[%d].hosts[%d]: %w", i, j, err)
+			}
+		}
+	}
+	if err := validateFamily(c.Wildcard.Family); err != nil {
+		return fmt.Errorf("wildcard.family: %w", err)
+	}
+
+	byPort := make(map[int][]ListenAddr)
+	listeners := c.GetServicesByListener()
+	for addr := range listeners {
+		byPort[addr.Port] = append(byPort[addr.Port], addr)
+	}
+	for port, addrs := range byPort {
+		for i, a := range addrs {
+			for _, b := range addrs[i+1:] {
+				if a.IP != "" && b.IP != "" {
+					continue
+				}
+				a4, a6 := a.families()
+				b4, b6 := b.families()
+				if (a4 && b4) || (a6 && b6) {
+					return fmt.Errorf("port %d is bound on overlapping addresses %s by %s and %s by %s",
+						port, describeHost(a), listeners[a][0].Name, describeHost(b), listeners[b][0].Name)
+				}
+			}
+		}
+	}
+
+	for addr, svcs := range listeners {
+		if err := c.validateVirtualHosts(addr, svcs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateVirtualHosts checks the services sharing a listener, which may have
+// one default service, must not claim the same host, and must agree on
+// whether the listener serves TLS. Services speaking protocols other than
+// HTTP have their port to themselves.
+func (c *Config) validateVirtualHosts(addr ListenAddr, svcs []ServiceConfig) error {
+	hosts := make(map[string]string)
+	secure := c.GetTls(&svcs[0]).CertFilePath != ""
+	for i, svc := range svcs {
+		if len(svcs) > 1 && !svc.SpeaksHTTP() {
+			return fmt.Errorf("%s is shared by services %s and %s, but %s services cannot share a port",
+				addr, svcs[0].Name, svcs[1].Name, svc.Type)
+		}
+		if i > 0 && svc.Default {
+			return fmt.Errorf("%s has default services %s and %s", addr, svcs[0].Name, svc.Name)
+		}
+		if i > 0 && (c.GetTls(&svc).CertFilePath != "") != secure {
+			return fmt.Errorf("%s is shared by services %s and %s, which must both serve TLS or both not",
+				addr, svcs[0].Name, svc.Name)
+		}
+		for _, host := range svc.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := hosts[host]; ok && other != svc.Name {
+				return fmt.Errorf("%s has host %q on services %s and %s", addr, host, other, svc.Name)
+			}
+			hosts[host] = svc.Name
+		}
+	}
+	return nil
+}
+
+// validateHost checks a virtual host name, which may start with a "*." label
+// to match any subdomain
+func validateHost(host string) error {
+	name := strings.TrimPrefix(host, "*.")
+	if name == "" || strings.ContainsAny(name, "*:/ ") {
+		return fmt.Errorf("invalid host %q, expected a name or *.name", host)
+	}
+	return nil
+}
+
+// validateFamily checks a configured address family, which may be empty to
+// listen on both
+func validateFamily(family string) error {
+	switch family {
+	case "", FamilyDual, FamilyIPv4, FamilyIPv6:
+		return nil
+	}
+	return fmt.Errorf("unknown family %q, expected %s, %s, or %s", family, FamilyDual, FamilyIPv4, FamilyIPv6)
+}
+
+// describeHost names the addresses a listener is bound on for errors
+func describeHost(a ListenAddr) string {
+	if host := a.Host(); host != "" {
+		return host
+	}
+	return "all addresses"
+}
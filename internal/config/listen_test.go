@@ -0,0 +1,159 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestGetServicesByListener(t *testing.T) {
+	cfg := &Config{
+		Tls: TlsConfig{CertFilePath: "global.pem", KeyFilePath: "global.key"},
+		Services: []ServiceConfig{
+			{Name: "web", Enabled: true, Ports: PortList{80}},
+			{Name: "mail", Enabled: true, Address: "10.0.0.2", Ports: PortList{443},
+				Tls: &TlsConfig{CertFilePath: "mail.pem", KeyFilePath: "mail.key"}},
+			{Name: "intranet", Enabled: true, Address: "10.0.0.3", Ports: PortList{443}},
+		},
+	}
+
+	listeners := cfg.GetServicesByListener()
+	if len(listeners) != 3 {
+		t.Fatalf("Expected 3 listeners, got %d", len(listeners))
+	}
+
+	mail := listeners[ListenAddr{IP: "10.0.0.2", Port: 443}]
+	if len(mail) != 1 || mail[0].Name != "mail" {
+		t.Fatalf("Expected mail on 10.0.0.2:443, got %v", mail)
+	}
+	if got := cfg.GetTls(&mail[0]).CertFilePath; got != "mail.pem" {
+		t.Fatalf("Expected mail.pem, got %s", got)
+	}
+
+	intranet := listeners[ListenAddr{IP: "10.0.0.3", Port: 443}]
+	if got := cfg.GetTls(&intranet[0]).CertFilePath; got != "global.pem" {
+		t.Fatalf("Expected global.pem, got %s", got)
+	}
+
+	if err := cfg.validateListeners(); err != nil {
+		t.Fatalf("Expected valid listeners, got %v", err)
+	}
+
+	// A port bound on all addresses cannot also be bound on an alias
+	cfg.Services = append(cfg.Services, ServiceConfig{Name: "any", Enabled: true, Ports: PortList{443}})
+	if err := cfg.validateListeners(); err == nil {
+		t.Fatalf("Expected error for port bound on all and specific addresses")
+	}
+
+	// IPv4-only and IPv6-only listeners can share a port, but not with a
+	// listener on both families
+	cfg.Services = []ServiceConfig{
+		{Name: "web4", Enabled: true, Family: FamilyIPv4, Ports: PortList{80}},
+		{Name: "web6", Enabled: true, Family: FamilyIPv6, Ports: PortList{80}},
+		{Name: "alias6", Enabled: true, Address: "2001:db8::2", Ports: PortList{443}},
+		{Name: "any4", Enabled: true, Family: FamilyIPv4, Ports: PortList{443}},
+	}
+	if err := cfg.validateListeners(); err != nil {
+		t.Fatalf("Expected valid listeners, got %v", err)
+	}
+	listeners = cfg.GetServicesByListener()
+	if got := (ListenAddr{Port: 80, Family: FamilyIPv6}); listeners[got] == nil || got.String() != "[::]:80" || got.Network() != "tcp6" {
+		t.Fatalf("Expected an IPv6-only listener on [::]:80, got %v", listeners)
+	}
+
+	cfg.Services = append(cfg.Services, ServiceConfig{Name: "dual", Enabled: true, Family: FamilyDual, Ports: PortList{80}})
+	if err := cfg.validateListeners(); err == nil {
+		t.Fatalf("Expected error for port bound on both families and on one")
+	}
+
+	cfg.Services = []ServiceConfig{{Name: "mismatch", Enabled: true, Address: "10.0.0.2", Family: FamilyIPv6, Ports: PortList{80}}}
+	if err := cfg.validateListeners(); err == nil {
+		t.Fatalf("Expected error for an IPv4 address on an IPv6-only service")
+	}
+
+	// Services sharing a listener are routed by host, the default first
+	cfg.Services = []ServiceConfig{
+		{Name: "intranet", Enabled: true, Ports: PortList{443}, Hosts: []string{"intranet.corp.test"}},
+		{Name: "www", Enabled: true, Ports: PortList{443}, Default: true},
+		{Name: "apps", Enabled: true, Ports: PortList{443}, Hosts: []string{"*.apps.test"}},
+	}
+	if err := cfg.validateListeners(); err != nil {
+		t.Fatalf("Expected valid virtual hosts, got %v", err)
+	}
+	shared := cfg.GetServicesByListener()[ListenAddr{Port: 443}]
+	if len(shared) != 3 || shared[0].Name != "www" || shared[1].Name != "intranet" {
+		t.Fatalf("Expected the default service first, got %v", shared)
+	}
+
+	cfg.Services[2].Hosts = []string{"Intranet.corp.test"}
+	if err := cfg.validateListeners(); err == nil {
+		t.Fatalf("Expected error for a host claimed by two services")
+	}
+	cfg.Services[2].Hosts = []string{"portal.*.test"}
+	if err := cfg.validateListeners(); err == nil {
+		t.Fatalf("Expected error for a wildcard past the first label")
+	}
+	cfg.Services[2].Hosts = nil
+	cfg.Services[2].Default = true
+	if err := cfg.validateListeners(); err == nil {
+		t.Fatalf("Expected error for two default services")
+	}
+	cfg.Services[2].Default = false
+	cfg.Services[2].Tls = &TlsConfig{CertFilePath: "apps.pem", KeyFilePath: "apps.key"}
+	cfg.Tls = TlsConfig{}
+	if err := cfg.validateListeners(); err == nil {
+		t.Fatalf("Expected error for TLS and plaintext services sharing a listener")
+	}
+
+	// SSH services cannot share a port with web services
+	cfg.Services = []ServiceConfig{
+		{Name: "www", Enabled: true, Ports: PortList{22}, Default: true},
+		{Name: "openssh", Type: ServiceTypeSSH, Enabled: true, Ports: PortList{22}},
+	}
+	if err := cfg.validateListeners(); err == nil {
+		t.Fatalf("Expected error for an ssh service sharing a listener")
+	}
+}
+
+func TestBindAddress(t *testing.T) {
+	cfg := &Config{
+		BindAddress: AddressList{"10.0.0.2"},
+		Services: []ServiceConfig{
+			{Name: "web", Enabled: true, Ports: PortList{80}},
+			{Name: "admin", Enabled: true, BindAddress: AddressList{"10.0.0.3", "10.0.0.4", "10.0.0.3"}, Ports: PortList{80}},
+			{Name: "mail", Enabled: true, Address: "10.0.0.5", Ports: PortList{80}},
+		},
+	}
+	cfg.applyBindAddress()
+	if err := cfg.validateListeners(); err != nil {
+		t.Fatalf("Expected valid listeners, got %v", err)
+	}
+
+	listeners := cfg.GetServicesByListener()
+	want := map[string]string{"10.0.0.2": "web", "10.0.0.3": "admin", "10.0.0.4": "admin", "10.0.0.5": "mail"}
+	if len(listeners) != len(want) {
+		t.Fatalf("Expected %d listeners, got %v", len(want), listeners)
+	}
+	for ip, name := range want {
+		if svcs := listeners[ListenAddr{IP: ip, Port: 80}]; len(svcs) != 1 || svcs[0].Name != name {
+			t.Fatalf("Expected %s on %s:80, got %v", name, ip, svcs)
+		}
+	}
+
+	// Interfaces bind every address assigned to them
+	addrs := (&ServiceConfig{BindAddress: AddressList{"lo"}, Family: FamilyIPv4}).ListenAddrs(80)
+	if len(addrs) == 0 || addrs[0].IP != "127.0.0.1" {
+		t.Fatalf("Expected the loopback interface to bind 127.0.0.1, got %v", addrs)
+	}
+
+	invalid := []ServiceConfig{
+		{Name: "both", Enabled: true, Address: "10.0.0.6", BindAddress: AddressList{"10.0.0.7"}, Ports: PortList{80}},
+		{Name: "unknown", Enabled: true, BindAddress: AddressList{"no-such-interface0"}, Ports: PortList{80}},
+		{Name: "unspecified", Enabled: true, BindAddress: AddressList{"0.0.0.0"}, Ports: PortList{80}},
+		{Name: "family", Enabled: true, BindAddress: AddressList{"10.0.0.8"}, Family: FamilyIPv6, Ports: PortList{80}},
+	}
+	for _, svc := range invalid {
+		cfg.Services = []ServiceConfig{svc}
+		if err := cfg.validateListeners(); err == nil {
+			t.Fatalf("Expected service %s to be rejected", svc.Name)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Outage modes, each how a server answers while its backend is down
+const (
+	OutageModeBadGateway  = "badGateway"
+	OutageModeUnavailable = "unavailable"
+	OutageModeReset       = "reset"
+	OutageModeHalfClose   = "halfClose"
+)
+
+// OutageConfig simulates the backend behind a service failing, since a
+// server that is never down is itself a honeypot signal. An outage of
+// Duration starts once every Every, at a random time within it, and fails
+// every request while it lasts. Outside outages each request fails with
+// Probability. Failed requests get Mode: badGateway and unavailable answer
+// with Response, a bare 502 or 503 with the service headers by default,
+// reset resets the connection, and halfClose closes the server's side of it
+// without a response.
+type OutageConfig struct {
+	Enabled     bool            `yaml:"enabled"`
+	Mode        string          `yaml:"mode,omitempty"`
+	Every       time.Duration   `yaml:"every,omitempty"`
+	Duration    time.Duration   `yaml:"duration,omitempty"`
+	Probability float64         `yaml:"probability,omitempty"`
+	Response    *ResponseConfig `yaml:"response,omitempty"`
+}
+
+// GetMode returns how failed requests are answered
+func (o *OutageConfig) GetMode() string {
+	if o.Mode == "" {
+		return OutageModeBadGateway
+	}
+	return o.Mode
+}
+
+// validate checks the mode is known and the outages fit in their period
+func (o *OutageConfig) validate() error {
+	switch o.GetMode() {
+	case OutageModeBadGateway, OutageModeUnavailable, OutageModeReset, OutageModeHalfClose:
+	default:
+		return fmt.Errorf("mode: unknown mode %q, expected %s, %s, %s, or %s", o.Mode,
+			OutageModeBadGateway, OutageModeUnavailable, OutageModeReset, OutageModeHalfClose)
+	}
+	if o.Every < 0 || o.Duration < 0 {
+		return fmt.Errorf("every and duration must not be negative")
+	}
+	if (o.Every > 0) != (o.Duration > 0) {
+		return fmt.Errorf("every and duration must be set together")
+	}
+	if o.Duration >= o.Every && o.Every > 0 {
+		return fmt.Errorf("duration must be shorter than every")
+	}
+	if o.Probability < 0 || o.Probability > 1 {
+		return fmt.Errorf("probability must be between 0 and 1")
+	}
+	if o.Every == 0 && o.Probability == 0 {
+		return fmt.Errorf("every and duration, or probability, are required")
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PersonalityConfig bundles everything that makes one fake machine coherent:
+// the address it answers on, its hostname, the services it runs, the TLS
+// identity they present, and the content theme their pages are drawn from
+type PersonalityConfig struct {
+	Name     string               `yaml:"name"`
+	Enabled  bool                 `yaml:"enabled"`
+	Address  string               `yaml:"address,omitempty"`
+	Hostname string               `yaml:"hostname,omitempty"`
+	Tls      *TlsConfig           `yaml:"tls,omitempty"`
+	Theme    string               `yaml:"theme,omitempty"`
+	Headers  map[string]string    `yaml:"headers,omitempty"`
+	Cloud    string               `yaml:"cloud,omitempty"`
+	Services []PersonalityService `yaml:"services"`
+}
+
+// PersonalityService assigns a service profile to a personality, optionally
+// on different ports than the profile's own
+type PersonalityService struct {
+	Service string   `yaml:"service"`
+	Ports   PortList `yaml:"ports,omitempty"`
+}
+
+// applyPersonalities adds a service for every service of every enabled
+// personality, copied from the referenced profile and named
+// "<personality>/<service>". Profiles need not be enabled themselves, so a
+// disabled service can serve purely as a template for personalities.
+func (c *Config) applyPersonalities() error {
+	profiles := make(map[string]ServiceConfig, len(c.Services))
+	for _, svc := range c.Services {
+		profiles[svc.Name] = svc
+	}
+
+	for i, p := range c.Personalities {
+		if p.Name == "" {
+			return fmt.Errorf("personality[%d]: name is required", i)
+		}
+		if !p.Enabled {
+			continue
+		}
+		if len(p.Services) == 0 {
+			return fmt.Errorf("personality %s: at least one service is required", p.Name)
+		}
+
+		for _, ps := range p.Services {
+			profile, ok := profiles[ps.Service]
+			if !ok {
+				return fmt.Errorf("personality %s: unknown service %q", p.Name, ps.Service)
+			}
+			c.Services = append(c.Services, p.apply(profile, ps))
+		}
+	}
+
+	return nil
+}
+
+// apply derives a personality's copy of a service profile
+func (p *PersonalityConfig) apply(profile ServiceConfig, ps PersonalityService) ServiceConfig {
+	svc := profile
+	svc.Name = p.Name + "/" + profile.Name
+	svc.Enabled = true
+	svc.Personality = p.Name
+	svc.Hostname = p.Hostname
+
+	if p.Address != "" {
+		svc.Address = p.Address
+		svc.BindAddress = nil
+	}
+	if len(ps.Ports) > 0 {
+		svc.Ports = ps.Ports
+	}
+	if p.Tls != nil {
+		svc.Tls = p.Tls
+	}
+	if p.Cloud != "" {
+		svc.Cloud = p.Cloud
+	}
+
+	// Copy maps and slices the personality modifies, so the profile and other
+	// personalities built from it are left untouched
+	svc.Headers = make(map[string]string, len(profile.Headers)+len(p.Headers))
+	for k, v := range profile.Headers {
+		svc.Headers[k] = v
+	}
+	for k, v := range p.Headers {
+		svc.Headers[k] = v
+	}
+
+	svc.Endpoints = make([]EndpointConfig, len(profile.Endpoints))
+	for i, ep := range profile.Endpoints {
+		ep.Template = p.themed(ep.Template)
+		svc.Endpoints[i] = ep
+	}
+
+	if profile.BadRequest != nil {
+		badRequest := *profile.BadRequest
+		badRequest.Template = p.themed(badRequest.Template)
+		svc.BadRequest = &badRequest
+	}
+
+	if profile.ServerError != nil {
+		serverError := *profile.ServerError
+		serverError.Template = p.themed(serverError.Template)
+		svc.ServerError = &serverError
+	}
+
+	return svc
+}
+
+// themed returns the theme's copy of a template if it has one. Themes mirror
+// the template tree, so ./services/apache2/404.html is looked up as
+// <theme>/services/apache2/404.html.
+func (p *PersonalityConfig) themed(template string) string {
+	if p.Theme == "" || template == "" {
+		return template
+	}
+
+	path := filepath.Join(p.Theme, template)
+	if _, err := os.Stat(path); err != nil {
+		return template
+	}
+	return path
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyPersonalities(t *testing.T) {
+	theme := t.TempDir()
+	themed := filepath.Join(theme, "services", "iis", "404.html")
+	if err := os.MkdirAll(filepath.Dir(themed), 0755); err != nil {
+		t.Fatalf("Failed to create theme: %v", err)
+	}
+	if err := os.WriteFile(themed, []byte("themed"), 0644); err != nil {
+		t.Fatalf("Failed to write theme template: %v", err)
+	}
+
+	cfg := &Config{
+		Services: []ServiceConfig{
+			{
+				Name: "iis", Type: "iis", Ports: PortList{80},
+				Headers: map[string]string{"Server": "Microsoft-IIS/10.0"},
+				Endpoints: []EndpointConfig{
+					{Path: "/*", Method: "*", Status: 404, Template: "services/iis/404.html"},
+					{Path: "/", Method: "GET", Status: 200, Template: "services/iis/default.html"},
+				},
+			},
+		},
+		Personalities: []PersonalityConfig{
+			{
+				Name: "mail", Enabled: true, Address: "10.0.0.2", Hostname: "mail.example.com",
+				Theme:    theme,
+				Tls:      &TlsConfig{CertFilePath: "mail.pem", KeyFilePath: "mail.key"},
+				Headers:  map[string]string{"X-Powered-By": "ASP.NET"},
+				Services: []PersonalityService{{Service: "iis", Ports: PortList{443}}},
+			},
+			{Name: "off", Services: []PersonalityService{{Service: "iis"}}},
+		},
+	}
+
+	if err := cfg.applyPersonalities(); err != nil {
+		t.Fatalf("Failed to apply personalities: %v", err)
+	}
+	if len(cfg.Services) != 2 {
+		t.Fatalf("Expected 2 services, got %d", len(cfg.Services))
+	}
+
+	svc := cfg.Services[1]
+	if svc.Name != "mail/iis" || !svc.Enabled || svc.Address != "10.0.0.2" || svc.Ports[0] != 443 {
+		t.Fatalf("Expected mail/iis enabled on 10.0.0.2:443, got %+v", svc)
+	}
+	if svc.Hostname != "mail.example.com" || svc.Tls.CertFilePath != "mail.pem" {
+		t.Fatalf("Expected personality hostname and TLS, got %+v", svc)
+	}
+	if svc.Headers["X-Powered-By"] != "ASP.NET" || cfg.Services[0].Headers["X-Powered-By"] != "" {
+		t.Fatalf("Expected personality headers on the copy only")
+	}
+	if svc.Endpoints[0].Template != themed {
+		t.Fatalf("Expected themed template %s, got %s", themed, svc.Endpoints[0].Template)
+	}
+	if svc.Endpoints[1].Template != "services/iis/default.html" {
+		t.Fatalf("Expected unthemed template to be kept, got %s", svc.Endpoints[1].Template)
+	}
+
+	cfg.Personalities = []PersonalityConfig{{Name: "bad", Enabled: true, Services: []PersonalityService{{Service: "missing"}}}}
+	if err := cfg.applyPersonalities(); err == nil {
+		t.Fatalf("Expected error for unknown service")
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortList is a list of ports that can be written in YAML as numbers,
+// ranges ("8000-8100"), and exclusions ("!8080" or "!8050-8059"), either as a
+// list or as a single string. Exclusions apply to the whole list regardless
+// of their position.
+type PortList []int
+
+// UnmarshalYAML expands ranges and removes exclusions
+func (p *PortList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var items []interface{}
+	if err := unmarshal(&items); err != nil {
+		var single interface{}
+		if err := unmarshal(&single); err != nil {
+			return err
+		}
+		items = []interface{}{single}
+	}
+
+	include := make([]int, 0, len(items))
+	exclude := make(map[int]bool)
+
+	for _, item := range items {
+		switch v := item.(type) {
+		case int:
+			if err := checkPort(v); err != nil {
+				return err
+			}
+			include = append(include, v)
+		case string:
+			for _, spec := range strings.Split(v, ",") {
+				spec = strings.TrimSpace(spec)
+				excluded := strings.HasPrefix(spec, "!")
+				ports, err := ParsePortRange(strings.TrimPrefix(spec, "!"))
+				if err != nil {
+					return err
+				}
+				for _, port := range ports {
+					if excluded {
+						exclude[port] = true
+					} else {
+						include = append(include, port)
+					}
+				}
+			}
+		default:
+			return fmt.Errorf("invalid port %v", item)
+		}
+	}
+
+	seen := make(map[int]bool, len(include))
+	ports := make(PortList, 0, len(include))
+	for _, port := range include {
+		if exclude[port] || seen[port] {
+			continue
+		}
+		seen[port] = true
+		ports = append(ports, port)
+	}
+
+	*p = ports
+	return nil
+}
+
+// ParsePortRange parses a single port ("8080") or an inclusive range
+// ("8000-8100")
+func ParsePortRange(spec string) ([]int, error) {
+	lo, hi, isRange := strings.Cut(spec, "-")
+
+	start, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", spec)
+	}
+	end := start
+	if isRange {
+		end, err = strconv.Atoi(strings.TrimSpace(hi))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port range %q", spec)
+		}
+	}
+
+	if err := checkPort(start); err != nil {
+		return nil, err
+	}
+	if err := checkPort(end); err != nil {
+		return nil, err
+	}
+	if end < start {
+		return nil, fmt.Errorf("invalid port range %q: end is before start", spec)
+	}
+
+	ports := make([]int, 0, end-start+1)
+	for port := start; port <= end; port++ {
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func checkPort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port %d out of range", port)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestPortList(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want PortList
+	}{
+		{"numbers", `[80, 443]`, PortList{80, 443}},
+		{"range", `["8000-8003"]`, PortList{8000, 8001, 8002, 8003}},
+		{"single string", `"8000-8002, 9000"`, PortList{8000, 8001, 8002, 9000}},
+		{"exclusions", `["8000-8005", "!8001", "!8003-8004", 80]`, PortList{8000, 8002, 8005, 80}},
+		{"duplicates", `[80, "79-81"]`, PortList{80, 79, 81}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got PortList
+			if err := yaml.Unmarshal([]byte(tt.yaml), &got); err != nil {
+				t.Fatalf("Failed to unmarshal %s: %v", tt.yaml, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	for _, bad := range []string{`["9000-8000"]`, `[0]`, `["http"]`, `["1-70000"]`} {
+		var got PortList
+		if err := yaml.Unmarshal([]byte(bad), &got); err == nil {
+			t.Fatalf("Expected error for %s, got %v", bad, got)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"net/http"
+
+	"github.com/davidthuman/service-spoof/internal/profile"
+)
+
+// applyProfiles adds the default headers of the release each service's
+// profileVersion selects, leaving those it sets itself
+func (c *Config) applyProfiles() {
+	for i := range c.Services {
+		svc := &c.Services[i]
+		p := profile.New(svc.Type, svc.ProfileVersion)
+		if p == nil {
+			continue
+		}
+
+		set := make(map[string]bool, len(svc.Headers))
+		for k := range svc.Headers {
+			set[http.CanonicalHeaderKey(k)] = true
+		}
+		headers := make(map[string]string, len(svc.Headers))
+		for k, v := range p.Headers() {
+			if !set[k] {
+				headers[k] = v
+			}
+		}
+		for k, v := range svc.Headers {
+			headers[k] = v
+		}
+		svc.Headers = headers
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Report parameter types
+const (
+	ReportParamString = "string"
+	ReportParamInt    = "int"
+	ReportParamFloat  = "float"
+	ReportParamBool   = "bool"
+
+	// ReportParamTime takes an RFC 3339 time or a duration, meaning that long
+	// ago, such as 24h
+	ReportParamTime = "time"
+)
+
+// reportName matches report and parameter names, which appear in URLs and
+// as SQL named parameters
+var reportName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ReportConfig is a saved SQL query the admin API runs on request at
+// /api/reports/{name}. The query may only read, and takes its parameters as
+// named SQL parameters, such as :since.
+type ReportConfig struct {
+	Name        string        `yaml:"name" json:"name"`
+	Description string        `yaml:"description,omitempty" json:"description,omitempty"`
+	Query       string        `yaml:"query" json:"query"`
+	Params      []ReportParam `yaml:"params,omitempty" json:"params,omitempty"`
+}
+
+// ReportParam is a parameter of a report, taken from the query string of the
+// request running it
+type ReportParam struct {
+	Name string `yaml:"name" json:"name"`
+
+	// Type is ReportParamString, the default, ReportParamInt,
+	// ReportParamFloat, ReportParamBool, or ReportParamTime
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+
+	// Default is used when the parameter is not given. A required parameter
+	// has none; an optional one without a default is NULL.
+	Default  string `yaml:"default,omitempty" json:"default,omitempty"`
+	Required bool   `yaml:"required,omitempty" json:"required,omitempty"`
+}
+
+// Parse converts a value of the parameter to its type
+func (p *ReportParam) Parse(v string) (any, error) {
+	switch p.Type {
+	case "", ReportParamString:
+		return v, nil
+	case ReportParamInt:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q is not an integer", p.Name, v)
+		}
+		return n, nil
+	case ReportParamFloat:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q is not a number", p.Name, v)
+		}
+		return f, nil
+	case ReportParamBool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q is not a boolean", p.Name, v)
+		}
+		return b, nil
+	case ReportParamTime:
+		if d, err := time.ParseDuration(v); err == nil {
+			return time.Now().Add(-d), nil
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q is neither an RFC 3339 time nor a duration", p.Name, v)
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("unknown type %q of %s", p.Type, p.Name)
+}
+
+// Validate checks that a report is named, has a query, and declares each
+// parameter once with a known type and a valid default. Its errors wrap
+// ErrValidation.
+func (r *ReportConfig) Validate() error {
+	return invalid(r.validate())
+}
+
+func (r *ReportConfig) validate() error {
+	if !reportName.MatchString(r.Name) {
+		return fmt.Errorf("name %q must be lowercase letters, digits, and underscores", r.Name)
+	}
+	if r.Query == "" {
+		return fmt.Errorf("query is required")
+	}
+
+	seen := make(map[string]bool, len(r.Params))
+	for i := range r.Params {
+		p := &r.Params[i]
+		if !reportName.MatchString(p.Name) {
+			return fmt.Errorf("params[%d].name %q must be lowercase letters, digits, and underscores", i, p.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("params[%d].name %q is declared twice", i, p.Name)
+		}
+		seen[p.Name] = true
+		if p.Required && p.Default != "" {
+			return fmt.Errorf("params[%d]: a required parameter cannot have a default", i)
+		}
+		switch p.Type {
+		case "", ReportParamString, ReportParamInt, ReportParamFloat, ReportParamBool, ReportParamTime:
+		default:
+			return fmt.Errorf("params[%d].type %q must be string, int, float, bool, or time", i, p.Type)
+		}
+		if p.Default != "" {
+			if _, err := p.Parse(p.Default); err != nil {
+				return fmt.Errorf("params[%d].default: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
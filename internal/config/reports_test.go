@@ -0,0 +1,59 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReportValidate(t *testing.T) {
+	valid := ReportConfig{
+		Name:  "top_paths",
+		Query: "SELECT path FROM request_logs WHERE timestamp >= :since LIMIT :limit",
+		Params: []ReportParam{
+			{Name: "since", Type: ReportParamTime, Default: "24h"},
+			{Name: "limit", Type: ReportParamInt, Default: "20"},
+		},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected a valid report, got %v", err)
+	}
+
+	invalid := map[string]func(r *ReportConfig){
+		"name":       func(r *ReportConfig) { r.Name = "Top Paths" },
+		"query":      func(r *ReportConfig) { r.Query = "" },
+		"param name": func(r *ReportConfig) { r.Params[0].Name = "since;" },
+		"duplicate":  func(r *ReportConfig) { r.Params[1].Name = "since" },
+		"type":       func(r *ReportConfig) { r.Params[1].Type = "uint" },
+		"default":    func(r *ReportConfig) { r.Params[1].Default = "twenty" },
+		"required":   func(r *ReportConfig) { r.Params[1].Required = true },
+	}
+	for name, mutate := range invalid {
+		r := valid
+		r.Params = append([]ReportParam(nil), valid.Params...)
+		mutate(&r)
+		if err := r.Validate(); !errors.Is(err, ErrValidation) {
+			t.Fatalf("Expected an invalid %s to be rejected with ErrValidation, got %v", name, err)
+		}
+	}
+}
+
+func TestReportParamParse(t *testing.T) {
+	since := ReportParam{Name: "since", Type: ReportParamTime}
+	v, err := since.Parse("1h")
+	if ago := time.Since(v.(time.Time)); err != nil || ago < time.Hour || ago > time.Hour+time.Minute {
+		t.Fatalf("Expected an hour ago, got %v, %v", v, err)
+	}
+	v, err = since.Parse("2024-05-01T00:00:00Z")
+	if err != nil || !v.(time.Time).Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected the RFC 3339 time, got %v, %v", v, err)
+	}
+
+	limit := ReportParam{Name: "limit", Type: ReportParamInt}
+	if v, err := limit.Parse("20"); err != nil || v != int64(20) {
+		t.Fatalf("Expected 20, got %v, %v", v, err)
+	}
+	if _, err := limit.Parse("1; DROP TABLE request_logs"); err == nil {
+		t.Fatalf("Expected a non-integer to be rejected")
+	}
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvironmentVariable selects the per-environment overlay merged over the
+// base config file, e.g. config.production.yaml for "production"
+const EnvironmentVariable = "SERVICE_SPOOF_ENV"
+
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandConfig merges the environment overlay for path, if one is selected,
+// over the base config and substitutes ${NAME} references with values from
+// the top-level variables block or the process environment. YAML anchors
+// and merge keys are resolved during parsing, so shared blocks can be kept
+// under any unused top-level key such as definitions.
+func expandConfig(path string, data []byte) ([]byte, error) {
+	var base interface{}
+	if err := yaml.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	if env := os.Getenv(EnvironmentVariable); env != "" {
+		overlayPath := overlayPath(path, env)
+		overlayData, err := os.ReadFile(overlayPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s overlay: %w", env, err)
+		}
+
+		var overlay interface{}
+		if err := yaml.Unmarshal(overlayData, &overlay); err != nil {
+			return nil, fmt.Errorf("failed to parse %s overlay: %w", env, err)
+		}
+		base = mergeValues(base, overlay)
+	}
+
+	root, ok := base.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("config file must be a mapping")
+	}
+
+	vars, err := configVariables(root)
+	if err != nil {
+		return nil, err
+	}
+	delete(root, "variables")
+
+	expanded, err := expandValue(root, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(expanded)
+}
+
+// overlayPath returns the overlay file for an environment next to the base
+// config, e.g. ./config.yaml and "dev" give ./config.dev.yaml
+func overlayPath(path, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// configVariables reads the variables block, expanding environment
+// references in its values
+func configVariables(root map[interface{}]interface{}) (map[string]string, error) {
+	vars := make(map[string]string)
+
+	block, ok := root["variables"].(map[interface{}]interface{})
+	if !ok {
+		return vars, nil
+	}
+
+	for k, v := range block {
+		value, err := expandString(fmt.Sprint(v), nil)
+		if err != nil {
+			return nil, fmt.Errorf("variables.%v: %w", k, err)
+		}
+		vars[fmt.Sprint(k)] = value
+	}
+
+	return vars, nil
+}
+
+// expandValue substitutes variables in every string of a parsed YAML value.
+// A string consisting of a single reference takes the type of the value it
+// expands to, so ports: ["${HTTP_PORT}"] still decodes as an int.
+func expandValue(v interface{}, vars map[string]string) (interface{}, error) {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		for k, item := range val {
+			expanded, err := expandValue(item, vars)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", k, err)
+			}
+			val[k] = expanded
+		}
+		return val, nil
+	case []interface{}:
+		for i, item := range val {
+			expanded, err := expandValue(item, vars)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			val[i] = expanded
+		}
+		return val, nil
+	case string:
+		expanded, err := expandString(val, vars)
+		if err != nil {
+			return nil, err
+		}
+		if m := variablePattern.FindStringIndex(val); m != nil && m[0] == 0 && m[1] == len(val) {
+			var typed interface{}
+			if err := yaml.Unmarshal([]byte(expanded), &typed); err == nil {
+				if _, isString := typed.(string); !isString && typed != nil {
+					return typed, nil
+				}
+			}
+		}
+		return expanded, nil
+	default:
+		return v, nil
+	}
+}
+
+// expandString substitutes ${NAME} references from vars, falling back to the
+// environment. Undefined references are an error rather than silently empty.
+func expandString(s string, vars map[string]string) (string, error) {
+	var missing []string
+
+	expanded := variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		missing = append(missing, name)
+		return ref
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// mergeValues deep merges overlay into base. Maps merge key by key, the
+// services and personalities lists merge entries by name, and any other
+// value is replaced.
+func mergeValues(base, overlay interface{}) interface{} {
+	baseMap, ok1 := base.(map[interface{}]interface{})
+	overlayMap, ok2 := overlay.(map[interface{}]interface{})
+	if !ok1 || !ok2 {
+		if overlay == nil {
+			return base
+		}
+		return overlay
+	}
+
+	for k, v := range overlayMap {
+		if k == "services" || k == "personalities" {
+			baseMap[k] = mergeServices(baseMap[k], v)
+			continue
+		}
+		baseMap[k] = mergeValues(baseMap[k], v)
+	}
+	return baseMap
+}
+
+// mergeServices merges overlay entries into base entries with the same name
+// and appends the rest
+func mergeServices(base, overlay interface{}) interface{} {
+	baseList, ok1 := base.([]interface{})
+	overlayList, ok2 := overlay.([]interface{})
+	if !ok1 || !ok2 {
+		return mergeValues(base, overlay)
+	}
+
+	for _, item := range overlayList {
+		name := serviceName(item)
+		merged := false
+		for i, existing := range baseList {
+			if name != "" && serviceName(existing) == name {
+				baseList[i] = mergeValues(existing, item)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			baseList = append(baseList, item)
+		}
+	}
+	return baseList
+}
+
+func serviceName(v interface{}) string {
+	if m, ok := v.(map[interface{}]interface{}); ok {
+		if name, ok := m["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
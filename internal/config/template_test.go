@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig_Templating(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	base := `version: "1.0"
+variables:
+  TEMPLATE_DIR: ./services
+  HTTP_PORT: 8080
+database:
+  path: ${DB_DIR}/spoof.db
+definitions:
+  apacheHeaders: &apacheHeaders
+    Server: "Apache/2.4.63 (Unix)"
+services:
+  - name: apache2
+    type: apache2
+    enabled: true
+    ports: ["${HTTP_PORT}"]
+    headers:
+      <<: *apacheHeaders
+      Content-Type: text/html
+    endpoints:
+      - path: "/*"
+        method: "*"
+        status: 404
+        template: ${TEMPLATE_DIR}/apache2/404.html
+`
+	overlay := `services:
+  - name: apache2
+    ports: [80]
+database:
+  path: /var/lib/spoof.db
+`
+	os.WriteFile(path, []byte(base), 0644)
+	os.WriteFile(filepath.Join(dir, "config.prod.yaml"), []byte(overlay), 0644)
+
+	t.Setenv("DB_DIR", "/tmp/data")
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Database.Path != "/tmp/data/spoof.db" {
+		t.Fatalf("Expected environment substitution, got %q", cfg.Database.Path)
+	}
+	svc := cfg.Services[0]
+	if len(svc.Ports) != 1 || svc.Ports[0] != 8080 {
+		t.Fatalf("Expected port 8080, got %v", svc.Ports)
+	}
+	if svc.Headers["Server"] != "Apache/2.4.63 (Unix)" || svc.Headers["Content-Type"] != "text/html" {
+		t.Fatalf("Expected merged header block, got %v", svc.Headers)
+	}
+	if svc.Endpoints[0].Template != "./services/apache2/404.html" {
+		t.Fatalf("Expected variable substitution, got %q", svc.Endpoints[0].Template)
+	}
+
+	// The overlay merges into the service with the same name
+	t.Setenv(EnvironmentVariable, "prod")
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config with overlay: %v", err)
+	}
+	if cfg.Database.Path != "/var/lib/spoof.db" {
+		t.Fatalf("Expected overlay database path, got %q", cfg.Database.Path)
+	}
+	if len(cfg.Services) != 1 || cfg.Services[0].Ports[0] != 80 || len(cfg.Services[0].Endpoints) != 1 {
+		t.Fatalf("Expected overlay merged by service name, got %+v", cfg.Services)
+	}
+}
+
+func TestLoadConfig_UndefinedVariable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("database:\n  path: ${SERVICE_SPOOF_UNDEFINED}\n"), 0644)
+
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatalf("Expected error for undefined variable")
+	}
+}
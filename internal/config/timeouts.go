@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeoutsConfig holds the HTTP server timeouts of a listener. Unset
+// timeouts fall back to the global ones, then to DefaultTimeouts.
+type TimeoutsConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout,omitempty"`
+	ReadTimeout       time.Duration `yaml:"readTimeout,omitempty"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout,omitempty"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout,omitempty"`
+}
+
+// DefaultTimeouts bound how long slow clients can hold a connection open
+// when no timeouts are configured
+var DefaultTimeouts = TimeoutsConfig{
+	ReadHeaderTimeout: 10 * time.Second,
+	ReadTimeout:       30 * time.Second,
+	WriteTimeout:      30 * time.Second,
+	IdleTimeout:       120 * time.Second,
+}
+
+// GetTimeouts returns the server timeouts of a service, taking each from the
+// service if it sets it, then from the global timeouts, then from the
+// defaults. A nil service returns the global timeouts.
+func (c *Config) GetTimeouts(svc *ServiceConfig) TimeoutsConfig {
+	t := DefaultTimeouts
+	t.merge(c.Timeouts)
+	if svc != nil && svc.Timeouts != nil {
+		t.merge(*svc.Timeouts)
+	}
+	return t
+}
+
+// merge overrides the timeouts set in o
+func (t *TimeoutsConfig) merge(o TimeoutsConfig) {
+	if o.ReadHeaderTimeout != 0 {
+		t.ReadHeaderTimeout = o.ReadHeaderTimeout
+	}
+	if o.ReadTimeout != 0 {
+		t.ReadTimeout = o.ReadTimeout
+	}
+	if o.WriteTimeout != 0 {
+		t.WriteTimeout = o.WriteTimeout
+	}
+	if o.IdleTimeout != 0 {
+		t.IdleTimeout = o.IdleTimeout
+	}
+}
+
+// validate checks that no timeout is negative
+func (t TimeoutsConfig) validate() error {
+	timeouts := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"readHeaderTimeout", t.ReadHeaderTimeout},
+		{"readTimeout", t.ReadTimeout},
+		{"writeTimeout", t.WriteTimeout},
+		{"idleTimeout", t.IdleTimeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.d < 0 {
+			return fmt.Errorf("%s must not be negative", timeout.name)
+		}
+	}
+	return nil
+}
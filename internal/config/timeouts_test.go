@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetTimeouts(t *testing.T) {
+	cfg := &Config{
+		Timeouts: TimeoutsConfig{ReadTimeout: time.Minute, IdleTimeout: time.Minute},
+		Services: []ServiceConfig{
+			{Name: "web"},
+			{Name: "upload", Timeouts: &TimeoutsConfig{ReadTimeout: 5 * time.Minute}},
+		},
+	}
+
+	web := cfg.GetTimeouts(&cfg.Services[0])
+	want := TimeoutsConfig{
+		ReadHeaderTimeout: DefaultTimeouts.ReadHeaderTimeout,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      DefaultTimeouts.WriteTimeout,
+		IdleTimeout:       time.Minute,
+	}
+	if web != want {
+		t.Fatalf("Expected %+v, got %+v", want, web)
+	}
+
+	upload := cfg.GetTimeouts(&cfg.Services[1])
+	want.ReadTimeout = 5 * time.Minute
+	if upload != want {
+		t.Fatalf("Expected %+v, got %+v", want, upload)
+	}
+
+	if err := (TimeoutsConfig{WriteTimeout: -time.Second}).validate(); err == nil {
+		t.Fatalf("Expected an error for a negative timeout")
+	}
+}
@@ -0,0 +1,230 @@
+// Package conformance checks that a running spoof answers like the software
+// a service profile emulates. A corpus holds requests to a profile and
+// assertions on the responses real servers give, so a new or changed
+// profile comes with proof of what it gets right.
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/fidelity"
+	"gopkg.in/yaml.v2"
+)
+
+// Corpus is the cases of one service profile, read from a YAML file
+type Corpus struct {
+	// Profile is the name of the service the corpus applies to
+	Profile     string `yaml:"profile"`
+	Description string `yaml:"description,omitempty"`
+	Cases       []Case `yaml:"cases"`
+
+	// Path is the file the corpus was read from
+	Path string `yaml:"-"`
+}
+
+// Case is a raw request and the assertions its response must satisfy.
+// {host} in Request is replaced with the Host the service is addressed by.
+type Case struct {
+	Name    string `yaml:"name"`
+	Request string `yaml:"request"`
+	Expect  Expect `yaml:"expect"`
+}
+
+// Expect are the assertions on a response. Header values and body patterns
+// are regular expressions; a header value must match in full, a body pattern
+// anywhere in the body. Assertions left out are not checked.
+type Expect struct {
+	Status int `yaml:"status,omitempty"`
+
+	// Dropped expects the connection to be closed without a response
+	Dropped bool `yaml:"dropped,omitempty"`
+
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Absent  []string          `yaml:"absent,omitempty"`
+	Body    []string          `yaml:"body,omitempty"`
+	NotBody []string          `yaml:"notBody,omitempty"`
+}
+
+// Failure is an assertion a response did not satisfy
+type Failure struct {
+	Case      string
+	Assertion string
+	Want      string
+	Got       string
+}
+
+// Result is the outcome of running a corpus against a target
+type Result struct {
+	Profile  string
+	Cases    int
+	Failures []Failure
+}
+
+// Failed returns the number of cases with at least one failure
+func (r *Result) Failed() int {
+	failed := make(map[string]bool)
+	for _, f := range r.Failures {
+		failed[f.Case] = true
+	}
+	return len(failed)
+}
+
+// Load reads and checks the corpus in a YAML file. Unknown fields are
+// rejected, so a misspelled assertion is not silently skipped.
+func Load(path string) (*Corpus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corpus: %w", err)
+	}
+	var c Corpus
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse corpus %s: %w", path, err)
+	}
+	c.Path = path
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("corpus %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// LoadDir reads every corpus in a directory, sorted by profile
+func LoadDir(dir string) ([]*Corpus, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list corpora: %w", err)
+	}
+	corpora := make([]*Corpus, 0, len(paths))
+	profiles := make(map[string]string)
+	for _, path := range paths {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := profiles[c.Profile]; ok {
+			return nil, fmt.Errorf("corpora %s and %s both cover profile %s", other, path, c.Profile)
+		}
+		profiles[c.Profile] = path
+		corpora = append(corpora, c)
+	}
+	sort.Slice(corpora, func(i, j int) bool { return corpora[i].Profile < corpora[j].Profile })
+	return corpora, nil
+}
+
+// Validate checks that the corpus names a profile, its cases have unique
+// names and a request, and their patterns compile
+func (c *Corpus) Validate() error {
+	if c.Profile == "" {
+		return fmt.Errorf("profile is required")
+	}
+	if len(c.Cases) == 0 {
+		return fmt.Errorf("at least one case is required")
+	}
+	names := make(map[string]bool, len(c.Cases))
+	for i, tc := range c.Cases {
+		if tc.Name == "" {
+			return fmt.Errorf("cases[%d]: name is required", i)
+		}
+		if names[tc.Name] {
+			return fmt.Errorf("case %s: duplicate name", tc.Name)
+		}
+		names[tc.Name] = true
+		if tc.Request == "" {
+			return fmt.Errorf("case %s: request is required", tc.Name)
+		}
+		e := tc.Expect
+		if e.Dropped && (e.Status != 0 || len(e.Headers) > 0 || len(e.Absent) > 0 || len(e.Body) > 0 || len(e.NotBody) > 0) {
+			return fmt.Errorf("case %s: a dropped connection has no response to assert on", tc.Name)
+		}
+		for name, pattern := range e.Headers {
+			if _, err := compileHeader(pattern); err != nil {
+				return fmt.Errorf("case %s: header %s: %w", tc.Name, name, err)
+			}
+		}
+		for _, pattern := range append(append([]string{}, e.Body...), e.NotBody...) {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("case %s: body: %w", tc.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Run sends every case of a corpus to a target and checks the responses
+func Run(ctx context.Context, target fidelity.Target, c *Corpus) (*Result, error) {
+	result := &Result{Profile: c.Profile, Cases: len(c.Cases)}
+	for _, tc := range c.Cases {
+		banner, body, err := fidelity.ReplayBody(ctx, target, fidelity.Probe{Name: tc.Name, Request: tc.Request})
+		if err != nil {
+			return nil, err
+		}
+		result.Failures = append(result.Failures, Check(tc, banner, body)...)
+	}
+	return result, nil
+}
+
+// Check returns the assertions of a case a response does not satisfy. A
+// banner with status 0 is a connection closed without a response.
+func Check(tc Case, banner *fidelity.Banner, body []byte) []Failure {
+	failures := make([]Failure, 0)
+	fail := func(assertion, want, got string) {
+		failures = append(failures, Failure{Case: tc.Name, Assertion: assertion, Want: want, Got: got})
+	}
+	e := tc.Expect
+
+	if e.Dropped {
+		if banner.Status != 0 {
+			fail("dropped", "no response", fmt.Sprint(banner.Status))
+		}
+		return failures
+	}
+	if banner.Status == 0 {
+		fail("response", "a response", "connection closed")
+		return failures
+	}
+
+	if e.Status != 0 && banner.Status != e.Status {
+		fail("status", fmt.Sprint(e.Status), fmt.Sprint(banner.Status))
+	}
+
+	names := make([]string, 0, len(e.Headers))
+	for name := range e.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		got := strings.Join(banner.Headers.Values(name), ", ")
+		re, _ := compileHeader(e.Headers[name])
+		if _, ok := banner.Headers[http.CanonicalHeaderKey(name)]; !ok || !re.MatchString(got) {
+			fail("header "+http.CanonicalHeaderKey(name), e.Headers[name], got)
+		}
+	}
+	for _, name := range e.Absent {
+		if got := banner.Headers.Values(name); len(got) > 0 {
+			fail("header "+http.CanonicalHeaderKey(name), "absent", strings.Join(got, ", "))
+		}
+	}
+
+	for _, pattern := range e.Body {
+		if !regexp.MustCompile(pattern).Match(body) {
+			fail("body", pattern, "no match")
+		}
+	}
+	for _, pattern := range e.NotBody {
+		if m := regexp.MustCompile(pattern).Find(body); m != nil {
+			fail("body", "no match of "+pattern, string(m))
+		}
+	}
+	return failures
+}
+
+// compileHeader compiles a header pattern to match whole values
+func compileHeader(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
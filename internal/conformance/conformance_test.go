@@ -0,0 +1,65 @@
+package conformance
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/fidelity"
+)
+
+func TestLoadDir_Bundled(t *testing.T) {
+	corpora, err := LoadDir("../../conformance")
+	if err != nil {
+		t.Fatalf("Failed to load bundled corpora: %v", err)
+	}
+	profiles := make(map[string]bool)
+	for _, c := range corpora {
+		profiles[c.Profile] = true
+	}
+	for _, want := range []string{"apache2", "nginx", "iis", "wordpress"} {
+		if !profiles[want] {
+			t.Fatalf("Expected a bundled corpus for %s", want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.25.3")
+		w.Header().Set("X-Powered-By", "PHP/8.2.0")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<title>404 Not Found</title>"))
+	}))
+	defer srv.Close()
+
+	corpus := &Corpus{Profile: "nginx", Cases: []Case{
+		{Name: "pass", Request: "GET / HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n", Expect: Expect{
+			Status:  404,
+			Headers: map[string]string{"Server": `nginx/1\.\d+\.\d+`},
+			Body:    []string{"404 Not Found"},
+		}},
+		{Name: "fail", Request: "GET / HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n", Expect: Expect{
+			Status:  200,
+			Headers: map[string]string{"Server": "nginx", "Etag": ".*"},
+			Absent:  []string{"X-Powered-By"},
+			NotBody: []string{"Not Found"},
+		}},
+	}}
+	if err := corpus.Validate(); err != nil {
+		t.Fatalf("Failed to validate corpus: %v", err)
+	}
+
+	result, err := Run(context.Background(), fidelity.Target{Addr: srv.Listener.Addr().String(), Host: "localhost"}, corpus)
+	if err != nil {
+		t.Fatalf("Failed to run corpus: %v", err)
+	}
+	if result.Failed() != 1 {
+		t.Fatalf("Expected 1 failed case, got %d: %+v", result.Failed(), result.Failures)
+	}
+	// Status, both headers, the absent header, and the body
+	if len(result.Failures) != 5 {
+		t.Fatalf("Expected 5 failed assertions, got %+v", result.Failures)
+	}
+}
@@ -0,0 +1,175 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+// activity is the data of the activity page
+type activity struct {
+	layout
+
+	// Campaign is the attack tag the page is limited to, if any, and
+	// Campaigns every tag seen in the window
+	Campaign  string
+	Campaigns []database.TagCount
+
+	Requests   int
+	Countries  []database.CountryCount
+	MaxCountry int
+	Map        *chart
+	Hours      *chart
+	Weekdays   *chart
+	Punchcard  *chart
+}
+
+// handleActivity renders where and when requests came from in a window: a
+// world heat map of sources and their hour of day and day of week, for all
+// requests or one campaign's
+func (h *Handler) handleActivity(w http.ResponseWriter, r *http.Request) {
+	window, d := parseWindow(r)
+	since := time.Now().Add(-d)
+	campaign := r.URL.Query().Get("campaign")
+
+	data := activity{
+		layout:   layout{Title: "Activity", Window: window, Windows: windows, query: r.URL.Query()},
+		Campaign: campaign,
+	}
+	var err error
+	if data.Campaigns, err = h.logger.GetTagActivity(since); err != nil {
+		h.fail(w, err)
+		return
+	}
+	if data.Countries, err = h.logger.GetCountryActivity(since, campaign); err != nil {
+		h.fail(w, err)
+		return
+	}
+	for _, c := range data.Countries {
+		data.MaxCountry = max(data.MaxCountry, c.Requests)
+	}
+	times, err := h.logger.GetTimeActivity(since, campaign)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	data.Requests = times.Requests
+	data.Map = countriesChart(data.Countries)
+	data.Hours = hoursChart(times)
+	data.Weekdays = weekdaysChart(times)
+	data.Punchcard = punchcardChart(times)
+
+	h.render(w, activityPage, data)
+}
+
+// handleActivityExport serves a chart of the activity page as a PNG image or
+// its data as CSV, named for download like activity-hours-24h.png
+func (h *Handler) handleActivityExport(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+	ext := path.Ext(file)
+	name := strings.TrimSuffix(file, ext)
+	if ext != ".png" && ext != ".csv" {
+		http.NotFound(w, r)
+		return
+	}
+
+	window, d := parseWindow(r)
+	since := time.Now().Add(-d)
+	campaign := r.URL.Query().Get("campaign")
+
+	var c *chart
+	var rows [][]string
+	switch name {
+	case "countries":
+		counts, err := h.logger.GetCountryActivity(since, campaign)
+		if err != nil {
+			h.fail(w, err)
+			return
+		}
+		c = countriesChart(counts)
+		rows = [][]string{{"country", "requests"}}
+		for _, cc := range counts {
+			rows = append(rows, []string{cc.Country, strconv.Itoa(cc.Requests)})
+		}
+	case "hours", "weekdays", "punchcard":
+		times, err := h.logger.GetTimeActivity(since, campaign)
+		if err != nil {
+			h.fail(w, err)
+			return
+		}
+		switch name {
+		case "hours":
+			c = hoursChart(times)
+			rows = [][]string{{"hour", "requests"}}
+			for hour, n := range times.Hours {
+				rows = append(rows, []string{strconv.Itoa(hour), strconv.Itoa(n)})
+			}
+		case "weekdays":
+			c = weekdaysChart(times)
+			rows = [][]string{{"weekday", "requests"}}
+			for _, wd := range weekdays {
+				rows = append(rows, []string{time.Weekday(wd.day).String(), strconv.Itoa(times.Weekdays[wd.day])})
+			}
+		case "punchcard":
+			c = punchcardChart(times)
+			rows = [][]string{{"weekday", "hour", "requests"}}
+			for _, wd := range weekdays {
+				for hour, n := range times.Matrix[wd.day] {
+					rows = append(rows, []string{time.Weekday(wd.day).String(), strconv.Itoa(hour), strconv.Itoa(n)})
+				}
+			}
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	download := "activity-" + name
+	if campaign != "" {
+		download += "-" + strings.Map(safeFilename, campaign)
+	}
+	download += "-" + window + ext
+
+	var buf bytes.Buffer
+	if ext == ".png" {
+		if err := c.writePNG(&buf); err != nil {
+			dashboardLog.Error("failed to render dashboard chart", "err", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+	} else {
+		cw := csv.NewWriter(&buf)
+		cw.WriteAll(rows)
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", download))
+	buf.WriteTo(w)
+}
+
+// Export returns the link to download a chart of the page, for the same
+// window and campaign
+func (a activity) Export(name, ext string) string {
+	q := url.Values{"window": {a.Window}}
+	if a.Campaign != "" {
+		q.Set("campaign", a.Campaign)
+	}
+	return (&url.URL{Path: "/dashboard/activity/" + name + "." + ext, RawQuery: q.Encode()}).String()
+}
+
+// safeFilename replaces the characters of a campaign that do not belong in a
+// file name
+func safeFilename(r rune) rune {
+	if r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+		return r
+	}
+	return '_'
+}
@@ -0,0 +1,266 @@
+package dashboard
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+// chart is a drawing in chart units, rendered inline as SVG on the page and
+// rasterized for PNG export, so that both show the same thing
+type chart struct {
+	Width, Height float64
+	Shapes        []shape
+}
+
+// shape is a rect, a circle, or a label of a chart. Rects are placed by their
+// top left corner, circles by their center, and labels by the middle of
+// their baseline.
+type shape struct {
+	Kind string
+	X, Y float64
+	W, H float64
+	R    float64
+	Fill string
+
+	// Text is a label's text, and Title the tooltip of a rect or circle
+	Text  string
+	Title string
+}
+
+const (
+	// labelSize is the cap height of labels
+	labelSize = 5
+
+	// pngScale is the pixels per chart unit of exported PNGs
+	pngScale = 4
+
+	background = "#ffffff"
+	gridColor  = "#d0d7de"
+	labelColor = "#57606a"
+	emptyColor = "#f6f8fa"
+	oceanColor = "#eaf2fb"
+)
+
+// weekdays are the days of the week in chart order, starting on Monday
+var weekdays = []struct {
+	day   int
+	label string
+}{{1, "MON"}, {2, "TUE"}, {3, "WED"}, {4, "THU"}, {5, "FRI"}, {6, "SAT"}, {0, "SUN"}}
+
+func (c *chart) rect(x, y, w, h float64, fill, title string) {
+	c.Shapes = append(c.Shapes, shape{Kind: "rect", X: x, Y: y, W: w, H: h, Fill: fill, Title: title})
+}
+
+func (c *chart) circle(x, y, r float64, fill, title string) {
+	c.Shapes = append(c.Shapes, shape{Kind: "circle", X: x, Y: y, R: r, Fill: fill, Title: title})
+}
+
+func (c *chart) label(x, y float64, text string) {
+	c.Shapes = append(c.Shapes, shape{Kind: "text", X: x, Y: y, Fill: labelColor, Text: text})
+}
+
+// heat returns the color of a share of the maximum, from pale yellow through
+// orange to red. Nothing at all is gray.
+func heat(n, max int) string {
+	if n <= 0 || max <= 0 {
+		return emptyColor
+	}
+	// Square roots spread out the many small counts
+	t := math.Sqrt(float64(n) / float64(max))
+	stops := [][3]float64{{255, 240, 179}, {251, 143, 68}, {207, 34, 46}}
+	i, f := 0, t*2
+	if f >= 1 {
+		i, f = 1, f-1
+	}
+	var rgb [3]int
+	for j := range rgb {
+		rgb[j] = int(math.Round(stops[i][j] + (stops[i+1][j]-stops[i][j])*f))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+}
+
+// countriesChart places the requests of each country on an equirectangular
+// world map, as circles sized and colored by their share of the busiest.
+// Countries without a known location are left off.
+func countriesChart(counts []database.CountryCount) *chart {
+	c := &chart{Width: 360, Height: 180}
+	c.rect(0, 0, 360, 180, oceanColor, "")
+	for lon := 30.0; lon < 360; lon += 30 {
+		c.rect(lon, 0, 0.25, 180, gridColor, "")
+	}
+	for lat := 30.0; lat < 180; lat += 30 {
+		c.rect(0, lat, 360, 0.25, gridColor, "")
+	}
+
+	most := 0
+	for _, cc := range counts {
+		if _, ok := centroids[cc.Country]; ok {
+			most = max(most, cc.Requests)
+		}
+	}
+	// The busiest are drawn last, on top
+	for i := len(counts) - 1; i >= 0; i-- {
+		cc := counts[i]
+		pos, ok := centroids[cc.Country]
+		if !ok {
+			continue
+		}
+		r := 1.5 + 8*math.Sqrt(float64(cc.Requests)/float64(most))
+		c.circle(pos[1]+180, 90-pos[0], r, heat(cc.Requests, most), fmt.Sprintf("%s: %d", cc.Country, cc.Requests))
+	}
+	return c
+}
+
+// histogram draws bars of a width, labeling every so many
+func histogram(values []int, labels []string, barWidth float64, every int) *chart {
+	const gap, height, top = 2, 60, 4
+	c := &chart{Width: float64(len(values))*(barWidth+gap) + gap, Height: top + height + 12}
+	most := 0
+	for _, v := range values {
+		most = max(most, v)
+	}
+
+	c.rect(0, top+height, c.Width, 0.5, gridColor, "")
+	for i, v := range values {
+		x := gap + float64(i)*(barWidth+gap)
+		h := 0.0
+		if most > 0 {
+			h = height * float64(v) / float64(most)
+		}
+		c.rect(x, top+height-h, barWidth, h, "#54aeff", fmt.Sprintf("%s: %d", labels[i], v))
+		if i%every == 0 {
+			c.label(x+barWidth/2, top+height+3+labelSize, labels[i])
+		}
+	}
+	return c
+}
+
+// hoursChart draws the requests of each hour of the day
+func hoursChart(a *database.TimeActivity) *chart {
+	labels := make([]string, 24)
+	for h := range labels {
+		labels[h] = strconv.Itoa(h)
+	}
+	return histogram(a.Hours[:], labels, 10, 3)
+}
+
+// weekdaysChart draws the requests of each day of the week
+func weekdaysChart(a *database.TimeActivity) *chart {
+	values := make([]int, len(weekdays))
+	labels := make([]string, len(weekdays))
+	for i, wd := range weekdays {
+		values[i], labels[i] = a.Weekdays[wd.day], wd.label
+	}
+	return histogram(values, labels, 32, 1)
+}
+
+// punchcardChart draws the requests of each hour of each day of the week as
+// a grid of cells colored by their share of the busiest
+func punchcardChart(a *database.TimeActivity) *chart {
+	const cell, left, top = 10, 20, 2
+	c := &chart{Width: left + 24*cell + 2, Height: top + 7*cell + 12}
+	most := 0
+	for _, day := range a.Matrix {
+		for _, n := range day {
+			most = max(most, n)
+		}
+	}
+
+	for row, wd := range weekdays {
+		y := float64(top + row*cell)
+		c.label(left/2, y+cell/2+labelSize/2, wd.label)
+		for h, n := range a.Matrix[wd.day] {
+			c.rect(float64(left+h*cell)+0.5, y+0.5, cell-1, cell-1, heat(n, most),
+				fmt.Sprintf("%s %02d:00: %d", wd.label, h, n))
+		}
+	}
+	for h := 0; h < 24; h += 3 {
+		c.label(float64(left+h*cell)+cell/2, top+7*cell+3+labelSize, strconv.Itoa(h))
+	}
+	return c
+}
+
+// glyphs are the labels' characters, five rows of three pixels each, with the
+// left pixel the high bit
+var glyphs = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7}, '3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 7, 1, 7}, '6': {7, 4, 7, 5, 7}, '7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 7},
+	'A': {2, 5, 7, 5, 5}, 'B': {6, 5, 6, 5, 6}, 'C': {3, 4, 4, 4, 3}, 'D': {6, 5, 5, 5, 6},
+	'E': {7, 4, 6, 4, 7}, 'F': {7, 4, 6, 4, 4}, 'G': {3, 4, 5, 5, 3}, 'H': {5, 5, 7, 5, 5},
+	'I': {7, 2, 2, 2, 7}, 'J': {1, 1, 1, 5, 2}, 'K': {5, 5, 6, 5, 5}, 'L': {4, 4, 4, 4, 7},
+	'M': {5, 7, 7, 5, 5}, 'N': {6, 5, 5, 5, 5}, 'O': {2, 5, 5, 5, 2}, 'P': {6, 5, 6, 4, 4},
+	'Q': {2, 5, 5, 6, 3}, 'R': {6, 5, 6, 5, 5}, 'S': {3, 4, 2, 1, 6}, 'T': {7, 2, 2, 2, 2},
+	'U': {5, 5, 5, 5, 7}, 'V': {5, 5, 5, 5, 2}, 'W': {5, 5, 7, 7, 5}, 'X': {5, 5, 2, 5, 5},
+	'Y': {5, 5, 2, 2, 2}, 'Z': {7, 1, 2, 4, 7},
+	'-': {0, 0, 7, 0, 0}, ':': {0, 2, 0, 2, 0}, '.': {0, 0, 0, 0, 2}, ' ': {},
+}
+
+// writePNG rasterizes the chart at pngScale pixels per unit
+func (c *chart) writePNG(w io.Writer) error {
+	img := image.NewRGBA(image.Rect(0, 0, int(c.Width*pngScale), int(c.Height*pngScale)))
+	fill(img, 0, 0, c.Width, c.Height, parseColor(background))
+
+	for _, s := range c.Shapes {
+		col := parseColor(s.Fill)
+		switch s.Kind {
+		case "rect":
+			fill(img, s.X, s.Y, s.W, s.H, col)
+		case "circle":
+			r := s.R * pngScale
+			cx, cy := s.X*pngScale, s.Y*pngScale
+			for y := int(cy - r); y <= int(cy+r); y++ {
+				for x := int(cx - r); x <= int(cx+r); x++ {
+					if dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy; dx*dx+dy*dy <= r*r {
+						img.Set(x, y, col)
+					}
+				}
+			}
+		case "text":
+			// Pixels of the glyphs are a fifth of the cap height, and glyphs
+			// are a pixel apart
+			px := float64(labelSize) / 5
+			text := strings.ToUpper(s.Text)
+			x := s.X - (float64(len(text))*4-1)*px/2
+			for _, r := range text {
+				for row, bits := range glyphs[r] {
+					for bit := 0; bit < 3; bit++ {
+						if bits&(4>>bit) != 0 {
+							fill(img, x+float64(bit)*px, s.Y-labelSize+float64(row)*px, px, px, col)
+						}
+					}
+				}
+				x += 4 * px
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// fill paints a rectangle given in chart units, at least a pixel wide
+func fill(img *image.RGBA, x, y, w, h float64, col color.Color) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	x0, y0 := int(math.Round(x*pngScale)), int(math.Round(y*pngScale))
+	x1, y1 := max(x0+1, int(math.Round((x+w)*pngScale))), max(y0+1, int(math.Round((y+h)*pngScale)))
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			img.Set(px, py, col)
+		}
+	}
+}
+
+// parseColor parses a #rrggbb color
+func parseColor(s string) color.Color {
+	v, _ := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
@@ -0,0 +1,274 @@
+// Package dashboard serves a browser dashboard of captured traffic on the
+// admin port: an overview of recent requests, per-service hit counts, top
+// source IPs, and the JA4 distribution, a filterable request list, the raw
+// dump of each request, and where and when requests came from. Pages are rendered server-side from templates
+// embedded in the binary, so it needs no assets or scripts.
+package dashboard
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/logging"
+)
+
+// dashboardLog logs the pages that fail
+var dashboardLog = logging.Logger("dashboard")
+
+const (
+	// defaultWindow is how far back the overview looks without a window
+	defaultWindow = 24 * time.Hour
+
+	// topLimit bounds the sources and fingerprints shown on the overview
+	topLimit = 10
+
+	// recentLimit bounds the requests shown on the overview
+	recentLimit = 25
+
+	// pageSize is the number of requests on each page of the request list
+	pageSize = 50
+)
+
+// windows are the windows offered on the overview
+var windows = []string{"1h", "24h", "168h", "720h"}
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var funcs = template.FuncMap{
+	"timestamp": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format("2006-01-02 15:04:05")
+	},
+	"truncate": func(s string, n int) string {
+		if len(s) <= n {
+			return s
+		}
+		return s[:n] + "…"
+	},
+	"percent": func(n, max int) int {
+		if max <= 0 {
+			return 0
+		}
+		return n * 100 / max
+	},
+	"statusClass": func(status int) int {
+		return status / 100
+	},
+}
+
+// page parses a page template with the shared layout
+func page(name string) *template.Template {
+	return template.Must(template.New(name).Funcs(funcs).ParseFS(templateFS, "templates/layout.html", "templates/"+name))
+}
+
+var (
+	overviewPage = page("overview.html")
+	requestsPage = page("requests.html")
+	requestPage  = page("request.html")
+	activityPage = page("activity.html")
+)
+
+// Handler serves the dashboard under /dashboard/
+type Handler struct {
+	logger *database.RequestLogger
+	mux    *http.ServeMux
+}
+
+// New creates a dashboard of the requests logged by logger
+func New(logger *database.RequestLogger) *Handler {
+	h := &Handler{logger: logger, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /dashboard/{$}", h.handleOverview)
+	h.mux.HandleFunc("GET /dashboard/requests", h.handleRequests)
+	h.mux.HandleFunc("GET /dashboard/requests/{id}", h.handleRequest)
+	h.mux.HandleFunc("GET /dashboard/activity", h.handleActivity)
+	h.mux.HandleFunc("GET /dashboard/activity/{file}", h.handleActivityExport)
+	return h
+}
+
+// ServeHTTP serves a dashboard page. Pages may not be framed and may load
+// nothing but their inline styles.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hdr := w.Header()
+	hdr.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'")
+	hdr.Set("X-Frame-Options", "DENY")
+	hdr.Set("X-Content-Type-Options", "nosniff")
+	hdr.Set("Referrer-Policy", "no-referrer")
+	hdr.Set("Cache-Control", "no-store")
+	h.mux.ServeHTTP(w, r)
+}
+
+// layout is what every page passes its layout
+type layout struct {
+	Title string
+
+	// Window is the window the page covers, offered among Windows if set
+	Window  string
+	Windows []string
+
+	// query is the page's query, kept by the links to other windows
+	query url.Values
+}
+
+// WindowURL returns the link to the page over another window
+func (l layout) WindowURL(window string) string {
+	q := url.Values{}
+	for k, v := range l.query {
+		q[k] = v
+	}
+	q.Set("window", window)
+	return "?" + q.Encode()
+}
+
+// parseWindow returns the window a request asks for, or the default
+func parseWindow(r *http.Request) (string, time.Duration) {
+	window := r.URL.Query().Get("window")
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return "24h", defaultWindow
+	}
+	return window, d
+}
+
+// overview is the data of the overview page
+type overview struct {
+	layout
+	Requests       int
+	Services       []database.ServiceActivity
+	MaxService     int
+	Sources        []database.SourceActivity
+	Fingerprints   []database.FingerprintCount
+	MaxFingerprint int
+	Recent         []database.RequestLog
+}
+
+// handleOverview renders the requests in a window: per-service hit counts,
+// the top sources and JA4 fingerprints, and the latest requests
+func (h *Handler) handleOverview(w http.ResponseWriter, r *http.Request) {
+	window, d := parseWindow(r)
+	since := time.Now().Add(-d)
+
+	data := overview{
+		layout: layout{Title: "Overview", Window: window, Windows: windows, query: r.URL.Query()},
+	}
+	var err error
+	if data.Services, err = h.logger.GetServiceActivity(since); err != nil {
+		h.fail(w, err)
+		return
+	}
+	for _, s := range data.Services {
+		data.Requests += s.Requests
+		data.MaxService = max(data.MaxService, s.Requests)
+	}
+	if data.Sources, err = h.logger.GetTopSources(since, topLimit); err != nil {
+		h.fail(w, err)
+		return
+	}
+	if data.Fingerprints, err = h.logger.GetTopFingerprints("ja4", since, topLimit); err != nil {
+		h.fail(w, err)
+		return
+	}
+	for _, f := range data.Fingerprints {
+		data.MaxFingerprint = max(data.MaxFingerprint, f.Requests)
+	}
+	if data.Recent, err = h.logger.Query(database.LogFilter{Since: since, Limit: recentLimit}); err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	h.render(w, overviewPage, data)
+}
+
+// requestList is the data of the request list page
+type requestList struct {
+	layout
+	Filter database.LogFilter
+	Logs   []database.RequestLog
+	Next   string
+}
+
+// handleRequests renders a page of the requests matching the filter in the
+// query, newest first, linking to the next page
+func (h *Handler) handleRequests(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := database.LogFilter{
+		SourceIP:   q.Get("source_ip"),
+		Service:    q.Get("service"),
+		PathPrefix: q.Get("path_prefix"),
+		JA4:        q.Get("ja4"),
+		JA4H:       q.Get("ja4h"),
+		Tag:        q.Get("tag"),
+		Limit:      pageSize,
+	}
+	filter.Cursor, _ = strconv.ParseInt(q.Get("cursor"), 10, 64)
+
+	logs, err := h.logger.Query(filter)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	data := requestList{layout: layout{Title: "Requests"}, Filter: filter, Logs: logs}
+	if len(logs) == pageSize {
+		q.Set("cursor", strconv.FormatInt(logs[len(logs)-1].ID, 10))
+		data.Next = (&url.URL{Path: "/dashboard/requests", RawQuery: q.Encode()}).String()
+	}
+	h.render(w, requestsPage, data)
+}
+
+// requestDetail is the data of a request's page
+type requestDetail struct {
+	layout
+	Log database.RequestLog
+}
+
+// handleRequest renders a request's details and raw dump
+func (h *Handler) handleRequest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	logs, err := h.logger.Query(database.LogFilter{ID: id})
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	if len(logs) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.render(w, requestPage, requestDetail{
+		layout: layout{Title: fmt.Sprintf("Request %d", id)},
+		Log:    logs[0],
+	})
+}
+
+// render writes a page, or a 500 if it fails to render
+func (h *Handler) render(w http.ResponseWriter, t *template.Template, data any) {
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, "layout", data); err != nil {
+		dashboardLog.Error("failed to render dashboard page", "err", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// fail logs a query error and answers with a 500
+func (h *Handler) fail(w http.ResponseWriter, err error) {
+	dashboardLog.Error("failed to query dashboard data", "err", err)
+	http.Error(w, "internal server error", http.StatusInternalServerError)
+}
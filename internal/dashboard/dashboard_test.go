@@ -0,0 +1,144 @@
+package dashboard
+
+import (
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+func TestDashboard(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	logger := database.NewRequestLogger(db)
+	ja4 := "t13d1516h2_8daaf6152771_e5627efa2ab1"
+	r := httptest.NewRequest("GET", "/search?q=<script>alert(1)</script>", nil)
+	r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &ja4))
+	r.RemoteAddr = "203.0.113.7:40000"
+	raw, _ := httputil.DumpRequest(r, true)
+	if err := logger.LogRequest(r, 443, "nginx", "nginx", 404, "", raw); err != nil {
+		t.Fatalf("Failed to log request: %v", err)
+	}
+
+	h := New(logger)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/dashboard/")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the overview, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"1 requests in the last 24h", "203.0.113.7", ja4, "/dashboard/requests/1"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("Expected the overview to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "<script>") {
+		t.Fatalf("Expected the request path to be escaped")
+	}
+	if w.Header().Get("X-Frame-Options") != "DENY" || w.Header().Get("Content-Security-Policy") == "" {
+		t.Fatalf("Expected framing and content restrictions, got %v", w.Header())
+	}
+
+	w = get("/dashboard/requests?source_ip=198.51.100.9")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "No requests") {
+		t.Fatalf("Expected no requests from another source, got %d", w.Code)
+	}
+
+	w = get("/dashboard/requests/1")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "GET /search?q=&lt;script&gt;") {
+		t.Fatalf("Expected the escaped raw request, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{"/dashboard/requests/2", "/dashboard/requests/x"} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Fatalf("Expected %s to be missing, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestActivity(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	logger := database.NewRequestLogger(db)
+	for _, host := range []string{"example.com", "192.0.2.1"} {
+		ja4 := ""
+		r := httptest.NewRequest("GET", "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &ja4))
+		r.Host = host
+		r.RemoteAddr = "203.0.113.7:40000"
+		if err := logger.LogRequest(r, 80, "nginx", "nginx", 200, "", nil); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+
+	h := New(logger)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/dashboard/activity")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "2 requests in the last 24h") {
+		t.Fatalf("Expected the activity of every request, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "<svg") || !strings.Contains(w.Body.String(), "campaign=host-ip") {
+		t.Fatalf("Expected charts and a link to the host-ip campaign")
+	}
+
+	w = get("/dashboard/activity?window=1h&campaign=host-ip")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "1 requests tagged host-ip in the last 1h") {
+		t.Fatalf("Expected the activity of the campaign, got %d", w.Code)
+	}
+
+	w = get("/dashboard/activity/punchcard.csv?campaign=host-ip")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if w.Code != http.StatusOK || len(lines) != 1+7*24 || lines[0] != "weekday,hour,requests" {
+		t.Fatalf("Expected a row for every hour of the week, got %d: %d lines", w.Code, len(lines))
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="activity-punchcard-host-ip-24h.csv"` {
+		t.Fatalf("Expected the export to be named for download, got %q", got)
+	}
+
+	w = get("/dashboard/activity/countries.png")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("Expected a PNG, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if _, err := png.Decode(w.Body); err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+
+	for _, path := range []string{"/dashboard/activity/countries.gif", "/dashboard/activity/other.csv"} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Fatalf("Expected %s to be missing, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"strings"
+)
+
+// Capture is what of a request's raw dump is stored. The zero value stores
+// all of it.
+type Capture struct {
+	// NoBody stores the request line and headers only, and NoRaw stores no
+	// raw dump at all
+	NoBody bool
+	NoRaw  bool
+}
+
+type captureKey struct{}
+
+// WithCapture returns a context storing c of its request
+func WithCapture(ctx context.Context, c Capture) context.Context {
+	return context.WithValue(ctx, captureKey{}, c)
+}
+
+// captureFromContext returns what is stored of the request, everything if
+// the context does not say
+func captureFromContext(ctx context.Context) Capture {
+	c, _ := ctx.Value(captureKey{}).(Capture)
+	return c
+}
+
+// stored returns what is kept of a raw dump
+func (c Capture) stored(rawDump []byte) string {
+	switch {
+	case c.NoRaw:
+		return ""
+	case c.NoBody:
+		if head, _, ok := strings.Cut(string(rawDump), "\r\n\r\n"); ok {
+			return head + "\r\n\r\n"
+		}
+	}
+	return string(rawDump)
+}
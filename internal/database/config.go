@@ -0,0 +1,196 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrNotFound is returned when a requested record does not exist
+var ErrNotFound = errors.New("not found")
+
+// ConfigGeneration is a distinct configuration the honeypot has run with
+type ConfigGeneration struct {
+	ID          int64     `json:"id"`
+	Hash        string    `json:"hash"`
+	FirstLoaded time.Time `json:"first_loaded"`
+	LastLoaded  time.Time `json:"last_loaded"`
+	Loads       int       `json:"loads"`
+	Requests    int       `json:"requests"`
+}
+
+// SaveConfig records a redacted snapshot of cfg and its services and
+// endpoints in the configs, services, and endpoints tables, logs the load in
+// config_loads, and returns the ID of the configuration. Configurations are
+// identified by a hash of the snapshot and the templates it serves, so
+// reloading an unchanged configuration only updates its last_loaded time.
+func (db *DB) SaveConfig(cfg *config.Config) (int64, error) {
+	raw, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	services := cfg.GetEnabledServices()
+
+	// Templates are part of what was served, so they are part of the hash
+	h := sha256.New()
+	h.Write(raw)
+	templateHashes := make([][]string, len(services))
+	for i, svc := range services {
+		templateHashes[i] = make([]string, len(svc.Endpoints))
+		for j, ep := range svc.Endpoints {
+			templateHashes[i][j] = hashFile(ep.Template)
+			fmt.Fprintf(h, "%s\x00%s\x00", ep.Template, templateHashes[i][j])
+		}
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var id int64
+	err = tx.QueryRow(`SELECT id FROM configs WHERE hash = ?`, hash).Scan(&id)
+	if err == nil {
+		if _, err := tx.Exec(`UPDATE configs SET last_loaded = ? WHERE id = ?`, now, id); err != nil {
+			return 0, fmt.Errorf("failed to update config: %w", err)
+		}
+		return id, commitConfigLoad(tx, id, now)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to look up config: %w", err)
+	}
+
+	id, err = tx.Insert(
+		`INSERT INTO configs (hash, snapshot, first_loaded, last_loaded) VALUES (?, ?, ?, ?)`,
+		hash, string(raw), now, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert config: %w", err)
+	}
+
+	for i, svc := range services {
+		address := svc.Address
+		if address == "" {
+			address = strings.Join(svc.BindAddress, ",")
+		}
+		ports, err := json.Marshal(svc.Ports)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal ports: %w", err)
+		}
+		serviceID, err := tx.Insert(`
+			INSERT INTO services (config_id, name, type, address, ports, headers, personality)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			id, svc.Name, svc.Type, address, string(ports), marshalHeaders(svc.Headers), svc.Personality,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert service %s: %w", svc.Name, err)
+		}
+
+		for j, ep := range svc.Endpoints {
+			_, err := tx.Exec(`
+				INSERT INTO endpoints (
+					service_id, position, path, method, status,
+					template, template_hash, headers, condition
+				) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				serviceID, j, ep.Path, ep.Method, ep.Status,
+				ep.Template, templateHashes[i][j], marshalHeaders(ep.Headers), ep.When,
+			)
+			if err != nil {
+				return 0, fmt.Errorf("failed to insert endpoint %s %s: %w", ep.Method, ep.Path, err)
+			}
+		}
+	}
+
+	return id, commitConfigLoad(tx, id, now)
+}
+
+// commitConfigLoad records a load of a configuration and commits tx
+func commitConfigLoad(tx *tx, id int64, now time.Time) error {
+	if _, err := tx.Exec(`INSERT INTO config_loads (config_id, loaded_at) VALUES (?, ?)`, id, now); err != nil {
+		return fmt.Errorf("failed to insert config load: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit config: %w", err)
+	}
+	return nil
+}
+
+// GetConfigHistory returns every configuration the honeypot has run with,
+// most recently loaded first, with how many times it was loaded and how many
+// requests it answered
+func (rl *RequestLogger) GetConfigHistory() ([]ConfigGeneration, error) {
+	rows, err := rl.db.conn.Query(`
+		SELECT c.id, c.hash, c.first_loaded, c.last_loaded,
+			(SELECT COUNT(*) FROM config_loads l WHERE l.config_id = c.id),
+			(SELECT COUNT(*) FROM request_logs r WHERE r.config_id = c.id)
+		FROM configs c
+		ORDER BY c.last_loaded DESC, c.id DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query config history: %w", err)
+	}
+	defer rows.Close()
+
+	history := make([]ConfigGeneration, 0)
+	for rows.Next() {
+		var g ConfigGeneration
+		if err := rows.Scan(&g.ID, &g.Hash, &g.FirstLoaded, &g.LastLoaded, &g.Loads, &g.Requests); err != nil {
+			return nil, fmt.Errorf("failed to scan config: %w", err)
+		}
+		history = append(history, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config history: %w", err)
+	}
+	return history, nil
+}
+
+// GetConfigSnapshot returns the redacted YAML snapshot of a configuration,
+// or ErrNotFound if there is none with the ID
+func (rl *RequestLogger) GetConfigSnapshot(id int64) (string, error) {
+	var snapshot string
+	err := rl.db.conn.QueryRow(`SELECT snapshot FROM configs WHERE id = ?`, id).Scan(&snapshot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query config snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// hashFile returns the hex SHA-256 of a file, or an empty string if it has
+// no path or cannot be read
+func hashFile(path string) string {
+	if path == "" {
+		return ""
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// marshalHeaders encodes configured headers as a JSON object
+func marshalHeaders(headers map[string]string) string {
+	if len(headers) == 0 {
+		return "{}"
+	}
+	b, _ := json.Marshal(headers)
+	return string(b)
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestSaveConfig(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	cfg := &config.Config{
+		Admin: config.AdminConfig{Enabled: true, Port: 9000, Token: "hunter2"},
+		Services: []config.ServiceConfig{{
+			Name:    "apache",
+			Type:    "apache",
+			Enabled: true,
+			Ports:   config.PortList{80},
+			Endpoints: []config.EndpointConfig{
+				{Path: "/", Method: "GET", Status: 200},
+				{Path: "/admin", Method: "GET", Status: 403, When: `country == "US"`},
+			},
+		}},
+	}
+
+	first, err := db.SaveConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	again, err := db.SaveConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	if again != first {
+		t.Fatalf("Expected unchanged config to keep ID %d, got %d", first, again)
+	}
+
+	cfg.Services[0].Endpoints[0].Status = 404
+	changed, err := db.SaveConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	if changed == first {
+		t.Fatalf("Expected changed config to get a new ID")
+	}
+
+	var status int
+	err = db.conn.QueryRow(`
+		SELECT e.status FROM endpoints e
+		JOIN services s ON s.id = e.service_id
+		WHERE s.config_id = ? AND s.name = 'apache' AND e.path = '/'`,
+		first,
+	).Scan(&status)
+	if err != nil {
+		t.Fatalf("Failed to query endpoints: %v", err)
+	}
+	if status != 200 {
+		t.Fatalf("Expected the first config to keep status 200, got %d", status)
+	}
+
+	logger := NewRequestLogger(db)
+	history, err := logger.GetConfigHistory()
+	if err != nil {
+		t.Fatalf("Failed to get config history: %v", err)
+	}
+	if len(history) != 2 || history[0].ID != changed || history[1].Loads != 2 {
+		t.Fatalf("Expected the changed config first and the original loaded twice, got %+v", history)
+	}
+
+	snapshot, err := logger.GetConfigSnapshot(first)
+	if err != nil {
+		t.Fatalf("Failed to get config snapshot: %v", err)
+	}
+	if strings.Contains(snapshot, "hunter2") || !strings.Contains(snapshot, "/admin") {
+		t.Fatalf("Expected a redacted snapshot of the config, got:\n%s", snapshot)
+	}
+	if _, err := logger.GetConfigSnapshot(changed + 1); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound for an unknown config, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/reputation"
+)
+
+// ConnectionLog is a connection to a service that does not speak HTTP, such
+// as SSH, with what the client revealed before it was closed
+type ConnectionLog struct {
+	ID          int64     `json:"id"`
+	Timestamp   time.Time `json:"timestamp"`
+	SourceIP    string    `json:"source_ip"`
+	SourcePort  int       `json:"source_port"`
+	IPVersion   int       `json:"ip_version"`
+	ServerPort  int       `json:"server_port"`
+	ServiceName string    `json:"service_name"`
+	ServiceType string    `json:"service_type"`
+	Protocol    string    `json:"protocol"`
+
+	// ClientVersion is the software the client announced, and Fingerprint
+	// and FingerprintRaw its protocol fingerprint (HASSH for SSH) and the
+	// string hashed for it
+	ClientVersion  string `json:"client_version"`
+	Fingerprint    string `json:"fingerprint"`
+	FingerprintRaw string `json:"fingerprint_raw"`
+	Raw            string `json:"raw_data"`
+	Error          string `json:"error"`
+
+	SessionID int64            `json:"session_id"`
+	Country   string           `json:"country"`
+	ASN       int              `json:"asn"`
+	Flags     reputation.Flags `json:"flags"`
+	ConfigID  int64            `json:"config_id"`
+}
+
+// LogConnection logs a connection from remoteAddr to a non-HTTP service,
+// filling in the source, session, and time of the log
+func (rl *RequestLogger) LogConnection(remoteAddr string, c *ConnectionLog) error {
+	c.SourceIP, c.SourcePort, c.IPVersion = parseRemoteAddr(remoteAddr)
+	origin, _ := rl.geo.Lookup(c.SourceIP)
+	c.Country, c.ASN = origin.Country, origin.ASN
+	c.Flags = rl.reputation.Flags(c.SourceIP)
+	c.ConfigID = rl.configID
+
+	ctx, cancel := logContext(context.Background())
+	defer cancel()
+
+	// Connections count toward the session but not its endpoints
+	c.Timestamp = time.Now()
+	sessionID, err := rl.recordInteraction(ctx, c.SourceIP, c.Timestamp, interaction{port: c.ServerPort})
+	if err != nil {
+		return err
+	}
+	c.SessionID = sessionID
+
+	c.ID, err = rl.db.conn.InsertContext(ctx, `
+		INSERT INTO connection_logs (
+			timestamp, source_ip, source_port, ip_version, server_port,
+			service_name, service_type, protocol,
+			client_version, fingerprint, fingerprint_raw, raw_data, error,
+			session_id, country, asn, tor, datacenter, proxy, config_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, c.Timestamp, c.SourceIP, c.SourcePort, c.IPVersion, c.ServerPort,
+		c.ServiceName, c.ServiceType, c.Protocol,
+		c.ClientVersion, c.Fingerprint, c.FingerprintRaw, c.Raw, c.Error,
+		c.SessionID, c.Country, c.ASN, c.Flags.Tor, c.Flags.Datacenter, c.Flags.Proxy, c.ConfigID)
+	if err != nil {
+		return fmt.Errorf("failed to insert connection log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// TagCredentials tags requests that submitted credentials to a login form
+const TagCredentials = "credentials"
+
+// credentialCapture collects the credentials a request submits
+type credentialCapture struct {
+	mu          sync.Mutex
+	credentials []Credential
+}
+
+type credentialsKey struct{}
+
+// WithCredentials returns a context collecting the credentials its request
+// submits, to be stored with its log
+func WithCredentials(ctx context.Context) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, &credentialCapture{})
+}
+
+// CaptureCredential records credentials a request submitted to a login
+// form, if its context collects them
+func CaptureCredential(ctx context.Context, c Credential) {
+	capture, ok := ctx.Value(credentialsKey{}).(*credentialCapture)
+	if !ok {
+		return
+	}
+	capture.mu.Lock()
+	capture.credentials = append(capture.credentials, c)
+	capture.mu.Unlock()
+}
+
+// credentialsFromContext returns the credentials a request submitted
+func credentialsFromContext(ctx context.Context) []Credential {
+	capture, ok := ctx.Value(credentialsKey{}).(*credentialCapture)
+	if !ok {
+		return nil
+	}
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	return capture.credentials
+}
+
+// insertCredentials stores the credentials the request logged as e
+// submitted within tx
+func insertCredentials(ctx context.Context, tx *tx, e *RequestLog, credentials []Credential) error {
+	for _, c := range credentials {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO credentials (request_id, timestamp, source_ip, service_name, path, username, password)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, e.ID, e.Timestamp, e.SourceIP, e.ServiceName, e.Path, c.Username, c.Password)
+		if err != nil {
+			return fmt.Errorf("failed to insert credentials: %w", err)
+		}
+	}
+	return nil
+}
@@ -5,17 +5,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/davidthuman/service-spoof/internal/config"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // DB represents the database connection
 type DB struct {
-	conn *sql.DB
+	conn *pool
 	path string
 }
 
-// New creates a new database connection
+// New creates a new connection to the SQLite database at path
 func New(path string) (*DB, error) {
 	// Ensure the directory exists
 	dir := filepath.Dir(path)
@@ -23,8 +25,26 @@ func New(path string) (*DB, error) {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
+	return open(sqliteDialect{}, path, path)
+}
+
+// Open creates a new connection to the configured database, the SQLite
+// file at its path or the PostgreSQL server at its DSN
+func Open(cfg *config.DatabaseConfig) (*DB, error) {
+	d, err := dialectFor(cfg.GetDriver())
+	if err != nil {
+		return nil, err
+	}
+	if d.name() == config.DatabaseDriverSQLite {
+		return New(cfg.Path)
+	}
+	return open(d, cfg.DSN, cfg.Target())
+}
+
+// open opens and pings a database in a dialect
+func open(d dialect, dsn, path string) (*DB, error) {
 	// Open the database
-	conn, err := sql.Open("sqlite3", path)
+	conn, err := sql.Open(d.driverName(), dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -36,7 +56,7 @@ func New(path string) (*DB, error) {
 	}
 
 	return &DB{
-		conn: conn,
+		conn: &pool{DB: conn, dialect: d},
 		path: path,
 	}, nil
 }
@@ -51,5 +71,24 @@ func (db *DB) Close() error {
 
 // GetConn returns the underlying database connection
 func (db *DB) GetConn() *sql.DB {
-	return db.conn
+	return db.conn.DB
+}
+
+// Driver returns the database's driver, sqlite or postgres
+func (db *DB) Driver() string {
+	return db.conn.dialect.name()
+}
+
+// LastRequestTime returns when the most recently logged request arrived, or
+// the zero time if none has
+func (db *DB) LastRequestTime() (time.Time, error) {
+	var ts time.Time
+	err := db.conn.QueryRow(`SELECT timestamp FROM request_logs ORDER BY id DESC LIMIT 1`).Scan(&ts)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query last request: %w", err)
+	}
+	return ts, nil
 }
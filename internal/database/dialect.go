@@ -0,0 +1,191 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+)
+
+// dialect is what differs between the SQL databases requests can be logged
+// to. Queries are written for SQLite, with ? placeholders, and rewritten for
+// the others.
+type dialect interface {
+	// name is the database driver in the configuration
+	name() string
+
+	// driverName is the database/sql driver opening the database
+	driverName() string
+
+	// rebind rewrites the ? placeholders of a query
+	rebind(query string) string
+
+	// bindNamed rewrites the :name parameters of a report's query, and its
+	// sql.Named arguments, into what the driver takes
+	bindNamed(query string, args []any) (string, []any)
+
+	// returning reports whether inserts return their ID through a RETURNING
+	// clause rather than LastInsertId
+	returning() bool
+
+	// migrations returns the directory holding the dialect's migrations
+	// within the migrations directory
+	migrations(path string) string
+
+	// migrationDriver returns the migration driver for a connection. It must
+	// not be closed, since that would close the connection.
+	migrationDriver(conn *sql.DB) (migratedb.Driver, error)
+
+	// locked reports whether a driver error was caused by a lock held by
+	// another connection
+	locked(err error) bool
+}
+
+// dialectFor returns the dialect of a configured database driver
+func dialectFor(driver string) (dialect, error) {
+	switch driver {
+	case "", config.DatabaseDriverSQLite:
+		return sqliteDialect{}, nil
+	case config.DatabaseDriverPostgres:
+		if postgresDriver == "" {
+			return nil, fmt.Errorf("postgres support is not built in, rebuild with -tags postgres")
+		}
+		return postgresDialect{}, nil
+	}
+	return nil, fmt.Errorf("unknown database driver %q", driver)
+}
+
+// sqliteDialect is SQLite, which queries are written for
+type sqliteDialect struct{}
+
+func (sqliteDialect) name() string       { return config.DatabaseDriverSQLite }
+func (sqliteDialect) driverName() string { return "sqlite3" }
+func (sqliteDialect) returning() bool    { return false }
+
+func (sqliteDialect) rebind(query string) string { return query }
+
+func (sqliteDialect) locked(err error) bool { return sqliteLocked(err) }
+
+func (sqliteDialect) bindNamed(query string, args []any) (string, []any) { return query, args }
+
+func (sqliteDialect) migrations(path string) string { return path }
+
+func (sqliteDialect) migrationDriver(conn *sql.DB) (migratedb.Driver, error) {
+	return sqlite3.WithInstance(conn, &sqlite3.Config{})
+}
+
+// postgresDriver is the database/sql driver for PostgreSQL,
+// postgresMigrationDriver its migration driver, and postgresLocked reports
+// whether a driver error was caused by a lock. All are registered by
+// postgres.go, built with the postgres tag, and unset otherwise.
+var (
+	postgresDriver          string
+	postgresMigrationDriver func(conn *sql.DB) (migratedb.Driver, error)
+	postgresLocked          func(err error) bool
+)
+
+// postgresDialect is PostgreSQL, which numbers its placeholders and has no
+// LastInsertId
+type postgresDialect struct{}
+
+func (postgresDialect) name() string       { return config.DatabaseDriverPostgres }
+func (postgresDialect) driverName() string { return postgresDriver }
+func (postgresDialect) returning() bool    { return true }
+
+func (postgresDialect) locked(err error) bool { return postgresLocked(err) }
+
+// rebind numbers the ? placeholders of a query as $1, $2, and so on, leaving
+// those within string literals and quoted identifiers
+func (postgresDialect) rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// bindNamed numbers the distinct :name parameters of a query, in order of
+// first use, and orders the named arguments to match. Parameters without an
+// argument are NULL, and :: casts are left alone.
+func (postgresDialect) bindNamed(query string, args []any) (string, []any) {
+	values := make(map[string]any, len(args))
+	for _, arg := range args {
+		if named, ok := arg.(sql.NamedArg); ok {
+			values[named.Name] = named.Value
+		}
+	}
+
+	var b strings.Builder
+	positions := make(map[string]int)
+	var bound []any
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			b.WriteString("::")
+			i++
+			continue
+		case c == ':' && i+1 < len(query) && isParamStart(query[i+1]):
+			j := i + 1
+			for j < len(query) && isParamChar(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			pos, ok := positions[name]
+			if !ok {
+				bound = append(bound, values[name])
+				pos = len(bound)
+				positions[name] = pos
+			}
+			b.WriteString("$" + strconv.Itoa(pos))
+			i = j - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), bound
+}
+
+func isParamStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isParamChar(c byte) bool {
+	return isParamStart(c) || (c >= '0' && c <= '9')
+}
+
+// migrations returns the postgres directory within the migrations directory
+func (postgresDialect) migrations(path string) string {
+	return filepath.Join(path, "postgres")
+}
+
+func (postgresDialect) migrationDriver(conn *sql.DB) (migratedb.Driver, error) {
+	return postgresMigrationDriver(conn)
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestPostgresRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"SELECT '?' FROM t WHERE a = ?", "SELECT '?' FROM t WHERE a = $1"},
+		{`SELECT "a?" FROM t WHERE a = ? AND b = 'it''s ?'`, `SELECT "a?" FROM t WHERE a = $1 AND b = 'it''s ?'`},
+	}
+	for _, tt := range tests {
+		if got := (postgresDialect{}).rebind(tt.query); got != tt.want {
+			t.Errorf("rebind(%q) = %q, expected %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestPostgresBindNamed(t *testing.T) {
+	query, args := (postgresDialect{}).bindNamed(
+		`SELECT path::text FROM request_logs WHERE country = :country AND ':skip' != '' AND timestamp >= :since OR country = :country`,
+		[]any{sql.Named("since", "2024-01-01"), sql.Named("country", "US")},
+	)
+
+	want := `SELECT path::text FROM request_logs WHERE country = $1 AND ':skip' != '' AND timestamp >= $2 OR country = $1`
+	if query != want {
+		t.Fatalf("Expected query %q, got %q", want, query)
+	}
+	if len(args) != 2 || args[0] != "US" || args[1] != "2024-01-01" {
+		t.Fatalf("Expected arguments [US 2024-01-01], got %v", args)
+	}
+
+	// Parameters without an argument are bound as NULL
+	_, args = (postgresDialect{}).bindNamed(`SELECT :missing`, nil)
+	if len(args) != 1 || args[0] != nil {
+		t.Fatalf("Expected a NULL argument, got %v", args)
+	}
+}
+
+func TestOpenDriver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(&config.DatabaseConfig{Path: path})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if db.Driver() != config.DatabaseDriverSQLite {
+		t.Fatalf("Expected the sqlite driver, got %s", db.Driver())
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected database file to be created: %v", err)
+	}
+
+	if _, err := Open(&config.DatabaseConfig{Driver: "mysql"}); err == nil {
+		t.Fatalf("Expected an unknown driver to fail")
+	}
+	if postgresDriver == "" {
+		_, err := Open(&config.DatabaseConfig{Driver: config.DatabaseDriverPostgres, DSN: "postgres://localhost/spoof"})
+		if err == nil || !strings.Contains(err.Error(), "-tags postgres") {
+			t.Fatalf("Expected postgres to need the build tag, got %v", err)
+		}
+	}
+}
+
+func TestLockedError(t *testing.T) {
+	busy := fmt.Errorf("failed to commit request logs: %w", sqlite3.Error{Code: sqlite3.ErrBusy})
+	err := wrapLocked(sqliteDialect{}, busy)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected ErrLocked, got %v", err)
+	}
+	var serr sqlite3.Error
+	if !errors.As(err, &serr) || serr.Code != sqlite3.ErrBusy {
+		t.Fatalf("Expected the driver error to be kept, got %v", err)
+	}
+	if err.Error() != busy.Error() {
+		t.Fatalf("Expected message %q, got %q", busy.Error(), err.Error())
+	}
+
+	constraint := sqlite3.Error{Code: sqlite3.ErrConstraint}
+	if err := wrapLocked(sqliteDialect{}, constraint); errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected a constraint error not to be ErrLocked")
+	}
+	if wrapLocked(sqliteDialect{}, nil) != nil {
+		t.Fatalf("Expected no error")
+	}
+}
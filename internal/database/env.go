@@ -0,0 +1,92 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/davidthuman/service-spoof/internal/expr"
+)
+
+// EnvVars are the variables sink filters and alert rules can read
+var EnvVars = []string{
+	"id", "timestamp", "source_ip", "source_port", "ip_version", "ja4", "ja4_r", "ja4_o", "ja3", "ja4h", "server_port",
+	"service_name", "service_type", "method", "path", "protocol", "host",
+	"user_agent", "headers", "body", "raw_request", "response_status",
+	"response_template", "malformed", "protocol_guess", "scheme", "alpn", "tls_version", "tls_cipher", "client_hello_hash", "canary", "variant", "session_id",
+	"country", "asn", "tor", "datacenter", "proxy", "scanner", "tags", "config_id",
+}
+
+// Env returns the variables of a request log for evaluating expressions.
+// Headers hold the first value of each request header, and tags are a list
+// for the in operator.
+func (e *RequestLog) Env() expr.Env {
+	headers := make(map[string]string)
+	var parsed map[string][]string
+	if json.Unmarshal([]byte(e.Headers), &parsed) == nil {
+		for k, v := range parsed {
+			if len(v) > 0 {
+				headers[k] = v[0]
+			}
+		}
+	}
+
+	tags := make([]any, len(e.Tags))
+	for i, tag := range e.Tags {
+		tags[i] = tag
+	}
+
+	return expr.Env{
+		"id":                e.ID,
+		"timestamp":         e.Timestamp.Unix(),
+		"source_ip":         e.SourceIP,
+		"source_port":       e.SourcePort,
+		"ip_version":        e.IPVersion,
+		"ja4":               e.JA4Fingerprint,
+		"ja4_r":             e.JA4R,
+		"ja4_o":             e.JA4O,
+		"ja3":               e.JA3Fingerprint,
+		"ja4h":              e.JA4H,
+		"server_port":       e.ServerPort,
+		"service_name":      e.ServiceName,
+		"service_type":      e.ServiceType,
+		"method":            e.Method,
+		"path":              e.Path,
+		"protocol":          e.Protocol,
+		"host":              e.Host,
+		"user_agent":        e.UserAgent,
+		"headers":           headers,
+		"body":              e.Body,
+		"raw_request":       e.RawRequest,
+		"response_status":   e.ResponseStatus,
+		"response_template": e.ResponseTemplate,
+		"malformed":         e.Malformed,
+		"protocol_guess":    e.ProtocolGuess,
+		"scheme":            e.Scheme,
+		"alpn":              e.ALPN,
+		"tls_version":       e.TLSVersion,
+		"tls_cipher":        e.TLSCipher,
+		"client_hello_hash": e.ClientHelloHash,
+		"canary":            e.Canary,
+		"variant":           e.Variant,
+		"session_id":        e.SessionID,
+		"country":           e.Country,
+		"asn":               e.ASN,
+		"tor":               e.Flags.Tor,
+		"datacenter":        e.Flags.Datacenter,
+		"proxy":             e.Flags.Proxy,
+		"scanner":           e.Scanner,
+		"tags":              tags,
+		"config_id":         e.ConfigID,
+	}
+}
+
+// AlertRule logs an alert for every stored request log its condition holds
+// for
+type AlertRule struct {
+	Name string
+	When *expr.Program
+}
+
+// SetAlertRules replaces the rules checked against every stored request log
+func (rl *RequestLogger) SetAlertRules(rules []AlertRule) {
+	rl.alertRules = rules
+}
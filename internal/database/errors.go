@@ -0,0 +1,36 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrLocked is wrapped by errors of queries that failed because another
+// connection or process held a lock on the database. They are worth
+// retrying once the lock is released.
+var ErrLocked = errors.New("database is locked")
+
+// lockedError is a driver error caused by a lock. It keeps the driver's
+// message and error while also matching ErrLocked.
+type lockedError struct {
+	err error
+}
+
+func (e *lockedError) Error() string   { return e.err.Error() }
+func (e *lockedError) Unwrap() []error { return []error{ErrLocked, e.err} }
+
+// sqliteLocked reports whether err is SQLite's busy or locked error
+func sqliteLocked(err error) bool {
+	var serr sqlite3.Error
+	return errors.As(err, &serr) && (serr.Code == sqlite3.ErrBusy || serr.Code == sqlite3.ErrLocked)
+}
+
+// wrapLocked marks err as an ErrLocked if the dialect's driver reports a
+// lock caused it
+func wrapLocked(d dialect, err error) error {
+	if err != nil && d.locked(err) {
+		return &lockedError{err: err}
+	}
+	return err
+}
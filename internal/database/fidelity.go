@@ -0,0 +1,120 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// FidelityRun is the comparison of a service to a reference server running
+// the software it spoofs
+type FidelityRun struct {
+	ID          int64                `json:"id"`
+	Timestamp   time.Time            `json:"timestamp"`
+	ServiceName string               `json:"service_name"`
+	Image       string               `json:"image"`
+	Score       float64              `json:"score"`
+	Probes      int                  `json:"probes"`
+	Compared    int                  `json:"compared"`
+	Differences []FidelityDifference `json:"differences"`
+}
+
+// FidelityDifference is a field of a probe's answer that differed between
+// the reference and the spoof
+type FidelityDifference struct {
+	Probe string `json:"probe"`
+	Field string `json:"field"`
+	Want  string `json:"want"`
+	Got   string `json:"got"`
+}
+
+// fidelityRunColumns are the columns scanned by scanFidelityRun
+const fidelityRunColumns = `id, timestamp, service_name, image, score, probes, compared, differences`
+
+// SaveFidelityRun saves a fidelity run, setting its ID
+func (rl *RequestLogger) SaveFidelityRun(run *FidelityRun) error {
+	differences := run.Differences
+	if differences == nil {
+		differences = []FidelityDifference{}
+	}
+	differencesJSON, err := json.Marshal(differences)
+	if err != nil {
+		return fmt.Errorf("failed to encode fidelity differences: %w", err)
+	}
+
+	run.ID, err = rl.db.conn.Insert(`
+		INSERT INTO fidelity_runs (timestamp, service_name, image, score, probes, compared, differences)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, run.Timestamp, run.ServiceName, run.Image, run.Score, run.Probes, run.Compared, string(differencesJSON))
+	if err != nil {
+		return fmt.Errorf("failed to save fidelity run: %w", err)
+	}
+	return nil
+}
+
+// GetFidelityRuns returns the fidelity runs of a service, or of every service
+// if it is empty, most recent first. A limit of 0 returns all of them.
+func (rl *RequestLogger) GetFidelityRuns(serviceName string, limit int) ([]FidelityRun, error) {
+	query := `SELECT ` + fidelityRunColumns + ` FROM fidelity_runs`
+	var args []any
+	if serviceName != "" {
+		query += " WHERE service_name = ?"
+		args = append(args, serviceName)
+	}
+	query += " ORDER BY timestamp DESC, id DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := rl.db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fidelity runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := make([]FidelityRun, 0)
+	for rows.Next() {
+		run, err := scanFidelityRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan fidelity run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate fidelity runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// GetLastFidelityRun returns the most recent fidelity run of a service
+// against an image, or ErrNotFound if there is none
+func (rl *RequestLogger) GetLastFidelityRun(serviceName, image string) (*FidelityRun, error) {
+	row := rl.db.conn.QueryRow(`SELECT `+fidelityRunColumns+` FROM fidelity_runs
+		WHERE service_name = ? AND image = ? ORDER BY timestamp DESC, id DESC LIMIT 1`, serviceName, image)
+	run, err := scanFidelityRun(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fidelity run: %w", err)
+	}
+	return run, nil
+}
+
+// scanFidelityRun scans a row of fidelityRunColumns
+func scanFidelityRun(row interface{ Scan(...any) error }) (*FidelityRun, error) {
+	var run FidelityRun
+	var differencesJSON string
+	err := row.Scan(&run.ID, &run.Timestamp, &run.ServiceName, &run.Image, &run.Score,
+		&run.Probes, &run.Compared, &differencesJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(differencesJSON), &run.Differences); err != nil {
+		return nil, fmt.Errorf("failed to decode fidelity differences: %w", err)
+	}
+	return &run, nil
+}
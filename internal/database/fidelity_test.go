@@ -0,0 +1,57 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFidelityRuns(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	logger := NewRequestLogger(db)
+
+	if _, err := logger.GetLastFidelityRun("nginx", "nginx:1.25.3"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound before any run, got %v", err)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	for i, score := range []float64{0.9, 0.8} {
+		run := &FidelityRun{
+			Timestamp:   start.Add(time.Duration(i) * time.Minute),
+			ServiceName: "nginx",
+			Image:       "nginx:1.25.3",
+			Score:       score,
+			Probes:      20,
+			Compared:    100,
+			Differences: []FidelityDifference{{Probe: "root", Field: "header Server", Want: "nginx/1.25.3", Got: "nginx"}},
+		}
+		if err := logger.SaveFidelityRun(run); err != nil {
+			t.Fatalf("Failed to save fidelity run: %v", err)
+		}
+	}
+
+	last, err := logger.GetLastFidelityRun("nginx", "nginx:1.25.3")
+	if err != nil {
+		t.Fatalf("Failed to get last fidelity run: %v", err)
+	}
+	if last.Score != 0.8 || len(last.Differences) != 1 || last.Differences[0].Probe != "root" {
+		t.Fatalf("Expected the latest run with its differences, got %+v", last)
+	}
+
+	runs, err := logger.GetFidelityRuns("", 1)
+	if err != nil {
+		t.Fatalf("Failed to get fidelity runs: %v", err)
+	}
+	if len(runs) != 1 || runs[0].ID != last.ID {
+		t.Fatalf("Expected only the latest run, got %+v", runs)
+	}
+}
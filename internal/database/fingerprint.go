@@ -0,0 +1,64 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// FingerprintColumns maps each kind of TLS and HTTP fingerprint to the
+// request_logs column holding it
+var FingerprintColumns = map[string]string{
+	"ja4":  "fingerprint",
+	"ja3":  "ja3_fingerprint",
+	"ja4h": "ja4h",
+}
+
+// FingerprintCount is how often a fingerprint was logged in a window
+type FingerprintCount struct {
+	Fingerprint string `json:"fingerprint"`
+	Requests    int    `json:"requests"`
+	Sources     int    `json:"sources"`
+}
+
+// GetTopFingerprints returns the fingerprints of a kind in
+// FingerprintColumns logged most often since the given time, with the number
+// of distinct source IPs each came from. A limit of 0 returns all of them.
+func (rl *RequestLogger) GetTopFingerprints(kind string, since time.Time, limit int) ([]FingerprintCount, error) {
+	column, ok := FingerprintColumns[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown fingerprint type %q", kind)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %[1]s, COUNT(*) AS requests, COUNT(DISTINCT source_ip)
+		FROM request_logs
+		WHERE timestamp >= ? AND %[1]s != ''
+		GROUP BY %[1]s
+		ORDER BY requests DESC, %[1]s
+	`, column)
+	args := []any{since}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := rl.db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fingerprints: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]FingerprintCount, 0)
+	for rows.Next() {
+		var c FingerprintCount
+		if err := rows.Scan(&c.Fingerprint, &c.Requests, &c.Sources); err != nil {
+			return nil, fmt.Errorf("failed to scan fingerprint: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate fingerprints: %w", err)
+	}
+
+	return counts, nil
+}
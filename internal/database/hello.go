@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+// Refingerprinted is what recomputing the fingerprints of a stored
+// ClientHello found
+type Refingerprinted struct {
+	Hash string `json:"hash"`
+	JA4  string `json:"ja4"`
+	JA4R string `json:"ja4_r"`
+	JA4O string `json:"ja4_o"`
+	JA3  string `json:"ja3"`
+
+	// Requests is how many requests sent over connections with the hello
+	// had fingerprints other than these
+	Requests int64 `json:"requests"`
+
+	// Error is why the hello could not be parsed, if it could not
+	Error string `json:"error,omitempty"`
+}
+
+// storedHello returns the raw ClientHello of a request's connection if it is
+// to be stored
+func (rl *RequestLogger) storedHello(ctx context.Context) []byte {
+	hello, ok := ctx.Value(fingerprint.Hello).(*[]byte)
+	if !ok || hello == nil || len(*hello) == 0 || len(*hello) > rl.helloMaxSize {
+		return nil
+	}
+	return *hello
+}
+
+// helloHash returns the hash a ClientHello is stored under, or "" for none
+func helloHash(hello []byte) string {
+	if len(hello) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(hello)
+	return hex.EncodeToString(sum[:])
+}
+
+// insertHello stores a ClientHello within tx unless it already is
+func insertHello(ctx context.Context, tx *tx, hash string, hello []byte, seen time.Time) error {
+	if len(hello) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO client_hellos (hash, raw, first_seen) VALUES (?, ?, ?)
+		ON CONFLICT(hash) DO NOTHING
+	`, hash, hello, seen)
+	if err != nil {
+		return fmt.Errorf("failed to store client hello: %w", err)
+	}
+	return nil
+}
+
+// Refingerprint recomputes the JA4, JA4_r, JA4_o, and JA3 fingerprints of
+// every stored ClientHello with the current code, and unless dryRun updates
+// the requests logged with other fingerprints, so that changes to the
+// fingerprint specs apply to past captures. Requests whose hello was not
+// stored keep their fingerprints.
+func (rl *RequestLogger) Refingerprint(ctx context.Context, dryRun bool) ([]Refingerprinted, error) {
+	rows, err := rl.db.conn.QueryContext(ctx, `SELECT hash, raw FROM client_hellos ORDER BY first_seen`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query client hellos: %w", err)
+	}
+	results := make([]Refingerprinted, 0)
+	raws := make([][]byte, 0)
+	for rows.Next() {
+		var r Refingerprinted
+		var raw []byte
+		if err := rows.Scan(&r.Hash, &raw); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan client hello: %w", err)
+		}
+		results = append(results, r)
+		raws = append(raws, raw)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate client hellos: %w", err)
+	}
+
+	tx, err := rl.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin refingerprint transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i := range results {
+		r := &results[i]
+		hello, err := fingerprint.ParseClientHello(raws[i])
+		if err != nil {
+			r.Error = err.Error()
+			continue
+		}
+		r.JA4, r.JA4R, r.JA4O = hello.JA4('t'), hello.JA4R('t'), hello.JA4O('t')
+		r.JA3, _, _ = fingerprint.ParseJA3(raws[i])
+
+		const stale = `client_hello_hash = ? AND (fingerprint != ? OR ja4_r != ? OR ja4_o != ? OR ja3_fingerprint != ?)`
+		args := []any{r.Hash, r.JA4, r.JA4R, r.JA4O, r.JA3}
+		if dryRun {
+			if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM request_logs WHERE `+stale, args...).Scan(&r.Requests); err != nil {
+				return nil, fmt.Errorf("failed to count stale fingerprints: %w", err)
+			}
+			continue
+		}
+		res, err := tx.ExecContext(ctx, `
+			UPDATE request_logs SET fingerprint = ?, ja4_r = ?, ja4_o = ?, ja3_fingerprint = ?
+			WHERE `+stale,
+			append([]any{r.JA4, r.JA4R, r.JA4O, r.JA3}, args...)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update fingerprints: %w", err)
+		}
+		if r.Requests, err = res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("failed to update fingerprints: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit fingerprints: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+func TestRefingerprint(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	client, server := net.Pipe()
+	go tls.Client(client, &tls.Config{InsecureSkipVerify: true}).Handshake()
+	buf := make([]byte, 1<<14)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to read ClientHello: %v", err)
+	}
+	client.Close()
+	server.Close()
+	hello := buf[:n]
+
+	// Log requests as if their fingerprints had been computed wrongly, the
+	// last with hellos too large to store
+	logger := NewRequestLogger(db)
+	logger.SetClientHelloMaxSize(len(hello))
+	stale := "t13d0000h2_000000000000_000000000000"
+	for i := range 3 {
+		if i == 2 {
+			logger.SetClientHelloMaxSize(len(hello) - 1)
+		}
+		r := httptest.NewRequest("GET", "/", nil)
+		ctx := context.WithValue(r.Context(), fingerprint.JA4, &stale)
+		ctx = context.WithValue(ctx, fingerprint.Hello, &hello)
+		if err := logger.LogRequest(r.WithContext(ctx), 443, "nginx", "nginx", 200, "", nil); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+
+	var hellos int
+	db.conn.QueryRow("SELECT COUNT(*) FROM client_hellos").Scan(&hellos)
+	if hellos != 1 {
+		t.Fatalf("Expected the hello to be stored once, got %d", hellos)
+	}
+
+	results, err := logger.Refingerprint(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Failed to refingerprint: %v", err)
+	}
+	parsed, _ := fingerprint.ParseClientHello(hello)
+	if len(results) != 1 || results[0].Requests != 2 || results[0].JA4 != parsed.JA4('t') {
+		t.Fatalf("Expected 2 requests to get JA4 %s, got %+v", parsed.JA4('t'), results)
+	}
+	if logs, _ := logger.Query(LogFilter{JA4: stale}); len(logs) != 3 {
+		t.Fatalf("Expected a dry run to change nothing, got %d stale requests", len(logs))
+	}
+
+	if _, err := logger.Refingerprint(context.Background(), false); err != nil {
+		t.Fatalf("Failed to refingerprint: %v", err)
+	}
+	logs, err := logger.Query(LogFilter{Order: OrderOldest})
+	if err != nil {
+		t.Fatalf("Failed to query logs: %v", err)
+	}
+	for i, l := range logs {
+		want := parsed.JA4('t')
+		if i == 2 {
+			want = stale
+		}
+		if l.JA4Fingerprint != want {
+			t.Fatalf("Expected request %d to have JA4 %s, got %s", i, want, l.JA4Fingerprint)
+		}
+	}
+	if results, _ := logger.Refingerprint(context.Background(), false); results[0].Requests != 0 {
+		t.Fatalf("Expected nothing left to update, got %d requests", results[0].Requests)
+	}
+}
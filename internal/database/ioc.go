@@ -0,0 +1,138 @@
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/reputation"
+)
+
+// IOC types produced from logged requests
+const (
+	IOCTypeIP   = "ip"
+	IOCTypeURL  = "url"
+	IOCTypeHash = "hash"
+	IOCTypeJA4  = "ja4"
+)
+
+// IOC represents a single deduplicated indicator of compromise
+type IOC struct {
+	Type      string    `json:"type"`
+	Value     string    `json:"value"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+
+	// Flags set on any request the indicator was seen in
+	Flags reputation.Flags `json:"flags"`
+}
+
+// GetIOCs returns deduplicated indicators observed since the given time in
+// requests carrying every flag set in require, sorted by type and then by
+// descending hit count. Requests from known research scanners are left out if
+// excludeScanners is set.
+func (rl *RequestLogger) GetIOCs(since time.Time, require reputation.Flags, excludeScanners bool) ([]IOC, error) {
+	query := `
+		SELECT timestamp, source_ip, host, path, fingerprint, raw_request,
+			tor, datacenter, proxy
+		FROM request_logs
+		WHERE timestamp >= ?
+	`
+	if require.Tor {
+		query += " AND tor"
+	}
+	if require.Datacenter {
+		query += " AND datacenter"
+	}
+	if require.Proxy {
+		query += " AND proxy"
+	}
+	if excludeScanners {
+		query += " AND scanner = ''"
+	}
+
+	rows, err := rl.db.conn.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query request logs: %w", err)
+	}
+	defer rows.Close()
+
+	seen := make(map[string]*IOC)
+	add := func(iocType, value string, ts time.Time, flags reputation.Flags) {
+		if value == "" {
+			return
+		}
+		key := iocType + "|" + value
+		ioc, exists := seen[key]
+		if !exists {
+			seen[key] = &IOC{Type: iocType, Value: value, Count: 1, FirstSeen: ts, LastSeen: ts, Flags: flags}
+			return
+		}
+		ioc.Count++
+		ioc.Flags.Tor = ioc.Flags.Tor || flags.Tor
+		ioc.Flags.Datacenter = ioc.Flags.Datacenter || flags.Datacenter
+		ioc.Flags.Proxy = ioc.Flags.Proxy || flags.Proxy
+		if ts.Before(ioc.FirstSeen) {
+			ioc.FirstSeen = ts
+		}
+		if ts.After(ioc.LastSeen) {
+			ioc.LastSeen = ts
+		}
+	}
+
+	for rows.Next() {
+		var ts time.Time
+		var sourceIP, path, ja4, rawRequest string
+		var host sql.NullString
+		var flags reputation.Flags
+		if err := rows.Scan(&ts, &sourceIP, &host, &path, &ja4, &rawRequest,
+			&flags.Tor, &flags.Datacenter, &flags.Proxy); err != nil {
+			return nil, fmt.Errorf("failed to scan request log: %w", err)
+		}
+
+		add(IOCTypeIP, sourceIP, ts, flags)
+		add(IOCTypeURL, host.String+path, ts, flags)
+		add(IOCTypeHash, payloadHash(rawRequest), ts, flags)
+		add(IOCTypeJA4, ja4, ts, flags)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate request logs: %w", err)
+	}
+
+	iocs := make([]IOC, 0, len(seen))
+	for _, ioc := range seen {
+		iocs = append(iocs, *ioc)
+	}
+	sort.Slice(iocs, func(i, j int) bool {
+		if iocs[i].Type != iocs[j].Type {
+			return iocs[i].Type < iocs[j].Type
+		}
+		if iocs[i].Count != iocs[j].Count {
+			return iocs[i].Count > iocs[j].Count
+		}
+		return iocs[i].Value < iocs[j].Value
+	})
+
+	return iocs, nil
+}
+
+// payloadHash returns the SHA-256 of the request body contained in a raw
+// request dump, or an empty string if the request had no body
+func payloadHash(rawRequest string) string {
+	raw := []byte(rawRequest)
+	idx := bytes.Index(raw, []byte("\r\n\r\n"))
+	if idx < 0 {
+		return ""
+	}
+	body := raw[idx+4:]
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -1,18 +1,67 @@
 package database
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/davidthuman/service-spoof/internal/canary"
+	"github.com/davidthuman/service-spoof/internal/enrich"
 	"github.com/davidthuman/service-spoof/internal/fingerprint"
+	"github.com/davidthuman/service-spoof/internal/geoip"
+	"github.com/davidthuman/service-spoof/internal/handoff"
+	"github.com/davidthuman/service-spoof/internal/hostheader"
+	"github.com/davidthuman/service-spoof/internal/logging"
+	"github.com/davidthuman/service-spoof/internal/outage"
+	"github.com/davidthuman/service-spoof/internal/ratelimit"
+	"github.com/davidthuman/service-spoof/internal/reputation"
+	"github.com/davidthuman/service-spoof/internal/scanner"
+	"github.com/davidthuman/service-spoof/internal/soap"
+	"github.com/davidthuman/service-spoof/internal/websocket"
+	"github.com/davidthuman/service-spoof/internal/wellknown"
+)
+
+// logTimeout bounds the database work of logging each request, so requests
+// cannot pile up behind a locked or stalled database
+const logTimeout = 5 * time.Second
+
+// databaseLog logs the storing of requests, sinkLog the sinks they are sent
+// to, and alertLog the alerts they raise
+var (
+	databaseLog = logging.Logger("database")
+	sinkLog     = logging.Logger("sink")
+	alertLog    = logging.Logger("alert")
 )
 
 // RequestLogger handles logging HTTP requests to the database
 type RequestLogger struct {
-	db *DB
+	db             *DB
+	alertThreshold int
+	handoff        int
+	onHandoff      func(Session)
+	configID       int64
+	helloMaxSize   int
+	alertRules     []AlertRule
+	canaryAlerts   []*sinkWorker
+	geo            *geoip.DB
+	reputation     *reputation.Checker
+	enricher       *enrich.Enricher
+	scans          *scanTracker
+	sinkMu         sync.RWMutex
+	sinks          []*sinkWorker
+	sinkWG         sync.WaitGroup
+	writerMu       sync.RWMutex
+	writer         *logWriter
 }
 
 // NewRequestLogger creates a new request logger
@@ -22,24 +71,69 @@ func NewRequestLogger(db *DB) *RequestLogger {
 
 // RequestLog represents a logged HTTP request
 type RequestLog struct {
-	ID               int64
-	Timestamp        time.Time
-	SourceIP         string
-	SourcePort       int
-	JA4Fingerprint   string
-	ServerPort       int
-	ServiceName      string
-	ServiceType      string
-	Method           string
-	Path             string
-	Protocol         string
-	Host             string
-	UserAgent        string
-	Headers          string
-	Body             string
-	RawRequest       string
-	ResponseStatus   int
-	ResponseTemplate string
+	ID               int64            `json:"id"`
+	Timestamp        time.Time        `json:"timestamp"`
+	SourceIP         string           `json:"source_ip"`
+	SourcePort       int              `json:"source_port"`
+	IPVersion        int              `json:"ip_version"`
+	JA4Fingerprint   string           `json:"ja4"`
+	JA4R             string           `json:"ja4_r"`
+	JA4O             string           `json:"ja4_o"`
+	JA3Fingerprint   string           `json:"ja3"`
+	JA4H             string           `json:"ja4h"`
+	ServerPort       int              `json:"server_port"`
+	ServiceName      string           `json:"service_name"`
+	ServiceType      string           `json:"service_type"`
+	Method           string           `json:"method"`
+	Path             string           `json:"path"`
+	Protocol         string           `json:"protocol"`
+	Host             string           `json:"host"`
+	UserAgent        string           `json:"user_agent"`
+	Headers          string           `json:"headers"`
+	Body             string           `json:"body"`
+	RawRequest       string           `json:"raw_request"`
+	ResponseStatus   int              `json:"response_status"`
+	ResponseTemplate string           `json:"response_template"`
+	Malformed        bool             `json:"malformed"`
+	ProtocolGuess    string           `json:"protocol_guess"`
+	Scheme           string           `json:"scheme"`
+	ALPN             string           `json:"alpn"`
+	TLSVersion       string           `json:"tls_version"`
+	TLSCipher        string           `json:"tls_cipher"`
+	ClientHelloHash  string           `json:"client_hello_hash"`
+	Canary           string           `json:"canary"`
+	Variant          string           `json:"variant"`
+	SessionID        int64            `json:"session_id"`
+	Country          string           `json:"country"`
+	ASN              int              `json:"asn"`
+	Flags            reputation.Flags `json:"flags"`
+	Scanner          string           `json:"scanner"`
+	Tags             []string         `json:"tags"`
+	ConfigID         int64            `json:"config_id"`
+}
+
+// SetGeoIP records the source country and AS of every request looked up in db
+func (rl *RequestLogger) SetGeoIP(db *geoip.DB) {
+	rl.geo = db
+}
+
+// SetReputation flags every request whose source the checker knows as a Tor
+// exit node, open proxy, or datacenter address
+func (rl *RequestLogger) SetReputation(checker *reputation.Checker) {
+	rl.reputation = checker
+}
+
+// SetClientHelloMaxSize stores the raw ClientHello of each request's
+// connection, once per distinct hello, if it is at most size bytes. A size
+// of 0 stores none.
+func (rl *RequestLogger) SetClientHelloMaxSize(size int) {
+	rl.helloMaxSize = size
+}
+
+// SetConfigID tags every request with the configuration saved by SaveConfig
+// that served it
+func (rl *RequestLogger) SetConfigID(id int64) {
+	rl.configID = id
 }
 
 // LogRequest logs an HTTP request to the database
@@ -53,7 +147,7 @@ func (rl *RequestLogger) LogRequest(
 	rawDump []byte,
 ) error {
 	// Parse source IP and port
-	sourceIP, sourcePort := parseRemoteAddr(r.RemoteAddr)
+	sourceIP, sourcePort, ipVersion := parseRemoteAddr(r.RemoteAddr)
 
 	// Marshal headers to JSON
 	headersJSON, err := json.Marshal(r.Header)
@@ -69,65 +163,391 @@ func (rl *RequestLogger) LogRequest(
 	// Get user agent
 	userAgent := r.Header.Get("User-Agent")
 
-	// Get connection fingerprint from request context
+	// Get connection fingerprints from request context
+	ja3 := contextString(r.Context(), fingerprint.JA3)
+	ja4r := contextString(r.Context(), fingerprint.JA4R)
+	ja4o := contextString(r.Context(), fingerprint.JA4O)
+	ja4h := contextString(r.Context(), fingerprint.JA4H)
+	if ja4h == "" {
+		ja4h = fingerprint.ComputeJA4H(r)
+	}
+	hello := rl.storedHello(r.Context())
 	fingerprint := r.Context().Value(fingerprint.JA4)
 
-	// Insert into database
-	query := `
-		INSERT INTO request_logs (
-			timestamp, source_ip, source_port, fingerprint, server_port,
-			service_name, service_type,
-			method, path, protocol, host, user_agent,
-			headers, body, raw_request,
-			response_status, response_template
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-
-	_, err = rl.db.conn.Exec(
-		query,
-		time.Now(),
-		sourceIP,
-		sourcePort,
-		fingerprint,
-		serverPort,
-		serviceName,
-		serviceType,
-		r.Method,
-		r.URL.Path,
-		r.Proto,
-		r.Host,
-		userAgent,
-		string(headersJSON),
-		body,
-		string(rawDump),
-		responseStatus,
-		responseTemplate,
-	)
+	// Record which scheme the client chose, since dual ports accept both, and
+	// what its TLS handshake settled on beside what the client offered
+	scheme := "http"
+	var alpn, tlsVersion, tlsCipher string
+	if r.TLS != nil {
+		scheme = "https"
+		alpn = r.TLS.NegotiatedProtocol
+		tlsVersion = tls.VersionName(r.TLS.Version)
+		tlsCipher = tls.CipherSuiteName(r.TLS.CipherSuite)
+	}
+
+	// Record where the request came from
+	origin, _ := rl.geo.Lookup(sourceIP)
+	flags := rl.reputation.Flags(sourceIP)
+
+	// Tag requests from known research scanners
+	scannerName := ""
+	if s := scanner.FromContext(r.Context()); s != nil {
+		scannerName = s.Name
+	}
+
+	// Tag attacks found in the request body and anomalies in its Host header
+	tags := make([]string, 0)
+	if probe := soap.FromContext(r.Context()); probe != nil {
+		tags = probe.Tags()
+	}
+	tags = append(tags, hostheader.Check(r, serverPort)...)
+	if wellknown.IsACMEChallenge(r.URL.Path) {
+		tags = append(tags, wellknown.TagACMEChallenge)
+	}
+	if ratelimit.FromContext(r.Context()) != nil {
+		tags = append(tags, ratelimit.TagRateLimited)
+	}
+	if _, ok := handoff.FromContext(r.Context()); ok {
+		tags = append(tags, handoff.TagHandedOff)
+	}
+	if outage.FromContext(r.Context()) != nil {
+		tags = append(tags, outage.TagOutage)
+	}
+	token := canary.FromContext(r.Context())
+	canaryName := ""
+	if token != nil {
+		tags = append(tags, canary.TagCanary)
+		canaryName = token.Name
+	}
+	ws := websocket.FromContext(r.Context())
+	if ws.Upgraded() {
+		tags = append(tags, websocket.TagUpgraded)
+	}
+	credentials := credentialsFromContext(r.Context())
+	if len(credentials) > 0 {
+		tags = append(tags, TagCredentials)
+	}
+
+	ja4 := ""
+	if fp, ok := fingerprint.(*string); ok && fp != nil {
+		ja4 = *fp
+	}
+	in := newInteraction(r, rawDump)
+	in.port = serverPort
+	p := &pendingLog{
+		in:          in,
+		fingerprint: fingerprint,
+		hello:       hello,
+		canary:      token,
+		frames:      ws.Frames(),
+		credentials: credentials,
+		entry: &RequestLog{
+			Timestamp:        time.Now(),
+			SourceIP:         sourceIP,
+			SourcePort:       sourcePort,
+			IPVersion:        ipVersion,
+			JA4Fingerprint:   ja4,
+			JA4R:             ja4r,
+			JA4O:             ja4o,
+			JA3Fingerprint:   ja3,
+			JA4H:             ja4h,
+			ServerPort:       serverPort,
+			ServiceName:      serviceName,
+			ServiceType:      serviceType,
+			Method:           r.Method,
+			Path:             r.URL.Path,
+			Protocol:         r.Proto,
+			Host:             r.Host,
+			UserAgent:        userAgent,
+			Headers:          string(headersJSON),
+			Body:             body,
+			RawRequest:       captureFromContext(r.Context()).stored(rawDump),
+			ResponseStatus:   responseStatus,
+			ResponseTemplate: responseTemplate,
+			Scheme:           scheme,
+			ALPN:             alpn,
+			TLSVersion:       tlsVersion,
+			TLSCipher:        tlsCipher,
+			ClientHelloHash:  helloHash(hello),
+			Canary:           canaryName,
+			Variant:          variantFromContext(r.Context()),
+			Country:          origin.Country,
+			ASN:              origin.ASN,
+			Flags:            flags,
+			Scanner:          scannerName,
+			Tags:             tags,
+			ConfigID:         rl.configID,
+		},
+	}
+
+	ctx, cancel := logContext(r.Context())
+	defer cancel()
+	return rl.write(ctx, p)
+}
+
+// LogMalformed logs the raw bytes of a request that could not be parsed as
+// HTTP, along with a guess of the protocol the client was speaking. The
+// request line is split on a best-effort basis.
+func (rl *RequestLogger) LogMalformed(
+	remoteAddr string,
+	serverPort int,
+	serviceName string,
+	serviceType string,
+	responseStatus int,
+	responseTemplate string,
+	protocolGuess string,
+	raw []byte,
+) error {
+	sourceIP, sourcePort, ipVersion := parseRemoteAddr(remoteAddr)
+
+	// Take method, path, and protocol from the first line of HTTP requests
+	var method, path, protocol string
+	firstLine, _, _ := strings.Cut(string(raw), "\n")
+	fields := strings.Fields(firstLine)
+	if protocolGuess != "http" {
+		fields = nil
+	}
+	if len(fields) > 0 {
+		method = truncate(fields[0], 32)
+	}
+	if len(fields) > 1 {
+		path = truncate(fields[1], 2048)
+	}
+	if len(fields) > 2 {
+		protocol = truncate(fields[2], 32)
+	}
+
+	// Tag anomalies in the Host header of requests that parse, since
+	// net/http refuses some Host headers outright
+	tags := make([]string, 0)
+	if protocolGuess == "http" {
+		if req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw))); err == nil {
+			tags = hostheader.Check(req, serverPort)
+		}
+	}
+
+	origin, _ := rl.geo.Lookup(sourceIP)
+	flags := rl.reputation.Flags(sourceIP)
+
+	// Malformed requests count toward the session but not its endpoints
+	p := &pendingLog{
+		in: interaction{port: serverPort},
+		entry: &RequestLog{
+			Timestamp:        time.Now(),
+			SourceIP:         sourceIP,
+			SourcePort:       sourcePort,
+			IPVersion:        ipVersion,
+			ServerPort:       serverPort,
+			ServiceName:      serviceName,
+			ServiceType:      serviceType,
+			Method:           method,
+			Path:             path,
+			Protocol:         protocol,
+			Headers:          "{}",
+			RawRequest:       string(raw),
+			ResponseStatus:   responseStatus,
+			ResponseTemplate: responseTemplate,
+			Malformed:        true,
+			ProtocolGuess:    protocolGuess,
+			Country:          origin.Country,
+			ASN:              origin.ASN,
+			Flags:            flags,
+			Tags:             tags,
+			ConfigID:         rl.configID,
+		},
+	}
+
+	ctx, cancel := logContext(context.Background())
+	defer cancel()
+	return rl.write(ctx, p)
+}
+
+// pendingLog is a request log waiting to be written, with the interaction
+// it adds to its source's session
+type pendingLog struct {
+	entry *RequestLog
+	in    interaction
+
+	// fingerprint is the JA4 fingerprint from the request context, stored
+	// as is
+	fingerprint any
+
+	// hello is the raw ClientHello of the request's connection, if stored
+	hello []byte
+
+	// canary is the canary the request touched, if any
+	canary *canary.Token
+
+	// frames are the WebSocket frames sent over the request's connection
+	// once upgraded
+	frames []websocket.Frame
 
+	// credentials are those the request submitted to a login form
+	credentials []Credential
+
+	// update is the session update recorded with the log
+	update *sessionUpdate
+}
+
+// write writes a request log through the async writer when one is running,
+// and otherwise before returning
+func (rl *RequestLogger) write(ctx context.Context, p *pendingLog) error {
+	rl.writerMu.RLock()
+	w := rl.writer
+	if w != nil {
+		defer rl.writerMu.RUnlock()
+		return w.enqueue(ctx, p)
+	}
+	rl.writerMu.RUnlock()
+
+	return rl.writeBatch(ctx, []*pendingLog{p})
+}
+
+// writeBatch writes request logs and their session updates in a single
+// transaction, then acts on the updates and emits the logs
+func (rl *RequestLogger) writeBatch(ctx context.Context, batch []*pendingLog) error {
+	tx, err := rl.db.conn.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to insert request log: %w", err)
+		return fmt.Errorf("failed to begin request log transaction: %w", err)
 	}
+	defer tx.Rollback()
 
+	for _, p := range batch {
+		if err := rl.insertLog(ctx, tx, p); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit request logs: %w", err)
+	}
+
+	for _, p := range batch {
+		rl.sessionUpdated(ctx, p.update)
+		rl.emit(p.entry)
+		rl.alertCanary(p.entry, p.canary)
+	}
 	return nil
 }
 
-// parseRemoteAddr parses the remote address into IP and port
-func parseRemoteAddr(remoteAddr string) (string, int) {
-	// Format is typically "ip:port"
-	parts := strings.Split(remoteAddr, ":")
-	if len(parts) < 2 {
-		return remoteAddr, 0
+// insertLog scores a request log against its source's session and inserts
+// it within tx
+func (rl *RequestLogger) insertLog(ctx context.Context, tx *tx, p *pendingLog) error {
+	e := p.entry
+	u, err := rl.updateSession(ctx, tx, e.SourceIP, e.Timestamp, p.in)
+	if err != nil {
+		return err
 	}
+	p.update = u
+	e.SessionID = u.session.ID
 
-	// Handle IPv6 addresses which have multiple colons
-	// For simplicity, we'll just take the last part as port
-	port := 0
-	portStr := parts[len(parts)-1]
-	fmt.Sscanf(portStr, "%d", &port)
+	if e.Malformed {
+		e.ID, err = tx.InsertContext(ctx, `
+			INSERT INTO request_logs (
+				timestamp, source_ip, source_port, ip_version, server_port,
+				service_name, service_type,
+				method, path, protocol,
+				headers, raw_request,
+				response_status, response_template, malformed, protocol_guess, session_id,
+				country, asn, tor, datacenter, proxy, tags, config_id
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, TRUE, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, e.Timestamp, e.SourceIP, e.SourcePort, e.IPVersion, e.ServerPort,
+			e.ServiceName, e.ServiceType,
+			e.Method, e.Path, e.Protocol,
+			e.Headers, e.RawRequest,
+			e.ResponseStatus, e.ResponseTemplate, e.ProtocolGuess, e.SessionID,
+			e.Country, e.ASN, e.Flags.Tor, e.Flags.Datacenter, e.Flags.Proxy, strings.Join(e.Tags, ","), e.ConfigID)
+		if err != nil {
+			return fmt.Errorf("failed to insert malformed request log: %w", err)
+		}
+	} else {
+		if err := insertHello(ctx, tx, e.ClientHelloHash, p.hello, e.Timestamp); err != nil {
+			return err
+		}
+		e.ID, err = tx.InsertContext(ctx, `
+			INSERT INTO request_logs (
+				timestamp, source_ip, source_port, ip_version, fingerprint, ja4_r, ja4_o, ja3_fingerprint, ja4h, server_port,
+				service_name, service_type,
+				method, path, protocol, host, user_agent,
+				headers, body, raw_request,
+				response_status, response_template, scheme, alpn, tls_version, tls_cipher, client_hello_hash, canary, variant, session_id,
+				country, asn, tor, datacenter, proxy, scanner, tags, config_id
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, e.Timestamp, e.SourceIP, e.SourcePort, e.IPVersion, p.fingerprint, e.JA4R, e.JA4O, e.JA3Fingerprint, e.JA4H, e.ServerPort,
+			e.ServiceName, e.ServiceType,
+			e.Method, e.Path, e.Protocol, e.Host, e.UserAgent,
+			e.Headers, e.Body, e.RawRequest,
+			e.ResponseStatus, e.ResponseTemplate, e.Scheme, e.ALPN, e.TLSVersion, e.TLSCipher, e.ClientHelloHash, e.Canary, e.Variant, e.SessionID,
+			e.Country, e.ASN, e.Flags.Tor, e.Flags.Datacenter, e.Flags.Proxy, e.Scanner, strings.Join(e.Tags, ","), e.ConfigID)
+		if err != nil {
+			return fmt.Errorf("failed to insert request log: %w", err)
+		}
+		if err := insertWebSocketMessages(ctx, tx, e.ID, p.frames); err != nil {
+			return err
+		}
+		if err := insertCredentials(ctx, tx, e, p.credentials); err != nil {
+			return err
+		}
+	}
+	return rl.rollup(ctx, tx, e)
+}
 
-	// IP is everything except the last part
-	ip := strings.Join(parts[:len(parts)-1], ":")
-	ip = strings.Trim(ip, "[]") // Remove brackets from IPv6
+// logContext returns the context a request is logged under. It keeps the
+// values of the request context but not its cancellation, since a client
+// hanging up mid-response is still worth logging, and gives up after
+// logTimeout.
+func logContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), logTimeout)
+}
 
-	return ip, port
+// contextString returns a connection fingerprint from the request context,
+// which the connection fills in once it has read the ClientHello
+func contextString(ctx context.Context, key fingerprint.JA4Key) string {
+	if fp, ok := ctx.Value(key).(*string); ok && fp != nil {
+		return *fp
+	}
+	return ""
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// SourceIP returns the normalized IP of a remote address, in the form
+// sources are stored in
+func SourceIP(remoteAddr string) string {
+	ip, _, _ := parseRemoteAddr(remoteAddr)
+	return ip
+}
+
+// parseRemoteAddr parses a remote address into a normalized IP, port, and IP
+// version. IPv4-mapped IPv6 addresses are returned as IPv4 and zones are
+// dropped, so each source is always stored in the same form. Hosts that are
+// not IPs are returned as they are with version 0.
+func parseRemoteAddr(remoteAddr string) (string, int, int) {
+	host, portStr, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		// No port, such as a bare IPv6 address
+		host, portStr = strings.Trim(remoteAddr, "[]"), ""
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		port = 0
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host, port, 0
+	}
+	addr = addr.Unmap().WithZone("")
+
+	version := 6
+	if addr.Is4() {
+		version = 4
+	}
+	return addr.String(), port, version
 }
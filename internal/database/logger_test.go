@@ -0,0 +1,62 @@
+package database
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseRemoteAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		ip      string
+		port    int
+		version int
+	}{
+		{"203.0.113.7:40000", "203.0.113.7", 40000, 4},
+		{"[2001:db8::1]:443", "2001:db8::1", 443, 6},
+		{"[2001:DB8:0:0::1]:443", "2001:db8::1", 443, 6},
+		{"[fe80::1%eth0]:8080", "fe80::1", 8080, 6},
+		{"[::ffff:203.0.113.7]:80", "203.0.113.7", 80, 4},
+		{"2001:db8::1", "2001:db8::1", 0, 6},
+		{"[2001:db8::1]", "2001:db8::1", 0, 6},
+		{"203.0.113.7", "203.0.113.7", 0, 4},
+		{"203.0.113.7:99999", "203.0.113.7", 0, 4},
+		{"203.0.113.7:http", "203.0.113.7", 0, 4},
+		{"pipe", "pipe", 0, 0},
+		{"", "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			ip, port, version := parseRemoteAddr(tt.addr)
+			if ip != tt.ip || port != tt.port || version != tt.version {
+				t.Fatalf("Expected %s, %d, IPv%d, got %s, %d, IPv%d", tt.ip, tt.port, tt.version, ip, port, version)
+			}
+		})
+	}
+}
+
+func FuzzParseRemoteAddr(f *testing.F) {
+	for _, addr := range []string{"203.0.113.7:40000", "[2001:db8::1]:443", "[fe80::1%eth0]:80", "2001:db8::1", "", ":", "[]:", "host"} {
+		f.Add(addr)
+	}
+
+	f.Fuzz(func(t *testing.T, addr string) {
+		ip, port, version := parseRemoteAddr(addr)
+		if port < 0 || port > 65535 {
+			t.Fatalf("Expected a port in range from %q, got %d", addr, port)
+		}
+		if version == 0 {
+			return
+		}
+
+		// IPs are normalized, so parsing them again changes nothing
+		parsed, err := netip.ParseAddr(ip)
+		if err != nil || parsed.String() != ip || parsed.Zone() != "" || parsed.Is4In6() {
+			t.Fatalf("Expected a normalized IP from %q, got %q", addr, ip)
+		}
+		if (version == 4) != parsed.Is4() {
+			t.Fatalf("Expected IPv%d for %q", version, ip)
+		}
+	})
+}
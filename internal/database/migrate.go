@@ -1,40 +1,72 @@
 package database
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"path/filepath"
 
 	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
-// RunMigrations runs all pending database migrations
-func (db *DB) RunMigrations(migrationsPath string) error {
+// migrationsURL returns the file source URL of the database's migrations in
+// a migrations directory, which holds those of SQLite and, in its postgres
+// directory, those of PostgreSQL
+func (db *DB) migrationsURL(migrationsPath string) (string, error) {
 	// Convert relative path to absolute if needed
-	absPath, err := filepath.Abs(migrationsPath)
+	absPath, err := filepath.Abs(db.conn.dialect.migrations(migrationsPath))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve migrations path: %w", err)
+	}
+	return fmt.Sprintf("file://%s", absPath), nil
+}
+
+// driver returns a migration driver for the database. It must not be
+// closed, since that would close the database connection.
+func (db *DB) driver() (migratedb.Driver, error) {
+	driver, err := db.conn.dialect.migrationDriver(db.conn.DB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration driver: %w", err)
+	}
+	return driver, nil
+}
+
+// migrator returns a migrate instance for the migrations in migrationsPath
+func (db *DB) migrator(migrationsPath string) (*migrate.Migrate, error) {
+	url, err := db.migrationsURL(migrationsPath)
 	if err != nil {
-		return fmt.Errorf("failed to resolve migrations path: %w", err)
+		return nil, err
 	}
 
-	// Create migration driver for SQLite
-	driver, err := sqlite3.WithInstance(db.conn, &sqlite3.Config{})
+	driver, err := db.driver()
 	if err != nil {
-		return fmt.Errorf("failed to create migration driver: %w", err)
+		return nil, err
 	}
 
 	// Create migrate instance
-	m, err := migrate.NewWithDatabaseInstance(
-		fmt.Sprintf("file://%s", absPath),
-		"sqlite3",
-		driver,
-	)
+	m, err := migrate.NewWithDatabaseInstance(url, db.conn.dialect.driverName(), driver)
 	if err != nil {
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+		return nil, fmt.Errorf("failed to create migrate instance: %w", err)
+	}
+	return m, nil
+}
+
+// RunMigrations runs all pending database migrations
+func (db *DB) RunMigrations(migrationsPath string) error {
+	m, err := db.migrator(migrationsPath)
+	if err != nil {
+		return err
 	}
 
 	// Run migrations
 	err = m.Up()
+	var dirty migrate.ErrDirty
+	if errors.As(err, &dirty) {
+		return fmt.Errorf("failed to run migrations: database is dirty at version %d, run \"migrate recover\" or enable database.autoRecover", dirty.Version)
+	}
 	if err != nil && err != migrate.ErrNoChange {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
@@ -42,30 +74,127 @@ func (db *DB) RunMigrations(migrationsPath string) error {
 	return nil
 }
 
-// GetMigrationVersion returns the current migration version and dirty state
-// by directly querying the schema_migrations table
+// RollbackMigrations runs the down migrations of the newest steps applied
+// migrations. Down migrations the SQLite schema cannot express leave their
+// columns in place, so only the recorded version goes back.
+func (db *DB) RollbackMigrations(migrationsPath string, steps int) error {
+	m, err := db.migrator(migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	err = m.Steps(-steps)
+	var dirty migrate.ErrDirty
+	if errors.As(err, &dirty) {
+		return fmt.Errorf("failed to roll back migrations: database is dirty at version %d, run \"migrate recover\" first", dirty.Version)
+	}
+	// Asking for more steps than were applied rolls them all back
+	var short migrate.ErrShortLimit
+	if err != nil && !errors.As(err, &short) && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to roll back migrations: %w", err)
+	}
+	return nil
+}
+
+// GetMigrationVersion returns the current migration version and dirty state.
+// A database without migrations is at version 0.
 func (db *DB) GetMigrationVersion() (uint, bool, error) {
-	var version uint
-	var dirty bool
+	driver, err := db.driver()
+	if err != nil {
+		return 0, false, err
+	}
 
-	// Check if schema_migrations table exists
-	var count int
-	err := db.conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='schema_migrations'").Scan(&count)
+	version, dirty, err := driver.Version()
 	if err != nil {
-		return 0, false, fmt.Errorf("failed to check for schema_migrations table: %w", err)
+		return 0, false, fmt.Errorf("failed to get migration version: %w", err)
 	}
+	if version == migratedb.NilVersion {
+		return 0, dirty, nil
+	}
+	return uint(version), dirty, nil
+}
+
+// ForceMigrationVersion records version as the current migration version and
+// clears the dirty state without running any migration. Version 0 marks the
+// database as having no migrations applied.
+func (db *DB) ForceMigrationVersion(migrationsPath string, version uint) error {
+	m, err := db.migrator(migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	v := int(version)
+	if version == 0 {
+		v = migratedb.NilVersion
+	}
+	if err := m.Force(v); err != nil {
+		return fmt.Errorf("failed to force migration version %d: %w", version, err)
+	}
+	return nil
+}
+
+// RecoverDirtyMigration resets a database left dirty by a crashed migration
+// to the version before it, so the migration is retried on the next run.
+// Each migration runs in a transaction, so a failed one leaves the
+// schema as it was. It returns the dirty version, or 0 if the database was
+// clean.
+func (db *DB) RecoverDirtyMigration(migrationsPath string) (uint, error) {
+	version, dirty, err := db.GetMigrationVersion()
+	if err != nil || !dirty {
+		return 0, err
+	}
+
+	url, err := db.migrationsURL(migrationsPath)
+	if err != nil {
+		return 0, err
+	}
+	src, err := source.Open(url)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open migrations: %w", err)
+	}
+	defer src.Close()
 
-	// If table doesn't exist, no migrations have been run
-	if count == 0 {
-		return 0, false, nil
+	var previous uint
+	if prev, err := src.Prev(version); err == nil {
+		previous = prev
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("failed to find the migration before version %d: %w", version, err)
 	}
 
-	// Query the version and dirty state
-	err = db.conn.QueryRow("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err := db.ForceMigrationVersion(migrationsPath, previous); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// LatestMigrationVersion returns the version of the newest migration in
+// migrationsPath, or 0 if there are none
+func (db *DB) LatestMigrationVersion(migrationsPath string) (uint, error) {
+	url, err := db.migrationsURL(migrationsPath)
 	if err != nil {
-		// No rows means no migrations have been run
-		return 0, false, nil
+		return 0, err
 	}
+	src, err := source.Open(url)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open migrations: %w", err)
+	}
+	defer src.Close()
 
-	return version, dirty, nil
+	version, err := src.First()
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read migrations: %w", err)
+		}
+		version = next
+	}
 }
@@ -352,3 +352,88 @@ func TestDatabase_CloseAndReopen(t *testing.T) {
 		t.Fatalf("Version changed after re-running migrations: was %d, now %d", v2, v3)
 	}
 }
+
+func TestRecoverDirtyMigration(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	latest, _, err := db.GetMigrationVersion()
+	if err != nil {
+		t.Fatalf("Failed to get version: %v", err)
+	}
+
+	// Simulate a crash during the latest migration
+	if _, err := db.conn.Exec("UPDATE schema_migrations SET dirty = 1"); err != nil {
+		t.Fatalf("Failed to mark database dirty: %v", err)
+	}
+	if err := db.RunMigrations("../../migrations"); err == nil {
+		t.Fatalf("Expected migrations to fail on a dirty database")
+	}
+
+	recovered, err := db.RecoverDirtyMigration("../../migrations")
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	if recovered != latest {
+		t.Fatalf("Expected to recover version %d, got %d", latest, recovered)
+	}
+
+	version, dirty, err := db.GetMigrationVersion()
+	if err != nil {
+		t.Fatalf("Failed to get version: %v", err)
+	}
+	if dirty || version >= latest {
+		t.Fatalf("Expected a clean version before %d, got %d (dirty %v)", latest, version, dirty)
+	}
+
+	if recovered, err := db.RecoverDirtyMigration("../../migrations"); err != nil || recovered != 0 {
+		t.Fatalf("Expected nothing to recover on a clean database, got %d, %v", recovered, err)
+	}
+}
+
+func TestRollbackMigrations(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	latest, _, err := db.GetMigrationVersion()
+	if err != nil {
+		t.Fatalf("Failed to get version: %v", err)
+	}
+
+	// Each migration can be rolled back and applied again, so its down
+	// migration must undo all of it
+	for steps := 1; steps <= int(latest); steps++ {
+		if err := db.RollbackMigrations("../../migrations", steps); err != nil {
+			t.Fatalf("Failed to roll back %d migrations: %v", steps, err)
+		}
+		if err := db.RunMigrations("../../migrations"); err != nil {
+			t.Fatalf("Failed to reapply %d migrations: %v", steps, err)
+		}
+	}
+
+	// Rolling back more than were applied stops at none
+	if err := db.RollbackMigrations("../../migrations", int(latest)+5); err != nil {
+		t.Fatalf("Failed to roll back all migrations: %v", err)
+	}
+	version, dirty, err := db.GetMigrationVersion()
+	if err != nil || version != 0 || dirty {
+		t.Fatalf("Expected version 0, got %d (dirty %v), %v", version, dirty, err)
+	}
+	var count int
+	db.conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='request_logs'").Scan(&count)
+	if count != 0 {
+		t.Fatalf("Expected request_logs to be dropped")
+	}
+}
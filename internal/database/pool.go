@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// pool is the database's connection pool. Its query methods take queries
+// written for SQLite and rewrite them for the database's dialect, and mark
+// errors caused by locks as ErrLocked.
+type pool struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (p *pool) Exec(query string, args ...any) (sql.Result, error) {
+	result, err := p.DB.Exec(p.dialect.rebind(query), args...)
+	return result, wrapLocked(p.dialect, err)
+}
+
+func (p *pool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := p.DB.ExecContext(ctx, p.dialect.rebind(query), args...)
+	return result, wrapLocked(p.dialect, err)
+}
+
+func (p *pool) Query(query string, args ...any) (*sql.Rows, error) {
+	rows, err := p.DB.Query(p.dialect.rebind(query), args...)
+	return rows, wrapLocked(p.dialect, err)
+}
+
+func (p *pool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := p.DB.QueryContext(ctx, p.dialect.rebind(query), args...)
+	return rows, wrapLocked(p.dialect, err)
+}
+
+func (p *pool) QueryRow(query string, args ...any) *sql.Row {
+	return p.DB.QueryRow(p.dialect.rebind(query), args...)
+}
+
+func (p *pool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return p.DB.QueryRowContext(ctx, p.dialect.rebind(query), args...)
+}
+
+func (p *pool) Begin() (*tx, error) {
+	return p.BeginTx(context.Background(), nil)
+}
+
+func (p *pool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*tx, error) {
+	t, err := p.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, wrapLocked(p.dialect, err)
+	}
+	return &tx{Tx: t, dialect: p.dialect}, nil
+}
+
+// InsertContext runs an INSERT and returns the ID of the inserted row
+func (p *pool) InsertContext(ctx context.Context, query string, args ...any) (int64, error) {
+	id, err := insert(ctx, p.DB, p.dialect, query, args...)
+	return id, wrapLocked(p.dialect, err)
+}
+
+// Insert runs an INSERT and returns the ID of the inserted row
+func (p *pool) Insert(query string, args ...any) (int64, error) {
+	return p.InsertContext(context.Background(), query, args...)
+}
+
+// tx is a transaction whose query methods rewrite queries as pool's do
+type tx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (t *tx) Exec(query string, args ...any) (sql.Result, error) {
+	result, err := t.Tx.Exec(t.dialect.rebind(query), args...)
+	return result, wrapLocked(t.dialect, err)
+}
+
+func (t *tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := t.Tx.ExecContext(ctx, t.dialect.rebind(query), args...)
+	return result, wrapLocked(t.dialect, err)
+}
+
+func (t *tx) Commit() error {
+	return wrapLocked(t.dialect, t.Tx.Commit())
+}
+
+func (t *tx) QueryRow(query string, args ...any) *sql.Row {
+	return t.Tx.QueryRow(t.dialect.rebind(query), args...)
+}
+
+func (t *tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.Tx.QueryRowContext(ctx, t.dialect.rebind(query), args...)
+}
+
+// InsertContext runs an INSERT and returns the ID of the inserted row
+func (t *tx) InsertContext(ctx context.Context, query string, args ...any) (int64, error) {
+	id, err := insert(ctx, t.Tx, t.dialect, query, args...)
+	return id, wrapLocked(t.dialect, err)
+}
+
+// Insert runs an INSERT and returns the ID of the inserted row
+func (t *tx) Insert(query string, args ...any) (int64, error) {
+	return t.InsertContext(context.Background(), query, args...)
+}
+
+// querier runs queries on a connection pool or in a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// insert runs an INSERT into a table with an id column and returns the ID
+// of the inserted row, through a RETURNING clause where the dialect has no
+// LastInsertId
+func insert(ctx context.Context, q querier, d dialect, query string, args ...any) (int64, error) {
+	query = d.rebind(query)
+	if d.returning() {
+		var id int64
+		err := q.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
@@ -0,0 +1,27 @@
+//go:build postgres
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	migratepgx "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// PostgreSQL support needs the pgx driver, which is only linked into builds
+// with the postgres tag
+func init() {
+	postgresDriver = "pgx"
+	postgresMigrationDriver = func(conn *sql.DB) (migratedb.Driver, error) {
+		return migratepgx.WithInstance(conn, &migratepgx.Config{})
+	}
+	postgresLocked = func(err error) bool {
+		// lock_not_available, raised by NOWAIT and lock_timeout
+		var perr *pgconn.PgError
+		return errors.As(err, &perr) && perr.Code == "55P03"
+	}
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/reputation"
+)
+
+// Credential is a username and password a client tried
+type Credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ProtocolSession is a session with a service speaking an interactive
+// protocol other than HTTP, such as FTP, with every line exchanged
+type ProtocolSession struct {
+	ID          int64     `json:"id"`
+	Timestamp   time.Time `json:"timestamp"`
+	SourceIP    string    `json:"source_ip"`
+	SourcePort  int       `json:"source_port"`
+	IPVersion   int       `json:"ip_version"`
+	ServerPort  int       `json:"server_port"`
+	ServiceName string    `json:"service_name"`
+	ServiceType string    `json:"service_type"`
+	Protocol    string    `json:"protocol"`
+
+	// Credentials are the logins the client tried, Commands how many
+	// commands it sent, and Transcript every line exchanged, client lines
+	// prefixed "C: " and server lines "S: "
+	Credentials []Credential  `json:"credentials"`
+	Commands    int           `json:"commands"`
+	Transcript  string        `json:"transcript"`
+	Duration    time.Duration `json:"duration"`
+	Error       string        `json:"error"`
+
+	SessionID int64            `json:"session_id"`
+	Country   string           `json:"country"`
+	ASN       int              `json:"asn"`
+	Flags     reputation.Flags `json:"flags"`
+	ConfigID  int64            `json:"config_id"`
+}
+
+// LogProtocolSession logs a session from remoteAddr with a non-HTTP service
+// once it has ended, filling in the source and session. Timestamp is when
+// the session started.
+func (rl *RequestLogger) LogProtocolSession(remoteAddr string, s *ProtocolSession) error {
+	s.SourceIP, s.SourcePort, s.IPVersion = parseRemoteAddr(remoteAddr)
+	origin, _ := rl.geo.Lookup(s.SourceIP)
+	s.Country, s.ASN = origin.Country, origin.ASN
+	s.Flags = rl.reputation.Flags(s.SourceIP)
+	s.ConfigID = rl.configID
+
+	credentials := s.Credentials
+	if credentials == nil {
+		credentials = []Credential{}
+	}
+	credentialsJSON, err := json.Marshal(credentials)
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+
+	ctx, cancel := logContext(context.Background())
+	defer cancel()
+
+	// Sessions count toward the source's session but not its endpoints
+	sessionID, err := rl.recordInteraction(ctx, s.SourceIP, s.Timestamp, interaction{port: s.ServerPort})
+	if err != nil {
+		return err
+	}
+	s.SessionID = sessionID
+
+	s.ID, err = rl.db.conn.InsertContext(ctx, `
+		INSERT INTO protocol_sessions (
+			timestamp, source_ip, source_port, ip_version, server_port,
+			service_name, service_type, protocol,
+			credentials, commands, transcript, duration_ms, error,
+			session_id, country, asn, tor, datacenter, proxy, config_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.Timestamp, s.SourceIP, s.SourcePort, s.IPVersion, s.ServerPort,
+		s.ServiceName, s.ServiceType, s.Protocol,
+		string(credentialsJSON), s.Commands, s.Transcript, s.Duration.Milliseconds(), s.Error,
+		s.SessionID, s.Country, s.ASN, s.Flags.Tor, s.Flags.Datacenter, s.Flags.Proxy, s.ConfigID)
+	if err != nil {
+		return fmt.Errorf("failed to insert protocol session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Orders logged requests can be returned in
+const (
+	OrderNewest = "newest"
+	OrderOldest = "oldest"
+)
+
+// LogFilter selects logged requests and pages through them. Empty fields
+// match everything.
+type LogFilter struct {
+	ID         int64
+	SourceIP   string
+	JA4        string
+	JA3        string
+	JA4H       string
+	Service    string
+	Port       int
+	Method     string
+	Path       string
+	PathPrefix string
+	Status     int
+	Country    string
+	Tag        string
+	Since      time.Time
+	Until      time.Time
+
+	// Order is OrderNewest, the default, or OrderOldest
+	Order string
+
+	// Cursor pages by keyset: only requests after the one with this ID in
+	// the order are returned, so pages stay stable while requests are
+	// logged. Pass the ID of the last request of the previous page.
+	Cursor int64
+
+	// Limit bounds the number of requests returned, all of them if 0, after
+	// skipping the first Offset
+	Limit  int
+	Offset int
+}
+
+// where returns the WHERE clause of the filter and its arguments
+func (f LogFilter) where() (string, []any) {
+	conds := make([]string, 0)
+	args := make([]any, 0)
+	add := func(cond string, arg any) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+
+	if f.ID != 0 {
+		add("id = ?", f.ID)
+	}
+	if f.SourceIP != "" {
+		add("source_ip = ?", f.SourceIP)
+	}
+	if f.JA4 != "" {
+		add("fingerprint = ?", f.JA4)
+	}
+	if f.JA3 != "" {
+		add("ja3_fingerprint = ?", f.JA3)
+	}
+	if f.JA4H != "" {
+		add("ja4h = ?", f.JA4H)
+	}
+	if f.Service != "" {
+		add("service_name = ?", f.Service)
+	}
+	if f.Port != 0 {
+		add("server_port = ?", f.Port)
+	}
+	if f.Method != "" {
+		add("method = ?", strings.ToUpper(f.Method))
+	}
+	if f.Path != "" {
+		add("path = ?", f.Path)
+	}
+	if f.PathPrefix != "" {
+		add(`path LIKE ? ESCAPE '\'`, likeEscaper.Replace(f.PathPrefix)+"%")
+	}
+	if f.Status != 0 {
+		add("response_status = ?", f.Status)
+	}
+	if f.Country != "" {
+		add("country = ?", strings.ToUpper(f.Country))
+	}
+	if f.Tag != "" {
+		add("(',' || tags || ',') LIKE ?", "%,"+f.Tag+",%")
+	}
+	if !f.Since.IsZero() {
+		add("timestamp >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("timestamp < ?", f.Until)
+	}
+	if f.Cursor != 0 {
+		if f.Order == OrderOldest {
+			add("id > ?", f.Cursor)
+		} else {
+			add("id < ?", f.Cursor)
+		}
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Query returns the logged requests matching a filter, in its order
+func (rl *RequestLogger) Query(f LogFilter) ([]RequestLog, error) {
+	where, args := f.where()
+	order := "DESC"
+	if f.Order == OrderOldest {
+		order = "ASC"
+	}
+	query := `
+		SELECT id, timestamp, source_ip, source_port, ip_version, fingerprint, ja4_r, ja4_o, ja3_fingerprint, ja4h,
+			server_port, service_name, service_type,
+			method, path, protocol, COALESCE(host, ''), COALESCE(user_agent, ''),
+			headers, COALESCE(body, ''), raw_request,
+			response_status, COALESCE(response_template, ''), malformed, protocol_guess, scheme, alpn, tls_version, tls_cipher, client_hello_hash, canary, variant,
+			COALESCE(session_id, 0), country, asn, tor, datacenter, proxy, scanner, tags, COALESCE(config_id, 0)
+		FROM request_logs` + where + `
+		ORDER BY id ` + order
+	if f.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	} else if f.Offset > 0 {
+		query += " LIMIT -1 OFFSET ?"
+		args = append(args, f.Offset)
+	}
+
+	rows, err := rl.db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query request logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := make([]RequestLog, 0)
+	for rows.Next() {
+		var l RequestLog
+		var tags string
+		if err := rows.Scan(&l.ID, &l.Timestamp, &l.SourceIP, &l.SourcePort, &l.IPVersion,
+			&l.JA4Fingerprint, &l.JA4R, &l.JA4O, &l.JA3Fingerprint, &l.JA4H,
+			&l.ServerPort, &l.ServiceName, &l.ServiceType,
+			&l.Method, &l.Path, &l.Protocol, &l.Host, &l.UserAgent,
+			&l.Headers, &l.Body, &l.RawRequest,
+			&l.ResponseStatus, &l.ResponseTemplate, &l.Malformed, &l.ProtocolGuess, &l.Scheme, &l.ALPN, &l.TLSVersion, &l.TLSCipher, &l.ClientHelloHash, &l.Canary, &l.Variant,
+			&l.SessionID, &l.Country, &l.ASN, &l.Flags.Tor, &l.Flags.Datacenter, &l.Flags.Proxy,
+			&l.Scanner, &tags, &l.ConfigID); err != nil {
+			return nil, fmt.Errorf("failed to scan request log: %w", err)
+		}
+		l.Tags = make([]string, 0)
+		if tags != "" {
+			l.Tags = strings.Split(tags, ",")
+		}
+		logs = append(logs, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate request logs: %w", err)
+	}
+
+	return logs, nil
+}
+
+// PathCount is how often a path was requested in a window
+type PathCount struct {
+	Path     string `json:"path"`
+	Requests int    `json:"requests"`
+	Sources  int    `json:"sources"`
+}
+
+// GetTopPaths returns the paths requested most often since the given time,
+// optionally on one service, with the number of distinct source IPs each was
+// requested from. A limit of 0 returns all of them.
+func (rl *RequestLogger) GetTopPaths(since time.Time, service string, limit int) ([]PathCount, error) {
+	query := `
+		SELECT path, COUNT(*) AS requests, COUNT(DISTINCT source_ip)
+		FROM request_logs
+		WHERE timestamp >= ?
+	`
+	args := []any{since}
+	if service != "" {
+		query += " AND service_name = ?"
+		args = append(args, service)
+	}
+	query += " GROUP BY path ORDER BY requests DESC, path"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := rl.db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query paths: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]PathCount, 0)
+	for rows.Next() {
+		var c PathCount
+		if err := rows.Scan(&c.Path, &c.Requests, &c.Sources); err != nil {
+			return nil, fmt.Errorf("failed to scan path: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate paths: %w", err)
+	}
+
+	return counts, nil
+}
+
+// ServiceActivity summarizes the requests a service answered in a window
+type ServiceActivity struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Requests  int       `json:"requests"`
+	Sources   int       `json:"sources"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// GetServiceActivity returns the requests each service answered since the
+// given time, busiest first
+func (rl *RequestLogger) GetServiceActivity(since time.Time) ([]ServiceActivity, error) {
+	rows, err := rl.db.conn.Query(`
+		SELECT service_name, service_type, COUNT(*) AS requests, COUNT(DISTINCT source_ip),
+			MIN(timestamp), MAX(timestamp)
+		FROM request_logs
+		WHERE timestamp >= ?
+		GROUP BY service_name, service_type
+		ORDER BY requests DESC, service_name
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query services: %w", err)
+	}
+	defer rows.Close()
+
+	services := make([]ServiceActivity, 0)
+	for rows.Next() {
+		var s ServiceActivity
+		var first, last string
+		if err := rows.Scan(&s.Name, &s.Type, &s.Requests, &s.Sources, &first, &last); err != nil {
+			return nil, fmt.Errorf("failed to scan service: %w", err)
+		}
+		s.FirstSeen = parseTimestamp(first)
+		s.LastSeen = parseTimestamp(last)
+		services = append(services, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate services: %w", err)
+	}
+
+	return services, nil
+}
+
+// SourceActivity summarizes the requests a source IP sent in a window
+type SourceActivity struct {
+	SourceIP  string    `json:"source_ip"`
+	Country   string    `json:"country"`
+	Requests  int       `json:"requests"`
+	Services  int       `json:"services"`
+	Paths     int       `json:"paths"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// GetTopSources returns the source IPs that sent the most requests since the
+// given time, with the number of distinct services and paths each reached. A
+// limit of 0 returns all of them.
+func (rl *RequestLogger) GetTopSources(since time.Time, limit int) ([]SourceActivity, error) {
+	query := `
+		SELECT source_ip, MAX(country), COUNT(*) AS requests, COUNT(DISTINCT service_name),
+			COUNT(DISTINCT path), MIN(timestamp), MAX(timestamp)
+		FROM request_logs
+		WHERE timestamp >= ?
+		GROUP BY source_ip
+		ORDER BY requests DESC, source_ip
+	`
+	args := []any{since}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := rl.db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sources: %w", err)
+	}
+	defer rows.Close()
+
+	sources := make([]SourceActivity, 0)
+	for rows.Next() {
+		var s SourceActivity
+		var first, last string
+		if err := rows.Scan(&s.SourceIP, &s.Country, &s.Requests, &s.Services, &s.Paths, &first, &last); err != nil {
+			return nil, fmt.Errorf("failed to scan source: %w", err)
+		}
+		s.FirstSeen = parseTimestamp(first)
+		s.LastSeen = parseTimestamp(last)
+		sources = append(sources, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sources: %w", err)
+	}
+
+	return sources, nil
+}
+
+// parseTimestamp parses a timestamp as the driver stores it. Aggregates of
+// DATETIME columns are returned as text rather than converted to times.
+// PostgreSQL returns times, which database/sql formats as RFC 3339.
+func parseTimestamp(s string) time.Time {
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t
+		}
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t
+	}
+	return time.Time{}
+}
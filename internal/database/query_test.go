@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+func TestQuery(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	logger := NewRequestLogger(db)
+	send := func(ip, ja4, service, path string, status int) {
+		r := httptest.NewRequest("GET", path, nil)
+		r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &ja4))
+		r.RemoteAddr = ip + ":40000"
+		if err := logger.LogRequest(r, 80, service, service, status, "", nil); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+
+	send("203.0.113.7", "t13d1516h2_8daaf6152771_e5627efa2ab1", "nginx", "/.env", 404)
+	send("203.0.113.7", "t13d1516h2_8daaf6152771_e5627efa2ab1", "nginx", "/.git/config", 404)
+	send("198.51.100.9", "", "wordpress", "/.env", 404)
+	send("198.51.100.9", "", "wordpress", "/wp-login.php", 200)
+
+	since := time.Now().Add(-time.Hour)
+
+	logs, err := logger.Query(LogFilter{SourceIP: "203.0.113.7", JA4: "t13d1516h2_8daaf6152771_e5627efa2ab1"})
+	if err != nil {
+		t.Fatalf("Failed to query logs: %v", err)
+	}
+	if len(logs) != 2 || logs[0].Path != "/.git/config" || logs[0].ServiceName != "nginx" {
+		t.Fatalf("Expected the two nginx requests newest first, got %+v", logs)
+	}
+
+	logs, _ = logger.Query(LogFilter{Status: 404, Since: since, Limit: 1, Offset: 2})
+	if len(logs) != 1 || logs[0].Path != "/.env" || logs[0].SourceIP != "203.0.113.7" {
+		t.Fatalf("Expected the third newest 404, got %+v", logs)
+	}
+
+	// Keyset pages pick up after the cursor in either order
+	logs, _ = logger.Query(LogFilter{Port: 80, PathPrefix: "/.", Order: OrderOldest, Limit: 2})
+	if len(logs) != 2 || logs[0].Path != "/.env" || logs[1].Path != "/.git/config" {
+		t.Fatalf("Expected the first two dotfile requests oldest first, got %+v", logs)
+	}
+	logs, _ = logger.Query(LogFilter{PathPrefix: "/.", Order: OrderOldest, Cursor: logs[1].ID, Limit: 2})
+	if len(logs) != 1 || logs[0].ServiceName != "wordpress" {
+		t.Fatalf("Expected the last dotfile request on the next page, got %+v", logs)
+	}
+	logs, _ = logger.Query(LogFilter{Cursor: logs[0].ID})
+	if len(logs) != 2 || logs[0].Path != "/.git/config" {
+		t.Fatalf("Expected the requests before the cursor newest first, got %+v", logs)
+	}
+	if logs, _ = logger.Query(LogFilter{PathPrefix: "/wp_"}); len(logs) != 0 {
+		t.Fatalf("Expected wildcards in the prefix to match literally, got %+v", logs)
+	}
+
+	paths, err := logger.GetTopPaths(since, "", 1)
+	if err != nil {
+		t.Fatalf("Failed to get top paths: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != (PathCount{Path: "/.env", Requests: 2, Sources: 2}) {
+		t.Fatalf("Expected /.env from 2 sources, got %+v", paths)
+	}
+
+	services, err := logger.GetServiceActivity(since)
+	if err != nil {
+		t.Fatalf("Failed to get services: %v", err)
+	}
+	if len(services) != 2 || services[0].Name != "nginx" || services[0].Requests != 2 || services[0].Sources != 1 {
+		t.Fatalf("Expected nginx and wordpress with 2 requests each, got %+v", services)
+	}
+	if services[0].FirstSeen.IsZero() || services[0].LastSeen.Before(services[0].FirstSeen) {
+		t.Fatalf("Expected first and last seen times, got %+v", services[0])
+	}
+
+	sources, err := logger.GetTopSources(since, 0)
+	if err != nil {
+		t.Fatalf("Failed to get sources: %v", err)
+	}
+	if len(sources) != 2 || sources[0].SourceIP != "198.51.100.9" || sources[0].Requests != 2 || sources[0].Paths != 2 {
+		t.Fatalf("Expected both sources with 2 requests each, got %+v", sources)
+	}
+
+	logs, _ = logger.Query(LogFilter{Path: "/.git/config"})
+	logs, _ = logger.Query(LogFilter{ID: logs[0].ID})
+	if len(logs) != 1 || logs[0].Path != "/.git/config" {
+		t.Fatalf("Expected the request with the ID, got %+v", logs)
+	}
+}
+
+func TestQuery_TLSNegotiation(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	logger := NewRequestLogger(db)
+	ja4 := "t13d1516h2_8daaf6152771_e5627efa2ab1"
+	for _, state := range []*tls.ConnectionState{
+		nil,
+		{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256, NegotiatedProtocol: "h2"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &ja4))
+		r.TLS = state
+		if err := logger.LogRequest(r, 443, "nginx", "nginx", 200, "", nil); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+
+	logs, err := logger.Query(LogFilter{Order: OrderOldest})
+	if err != nil {
+		t.Fatalf("Failed to query logs: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 logs, got %d", len(logs))
+	}
+	if l := logs[0]; l.ALPN != "" || l.TLSVersion != "" || l.TLSCipher != "" {
+		t.Fatalf("Expected no TLS details for a plaintext request, got %+v", l)
+	}
+	if l := logs[1]; l.ALPN != "h2" || l.TLSVersion != "TLS 1.3" || l.TLSCipher != "TLS_AES_128_GCM_SHA256" {
+		t.Fatalf("Expected h2 over TLS 1.3 with TLS_AES_128_GCM_SHA256, got %q %q %q", l.ALPN, l.TLSVersion, l.TLSCipher)
+	}
+}
@@ -0,0 +1,248 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// reportTimeout bounds how long a report may run
+	reportTimeout = 30 * time.Second
+
+	// MaxReportRows bounds the rows a report returns
+	MaxReportRows = 10000
+)
+
+// sqliteRecursive is the authorizer action of a recursive common table
+// expression, which the driver does not export
+const sqliteRecursive = 33
+
+// reportActions are the only operations a report may perform: selecting,
+// reading columns, and calling functions
+var reportActions = map[int]bool{
+	sqlite3.SQLITE_SELECT:   true,
+	sqlite3.SQLITE_READ:     true,
+	sqlite3.SQLITE_FUNCTION: true,
+	sqliteRecursive:         true,
+}
+
+// ReportResult is the rows a report returned
+type ReportResult struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+
+	// Truncated is set when the report returned more than MaxReportRows
+	Truncated bool `json:"truncated"`
+}
+
+// reportConn is what a report runs on
+type reportConn interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// readOnly runs fn on a connection that may only read, whatever statements
+// it is given
+func (rl *RequestLogger) readOnly(ctx context.Context, fn func(conn reportConn) error) error {
+	if rl.db.conn.dialect.name() == config.DatabaseDriverPostgres {
+		return rl.readOnlyTx(ctx, fn)
+	}
+
+	conn, err := rl.db.conn.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	// SQLite's authorizer restricts the connection, which is discarded
+	// afterwards rather than returned to the pool
+	defer conn.Close()
+	defer conn.Raw(func(any) error { return driver.ErrBadConn })
+
+	err = conn.Raw(func(dc any) error {
+		c, ok := dc.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", dc)
+		}
+		c.RegisterAuthorizer(func(action int, _, _, _ string) int {
+			if reportActions[action] {
+				return sqlite3.SQLITE_OK
+			}
+			return sqlite3.SQLITE_DENY
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restrict connection: %w", err)
+	}
+	return fn(conn)
+}
+
+// readOnlyTx runs fn in a read only transaction that is rolled back
+// afterwards, with the server bounding its statements by reportTimeout
+func (rl *RequestLogger) readOnlyTx(ctx context.Context, fn func(conn reportConn) error) error {
+	tx, err := rl.db.conn.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin read only transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	timeout := fmt.Sprintf("SET LOCAL statement_timeout = %d", reportTimeout.Milliseconds())
+	if _, err := tx.ExecContext(ctx, timeout); err != nil {
+		return fmt.Errorf("failed to restrict transaction: %w", err)
+	}
+	return fn(tx)
+}
+
+// CheckReport checks that a report's query compiles and only reads
+func (rl *RequestLogger) CheckReport(query string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+
+	query, _ = rl.db.conn.dialect.bindNamed(query, nil)
+	return rl.readOnly(ctx, func(conn reportConn) error {
+		stmt, err := conn.PrepareContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("invalid query: %w", err)
+		}
+		return stmt.Close()
+	})
+}
+
+// RunReport runs a report's query with its arguments, typically sql.Named
+// parameters, returning at most MaxReportRows rows
+func (rl *RequestLogger) RunReport(ctx context.Context, query string, args ...any) (*ReportResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, reportTimeout)
+	defer cancel()
+
+	query, args = rl.db.conn.dialect.bindNamed(query, args)
+	result := &ReportResult{Rows: make([][]any, 0)}
+	err := rl.readOnly(ctx, func(conn reportConn) error {
+		rows, err := conn.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to run report: %w", err)
+		}
+		defer rows.Close()
+
+		if result.Columns, err = rows.Columns(); err != nil {
+			return fmt.Errorf("failed to get report columns: %w", err)
+		}
+		for rows.Next() {
+			if len(result.Rows) == MaxReportRows {
+				result.Truncated = true
+				break
+			}
+			row := make([]any, len(result.Columns))
+			ptrs := make([]any, len(row))
+			for i := range row {
+				ptrs[i] = &row[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				return fmt.Errorf("failed to scan report row: %w", err)
+			}
+			for i, v := range row {
+				if b, ok := v.([]byte); ok {
+					row[i] = string(b)
+				}
+			}
+			result.Rows = append(result.Rows, row)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to iterate report rows: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SaveReport saves a report, replacing any saved under the same name
+func (rl *RequestLogger) SaveReport(r *config.ReportConfig) error {
+	params := r.Params
+	if params == nil {
+		params = []config.ReportParam{}
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode report params: %w", err)
+	}
+
+	now := time.Now()
+	_, err = rl.db.conn.Exec(`
+		INSERT INTO saved_reports (name, description, query, params, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			description = excluded.description, query = excluded.query,
+			params = excluded.params, updated_at = excluded.updated_at
+	`, r.Name, r.Description, r.Query, string(paramsJSON), now, now)
+	if err != nil {
+		return fmt.Errorf("failed to save report: %w", err)
+	}
+	return nil
+}
+
+// DeleteReport deletes a saved report, returning ErrNotFound if there is
+// none of that name
+func (rl *RequestLogger) DeleteReport(name string) error {
+	result, err := rl.db.conn.Exec(`DELETE FROM saved_reports WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete report: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetReports returns the saved reports, by name
+func (rl *RequestLogger) GetReports() ([]config.ReportConfig, error) {
+	rows, err := rl.db.conn.Query(`SELECT name, description, query, params FROM saved_reports ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := make([]config.ReportConfig, 0)
+	for rows.Next() {
+		var r config.ReportConfig
+		var paramsJSON string
+		if err := rows.Scan(&r.Name, &r.Description, &r.Query, &paramsJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan report: %w", err)
+		}
+		if err := json.Unmarshal([]byte(paramsJSON), &r.Params); err != nil {
+			return nil, fmt.Errorf("failed to decode report params: %w", err)
+		}
+		reports = append(reports, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate reports: %w", err)
+	}
+
+	return reports, nil
+}
+
+// GetReport returns a saved report, or ErrNotFound if there is none of that
+// name
+func (rl *RequestLogger) GetReport(name string) (*config.ReportConfig, error) {
+	var r config.ReportConfig
+	var paramsJSON string
+	err := rl.db.conn.QueryRow(`SELECT name, description, query, params FROM saved_reports WHERE name = ?`, name).
+		Scan(&r.Name, &r.Description, &r.Query, &paramsJSON)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query report: %w", err)
+	}
+	if err := json.Unmarshal([]byte(paramsJSON), &r.Params); err != nil {
+		return nil, fmt.Errorf("failed to decode report params: %w", err)
+	}
+	return &r, nil
+}
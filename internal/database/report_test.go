@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+func TestReports(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	logger := NewRequestLogger(db)
+	send := func(path string) error {
+		var ja4 string
+		r := httptest.NewRequest("GET", path, nil)
+		r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &ja4))
+		r.RemoteAddr = "203.0.113.7:40000"
+		return logger.LogRequest(r, 80, "nginx", "nginx", 404, "", nil)
+	}
+	for _, path := range []string{"/.env", "/.env", "/wp-login.php"} {
+		if err := send(path); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	query := `SELECT path, COUNT(*) AS hits FROM request_logs WHERE source_ip = :ip GROUP BY path ORDER BY hits DESC`
+	result, err := logger.RunReport(ctx, query, sql.Named("ip", "203.0.113.7"))
+	if err != nil {
+		t.Fatalf("Failed to run report: %v", err)
+	}
+	if len(result.Columns) != 2 || result.Columns[1] != "hits" {
+		t.Fatalf("Expected path and hits columns, got %v", result.Columns)
+	}
+	if len(result.Rows) != 2 || result.Rows[0][0] != "/.env" || result.Rows[0][1] != int64(2) {
+		t.Fatalf("Expected /.env twice first, got %v", result.Rows)
+	}
+
+	// Reports may only read, whatever statements they smuggle in
+	writes := []string{
+		`DELETE FROM request_logs`,
+		`SELECT 1; DELETE FROM request_logs`,
+		`ATTACH DATABASE 'other.db' AS other`,
+		`PRAGMA query_only = OFF`,
+	}
+	for _, q := range writes {
+		if _, err := logger.RunReport(ctx, q); err == nil {
+			t.Fatalf("Expected %q to be rejected", q)
+		}
+	}
+	if err := logger.CheckReport(writes[0]); err == nil {
+		t.Fatalf("Expected a write to fail its check")
+	}
+	if logs, _ := logger.Query(LogFilter{}); len(logs) != 3 {
+		t.Fatalf("Expected reports to leave the logs alone, got %d", len(logs))
+	}
+	if err := logger.CheckReport(query); err != nil {
+		t.Fatalf("Expected the report to pass its check, got %v", err)
+	}
+
+	// The connections reports ran on are not reused for writes
+	if err := send("/"); err != nil {
+		t.Fatalf("Expected logging to work after reports ran, got %v", err)
+	}
+
+	report := &config.ReportConfig{
+		Name:   "paths_by_ip",
+		Query:  query,
+		Params: []config.ReportParam{{Name: "ip", Required: true}},
+	}
+	if err := logger.SaveReport(report); err != nil {
+		t.Fatalf("Failed to save report: %v", err)
+	}
+	report.Description = "Paths a source requested"
+	if err := logger.SaveReport(report); err != nil {
+		t.Fatalf("Failed to replace report: %v", err)
+	}
+	saved, err := logger.GetReport("paths_by_ip")
+	if err != nil || saved.Description != report.Description || len(saved.Params) != 1 || !saved.Params[0].Required {
+		t.Fatalf("Expected the replaced report, got %+v, %v", saved, err)
+	}
+	if reports, _ := logger.GetReports(); len(reports) != 1 {
+		t.Fatalf("Expected one saved report, got %+v", reports)
+	}
+
+	if err := logger.DeleteReport("paths_by_ip"); err != nil {
+		t.Fatalf("Failed to delete report: %v", err)
+	}
+	if _, err := logger.GetReport("paths_by_ip"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected the report to be gone, got %v", err)
+	}
+	if err := logger.DeleteReport("paths_by_ip"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected deleting a missing report to fail, got %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package database
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// pruneBatchSize is how many request logs are archived and deleted per
+// transaction, so pruning never holds the database for long
+const pruneBatchSize = 1000
+
+// sizeSampleRows is how many of the newest request logs PostgreSQL measures
+// to estimate the size of a row
+const sizeSampleRows = 1000
+
+// Pruned is what a pass of the pruner removed
+type Pruned struct {
+	Rows int64
+
+	// Archive is the file the pruned logs were written to, if any
+	Archive string
+}
+
+// StartRetention prunes request logs on the configured interval, starting
+// now, and vacuums the database on its own interval until ctx is done
+func (rl *RequestLogger) StartRetention(ctx context.Context, cfg *config.RetentionConfig) {
+	ticker := time.NewTicker(cfg.GetInterval())
+	defer ticker.Stop()
+
+	vacuumed := time.Now()
+	for {
+		pruned, err := rl.Prune(ctx, cfg, time.Now())
+		if err != nil {
+			databaseLog.Warn("failed to prune request logs", "err", err)
+		} else if pruned.Rows > 0 {
+			databaseLog.Info("pruned request logs", "rows", pruned.Rows, "archive", pruned.Archive)
+		}
+
+		if interval := cfg.GetVacuumInterval(); interval > 0 && time.Since(vacuumed) >= interval {
+			if err := rl.Vacuum(ctx); err != nil {
+				databaseLog.Warn("failed to vacuum database", "err", err)
+			}
+			vacuumed = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune deletes the request logs past the retention limits as of now,
+// oldest first, along with their WebSocket frames and credentials and the
+// ClientHellos no longer sent by any logged request. Hourly rollups are
+// kept, so activity charts still cover pruned logs.
+func (rl *RequestLogger) Prune(ctx context.Context, cfg *config.RetentionConfig, now time.Time) (Pruned, error) {
+	var pruned Pruned
+	upTo, err := rl.pruneBound(ctx, cfg, now)
+	if err != nil || upTo == 0 {
+		return pruned, err
+	}
+
+	var archive *logArchive
+	if cfg.Archive != "" {
+		archive, err = createLogArchive(cfg.Archive, now)
+		if err != nil {
+			return pruned, err
+		}
+		pruned.Archive = archive.path
+		defer archive.close()
+	}
+
+	var cursor int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return pruned, err
+		}
+
+		// Archive each batch before deleting it, so logs pruned midway
+		// through a failure are in the archive
+		last := upTo
+		if archive != nil {
+			logs, err := rl.Query(LogFilter{Order: OrderOldest, Cursor: cursor, Limit: pruneBatchSize})
+			if err != nil {
+				return pruned, err
+			}
+			for i, l := range logs {
+				if l.ID > upTo {
+					logs = logs[:i]
+					break
+				}
+			}
+			if len(logs) == 0 {
+				break
+			}
+			if err := archive.write(logs); err != nil {
+				return pruned, err
+			}
+			last = logs[len(logs)-1].ID
+			cursor = last
+		}
+
+		n, err := rl.deleteLogs(ctx, last)
+		if err != nil {
+			return pruned, err
+		}
+		pruned.Rows += n
+		if n == 0 || (archive == nil && n < pruneBatchSize) {
+			break
+		}
+	}
+
+	if archive != nil {
+		if err := archive.close(); err != nil {
+			return pruned, err
+		}
+	}
+
+	_, err = rl.db.conn.ExecContext(ctx, `
+		DELETE FROM client_hellos
+		WHERE NOT EXISTS (SELECT 1 FROM request_logs WHERE request_logs.client_hello_hash = client_hellos.hash)
+	`)
+	if err != nil {
+		return pruned, fmt.Errorf("failed to delete unused client hellos: %w", err)
+	}
+	return pruned, nil
+}
+
+// pruneBound returns the ID of the newest request log past a retention
+// limit, or 0 if none is
+func (rl *RequestLogger) pruneBound(ctx context.Context, cfg *config.RetentionConfig, now time.Time) (int64, error) {
+	var upTo int64
+	if cfg.MaxAge > 0 {
+		var id sql.NullInt64
+		err := rl.db.conn.QueryRowContext(ctx, `SELECT MAX(id) FROM request_logs WHERE timestamp < ?`, now.Add(-cfg.MaxAge)).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to find expired request logs: %w", err)
+		}
+		upTo = max(upTo, id.Int64)
+	}
+	if cfg.MaxRows == 0 && cfg.MaxSize == 0 {
+		return upTo, nil
+	}
+
+	var count int64
+	if err := rl.db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM request_logs`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count request logs: %w", err)
+	}
+	var excess int64
+	if cfg.MaxRows > 0 {
+		excess = count - cfg.MaxRows
+	}
+	if cfg.MaxSize > 0 && count > 0 {
+		size, err := rl.usedSize(ctx, count)
+		if err != nil {
+			return 0, err
+		}
+		if size > cfg.MaxSize {
+			// Rows are assumed to take an even share of the size
+			perRow := max(size/count, 1)
+			excess = max(excess, min(count, (size-cfg.MaxSize+perRow-1)/perRow))
+		}
+	}
+	if excess <= 0 {
+		return upTo, nil
+	}
+
+	var id int64
+	err := rl.db.conn.QueryRowContext(ctx, `SELECT id FROM request_logs ORDER BY id LIMIT 1 OFFSET ?`, excess-1).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find excess request logs: %w", err)
+	}
+	return max(upTo, id), nil
+}
+
+// usedSize returns the bytes the database uses. SQLite counts the pages in
+// use, so space freed by pruning counts at once rather than after a vacuum.
+// PostgreSQL files do not shrink as rows are deleted, so the size of its
+// count request logs is estimated from the newest ones instead.
+func (rl *RequestLogger) usedSize(ctx context.Context, count int64) (int64, error) {
+	var size int64
+	var err error
+	if rl.db.conn.dialect.name() == config.DatabaseDriverPostgres {
+		var avg sql.NullFloat64
+		err = rl.db.conn.QueryRowContext(ctx, `
+			SELECT AVG(pg_column_size(r.*))
+			FROM (SELECT * FROM request_logs ORDER BY id DESC LIMIT ?) r
+		`, sizeSampleRows).Scan(&avg)
+		size = int64(avg.Float64 * float64(count))
+	} else {
+		err = rl.db.conn.QueryRowContext(ctx, `
+			SELECT (p.page_count - f.freelist_count) * s.page_size
+			FROM pragma_page_count() p, pragma_freelist_count() f, pragma_page_size() s
+		`).Scan(&size)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure database size: %w", err)
+	}
+	return size, nil
+}
+
+// deleteLogs deletes a batch of the request logs up to an ID, with their
+// WebSocket frames and credentials, returning how many were deleted
+func (rl *RequestLogger) deleteLogs(ctx context.Context, upTo int64) (int64, error) {
+	tx, err := rl.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var last sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+		SELECT MAX(id) FROM (SELECT id FROM request_logs WHERE id <= ? ORDER BY id LIMIT ?) AS batch
+	`, upTo, pruneBatchSize).Scan(&last)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find request logs to delete: %w", err)
+	}
+	if !last.Valid {
+		return 0, nil
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM request_logs WHERE id <= ?`, last.Int64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete request logs: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted request logs: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM websocket_messages WHERE request_id <= ?`, last.Int64); err != nil {
+		return 0, fmt.Errorf("failed to delete websocket messages: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM credentials WHERE request_id <= ?`, last.Int64); err != nil {
+		return 0, fmt.Errorf("failed to delete credentials: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return n, nil
+}
+
+// Vacuum rebuilds the database to return the space of deleted rows to the
+// filesystem on SQLite, and to mark it for reuse on PostgreSQL
+func (rl *RequestLogger) Vacuum(ctx context.Context) error {
+	if _, err := rl.db.conn.ExecContext(ctx, `VACUUM`); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
+
+// logArchive is a gzipped JSONL file of pruned request logs
+type logArchive struct {
+	path   string
+	file   *os.File
+	gz     *gzip.Writer
+	buf    *bufio.Writer
+	closed bool
+}
+
+// createLogArchive creates the archive of a pruning pass in dir
+func createLogArchive(dir string, now time.Time) (*logArchive, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	path := filepath.Join(dir, "request_logs-"+now.UTC().Format("20060102T150405Z")+".jsonl.gz")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+	gz := gzip.NewWriter(f)
+	return &logArchive{path: path, file: f, gz: gz, buf: bufio.NewWriter(gz)}, nil
+}
+
+// write appends request logs to the archive, flushed through to the file
+func (a *logArchive) write(logs []RequestLog) error {
+	enc := json.NewEncoder(a.buf)
+	for i := range logs {
+		if err := enc.Encode(&logs[i]); err != nil {
+			return fmt.Errorf("failed to archive request log: %w", err)
+		}
+	}
+	if err := a.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := a.gz.Flush(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// close finishes the archive, and may be called again to no effect
+func (a *logArchive) close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	if err := a.gz.Close(); err != nil {
+		a.file.Close()
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := a.file.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+func TestPrune(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	logger := NewRequestLogger(db)
+	for _, path := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		ja4 := ""
+		r := httptest.NewRequest("GET", path, nil)
+		r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &ja4))
+		r.RemoteAddr = "203.0.113.7:40000"
+		if err := logger.LogRequest(r, 80, "nginx", "nginx", 404, "", nil); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+	ctx := context.Background()
+
+	// Nothing is old enough to prune yet
+	pruned, err := logger.Prune(ctx, &config.RetentionConfig{MaxAge: time.Hour}, time.Now())
+	if err != nil || pruned.Rows != 0 {
+		t.Fatalf("Expected nothing pruned by age, got %+v, %v", pruned, err)
+	}
+
+	// The oldest logs past the row limit are archived, then deleted
+	dir := filepath.Join(t.TempDir(), "archive")
+	pruned, err = logger.Prune(ctx, &config.RetentionConfig{MaxRows: 2, Archive: dir}, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	if pruned.Rows != 3 || filepath.Dir(pruned.Archive) != dir {
+		t.Fatalf("Expected 3 logs archived in %s, got %+v", dir, pruned)
+	}
+	logs, _ := logger.Query(LogFilter{Order: OrderOldest})
+	if len(logs) != 2 || logs[0].Path != "/d" || logs[1].Path != "/e" {
+		t.Fatalf("Expected the newest two logs kept, got %+v", logs)
+	}
+
+	f, err := os.Open(pruned.Archive)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	var paths []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var l RequestLog
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			t.Fatalf("Failed to decode archived log: %v", err)
+		}
+		paths = append(paths, l.Path)
+	}
+	if len(paths) != 3 || paths[0] != "/a" || paths[2] != "/c" {
+		t.Fatalf("Expected the pruned logs archived oldest first, got %v", paths)
+	}
+
+	// The database is well within a terabyte
+	pruned, err = logger.Prune(ctx, &config.RetentionConfig{MaxSize: 1 << 40}, time.Now())
+	if err != nil || pruned.Rows != 0 {
+		t.Fatalf("Expected nothing pruned by size, got %+v, %v", pruned, err)
+	}
+
+	// Everything is past an age limit from the future
+	pruned, err = logger.Prune(ctx, &config.RetentionConfig{MaxAge: time.Hour}, time.Now().Add(2*time.Hour))
+	if err != nil || pruned.Rows != 2 || pruned.Archive != "" {
+		t.Fatalf("Expected the remaining 2 logs pruned by age, got %+v, %v", pruned, err)
+	}
+	if err := logger.Vacuum(ctx); err != nil {
+		t.Fatalf("Failed to vacuum: %v", err)
+	}
+}
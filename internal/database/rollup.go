@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CountryCount is the requests from a country
+type CountryCount struct {
+	Country  string `json:"country"`
+	Requests int    `json:"requests"`
+}
+
+// TagCount is the requests carrying an attack tag
+type TagCount struct {
+	Tag      string `json:"tag"`
+	Requests int    `json:"requests"`
+}
+
+// TimeActivity is when requests arrived, in UTC: by hour of the day, by day
+// of the week indexed by time.Weekday, and by both
+type TimeActivity struct {
+	Requests int        `json:"requests"`
+	Hours    [24]int    `json:"hours"`
+	Weekdays [7]int     `json:"weekdays"`
+	Matrix   [7][24]int `json:"matrix"`
+}
+
+// rollup counts a request into the hourly rollups, under the empty tag and
+// each of its tags
+func (rl *RequestLogger) rollup(ctx context.Context, tx *tx, e *RequestLog) error {
+	bucket := e.Timestamp.Truncate(time.Hour).Unix()
+	seen := map[string]bool{}
+	for _, tag := range append([]string{""}, e.Tags...) {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO request_rollups (bucket, country, tag, requests) VALUES (?, ?, ?, 1)
+			ON CONFLICT(bucket, country, tag) DO UPDATE SET requests = request_rollups.requests + 1
+		`, bucket, e.Country, tag)
+		if err != nil {
+			return fmt.Errorf("failed to update request rollup: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetCountryActivity returns the requests from each country since the given
+// time, most first. If tag is set only requests carrying it are counted.
+func (rl *RequestLogger) GetCountryActivity(since time.Time, tag string) ([]CountryCount, error) {
+	rows, err := rl.db.conn.Query(`
+		SELECT country, SUM(requests) AS total
+		FROM request_rollups
+		WHERE bucket >= ? AND tag = ?
+		GROUP BY country
+		ORDER BY total DESC, country
+	`, since.Truncate(time.Hour).Unix(), tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query country activity: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]CountryCount, 0)
+	for rows.Next() {
+		var c CountryCount
+		if err := rows.Scan(&c.Country, &c.Requests); err != nil {
+			return nil, fmt.Errorf("failed to scan country activity: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate country activity: %w", err)
+	}
+
+	return counts, nil
+}
+
+// GetTimeActivity returns when requests arrived since the given time. If tag
+// is set only requests carrying it are counted.
+func (rl *RequestLogger) GetTimeActivity(since time.Time, tag string) (*TimeActivity, error) {
+	rows, err := rl.db.conn.Query(`
+		SELECT bucket, SUM(requests)
+		FROM request_rollups
+		WHERE bucket >= ? AND tag = ?
+		GROUP BY bucket
+	`, since.Truncate(time.Hour).Unix(), tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query time activity: %w", err)
+	}
+	defer rows.Close()
+
+	activity := &TimeActivity{}
+	for rows.Next() {
+		var bucket int64
+		var requests int
+		if err := rows.Scan(&bucket, &requests); err != nil {
+			return nil, fmt.Errorf("failed to scan time activity: %w", err)
+		}
+		t := time.Unix(bucket, 0).UTC()
+		activity.Requests += requests
+		activity.Hours[t.Hour()] += requests
+		activity.Weekdays[t.Weekday()] += requests
+		activity.Matrix[t.Weekday()][t.Hour()] += requests
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate time activity: %w", err)
+	}
+
+	return activity, nil
+}
+
+// GetTagActivity returns the requests carrying each attack tag since the
+// given time, most first
+func (rl *RequestLogger) GetTagActivity(since time.Time) ([]TagCount, error) {
+	rows, err := rl.db.conn.Query(`
+		SELECT tag, SUM(requests) AS total
+		FROM request_rollups
+		WHERE bucket >= ? AND tag != ''
+		GROUP BY tag
+		ORDER BY total DESC, tag
+	`, since.Truncate(time.Hour).Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tag activity: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]TagCount, 0)
+	for rows.Next() {
+		var c TagCount
+		if err := rows.Scan(&c.Tag, &c.Requests); err != nil {
+			return nil, fmt.Errorf("failed to scan tag activity: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate tag activity: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+func TestRollups(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	logger := NewRequestLogger(db)
+	for _, host := range []string{"example.com", "192.0.2.1", "192.0.2.1"} {
+		ja4 := ""
+		r := httptest.NewRequest("GET", "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &ja4))
+		r.Host = host
+		r.RemoteAddr = "203.0.113.7:40000"
+		if err := logger.LogRequest(r, 80, "nginx", "nginx", 200, "", nil); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+
+	since := time.Now().Add(-time.Hour)
+	tags, err := logger.GetTagActivity(since)
+	if err != nil {
+		t.Fatalf("Failed to get tag activity: %v", err)
+	}
+	if len(tags) != 1 || tags[0].Tag != "host-ip" || tags[0].Requests != 2 {
+		t.Fatalf("Expected 2 requests tagged host-ip, got %+v", tags)
+	}
+
+	countries, err := logger.GetCountryActivity(since, "")
+	if err != nil {
+		t.Fatalf("Failed to get country activity: %v", err)
+	}
+	if len(countries) != 1 || countries[0].Requests != 3 {
+		t.Fatalf("Expected 3 requests from an unknown country, got %+v", countries)
+	}
+
+	times, err := logger.GetTimeActivity(since, "host-ip")
+	if err != nil {
+		t.Fatalf("Failed to get time activity: %v", err)
+	}
+	now := time.Now().UTC()
+	if times.Requests != 2 || times.Hours[now.Hour()] != 2 || times.Matrix[now.Weekday()][now.Hour()] != 2 {
+		t.Fatalf("Expected 2 requests this hour, got %+v", times)
+	}
+}
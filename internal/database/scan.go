@@ -0,0 +1,255 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Scan patterns, judged by the median gap between the first hits on
+// successive ports
+const (
+	// ScanPatternFast is a sweep of ports in quick succession, as SYN
+	// scanners such as masscan and nmap send
+	ScanPatternFast = "fast"
+
+	// ScanPatternSlow is a scan paced out to stay under detection thresholds,
+	// or a source working through services by hand
+	ScanPatternSlow = "slow"
+)
+
+// fastScanGap is the longest median gap between new ports of a fast scan
+const fastScanGap = time.Second
+
+// maxScanPorts bounds the port sequence recorded for a scan event. Ports hit
+// beyond it are still counted.
+const maxScanPorts = 1024
+
+// ScanHit is a port a scanning source hit, and how many milliseconds after
+// the start of the scan it first did
+type ScanHit struct {
+	Port     int   `json:"port"`
+	OffsetMS int64 `json:"offset_ms"`
+}
+
+// ScanEvent is one source hitting several spoofed ports without going silent
+// for longer than the scan window, correlated across listeners
+type ScanEvent struct {
+	ID        int64     `json:"id"`
+	SourceIP  string    `json:"source_ip"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+
+	// Ports are the ports hit in the order first hit, and PortCount how many
+	// there were, including any past the recorded sequence
+	Ports     []ScanHit `json:"ports"`
+	PortCount int       `json:"port_count"`
+
+	// Pattern is ScanPatternFast or ScanPatternSlow, judged by MedianGap
+	// between the first hits on successive ports
+	Pattern   string        `json:"pattern"`
+	MedianGap time.Duration `json:"median_gap"`
+
+	SessionID int64 `json:"session_id"`
+}
+
+// scanTracker follows the ports each source hits, to correlate them into
+// scan events
+type scanTracker struct {
+	minPorts int
+	window   time.Duration
+
+	mu        sync.Mutex
+	sources   map[string]*scanState
+	lastSweep time.Time
+}
+
+// scanState is the ports a source has hit since it last went silent for
+// longer than the window
+type scanState struct {
+	event ScanEvent
+	seen  map[int]bool
+	last  time.Time
+}
+
+// SetScanDetection records a scan event when a source hits minPorts distinct
+// ports without going silent for longer than window. A minPorts below 2
+// disables detection.
+func (rl *RequestLogger) SetScanDetection(minPorts int, window time.Duration) {
+	if minPorts < 2 || window <= 0 {
+		rl.scans = nil
+		return
+	}
+	rl.scans = &scanTracker{
+		minPorts: minPorts,
+		window:   window,
+		sources:  make(map[string]*scanState),
+	}
+}
+
+// trackScan correlates a hit on a port with the source's earlier hits,
+// recording a scan event once it has hit enough ports and updating it as it
+// hits more. The tracker stays locked while the event is saved, so a source
+// hitting ports concurrently cannot record its scan twice.
+func (rl *RequestLogger) trackScan(ctx context.Context, sourceIP string, port int, ts time.Time, sessionID int64) {
+	t := rl.scans
+	if t == nil || port == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ts.Sub(t.lastSweep) > t.window {
+		t.sweep(ts)
+	}
+	st, ok := t.sources[sourceIP]
+	if !ok || ts.Sub(st.last) > t.window {
+		st = &scanState{
+			event: ScanEvent{SourceIP: sourceIP, FirstSeen: ts},
+			seen:  make(map[int]bool),
+		}
+		t.sources[sourceIP] = st
+	}
+	if ts.After(st.last) {
+		st.last = ts
+	}
+	if st.seen[port] {
+		return
+	}
+	st.seen[port] = true
+
+	e := &st.event
+	e.PortCount++
+	if len(e.Ports) < maxScanPorts {
+		e.Ports = append(e.Ports, ScanHit{Port: port, OffsetMS: ts.Sub(e.FirstSeen).Milliseconds()})
+	}
+	e.LastSeen = ts
+	e.SessionID = sessionID
+	e.Pattern, e.MedianGap = scanPattern(e.Ports)
+	if e.PortCount < t.minPorts {
+		return
+	}
+
+	created := e.ID == 0
+	if err := rl.saveScanEvent(ctx, e); err != nil {
+		databaseLog.Error("failed to record scan event", "source", sourceIP, "err", err)
+		return
+	}
+	if created {
+		databaseLog.Info("scan detected", "source", sourceIP, "ports", e.PortCount, "pattern", e.Pattern)
+	}
+}
+
+// sweep forgets sources that have gone silent for longer than the window
+func (t *scanTracker) sweep(now time.Time) {
+	t.lastSweep = now
+	for source, st := range t.sources {
+		if now.Sub(st.last) > t.window {
+			delete(t.sources, source)
+		}
+	}
+}
+
+// scanPattern judges how a scan was paced from the gaps between the first
+// hits on successive ports
+func scanPattern(hits []ScanHit) (string, time.Duration) {
+	if len(hits) < 2 {
+		return "", 0
+	}
+	gaps := make([]time.Duration, 0, len(hits)-1)
+	for i := 1; i < len(hits); i++ {
+		gaps = append(gaps, time.Duration(hits[i].OffsetMS-hits[i-1].OffsetMS)*time.Millisecond)
+	}
+	slices.Sort(gaps)
+	median := gaps[len(gaps)/2]
+	if len(gaps)%2 == 0 {
+		median = (gaps[len(gaps)/2-1] + median) / 2
+	}
+	if median <= fastScanGap {
+		return ScanPatternFast, median
+	}
+	return ScanPatternSlow, median
+}
+
+// saveScanEvent inserts a scan event, setting its ID, or updates it if it
+// already has one
+func (rl *RequestLogger) saveScanEvent(ctx context.Context, e *ScanEvent) error {
+	portsJSON, err := json.Marshal(e.Ports)
+	if err != nil {
+		return fmt.Errorf("failed to encode scan ports: %w", err)
+	}
+
+	if e.ID != 0 {
+		_, err := rl.db.conn.ExecContext(ctx, `
+			UPDATE scan_events
+			SET last_seen = ?, ports = ?, port_count = ?, pattern = ?, median_gap_ms = ?, session_id = ?
+			WHERE id = ?
+		`, e.LastSeen, string(portsJSON), e.PortCount, e.Pattern, e.MedianGap.Milliseconds(), e.SessionID, e.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update scan event: %w", err)
+		}
+		return nil
+	}
+
+	e.ID, err = rl.db.conn.InsertContext(ctx, `
+		INSERT INTO scan_events (
+			source_ip, first_seen, last_seen, ports, port_count, pattern, median_gap_ms, session_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.SourceIP, e.FirstSeen, e.LastSeen, string(portsJSON), e.PortCount, e.Pattern,
+		e.MedianGap.Milliseconds(), e.SessionID)
+	if err != nil {
+		return fmt.Errorf("failed to insert scan event: %w", err)
+	}
+	return nil
+}
+
+// GetScanEvents returns scan events active since the given time, most recent
+// first, keeping only those of the given pattern if one is set. A limit of 0
+// returns all of them.
+func (rl *RequestLogger) GetScanEvents(since time.Time, pattern string, limit int) ([]ScanEvent, error) {
+	query := `
+		SELECT id, source_ip, first_seen, last_seen, ports, port_count, pattern, median_gap_ms, session_id
+		FROM scan_events
+		WHERE last_seen >= ?
+	`
+	args := []any{since}
+	if pattern != "" {
+		query += " AND pattern = ?"
+		args = append(args, pattern)
+	}
+	query += " ORDER BY last_seen DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := rl.db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scan events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]ScanEvent, 0)
+	for rows.Next() {
+		var e ScanEvent
+		var portsJSON string
+		var gapMS int64
+		if err := rows.Scan(&e.ID, &e.SourceIP, &e.FirstSeen, &e.LastSeen, &portsJSON, &e.PortCount,
+			&e.Pattern, &gapMS, &e.SessionID); err != nil {
+			return nil, fmt.Errorf("failed to scan scan event: %w", err)
+		}
+		if err := json.Unmarshal([]byte(portsJSON), &e.Ports); err != nil {
+			return nil, fmt.Errorf("failed to decode scan ports: %w", err)
+		}
+		e.MedianGap = time.Duration(gapMS) * time.Millisecond
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate scan events: %w", err)
+	}
+
+	return events, nil
+}
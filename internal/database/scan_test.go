@@ -0,0 +1,81 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrackScan(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	logger := NewRequestLogger(db)
+	logger.SetScanDetection(3, 10*time.Minute)
+
+	start := time.Now().Add(-time.Hour)
+	hit := func(addr string, port int, at time.Duration) {
+		s := &ProtocolSession{Timestamp: start.Add(at), ServerPort: port, ServiceName: "ftp", ServiceType: "ftp", Protocol: "ftp"}
+		if err := logger.LogProtocolSession(addr, s); err != nil {
+			t.Fatalf("Failed to log session: %v", err)
+		}
+	}
+
+	// A sweep of four ports in a second, revisiting one
+	hit("198.51.100.1:40000", 21, 0)
+	hit("198.51.100.1:40001", 22, 200*time.Millisecond)
+	hit("198.51.100.1:40002", 21, 300*time.Millisecond)
+	hit("198.51.100.1:40003", 80, 400*time.Millisecond)
+	hit("198.51.100.1:40004", 443, 600*time.Millisecond)
+
+	// Ports worked through minutes apart
+	hit("198.51.100.2:40000", 21, 0)
+	hit("198.51.100.2:40001", 80, 3*time.Minute)
+	hit("198.51.100.2:40002", 443, 8*time.Minute)
+
+	// Too few ports, then silent for longer than the window
+	hit("198.51.100.3:40000", 21, 0)
+	hit("198.51.100.3:40001", 80, time.Second)
+	hit("198.51.100.3:40002", 443, 20*time.Minute)
+
+	events, err := logger.GetScanEvents(start.Add(-time.Minute), "", 0)
+	if err != nil {
+		t.Fatalf("Failed to get scan events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 scan events, got %+v", events)
+	}
+
+	bySource := make(map[string]ScanEvent)
+	for _, e := range events {
+		bySource[e.SourceIP] = e
+	}
+
+	fast := bySource["198.51.100.1"]
+	if fast.Pattern != ScanPatternFast || fast.PortCount != 4 || len(fast.Ports) != 4 {
+		t.Fatalf("Expected a fast scan of 4 ports, got %+v", fast)
+	}
+	if fast.Ports[2] != (ScanHit{Port: 80, OffsetMS: 400}) {
+		t.Fatalf("Expected port 80 third at 400ms, got %+v", fast.Ports[2])
+	}
+
+	slow := bySource["198.51.100.2"]
+	if slow.Pattern != ScanPatternSlow || slow.PortCount != 3 || slow.MedianGap != 4*time.Minute {
+		t.Fatalf("Expected a slow scan of 3 ports 4m apart, got %+v", slow)
+	}
+
+	slowOnly, err := logger.GetScanEvents(start.Add(-time.Minute), ScanPatternSlow, 0)
+	if err != nil {
+		t.Fatalf("Failed to get scan events: %v", err)
+	}
+	if len(slowOnly) != 1 || slowOnly[0].SourceIP != "198.51.100.2" {
+		t.Fatalf("Expected only the slow scan, got %+v", slowOnly)
+	}
+}
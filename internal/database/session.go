@@ -0,0 +1,327 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/scanner"
+)
+
+// SessionIdleTimeout is how long a source IP may stay silent before its next
+// request starts a new session
+const SessionIdleTimeout = 30 * time.Minute
+
+// Interaction score weights. Every distinct endpoint, submitted credential,
+// and uploaded payload adds to a session's score, as does each minute spent,
+// up to maxScoredMinutes.
+const (
+	scoreEndpoint    = 1
+	scoreCredential  = 5
+	scoreUpload      = 10
+	scoreMinute      = 1
+	maxScoredMinutes = 60
+)
+
+// credentialFields are form and JSON fields that carry a password
+var credentialFields = []string{"password", "passwd", "pwd", "pass", "passphrase"}
+
+// Session represents the requests one source IP sent without pausing longer
+// than SessionIdleTimeout, scored by how deeply it interacted
+type Session struct {
+	ID          int64     `json:"id"`
+	SourceIP    string    `json:"source_ip"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Requests    int       `json:"requests"`
+	Endpoints   int       `json:"endpoints"`
+	Credentials int       `json:"credentials"`
+	Uploads     int       `json:"uploads"`
+	UploadBytes int64     `json:"upload_bytes"`
+	Score       int       `json:"score"`
+
+	// Scanner names the known research scanner the session came from
+	Scanner string `json:"scanner,omitempty"`
+	muted   bool
+
+	// Reverse DNS and RDAP data for the source, once looked up
+	PTR     string `json:"ptr"`
+	Network string `json:"network"`
+	Org     string `json:"org"`
+}
+
+// computeScore scores the session's interaction depth
+func (s *Session) computeScore() int {
+	minutes := int(s.LastSeen.Sub(s.FirstSeen).Minutes())
+	if minutes > maxScoredMinutes {
+		minutes = maxScoredMinutes
+	}
+	return s.Endpoints*scoreEndpoint +
+		s.Credentials*scoreCredential +
+		s.Uploads*scoreUpload +
+		minutes*scoreMinute
+}
+
+// interaction is what a single request contributes to its session
+type interaction struct {
+	port        int
+	method      string
+	path        string
+	credential  bool
+	upload      bool
+	uploadBytes int64
+	scanner     string
+	muteAlerts  bool
+}
+
+// newInteraction inspects a request and its dumped body for submitted
+// credentials and uploaded payloads
+func newInteraction(r *http.Request, rawDump []byte) interaction {
+	in := interaction{method: r.Method, path: r.URL.Path}
+	if s := scanner.FromContext(r.Context()); s != nil {
+		in.scanner = s.Name
+		in.muteAlerts = s.MuteAlerts
+	}
+
+	body := ""
+	if _, b, ok := strings.Cut(string(rawDump), "\r\n\r\n"); ok {
+		body = b
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	in.credential = r.Header.Get("Authorization") != "" ||
+		hasCredentialField(r.URL.Query()) ||
+		bodyHasCredential(mediaType, body)
+
+	if mediaType == "multipart/form-data" || (r.Method == http.MethodPut && len(body) > 0) {
+		in.upload = true
+		in.uploadBytes = int64(len(body))
+	}
+
+	return in
+}
+
+// bodyHasCredential reports whether a form or JSON body carries a password
+func bodyHasCredential(mediaType, body string) bool {
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(body)
+		return err == nil && hasCredentialField(values)
+	case "application/json":
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(body), &fields); err != nil {
+			return false
+		}
+		values := make(url.Values, len(fields))
+		for k, v := range fields {
+			values.Set(k, fmt.Sprint(v))
+		}
+		return hasCredentialField(values)
+	}
+	return false
+}
+
+func hasCredentialField(values url.Values) bool {
+	for key := range values {
+		for _, field := range credentialFields {
+			if strings.EqualFold(key, field) && values.Get(key) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetAlertThreshold logs an alert when a session's score first reaches
+// threshold. A threshold of 0 disables alerts.
+func (rl *RequestLogger) SetAlertThreshold(threshold int) {
+	rl.alertThreshold = threshold
+}
+
+// SetHandoff calls fn with a session whenever it records an interaction of a
+// session scoring at least threshold, unless it came from a known research
+// scanner, so sessions carried over from before a restart are still handed
+// off. A threshold of 0 disables it.
+func (rl *RequestLogger) SetHandoff(threshold int, fn func(Session)) {
+	rl.handoff = threshold
+	rl.onHandoff = fn
+}
+
+// sessionUpdate is an interaction recorded in a session, acted on once the
+// transaction recording it commits
+type sessionUpdate struct {
+	session  Session
+	created  bool
+	previous int
+	port     int
+	ts       time.Time
+}
+
+// recordInteraction adds a request to the source IP's current session,
+// starting a new one if the last has gone idle, and returns the session ID
+func (rl *RequestLogger) recordInteraction(ctx context.Context, sourceIP string, ts time.Time, in interaction) (int64, error) {
+	tx, err := rl.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin session update: %w", err)
+	}
+	defer tx.Rollback()
+
+	u, err := rl.updateSession(ctx, tx, sourceIP, ts, in)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit session update: %w", err)
+	}
+	rl.sessionUpdated(ctx, u)
+
+	return u.session.ID, nil
+}
+
+// updateSession adds a request to the source IP's current session within
+// tx, starting a new one if the last has gone idle
+func (rl *RequestLogger) updateSession(ctx context.Context, tx *tx, sourceIP string, ts time.Time, in interaction) (*sessionUpdate, error) {
+	s := Session{SourceIP: sourceIP}
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, first_seen, last_seen, request_count, endpoint_count,
+			credential_count, upload_count, upload_bytes, score, scanner, alerts_muted
+		FROM sessions
+		WHERE source_ip = ?
+		ORDER BY last_seen DESC
+		LIMIT 1
+	`, sourceIP).Scan(&s.ID, &s.FirstSeen, &s.LastSeen, &s.Requests, &s.Endpoints,
+		&s.Credentials, &s.Uploads, &s.UploadBytes, &s.Score, &s.Scanner, &s.muted)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to query session: %w", err)
+	}
+
+	created := err == sql.ErrNoRows || ts.Sub(s.LastSeen) > SessionIdleTimeout
+	if created {
+		id, err := tx.InsertContext(ctx, `INSERT INTO sessions (source_ip, first_seen, last_seen) VALUES (?, ?, ?)`,
+			sourceIP, ts, ts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert session: %w", err)
+		}
+		s = Session{ID: id, SourceIP: sourceIP, FirstSeen: ts}
+	}
+
+	// Endpoints count once per session, however often they are requested
+	if in.path != "" {
+		var seen bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM request_logs WHERE session_id = ? AND method = ? AND path = ?)
+		`, s.ID, in.method, in.path).Scan(&seen)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query session endpoints: %w", err)
+		}
+		if !seen {
+			s.Endpoints++
+		}
+	}
+
+	s.LastSeen = ts
+	s.Requests++
+	if in.credential {
+		s.Credentials++
+	}
+	if in.upload {
+		s.Uploads++
+		s.UploadBytes += in.uploadBytes
+	}
+
+	// A session stays tagged once any of its requests came from a scanner,
+	// since later requests may not identify themselves
+	if in.scanner != "" {
+		s.Scanner = in.scanner
+		s.muted = s.muted || in.muteAlerts
+	}
+
+	previous := s.Score
+	s.Score = s.computeScore()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE sessions
+		SET last_seen = ?, request_count = ?, endpoint_count = ?, credential_count = ?,
+			upload_count = ?, upload_bytes = ?, score = ?, scanner = ?, alerts_muted = ?
+		WHERE id = ?
+	`, s.LastSeen, s.Requests, s.Endpoints, s.Credentials, s.Uploads, s.UploadBytes, s.Score,
+		s.Scanner, s.muted, s.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	return &sessionUpdate{session: s, created: created, previous: previous, port: in.port, ts: ts}, nil
+}
+
+// sessionUpdated acts on a committed session update: enriching new sources,
+// tracking scans, alerting, and handing off
+func (rl *RequestLogger) sessionUpdated(ctx context.Context, u *sessionUpdate) {
+	s := u.session
+
+	// Look up who the source is once per session, off the request path
+	if u.created {
+		rl.enricher.Enqueue(s.SourceIP)
+	}
+
+	rl.trackScan(ctx, s.SourceIP, u.port, u.ts, s.ID)
+
+	if rl.alertThreshold > 0 && !s.muted && u.previous < rl.alertThreshold && s.Score >= rl.alertThreshold {
+		alertLog.Warn("ALERT high-interaction session", "session", s.ID, "source", s.SourceIP, "score", s.Score,
+			"endpoints", s.Endpoints, "credentials", s.Credentials, "uploads", s.Uploads, "duration", s.LastSeen.Sub(s.FirstSeen).Round(time.Second))
+	}
+
+	if rl.onHandoff != nil && rl.handoff > 0 && s.Scanner == "" && s.Score >= rl.handoff {
+		rl.onHandoff(s)
+	}
+}
+
+// GetSessions returns sessions active since the given time with at least
+// minScore, highest scoring first, leaving out known research scanners if
+// excludeScanners is set. A limit of 0 returns all of them.
+func (rl *RequestLogger) GetSessions(since time.Time, minScore, limit int, excludeScanners bool) ([]Session, error) {
+	query := `
+		SELECT s.id, s.source_ip, s.first_seen, s.last_seen, s.request_count, s.endpoint_count,
+			s.credential_count, s.upload_count, s.upload_bytes, s.score, s.scanner,
+			COALESCE(i.ptr, ''), COALESCE(i.network, ''), COALESCE(i.org, '')
+		FROM sessions s
+		LEFT JOIN source_info i ON i.ip = s.source_ip
+		WHERE s.last_seen >= ? AND s.score >= ?
+	`
+	if excludeScanners {
+		query += " AND s.scanner = ''"
+	}
+	query += " ORDER BY s.score DESC, s.last_seen DESC"
+	args := []any{since, minScore}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := rl.db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.SourceIP, &s.FirstSeen, &s.LastSeen, &s.Requests, &s.Endpoints,
+			&s.Credentials, &s.Uploads, &s.UploadBytes, &s.Score, &s.Scanner,
+			&s.PTR, &s.Network, &s.Org); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+	"github.com/davidthuman/service-spoof/internal/scanner"
+)
+
+func TestLogRequest_ScoresSession(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	logger := NewRequestLogger(db)
+	send := func(r *http.Request) {
+		ja4 := ""
+		r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &ja4))
+		r.RemoteAddr = "203.0.113.7:40000"
+		dump, err := httputil.DumpRequest(r, true)
+		if err != nil {
+			t.Fatalf("Failed to dump request: %v", err)
+		}
+		if err := logger.LogRequest(r, 80, "wordpress", "wordpress", 200, "", dump); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+
+	send(httptest.NewRequest("GET", "/wp-login.php", nil))
+	send(httptest.NewRequest("GET", "/wp-login.php", nil))
+	login := httptest.NewRequest("POST", "/wp-login.php", strings.NewReader("log=admin&pwd=hunter2"))
+	login.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	send(login)
+	upload := httptest.NewRequest("PUT", "/shell.php", strings.NewReader("<?php system($_GET['c']); ?>"))
+	send(upload)
+
+	sessions, err := logger.GetSessions(time.Now().Add(-time.Hour), 0, 0, false)
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("Expected 1 session, got %d", len(sessions))
+	}
+
+	s := sessions[0]
+	if s.Requests != 4 || s.Endpoints != 3 || s.Credentials != 1 || s.Uploads != 1 {
+		t.Fatalf("Expected 4 requests, 3 endpoints, 1 credential, 1 upload, got %+v", s)
+	}
+	if want := 3*scoreEndpoint + scoreCredential + scoreUpload; s.Score != want {
+		t.Fatalf("Expected score %d, got %d", want, s.Score)
+	}
+
+	var linked int
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM request_logs WHERE session_id = ?", s.ID).Scan(&linked); err != nil {
+		t.Fatalf("Failed to count session requests: %v", err)
+	}
+	if linked != 4 {
+		t.Fatalf("Expected 4 requests linked to the session, got %d", linked)
+	}
+
+	if high, _ := logger.GetSessions(time.Now().Add(-time.Hour), s.Score+1, 0, false); len(high) != 0 {
+		t.Fatalf("Expected no sessions above score %d, got %d", s.Score, len(high))
+	}
+}
+
+func TestLogRequest_TagsScannerSession(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	logger := NewRequestLogger(db)
+	send := func(ip string, s *scanner.Scanner) {
+		ja4 := ""
+		r := httptest.NewRequest("GET", "/", nil)
+		ctx := context.WithValue(r.Context(), fingerprint.JA4, &ja4)
+		if s != nil {
+			ctx = scanner.NewContext(ctx, s)
+		}
+		r = r.WithContext(ctx)
+		r.RemoteAddr = ip + ":40000"
+		if err := logger.LogRequest(r, 80, "nginx", "nginx", 200, "", nil); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+
+	send("198.51.100.1", &scanner.Scanner{Name: "censys", MuteAlerts: true})
+	send("198.51.100.1", nil)
+	send("203.0.113.7", nil)
+
+	sessions, err := logger.GetSessions(time.Now().Add(-time.Hour), 0, 0, false)
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(sessions))
+	}
+
+	filtered, err := logger.GetSessions(time.Now().Add(-time.Hour), 0, 0, true)
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].SourceIP != "203.0.113.7" {
+		t.Fatalf("Expected only the session from 203.0.113.7, got %+v", filtered)
+	}
+
+	var tagged int
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM request_logs WHERE scanner = 'censys'").Scan(&tagged); err != nil {
+		t.Fatalf("Failed to count scanner requests: %v", err)
+	}
+	if tagged != 1 {
+		t.Fatalf("Expected 1 request tagged censys, got %d", tagged)
+	}
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/davidthuman/service-spoof/internal/canary"
+)
+
+// sinkQueueSize bounds how many request logs may wait for each sink. Logs
+// arriving while a sink's queue is full are dropped for that sink only.
+const sinkQueueSize = 1024
+
+// Sink receives a copy of every stored request log
+type Sink interface {
+	Write(entry *RequestLog) error
+}
+
+// Filter reports whether a request log should be sent to a sink
+type Filter func(entry *RequestLog) bool
+
+// sinkWorker feeds one sink from its own queue, so a slow or failing sink
+// never delays requests or the other sinks
+type sinkWorker struct {
+	name    string
+	sink    Sink
+	filter  Filter
+	queue   chan *RequestLog
+	dropped atomic.Int64
+}
+
+// run writes queued request logs until the queue is closed
+func (w *sinkWorker) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	failing := false
+	for entry := range w.queue {
+		if n := w.dropped.Swap(0); n > 0 {
+			sinkLog.Warn("sink queue full", "sink", w.name, "dropped", n)
+		}
+
+		// Only the first of a run of failures is logged
+		if err := w.sink.Write(entry); err != nil {
+			if !failing {
+				sinkLog.Error("failed to write to sink", "sink", w.name, "err", err)
+			}
+			failing = true
+			continue
+		}
+		if failing {
+			sinkLog.Info("sink recovered", "sink", w.name)
+			failing = false
+		}
+	}
+}
+
+// AddSink sends every stored request log passing filter to s. A nil filter
+// passes everything.
+func (rl *RequestLogger) AddSink(name string, s Sink, filter Filter) {
+	w := rl.newSinkWorker(name, s, filter)
+	rl.sinkMu.Lock()
+	rl.sinks = append(rl.sinks, w)
+	rl.sinkMu.Unlock()
+}
+
+// AddCanaryAlert sends every stored request log passing filter of a request
+// to a canary endpoint notifying the destination name to s. A nil filter
+// passes everything.
+func (rl *RequestLogger) AddCanaryAlert(name string, s Sink, filter Filter) {
+	w := rl.newSinkWorker(name, s, filter)
+	rl.sinkMu.Lock()
+	rl.canaryAlerts = append(rl.canaryAlerts, w)
+	rl.sinkMu.Unlock()
+}
+
+// newSinkWorker starts feeding s from a queue of its own
+func (rl *RequestLogger) newSinkWorker(name string, s Sink, filter Filter) *sinkWorker {
+	w := &sinkWorker{
+		name:   name,
+		sink:   s,
+		filter: filter,
+		queue:  make(chan *RequestLog, sinkQueueSize),
+	}
+	rl.sinkWG.Add(1)
+	go w.run(&rl.sinkWG)
+	return w
+}
+
+// CloseSinks stops accepting request logs and waits until every sink has
+// written its queue or ctx is done. Sinks implementing io.Closer are closed.
+func (rl *RequestLogger) CloseSinks(ctx context.Context) error {
+	rl.sinkMu.Lock()
+	sinks := append(rl.sinks, rl.canaryAlerts...)
+	rl.sinks = nil
+	rl.canaryAlerts = nil
+	rl.sinkMu.Unlock()
+	for _, w := range sinks {
+		close(w.queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		rl.sinkWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush sinks: %w", ctx.Err())
+	}
+
+	for _, w := range sinks {
+		if c, ok := w.sink.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				sinkLog.Error("failed to close sink", "sink", w.name, "err", err)
+			}
+		}
+	}
+	return nil
+}
+
+// emit checks a stored request log against the alert rules and queues it
+// for every sink whose filter it passes
+func (rl *RequestLogger) emit(entry *RequestLog) {
+	for _, rule := range rl.alertRules {
+		if rule.When.Eval(entry.Env()) {
+			alertLog.Warn("ALERT rule", "rule", rule.Name, "service", entry.ServiceName, "method", entry.Method,
+				"path", entry.Path, "source", entry.SourceIP, "session", entry.SessionID)
+		}
+	}
+
+	rl.sinkMu.RLock()
+	defer rl.sinkMu.RUnlock()
+	for _, w := range rl.sinks {
+		if w.filter != nil && !w.filter(entry) {
+			continue
+		}
+		select {
+		case w.queue <- entry:
+		default:
+			w.dropped.Add(1)
+		}
+	}
+}
+
+// alertCanary logs an alert for a stored request log of a request to a
+// canary endpoint and queues it for every alert destination the canary
+// notifies
+func (rl *RequestLogger) alertCanary(entry *RequestLog, token *canary.Token) {
+	if token == nil {
+		return
+	}
+	alertLog.Warn("ALERT canary", "canary", token.Name, "service", entry.ServiceName, "method", entry.Method,
+		"path", entry.Path, "source", entry.SourceIP, "ja4", entry.JA4Fingerprint, "session", entry.SessionID)
+
+	rl.sinkMu.RLock()
+	defer rl.sinkMu.RUnlock()
+	for _, w := range rl.canaryAlerts {
+		if !token.Notifies(w.name) || (w.filter != nil && !w.filter(entry)) {
+			continue
+		}
+		select {
+		case w.queue <- entry:
+		default:
+			w.dropped.Add(1)
+		}
+	}
+}
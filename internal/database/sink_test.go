@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/canary"
+)
+
+type blockedSink struct {
+	release chan struct{}
+}
+
+func (s *blockedSink) Write(entry *RequestLog) error {
+	<-s.release
+	return errors.New("collector down")
+}
+
+type recordingSink struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (s *recordingSink) Write(entry *RequestLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = append(s.paths, entry.Path)
+	return nil
+}
+
+func TestEmit_IsolatesSinks(t *testing.T) {
+	rl := &RequestLogger{}
+	blocked := &blockedSink{release: make(chan struct{})}
+	recorded := &recordingSink{}
+	rl.AddSink("blocked", blocked, nil)
+	rl.AddSink("recorded", recorded, func(entry *RequestLog) bool {
+		return entry.Path != "/skip"
+	})
+
+	// Far more logs than a queue holds must not block while a sink hangs
+	for i := 0; i < sinkQueueSize*2; i++ {
+		rl.emit(&RequestLog{Path: "/"})
+	}
+	rl.emit(&RequestLog{Path: "/skip"})
+	close(blocked.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rl.CloseSinks(ctx); err != nil {
+		t.Fatalf("Failed to close sinks: %v", err)
+	}
+
+	if len(recorded.paths) == 0 {
+		t.Fatal("Expected the healthy sink to receive request logs")
+	}
+	for _, p := range recorded.paths {
+		if p == "/skip" {
+			t.Fatal("Expected the filtered request log not to reach the sink")
+		}
+	}
+}
+
+func TestAlertCanary_NotifiesNamedDestinations(t *testing.T) {
+	rl := &RequestLogger{}
+	named := &recordingSink{}
+	other := &recordingSink{}
+	rl.AddCanaryAlert("named", named, nil)
+	rl.AddCanaryAlert("other", other, nil)
+
+	rl.alertCanary(&RequestLog{Path: "/"}, nil)
+	rl.alertCanary(&RequestLog{Path: "/backup.zip"}, &canary.Token{Name: "backup", Alerts: []string{"named"}})
+	rl.alertCanary(&RequestLog{Path: "/.env"}, &canary.Token{Name: "env"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rl.CloseSinks(ctx); err != nil {
+		t.Fatalf("Failed to close sinks: %v", err)
+	}
+
+	if len(named.paths) != 2 || named.paths[0] != "/backup.zip" || named.paths[1] != "/.env" {
+		t.Fatalf("Expected the named destination to receive both canaries, got %v", named.paths)
+	}
+	if len(other.paths) != 1 || other.paths[0] != "/.env" {
+		t.Fatalf("Expected the other destination to receive the canary notifying every destination, got %v", other.paths)
+	}
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/davidthuman/service-spoof/internal/enrich"
+)
+
+// SetEnricher looks up reverse DNS and RDAP data for the source of every new
+// session in the background
+func (rl *RequestLogger) SetEnricher(e *enrich.Enricher) {
+	rl.enricher = e
+}
+
+// GetSourceInfo returns the cached enrichment for an IP, or nil if there is
+// none
+func (rl *RequestLogger) GetSourceInfo(ctx context.Context, ip string) (*enrich.Info, error) {
+	info := &enrich.Info{IP: ip}
+	err := rl.db.conn.QueryRowContext(ctx, `
+		SELECT ptr, network, org, country, looked_up_at
+		FROM source_info
+		WHERE ip = ?
+	`, ip).Scan(&info.PTR, &info.Network, &info.Org, &info.Country, &info.LookedUpAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query source info: %w", err)
+	}
+	return info, nil
+}
+
+// SaveSourceInfo caches the enrichment for an IP
+func (rl *RequestLogger) SaveSourceInfo(ctx context.Context, info *enrich.Info) error {
+	_, err := rl.db.conn.ExecContext(ctx, `
+		INSERT INTO source_info (ip, ptr, network, org, country, looked_up_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(ip) DO UPDATE SET
+			ptr = excluded.ptr,
+			network = excluded.network,
+			org = excluded.org,
+			country = excluded.country,
+			looked_up_at = excluded.looked_up_at
+	`, info.IP, info.PTR, info.Network, info.Org, info.Country, info.LookedUpAt)
+	if err != nil {
+		return fmt.Errorf("failed to save source info: %w", err)
+	}
+	return nil
+}
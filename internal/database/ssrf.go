@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/ssrf"
+)
+
+// ssrfHitColumns are the columns scanned by scanSSRFHit
+const ssrfHitColumns = `token, parent, source_ip, method, path, host, user_agent, redirect_target,
+	provider, via, client, internal_headers, private_forwarded, issued_at`
+
+// SaveSSRFHit saves a token handed out by the SSRF catcher
+func (rl *RequestLogger) SaveSSRFHit(ctx context.Context, hit *ssrf.Hit) error {
+	ctx, cancel := logContext(ctx)
+	defer cancel()
+
+	_, err := rl.db.conn.ExecContext(ctx, `
+		INSERT INTO ssrf_hits (`+ssrfHitColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, hit.Token, hit.Parent, hit.SourceIP, hit.Method, hit.Path, hit.Host, hit.UserAgent, hit.RedirectTarget,
+		hit.Origin.Provider, hit.Origin.Via, hit.Origin.Client, strings.Join(hit.Origin.InternalHeaders, ","),
+		hit.Origin.PrivateForwarded, hit.IssuedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save SSRF hit: %w", err)
+	}
+	return nil
+}
+
+// GetSSRFHit returns the hit a token was handed out to, without its
+// callbacks, or nil if there is none
+func (rl *RequestLogger) GetSSRFHit(ctx context.Context, token string) (*ssrf.Hit, error) {
+	row := rl.db.conn.QueryRowContext(ctx, `SELECT `+ssrfHitColumns+` FROM ssrf_hits WHERE token = ?`, token)
+	hit, err := scanSSRFHit(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query SSRF hit: %w", err)
+	}
+	return hit, nil
+}
+
+// SaveSSRFCallback saves a sighting of a handed out token
+func (rl *RequestLogger) SaveSSRFCallback(ctx context.Context, cb *ssrf.Callback) error {
+	id, err := rl.db.conn.InsertContext(ctx, `
+		INSERT INTO ssrf_callbacks (token, source, protocol, data, received_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, cb.Token, cb.Source, cb.Protocol, cb.Data, cb.ReceivedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save SSRF callback: %w", err)
+	}
+	cb.ID = id
+	return nil
+}
+
+// GetSSRFHits returns the hits handed a token since a time with their
+// callbacks, most recent first. A limit of 0 returns all of them, and
+// withCallbacks leaves out hits no callback has been seen for.
+func (rl *RequestLogger) GetSSRFHits(since time.Time, limit int, withCallbacks bool) ([]ssrf.Hit, error) {
+	query := `SELECT ` + ssrfHitColumns + ` FROM ssrf_hits WHERE issued_at >= ?`
+	if withCallbacks {
+		query += " AND token IN (SELECT token FROM ssrf_callbacks)"
+	}
+	query += " ORDER BY issued_at DESC"
+	args := []any{since}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := rl.db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query SSRF hits: %w", err)
+	}
+	defer rows.Close()
+
+	hits := make([]ssrf.Hit, 0)
+	index := make(map[string]int)
+	for rows.Next() {
+		hit, err := scanSSRFHit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan SSRF hit: %w", err)
+		}
+		index[hit.Token] = len(hits)
+		hits = append(hits, *hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate SSRF hits: %w", err)
+	}
+	if len(hits) == 0 {
+		return hits, nil
+	}
+
+	rows, err = rl.db.conn.Query(`
+		SELECT c.id, c.token, c.source, c.protocol, c.data, c.received_at
+		FROM ssrf_callbacks c
+		JOIN ssrf_hits h ON h.token = c.token
+		WHERE h.issued_at >= ?
+		ORDER BY c.received_at
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query SSRF callbacks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cb ssrf.Callback
+		if err := rows.Scan(&cb.ID, &cb.Token, &cb.Source, &cb.Protocol, &cb.Data, &cb.ReceivedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan SSRF callback: %w", err)
+		}
+		if i, ok := index[cb.Token]; ok {
+			hits[i].Callbacks = append(hits[i].Callbacks, cb)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate SSRF callbacks: %w", err)
+	}
+
+	return hits, nil
+}
+
+// scanSSRFHit scans a row of ssrfHitColumns
+func scanSSRFHit(row interface{ Scan(...any) error }) (*ssrf.Hit, error) {
+	var hit ssrf.Hit
+	var internalHeaders string
+	err := row.Scan(&hit.Token, &hit.Parent, &hit.SourceIP, &hit.Method, &hit.Path, &hit.Host, &hit.UserAgent,
+		&hit.RedirectTarget, &hit.Origin.Provider, &hit.Origin.Via, &hit.Origin.Client, &internalHeaders,
+		&hit.Origin.PrivateForwarded, &hit.IssuedAt)
+	if err != nil {
+		return nil, err
+	}
+	hit.Origin.InternalHeaders = make([]string, 0)
+	if internalHeaders != "" {
+		hit.Origin.InternalHeaders = strings.Split(internalHeaders, ",")
+	}
+	hit.Callbacks = make([]ssrf.Callback, 0)
+	return &hit, nil
+}
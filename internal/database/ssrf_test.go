@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/ssrf"
+)
+
+func TestSSRFHits(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	logger := NewRequestLogger(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	for i, token := range []string{"00000000000000aa", "00000000000000bb"} {
+		hit := &ssrf.Hit{
+			Token:    token,
+			SourceIP: "198.51.100.4",
+			Method:   "GET",
+			Path:     "/latest/meta-data/",
+			Origin:   ssrf.Origin{Provider: ssrf.ProviderAWS, Via: ssrf.ViaProxy, InternalHeaders: []string{"Via", "X-Forwarded-For"}},
+			IssuedAt: now.Add(time.Duration(i) * time.Second),
+		}
+		if err := logger.SaveSSRFHit(ctx, hit); err != nil {
+			t.Fatalf("Failed to save hit: %v", err)
+		}
+	}
+	cb := &ssrf.Callback{Token: "00000000000000aa", Source: "203.0.113.9", Protocol: "dns", ReceivedAt: now}
+	if err := logger.SaveSSRFCallback(ctx, cb); err != nil || cb.ID == 0 {
+		t.Fatalf("Failed to save callback: %v", err)
+	}
+
+	hits, err := logger.GetSSRFHits(now.Add(-time.Hour), 0, false)
+	if err != nil {
+		t.Fatalf("Failed to get hits: %v", err)
+	}
+	if len(hits) != 2 || hits[0].Token != "00000000000000bb" || len(hits[1].Callbacks) != 1 {
+		t.Fatalf("Expected two hits, newest first, with the callback on the first, got %+v", hits)
+	}
+	if got := hits[1].Origin.InternalHeaders; len(got) != 2 || got[1] != "X-Forwarded-For" {
+		t.Fatalf("Expected internal headers to round trip, got %v", got)
+	}
+
+	hits, err = logger.GetSSRFHits(now.Add(-time.Hour), 0, true)
+	if err != nil || len(hits) != 1 || hits[0].Token != "00000000000000aa" {
+		t.Fatalf("Expected only the hit with a callback, got %+v, %v", hits, err)
+	}
+
+	if hit, err := logger.GetSSRFHit(ctx, "ffffffffffffffff"); err != nil || hit != nil {
+		t.Fatalf("Expected no hit for an unknown token, got %+v, %v", hit, err)
+	}
+}
@@ -0,0 +1,18 @@
+package database
+
+import "context"
+
+type variantKey struct{}
+
+// WithVariant returns a context recording the response variant its request
+// is answered with
+func WithVariant(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, variantKey{}, name)
+}
+
+// variantFromContext returns the response variant of a request, or "" if it
+// is answered with its endpoint's own response
+func variantFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(variantKey{}).(string)
+	return name
+}
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/davidthuman/service-spoof/internal/websocket"
+)
+
+// insertWebSocketMessages stores the frames sent over the connection of the
+// request logged as requestID within tx, numbered in the order received
+func insertWebSocketMessages(ctx context.Context, tx *tx, requestID int64, frames []websocket.Frame) error {
+	for i, f := range frames {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO websocket_messages (request_id, seq, received_at, opcode, type, fin, length, payload)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, requestID, i, f.Time, int(f.Opcode), f.Type(), f.Fin, f.Length, f.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to insert websocket message: %w", err)
+		}
+	}
+	return nil
+}
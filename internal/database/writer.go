@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// flushTimeout bounds the database work of writing each batch
+const flushTimeout = 30 * time.Second
+
+// lockRetries is how many more times a batch is written while the database
+// is locked, waiting lockRetryDelay longer before each
+const (
+	lockRetries    = 5
+	lockRetryDelay = 100 * time.Millisecond
+)
+
+// logWriter writes queued request logs in batched transactions from a pool
+// of goroutines sharing the queue
+type logWriter struct {
+	rl        *RequestLogger
+	queue     chan *pendingLog
+	batchSize int
+	interval  time.Duration
+	block     bool
+	dropped   atomic.Int64
+	reported  atomic.Int64
+	done      chan struct{}
+}
+
+// WriterStats describes the queue of the request log writer
+type WriterStats struct {
+	Queued   int   `json:"queued"`
+	Capacity int   `json:"capacity"`
+	Dropped  int64 `json:"dropped"`
+}
+
+// StartWriter writes request logs from a queue in batched transactions
+// instead of before LogRequest and LogMalformed return. Logs are written
+// once a batch fills or its flush interval passes, by as many goroutines
+// as the config has workers.
+func (rl *RequestLogger) StartWriter(cfg *config.WriterConfig) {
+	w := &logWriter{
+		rl:        rl,
+		queue:     make(chan *pendingLog, cfg.GetQueueSize()),
+		batchSize: cfg.GetBatchSize(),
+		interval:  cfg.GetFlushInterval(),
+		block:     cfg.Overflow == config.WriterOverflowBlock,
+		done:      make(chan struct{}),
+	}
+	rl.writerMu.Lock()
+	rl.writer = w
+	rl.writerMu.Unlock()
+
+	var wg sync.WaitGroup
+	for range cfg.GetWorkers() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(w.done)
+	}()
+}
+
+// CloseWriter stops queueing request logs, writing later ones directly, and
+// waits until the queue is written or ctx is done
+func (rl *RequestLogger) CloseWriter(ctx context.Context) error {
+	rl.writerMu.Lock()
+	w := rl.writer
+	rl.writer = nil
+	rl.writerMu.Unlock()
+	if w == nil {
+		return nil
+	}
+	close(w.queue)
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush request logs: %w", ctx.Err())
+	}
+}
+
+// WriterStats returns the state of the request log writer's queue, or false
+// if it is not running
+func (rl *RequestLogger) WriterStats() (WriterStats, bool) {
+	rl.writerMu.RLock()
+	defer rl.writerMu.RUnlock()
+	w := rl.writer
+	if w == nil {
+		return WriterStats{}, false
+	}
+	return WriterStats{Queued: len(w.queue), Capacity: cap(w.queue), Dropped: w.dropped.Load()}, true
+}
+
+// enqueue queues a request log, waiting for room until ctx is done if the
+// writer blocks and dropping it otherwise
+func (w *logWriter) enqueue(ctx context.Context, p *pendingLog) error {
+	if w.block {
+		select {
+		case w.queue <- p:
+			return nil
+		case <-ctx.Done():
+			w.dropped.Add(1)
+			return fmt.Errorf("failed to queue request log: %w", ctx.Err())
+		}
+	}
+
+	select {
+	case w.queue <- p:
+	default:
+		w.dropped.Add(1)
+	}
+	return nil
+}
+
+// run writes batches until the queue is closed and drained
+func (w *logWriter) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]*pendingLog, 0, w.batchSize)
+	for {
+		select {
+		case p, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, p)
+			if len(batch) < w.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		w.flush(batch)
+		batch = batch[:0]
+
+		// Whichever worker first sees new drops reports them
+		n, reported := w.dropped.Load(), w.reported.Load()
+		if n > reported && w.reported.CompareAndSwap(reported, n) {
+			databaseLog.Warn("request log queue full", "dropped", n-reported)
+		}
+	}
+}
+
+// flush writes a batch in one transaction, retrying while the database is
+// locked. If the transaction fails otherwise, each log is retried on its own,
+// so one bad log does not lose the rest.
+func (w *logWriter) flush(batch []*pendingLog) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	err := w.rl.writeBatch(ctx, batch)
+	// A lock fails every log alike, so the batch waits for it rather than
+	// being split up
+	for attempt := 1; errors.Is(err, ErrLocked) && attempt <= lockRetries; attempt++ {
+		select {
+		case <-time.After(time.Duration(attempt) * lockRetryDelay):
+		case <-ctx.Done():
+			databaseLog.Error("failed to write batch of request logs", "size", len(batch), "err", err)
+			return
+		}
+		err = w.rl.writeBatch(ctx, batch)
+	}
+	if err == nil {
+		return
+	}
+	if len(batch) == 1 {
+		databaseLog.Error("failed to log request to database", "err", err)
+		return
+	}
+
+	databaseLog.Warn("failed to write batch of request logs, retrying one at a time", "size", len(batch), "err", err)
+	for _, p := range batch {
+		if err := w.rl.writeBatch(ctx, []*pendingLog{p}); err != nil {
+			databaseLog.Error("failed to log request to database", "err", err)
+		}
+	}
+}
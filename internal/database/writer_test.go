@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+type idSink struct {
+	ids chan int64
+}
+
+func (s *idSink) Write(entry *RequestLog) error {
+	s.ids <- entry.ID
+	return nil
+}
+
+func TestWriter_BatchesAndFlushesOnClose(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	const requests = 250
+	logger := NewRequestLogger(db)
+	sink := &idSink{ids: make(chan int64, requests+1)}
+	logger.AddSink("ids", sink, nil)
+
+	// A long interval leaves the last partial batch to be flushed on close
+	logger.StartWriter(&config.WriterConfig{Enabled: true, BatchSize: 100, FlushInterval: time.Hour})
+
+	for i := 0; i < requests; i++ {
+		var ja4 string
+		r := httptest.NewRequest("GET", "/probe", nil)
+		r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &ja4))
+		r.RemoteAddr = "203.0.113.7:40000"
+		if err := logger.LogRequest(r, 80, "nginx", "nginx", 404, "", nil); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+	if err := logger.LogMalformed("203.0.113.7:40001", 80, "nginx", "nginx", 400, "", "tls", []byte{0x16, 0x03}); err != nil {
+		t.Fatalf("Failed to log malformed request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := logger.CloseWriter(ctx); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	if _, ok := logger.WriterStats(); ok {
+		t.Fatal("Expected no writer after close")
+	}
+
+	var count, sessions int
+	db.conn.QueryRow(`SELECT COUNT(*), COUNT(DISTINCT session_id) FROM request_logs`).Scan(&count, &sessions)
+	if count != requests+1 {
+		t.Fatalf("Expected %d request logs, got %d", requests+1, count)
+	}
+	if sessions != 1 {
+		t.Fatalf("Expected every request in one session, got %d", sessions)
+	}
+
+	var recorded int
+	db.conn.QueryRow(`SELECT request_count FROM sessions`).Scan(&recorded)
+	if recorded != requests+1 {
+		t.Fatalf("Expected the session to count %d requests, got %d", requests+1, recorded)
+	}
+
+	if err := logger.CloseSinks(ctx); err != nil {
+		t.Fatalf("Failed to close sinks: %v", err)
+	}
+	close(sink.ids)
+	emitted := 0
+	for id := range sink.ids {
+		if id == 0 {
+			t.Fatal("Expected emitted logs to carry their ID")
+		}
+		emitted++
+	}
+	if emitted != requests+1 {
+		t.Fatalf("Expected %d logs emitted, got %d", requests+1, emitted)
+	}
+
+	// Requests after close are written directly
+	var ja4 string
+	r := httptest.NewRequest("GET", "/late", nil)
+	r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &ja4))
+	r.RemoteAddr = "203.0.113.7:40002"
+	if err := logger.LogRequest(r, 80, "nginx", "nginx", 404, "", nil); err != nil {
+		t.Fatalf("Failed to log request after close: %v", err)
+	}
+	db.conn.QueryRow(`SELECT COUNT(*) FROM request_logs`).Scan(&count)
+	if count != requests+2 {
+		t.Fatalf("Expected the late request to be written directly, got %d logs", count)
+	}
+}
+
+func TestWriter_WorkersDrainQueue(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	const requests = 200
+	logger := NewRequestLogger(db)
+	logger.StartWriter(&config.WriterConfig{Enabled: true, BatchSize: 10, FlushInterval: time.Hour, Workers: 4})
+
+	for i := 0; i < requests; i++ {
+		var ja4 string
+		r := httptest.NewRequest("GET", "/probe", nil)
+		r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &ja4))
+		r.RemoteAddr = fmt.Sprintf("203.0.113.%d:40000", i%250+1)
+		if err := logger.LogRequest(r, 80, "nginx", "nginx", 404, "", nil); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := logger.CloseWriter(ctx); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	var count int
+	db.conn.QueryRow(`SELECT COUNT(*) FROM request_logs`).Scan(&count)
+	if count != requests {
+		t.Fatalf("Expected %d request logs, got %d", requests, count)
+	}
+}
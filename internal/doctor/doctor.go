@@ -0,0 +1,355 @@
+package doctor
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/audit"
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/geoip"
+	"github.com/davidthuman/service-spoof/internal/templates"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// clockFloor is a time the system clock can never correctly be before, since
+// this check was written after it
+var clockFloor = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Check is the result of one startup check
+type Check struct {
+	Name   string `json:"name"`
+	Target string `json:"target,omitempty"`
+	Status Status `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Options controls which checks run and their thresholds
+type Options struct {
+	ConfigPath     string
+	MigrationsPath string
+
+	// CertWarning warns about certificates expiring within it
+	CertWarning time.Duration
+
+	// GeoIPMaxAge warns about GeoIP databases not updated within it
+	GeoIPMaxAge time.Duration
+
+	// SkipPorts skips binding every listener, for running beside a live
+	// instance
+	SkipPorts bool
+}
+
+// Run checks that the spoof would start cleanly with the configuration at
+// opts.ConfigPath. Checks needing the configuration are skipped if it does
+// not load.
+func Run(opts Options) []Check {
+	cfg, err := config.LoadConfig(opts.ConfigPath)
+	if err != nil {
+		return []Check{{Name: "config", Target: opts.ConfigPath, Status: StatusFail, Detail: err.Error()}}
+	}
+
+	listeners := len(cfg.GetServicesByListener())
+	checks := []Check{{
+		Name:   "config",
+		Target: opts.ConfigPath,
+		Status: StatusPass,
+		Detail: fmt.Sprintf("version %s, %d services on %d listeners", cfg.Version, len(cfg.GetEnabledServices()), listeners),
+	}}
+
+	checks = append(checks, checkAudit(cfg))
+	checks = append(checks, checkDatabase(cfg, opts.MigrationsPath)...)
+	checks = append(checks, checkCerts(cfg, opts.CertWarning)...)
+	checks = append(checks, checkTemplates(cfg)...)
+	if !opts.SkipPorts {
+		checks = append(checks, checkPorts(cfg)...)
+	}
+	if cfg.GeoIP.DatabasePath != "" {
+		checks = append(checks, checkGeoIP(cfg.GeoIP.DatabasePath, opts.GeoIPMaxAge))
+	}
+	return checks
+}
+
+// Failed reports whether any check failed, or warned if strict is set
+func Failed(checks []Check, strict bool) bool {
+	for _, c := range checks {
+		if c.Status == StatusFail || (strict && c.Status == StatusWarn) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAudit runs the banner consistency audit the spoof runs on startup
+func checkAudit(cfg *config.Config) Check {
+	findings := audit.Run(cfg)
+	if len(findings) == 0 {
+		return Check{Name: "audit", Status: StatusPass, Detail: "no banner contradictions"}
+	}
+
+	messages := make([]string, len(findings))
+	for i, f := range findings {
+		messages[i] = f.String()
+	}
+	status := StatusWarn
+	if audit.Failed(findings, cfg.Audit.Strict) {
+		status = StatusFail
+	}
+	return Check{Name: "audit", Status: status, Detail: strings.Join(messages, "; ")}
+}
+
+// checkDatabase checks the schema version of the database against the
+// migrations and that the clock is not behind the last logged request. A
+// SQLite database that does not exist yet is created on the first run.
+func checkDatabase(cfg *config.Config, migrationsPath string) []Check {
+	path := cfg.Database.Target()
+	now := time.Now()
+	clock := Check{Name: "clock", Status: StatusPass, Detail: now.UTC().Format(time.RFC3339)}
+	if now.Before(clockFloor) {
+		clock.Status = StatusFail
+		clock.Detail = fmt.Sprintf("system time %s is in the past", now.UTC().Format(time.RFC3339))
+	}
+
+	sqlite := cfg.Database.GetDriver() == config.DatabaseDriverSQLite
+	if _, err := os.Stat(path); sqlite && os.IsNotExist(err) {
+		return []Check{
+			{Name: "migrations", Target: path, Status: StatusWarn, Detail: "database does not exist yet and is created on startup"},
+			clock,
+		}
+	}
+
+	db, err := database.Open(&cfg.Database)
+	if err != nil {
+		return []Check{{Name: "migrations", Target: path, Status: StatusFail, Detail: err.Error()}, clock}
+	}
+	defer db.Close()
+
+	migrations := Check{Name: "migrations", Target: path}
+	version, dirty, err := db.GetMigrationVersion()
+	latest, latestErr := db.LatestMigrationVersion(migrationsPath)
+	switch {
+	case err != nil:
+		migrations.Status, migrations.Detail = StatusFail, err.Error()
+	case latestErr != nil:
+		migrations.Status, migrations.Detail = StatusFail, latestErr.Error()
+	case dirty:
+		migrations.Status = StatusFail
+		migrations.Detail = fmt.Sprintf("dirty at version %d, run migrate recover", version)
+	case version > latest:
+		migrations.Status = StatusFail
+		migrations.Detail = fmt.Sprintf("version %d is newer than the latest migration %d", version, latest)
+	case version < latest:
+		migrations.Status = StatusWarn
+		migrations.Detail = fmt.Sprintf("version %d, migrations up to %d are applied on startup", version, latest)
+	default:
+		migrations.Status = StatusPass
+		migrations.Detail = fmt.Sprintf("version %d", version)
+	}
+
+	// A clock behind the last logged request would misorder sessions
+	if last, err := db.LastRequestTime(); err == nil && now.Before(last) {
+		clock.Status = StatusFail
+		clock.Detail = fmt.Sprintf("system time %s is before the last logged request at %s",
+			now.UTC().Format(time.RFC3339), last.UTC().Format(time.RFC3339))
+	}
+
+	return []Check{migrations, clock}
+}
+
+// checkCerts checks that every certificate the spoof presents loads and is
+// neither expired nor about to expire
+func checkCerts(cfg *config.Config, warning time.Duration) []Check {
+	paths := map[string]config.TlsConfig{}
+	add := func(t *config.TlsConfig) {
+		if t != nil && t.CertFilePath != "" {
+			paths[t.CertFilePath] = *t
+		}
+	}
+	add(&cfg.Tls)
+	for _, svc := range cfg.GetEnabledServices() {
+		add(svc.Tls)
+	}
+	for _, p := range cfg.Personalities {
+		if p.Enabled {
+			add(p.Tls)
+		}
+	}
+
+	checks := make([]Check, 0, len(paths))
+	for _, path := range sortedKeys(paths) {
+		checks = append(checks, checkCert(paths[path], time.Now(), warning))
+	}
+	return checks
+}
+
+// checkCert checks one certificate and key pair at now
+func checkCert(t config.TlsConfig, now time.Time, warning time.Duration) Check {
+	c := Check{Name: "certificate", Target: t.CertFilePath}
+
+	cert, err := tls.LoadX509KeyPair(t.CertFilePath, t.KeyFilePath)
+	if err != nil {
+		c.Status, c.Detail = StatusFail, err.Error()
+		return c
+	}
+	leaf := cert.Leaf
+
+	switch {
+	case now.Before(leaf.NotBefore):
+		c.Status = StatusFail
+		c.Detail = fmt.Sprintf("not valid until %s", leaf.NotBefore.UTC().Format(time.RFC3339))
+	case now.After(leaf.NotAfter):
+		c.Status = StatusFail
+		c.Detail = fmt.Sprintf("expired %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	case leaf.NotAfter.Sub(now) < warning:
+		c.Status = StatusWarn
+		c.Detail = fmt.Sprintf("expires %s, in %s", leaf.NotAfter.UTC().Format(time.RFC3339), leaf.NotAfter.Sub(now).Round(time.Hour))
+	default:
+		c.Status = StatusPass
+		c.Detail = fmt.Sprintf("valid until %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return c
+}
+
+// checkTemplates checks that every response template can be read
+func checkTemplates(cfg *config.Config) []Check {
+	paths := map[string]bool{}
+	add := func(path string) {
+		if path != "" {
+			paths[path] = true
+		}
+	}
+	for _, svc := range cfg.GetEnabledServices() {
+		for _, ep := range svc.Endpoints {
+			add(ep.Template)
+		}
+		if svc.BadRequest != nil {
+			add(svc.BadRequest.Template)
+		}
+		if svc.ServerError != nil {
+			add(svc.ServerError.Template)
+		}
+	}
+	if cfg.Wildcard.Enabled {
+		add(cfg.Wildcard.Template)
+	}
+
+	dir, err := templates.Open(cfg.Templates.GetRoot())
+	if err != nil {
+		return []Check{{Name: "templates", Status: StatusFail, Detail: err.Error()}}
+	}
+	defer dir.Close()
+
+	var unreadable []string
+	for _, path := range sortedKeys(paths) {
+		if _, err := dir.ReadFile(path); err != nil {
+			unreadable = append(unreadable, err.Error())
+		}
+	}
+	if len(unreadable) > 0 {
+		return []Check{{Name: "templates", Status: StatusFail, Detail: strings.Join(unreadable, "; ")}}
+	}
+	return []Check{{Name: "templates", Status: StatusPass, Detail: fmt.Sprintf("%d readable", len(paths))}}
+}
+
+// checkPorts checks that every listener the spoof opens can be bound.
+// Wildcard ports another program owns are skipped on startup, so they only
+// warn.
+func checkPorts(cfg *config.Config) []Check {
+	type listener struct {
+		addr     config.ListenAddr
+		wildcard bool
+	}
+	var listeners []listener
+
+	if cfg.Redirect.Enabled {
+		listeners = append(listeners, listener{addr: config.ListenAddr{Port: cfg.Redirect.Port}})
+	} else {
+		for addr := range cfg.GetServicesByListener() {
+			listeners = append(listeners, listener{addr: addr})
+		}
+		if wildcard := cfg.GetWildcardService(); wildcard != nil {
+			for _, port := range wildcard.Ports {
+				for _, addr := range wildcard.ListenAddrs(port) {
+					listeners = append(listeners, listener{addr: addr, wildcard: true})
+				}
+			}
+		}
+	}
+	if cfg.Admin.Enabled {
+		listeners = append(listeners, listener{addr: config.ListenAddr{Port: cfg.Admin.Port}})
+	}
+	sort.Slice(listeners, func(i, j int) bool {
+		if listeners[i].addr.Port != listeners[j].addr.Port {
+			return listeners[i].addr.Port < listeners[j].addr.Port
+		}
+		return listeners[i].addr.String() < listeners[j].addr.String()
+	})
+
+	checks := make([]Check, 0)
+	bound := 0
+	for _, l := range listeners {
+		ln, err := net.Listen(l.addr.Network(), l.addr.String())
+		if err != nil {
+			status := StatusFail
+			if l.wildcard {
+				status = StatusWarn
+			}
+			checks = append(checks, Check{Name: "port", Target: l.addr.String(), Status: status, Detail: err.Error()})
+			continue
+		}
+		ln.Close()
+		bound++
+	}
+	if bound > 0 {
+		checks = append(checks, Check{Name: "port", Status: StatusPass, Detail: fmt.Sprintf("%d of %d listeners available", bound, len(listeners))})
+	}
+	return checks
+}
+
+// checkGeoIP checks that the GeoIP database loads and has been updated
+// within maxAge
+func checkGeoIP(path string, maxAge time.Duration) Check {
+	c := Check{Name: "geoip", Target: path}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		c.Status, c.Detail = StatusFail, err.Error()
+		return c
+	}
+	db, err := geoip.Open(path)
+	if err != nil {
+		c.Status, c.Detail = StatusFail, err.Error()
+		return c
+	}
+
+	age := time.Since(info.ModTime()).Round(time.Hour)
+	c.Status = StatusPass
+	c.Detail = fmt.Sprintf("%d ranges, updated %s ago", db.Len(), age)
+	if maxAge > 0 && age > maxAge {
+		c.Status = StatusWarn
+	}
+	return c
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
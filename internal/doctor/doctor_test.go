@@ -0,0 +1,125 @@
+package doctor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestCheckCert(t *testing.T) {
+	dir := t.TempDir()
+	notAfter := time.Now().Add(10 * 24 * time.Hour)
+	tlsCfg := writeCert(t, dir, notAfter)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want Status
+	}{
+		{"valid", time.Now(), StatusPass},
+		{"expiring", notAfter.Add(-24 * time.Hour), StatusWarn},
+		{"expired", notAfter.Add(time.Hour), StatusFail},
+		{"not yet valid", time.Now().Add(-48 * time.Hour), StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkCert(tlsCfg, tt.now, 7*24*time.Hour); got.Status != tt.want {
+				t.Fatalf("Expected %s, got %s: %s", tt.want, got.Status, got.Detail)
+			}
+		})
+	}
+
+	tlsCfg.KeyFilePath = filepath.Join(dir, "missing.key")
+	if got := checkCert(tlsCfg, time.Now(), 0); got.Status != StatusFail {
+		t.Fatalf("Expected a missing key to fail, got %s", got.Status)
+	}
+}
+
+func TestCheckPortsAndTemplates(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer busy.Close()
+	port := busy.Addr().(*net.TCPAddr).Port
+
+	root := t.TempDir()
+	template := filepath.Join(root, "404.html")
+	if err := os.WriteFile(template, []byte("Not Found"), 0600); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	cfg := &config.Config{
+		Templates: config.TemplatesConfig{Root: root},
+		Services: []config.ServiceConfig{{
+			Name:    "web",
+			Enabled: true,
+			Address: "127.0.0.1",
+			Ports:   config.PortList{port},
+			Endpoints: []config.EndpointConfig{
+				{Path: "/", Method: "GET", Status: 404, Template: template},
+			},
+		}},
+	}
+
+	checks := checkPorts(cfg)
+	if len(checks) != 1 || checks[0].Status != StatusFail || checks[0].Target != busy.Addr().String() {
+		t.Fatalf("Expected the bound port to fail, got %+v", checks)
+	}
+
+	if checks := checkTemplates(cfg); checks[0].Status != StatusPass {
+		t.Fatalf("Expected readable templates to pass, got %+v", checks)
+	}
+	cfg.Services[0].ServerError = &config.ResponseConfig{Template: template + ".missing"}
+	if checks := checkTemplates(cfg); checks[0].Status != StatusFail {
+		t.Fatalf("Expected a missing template to fail, got %+v", checks)
+	}
+}
+
+// writeCert writes a self-signed certificate valid from a day ago until
+// notAfter
+func writeCert(t *testing.T, dir string, notAfter time.Time) config.TlsConfig {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "spoof.test"},
+		NotBefore:    time.Now().Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	cfg := config.TlsConfig{
+		CertFilePath: filepath.Join(dir, "cert.pem"),
+		KeyFilePath:  filepath.Join(dir, "key.pem"),
+	}
+	if err := os.WriteFile(cfg.CertFilePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(cfg.KeyFilePath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return cfg
+}
@@ -0,0 +1,127 @@
+// Package engagement bounds how far each source may engage with the spoof.
+// Requests, time, and bytes served are counted per source IP over a session,
+// which ends after the same idle timeout as logged sessions, and sources past
+// any limit have the rest of their session degraded.
+package engagement
+
+import (
+	"sync"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/logging"
+)
+
+// engagementLog logs the sessions that reach a limit
+var engagementLog = logging.Logger("engagement")
+
+// Limiter tracks the engagement of every source
+type Limiter struct {
+	cfg     config.EngagementConfig
+	timeout time.Duration
+
+	mu        sync.Mutex
+	sources   map[string]*engagement
+	lastSweep time.Time
+}
+
+// engagement is a source's session so far
+type engagement struct {
+	first    time.Time
+	last     time.Time
+	requests int
+	bytes    int64
+
+	// exceeded is set once the source has gone past a limit
+	exceeded bool
+}
+
+// NewLimiter creates a limiter enforcing the configured limits, or nil if
+// they are disabled
+func NewLimiter(cfg *config.EngagementConfig) *Limiter {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Limiter{
+		cfg:     *cfg,
+		timeout: database.SessionIdleTimeout,
+		sources: make(map[string]*engagement),
+	}
+}
+
+// Action returns what is done with requests from sources past their limits
+func (l *Limiter) Action() string {
+	return l.cfg.GetAction()
+}
+
+// Hold returns how long requests past the limits are held unanswered
+func (l *Limiter) Hold() time.Duration {
+	return l.cfg.GetHold()
+}
+
+// Allow counts a request from a source, reporting whether the source is
+// still within its limits
+func (l *Limiter) Allow(source string, now time.Time) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		l.sweep(now)
+	}
+
+	e, ok := l.sources[source]
+	if !ok || now.Sub(e.last) > l.timeout {
+		e = &engagement{first: now}
+		l.sources[source] = e
+	}
+	e.last = now
+	e.requests++
+
+	if e.exceeded {
+		return false
+	}
+
+	reason := ""
+	switch {
+	case l.cfg.MaxRequests > 0 && e.requests > l.cfg.MaxRequests:
+		reason = "requests"
+	case l.cfg.MaxDuration > 0 && now.Sub(e.first) > l.cfg.MaxDuration:
+		reason = "duration"
+	case l.cfg.MaxBytes > 0 && e.bytes >= l.cfg.MaxBytes:
+		reason = "bytes"
+	}
+	if reason == "" {
+		return true
+	}
+
+	e.exceeded = true
+	engagementLog.Info("engagement limit reached", "limit", reason, "source", source, "requests", e.requests-1,
+		"duration", now.Sub(e.first).Round(time.Second), "bytes", e.bytes, "action", l.Action())
+	return false
+}
+
+// Served counts the response bytes served to a source
+func (l *Limiter) Served(source string, n int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.sources[source]; ok {
+		e.bytes += n
+	}
+}
+
+// sweep forgets sources whose session has ended
+func (l *Limiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for source, e := range l.sources {
+		if now.Sub(e.last) > l.timeout {
+			delete(l.sources, source)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package engagement
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	l := NewLimiter(&config.EngagementConfig{Enabled: true, MaxRequests: 3, MaxDuration: time.Hour, MaxBytes: 1000})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("203.0.113.7", now) {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+	if l.Allow("203.0.113.7", now) {
+		t.Fatalf("Expected the fourth request to go past the limit")
+	}
+	if !l.Allow("198.51.100.9", now) {
+		t.Fatalf("Expected other sources to be unaffected")
+	}
+	l.Served("198.51.100.9", 1000)
+	if l.Allow("198.51.100.9", now.Add(time.Minute)) {
+		t.Fatalf("Expected the byte limit to be enforced")
+	}
+
+	// A session degraded stays degraded while the source keeps at it
+	if l.Allow("203.0.113.7", now.Add(20*time.Minute)) {
+		t.Fatalf("Expected the session to stay degraded")
+	}
+	if !l.Allow("203.0.113.7", now.Add(time.Hour)) {
+		t.Fatalf("Expected a new session after the source went idle")
+	}
+
+	l = NewLimiter(&config.EngagementConfig{Enabled: true, MaxDuration: time.Hour})
+	for i := 0; i <= 60; i += 20 {
+		if !l.Allow("192.0.2.1", now.Add(time.Duration(i)*time.Minute)) {
+			t.Fatalf("Expected requests within the hour to be allowed")
+		}
+	}
+	if l.Allow("192.0.2.1", now.Add(time.Hour+time.Minute)) {
+		t.Fatalf("Expected the duration limit to be enforced")
+	}
+
+	if NewLimiter(&config.EngagementConfig{}) != nil {
+		t.Fatalf("Expected no limiter when disabled")
+	}
+}
@@ -0,0 +1,271 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/logging"
+)
+
+// enrichLog logs the lookups that fail
+var enrichLog = logging.Logger("enrich")
+
+const (
+	// lookupTimeout bounds each PTR and RDAP lookup
+	lookupTimeout = 10 * time.Second
+
+	// sourceTimeout bounds all work on one source, including the cache, so
+	// a stalled store cannot hold up a worker
+	sourceTimeout = 3 * lookupTimeout
+
+	// queueSize bounds how many sources may wait for enrichment. Sources
+	// arriving while the queue is full are dropped and retried on their
+	// next session.
+	queueSize = 1024
+)
+
+// Info is what reverse DNS and RDAP know about a source IP
+type Info struct {
+	IP         string    `json:"ip"`
+	PTR        string    `json:"ptr"`
+	Network    string    `json:"network"`
+	Org        string    `json:"org"`
+	Country    string    `json:"country"`
+	LookedUpAt time.Time `json:"looked_up_at"`
+}
+
+// Store caches enrichment results
+type Store interface {
+	// GetSourceInfo returns the cached info for an IP, or nil if there is none
+	GetSourceInfo(ctx context.Context, ip string) (*Info, error)
+
+	// SaveSourceInfo caches the info for an IP
+	SaveSourceInfo(ctx context.Context, info *Info) error
+}
+
+// Enricher resolves PTR records and RDAP registration data for source IPs in
+// the background, so lookups never delay a response
+type Enricher struct {
+	config   *config.EnrichmentConfig
+	store    Store
+	resolver *net.Resolver
+	client   *http.Client
+	queue    chan string
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+// NewEnricher creates an enricher caching its results in store
+func NewEnricher(cfg *config.EnrichmentConfig, store Store) *Enricher {
+	return &Enricher{
+		config:   cfg,
+		store:    store,
+		resolver: net.DefaultResolver,
+		client:   &http.Client{Timeout: lookupTimeout},
+		queue:    make(chan string, queueSize),
+		pending:  make(map[string]bool),
+	}
+}
+
+// Enqueue schedules an IP for enrichment without blocking. Non-public
+// addresses and IPs already queued are ignored.
+func (e *Enricher) Enqueue(ip string) {
+	if e == nil {
+		return
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.pending[ip] {
+		return
+	}
+
+	select {
+	case e.queue <- ip:
+		e.pending[ip] = true
+	default:
+	}
+}
+
+// Start runs the configured number of lookup workers until ctx is cancelled
+func (e *Enricher) Start(ctx context.Context) {
+	workers := e.config.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ip := <-e.queue:
+					if err := e.enrich(ctx, ip); err != nil {
+						enrichLog.Error("failed to enrich address", "ip", ip, "err", err)
+					}
+					e.mu.Lock()
+					delete(e.pending, ip)
+					e.mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// enrich looks up an IP unless its cached info is still fresh
+func (e *Enricher) enrich(ctx context.Context, ip string) error {
+	ctx, cancel := context.WithTimeout(ctx, sourceTimeout)
+	defer cancel()
+
+	cached, err := e.store.GetSourceInfo(ctx, ip)
+	if err != nil {
+		return err
+	}
+	if cached != nil && time.Since(cached.LookedUpAt) < e.config.CacheTTL {
+		return nil
+	}
+
+	info := &Info{IP: ip, LookedUpAt: time.Now()}
+
+	if e.config.ReverseDNS {
+		lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+		names, err := e.resolver.LookupAddr(lookupCtx, ip)
+		cancel()
+		if err == nil && len(names) > 0 {
+			info.PTR = strings.TrimSuffix(names[0], ".")
+		}
+	}
+
+	if e.config.RDAPURL != "" {
+		if err := e.lookupRDAP(ctx, info); err != nil {
+			// Keep what reverse DNS found, the next session retries RDAP
+			enrichLog.Warn("RDAP lookup failed", "ip", ip, "err", err)
+			if info.PTR == "" {
+				return nil
+			}
+			info.LookedUpAt = time.Time{}
+		}
+	}
+
+	return e.store.SaveSourceInfo(ctx, info)
+}
+
+// rdapEntity is the subset of an RDAP entity used to find the owning
+// organization
+type rdapEntity struct {
+	Roles      []string        `json:"roles"`
+	VCardArray json.RawMessage `json:"vcardArray"`
+	Entities   []rdapEntity    `json:"entities"`
+}
+
+// rdapNetwork is the subset of an RDAP IP network response used here
+type rdapNetwork struct {
+	Handle   string       `json:"handle"`
+	Name     string       `json:"name"`
+	Country  string       `json:"country"`
+	Entities []rdapEntity `json:"entities"`
+}
+
+// lookupRDAP fills in the network name, organization, and country of an IP
+func (e *Enricher) lookupRDAP(ctx context.Context, info *Info) error {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(e.config.RDAPURL, "/")+"/"+info.IP, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var network rdapNetwork
+	if err := json.NewDecoder(resp.Body).Decode(&network); err != nil {
+		return fmt.Errorf("failed to decode RDAP response: %w", err)
+	}
+
+	info.Network = network.Name
+	if info.Network == "" {
+		info.Network = network.Handle
+	}
+	info.Country = network.Country
+	info.Org = registrant(network.Entities)
+	return nil
+}
+
+// registrant returns the name of the registrant entity, falling back to the
+// first named entity
+func registrant(entities []rdapEntity) string {
+	fallback := ""
+	var walk func([]rdapEntity) string
+	walk = func(entities []rdapEntity) string {
+		for _, entity := range entities {
+			name := vcardName(entity.VCardArray)
+			for _, role := range entity.Roles {
+				if role == "registrant" && name != "" {
+					return name
+				}
+			}
+			if fallback == "" {
+				fallback = name
+			}
+			if name := walk(entity.Entities); name != "" {
+				return name
+			}
+		}
+		return ""
+	}
+
+	if name := walk(entities); name != "" {
+		return name
+	}
+	return fallback
+}
+
+// vcardName returns the formatted name (fn) of a jCard
+func vcardName(raw json.RawMessage) string {
+	var vcard []any
+	if err := json.Unmarshal(raw, &vcard); err != nil || len(vcard) < 2 {
+		return ""
+	}
+	props, ok := vcard[1].([]any)
+	if !ok {
+		return ""
+	}
+	for _, p := range props {
+		prop, ok := p.([]any)
+		if !ok || len(prop) < 4 || prop[0] != "fn" {
+			continue
+		}
+		if name, ok := prop[3].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+type memoryStore map[string]*Info
+
+func (m memoryStore) GetSourceInfo(ctx context.Context, ip string) (*Info, error) {
+	return m[ip], nil
+}
+func (m memoryStore) SaveSourceInfo(ctx context.Context, info *Info) error {
+	m[info.IP] = info
+	return nil
+}
+
+const rdapResponse = `{
+  "handle": "NET-198-51-100-0-1",
+  "name": "EXAMPLE-NET",
+  "country": "US",
+  "entities": [
+    {"roles": ["abuse"], "vcardArray": ["vcard", [["fn", {}, "text", "Abuse Desk"]]]},
+    {"roles": ["registrant"], "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example Hosting LLC"]]]}
+  ]
+}`
+
+func TestEnricher_RDAP(t *testing.T) {
+	lookups := 0
+	rdap := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		if r.URL.Path != "/ip/198.51.100.7" {
+			t.Errorf("Expected lookup of /ip/198.51.100.7, got %s", r.URL.Path)
+		}
+		fmt.Fprint(w, rdapResponse)
+	}))
+	defer rdap.Close()
+
+	store := memoryStore{}
+	e := NewEnricher(&config.EnrichmentConfig{RDAPURL: rdap.URL + "/ip/", CacheTTL: time.Hour}, store)
+
+	if err := e.enrich(context.Background(), "198.51.100.7"); err != nil {
+		t.Fatalf("Failed to enrich: %v", err)
+	}
+	info := store["198.51.100.7"]
+	if info == nil || info.Network != "EXAMPLE-NET" || info.Org != "Example Hosting LLC" || info.Country != "US" {
+		t.Fatalf("Expected EXAMPLE-NET registered to Example Hosting LLC, got %+v", info)
+	}
+
+	// Fresh cache entries are not looked up again
+	if err := e.enrich(context.Background(), "198.51.100.7"); err != nil {
+		t.Fatalf("Failed to enrich: %v", err)
+	}
+	if lookups != 1 {
+		t.Fatalf("Expected 1 RDAP lookup, got %d", lookups)
+	}
+}
+
+func TestEnricher_EnqueueSkipsPrivate(t *testing.T) {
+	e := NewEnricher(&config.EnrichmentConfig{}, memoryStore{})
+
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "fe80::1", "bogus"} {
+		e.Enqueue(ip)
+	}
+	e.Enqueue("198.51.100.7")
+	e.Enqueue("198.51.100.7")
+
+	if len(e.queue) != 1 {
+		t.Fatalf("Expected 1 queued address, got %d", len(e.queue))
+	}
+}
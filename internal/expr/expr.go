@@ -0,0 +1,288 @@
+// Package expr implements the small expression language used by endpoint
+// conditions, sink filters, and alert rules, such as
+//
+//	ja4 startsWith "t13d" && path matches "^/wp-.*" && !scanner
+//
+// Expressions combine variables, string, number, and boolean literals, and
+// lists with the operators ||, &&, !, ==, !=, <, <=, >, >=, startsWith,
+// endsWith, contains, matches (regular expression), and in. Map variables are
+// indexed with brackets, as in headers["X-Api-Key"]. Unknown variables are
+// nil, and any value is true unless it is false, nil, zero, or empty.
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Env holds the variables an expression is evaluated against. Numbers are
+// float64 or int, and maps are map[string]any or map[string]string.
+type Env map[string]any
+
+// Program is a compiled expression
+type Program struct {
+	source string
+	root   node
+	vars   []string
+}
+
+// Compile parses an expression
+func Compile(source string) (*Program, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	p := &parser{tokens: tokens, vars: make(map[string]bool)}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %s", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+
+	prog := &Program{source: source, root: root}
+	for name := range p.vars {
+		prog.vars = append(prog.vars, name)
+	}
+	return prog, nil
+}
+
+// String returns the expression source
+func (p *Program) String() string {
+	return p.source
+}
+
+// Vars returns the variables the expression reads, so callers can reject
+// unknown ones
+func (p *Program) Vars() []string {
+	return p.vars
+}
+
+// Check returns an error naming the first variable the expression reads that
+// is not in known
+func (p *Program) Check(known []string) error {
+	allowed := make(map[string]bool, len(known))
+	for _, k := range known {
+		allowed[k] = true
+	}
+	for _, v := range p.vars {
+		if !allowed[v] {
+			return fmt.Errorf("unknown variable %q in %q (available: %s)", v, p.source, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// Eval reports whether the expression holds for env
+func (p *Program) Eval(env Env) bool {
+	return truthy(p.root.eval(env))
+}
+
+// node is an expression tree node
+type node interface {
+	eval(env Env) any
+}
+
+type literal struct {
+	value any
+}
+
+func (n *literal) eval(Env) any { return n.value }
+
+type variable struct {
+	name string
+}
+
+func (n *variable) eval(env Env) any { return normalize(env[n.name]) }
+
+type list struct {
+	items []node
+}
+
+func (n *list) eval(env Env) any {
+	values := make([]any, len(n.items))
+	for i, item := range n.items {
+		values[i] = item.eval(env)
+	}
+	return values
+}
+
+type index struct {
+	target node
+	key    node
+}
+
+func (n *index) eval(env Env) any {
+	key, _ := n.key.eval(env).(string)
+	switch m := n.target.eval(env).(type) {
+	case map[string]any:
+		if v, ok := m[key]; ok {
+			return normalize(v)
+		}
+		for k, v := range m {
+			if strings.EqualFold(k, key) {
+				return normalize(v)
+			}
+		}
+	case map[string]string:
+		if v, ok := m[key]; ok {
+			return v
+		}
+		for k, v := range m {
+			if strings.EqualFold(k, key) {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+type not struct {
+	operand node
+}
+
+func (n *not) eval(env Env) any { return !truthy(n.operand.eval(env)) }
+
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (n *logical) eval(env Env) any {
+	left := truthy(n.left.eval(env))
+	if n.and != left {
+		return left
+	}
+	return truthy(n.right.eval(env))
+}
+
+type compare struct {
+	op          string
+	left, right node
+	re          *regexp.Regexp
+}
+
+func (n *compare) eval(env Env) any {
+	left := n.left.eval(env)
+	if n.re != nil {
+		s, ok := left.(string)
+		return ok && n.re.MatchString(s)
+	}
+	right := n.right.eval(env)
+
+	switch n.op {
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	case "in":
+		items, _ := right.([]any)
+		for _, item := range items {
+			if equal(left, item) {
+				return true
+			}
+		}
+		return false
+	case "startsWith", "endsWith", "contains":
+		l, lok := left.(string)
+		r, rok := right.(string)
+		if !lok || !rok {
+			return false
+		}
+		switch n.op {
+		case "startsWith":
+			return strings.HasPrefix(l, r)
+		case "endsWith":
+			return strings.HasSuffix(l, r)
+		}
+		return strings.Contains(l, r)
+	}
+
+	// Ordering compares two numbers or two strings
+	var c int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case l < r:
+			c = -1
+		case l > r:
+			c = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(l, r)
+	default:
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// normalize converts integer variables to float64 so numbers compare equal
+// whatever their Go type
+func normalize(v any) any {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case uint16:
+		return float64(n)
+	}
+	return v
+}
+
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case float64:
+		b, ok := b.(float64)
+		return ok && a == b
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	case nil:
+		return b == nil
+	}
+	return false
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	case map[string]string:
+		return len(v) > 0
+	}
+	return true
+}
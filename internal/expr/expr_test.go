@@ -0,0 +1,96 @@
+package expr
+
+import "testing"
+
+func TestEval(t *testing.T) {
+	env := Env{
+		"ja4":             "t13d1516h2_8daaf6152771_02713d6af862",
+		"path":            "/wp-login.php",
+		"method":          "POST",
+		"server_port":     8100,
+		"response_status": 200,
+		"country":         "DE",
+		"scanner":         "",
+		"tor":             true,
+		"headers":         map[string]string{"X-Api-Key": "secret"},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`ja4 startsWith "t13d" && path matches "^/wp-.*"`, true},
+		{`ja4 startsWith "t12d" || path endsWith ".php"`, true},
+		{`!scanner && tor`, true},
+		{`country in ["DE", "FR"] && method != "GET"`, true},
+		{`country in ['US']`, false},
+		{`server_port == 8100 && response_status >= 200 && response_status < 300`, true},
+		{`headers["x-api-key"] == "secret"`, true},
+		{`headers["Missing"]`, false},
+		{`undefined == nil && !(path contains "admin")`, true},
+		{`server_port == "8100"`, false},
+	}
+
+	for _, tt := range tests {
+		prog, err := Compile(tt.expr)
+		if err != nil {
+			t.Fatalf("Failed to compile %q: %v", tt.expr, err)
+		}
+		if got := prog.Eval(env); got != tt.want {
+			t.Fatalf("Expected %q to be %v, got %v", tt.expr, tt.want, got)
+		}
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	for _, src := range []string{
+		`path ==`,
+		`(path == "/"`,
+		`path matches "["`,
+		`path matches other`,
+		`"unterminated`,
+		`path = "/"`,
+		`path "/"`,
+	} {
+		if _, err := Compile(src); err == nil {
+			t.Fatalf("Expected an error compiling %q", src)
+		}
+	}
+}
+
+func TestProgram_Check(t *testing.T) {
+	prog, err := Compile(`path == "/" && coutnry == "DE"`)
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	if err := prog.Check([]string{"path", "country"}); err == nil {
+		t.Fatal("Expected an error for the misspelled variable")
+	}
+}
+
+// FuzzCompile checks that no expression, however malformed, panics when it
+// is compiled or evaluated
+func FuzzCompile(f *testing.F) {
+	for _, src := range []string{
+		`ja4 startsWith "t13d" && path matches "^/wp-.*" && !scanner`,
+		`country in ["DE", 'FR'] || asn >= 64500`,
+		`headers["X-Api-Key"] != "" && !(tags contains "xxe")`,
+		`((a`, `"\"`, `x in [`, `1.2.3 == 1`,
+	} {
+		f.Add(src)
+	}
+	env := Env{
+		"path":    "/wp-login.php",
+		"asn":     64500,
+		"tags":    []any{"xxe"},
+		"headers": map[string]string{"X-Api-Key": "secret"},
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		prog, err := Compile(src)
+		if err != nil {
+			return
+		}
+		prog.Eval(env)
+		prog.Check([]string{"path"})
+	})
+}
@@ -0,0 +1,249 @@
+package fidelity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultDockerHost is the Docker daemon used when DOCKER_HOST is not set
+	DefaultDockerHost = "unix:///var/run/docker.sock"
+
+	// dockerAPIVersion is the Engine API version requested, supported since
+	// Docker 20.10
+	dockerAPIVersion = "v1.41"
+)
+
+// Docker is a client of the Docker Engine API, covering what running
+// reference containers needs
+type Docker struct {
+	client *http.Client
+	base   string
+}
+
+// Container is a running container
+type Container struct {
+	ID   string
+	Name string
+
+	// Addr is the host address the container's port is published on
+	Addr string
+}
+
+// ContainerSpec describes a container to run
+type ContainerSpec struct {
+	Name  string
+	Image string
+	Env   []string
+
+	// Port is the container port to publish on a random loopback port, none
+	// if 0
+	Port int
+
+	// Network is the network the container joins, where others reach it by
+	// Name
+	Network string
+}
+
+// NewDocker creates a client of the Docker daemon at host, a unix:// or
+// tcp:// address as in DOCKER_HOST
+func NewDocker(host string) (*Docker, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &Docker{
+			client: &http.Client{Transport: transport},
+			base:   "http://docker/" + dockerAPIVersion,
+		}, nil
+	case "tcp", "http":
+		return &Docker{
+			client: &http.Client{},
+			base:   "http://" + u.Host + "/" + dockerAPIVersion,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported docker host %q", host)
+}
+
+// Pull pulls an image, such as nginx:1.25.3
+func (d *Docker) Pull(ctx context.Context, image string) error {
+	resp, err := d.request(ctx, http.MethodPost, "/images/create?fromImage="+url.QueryEscape(image), nil)
+	if err != nil {
+		return fmt.Errorf("failed to pull %s: %w", image, err)
+	}
+	defer resp.Body.Close()
+
+	// Progress is streamed as JSON messages until the pull ends, and a
+	// failure part way through is reported as one of them
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to pull %s: %w", image, err)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("failed to pull %s: %s", image, msg.Error)
+		}
+	}
+}
+
+// Run creates and starts a container, returning where its port is published
+func (d *Docker) Run(ctx context.Context, spec ContainerSpec) (*Container, error) {
+	create := map[string]any{
+		"Image": spec.Image,
+		"Env":   spec.Env,
+	}
+	hostConfig := map[string]any{}
+	port := strconv.Itoa(spec.Port) + "/tcp"
+	if spec.Port != 0 {
+		create["ExposedPorts"] = map[string]any{port: struct{}{}}
+		hostConfig["PortBindings"] = map[string]any{
+			port: []map[string]string{{"HostIp": "127.0.0.1", "HostPort": ""}},
+		}
+	}
+	if spec.Network != "" {
+		hostConfig["NetworkMode"] = spec.Network
+	}
+	create["HostConfig"] = hostConfig
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := d.call(ctx, http.MethodPost, "/containers/create?name="+url.QueryEscape(spec.Name), create, &created); err != nil {
+		return nil, fmt.Errorf("failed to create container %s: %w", spec.Name, err)
+	}
+	c := &Container{ID: created.ID, Name: spec.Name}
+
+	if err := d.call(ctx, http.MethodPost, "/containers/"+c.ID+"/start", nil, nil); err != nil {
+		d.Remove(context.WithoutCancel(ctx), c)
+		return nil, fmt.Errorf("failed to start container %s: %w", spec.Name, err)
+	}
+	if spec.Port == 0 {
+		return c, nil
+	}
+
+	var inspect struct {
+		NetworkSettings struct {
+			Ports map[string][]struct {
+				HostIP   string `json:"HostIp"`
+				HostPort string `json:"HostPort"`
+			} `json:"Ports"`
+		} `json:"NetworkSettings"`
+	}
+	if err := d.call(ctx, http.MethodGet, "/containers/"+c.ID+"/json", nil, &inspect); err != nil {
+		d.Remove(context.WithoutCancel(ctx), c)
+		return nil, fmt.Errorf("failed to inspect container %s: %w", spec.Name, err)
+	}
+	bindings := inspect.NetworkSettings.Ports[port]
+	if len(bindings) == 0 {
+		d.Remove(context.WithoutCancel(ctx), c)
+		return nil, fmt.Errorf("container %s did not publish port %s", spec.Name, port)
+	}
+	c.Addr = net.JoinHostPort(bindings[0].HostIP, bindings[0].HostPort)
+	return c, nil
+}
+
+// Remove stops and removes a container with its volumes
+func (d *Docker) Remove(ctx context.Context, c *Container) error {
+	if err := d.call(ctx, http.MethodDelete, "/containers/"+c.ID+"?force=true&v=true", nil, nil); err != nil {
+		return fmt.Errorf("failed to remove container %s: %w", c.Name, err)
+	}
+	return nil
+}
+
+// CreateNetwork creates a bridge network containers reach each other on by
+// name
+func (d *Docker) CreateNetwork(ctx context.Context, name string) error {
+	body := map[string]any{"Name": name, "CheckDuplicate": true}
+	if err := d.call(ctx, http.MethodPost, "/networks/create", body, nil); err != nil {
+		return fmt.Errorf("failed to create network %s: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveNetwork removes a network
+func (d *Docker) RemoveNetwork(ctx context.Context, name string) error {
+	if err := d.call(ctx, http.MethodDelete, "/networks/"+url.PathEscape(name), nil, nil); err != nil {
+		return fmt.Errorf("failed to remove network %s: %w", name, err)
+	}
+	return nil
+}
+
+// call sends a request with an optional JSON body, decoding a JSON response
+// into out unless it is nil
+func (d *Docker) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	resp, err := d.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// request sends a request, returning an error with the daemon's message for
+// unsuccessful statuses
+func (d *Docker) request(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, d.base+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach docker: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var msg struct {
+			Message string `json:"message"`
+		}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(b, &msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(b))
+		}
+		return nil, fmt.Errorf("%s: %s", resp.Status, msg.Message)
+	}
+	return resp, nil
+}
@@ -0,0 +1,146 @@
+package fidelity
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// volatileHeaders change between requests on real servers, so only their
+// presence is compared
+var volatileHeaders = map[string]bool{
+	"Date":          true,
+	"Expires":       true,
+	"Set-Cookie":    true,
+	"Etag":          true,
+	"Last-Modified": true,
+	"Age":           true,
+}
+
+// Banner is the status and headers served by a host on a single port
+type Banner struct {
+	Status  int
+	Headers http.Header
+}
+
+// Difference describes a single field that differs between two banners
+type Difference struct {
+	Field string
+	Want  string
+	Got   string
+}
+
+// Report is the result of comparing a reference banner to the local spoof
+type Report struct {
+	Differences []Difference
+	Compared    int
+}
+
+// Score returns the fraction of compared fields that matched
+func (r *Report) Score() float64 {
+	if r.Compared == 0 {
+		return 1
+	}
+	return float64(r.Compared-len(r.Differences)) / float64(r.Compared)
+}
+
+// ParseBanner parses a raw HTTP response header block as indexed by
+// internet scanners
+func ParseBanner(raw string) (*Banner, error) {
+	raw = strings.TrimLeft(raw, "\r\n")
+	if !strings.Contains(raw, "\r\n\r\n") && !strings.Contains(raw, "\n\n") {
+		raw += "\r\n"
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(raw)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse banner: %w", err)
+	}
+	resp.Body.Close()
+
+	return &Banner{Status: resp.StatusCode, Headers: resp.Header}, nil
+}
+
+// FetchLocal requests a URL from the local spoof and returns its banner
+func FetchLocal(ctx context.Context, client *http.Client, url string) (*Banner, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	return &Banner{Status: resp.StatusCode, Headers: resp.Header}, nil
+}
+
+// Compare compares the banner of a real host to the banner the spoof serves
+func Compare(want, got *Banner) *Report {
+	report := &Report{}
+
+	report.Compared++
+	if want.Status != got.Status {
+		report.Differences = append(report.Differences, Difference{
+			Field: "status",
+			Want:  fmt.Sprint(want.Status),
+			Got:   fmt.Sprint(got.Status),
+		})
+	}
+
+	keys := make(map[string]bool)
+	for k := range want.Headers {
+		keys[http.CanonicalHeaderKey(k)] = true
+	}
+	for k := range got.Headers {
+		keys[http.CanonicalHeaderKey(k)] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		report.Compared++
+
+		wantVal := strings.Join(want.Headers.Values(k), ", ")
+		gotVal := strings.Join(got.Headers.Values(k), ", ")
+
+		if volatileHeaders[k] {
+			if (wantVal == "") != (gotVal == "") {
+				report.Differences = append(report.Differences, Difference{
+					Field: "header " + k,
+					Want:  presence(wantVal),
+					Got:   presence(gotVal),
+				})
+			}
+			continue
+		}
+
+		if wantVal != gotVal {
+			report.Differences = append(report.Differences, Difference{
+				Field: "header " + k,
+				Want:  wantVal,
+				Got:   gotVal,
+			})
+		}
+	}
+
+	return report
+}
+
+func presence(v string) string {
+	if v == "" {
+		return "<absent>"
+	}
+	return "<present>"
+}
@@ -0,0 +1,63 @@
+package fidelity
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseBanner(t *testing.T) {
+	raw := "HTTP/1.1 404 Not Found\r\nServer: nginx/1.18.0 (Ubuntu)\r\nDate: Mon, 01 Jan 2024 00:00:00 GMT\r\nContent-Type: text/html\r\n"
+
+	banner, err := ParseBanner(raw)
+	if err != nil {
+		t.Fatalf("Failed to parse banner: %v", err)
+	}
+
+	if banner.Status != 404 {
+		t.Fatalf("Expected status 404, got %d", banner.Status)
+	}
+
+	if got := banner.Headers.Get("Server"); got != "nginx/1.18.0 (Ubuntu)" {
+		t.Fatalf("Expected Server header, got %q", got)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	want := &Banner{
+		Status: 200,
+		Headers: http.Header{
+			"Server":       {"nginx/1.18.0 (Ubuntu)"},
+			"Date":         {"Mon, 01 Jan 2024 00:00:00 GMT"},
+			"Content-Type": {"text/html"},
+		},
+	}
+	got := &Banner{
+		Status: 200,
+		Headers: http.Header{
+			"Server":       {"nginx/1.25.3"},
+			"Date":         {"Tue, 02 Jan 2024 00:00:00 GMT"},
+			"Content-Type": {"text/html"},
+			"X-Extra":      {"1"},
+		},
+	}
+
+	report := Compare(want, got)
+
+	// status, Content-Type, Date, Server, X-Extra
+	if report.Compared != 5 {
+		t.Fatalf("Expected 5 compared fields, got %d", report.Compared)
+	}
+
+	fields := make(map[string]bool)
+	for _, d := range report.Differences {
+		fields[d.Field] = true
+	}
+
+	if !fields["header Server"] || !fields["header X-Extra"] {
+		t.Fatalf("Expected Server and X-Extra differences, got %+v", report.Differences)
+	}
+
+	if fields["header Date"] {
+		t.Fatalf("Date is volatile and should only be compared by presence")
+	}
+}
@@ -0,0 +1,202 @@
+package fidelity
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// probeTimeout bounds a probe without a deadline of its own
+	probeTimeout = 10 * time.Second
+
+	// maxBody bounds how much of a response body ReplayBody reads
+	maxBody = 1 << 20
+)
+
+// Probe is a raw request replayed against a reference server and the spoof.
+// {host} in Request is replaced with the Host the target is addressed by.
+type Probe struct {
+	Name    string
+	Request string
+}
+
+// Corpus is the probes replayed by a fidelity run: the requests scanners and
+// fingerprinting tools send, including malformed ones, whose answers real
+// servers give away their implementation in
+var Corpus = []Probe{
+	{"root", "GET / HTTP/1.1\r\nHost: {host}\r\nUser-Agent: Mozilla/5.0\r\nAccept: */*\r\nConnection: close\r\n\r\n"},
+	{"head", "HEAD / HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"not-found", "GET /fidelity-probe-not-found.html HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"directory", "GET /icons HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"dotfile", "GET /.env HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"htaccess", "GET /.htaccess HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"options", "OPTIONS / HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"options-star", "OPTIONS * HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"trace", "TRACE / HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"post", "POST / HTTP/1.1\r\nHost: {host}\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 7\r\nConnection: close\r\n\r\nprobe=1"},
+	{"unknown-method", "PROBE / HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"http10", "GET / HTTP/1.0\r\n\r\n"},
+	{"no-host", "GET / HTTP/1.1\r\nConnection: close\r\n\r\n"},
+	{"bad-version", "GET / HTTP/9.9\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"traversal", "GET /../../etc/passwd HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"encoded-slash", "GET /%2e%2e%2f%2e%2e%2fetc%2fpasswd HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"long-uri", "GET /" + strings.Repeat("A", 9000) + " HTTP/1.1\r\nHost: {host}\r\nConnection: close\r\n\r\n"},
+	{"long-header", "GET / HTTP/1.1\r\nHost: {host}\r\nX-Probe: " + strings.Repeat("A", 9000) + "\r\nConnection: close\r\n\r\n"},
+	{"range", "GET / HTTP/1.1\r\nHost: {host}\r\nRange: bytes=0-0\r\nConnection: close\r\n\r\n"},
+	{"conditional", "GET / HTTP/1.1\r\nHost: {host}\r\nIf-Modified-Since: Mon, 01 Jan 2024 00:00:00 GMT\r\nConnection: close\r\n\r\n"},
+}
+
+// Target is a server probes are replayed against
+type Target struct {
+	// Addr is the address connected to
+	Addr string
+	TLS  bool
+
+	// Host is the Host probes address, the same for a reference and the
+	// spoof so that what servers derive from it, such as redirect
+	// locations, compares equal
+	Host string
+}
+
+// Replay sends a probe to a target over a new connection and returns the
+// banner of its response. A server closing the connection without answering
+// gives a banner with status 0, so that servers dropping the same probes
+// compare equal.
+func Replay(ctx context.Context, target Target, p Probe) (*Banner, error) {
+	banner, _, err := replay(ctx, target, p, false)
+	return banner, err
+}
+
+// ReplayBody replays a probe like Replay and also returns up to 1 MiB of the
+// response body
+func ReplayBody(ctx context.Context, target Target, p Probe) (*Banner, []byte, error) {
+	return replay(ctx, target, p, true)
+}
+
+// replay sends a probe and reads its response, with the body if withBody
+func replay(ctx context.Context, target Target, p Probe, withBody bool) (*Banner, []byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, probeTimeout)
+		defer cancel()
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", target.Addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", target.Addr, err)
+	}
+	if target.TLS {
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         target.Host,
+			InsecureSkipVerify: true,
+		})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed TLS handshake with %s: %w", target.Addr, err)
+		}
+		conn = tlsConn
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	request := strings.ReplaceAll(p.Request, "{host}", target.Host)
+	if _, err := io.WriteString(conn, request); err != nil && !dropped(err) {
+		return nil, nil, fmt.Errorf("failed to send probe %s: %w", p.Name, err)
+	}
+
+	// The method tells whether the response to a HEAD probe has a body
+	method, _, _ := strings.Cut(request, " ")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: method})
+	if dropped(err) {
+		return &Banner{Headers: make(http.Header)}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response to probe %s: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var body []byte
+	if withBody {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxBody))
+		if err != nil && !dropped(err) {
+			return nil, nil, fmt.Errorf("failed to read response body to probe %s: %w", p.Name, err)
+		}
+	}
+	return &Banner{Status: resp.StatusCode, Headers: resp.Header}, body, nil
+}
+
+// dropped reports whether an error is the server closing the connection
+func dropped(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// ProbeResult is the comparison of a reference's and the spoof's answers to
+// a probe
+type ProbeResult struct {
+	Probe  string
+	Report *Report
+}
+
+// Result is the outcome of replaying probes against a reference and the
+// spoof
+type Result struct {
+	Probes []ProbeResult
+}
+
+// Compared returns the number of fields compared across every probe
+func (r *Result) Compared() int {
+	n := 0
+	for _, p := range r.Probes {
+		n += p.Report.Compared
+	}
+	return n
+}
+
+// Differences returns the number of fields that differed across every probe
+func (r *Result) Differences() int {
+	n := 0
+	for _, p := range r.Probes {
+		n += len(p.Report.Differences)
+	}
+	return n
+}
+
+// Score returns the fraction of fields compared across every probe that
+// matched
+func (r *Result) Score() float64 {
+	compared := r.Compared()
+	if compared == 0 {
+		return 1
+	}
+	return float64(compared-r.Differences()) / float64(compared)
+}
+
+// Run replays each probe against a reference and the spoof and compares
+// their answers
+func Run(ctx context.Context, probes []Probe, reference, spoof Target) (*Result, error) {
+	result := &Result{Probes: make([]ProbeResult, 0, len(probes))}
+	for _, p := range probes {
+		want, err := Replay(ctx, reference, p)
+		if err != nil {
+			return nil, fmt.Errorf("reference: %w", err)
+		}
+		got, err := Replay(ctx, spoof, p)
+		if err != nil {
+			return nil, fmt.Errorf("spoof: %w", err)
+		}
+		result.Probes = append(result.Probes, ProbeResult{Probe: p.Name, Report: Compare(want, got)})
+	}
+	return result, nil
+}
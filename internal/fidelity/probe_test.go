@@ -0,0 +1,141 @@
+package fidelity
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.25.3")
+		w.Header().Set("Location", "http://"+r.Host+"/login")
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer srv.Close()
+
+	target := Target{Addr: srv.Listener.Addr().String(), Host: "example.com"}
+	banner, err := Replay(context.Background(), target, Corpus[0])
+	if err != nil {
+		t.Fatalf("Failed to replay probe: %v", err)
+	}
+	if banner.Status != http.StatusFound {
+		t.Fatalf("Expected status 302, got %d", banner.Status)
+	}
+	if got := banner.Headers.Get("Location"); got != "http://example.com/login" {
+		t.Fatalf("Expected probe to address example.com, got Location %q", got)
+	}
+}
+
+func TestReplayDropped(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	banner, err := Replay(context.Background(), Target{Addr: ln.Addr().String(), Host: "localhost"}, Corpus[0])
+	if err != nil {
+		t.Fatalf("Expected a dropped probe to give a banner, got %v", err)
+	}
+	if banner.Status != 0 {
+		t.Fatalf("Expected status 0 for a dropped probe, got %d", banner.Status)
+	}
+}
+
+func TestRun(t *testing.T) {
+	handler := func(server string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", server)
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+			}
+		})
+	}
+	reference := httptest.NewServer(handler("Apache/2.4.58 (Unix)"))
+	defer reference.Close()
+	spoof := httptest.NewServer(handler("Apache/2.4.58 (Unix)"))
+	defer spoof.Close()
+
+	probes := []Probe{Corpus[0], Corpus[2]}
+	result, err := Run(context.Background(), probes,
+		Target{Addr: reference.Listener.Addr().String(), Host: "localhost"},
+		Target{Addr: spoof.Listener.Addr().String(), Host: "localhost"})
+	if err != nil {
+		t.Fatalf("Failed to run probes: %v", err)
+	}
+	if len(result.Probes) != 2 {
+		t.Fatalf("Expected 2 probe results, got %d", len(result.Probes))
+	}
+	if result.Score() != 1 {
+		t.Fatalf("Expected identical servers to score 1, got %f", result.Score())
+	}
+}
+
+func TestReferenceFor(t *testing.T) {
+	if ref := ReferenceFor("apache2", "Apache/2.4.58 (Unix)"); ref == nil || ref.Image != "httpd:2.4.58" {
+		t.Fatalf("Expected httpd:2.4.58, got %+v", ref)
+	}
+	if ref := ReferenceFor("nginx", "cloudflare"); ref == nil || ref.Image != "nginx:stable" {
+		t.Fatalf("Expected nginx:stable, got %+v", ref)
+	}
+	if ref := ReferenceFor("wordpress", ""); ref == nil || len(ref.Sidecars) != 1 {
+		t.Fatalf("Expected wordpress with a database sidecar, got %+v", ref)
+	}
+	if ref := ReferenceFor("iis", "Microsoft-IIS/10.0"); ref != nil {
+		t.Fatalf("Expected no reference for iis, got %+v", ref)
+	}
+}
+
+func TestDockerRun(t *testing.T) {
+	var created map[string]any
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1.41/containers/create":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"Id":"abc123"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/v1.41/containers/abc123/start":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && r.URL.Path == "/v1.41/containers/abc123/json":
+			w.Write([]byte(`{"NetworkSettings":{"Ports":{"80/tcp":[{"HostIp":"127.0.0.1","HostPort":"49153"}]}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"no such route"}`))
+		}
+	}))
+	defer api.Close()
+
+	docker, err := NewDocker("tcp://" + strings.TrimPrefix(api.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	c, err := docker.Run(context.Background(), ContainerSpec{Name: "ref", Image: "nginx:stable", Port: 80})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	if c.ID != "abc123" || c.Addr != "127.0.0.1:49153" {
+		t.Fatalf("Expected container abc123 on 127.0.0.1:49153, got %+v", c)
+	}
+	if created["Image"] != "nginx:stable" {
+		t.Fatalf("Expected image nginx:stable to be created, got %v", created["Image"])
+	}
+
+	err = docker.Remove(context.Background(), &Container{ID: "missing", Name: "missing"})
+	if err == nil || !strings.Contains(err.Error(), "no such route") {
+		t.Fatalf("Expected the daemon's message in the error, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package fidelity
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// readyInterval is how often a starting reference is polled
+const readyInterval = time.Second
+
+// Reference is a real server run in a container for a spoofed service to be
+// compared to
+type Reference struct {
+	Image string
+	Port  int
+	Env   []string
+
+	// Sidecars are containers the reference depends on, run first on a
+	// network shared with it
+	Sidecars []ContainerSpec
+
+	// Startup bounds how long the reference takes to answer once started
+	Startup time.Duration
+}
+
+// referenceImage is the image run for a service type, and how to find the
+// version to run in the Server header the spoof claims
+type referenceImage struct {
+	repository string
+	version    *regexp.Regexp
+	fallback   string
+}
+
+var referenceImages = map[string]referenceImage{
+	"apache2": {"httpd", regexp.MustCompile(`^Apache/(\d+\.\d+\.\d+)`), "2.4"},
+	"nginx":   {"nginx", regexp.MustCompile(`^nginx/(\d+\.\d+\.\d+)`), "stable"},
+}
+
+// ReferenceFor returns the reference container for a service type, or nil if
+// there is none. The image's version is the one the spoof's Server header
+// claims where it names one.
+func ReferenceFor(serviceType, server string) *Reference {
+	if serviceType == "wordpress" {
+		// WordPress answers every request with an error page until its
+		// database is reachable
+		return &Reference{
+			Image: "wordpress:latest",
+			Port:  80,
+			Env: []string{
+				"WORDPRESS_DB_HOST={db}",
+				"WORDPRESS_DB_USER=wordpress",
+				"WORDPRESS_DB_PASSWORD=wordpress",
+				"WORDPRESS_DB_NAME=wordpress",
+			},
+			Sidecars: []ContainerSpec{{
+				Name:  "{db}",
+				Image: "mariadb:11",
+				Env: []string{
+					"MARIADB_RANDOM_ROOT_PASSWORD=1",
+					"MARIADB_USER=wordpress",
+					"MARIADB_PASSWORD=wordpress",
+					"MARIADB_DATABASE=wordpress",
+				},
+			}},
+			Startup: 2 * time.Minute,
+		}
+	}
+
+	img, ok := referenceImages[serviceType]
+	if !ok {
+		return nil
+	}
+	tag := img.fallback
+	if m := img.version.FindStringSubmatch(server); m != nil {
+		tag = m[1]
+	}
+	return &Reference{
+		Image:   img.repository + ":" + tag,
+		Port:    80,
+		Startup: 30 * time.Second,
+	}
+}
+
+// Start pulls and runs a reference and its sidecars, with container names
+// prefixed by name, and waits until it answers. The returned function
+// removes everything started.
+func (d *Docker) Start(ctx context.Context, name string, ref *Reference) (*Container, func(), error) {
+	var containers []*Container
+	network := ""
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		for i := len(containers) - 1; i >= 0; i-- {
+			d.Remove(ctx, containers[i])
+		}
+		if network != "" {
+			d.RemoveNetwork(ctx, network)
+		}
+	}
+
+	// Sidecars are reached by name, so {db} in the reference's environment
+	// is replaced with the name the sidecar runs under
+	db := name + "-db"
+	env := make([]string, len(ref.Env))
+	for i, e := range ref.Env {
+		env[i] = expandName(e, db)
+	}
+
+	if len(ref.Sidecars) > 0 {
+		if err := d.CreateNetwork(ctx, name); err != nil {
+			return nil, nil, err
+		}
+		network = name
+	}
+	for _, spec := range ref.Sidecars {
+		spec.Name = expandName(spec.Name, db)
+		spec.Network = network
+		if err := d.Pull(ctx, spec.Image); err != nil {
+			stop()
+			return nil, nil, err
+		}
+		c, err := d.Run(ctx, spec)
+		if err != nil {
+			stop()
+			return nil, nil, err
+		}
+		containers = append(containers, c)
+	}
+
+	if err := d.Pull(ctx, ref.Image); err != nil {
+		stop()
+		return nil, nil, err
+	}
+	c, err := d.Run(ctx, ContainerSpec{
+		Name:    name,
+		Image:   ref.Image,
+		Env:     env,
+		Port:    ref.Port,
+		Network: network,
+	})
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	containers = append(containers, c)
+
+	if err := waitReady(ctx, Target{Addr: c.Addr, Host: "localhost"}, ref.Startup); err != nil {
+		stop()
+		return nil, nil, fmt.Errorf("reference %s did not start: %w", ref.Image, err)
+	}
+	return c, stop, nil
+}
+
+// waitReady polls a target with the root probe until it answers with a
+// status below 500, which a starting server or one missing its database
+// answers with
+func waitReady(ctx context.Context, target Target, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(readyInterval)
+	defer ticker.Stop()
+	for {
+		probeCtx, probeCancel := context.WithTimeout(ctx, readyInterval*5)
+		banner, err := Replay(probeCtx, target, Corpus[0])
+		probeCancel()
+		if err == nil && banner.Status != 0 && banner.Status < 500 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = fmt.Errorf("answered with status %d", banner.Status)
+			}
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// expandName replaces {db} with the name of the database sidecar
+func expandName(s, db string) string {
+	return strings.ReplaceAll(s, "{db}", db)
+}
@@ -0,0 +1,117 @@
+package fidelity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	shodanHostURL = "https://api.shodan.io/shodan/host/%s"
+	censysHostURL = "https://search.censys.io/api/v2/hosts/%s"
+)
+
+// shodanHost is the subset of the Shodan host API response that is used
+type shodanHost struct {
+	Data []struct {
+		Port int    `json:"port"`
+		Data string `json:"data"`
+	} `json:"data"`
+}
+
+// censysHost is the subset of the Censys v2 host API response that is used
+type censysHost struct {
+	Result struct {
+		Services []struct {
+			Port int `json:"port"`
+			HTTP struct {
+				Response struct {
+					StatusCode int `json:"status_code"`
+					Headers    map[string]struct {
+						Headers []string `json:"headers"`
+					} `json:"headers"`
+				} `json:"response"`
+			} `json:"http"`
+		} `json:"services"`
+	} `json:"result"`
+}
+
+// FetchShodan returns the banner Shodan has indexed for a host and port
+func FetchShodan(ctx context.Context, client *http.Client, apiKey, ip string, port int) (*Banner, error) {
+	u := fmt.Sprintf(shodanHostURL, url.PathEscape(ip)) + "?key=" + url.QueryEscape(apiKey)
+
+	var host shodanHost
+	if err := getJSON(ctx, client, u, nil, &host); err != nil {
+		return nil, fmt.Errorf("shodan lookup failed: %w", err)
+	}
+
+	for _, svc := range host.Data {
+		if svc.Port == port {
+			return ParseBanner(svc.Data)
+		}
+	}
+
+	return nil, fmt.Errorf("shodan has no banner for %s port %d", ip, port)
+}
+
+// FetchCensys returns the HTTP response Censys has indexed for a host and port
+func FetchCensys(ctx context.Context, client *http.Client, apiID, apiSecret, ip string, port int) (*Banner, error) {
+	u := fmt.Sprintf(censysHostURL, url.PathEscape(ip))
+
+	setAuth := func(req *http.Request) {
+		req.SetBasicAuth(apiID, apiSecret)
+	}
+
+	var host censysHost
+	if err := getJSON(ctx, client, u, setAuth, &host); err != nil {
+		return nil, fmt.Errorf("censys lookup failed: %w", err)
+	}
+
+	for _, svc := range host.Result.Services {
+		if svc.Port != port {
+			continue
+		}
+
+		banner := &Banner{
+			Status:  svc.HTTP.Response.StatusCode,
+			Headers: make(http.Header),
+		}
+		for k, v := range svc.HTTP.Response.Headers {
+			// Censys reports pseudo headers such as "_encoding"
+			if len(k) > 0 && k[0] == '_' {
+				continue
+			}
+			for _, val := range v.Headers {
+				banner.Headers.Add(k, val)
+			}
+		}
+		return banner, nil
+	}
+
+	return nil, fmt.Errorf("censys has no http service for %s port %d", ip, port)
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, prepare func(*http.Request), v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if prepare != nil {
+		prepare(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,226 @@
+package fingerprint
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// JA4R and JA4O are the context keys of a connection's raw and original
+// order JA4 fingerprints
+const (
+	JA4R JA4Key = "ja4_r"
+	JA4O JA4Key = "ja4_o"
+)
+
+// Hello is the context key of a connection's raw ClientHello record
+const Hello JA4Key = "client_hello"
+
+const (
+	extServerName          = 0x0000
+	extALPN                = 0x0010
+	extSignatureAlgorithms = 0x000d
+	extSupportedVersions   = 0x002b
+
+	// Extensions whose contents change on every connection
+	extSessionTicket = 0x0023
+	extPreSharedKey  = 0x0029
+	extKeyShare      = 0x0033
+	extECH           = 0xfe0d
+)
+
+// ClientHello holds the fields of a ClientHello that JA4 is computed from,
+// leaving out GREASE values. Cipher suites and extensions are in the order
+// the client sent them.
+type ClientHello struct {
+	Version             uint16
+	CipherSuites        []uint16
+	Extensions          []uint16
+	SignatureAlgorithms []uint16
+	SupportedVersions   []uint16
+	ServerName          bool
+	ALPN                string
+}
+
+// ParseClientHello parses every extension of the ClientHello in a TLS
+// handshake record, in order
+func ParseClientHello(payload []byte) (*ClientHello, error) {
+	r, err := readHello(payload, handshakeClientHello)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &ClientHello{Version: uint16(r.u16())}
+	r.next(32)     // random
+	r.next(r.u8()) // session ID
+	h.CipherSuites = r.uint16s(r.u16())
+	r.next(r.u8()) // compression methods
+	if r.bad {
+		return nil, errShortHello
+	}
+
+	h.Extensions = make([]uint16, 0)
+	exts := &helloReader{b: r.next(r.u16())}
+	for len(exts.b) >= 4 {
+		typ := uint16(exts.u16())
+		data := &helloReader{b: exts.next(exts.u16())}
+		if exts.bad {
+			break
+		}
+		if IsGreaseValue(typ) {
+			continue
+		}
+		h.Extensions = append(h.Extensions, typ)
+
+		switch typ {
+		case extServerName:
+			h.ServerName = true
+		case extALPN:
+			protocols := &helloReader{b: data.next(data.u16())}
+			h.ALPN = string(protocols.next(protocols.u8()))
+		case extSignatureAlgorithms:
+			h.SignatureAlgorithms = data.uint16s(data.u16())
+		case extSupportedVersions:
+			h.SupportedVersions = data.uint16s(data.u8())
+		}
+	}
+
+	return h, nil
+}
+
+// StableClientHello returns a copy of a ClientHello record with the values
+// that change on every connection zeroed, so that the hellos of a client
+// compare equal: the random, session ID, key share public keys, session
+// ticket, pre-shared keys, and encrypted ClientHello. No fingerprint reads
+// them. Records that do not parse are copied as is.
+func StableClientHello(payload []byte) []byte {
+	stable := bytes.Clone(payload)
+	r, err := readHello(stable, handshakeClientHello)
+	if err != nil {
+		return stable
+	}
+
+	r.next(2)             // version
+	clear(r.next(32))     // random
+	clear(r.next(r.u8())) // session ID
+	r.next(r.u16())       // cipher suites
+	r.next(r.u8())        // compression methods
+	exts := &helloReader{b: r.next(r.u16())}
+	for len(exts.b) >= 4 {
+		typ := exts.u16()
+		data := exts.next(exts.u16())
+		switch typ {
+		case extKeyShare:
+			list := &helloReader{b: data}
+			shares := &helloReader{b: list.next(list.u16())}
+			for len(shares.b) >= 4 {
+				shares.next(2) // group
+				clear(shares.next(shares.u16()))
+			}
+		case extSessionTicket, extPreSharedKey:
+			clear(data)
+		case extECH:
+			// Only the outer form carries an encapsulated key and payload
+			ech := &helloReader{b: data}
+			if ech.u8() == 0 {
+				ech.next(5) // cipher suite and config ID
+				clear(ech.next(ech.u16()))
+				clear(ech.next(ech.u16()))
+			}
+		}
+	}
+	return stable
+}
+
+// JA4 returns the JA4 fingerprint of the hello, with sorted cipher suites
+// and extensions hashed
+func (h *ClientHello) JA4(protocol byte) string {
+	return h.ja4(protocol, false, false)
+}
+
+// JA4R returns the JA4_r fingerprint of the hello, the sorted lists JA4
+// hashes written out in full
+func (h *ClientHello) JA4R(protocol byte) string {
+	return h.ja4(protocol, false, true)
+}
+
+// JA4O returns the JA4_o fingerprint of the hello, hashing cipher suites and
+// all extensions in the order the client sent them
+func (h *ClientHello) JA4O(protocol byte) string {
+	return h.ja4(protocol, true, false)
+}
+
+// ja4 builds a JA4 variant, keeping the original order of the lists and
+// leaving them unhashed as asked
+func (h *ClientHello) ja4(protocol byte, original, raw bool) string {
+	ciphers := append([]uint16(nil), h.CipherSuites...)
+	extensions := make([]uint16, 0, len(h.Extensions))
+	for _, ext := range h.Extensions {
+		// SNI and ALPN are already in JA4_a, so only the original order keeps them
+		if original || (ext != extServerName && ext != extALPN) {
+			extensions = append(extensions, ext)
+		}
+	}
+	if !original {
+		sortUint16(ciphers)
+		sortUint16(extensions)
+	}
+
+	cipherList := BuildHexList(ciphers)
+	extensionList := BuildHexList(extensions)
+	if len(h.SignatureAlgorithms) > 0 {
+		extensionList += "_" + BuildHexList(h.SignatureAlgorithms)
+	}
+
+	a := h.ja4a(protocol)
+	if raw {
+		return a + "_" + cipherList + "_" + extensionList
+	}
+
+	b, c := "000000000000", "000000000000"
+	if len(ciphers) > 0 {
+		b = ComputeTruncatedSHA256(cipherList)
+	}
+	if len(extensions) > 0 {
+		c = ComputeTruncatedSHA256(extensionList)
+	}
+	return a + "_" + b + "_" + c
+}
+
+// ja4a returns the readable first part of a JA4 fingerprint: the protocol,
+// highest TLS version, SNI indicator, cipher suite and extension counts, and
+// the ends of the first ALPN value
+func (h *ClientHello) ja4a(protocol byte) string {
+	version := h.Version
+	if len(h.SupportedVersions) > 0 {
+		version = 0
+		for _, v := range h.SupportedVersions {
+			version = max(version, v)
+		}
+	}
+
+	sni := 'i'
+	if h.ServerName {
+		sni = 'd'
+	}
+
+	return fmt.Sprintf("%c%s%c%02d%02d%s", protocol, MapTLSVersion(version), sni,
+		min(len(h.CipherSuites), 99), min(len(h.Extensions), 99), alpnChars(h.ALPN))
+}
+
+// alpnChars returns the first and last characters of an ALPN value, or of
+// its hex encoding if either is not alphanumeric
+func alpnChars(alpn string) string {
+	if alpn == "" {
+		return "00"
+	}
+	first, last := alpn[0], alpn[len(alpn)-1]
+	if !isASCIIAlnum(first) || !isASCIIAlnum(last) {
+		hex := fmt.Sprintf("%x", []byte{first, last})
+		return hex[:1] + hex[len(hex)-1:]
+	}
+	return string([]byte{first, last})
+}
+
+func isASCIIAlnum(b byte) bool {
+	return b < 0x80 && IsAlnum(b)
+}
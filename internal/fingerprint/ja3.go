@@ -0,0 +1,191 @@
+package fingerprint
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// JA3 is the context key of a connection's JA3 fingerprint
+const JA3 JA4Key = "ja3"
+
+const (
+	handshakeClientHello = 0x01
+	handshakeServerHello = 0x02
+
+	extSupportedGroups = 0x000a
+	extPointFormats    = 0x000b
+)
+
+// errShortHello is returned for hellos cut off before a field JA3 needs
+var errShortHello = errors.New("payload too short")
+
+// helloReader reads the fields of a hello message, remembering whether any
+// read ran past the end
+type helloReader struct {
+	b   []byte
+	bad bool
+}
+
+func (r *helloReader) next(n int) []byte {
+	if r.bad || n > len(r.b) {
+		r.bad = true
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *helloReader) u8() int {
+	if v := r.next(1); v != nil {
+		return int(v[0])
+	}
+	return 0
+}
+
+func (r *helloReader) u16() int {
+	if v := r.next(2); v != nil {
+		return int(v[0])<<8 | int(v[1])
+	}
+	return 0
+}
+
+// uint16s reads a list of n bytes of 16-bit values, leaving out GREASE
+func (r *helloReader) uint16s(n int) []uint16 {
+	list := &helloReader{b: r.next(n)}
+	values := make([]uint16, 0, n/2)
+	for len(list.b) >= 2 {
+		if v := uint16(list.u16()); !IsGreaseValue(v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// readHello returns a reader positioned at the version of the hello in a TLS
+// handshake record, checking the handshake type
+func readHello(payload []byte, handshakeType byte) (*helloReader, error) {
+	r := &helloReader{b: payload}
+	r.next(5) // record header
+	typ := r.u8()
+	length := r.u8()<<16 | r.u16()
+	if r.bad {
+		return nil, errShortHello
+	}
+	if typ != int(handshakeType) {
+		return nil, errors.New("unexpected handshake message type")
+	}
+	if length < len(r.b) {
+		r.b = r.b[:length]
+	}
+	return r, nil
+}
+
+// ParseJA3 computes the JA3 fingerprint of a TLS record holding a
+// ClientHello. It returns the MD5 hash used to match threat intelligence and
+// the string it hashes: the decimal version, cipher suites, extensions,
+// supported groups, and EC point formats, leaving out GREASE values.
+func ParseJA3(payload []byte) (string, string, error) {
+	r, err := readHello(payload, handshakeClientHello)
+	if err != nil {
+		return "", "", err
+	}
+
+	version := r.u16()
+	r.next(32)     // random
+	r.next(r.u8()) // session ID
+	ciphers := r.uint16s(r.u16())
+	r.next(r.u8()) // compression methods
+	if r.bad {
+		return "", "", errShortHello
+	}
+
+	var extensions, groups, pointFormats []uint16
+	exts := &helloReader{b: r.next(r.u16())}
+	for len(exts.b) >= 4 {
+		typ := uint16(exts.u16())
+		data := &helloReader{b: exts.next(exts.u16())}
+		if exts.bad {
+			break
+		}
+		if IsGreaseValue(typ) {
+			continue
+		}
+		extensions = append(extensions, typ)
+
+		switch typ {
+		case extSupportedGroups:
+			groups = data.uint16s(data.u16())
+		case extPointFormats:
+			for _, f := range data.next(data.u8()) {
+				pointFormats = append(pointFormats, uint16(f))
+			}
+		}
+	}
+
+	raw := strings.Join([]string{
+		strconv.Itoa(version),
+		joinDecimal(ciphers),
+		joinDecimal(extensions),
+		joinDecimal(groups),
+		joinDecimal(pointFormats),
+	}, ",")
+	return md5Hex(raw), raw, nil
+}
+
+// ParseJA3S computes the JA3S fingerprint of a TLS record holding a
+// ServerHello, returning the MD5 hash and the string it hashes: the decimal
+// version, chosen cipher suite, and extensions
+func ParseJA3S(payload []byte) (string, string, error) {
+	r, err := readHello(payload, handshakeServerHello)
+	if err != nil {
+		return "", "", err
+	}
+
+	version := r.u16()
+	r.next(32)     // random
+	r.next(r.u8()) // session ID
+	cipher := r.u16()
+	r.next(1) // compression method
+	if r.bad {
+		return "", "", errShortHello
+	}
+
+	var extensions []uint16
+	if len(r.b) >= 2 {
+		exts := &helloReader{b: r.next(r.u16())}
+		for len(exts.b) >= 4 {
+			typ := uint16(exts.u16())
+			exts.next(exts.u16())
+			if exts.bad {
+				break
+			}
+			extensions = append(extensions, typ)
+		}
+	}
+
+	raw := strings.Join([]string{
+		strconv.Itoa(version),
+		strconv.Itoa(cipher),
+		joinDecimal(extensions),
+	}, ",")
+	return md5Hex(raw), raw, nil
+}
+
+// joinDecimal joins values in decimal with dashes, as JA3 does
+func joinDecimal(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(parts, "-")
+}
+
+// md5Hex returns the hex MD5 digest of s
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
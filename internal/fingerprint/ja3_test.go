@@ -0,0 +1,132 @@
+package fingerprint
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseJA3(t *testing.T) {
+	// TLS 1.2, ciphers GREASE and 0xc02b, then GREASE, supported groups
+	// (GREASE, x25519, secp256r1), and EC point formats (uncompressed)
+	hello := "\x03\x03" + strings.Repeat("\x00", 32) + "\x00" +
+		"\x00\x04\x0a\x0a\xc0\x2b" +
+		"\x01\x00" +
+		"\x00\x16" +
+		"\x1a\x1a\x00\x00" +
+		"\x00\x0a\x00\x08\x00\x06\x2a\x2a\x00\x1d\x00\x17" +
+		"\x00\x0b\x00\x02\x01\x00"
+	record := []byte("\x16\x03\x01\x00\x00\x01\x00\x00\x00" + hello)
+	record[4] = byte(len(hello) + 4)
+	record[8] = byte(len(hello))
+
+	hash, raw, err := ParseJA3(record)
+	if err != nil {
+		t.Fatalf("Expected ClientHello to parse, got %v", err)
+	}
+	if want := "771,49195,10-11,29-23,0"; raw != want {
+		t.Fatalf("Expected JA3 string %q, got %q", want, raw)
+	}
+	if hash != md5Hex(raw) {
+		t.Fatalf("Expected hash %s of the JA3 string, got %s", md5Hex(raw), hash)
+	}
+
+	if _, _, err := ParseJA3(record[:20]); err == nil {
+		t.Fatalf("Expected truncated ClientHello to fail")
+	}
+}
+
+func TestParseJA3_CryptoTLS(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go tls.Client(client, &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}).Handshake()
+
+	buf := make([]byte, 1<<14)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to read ClientHello: %v", err)
+	}
+	if _, raw, err := ParseJA3(buf[:n]); err != nil || !strings.HasPrefix(raw, "771,") {
+		t.Fatalf("Expected crypto/tls ClientHello to parse, got %q, %v", raw, err)
+	}
+	if _, _, err := ParseJA3S(buf[:n]); err == nil {
+		t.Fatalf("Expected JA3S of a ClientHello to fail")
+	}
+}
+
+func TestParseJA3S(t *testing.T) {
+	// TLS 1.2 choosing 0xc02f with the renegotiation_info extension
+	hello := "\x03\x03" + strings.Repeat("\x00", 32) + "\x00" +
+		"\xc0\x2f\x00" +
+		"\x00\x05\xff\x01\x00\x01\x00"
+	record := []byte("\x16\x03\x03\x00\x00\x02\x00\x00\x00" + hello)
+	record[4] = byte(len(hello) + 4)
+	record[8] = byte(len(hello))
+
+	hash, raw, err := ParseJA3S(record)
+	if err != nil {
+		t.Fatalf("Expected ServerHello to parse, got %v", err)
+	}
+	if want := "771,49199,65281"; raw != want {
+		t.Fatalf("Expected JA3S string %q, got %q", want, raw)
+	}
+	if hash != md5Hex(raw) {
+		t.Fatalf("Expected hash %s of the JA3S string, got %s", md5Hex(raw), hash)
+	}
+}
+
+func FuzzParseJA3(f *testing.F) {
+	for _, record := range seedClientHellos(f) {
+		f.Add(record)
+	}
+	f.Add([]byte{0x16, 0x03, 0x01, 0x00, 0x04, 0x01, 0x00, 0x00, 0x00})
+
+	f.Fuzz(func(t *testing.T, record []byte) {
+		record = record[:len(record):len(record)]
+		ParseJA3(record)
+		ParseJA3S(record)
+	})
+}
+
+func TestStableClientHello(t *testing.T) {
+	// crypto/tls sends a fresh random, session ID, and key shares on every
+	// connection
+	hellos := make([][]byte, 2)
+	for i := range hellos {
+		client, server := net.Pipe()
+		go tls.Client(client, &tls.Config{InsecureSkipVerify: true, ServerName: "example.com"}).Handshake()
+		buf := make([]byte, 1<<14)
+		n, err := server.Read(buf)
+		if err != nil {
+			t.Fatalf("Failed to read ClientHello: %v", err)
+		}
+		hellos[i] = buf[:n]
+		client.Close()
+		server.Close()
+	}
+	if bytes.Equal(hellos[0], hellos[1]) {
+		t.Fatalf("Expected the raw hellos to differ")
+	}
+
+	stable := StableClientHello(hellos[0])
+	if !bytes.Equal(stable, StableClientHello(hellos[1])) {
+		t.Fatalf("Expected the stable hellos to be equal")
+	}
+	original, _ := ParseClientHello(hellos[0])
+	parsed, err := ParseClientHello(stable)
+	if err != nil || parsed.JA4('t') != original.JA4('t') || parsed.JA4O('t') != original.JA4O('t') {
+		t.Fatalf("Expected the stable hello to keep its JA4, got %v", err)
+	}
+	ja3, _, _ := ParseJA3(hellos[0])
+	if got, _, _ := ParseJA3(stable); got != ja3 {
+		t.Fatalf("Expected the stable hello to keep JA3 %s, got %s", ja3, got)
+	}
+
+	if junk := []byte{1, 2, 3}; !bytes.Equal(StableClientHello(junk), junk) {
+		t.Fatalf("Expected a record that does not parse to be copied as is")
+	}
+}
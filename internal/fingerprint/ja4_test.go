@@ -0,0 +1,125 @@
+package fingerprint
+
+import (
+	"strings"
+	"testing"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// seedClientHellos returns ClientHello records of common browsers to seed
+// the fuzzers with
+func seedClientHellos(f *testing.F) [][]byte {
+	f.Helper()
+
+	ids := []utls.ClientHelloID{utls.HelloChrome_Auto, utls.HelloFirefox_Auto, utls.HelloSafari_Auto}
+	records := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		client := utls.UClient(nil, &utls.Config{ServerName: "example.com"}, id)
+		if err := client.BuildHandshakeState(); err != nil {
+			f.Fatalf("Failed to build %s ClientHello: %v", id.Str(), err)
+		}
+		hello := client.HandshakeState.Hello.Raw
+		records = append(records, append([]byte{0x16, 0x03, 0x01, byte(len(hello) >> 8), byte(len(hello))}, hello...))
+	}
+	return records
+}
+
+// chromeHello builds the ClientHello of the JA4 specification's Chrome
+// example, with GREASE values where Chrome sends them
+func chromeHello() []byte {
+	u16 := func(b []byte, v int) []byte { return append(b, byte(v>>8), byte(v)) }
+
+	ciphers := []int{0x0a0a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030,
+		0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035}
+	extensions := []struct {
+		typ  int
+		data []byte
+	}{
+		{0x1a1a, nil},
+		{0x0033, nil}, {0x4469, nil}, {0x002b, []byte{4, 0x2a, 0x2a, 0x03, 0x04}},
+		{0x0010, []byte{0, 3, 2, 'h', '2'}}, {0x0017, nil}, {0xff01, nil}, {0x0005, nil},
+		{0x000d, []byte{0, 16, 4, 3, 8, 4, 4, 1, 5, 3, 8, 5, 5, 1, 8, 6, 6, 1}},
+		{0x0000, nil}, {0x002d, nil}, {0x000a, nil}, {0x0012, nil}, {0x001b, nil},
+		{0x000b, nil}, {0x0023, nil}, {0x0015, nil},
+	}
+
+	body := u16(nil, 0x0303)
+	body = append(body, make([]byte, 33)...) // random and an empty session ID
+	body = u16(body, 2*len(ciphers))
+	for _, c := range ciphers {
+		body = u16(body, c)
+	}
+	body = append(body, 1, 0) // compression methods
+	var exts []byte
+	for _, e := range extensions {
+		exts = u16(u16(exts, e.typ), len(e.data))
+		exts = append(exts, e.data...)
+	}
+	body = append(u16(body, len(exts)), exts...)
+
+	hello := append([]byte{0x01, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	return append([]byte{0x16, 0x03, 0x01, byte(len(hello) >> 8), byte(len(hello))}, hello...)
+}
+
+func TestClientHello_JA4(t *testing.T) {
+	h, err := ParseClientHello(chromeHello())
+	if err != nil {
+		t.Fatalf("Failed to parse ClientHello: %v", err)
+	}
+
+	original := "1301,1302,1303,c02b,c02f,c02c,c030,cca9,cca8,c013,c014,009c,009d,002f,0035_" +
+		"0033,4469,002b,0010,0017,ff01,0005,000d,0000,002d,000a,0012,001b,000b,0023,0015_" +
+		"0403,0804,0401,0503,0805,0501,0806,0601"
+	parts := strings.SplitN(original, "_", 2)
+
+	cases := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"JA4", h.JA4('t'), "t13d1516h2_8daaf6152771_e5627efa2ab1"},
+		{"JA4_r", h.JA4R('t'), "t13d1516h2_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_" +
+			"0005,000a,000b,000d,0012,0015,0017,001b,0023,002b,002d,0033,4469,ff01_0403,0804,0401,0503,0805,0501,0806,0601"},
+		{"JA4_o", h.JA4O('t'), "t13d1516h2_" + ComputeTruncatedSHA256(parts[0]) + "_" + ComputeTruncatedSHA256(parts[1])},
+	}
+	for _, tc := range cases {
+		if tc.got != tc.want {
+			t.Fatalf("Expected %s %s, got %s", tc.name, tc.want, tc.got)
+		}
+	}
+
+	if got := alpnChars("\xabhttp/1.1\xcd"); got != "ad" {
+		t.Fatalf("Expected non-alphanumeric ALPN as hex, got %s", got)
+	}
+}
+
+func FuzzParseJA4(f *testing.F) {
+	for _, record := range seedClientHellos(f) {
+		f.Add(record)
+	}
+	f.Add([]byte{0x16, 0x03, 0x01, 0x00, 0x04, 0x01, 0x00, 0x00, 0x00})
+
+	// An odd-length signature algorithm list ending the record
+	f.Add([]byte("\x16\x03\x01\x006\x01\x00\x002\x03\x03" + strings.Repeat("\x00", 33) +
+		"\x00\x02\x13\x01\x01\x00\x00\x07\x00\x0d\x00\x03\x00\x01\x04"))
+
+	f.Fuzz(func(t *testing.T, record []byte) {
+		// Reading past the end must fail even where the slice has capacity
+		ParseJA4(record[:len(record):len(record)], 't')
+	})
+}
+
+func FuzzJA4UnmarshalBytes(f *testing.F) {
+	for _, record := range seedClientHellos(f) {
+		f.Add(record)
+	}
+	f.Add([]byte{0x16, 0x03, 0x01, 0x00, 0x04, 0x01, 0x00, 0x00, 0x00})
+
+	f.Fuzz(func(t *testing.T, record []byte) {
+		var j JA4Fingerprint
+		if j.UnmarshalBytes(record[:len(record):len(record)], 't') == nil {
+			_ = j.String()
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package fingerprint
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// JA4H is the context key of a request's JA4H fingerprint
+const JA4H JA4Key = "ja4h"
+
+// emptyJA4HHash stands in for the cookie hashes of requests without cookies
+const emptyJA4HHash = "000000000000"
+
+// ComputeJA4H returns the JA4H fingerprint of an HTTP request: its method,
+// version, whether it sent cookies and a referer, how many other headers it
+// sent, and its preferred language, then hashes of its header names, cookie
+// names, and cookies.
+//
+// net/http keeps neither the order nor the case of header names, so they are
+// hashed sorted, in canonical form over HTTP/1.x and lower case over HTTP/2
+// and HTTP/3 as clients send them there. Requests sending the same headers in
+// another order share a fingerprint.
+func ComputeJA4H(r *http.Request) string {
+	names := make([]string, 0, len(r.Header)+1)
+	if r.ProtoMajor < 2 && r.Host != "" {
+		names = append(names, "Host")
+	}
+	for name, values := range r.Header {
+		if name == "Cookie" || name == "Referer" {
+			continue
+		}
+		if r.ProtoMajor >= 2 {
+			name = strings.ToLower(name)
+		}
+		for range values {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	cookie, referer := 'n', 'n'
+	cookies := r.Cookies()
+	if len(cookies) > 0 {
+		cookie = 'c'
+	}
+	if r.Header.Get("Referer") != "" {
+		referer = 'r'
+	}
+
+	a := fmt.Sprintf("%s%s%c%c%02d%s", ja4hMethod(r.Method), ja4hVersion(r),
+		cookie, referer, min(len(names), 99), ja4hLanguage(r.Header.Get("Accept-Language")))
+	b := ComputeTruncatedSHA256(strings.Join(names, ","))
+
+	c, d := emptyJA4HHash, emptyJA4HHash
+	if len(cookies) > 0 {
+		cookieNames := make([]string, len(cookies))
+		cookieFields := make([]string, len(cookies))
+		for i, ck := range cookies {
+			cookieNames[i] = ck.Name
+			cookieFields[i] = ck.Name + "=" + ck.Value
+		}
+		slices.Sort(cookieNames)
+		slices.Sort(cookieFields)
+		c = ComputeTruncatedSHA256(strings.Join(cookieNames, ","))
+		d = ComputeTruncatedSHA256(strings.Join(cookieFields, ","))
+	}
+
+	return a + "_" + b + "_" + c + "_" + d
+}
+
+// ja4hMethod returns the first two letters of a method in lower case
+func ja4hMethod(method string) string {
+	m := strings.ToLower(method)
+	for len(m) < 2 {
+		m += "0"
+	}
+	return m[:2]
+}
+
+// ja4hVersion returns a request's HTTP version as two digits
+func ja4hVersion(r *http.Request) string {
+	switch {
+	case r.ProtoMajor >= 2:
+		return fmt.Sprintf("%d0", min(r.ProtoMajor, 9))
+	case r.ProtoMinor == 0:
+		return "10"
+	default:
+		return "11"
+	}
+}
+
+// ja4hLanguage returns the first four characters of the first language in
+// an Accept-Language header, without hyphens and padded with zeros
+func ja4hLanguage(header string) string {
+	lang := strings.ToLower(strings.ReplaceAll(header, "-", ""))
+	lang, _, _ = strings.Cut(strings.ReplaceAll(lang, ";", ","), ",")
+	lang = strings.TrimSpace(lang)
+	if len(lang) > 4 {
+		lang = lang[:4]
+	}
+	return lang + strings.Repeat("0", 4-len(lang))
+}
@@ -0,0 +1,31 @@
+package fingerprint
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestComputeJA4H(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://example.com/", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0")
+	r.Header.Set("Accept", "*/*")
+	r.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	r.Header.Set("Referer", "http://example.com/")
+	r.Header.Set("Cookie", "sid=xyz; a=1")
+
+	want := "ge11cr04enus_1020f15d5506_485ab0ac9965_5848ddf7f4f6"
+	if got := ComputeJA4H(r); got != want {
+		t.Fatalf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestComputeJA4H_NoCookies(t *testing.T) {
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/1.0", 1, 0
+	r.Host = ""
+
+	want := "po10nn000000_" + ComputeTruncatedSHA256("") + "_000000000000_000000000000"
+	if got := ComputeJA4H(r); got != want {
+		t.Fatalf("Expected %s, got %s", want, got)
+	}
+}
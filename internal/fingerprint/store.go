@@ -0,0 +1,99 @@
+package fingerprint
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxStoreEntries bounds the store. Once full, recording a new fingerprint
+// evicts the one seen least recently.
+const maxStoreEntries = 10000
+
+// Entry is a JA4 fingerprint seen since the store was last cleared
+type Entry struct {
+	Fingerprint string    `json:"fingerprint"`
+	Count       int       `json:"count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	LastSource  string    `json:"last_source"`
+}
+
+// Store keeps the JA4 fingerprints of recent TLS connections in memory, so
+// fingerprinting can be inspected without querying the database
+type Store struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+}
+
+// NewStore creates an empty fingerprint store
+func NewStore() *Store {
+	return &Store{entries: make(map[string]*Entry)}
+}
+
+// Record counts a fingerprint seen from source. A nil store discards it.
+func (s *Store) Record(fingerprint, source string) {
+	if s == nil || fingerprint == "" {
+		return
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[fingerprint]
+	if !ok {
+		if len(s.entries) >= maxStoreEntries {
+			s.evictOldest()
+		}
+		e = &Entry{Fingerprint: fingerprint, FirstSeen: now}
+		s.entries[fingerprint] = e
+	}
+	e.Count++
+	e.LastSeen = now
+	e.LastSource = source
+}
+
+// evictOldest removes the entry seen least recently
+func (s *Store) evictOldest() {
+	var oldest *Entry
+	for _, e := range s.entries {
+		if oldest == nil || e.LastSeen.Before(oldest.LastSeen) {
+			oldest = e
+		}
+	}
+	if oldest != nil {
+		delete(s.entries, oldest.Fingerprint)
+	}
+}
+
+// Search returns copies of the entries whose fingerprint contains query,
+// most seen first. An empty query returns every entry.
+func (s *Store) Search(query string) []Entry {
+	s.mu.Lock()
+	result := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		if strings.Contains(e.Fingerprint, query) {
+			result = append(result, *e)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Fingerprint < result[j].Fingerprint
+	})
+	return result
+}
+
+// Clear removes every entry and returns how many there were
+func (s *Store) Clear() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.entries)
+	s.entries = make(map[string]*Entry)
+	return n
+}
@@ -0,0 +1,30 @@
+package fingerprint
+
+import "testing"
+
+func TestStore_RecordSearchClear(t *testing.T) {
+	s := NewStore()
+	s.Record("t13d1516h2_8daaf6152771_02713d6af862", "203.0.113.7")
+	s.Record("t13d1516h2_8daaf6152771_02713d6af862", "203.0.113.8")
+	s.Record("t12d1209h1_c866b44c5a26_b5d4cf4aa9ca", "198.51.100.1")
+	s.Record("", "198.51.100.1")
+
+	all := s.Search("")
+	if len(all) != 2 {
+		t.Fatalf("Expected 2 fingerprints, got %d", len(all))
+	}
+	if all[0].Count != 2 || all[0].LastSource != "203.0.113.8" {
+		t.Fatalf("Expected the most seen fingerprint first, got %+v", all[0])
+	}
+
+	if found := s.Search("t12d"); len(found) != 1 || found[0].Fingerprint != "t12d1209h1_c866b44c5a26_b5d4cf4aa9ca" {
+		t.Fatalf("Expected 1 TLS 1.2 fingerprint, got %+v", found)
+	}
+
+	if n := s.Clear(); n != 2 {
+		t.Fatalf("Expected 2 cleared entries, got %d", n)
+	}
+	if len(s.Search("")) != 0 {
+		t.Fatal("Expected an empty store after clearing")
+	}
+}
@@ -0,0 +1,102 @@
+package firewall
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// multiportLimit is the most ports or ranges one iptables multiport match
+// accepts, with each range counting as two
+const multiportLimit = 15
+
+// PortRange is an inclusive range of ports
+type PortRange struct {
+	Start int
+	End   int
+}
+
+// Ranges sorts ports and collapses consecutive runs into ranges
+func Ranges(ports []int) []PortRange {
+	sorted := append([]int(nil), ports...)
+	sort.Ints(sorted)
+
+	ranges := make([]PortRange, 0)
+	for _, port := range sorted {
+		if n := len(ranges); n > 0 && port <= ranges[n-1].End+1 {
+			if port > ranges[n-1].End {
+				ranges[n-1].End = port
+			}
+			continue
+		}
+		ranges = append(ranges, PortRange{Start: port, End: port})
+	}
+	return ranges
+}
+
+// NFTables returns an nftables ruleset redirecting inbound TCP traffic for
+// ports to the target port
+func NFTables(ports []int, target int) string {
+	elements := make([]string, 0)
+	for _, r := range Ranges(ports) {
+		elements = append(elements, r.format("-"))
+	}
+
+	var b strings.Builder
+	b.WriteString("table inet service_spoof {\n")
+	b.WriteString("\tchain prerouting {\n")
+	b.WriteString("\t\ttype nat hook prerouting priority dstnat; policy accept;\n")
+	fmt.Fprintf(&b, "\t\ttcp dport { %s } redirect to :%d\n", strings.Join(elements, ", "), target)
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// IPTables returns iptables and ip6tables commands redirecting inbound TCP
+// traffic for ports to the target port
+func IPTables(ports []int, target int) string {
+	var b strings.Builder
+
+	for _, group := range multiportGroups(Ranges(ports)) {
+		elements := make([]string, 0, len(group))
+		for _, r := range group {
+			elements = append(elements, r.format(":"))
+		}
+		for _, cmd := range []string{"iptables", "ip6tables"} {
+			fmt.Fprintf(&b, "%s -t nat -A PREROUTING -p tcp -m multiport --dports %s -j REDIRECT --to-ports %d\n",
+				cmd, strings.Join(elements, ","), target)
+		}
+	}
+	return b.String()
+}
+
+// multiportGroups splits ranges into groups that fit a multiport match
+func multiportGroups(ranges []PortRange) [][]PortRange {
+	groups := make([][]PortRange, 0)
+	var group []PortRange
+	size := 0
+
+	for _, r := range ranges {
+		cost := 1
+		if r.Start != r.End {
+			cost = 2
+		}
+		if size+cost > multiportLimit {
+			groups = append(groups, group)
+			group, size = nil, 0
+		}
+		group = append(group, r)
+		size += cost
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func (r PortRange) format(sep string) string {
+	if r.Start == r.End {
+		return fmt.Sprint(r.Start)
+	}
+	return fmt.Sprintf("%d%s%d", r.Start, sep, r.End)
+}
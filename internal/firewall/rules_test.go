@@ -0,0 +1,31 @@
+package firewall
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNFTables(t *testing.T) {
+	rules := NFTables([]int{8002, 80, 8000, 8001, 443, 8080}, 10000)
+
+	if !strings.Contains(rules, "tcp dport { 80, 443, 8000-8002, 8080 } redirect to :10000") {
+		t.Fatalf("Expected collapsed port ranges, got:\n%s", rules)
+	}
+}
+
+func TestIPTables(t *testing.T) {
+	ports := make([]int, 0)
+	for p := 1; p <= 40; p += 2 {
+		ports = append(ports, p)
+	}
+
+	lines := strings.Split(strings.TrimSpace(IPTables(ports, 10000)), "\n")
+
+	// 20 single ports need two multiport matches, each for IPv4 and IPv6
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 rules, got %d:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	if !strings.HasPrefix(lines[0], "iptables -t nat -A PREROUTING -p tcp -m multiport --dports 1,3,5,") {
+		t.Fatalf("Unexpected rule: %s", lines[0])
+	}
+}
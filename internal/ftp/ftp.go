@@ -0,0 +1,243 @@
+// Package ftp answers FTP clients as vsftpd, ProFTPD, or Microsoft's FTP
+// service would, speaking enough of RFC 959 to accept any login and answer
+// the commands scanners and brute-forcers send next. Every line exchanged is
+// recorded. Data connections are never opened, so listings and transfers fail
+// as they would behind a firewall blocking them.
+package ftp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+const (
+	// idleTimeout bounds how long a client may take to send a command
+	idleTimeout = 60 * time.Second
+
+	// maxSession bounds how long a session may last
+	maxSession = 10 * time.Minute
+
+	// maxCommands bounds the commands answered in a session
+	maxCommands = 500
+
+	// maxLine bounds the length of a command line
+	maxLine = 1024
+
+	// maxTranscript bounds the transcript recorded for a session
+	maxTranscript = 64 << 10
+)
+
+// Server answers FTP connections
+type Server struct {
+	flavor flavor
+	banner string
+}
+
+// NewServer creates a server answering as the configured FTP server
+func NewServer(cfg *config.FTPConfig) *Server {
+	s := &Server{flavor: flavors[cfg.GetServer()]}
+	if cfg != nil {
+		s.banner = cfg.Banner
+	}
+	return s
+}
+
+// Banner returns the greeting the server sends clients connecting from its
+// local address
+func (s *Server) Banner(local net.Addr) string {
+	if s.banner != "" {
+		return "220 " + s.banner
+	}
+	host := local.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return "220 " + reply(s.flavor.greeting, host)
+}
+
+// Session is what a client did before the connection was closed
+type Session struct {
+	Start       time.Time
+	Duration    time.Duration
+	Credentials []database.Credential
+	Commands    int
+	Transcript  string
+
+	// Err is why the session ended other than with QUIT, if it did
+	Err error
+}
+
+// state is where a client's session stands
+type state struct {
+	user     string
+	loggedIn bool
+	cwd      string
+	passive  bool
+}
+
+// Handle greets a client and answers its commands until it quits, goes
+// idle, or reaches the session limits. The caller closes the connection.
+func (s *Server) Handle(conn net.Conn) *Session {
+	sess := &Session{Start: time.Now()}
+	var transcript strings.Builder
+	defer func() {
+		sess.Duration = time.Since(sess.Start)
+		sess.Transcript = transcript.String()
+	}()
+
+	record := func(prefix, line string) {
+		if transcript.Len()+len(line) < maxTranscript {
+			transcript.WriteString(prefix + line + "\n")
+		}
+	}
+	send := func(line string) error {
+		for _, l := range strings.Split(line, "\r\n") {
+			record("S: ", l)
+		}
+		_, err := io.WriteString(conn, line+"\r\n")
+		return err
+	}
+
+	if sess.Err = send(s.Banner(conn.LocalAddr())); sess.Err != nil {
+		return sess
+	}
+
+	st := &state{cwd: "/"}
+	r := bufio.NewReaderSize(conn, maxLine)
+	deadline := sess.Start.Add(maxSession)
+	for sess.Commands < maxCommands {
+		conn.SetReadDeadline(minTime(time.Now().Add(idleTimeout), deadline))
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				send("421 Timeout.")
+			}
+			if !errors.Is(err, io.EOF) {
+				sess.Err = err
+			}
+			return sess
+		}
+
+		text := strings.TrimRight(string(line), "\r\n")
+		record("C: ", text)
+		sess.Commands++
+
+		cmd, arg, _ := strings.Cut(text, " ")
+		cmd = strings.ToUpper(cmd)
+		if cmd == "PASS" && st.user != "" {
+			sess.Credentials = append(sess.Credentials, database.Credential{Username: st.user, Password: arg})
+		}
+
+		answer, quit := s.answer(st, cmd, arg, conn.LocalAddr())
+		if err := send(answer); err != nil {
+			sess.Err = err
+			return sess
+		}
+		if quit {
+			return sess
+		}
+	}
+	send("421 Too many commands.")
+	return sess
+}
+
+// answer returns the reply to a command, and whether the session ends
+func (s *Server) answer(st *state, cmd, arg string, local net.Addr) (string, bool) {
+	f := s.flavor
+
+	switch cmd {
+	case "USER":
+		st.user, st.loggedIn = arg, false
+		return reply(f.user, arg), false
+	case "PASS":
+		if st.user == "" {
+			return "503 Login with USER first.", false
+		}
+		st.loggedIn = true
+		return reply(f.pass, st.user), false
+	case "QUIT":
+		return f.goodbye, true
+	case "FEAT":
+		return f.feat, false
+	case "SYST":
+		return f.syst, false
+	case "NOOP":
+		return f.noop, false
+	}
+
+	if !st.loggedIn {
+		return f.notLoggedIn, false
+	}
+
+	switch cmd {
+	case "PWD", "XPWD":
+		return reply(f.pwd, st.cwd), false
+	case "CWD", "XCWD":
+		if arg == "" {
+			arg = "/"
+		}
+		if !path.IsAbs(arg) {
+			arg = path.Join(st.cwd, arg)
+		}
+		st.cwd = path.Clean(arg)
+		return f.cwd, false
+	case "CDUP", "XCUP":
+		st.cwd = path.Dir(st.cwd)
+		return f.cwd, false
+	case "TYPE":
+		code := strings.ToUpper(strings.TrimSpace(arg))
+		if f.typeNames {
+			if strings.HasPrefix(code, "I") {
+				code = "Binary"
+			} else {
+				code = "ASCII"
+			}
+		}
+		return reply(f.typeSet, code), false
+	case "PASV":
+		st.passive = true
+		ip := net.IPv4(127, 0, 0, 1)
+		if tcp, ok := local.(*net.TCPAddr); ok && tcp.IP.To4() != nil {
+			ip = tcp.IP.To4()
+		}
+		port := passivePort()
+		return fmt.Sprintf("227 Entering Passive Mode (%d,%d,%d,%d,%d,%d).", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff), false
+	case "EPSV":
+		st.passive = true
+		return fmt.Sprintf("229 Entering Extended Passive Mode (|||%d|)", passivePort()), false
+	case "PORT", "EPRT":
+		st.passive = true
+		return f.port, false
+	case "LIST", "NLST", "MLSD", "RETR", "STOR", "STOU", "APPE":
+		if !st.passive {
+			return f.noDataConn, false
+		}
+		st.passive = false
+		return f.failDataConn, false
+	}
+	return reply(f.unknown, cmd), false
+}
+
+// passivePort returns a port from the range servers commonly hand out for
+// passive data connections
+func passivePort() int {
+	return 30000 + rand.IntN(20000)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
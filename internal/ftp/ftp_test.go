@@ -0,0 +1,74 @@
+package ftp
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestServer_Handle(t *testing.T) {
+	server, client := net.Pipe()
+	srv := NewServer(&config.FTPConfig{Server: config.FTPServerVsftpd})
+
+	done := make(chan *Session)
+	go func() {
+		sess := srv.Handle(server)
+		server.Close()
+		done <- sess
+	}()
+
+	r := bufio.NewReader(client)
+	expect := func(want string) {
+		t.Helper()
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read reply: %v", err)
+		}
+		if line != want+"\r\n" {
+			t.Fatalf("Expected %q, got %q", want, line)
+		}
+	}
+	send := func(line string) {
+		t.Helper()
+		if _, err := client.Write([]byte(line + "\r\n")); err != nil {
+			t.Fatalf("Failed to send %q: %v", line, err)
+		}
+	}
+
+	expect("220 (vsFTPd 3.0.3)")
+	send("PWD")
+	expect("530 Please login with USER and PASS.")
+	send("USER admin")
+	expect("331 Please specify the password.")
+	send("PASS hunter2")
+	expect("230 Login successful.")
+	send("SYST")
+	expect("215 UNIX Type: L8")
+	send("CWD pub")
+	expect("250 Directory successfully changed.")
+	send("PWD")
+	expect(`257 "/pub" is the current directory`)
+	send("TYPE I")
+	expect("200 Switching to Binary mode.")
+	send("LIST")
+	expect("425 Use PORT or PASV first.")
+	send("QUIT")
+	expect("221 Goodbye.")
+
+	sess := <-done
+	if sess.Err != nil {
+		t.Fatalf("Expected the session to end with QUIT, got %v", sess.Err)
+	}
+	if len(sess.Credentials) != 1 || sess.Credentials[0].Username != "admin" || sess.Credentials[0].Password != "hunter2" {
+		t.Fatalf("Expected the login to be recorded, got %+v", sess.Credentials)
+	}
+	if sess.Commands != 9 {
+		t.Fatalf("Expected 9 commands, got %d", sess.Commands)
+	}
+	if !strings.Contains(sess.Transcript, "C: PASS hunter2\nS: 230 Login successful.\n") {
+		t.Fatalf("Expected the transcript to record the exchange, got %q", sess.Transcript)
+	}
+}
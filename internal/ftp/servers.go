@@ -0,0 +1,97 @@
+package ftp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// flavor is the wording of an FTP server's replies. Replies taking the
+// username, directory, type, or command have a %s for it.
+type flavor struct {
+	// typeNames names transfer types Binary and ASCII in typeSet, rather
+	// than by their code
+	typeNames bool
+
+	greeting     string
+	user         string
+	pass         string
+	notLoggedIn  string
+	syst         string
+	feat         string
+	pwd          string
+	cwd          string
+	typeSet      string
+	noop         string
+	port         string
+	noDataConn   string
+	failDataConn string
+	unknown      string
+	goodbye      string
+}
+
+// flavors are the replies of each server an ftp service can answer as
+var flavors = map[string]flavor{
+	config.FTPServerVsftpd: {
+		typeNames:    true,
+		greeting:     "(vsFTPd 3.0.3)",
+		user:         "331 Please specify the password.",
+		pass:         "230 Login successful.",
+		notLoggedIn:  "530 Please login with USER and PASS.",
+		syst:         "215 UNIX Type: L8",
+		feat:         "211-Features:\r\n EPRT\r\n EPSV\r\n MDTM\r\n PASV\r\n REST STREAM\r\n SIZE\r\n TVFS\r\n UTF8\r\n211 End",
+		pwd:          "257 \"%s\" is the current directory",
+		cwd:          "250 Directory successfully changed.",
+		typeSet:      "200 Switching to %s mode.",
+		noop:         "200 NOOP ok.",
+		port:         "200 PORT command successful. Consider using PASV.",
+		noDataConn:   "425 Use PORT or PASV first.",
+		failDataConn: "425 Failed to establish connection.",
+		unknown:      "500 Unknown command.",
+		goodbye:      "221 Goodbye.",
+	},
+	config.FTPServerProFTPD: {
+		greeting:     "ProFTPD Server (ProFTPD Default Installation) [%s]",
+		user:         "331 Password required for %s",
+		pass:         "230 User %s logged in",
+		notLoggedIn:  "530 Please login with USER and PASS",
+		syst:         "215 UNIX Type: L8",
+		feat:         "211-Features:\r\n LANG en-US*\r\n MDTM\r\n MFMT\r\n TVFS\r\n UTF8\r\n MFF modify;UNIX.group;UNIX.mode;\r\n MLST modify*;perm*;size*;type*;unique*;UNIX.group*;UNIX.mode*;UNIX.owner*;\r\n REST STREAM\r\n SIZE\r\n211 End",
+		pwd:          "257 \"%s\" is the current directory",
+		cwd:          "250 CWD command successful",
+		typeSet:      "200 Type set to %s",
+		noop:         "200 NOOP command successful",
+		port:         "200 PORT command successful",
+		noDataConn:   "425 Unable to build data connection: No such file or directory",
+		failDataConn: "425 Unable to build data connection: Connection refused",
+		unknown:      "500 %s not understood",
+		goodbye:      "221 Goodbye.",
+	},
+	config.FTPServerIIS: {
+		greeting:     "Microsoft FTP Service",
+		user:         "331 Password required",
+		pass:         "230 User logged in.",
+		notLoggedIn:  "530 Please login with USER and PASS.",
+		syst:         "215 Windows_NT",
+		feat:         "211-Extended features supported:\r\n LANG EN*\r\n UTF8\r\n AUTH TLS;TLS-C;SSL;TLS-P;\r\n PBSZ\r\n PROT C;P;\r\n CCC\r\n HOST\r\n SIZE\r\n MDTM\r\n REST STREAM\r\n211 END",
+		pwd:          "257 \"%s\" is current directory.",
+		cwd:          "250 CWD command successful.",
+		typeSet:      "200 Type set to %s.",
+		noop:         "200 NOOP command successful.",
+		port:         "200 PORT command successful.",
+		noDataConn:   "425 Use PORT or PASV first.",
+		failDataConn: "425 Cannot open data connection.",
+		unknown:      "500 Command not understood.",
+		goodbye:      "221 Goodbye.",
+	},
+}
+
+// reply formats a reply that may take an argument, leaving replies without a
+// %s unchanged
+func reply(format, arg string) string {
+	if !strings.Contains(format, "%s") {
+		return format
+	}
+	return fmt.Sprintf(format, arg)
+}
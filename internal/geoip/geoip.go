@@ -0,0 +1,157 @@
+package geoip
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Record is what is known about the network an address belongs to
+type Record struct {
+	Country string `json:"country"`
+	ASN     int    `json:"asn"`
+	Org     string `json:"org"`
+}
+
+// ipRange is an inclusive range of addresses announced by one AS
+type ipRange struct {
+	start  netip.Addr
+	end    netip.Addr
+	record Record
+}
+
+// DB looks up the country and AS of addresses from an IP-to-ASN table
+type DB struct {
+	ranges []ipRange
+}
+
+// Open loads an IP-to-ASN table in the iptoasn.com TSV format, optionally
+// gzip compressed: range start, range end, AS number, country code, and AS
+// description, separated by tabs
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geoip database: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress geoip database: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	db, err := Load(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load geoip database %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// Load reads an IP-to-ASN table from r
+func Load(r io.Reader) (*DB, error) {
+	db := &DB{ranges: make([]ipRange, 0)}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("line %d: expected at least 4 fields, got %d", line, len(fields))
+		}
+
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		asn, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid AS number %q", line, fields[2])
+		}
+
+		// Unannounced ranges carry AS 0 and no country
+		if asn == 0 {
+			continue
+		}
+
+		rec := Record{Country: strings.ToUpper(fields[3]), ASN: asn}
+		if len(fields) > 4 {
+			rec.Org = fields[4]
+		}
+		db.ranges = append(db.ranges, ipRange{start: start.Unmap(), end: end.Unmap(), record: rec})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].start.Less(db.ranges[j].start)
+	})
+
+	return db, nil
+}
+
+// Lookup returns the record for an address, which may include a port
+func (db *DB) Lookup(ip string) (Record, bool) {
+	if db == nil {
+		return Record{}, false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		addrPort, err := netip.ParseAddrPort(ip)
+		if err != nil {
+			return Record{}, false
+		}
+		addr = addrPort.Addr()
+	}
+	addr = addr.Unmap().WithZone("")
+
+	// Find the last range starting at or before the address
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].start)
+	}) - 1
+	if i < 0 || db.ranges[i].end.Less(addr) {
+		return Record{}, false
+	}
+	return db.ranges[i].record, true
+}
+
+// Len returns the number of ranges loaded
+func (db *DB) Len() int {
+	return len(db.ranges)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the record of a request's source
+func NewContext(ctx context.Context, rec Record) context.Context {
+	return context.WithValue(ctx, contextKey{}, rec)
+}
+
+// FromContext returns the source record stored in ctx, if any
+func FromContext(ctx context.Context) (Record, bool) {
+	rec, ok := ctx.Value(contextKey{}).(Record)
+	return rec, ok
+}
@@ -0,0 +1,46 @@
+package geoip
+
+import (
+	"strings"
+	"testing"
+)
+
+const table = "1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+	"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+	"5.255.255.0\t5.255.255.255\t13238\tRU\tYANDEX\n" +
+	"2001:db8::\t2001:db8::ffff\t64500\tDE\tEXAMPLE\n"
+
+func TestLookup(t *testing.T) {
+	db, err := Load(strings.NewReader(table))
+	if err != nil {
+		t.Fatalf("Failed to load table: %v", err)
+	}
+	if db.Len() != 3 {
+		t.Fatalf("Expected 3 ranges, got %d", db.Len())
+	}
+
+	tests := []struct {
+		ip      string
+		country string
+		asn     int
+	}{
+		{"1.0.0.1", "US", 13335},
+		{"1.0.0.255", "US", 13335},
+		{"5.255.255.5:443", "RU", 13238},
+		{"::ffff:5.255.255.5", "RU", 13238},
+		{"2001:db8::1", "DE", 64500},
+		{"[2001:db8::2]:80", "DE", 64500},
+	}
+	for _, tt := range tests {
+		rec, ok := db.Lookup(tt.ip)
+		if !ok || rec.Country != tt.country || rec.ASN != tt.asn {
+			t.Fatalf("Expected %s in %s/AS%d, got %+v (found %v)", tt.ip, tt.country, tt.asn, rec, ok)
+		}
+	}
+
+	for _, ip := range []string{"1.0.2.1", "9.9.9.9", "0.0.0.1", "garbage"} {
+		if rec, ok := db.Lookup(ip); ok {
+			t.Fatalf("Expected no record for %s, got %+v", ip, rec)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Package handoff turns the spoof into the front tier of a honeynet. Sources
+// whose session reaches an interaction score are handed off to a
+// high-interaction honeypot for the rest of their session: their HTTP
+// requests are proxied to it unchanged, each client connection pinned to its
+// own connection to the honeypot, and still logged as they pass through.
+package handoff
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/logging"
+)
+
+// handoffLog logs the sources handed off
+var handoffLog = logging.Logger("handoff")
+
+// TagHandedOff tags requests proxied to the honeypot
+const TagHandedOff = "handed-off"
+
+const (
+	// dialTimeout bounds how long connecting to the honeypot may take
+	dialTimeout = 10 * time.Second
+
+	// upstreamIdle is how long a client connection's connection to the
+	// honeypot is kept after its last request
+	upstreamIdle = 2 * time.Minute
+)
+
+// forwardedHeaders are headers httputil.ReverseProxy strips that clients may
+// have sent themselves, and are passed on as sent
+var forwardedHeaders = []string{"X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto"}
+
+// Handoff tracks the sources handed off and proxies their requests
+type Handoff struct {
+	cfg     config.HandoffConfig
+	timeout time.Duration
+
+	mu        sync.Mutex
+	sources   map[string]time.Time
+	upstreams map[string]*upstream
+	lastSweep time.Time
+}
+
+// upstream is the transport carrying a client connection's requests over
+// its own connection to the honeypot
+type upstream struct {
+	transport *http.Transport
+	last      time.Time
+}
+
+// New creates a hand-off to the configured honeypot, pinning sources until
+// they go silent for longer than timeout, or nil if it is disabled
+func New(cfg *config.HandoffConfig, timeout time.Duration) *Handoff {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Handoff{
+		cfg:       *cfg,
+		timeout:   timeout,
+		sources:   make(map[string]time.Time),
+		upstreams: make(map[string]*upstream),
+	}
+}
+
+// Threshold returns the interaction score at which sources are handed off
+func (h *Handoff) Threshold() int {
+	return h.cfg.Threshold
+}
+
+// Pin hands a source off for the rest of its session
+func (h *Handoff) Pin(source string, sessionID int64, score int, now time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if last, ok := h.sources[source]; ok && now.Sub(last) <= h.timeout {
+		return
+	}
+	h.sources[source] = now
+	handoffLog.Info("handing off source to the high-interaction honeypot", "source", source, "session", sessionID, "score", score)
+}
+
+// Pinned reports whether a source has been handed off, keeping it pinned
+// for another session timeout if it has
+func (h *Handoff) Pinned(source string, now time.Time) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if now.Sub(h.lastSweep) > time.Minute {
+		h.sweep(now)
+	}
+	last, ok := h.sources[source]
+	if !ok || now.Sub(last) > h.timeout {
+		return false
+	}
+	h.sources[source] = now
+	return true
+}
+
+// Target returns the address requests arriving on a port are proxied to
+func (h *Handoff) Target(port int) string {
+	return h.cfg.GetTarget(port)
+}
+
+// Proxy forwards a request to the honeypot at target over the connection
+// pinned to the client's, answering with fallback if the honeypot cannot be
+// reached. Headers already set for the spoof's response are dropped, so the
+// client sees only the honeypot's.
+func (h *Handoff) Proxy(w http.ResponseWriter, r *http.Request, target string, fallback http.Handler) {
+	hdr := w.Header()
+	for k := range hdr {
+		delete(hdr, k)
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = scheme
+			pr.Out.URL.Host = target
+			pr.Out.Host = pr.In.Host
+			for _, name := range forwardedHeaders {
+				if v, ok := pr.In.Header[name]; ok {
+					pr.Out.Header[name] = v
+				}
+			}
+		},
+		Transport:     h.transport(r, target),
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			handoffLog.Error("hand-off failed", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr, "target", target, "err", err)
+			fallback.ServeHTTP(w, r)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// Close closes the idle connections to the honeypot
+func (h *Handoff) Close() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, up := range h.upstreams {
+		up.transport.CloseIdleConnections()
+		delete(h.upstreams, key)
+	}
+}
+
+// transport returns the transport pinned to a request's client connection,
+// creating it on the connection's first request. It holds at most one
+// connection to the honeypot, presenting the name the client asked for.
+func (h *Handoff) transport(r *http.Request, target string) *http.Transport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := r.RemoteAddr + ">" + target
+	now := time.Now()
+	if up, ok := h.upstreams[key]; ok {
+		up.last = now
+		return up.transport
+	}
+
+	// The honeypot's certificate is its own business
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	if r.TLS != nil {
+		tlsConfig.ServerName = r.TLS.ServerName
+	}
+	transport := &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: dialTimeout}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		MaxConnsPerHost:     1,
+		MaxIdleConnsPerHost: 1,
+		IdleConnTimeout:     upstreamIdle,
+		DisableCompression:  true,
+	}
+	h.upstreams[key] = &upstream{transport: transport, last: now}
+	return transport
+}
+
+// sweep forgets sources whose session has ended and closes the connections
+// of client connections gone idle
+func (h *Handoff) sweep(now time.Time) {
+	h.lastSweep = now
+	for source, last := range h.sources {
+		if now.Sub(last) > h.timeout {
+			delete(h.sources, source)
+		}
+	}
+	for key, up := range h.upstreams {
+		if now.Sub(up.last) > upstreamIdle {
+			up.transport.CloseIdleConnections()
+			delete(h.upstreams, key)
+		}
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a context marking a request as handed off to target
+func NewContext(ctx context.Context, target string) context.Context {
+	return context.WithValue(ctx, contextKey{}, target)
+}
+
+// FromContext returns the address a request is handed off to, if it is
+func FromContext(ctx context.Context) (string, bool) {
+	target, ok := ctx.Value(contextKey{}).(string)
+	return target, ok
+}
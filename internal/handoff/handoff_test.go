@@ -0,0 +1,95 @@
+package handoff
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestHandoff_Pinned(t *testing.T) {
+	h := New(&config.HandoffConfig{Enabled: true, Threshold: 10, Target: "192.0.2.50"}, 30*time.Minute)
+	now := time.Now()
+
+	if h.Pinned("203.0.113.7", now) {
+		t.Fatalf("Expected sources not to be pinned before they are handed off")
+	}
+	h.Pin("203.0.113.7", 1, 10, now)
+	if !h.Pinned("203.0.113.7", now.Add(20*time.Minute)) {
+		t.Fatalf("Expected the source to be pinned")
+	}
+	if !h.Pinned("203.0.113.7", now.Add(40*time.Minute)) {
+		t.Fatalf("Expected requests to keep the source pinned")
+	}
+	if h.Pinned("203.0.113.7", now.Add(80*time.Minute)) {
+		t.Fatalf("Expected the pin to end with the session")
+	}
+
+	var nilHandoff *Handoff
+	if nilHandoff.Pinned("203.0.113.7", now) {
+		t.Fatalf("Expected a nil hand-off to pin nothing")
+	}
+}
+
+func TestHandoff_Proxy(t *testing.T) {
+	var hosts []string
+	var remotes []string
+	honeypot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host+" "+r.Header.Get("X-Forwarded-For"))
+		remotes = append(remotes, r.RemoteAddr)
+		w.Header().Set("Server", "Apache/2.4.62 (Debian)")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer honeypot.Close()
+	target := strings.TrimPrefix(honeypot.URL, "http://")
+
+	h := New(&config.HandoffConfig{Enabled: true, Threshold: 10, Target: "127.0.0.1"}, 30*time.Minute)
+	defer h.Close()
+	spoof := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("Expected the honeypot to answer")
+	})
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "http://www.example.com/admin", nil)
+		r.RemoteAddr = "203.0.113.7:40000"
+		w := httptest.NewRecorder()
+		w.Header().Set("X-RateLimit-Limit", "60")
+		h.Proxy(w, r, target, spoof)
+
+		if w.Code != http.StatusForbidden || w.Header().Get("Server") != "Apache/2.4.62 (Debian)" {
+			t.Fatalf("Expected the honeypot's response, got %d %v", w.Code, w.Header())
+		}
+		if w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("Expected the spoof's headers to be dropped")
+		}
+	}
+
+	if hosts[0] != "www.example.com " {
+		t.Fatalf("Expected the request to reach the honeypot unchanged, got %q", hosts[0])
+	}
+	if remotes[0] != remotes[1] {
+		t.Fatalf("Expected the client connection's requests to share a connection, got %v", remotes)
+	}
+}
+
+func TestHandoff_ProxyFallback(t *testing.T) {
+	h := New(&config.HandoffConfig{Enabled: true, Threshold: 10, Target: "127.0.0.1"}, 30*time.Minute)
+	defer h.Close()
+
+	// Nothing listens on the port of a closed server
+	closed := httptest.NewServer(http.NotFoundHandler())
+	target := strings.TrimPrefix(closed.URL, "http://")
+	closed.Close()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	h.Proxy(w, r, target, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("Expected the spoof to answer when the honeypot is down, got %d", w.Code)
+	}
+}
@@ -0,0 +1,175 @@
+// Package hostheader flags unusual Host headers: requests naming the server
+// by IP address rather than name, internationalized names, ports other than
+// the one the request arrived on, and the malformed hosts and override
+// headers of host header injection attempts, such as password reset
+// poisoning and cache poisoning probes
+package hostheader
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Host header anomaly tags
+const (
+	// TagMissing tags requests without a Host header, which only HTTP/1.0
+	// clients may send
+	TagMissing = "host-missing"
+
+	// TagIP tags requests naming the server by an IP address, including
+	// the decimal, octal, and hex forms of IPv4 addresses, as scanners
+	// sweeping address ranges do
+	TagIP = "host-ip"
+
+	// TagIDN tags internationalized hosts, in punycode or raw UTF-8, as
+	// homograph and parser-confusion probes use
+	TagIDN = "host-idn"
+
+	// TagPort tags hosts naming a port other than the one the request
+	// arrived on
+	TagPort = "host-port"
+
+	// TagInjection tags hosts no browser would send: with userinfo, paths,
+	// whitespace, several hosts or ports, or a port that is not a number
+	TagInjection = "host-injection"
+
+	// TagOverride tags requests carrying headers that override the Host
+	// header behind proxies, which host header injection relies on
+	TagOverride = "host-override"
+)
+
+// overrideHeaders are headers frameworks trust over the Host header
+var overrideHeaders = []string{"X-Forwarded-Host", "X-Host", "X-Original-Host", "X-Forwarded-Server", "X-HTTP-Host-Override", "Forwarded"}
+
+// Check returns the tags of the anomalies in a request's Host header, in the
+// order the tags are declared. Ports are compared with serverPort, or the
+// port the connection arrived on if it is 0.
+func Check(r *http.Request, serverPort int) []string {
+	tags := make([]string, 0)
+	if r.Host == "" {
+		tags = append(tags, TagMissing)
+	}
+
+	host, port, ok := split(r.Host)
+	if r.Host != "" {
+		if isIP(host) {
+			tags = append(tags, TagIP)
+		}
+		if isIDN(host) {
+			tags = append(tags, TagIDN)
+		}
+		local := strconv.Itoa(serverPort)
+		if serverPort == 0 {
+			local = localPort(r)
+		}
+		if ok && port != "" && port != local {
+			tags = append(tags, TagPort)
+		}
+		if !ok || strings.ContainsAny(host, "@/\\?#, \t;") {
+			tags = append(tags, TagInjection)
+		}
+	}
+
+	for _, h := range overrideHeaders {
+		if r.Header.Get(h) != "" {
+			tags = append(tags, TagOverride)
+			break
+		}
+	}
+	return tags
+}
+
+// Valid reports whether a Host header holds only the bytes Go's HTTP server
+// accepts. It answers others, including raw UTF-8 names, with a bare 400
+// before any handler sees them, so guarded listeners log them as malformed
+// instead.
+func Valid(host string) bool {
+	for i := 0; i < len(host); i++ {
+		c := host[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!$%&'()*+,-.:;=[]_~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// split splits a Host header into its host and port, reporting whether it
+// is well formed: at most one port, a number in range
+func split(hostport string) (string, string, bool) {
+	host, port := hostport, ""
+	if strings.HasPrefix(hostport, "[") {
+		end := strings.Index(hostport, "]")
+		if end < 0 {
+			return hostport, "", false
+		}
+		host, port = hostport[1:end], hostport[end+1:]
+		if port != "" && !strings.HasPrefix(port, ":") {
+			return host, "", false
+		}
+		port = strings.TrimPrefix(port, ":")
+	} else if i := strings.Index(hostport, ":"); i >= 0 {
+		host, port = hostport[:i], hostport[i+1:]
+	}
+
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 || strconv.Itoa(n) != port {
+			return host, port, false
+		}
+	}
+	return host, port, true
+}
+
+// isIP reports whether a host is an IP address, IPv4 addresses in any of the
+// forms inet_aton accepts
+func isIP(host string) bool {
+	if _, err := netip.ParseAddr(host); err == nil {
+		return true
+	}
+
+	// 2130706433, 0x7f000001, 0177.0.0.1, and 127.1 all name 127.0.0.1
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return false
+	}
+	for _, p := range parts {
+		if _, err := strconv.ParseUint(p, 0, 32); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isIDN reports whether a host is internationalized
+func isIDN(host string) bool {
+	for _, label := range strings.Split(strings.ToLower(host), ".") {
+		if strings.HasPrefix(label, "xn--") {
+			return true
+		}
+	}
+	for i := 0; i < len(host); i++ {
+		if host[i] >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+// localPort returns the port the request arrived on, or "" if unknown
+func localPort(r *http.Request) string {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	return port
+}
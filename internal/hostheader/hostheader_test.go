@@ -0,0 +1,77 @@
+package hostheader
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		host string
+		want []string
+	}{
+		{"example.com", []string{}},
+		{"example.com:8080", []string{}},
+		{"", []string{TagMissing}},
+		{"10.0.0.5", []string{TagIP}},
+		{"[::1]:8080", []string{TagIP}},
+		{"2130706433", []string{TagIP}},
+		{"0x7f.1", []string{TagIP}},
+		{"xn--80ak6aa92e.com", []string{TagIDN}},
+		{"exаmple.com", []string{TagIDN}},
+		{"example.com:443", []string{TagPort}},
+		{"evil.com@example.com", []string{TagInjection}},
+		{"example.com:8080:80", []string{TagInjection}},
+		{"example.com:abc", []string{TagInjection}},
+		{"example.com, evil.com", []string{TagInjection}},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = tt.host
+		local := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 5), Port: 8080}
+		r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, local))
+
+		if got := Check(r, 0); !slices.Equal(got, tt.want) {
+			t.Fatalf("Expected %v for host %q, got %v", tt.want, tt.host, got)
+		}
+	}
+}
+
+func TestCheckOverride(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Forwarded-Host", "evil.com")
+
+	if got := Check(r, 0); !slices.Equal(got, []string{TagOverride}) {
+		t.Fatalf("Expected [%s], got %v", TagOverride, got)
+	}
+}
+
+func TestCheckServerPort(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Host = "example.com:8080"
+
+	if got := Check(r, 8080); len(got) != 0 {
+		t.Fatalf("Expected no tags, got %v", got)
+	}
+	if got := Check(r, 80); !slices.Equal(got, []string{TagPort}) {
+		t.Fatalf("Expected [%s], got %v", TagPort, got)
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, host := range []string{"example.com", "[::1]:8080", "a.com,b.com"} {
+		if !Valid(host) {
+			t.Fatalf("Expected %q to be valid", host)
+		}
+	}
+	for _, host := range []string{"evil.com@example.com", "a b", "exаmple.com", "a/b"} {
+		if Valid(host) {
+			t.Fatalf("Expected %q to be invalid", host)
+		}
+	}
+}
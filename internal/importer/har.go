@@ -0,0 +1,197 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// harFile is the subset of the HTTP Archive 1.2 format that is used
+type harFile struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+	} `json:"request"`
+	Response struct {
+		Status  int `json:"status"`
+		Headers []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+// harHeaderExclusions are response headers that do not apply once the body
+// is served decoded from a template
+var harHeaderExclusions = map[string]bool{
+	"Content-Encoding": true,
+}
+
+// ParseHAR converts a browser HAR recording into service profiles, one per
+// origin, with an endpoint and template for each distinct method and path.
+// Headers shared by every response of an origin become service headers.
+func ParseHAR(r io.Reader, templateDir string) ([]config.ServiceConfig, error) {
+	var har harFile
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, fmt.Errorf("failed to parse har: %w", err)
+	}
+
+	type origin struct {
+		host      string
+		port      int
+		endpoints []config.EndpointConfig
+		headers   []map[string]string
+		seen      map[string]bool
+	}
+
+	origins := make(map[string]*origin)
+	order := make([]string, 0)
+
+	for i, entry := range har.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+
+		port := portFromURL(u.Scheme, u.Host)
+		key := u.Hostname() + ":" + strconv.Itoa(port)
+		o, exists := origins[key]
+		if !exists {
+			o = &origin{host: u.Hostname(), port: port, seen: make(map[string]bool)}
+			origins[key] = o
+			order = append(order, key)
+		}
+
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+
+		// Only the first response for a method and path is reproduced
+		if o.seen[entry.Request.Method+" "+path] {
+			continue
+		}
+		o.seen[entry.Request.Method+" "+path] = true
+
+		headers := make(http.Header)
+		for _, h := range entry.Response.Headers {
+			// HTTP/2 recordings include pseudo headers such as ":status"
+			if strings.HasPrefix(h.Name, ":") {
+				continue
+			}
+			headers.Add(h.Name, h.Value)
+		}
+		filtered := FilterHeaders(headers)
+		for k := range harHeaderExclusions {
+			delete(filtered, k)
+		}
+
+		endpoint := config.EndpointConfig{
+			Path:   path,
+			Method: entry.Request.Method,
+			Status: entry.Response.Status,
+		}
+
+		body, err := harBody(entry)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		if len(body) > 0 {
+			name := fmt.Sprintf("%s_%d_%s%s", o.host, o.port, entry.Request.Method, path)
+			template, err := WriteTemplate(templateDir, name, body)
+			if err != nil {
+				return nil, err
+			}
+			endpoint.Template = template
+		}
+
+		o.endpoints = append(o.endpoints, endpoint)
+		o.headers = append(o.headers, filtered)
+	}
+
+	services := make([]config.ServiceConfig, 0, len(origins))
+	for _, key := range order {
+		o := origins[key]
+		if len(o.endpoints) == 0 {
+			continue
+		}
+
+		shared := sharedHeaders(o.headers)
+		for i := range o.endpoints {
+			for k, v := range o.headers[i] {
+				if _, ok := shared[k]; ok {
+					continue
+				}
+				if o.endpoints[i].Headers == nil {
+					o.endpoints[i].Headers = make(map[string]string)
+				}
+				o.endpoints[i].Headers[k] = v
+			}
+		}
+
+		svcType := GuessServiceType(shared["Server"] + " " + shared["X-Powered-By"] + " " + shared["Link"])
+		services = append(services, config.ServiceConfig{
+			Name:      SafeFileName(o.host) + "-" + strconv.Itoa(o.port),
+			Type:      svcType,
+			Enabled:   true,
+			Ports:     []int{o.port},
+			Headers:   shared,
+			Endpoints: append(o.endpoints, notFoundEndpoint()),
+		})
+	}
+
+	return services, nil
+}
+
+// harBody returns the decoded response body of a HAR entry
+func harBody(entry harEntry) ([]byte, error) {
+	content := entry.Response.Content
+	if content.Encoding == "base64" {
+		body, err := base64.StdEncoding.DecodeString(content.Text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 body: %w", err)
+		}
+		return body, nil
+	}
+	return []byte(content.Text), nil
+}
+
+// sharedHeaders returns the headers that have the same value in every set
+func sharedHeaders(sets []map[string]string) map[string]string {
+	shared := make(map[string]string)
+	if len(sets) == 0 {
+		return shared
+	}
+
+	for k, v := range sets[0] {
+		common := true
+		for _, set := range sets[1:] {
+			if set[k] != v {
+				common = false
+				break
+			}
+		}
+		if common {
+			shared[k] = v
+		}
+	}
+	return shared
+}
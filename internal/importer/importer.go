@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"gopkg.in/yaml.v2"
+)
+
+// managedHeaders are set by the HTTP server itself and must not be copied
+// into a generated profile
+var managedHeaders = map[string]bool{
+	"Date":              true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Keep-Alive":        true,
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// GuessServiceType maps a product name or Server header to a built-in
+// service type, falling back to generic
+func GuessServiceType(product string) string {
+	p := strings.ToLower(product)
+	switch {
+	case strings.Contains(p, "wordpress"):
+		return "wordpress"
+	case strings.Contains(p, "nginx"):
+		return "nginx"
+	case strings.Contains(p, "apache"):
+		return "apache2"
+	case strings.Contains(p, "iis"):
+		return "iis"
+	default:
+		return "generic"
+	}
+}
+
+// FilterHeaders copies the first value of every header that is not managed
+// by the HTTP server
+func FilterHeaders(h http.Header) map[string]string {
+	headers := make(map[string]string)
+	for k, v := range h {
+		k = http.CanonicalHeaderKey(k)
+		if managedHeaders[k] || len(v) == 0 {
+			continue
+		}
+		headers[k] = v[0]
+	}
+	return headers
+}
+
+// WriteTemplate writes a response body to the template directory and
+// returns the path to reference from the generated endpoint
+func WriteTemplate(dir, name string, body []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create template directory: %w", err)
+	}
+
+	path := filepath.Join(dir, SafeFileName(name))
+	if err := os.WriteFile(path, body, 0644); err != nil {
+		return "", fmt.Errorf("failed to write template: %w", err)
+	}
+
+	return path, nil
+}
+
+// SafeFileName replaces characters that are not safe in file names
+func SafeFileName(name string) string {
+	return strings.Trim(unsafeFileChars.ReplaceAllString(name, "_"), "_")
+}
+
+// MarshalServices renders generated services as a YAML snippet that can be
+// pasted into the services list of config.yaml
+func MarshalServices(services []config.ServiceConfig) ([]byte, error) {
+	out, err := yaml.Marshal(map[string][]config.ServiceConfig{"services": services})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal services: %w", err)
+	}
+	return out, nil
+}
+
+// notFoundEndpoint is the catch-all endpoint added to every generated service
+func notFoundEndpoint() config.EndpointConfig {
+	return config.EndpointConfig{
+		Path:   "/*",
+		Method: "*",
+		Status: http.StatusNotFound,
+	}
+}
@@ -0,0 +1,198 @@
+package importer
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+const nmapSample = `<?xml version="1.0" encoding="UTF-8"?>
+<nmaprun scanner="nmap">
+  <host>
+    <address addr="203.0.113.10" addrtype="ipv4"/>
+    <ports>
+      <port protocol="tcp" portid="80">
+        <state state="open"/>
+        <service name="http" product="nginx" version="1.18.0" extrainfo="Ubuntu"/>
+        <script id="http-headers" output="&#xa;  Server: nginx/1.18.0 (Ubuntu)&#xa;  Date: Mon, 01 Jan 2024 00:00:00 GMT&#xa;  Content-Type: text/html&#xa;  Connection: close&#xa;  &#xa;  (Request type: HEAD)&#xa;"/>
+      </port>
+      <port protocol="tcp" portid="22">
+        <state state="open"/>
+        <service name="ssh" product="OpenSSH" version="8.9p1"/>
+      </port>
+      <port protocol="tcp" portid="8080">
+        <state state="closed"/>
+        <service name="http-proxy"/>
+      </port>
+    </ports>
+  </host>
+</nmaprun>`
+
+func TestParseNmap(t *testing.T) {
+	services, err := ParseNmap(strings.NewReader(nmapSample))
+	if err != nil {
+		t.Fatalf("Failed to parse nmap output: %v", err)
+	}
+
+	if len(services) != 1 {
+		t.Fatalf("Expected 1 service, got %d", len(services))
+	}
+
+	svc := services[0]
+	if svc.Type != "nginx" || svc.Ports[0] != 80 {
+		t.Fatalf("Expected nginx on port 80, got %s on %v", svc.Type, svc.Ports)
+	}
+
+	if svc.Headers["Server"] != "nginx/1.18.0 (Ubuntu)" {
+		t.Fatalf("Expected Server header from http-headers script, got %q", svc.Headers["Server"])
+	}
+
+	if _, ok := svc.Headers["Date"]; ok {
+		t.Fatalf("Date header should be managed by the server and not imported")
+	}
+}
+
+func TestParseZgrab(t *testing.T) {
+	line := `{"ip":"203.0.113.10","data":{"http":{"status":"success","result":{"response":{"status_code":200,"headers":{"server":["Microsoft-IIS/10.0"],"x_powered_by":["ASP.NET"]},"body":"<html>iis</html>","request":{"url":{"scheme":"http","host":"203.0.113.10","path":"/"}}}}}}}`
+
+	services, err := ParseZgrab(strings.NewReader(line), t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to parse zgrab output: %v", err)
+	}
+
+	if len(services) != 1 {
+		t.Fatalf("Expected 1 service, got %d", len(services))
+	}
+
+	svc := services[0]
+	if svc.Type != "iis" {
+		t.Fatalf("Expected iis service type, got %s", svc.Type)
+	}
+
+	if svc.Headers["X-Powered-By"] != "ASP.NET" {
+		t.Fatalf("Expected X-Powered-By header, got %v", svc.Headers)
+	}
+
+	if svc.Endpoints[0].Template == "" {
+		t.Fatalf("Expected response body to be written as a template")
+	}
+}
+
+func TestParseHAR(t *testing.T) {
+	har := `{"log":{"entries":[
+		{"request":{"method":"GET","url":"https://app.example.com/"},
+		 "response":{"status":200,"headers":[{"name":"Server","value":"nginx"},{"name":"Content-Type","value":"text/html"}],
+		  "content":{"mimeType":"text/html","text":"<html>home</html>"}}},
+		{"request":{"method":"GET","url":"https://app.example.com/api/me"},
+		 "response":{"status":401,"headers":[{"name":"Server","value":"nginx"},{"name":"Content-Type","value":"application/json"}],
+		  "content":{"mimeType":"application/json","text":"eyJlcnJvciI6InVuYXV0aG9yaXplZCJ9","encoding":"base64"}}}
+	]}}`
+
+	services, err := ParseHAR(strings.NewReader(har), t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to parse har: %v", err)
+	}
+
+	if len(services) != 1 {
+		t.Fatalf("Expected 1 service, got %d", len(services))
+	}
+
+	svc := services[0]
+	if svc.Ports[0] != 443 {
+		t.Fatalf("Expected port 443, got %v", svc.Ports)
+	}
+
+	if svc.Headers["Server"] != "nginx" {
+		t.Fatalf("Expected shared Server header, got %v", svc.Headers)
+	}
+
+	if _, ok := svc.Headers["Content-Type"]; ok {
+		t.Fatalf("Content-Type differs per response and should be an endpoint header")
+	}
+
+	// Two recorded endpoints plus the catch-all
+	if len(svc.Endpoints) != 3 {
+		t.Fatalf("Expected 3 endpoints, got %d", len(svc.Endpoints))
+	}
+
+	if svc.Endpoints[1].Headers["Content-Type"] != "application/json" {
+		t.Fatalf("Expected endpoint Content-Type header, got %v", svc.Endpoints[1].Headers)
+	}
+}
+
+func TestParseOpenAPI(t *testing.T) {
+	doc := `
+openapi: 3.0.0
+info:
+  title: Pet Store
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /pets/{id}:
+    get:
+      responses:
+        "200":
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Pet"
+        "404":
+          description: not found
+  /pets:
+    post:
+      responses:
+        "201":
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Pet"
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+        name:
+          type: string
+          example: Rex
+`
+
+	services, err := ParseOpenAPI(strings.NewReader(doc), t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to parse openapi document: %v", err)
+	}
+
+	svc := services[0]
+	if svc.Name != "pet_store" || svc.Ports[0] != 443 {
+		t.Fatalf("Expected pet_store on port 443, got %s on %v", svc.Name, svc.Ports)
+	}
+
+	// Concrete paths are ordered before templated ones
+	if svc.Endpoints[0].Path != "/v1/pets" || svc.Endpoints[0].Status != 201 {
+		t.Fatalf("Expected POST /v1/pets 201 first, got %+v", svc.Endpoints[0])
+	}
+
+	if svc.Endpoints[1].Path != "/v1/pets/*" || svc.Endpoints[1].Status != 200 {
+		t.Fatalf("Expected GET /v1/pets/* 200, got %+v", svc.Endpoints[1])
+	}
+
+	if svc.Endpoints[1].Headers["Content-Type"] != "application/json" {
+		t.Fatalf("Expected JSON content type, got %v", svc.Endpoints[1].Headers)
+	}
+
+	body, err := os.ReadFile(svc.Endpoints[1].Template)
+	if err != nil {
+		t.Fatalf("Failed to read generated template: %v", err)
+	}
+
+	var pet map[string]interface{}
+	if err := json.Unmarshal(body, &pet); err != nil {
+		t.Fatalf("Generated example is not valid JSON: %v", err)
+	}
+
+	if pet["name"] != "Rex" {
+		t.Fatalf("Expected schema example to be used, got %v", pet)
+	}
+}
@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// nmapRun is the subset of nmap's XML output (-oX) that is used
+type nmapRun struct {
+	Hosts []struct {
+		Addresses []struct {
+			Addr     string `xml:"addr,attr"`
+			AddrType string `xml:"addrtype,attr"`
+		} `xml:"address"`
+		Ports []struct {
+			Protocol string `xml:"protocol,attr"`
+			PortID   int    `xml:"portid,attr"`
+			State    struct {
+				State string `xml:"state,attr"`
+			} `xml:"state"`
+			Service struct {
+				Name      string `xml:"name,attr"`
+				Product   string `xml:"product,attr"`
+				Version   string `xml:"version,attr"`
+				ExtraInfo string `xml:"extrainfo,attr"`
+				Tunnel    string `xml:"tunnel,attr"`
+			} `xml:"service"`
+			Scripts []struct {
+				ID     string `xml:"id,attr"`
+				Output string `xml:"output,attr"`
+			} `xml:"script"`
+		} `xml:"ports>port"`
+	} `xml:"host"`
+}
+
+// ParseNmap converts nmap -sV XML output into service profiles, one per
+// open HTTP port. Headers are taken from the http-headers and
+// http-server-header NSE scripts when present.
+func ParseNmap(r io.Reader) ([]config.ServiceConfig, error) {
+	var run nmapRun
+	if err := xml.NewDecoder(r).Decode(&run); err != nil {
+		return nil, fmt.Errorf("failed to parse nmap xml: %w", err)
+	}
+
+	services := make([]config.ServiceConfig, 0)
+	for _, host := range run.Hosts {
+		for _, port := range host.Ports {
+			if port.Protocol != "tcp" || port.State.State != "open" {
+				continue
+			}
+			if !strings.HasPrefix(port.Service.Name, "http") && port.Service.Tunnel != "ssl" {
+				continue
+			}
+
+			headers := make(http.Header)
+			for _, script := range port.Scripts {
+				switch script.ID {
+				case "http-headers":
+					for k, v := range parseNmapHeaders(script.Output) {
+						headers[k] = v
+					}
+				case "http-server-header":
+					if headers.Get("Server") == "" {
+						headers.Set("Server", strings.TrimSpace(script.Output))
+					}
+				}
+			}
+
+			// Fall back to the version detection result for the Server header
+			if headers.Get("Server") == "" && port.Service.Product != "" {
+				headers.Set("Server", strings.TrimSpace(port.Service.Product+" "+port.Service.Version))
+			}
+
+			svcType := GuessServiceType(port.Service.Product + " " + headers.Get("Server"))
+			services = append(services, config.ServiceConfig{
+				Name:    svcType + "-" + strconv.Itoa(port.PortID),
+				Type:    svcType,
+				Enabled: true,
+				Ports:   []int{port.PortID},
+				Headers: FilterHeaders(headers),
+				Endpoints: []config.EndpointConfig{
+					{Path: "/", Method: http.MethodGet, Status: http.StatusOK},
+					notFoundEndpoint(),
+				},
+			})
+		}
+	}
+
+	return services, nil
+}
+
+// parseNmapHeaders parses the indented "Key: Value" lines written by the
+// http-headers NSE script, stopping at the first blank line
+func parseNmapHeaders(output string) http.Header {
+	headers := make(http.Header)
+	started := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if started {
+				break
+			}
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		started = true
+		headers.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	return headers
+}
@@ -0,0 +1,361 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"gopkg.in/yaml.v2"
+)
+
+// maxSchemaDepth bounds example generation for recursive schemas
+const maxSchemaDepth = 8
+
+var pathParam = regexp.MustCompile(`\{[^/}]+\}`)
+
+// openAPIDoc is the subset of an OpenAPI 3 or Swagger 2 document that is
+// used. YAML decoding handles both JSON and YAML documents.
+type openAPIDoc struct {
+	Swagger string `yaml:"swagger"`
+	OpenAPI string `yaml:"openapi"`
+	Info    struct {
+		Title string `yaml:"title"`
+	} `yaml:"info"`
+	Host     string   `yaml:"host"`
+	BasePath string   `yaml:"basePath"`
+	Schemes  []string `yaml:"schemes"`
+	Servers  []struct {
+		URL string `yaml:"url"`
+	} `yaml:"servers"`
+	Paths      map[string]openAPIPathItem `yaml:"paths"`
+	Components struct {
+		Schemas map[string]*openAPISchema `yaml:"schemas"`
+	} `yaml:"components"`
+	Definitions map[string]*openAPISchema `yaml:"definitions"`
+}
+
+type openAPIPathItem struct {
+	Get     *openAPIOperation `yaml:"get"`
+	Put     *openAPIOperation `yaml:"put"`
+	Post    *openAPIOperation `yaml:"post"`
+	Delete  *openAPIOperation `yaml:"delete"`
+	Options *openAPIOperation `yaml:"options"`
+	Head    *openAPIOperation `yaml:"head"`
+	Patch   *openAPIOperation `yaml:"patch"`
+}
+
+type openAPIOperation struct {
+	Produces  []string                   `yaml:"produces"`
+	Responses map[string]openAPIResponse `yaml:"responses"`
+}
+
+type openAPIResponse struct {
+	// OpenAPI 3
+	Content map[string]struct {
+		Schema  *openAPISchema `yaml:"schema"`
+		Example interface{}    `yaml:"example"`
+	} `yaml:"content"`
+
+	// Swagger 2
+	Schema   *openAPISchema         `yaml:"schema"`
+	Examples map[string]interface{} `yaml:"examples"`
+}
+
+type openAPISchema struct {
+	Ref        string                    `yaml:"$ref"`
+	Type       string                    `yaml:"type"`
+	Format     string                    `yaml:"format"`
+	Properties map[string]*openAPISchema `yaml:"properties"`
+	Items      *openAPISchema            `yaml:"items"`
+	Example    interface{}               `yaml:"example"`
+	Default    interface{}               `yaml:"default"`
+	Enum       []interface{}             `yaml:"enum"`
+	AllOf      []*openAPISchema          `yaml:"allOf"`
+	OneOf      []*openAPISchema          `yaml:"oneOf"`
+	AnyOf      []*openAPISchema          `yaml:"anyOf"`
+}
+
+// ParseOpenAPI converts an OpenAPI 3 or Swagger 2 document into a service
+// profile with an endpoint per operation returning schema-conformant example
+// JSON with the documented success status and content type
+func ParseOpenAPI(r io.Reader, templateDir string) ([]config.ServiceConfig, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read openapi document: %w", err)
+	}
+
+	var doc openAPIDoc
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse openapi document: %w", err)
+	}
+	if doc.OpenAPI == "" && doc.Swagger == "" {
+		return nil, fmt.Errorf("document is neither OpenAPI 3 nor Swagger 2")
+	}
+
+	schemas := doc.Components.Schemas
+	if doc.Swagger != "" {
+		schemas = doc.Definitions
+	}
+
+	basePath, port := openAPIBase(&doc)
+	name := SafeFileName(strings.ToLower(doc.Info.Title))
+	if name == "" {
+		name = "api"
+	}
+
+	// Concrete paths must come before templated ones, since the router
+	// returns the first pattern that matches
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		pi, pj := len(pathParam.FindAllString(paths[i], -1)), len(pathParam.FindAllString(paths[j], -1))
+		if pi != pj {
+			return pi < pj
+		}
+		return paths[i] < paths[j]
+	})
+
+	endpoints := make([]config.EndpointConfig, 0)
+	for _, p := range paths {
+		item := doc.Paths[p]
+		ops := []struct {
+			method string
+			op     *openAPIOperation
+		}{
+			{http.MethodGet, item.Get},
+			{http.MethodPost, item.Post},
+			{http.MethodPut, item.Put},
+			{http.MethodPatch, item.Patch},
+			{http.MethodDelete, item.Delete},
+			{http.MethodOptions, item.Options},
+			{http.MethodHead, item.Head},
+		}
+
+		for _, o := range ops {
+			if o.op == nil {
+				continue
+			}
+
+			status, resp := successResponse(o.op)
+			endpoint := config.EndpointConfig{
+				Path:   basePath + pathParam.ReplaceAllString(p, "*"),
+				Method: o.method,
+				Status: status,
+			}
+
+			contentType, example := responseExample(resp, o.op.Produces, schemas)
+			if contentType != "" {
+				endpoint.Headers = map[string]string{"Content-Type": contentType}
+			}
+			if example != nil {
+				body, err := json.MarshalIndent(example, "", "  ")
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: failed to encode example: %w", o.method, p, err)
+				}
+				template, err := WriteTemplate(templateDir, fmt.Sprintf("%s_%s%s.json", name, o.method, p), body)
+				if err != nil {
+					return nil, err
+				}
+				endpoint.Template = template
+			}
+
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	return []config.ServiceConfig{{
+		Name:      name,
+		Type:      "generic",
+		Enabled:   true,
+		Ports:     []int{port},
+		Endpoints: append(endpoints, notFoundEndpoint()),
+	}}, nil
+}
+
+// openAPIBase returns the path prefix and port the API is served on
+func openAPIBase(doc *openAPIDoc) (string, int) {
+	if doc.Swagger != "" {
+		scheme := "http"
+		if len(doc.Schemes) > 0 {
+			scheme = doc.Schemes[0]
+		}
+		return strings.TrimRight(doc.BasePath, "/"), portFromURL(scheme, doc.Host)
+	}
+
+	if len(doc.Servers) > 0 {
+		if u, err := url.Parse(doc.Servers[0].URL); err == nil {
+			return strings.TrimRight(u.Path, "/"), portFromURL(u.Scheme, u.Host)
+		}
+	}
+	return "", 80
+}
+
+// successResponse returns the lowest documented 2xx status of an operation,
+// defaulting to 200
+func successResponse(op *openAPIOperation) (int, *openAPIResponse) {
+	best := 0
+	var bestResp *openAPIResponse
+	for code, resp := range op.Responses {
+		status, err := strconv.Atoi(code)
+		if err != nil || status < 200 || status > 299 {
+			continue
+		}
+		if best == 0 || status < best {
+			best = status
+			r := resp
+			bestResp = &r
+		}
+	}
+	if best == 0 {
+		return http.StatusOK, nil
+	}
+	return best, bestResp
+}
+
+// responseExample returns the content type and example body of a response
+func responseExample(resp *openAPIResponse, produces []string, schemas map[string]*openAPISchema) (string, interface{}) {
+	if resp == nil {
+		return "", nil
+	}
+
+	// OpenAPI 3: prefer a JSON media type
+	if len(resp.Content) > 0 {
+		types := make([]string, 0, len(resp.Content))
+		for t := range resp.Content {
+			types = append(types, t)
+		}
+		sort.Slice(types, func(i, j int) bool {
+			return strings.Contains(types[i], "json") && !strings.Contains(types[j], "json")
+		})
+
+		media := resp.Content[types[0]]
+		if media.Example != nil {
+			return types[0], normalize(media.Example)
+		}
+		return types[0], exampleFor(media.Schema, schemas, 0)
+	}
+
+	// Swagger 2
+	contentType := "application/json"
+	if len(produces) > 0 {
+		contentType = produces[0]
+	}
+	if ex, ok := resp.Examples[contentType]; ok {
+		return contentType, normalize(ex)
+	}
+	if resp.Schema != nil {
+		return contentType, exampleFor(resp.Schema, schemas, 0)
+	}
+	return "", nil
+}
+
+// exampleFor builds an example value conforming to a schema
+func exampleFor(s *openAPISchema, schemas map[string]*openAPISchema, depth int) interface{} {
+	if s == nil || depth > maxSchemaDepth {
+		return nil
+	}
+
+	if s.Ref != "" {
+		name := s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+		return exampleFor(schemas[name], schemas, depth+1)
+	}
+	if s.Example != nil {
+		return normalize(s.Example)
+	}
+	if s.Default != nil {
+		return normalize(s.Default)
+	}
+	if len(s.Enum) > 0 {
+		return normalize(s.Enum[0])
+	}
+
+	if len(s.AllOf) > 0 {
+		merged := make(map[string]interface{})
+		for _, sub := range s.AllOf {
+			if obj, ok := exampleFor(sub, schemas, depth+1).(map[string]interface{}); ok {
+				for k, v := range obj {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+	if len(s.OneOf) > 0 {
+		return exampleFor(s.OneOf[0], schemas, depth+1)
+	}
+	if len(s.AnyOf) > 0 {
+		return exampleFor(s.AnyOf[0], schemas, depth+1)
+	}
+
+	switch s.Type {
+	case "string":
+		return stringExample(s.Format)
+	case "integer":
+		return 1
+	case "number":
+		return 1.5
+	case "boolean":
+		return true
+	case "array":
+		item := exampleFor(s.Items, schemas, depth+1)
+		if item == nil {
+			return []interface{}{}
+		}
+		return []interface{}{item}
+	default:
+		obj := make(map[string]interface{})
+		for k, prop := range s.Properties {
+			obj[k] = exampleFor(prop, schemas, depth+1)
+		}
+		return obj
+	}
+}
+
+func stringExample(format string) string {
+	switch format {
+	case "date-time":
+		return "2024-01-01T00:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "email":
+		return "user@example.com"
+	case "uuid":
+		return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	case "uri", "url":
+		return "https://example.com"
+	case "ipv4":
+		return "192.0.2.1"
+	case "byte":
+		return "c3RyaW5n"
+	default:
+		return "string"
+	}
+}
+
+// normalize converts YAML decoded maps into JSON encodable maps
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[fmt.Sprint(k)] = normalize(item)
+		}
+		return m
+	case []interface{}:
+		for i := range val {
+			val[i] = normalize(val[i])
+		}
+		return val
+	default:
+		return v
+	}
+}
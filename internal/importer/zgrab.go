@@ -0,0 +1,128 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// zgrabResult is the subset of a zgrab2 http module result line that is used
+type zgrabResult struct {
+	IP   string `json:"ip"`
+	Data struct {
+		HTTP struct {
+			Status string `json:"status"`
+			Result struct {
+				Response struct {
+					StatusCode int                 `json:"status_code"`
+					Headers    map[string][]string `json:"headers"`
+					Body       string              `json:"body"`
+					Request    struct {
+						URL struct {
+							Scheme string `json:"scheme"`
+							Host   string `json:"host"`
+							Path   string `json:"path"`
+						} `json:"url"`
+					} `json:"request"`
+				} `json:"response"`
+			} `json:"result"`
+		} `json:"http"`
+	} `json:"data"`
+}
+
+// ParseZgrab converts zgrab2 http module JSON lines into service profiles.
+// Response bodies are written as templates into templateDir.
+func ParseZgrab(r io.Reader, templateDir string) ([]config.ServiceConfig, error) {
+	services := make([]config.ServiceConfig, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var res zgrabResult
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			return nil, fmt.Errorf("failed to parse zgrab line: %w", err)
+		}
+		if res.Data.HTTP.Status != "success" {
+			continue
+		}
+
+		resp := res.Data.HTTP.Result.Response
+		port := portFromURL(resp.Request.URL.Scheme, resp.Request.URL.Host)
+
+		// zgrab2 lower-cases header names and uses underscores
+		headers := make(http.Header)
+		for k, v := range resp.Headers {
+			for _, val := range v {
+				headers.Add(zgrabHeaderName(k), val)
+			}
+		}
+
+		path := resp.Request.URL.Path
+		if path == "" {
+			path = "/"
+		}
+
+		endpoint := config.EndpointConfig{
+			Path:   path,
+			Method: http.MethodGet,
+			Status: resp.StatusCode,
+		}
+		if resp.Body != "" {
+			name := fmt.Sprintf("%s_%d%s.html", res.IP, port, path)
+			template, err := WriteTemplate(templateDir, name, []byte(resp.Body))
+			if err != nil {
+				return nil, err
+			}
+			endpoint.Template = template
+		}
+
+		svcType := GuessServiceType(headers.Get("Server") + " " + headers.Get("X-Powered-By") + " " + resp.Body)
+		services = append(services, config.ServiceConfig{
+			Name:      svcType + "-" + strconv.Itoa(port),
+			Type:      svcType,
+			Enabled:   true,
+			Ports:     []int{port},
+			Headers:   FilterHeaders(headers),
+			Endpoints: []config.EndpointConfig{endpoint, notFoundEndpoint()},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read zgrab output: %w", err)
+	}
+
+	return services, nil
+}
+
+// zgrabHeaderName converts a zgrab2 header key like "x_powered_by" back to
+// its canonical form
+func zgrabHeaderName(k string) string {
+	b := []byte(k)
+	for i := range b {
+		if b[i] == '_' {
+			b[i] = '-'
+		}
+	}
+	return http.CanonicalHeaderKey(string(b))
+}
+
+// portFromURL returns the port of a host, defaulting by scheme
+func portFromURL(scheme, host string) int {
+	u := url.URL{Host: host}
+	if p, err := strconv.Atoi(u.Port()); err == nil {
+		return p
+	}
+	if scheme == "https" {
+		return 443
+	}
+	return 80
+}
@@ -0,0 +1,159 @@
+// Package logging writes the server's own logs with log/slog, tagging each
+// entry with the component that logged it and filtering entries by the level
+// configured for that component
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// settings are the output and levels in effect
+type settings struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+}
+
+// current holds the settings of Setup. Until it is called, entries of every
+// level from info go to the default logger, so that commands other than
+// serve and tests log as the log package does.
+var current atomic.Pointer[settings]
+
+// levelFor returns the level a component logs from
+func levelFor(component string) slog.Level {
+	if s := current.Load(); s != nil {
+		if level, ok := s.levels[component]; ok {
+			return level
+		}
+		return s.level
+	}
+	return slog.LevelInfo
+}
+
+// baseHandler returns the handler entries are written with
+func baseHandler() slog.Handler {
+	if s := current.Load(); s != nil {
+		return s.handler
+	}
+	return slog.Default().Handler()
+}
+
+// Setup directs logs to the configured output, in the configured format and
+// at the configured levels, and makes the result the default logger, so the
+// log package writes there too. It returns the file written to, to be
+// closed on shutdown, or nil.
+func Setup(cfg *config.LogConfig) (io.Closer, error) {
+	var (
+		out    io.Writer
+		closer io.Closer
+	)
+	switch cfg.Output {
+	case "", config.LogOutputStderr:
+		out = os.Stderr
+	case config.LogOutputStdout:
+		out = os.Stdout
+	default:
+		f, err := os.OpenFile(cfg.Output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out, closer = f, f
+	}
+
+	// Components are filtered before entries reach the handler
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var handler slog.Handler
+	if cfg.Format == config.LogFormatJSON {
+		handler = slog.NewJSONHandler(out, opts)
+	} else {
+		handler = slog.NewTextHandler(out, opts)
+	}
+
+	s := &settings{
+		handler: handler,
+		level:   parseLevel(cfg.GetLevel("")),
+		levels:  make(map[string]slog.Level, len(cfg.Components)),
+	}
+	for component := range cfg.Components {
+		s.levels[component] = parseLevel(cfg.GetLevel(component))
+	}
+	current.Store(s)
+	slog.SetDefault(slog.New(&componentHandler{}))
+	return closer, nil
+}
+
+// parseLevel returns the level a validated level name stands for
+func parseLevel(name string) slog.Level {
+	var level slog.Level
+	level.UnmarshalText([]byte(name))
+	return level
+}
+
+// Logger returns the logger of a component. Loggers can be created before
+// Setup is called, and follow it once it is.
+func Logger(component string) *slog.Logger {
+	return slog.New(&componentHandler{component: component})
+}
+
+// componentHandler tags entries with a component and filters them by its
+// level, writing them with the handler in effect when they are logged
+type componentHandler struct {
+	component string
+
+	// with applies the attributes and groups the logger was given, in order
+	with []func(slog.Handler) slog.Handler
+}
+
+func (h *componentHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= levelFor(h.component)
+}
+
+func (h *componentHandler) Handle(ctx context.Context, r slog.Record) error {
+	handler := baseHandler()
+	if h.component != "" {
+		handler = handler.WithAttrs([]slog.Attr{slog.String("component", h.component)})
+	}
+	for _, with := range h.with {
+		handler = with(handler)
+	}
+	return handler.Handle(ctx, r)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.extend(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return h.extend(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *componentHandler) extend(with func(slog.Handler) slog.Handler) slog.Handler {
+	return &componentHandler{
+		component: h.component,
+		with:      append(h.with[:len(h.with):len(h.with)], with),
+	}
+}
+
+// Writer returns a writer logging each write as an entry of a logger, for
+// the standard library's loggers, such as http.Server's ErrorLog
+func Writer(logger *slog.Logger, level slog.Level) io.Writer {
+	return &writer{logger: logger, level: level}
+}
+
+type writer struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.logger.Log(context.Background(), w.level, strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestSetup(t *testing.T) {
+	defaultLogger := slog.Default()
+	defer func() {
+		current.Store(nil)
+		slog.SetDefault(defaultLogger)
+	}()
+
+	path := filepath.Join(t.TempDir(), "spoof.log")
+	closer, err := Setup(&config.LogConfig{
+		Level:      "warn",
+		Format:     config.LogFormatJSON,
+		Output:     path,
+		Components: map[string]string{"database": "debug"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to set up logging: %v", err)
+	}
+
+	Logger("database").Debug("batch written", "size", 3)
+	Logger("server").Info("starting server")
+	Logger("server").With("addr", "0.0.0.0:80").Warn("accept error")
+	closer.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 entries, got %d: %s", len(lines), data)
+	}
+
+	var entries []map[string]any
+	for _, line := range lines {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Expected JSON entries, got %s", line)
+		}
+		entries = append(entries, entry)
+	}
+	if entries[0]["component"] != "database" || entries[0]["level"] != "DEBUG" || entries[0]["size"] != float64(3) {
+		t.Fatalf("Expected the database debug entry, got %v", entries[0])
+	}
+	if entries[1]["component"] != "server" || entries[1]["msg"] != "accept error" || entries[1]["addr"] != "0.0.0.0:80" {
+		t.Fatalf("Expected the server warning, got %v", entries[1])
+	}
+}
@@ -0,0 +1,306 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/logging"
+)
+
+// sinkLog logs the shipping of entries, as the sinks do
+var sinkLog = logging.Logger("sink")
+
+const (
+	// Defaults for settings left at zero
+	defaultBatchSize  = 100
+	defaultBatchWait  = time.Second
+	defaultMaxRetries = 5
+
+	// queueSize bounds how many entries may wait to be shipped. Entries
+	// arriving while the queue is full are dropped rather than delaying a
+	// response.
+	queueSize = 4096
+
+	// pushTimeout bounds each push request
+	pushTimeout = 10 * time.Second
+
+	// drainTimeout bounds pushing the remaining entries, with retries, when
+	// shipping stops
+	drainTimeout = 30 * time.Second
+
+	// Retries back off exponentially between these bounds
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// entry is a log line and the labels of the stream it belongs to
+type entry struct {
+	labels map[string]string
+	ts     time.Time
+	line   string
+}
+
+// Client ships log lines to a Loki push endpoint in batches, retrying failed
+// pushes with exponential backoff
+type Client struct {
+	config     *config.LokiConfig
+	http       *http.Client
+	queue      chan entry
+	stop       chan struct{}
+	done       chan struct{}
+	batchSize  int
+	batchWait  time.Duration
+	maxRetries int
+	dropped    atomic.Int64
+}
+
+// NewClient creates a client for the configured push endpoint
+func NewClient(cfg *config.LokiConfig) *Client {
+	c := &Client{
+		config:     cfg,
+		http:       &http.Client{Timeout: pushTimeout},
+		queue:      make(chan entry, queueSize),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		batchSize:  cfg.BatchSize,
+		batchWait:  cfg.BatchWait,
+		maxRetries: cfg.MaxRetries,
+	}
+	if c.batchSize <= 0 {
+		c.batchSize = defaultBatchSize
+	}
+	if c.batchWait <= 0 {
+		c.batchWait = defaultBatchWait
+	}
+	if c.maxRetries <= 0 {
+		c.maxRetries = defaultMaxRetries
+	}
+	return c
+}
+
+// Push queues a line for the stream identified by labels without blocking.
+// The configured static labels are added, and empty labels are left out. A
+// nil client discards the line.
+func (c *Client) Push(labels map[string]string, ts time.Time, line string) {
+	if c == nil {
+		return
+	}
+
+	stream := make(map[string]string, len(labels)+len(c.config.Labels))
+	for k, v := range c.config.Labels {
+		stream[k] = v
+	}
+	for k, v := range labels {
+		if v != "" {
+			stream[k] = v
+		}
+	}
+
+	select {
+	case c.queue <- entry{labels: stream, ts: ts, line: line}:
+	default:
+		c.dropped.Add(1)
+	}
+}
+
+// Start ships batches until ctx is cancelled or Close is called, then pushes
+// whatever is still queued
+func (c *Client) Start(ctx context.Context) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.batchWait)
+	defer ticker.Stop()
+
+	batch := make([]entry, 0, c.batchSize)
+	flush := func(ctx context.Context) {
+		if n := c.dropped.Swap(0); n > 0 {
+			sinkLog.Warn("Loki queue full", "dropped", n)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := c.send(ctx, batch); err != nil {
+			sinkLog.Error("failed to ship entries to Loki", "entries", len(batch), "err", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e := <-c.queue:
+			batch = append(batch, e)
+			if len(batch) >= c.batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			c.drain(context.Background(), batch)
+			return
+		case <-c.stop:
+			c.drain(ctx, batch)
+			return
+		}
+	}
+}
+
+// drain pushes the pending batch and everything still queued
+func (c *Client) drain(ctx context.Context, batch []entry) {
+	for len(c.queue) > 0 {
+		batch = append(batch, <-c.queue)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, drainTimeout)
+	defer cancel()
+	if err := c.send(ctx, batch); err != nil {
+		sinkLog.Error("failed to ship entries to Loki", "entries", len(batch), "err", err)
+	}
+}
+
+// Close stops shipping after pushing the queued entries, waiting until they
+// are sent or ctx is done
+func (c *Client) Close(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	close(c.stop)
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush Loki entries: %w", ctx.Err())
+	}
+}
+
+// send pushes a batch, retrying failures that may be temporary
+func (c *Client) send(ctx context.Context, batch []entry) error {
+	backoff := minBackoff
+	var err error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff = min(backoff*2, maxBackoff)
+		}
+
+		err = c.push(ctx, batch)
+		if err == nil {
+			return nil
+		}
+		if perm, ok := err.(*permanentError); ok {
+			return perm.err
+		}
+	}
+	return err
+}
+
+// permanentError is a push failure that retrying will not fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// stream is a Loki push API stream
+type stream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// encode groups a batch into one stream per label set
+func encode(batch []entry) ([]byte, error) {
+	streams := make(map[string]*stream)
+	keys := make([]string, 0)
+	for _, e := range batch {
+		key := labelKey(e.labels)
+		s, ok := streams[key]
+		if !ok {
+			s = &stream{Stream: e.labels}
+			streams[key] = s
+			keys = append(keys, key)
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.ts.UnixNano(), 10), e.line})
+	}
+
+	body := struct {
+		Streams []*stream `json:"streams"`
+	}{Streams: make([]*stream, 0, len(keys))}
+	for _, key := range keys {
+		body.Streams = append(body.Streams, streams[key])
+	}
+	return json.Marshal(body)
+}
+
+// labelKey identifies a label set independent of map order
+func labelKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, k := range names {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// push sends one batch to the push endpoint
+func (c *Client) push(ctx context.Context, batch []entry) error {
+	body, err := encode(batch)
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to encode batch: %w", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to create push request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.config.TenantID)
+	}
+	if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("push returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return &permanentError{err}
+}
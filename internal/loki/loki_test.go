@@ -0,0 +1,78 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestClient_RetriesAndGroupsStreams(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	var received []stream
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "ingester unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("X-Scope-OrgID") != "honeypot" {
+			t.Errorf("Expected tenant header, got %q", r.Header.Get("X-Scope-OrgID"))
+		}
+		var body struct {
+			Streams []stream `json:"streams"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode push: %v", err)
+		}
+		received = append(received, body.Streams...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := NewClient(&config.LokiConfig{
+		URL:       srv.URL,
+		TenantID:  "honeypot",
+		Labels:    map[string]string{"job": "service-spoof"},
+		BatchSize: 3,
+		BatchWait: time.Hour,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Start(ctx)
+
+	now := time.Now()
+	c.Push(map[string]string{"service": "nginx", "country": ""}, now, "a")
+	c.Push(map[string]string{"service": "apache2"}, now, "b")
+	c.Push(map[string]string{"service": "nginx"}, now, "c")
+
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer closeCancel()
+	if err := c.Close(closeCtx); err != nil {
+		t.Fatalf("Failed to close client: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 2 {
+		t.Fatalf("Expected 2 push attempts, got %d", attempts)
+	}
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 streams, got %d", len(received))
+	}
+	nginx := received[0]
+	if nginx.Stream["service"] != "nginx" || nginx.Stream["job"] != "service-spoof" || len(nginx.Values) != 2 {
+		t.Fatalf("Expected 2 nginx lines with the job label, got %+v", nginx)
+	}
+	if _, ok := nginx.Stream["country"]; ok {
+		t.Fatalf("Expected empty labels to be left out, got %+v", nginx.Stream)
+	}
+}
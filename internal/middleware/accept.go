@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// Delays between retries of a failed Accept, as net/http backs off
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// RetryListener retries Accept after temporary errors, such as the process
+// running out of file descriptors, instead of returning them. Servers stop
+// serving a listener on the first error Accept returns, so without it a
+// burst of connections across many ports would close ports for good.
+type RetryListener struct {
+	net.Listener
+}
+
+func (rl *RetryListener) Accept() (net.Conn, error) {
+	var delay time.Duration
+	for {
+		conn, err := rl.Listener.Accept()
+		if err == nil {
+			return conn, nil
+		}
+		var temp interface{ Temporary() bool }
+		if !errors.As(err, &temp) || !temp.Temporary() {
+			return nil, err
+		}
+
+		if delay == 0 {
+			delay = minAcceptDelay
+		} else {
+			delay = min(2*delay, maxAcceptDelay)
+		}
+		middlewareLog.Error("accept error, retrying", "addr", rl.Addr().String(), "err", err, "delay", delay)
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/davidthuman/service-spoof/internal/apierror"
+	"github.com/davidthuman/service-spoof/internal/service"
+)
+
+// APIErrors creates middleware that answers a service's routing and
+// validation errors in the JSON format of its framework: requests for no
+// endpoint, requests with a method only other endpoints on the path take,
+// requests missing required fields, and endpoints with an error status and
+// no template. A nil format disables it.
+func APIErrors(svc service.Service, format *apierror.Format) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if format == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			router := svc.Router()
+			endpoint, matched := router.MatchRequest(r)
+			if !matched || endpoint.IsWildcard() {
+				// Frameworks answer HEAD wherever they answer GET
+				allowed := router.Allowed(r.URL.Path)
+				if slices.Contains(allowed, http.MethodGet) && !slices.Contains(allowed, http.MethodHead) {
+					allowed = append(allowed, http.MethodHead)
+				}
+				if len(allowed) > 0 && !slices.Contains(allowed, r.Method) {
+					format.MethodNotAllowed(w, r, allowed)
+					return
+				}
+			}
+			if !matched {
+				format.NotFound(w, r)
+				return
+			}
+
+			for k, v := range endpoint.Headers {
+				w.Header().Set(k, v)
+			}
+			if endpoint.Template == "" && endpoint.Status >= 400 {
+				if endpoint.Status == http.StatusNotFound {
+					format.NotFound(w, r)
+				} else {
+					format.Status(w, r, endpoint.Status)
+				}
+				return
+			}
+			if format.Validate(w, r, endpoint.Required) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
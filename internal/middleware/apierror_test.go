@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/apierror"
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/service"
+)
+
+func TestAPIErrors(t *testing.T) {
+	cfg := &config.ServiceConfig{
+		Name: "api",
+		Type: "generic",
+		API:  &config.APIConfig{Framework: config.FrameworkLaravel},
+		Endpoints: []config.EndpointConfig{
+			{Path: "/api/users", Method: "GET", Status: 200},
+			{Path: "/api/login", Method: "POST", Status: 200, Required: []string{"email", "password"}},
+			{Path: "/api/admin/*", Method: "*", Status: 403},
+			{Path: "/*", Method: "*", Status: 404},
+		},
+	}
+	svc, err := service.NewService(cfg, nil)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	handler := APIErrors(svc, apierror.New(cfg.API))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("served"))
+	}))
+
+	cases := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		prefix string
+	}{
+		{"GET", "/api/users", "", 200, "served"},
+		{"DELETE", "/api/users", "", 405, `{"message":"The DELETE method is not supported for route api/users. Supported methods: GET, HEAD."}`},
+		{"GET", "/api/missing", "", 404, `{"message":"The route api/missing could not be found."}`},
+		{"GET", "/api/admin/users", "", 403, `{"message":"Forbidden"}`},
+		{"POST", "/api/login", `{"email":"a@b.test"}`, 422, `{"message":"The password field is required."`},
+		{"POST", "/api/login", `{"email":"a@b.test","password":"x"}`, 200, "served"},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != tc.status || !strings.HasPrefix(rec.Body.String(), tc.prefix) {
+			t.Fatalf("Expected %s %s answered %d %s, got %d %s", tc.method, tc.path, tc.status, tc.prefix, rec.Code, rec.Body.String())
+		}
+	}
+}
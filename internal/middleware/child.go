@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net"
+	"sync"
+)
+
+// childListener is a net.Listener fed with connections accepted by a parent
+// listener, such as a ProtocolMux or RedirectListener
+type childListener struct {
+	addr   net.Addr
+	conns  chan net.Conn
+	closed chan struct{}
+	done   <-chan struct{}
+	once   sync.Once
+}
+
+// newChildListener creates a child listener that stops accepting once it is
+// closed or done is closed
+func newChildListener(addr net.Addr, done <-chan struct{}) *childListener {
+	return &childListener{
+		addr:   addr,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+		done:   done,
+	}
+}
+
+func (cl *childListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-cl.conns:
+		return conn, nil
+	case <-cl.closed:
+		return nil, net.ErrClosed
+	case <-cl.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the listener without closing the parent listener, which other
+// children may still be using
+func (cl *childListener) Close() error {
+	cl.once.Do(func() { close(cl.closed) })
+	return nil
+}
+
+func (cl *childListener) Addr() net.Addr {
+	return cl.addr
+}
+
+// deliver hands a connection to the listener, closing it if the listener
+// is no longer accepting
+func (cl *childListener) deliver(conn net.Conn) {
+	select {
+	case cl.conns <- conn:
+	case <-cl.closed:
+		conn.Close()
+	case <-cl.done:
+		conn.Close()
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/davidthuman/service-spoof/internal/cloud"
+)
+
+// cloudWriter adds a cloud front end's headers to a response as its status
+// is written, and swaps the gateway errors the front end would answer itself
+// for its own page
+type cloudWriter struct {
+	http.ResponseWriter
+	front     *cloud.Front
+	r         *http.Request
+	requestID string
+	wrote     bool
+	replaced  bool
+}
+
+func (cw *cloudWriter) WriteHeader(code int) {
+	if cw.wrote {
+		return
+	}
+	if code < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.wrote = true
+	if cw.front.ErrorPage(cw.ResponseWriter, cw.r, code, cw.requestID) {
+		cw.replaced = true
+		return
+	}
+	cw.front.Header(cw.Header(), cw.r, code, cw.requestID)
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cloudWriter) Write(b []byte) (int, error) {
+	if !cw.wrote {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.replaced {
+		return len(b), nil
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *cloudWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Cloud creates middleware that makes responses look like they passed
+// through a cloud provider's load balancer or CDN. A nil front end disables
+// it.
+func Cloud(front *cloud.Front) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if front == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &cloudWriter{ResponseWriter: w, front: front, r: r, requestID: front.RequestID()}
+			next.ServeHTTP(cw, r)
+			if !cw.wrote {
+				cw.WriteHeader(http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/cloud"
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestCloud(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.24.0")
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html>nginx bad gateway</html>"))
+			return
+		}
+		w.Write([]byte("It works!"))
+	})
+	serve := func(profile, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		handler := Cloud(cloud.New(&config.CloudConfig{Pop: "FRA56-P1"}, profile))(backend)
+		r := httptest.NewRequest(http.MethodGet, "http://app.example.com"+path, nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := serve(config.CloudAWSCloudFront, "/")
+	h := rec.Header()
+	if rec.Body.String() != "It works!" || h.Get("Server") != "nginx/1.24.0" || h.Get("X-Cache") != "Miss from cloudfront" ||
+		h.Get("X-Amz-Cf-Pop") != "FRA56-P1" || len(h.Get("X-Amz-Cf-Id")) != 56 || !strings.HasSuffix(h.Get("Via"), ".cloudfront.net (CloudFront)") {
+		t.Fatalf("Expected the backend's response through CloudFront, got %v %q", h, rec.Body.String())
+	}
+
+	rec = serve(config.CloudAWSCloudFront, "/down")
+	h = rec.Header()
+	if rec.Code != http.StatusBadGateway || h.Get("Server") != "CloudFront" || h.Get("X-Cache") != "Error from cloudfront" ||
+		!strings.Contains(rec.Body.String(), "Request ID: "+h.Get("X-Amz-Cf-Id")) {
+		t.Fatalf("Expected CloudFront's error page, got %d %v %q", rec.Code, h, rec.Body.String())
+	}
+
+	rec = serve(config.CloudAWSALB, "/down")
+	if rec.Header().Get("Server") != "awselb/2.0" || !strings.Contains(rec.Body.String(), "<h1>502 Bad Gateway</h1>") ||
+		len(rec.Result().Cookies()) != 2 {
+		t.Fatalf("Expected the ALB's error page with stickiness cookies, got %v %q", rec.Header(), rec.Body.String())
+	}
+
+	rec = serve(config.CloudAWSELB, "/down")
+	if rec.Code != http.StatusBadGateway || rec.Body.Len() != 0 || rec.Header().Get("Server") != "" {
+		t.Fatalf("Expected a classic ELB's empty error, got %v %q", rec.Header(), rec.Body.String())
+	}
+
+	rec = serve(config.CloudAzureAppService, "/")
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 2 || cookies[0].Name != "ARRAffinity" || cookies[0].Domain != "app.example.com" || len(cookies[0].Value) != 64 {
+		t.Fatalf("Expected ARRAffinity cookies, got %v", cookies)
+	}
+	rec = serve(config.CloudAzureAppService, "/", &http.Cookie{Name: "ARRAffinity", Value: cookies[0].Value})
+	if len(rec.Result().Cookies()) != 0 {
+		t.Fatalf("Expected no new affinity cookie for a pinned client, got %v", rec.Result().Cookies())
+	}
+
+	if rec := serve("", "/down"); !strings.Contains(rec.Body.String(), "nginx") {
+		t.Fatalf("Expected no front end to leave the backend's page, got %q", rec.Body.String())
+	}
+}
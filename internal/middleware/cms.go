@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/davidthuman/service-spoof/internal/cms"
+)
+
+// CMS creates middleware that answers a CMS service's REST API from the state
+// each source built up, before the service's endpoints. A nil store disables
+// it.
+func CMS(store *cms.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if store == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if store.Handle(w, r) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
-	"log"
 	"net"
 
 	"github.com/davidthuman/service-spoof/internal/fingerprint"
@@ -14,6 +13,16 @@ import (
 
 type TlsClientHelloListener struct {
 	net.Listener
+
+	// OnNonTLS is called with the first bytes of connections that do not
+	// start with a TLS handshake record
+	OnNonTLS func(conn net.Conn, raw []byte, protocol string)
+
+	// Store records the JA4 fingerprint of every parsed ClientHello, if set
+	Store *fingerprint.Store
+
+	// JA3Store records the JA3 fingerprint of every parsed ClientHello, if set
+	JA3Store *fingerprint.Store
 }
 
 func (wl *TlsClientHelloListener) Accept() (net.Conn, error) {
@@ -21,14 +30,37 @@ func (wl *TlsClientHelloListener) Accept() (net.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &TlsClientHelloConn{Conn: conn}, nil
+	return &TlsClientHelloConn{Conn: conn, onNonTLS: wl.OnNonTLS, store: wl.Store, ja3Store: wl.JA3Store}, nil
 }
 
+// maxClientHelloRecord is the longest TLS record a ClientHello is read from,
+// the record header and the most plaintext a record may carry
+const maxClientHelloRecord = 5 + 1<<14
+
 type TlsClientHelloConn struct {
 	net.Conn
+	// buffer holds the bytes read until the ClientHello is complete. It is
+	// released once the ClientHello is parsed or the connection turns out
+	// not to start with one, so long-lived connections hold no copy of
+	// what they read.
 	buffer        bytes.Buffer
+	skipped       bool
 	handshakeSize uint16
 	fingerprint   string
+	ja4r          string
+	ja4o          string
+	ja3           string
+	hello         []byte
+	onNonTLS      func(conn net.Conn, raw []byte, protocol string)
+	sniffed       bool
+	store         *fingerprint.Store
+	ja3Store      *fingerprint.Store
+	wroteHello    bool
+}
+
+// NetConn returns the wrapped connection
+func (c *TlsClientHelloConn) NetConn() net.Conn {
+	return c.Conn
 }
 
 func (c *TlsClientHelloConn) hasCompletedClientHello() bool {
@@ -43,7 +75,7 @@ func (c *TlsClientHelloConn) hasCompletedClientHello() bool {
 		// if buffer content is longer than we need,
 		// cut it to expected len
 		c.buffer.Truncate(int(c.handshakeSize))
-		log.Printf("truncated buffer from %d to %d bytes", bufLen, c.handshakeSize)
+		fingerprintLog.Debug("truncated buffer", "from", bufLen, "to", c.handshakeSize)
 	}
 	return true
 }
@@ -56,7 +88,7 @@ func (c *TlsClientHelloConn) ParseClientHello() error {
 	bufBytes := c.buffer.Bytes()
 	bufLen := c.buffer.Len()
 	if bufLen < 5 {
-		log.Printf("buffer too short (%d bytes), skipping parse", bufLen)
+		fingerprintLog.Debug("buffer too short, skipping parse", "bytes", bufLen)
 		return errors.New("incomplete client hello")
 	}
 
@@ -71,6 +103,9 @@ func (c *TlsClientHelloConn) ParseClientHello() error {
 	}
 
 	handshakeLen := uint16(bufBytes[3])<<8 | uint16(bufBytes[4])
+	if 5+int(handshakeLen) > maxClientHelloRecord {
+		return fmt.Errorf("tls record of %d bytes is too long", handshakeLen)
+	}
 	c.handshakeSize = 5 + handshakeLen
 
 	if c.hasCompletedClientHello() {
@@ -84,17 +119,33 @@ func (c *TlsClientHelloConn) Read(p []byte) (int, error) {
 	// Read data from the underlying connection
 	n, err := c.Conn.Read(p)
 
-	if c.fingerprint == "" && err == nil && n > 0 {
+	if !c.sniffed && n > 0 {
+		c.sniffed = true
+		if p[0] != 0x16 && c.onNonTLS != nil {
+			c.onNonTLS(c.Conn, p[:n], GuessProtocol(p[:n]))
+		}
+	}
+
+	if c.fingerprint == "" && !c.skipped && err == nil && n > 0 {
 
 		if c.hasCompletedClientHello() {
 			//log.Println("Conn has full Client Hello message")
 			//log.Println("Raw data received")
 			//fmt.Println(hex.Dump(c.buffer.Bytes()))
-			fingerprint1, err := fingerprint.ParseJA4(c.buffer.Bytes(), byte('t'))
+			fingerprint1 := ""
+			hello, err := fingerprint.ParseClientHello(c.buffer.Bytes())
 			if err != nil {
 				fingerprint1 = err.Error()
+			} else {
+				fingerprint1 = hello.JA4('t')
+				c.ja4r = hello.JA4R('t')
+				c.ja4o = hello.JA4O('t')
+				c.hello = fingerprint.StableClientHello(c.buffer.Bytes())
+				source, _, _ := net.SplitHostPort(c.Conn.RemoteAddr().String())
+				c.store.Record(fingerprint1, source)
 			}
-			log.Printf("JA4 Fingerprint 1: %s\n", fingerprint1)
+			fingerprintLog.Info("ClientHello", "remote", c.Conn.RemoteAddr().String(),
+				"ja4", fingerprint1, "ja4_r", c.ja4r, "ja4_o", c.ja4o)
 
 			fingerprint2 := ""
 			j := fingerprint.JA4Fingerprint{}
@@ -104,30 +155,64 @@ func (c *TlsClientHelloConn) Read(p []byte) (int, error) {
 			} else {
 				fingerprint2 = j.String()
 			}
-			log.Printf("JA4 Fingerprint 2: %s\n", fingerprint2)
+			fingerprintLog.Debug("ClientHello unmarshaled", "ja4", fingerprint2)
 
 			c.fingerprint = fingerprint1
 
+			if ja3, raw, err := fingerprint.ParseJA3(c.buffer.Bytes()); err == nil {
+				source, _, _ := net.SplitHostPort(c.Conn.RemoteAddr().String())
+				c.ja3Store.Record(ja3, source)
+				c.ja3 = ja3
+				fingerprintLog.Info("ClientHello JA3", "ja3", ja3, "raw", raw)
+			}
+			c.buffer = bytes.Buffer{}
+
 		} else {
 			c.buffer.Write(p[:n])
-			_ = c.ParseClientHello()
-			log.Printf("Writing to buffer. New length %d", c.buffer.Len())
+			// Stop buffering connections that do not start with a
+			// handshake record short enough to hold a ClientHello
+			if err := c.ParseClientHello(); err != nil && c.buffer.Len() >= 5 {
+				c.skipped = true
+				c.buffer = bytes.Buffer{}
+			} else {
+				fingerprintLog.Debug("writing to buffer", "length", c.buffer.Len())
+			}
 		}
 	}
 
 	return n, err
 }
 
+// Write logs the JA3S fingerprint of the ServerHello the server answers
+// with, which should match that of the server being emulated
+func (c *TlsClientHelloConn) Write(p []byte) (int, error) {
+	if !c.wroteHello {
+		c.wroteHello = true
+		if ja3s, raw, err := fingerprint.ParseJA3S(p); err == nil {
+			fingerprintLog.Info("ServerHello JA3S", "ja3s", ja3s, "raw", raw)
+		}
+	}
+	return c.Conn.Write(p)
+}
+
 func ConnContextFingerprint(ctx context.Context, conn net.Conn) context.Context {
-	log.Println("Conn Context checking connection")
+	fingerprintLog.Debug("checking connection")
 
 	// Now assert the type to get *tls.Conn
 	if tlsConn, ok := conn.(*tls.Conn); ok {
 		// Use tlsConn for TLS-specific operations
 		cc := tlsConn.NetConn().(*TlsClientHelloConn)
+		ctx = context.WithValue(ctx, fingerprint.Hello, &cc.hello)
+		ctx = context.WithValue(ctx, fingerprint.JA3, &cc.ja3)
+		ctx = context.WithValue(ctx, fingerprint.JA4R, &cc.ja4r)
+		ctx = context.WithValue(ctx, fingerprint.JA4O, &cc.ja4o)
 		return context.WithValue(ctx, fingerprint.JA4, &cc.fingerprint)
 	} else {
 		cc := conn.(*TlsClientHelloConn)
+		ctx = context.WithValue(ctx, fingerprint.Hello, &cc.hello)
+		ctx = context.WithValue(ctx, fingerprint.JA3, &cc.ja3)
+		ctx = context.WithValue(ctx, fingerprint.JA4R, &cc.ja4r)
+		ctx = context.WithValue(ctx, fingerprint.JA4O, &cc.ja4o)
 		return context.WithValue(ctx, fingerprint.JA4, &cc.fingerprint)
 	}
 }
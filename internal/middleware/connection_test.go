@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"io"
+	"log"
+	"net"
+	"testing"
+)
+
+// chunkConn is a connection that returns its chunks from successive reads
+type chunkConn struct {
+	net.Conn
+	chunks [][]byte
+}
+
+func (c *chunkConn) Read(p []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.chunks[0])
+	c.chunks[0] = c.chunks[0][n:]
+	if len(c.chunks[0]) == 0 {
+		c.chunks = c.chunks[1:]
+	}
+	return n, nil
+}
+
+func (c *chunkConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 40000}
+}
+
+func FuzzTlsClientHelloConn(f *testing.F) {
+	f.Add([]byte{0x16, 0x03, 0x01, 0x00, 0x04, 0x01, 0x00, 0x00, 0x00}, uint8(3))
+	f.Add([]byte{0x16, 0x03, 0x03, 0xff, 0xff}, uint8(1))
+	f.Add([]byte("GET / HTTP/1.1\r\n\r\n"), uint8(0))
+
+	w := log.Writer()
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(w) })
+
+	// Split the bytes into chunks, since the ClientHello is parsed as it
+	// arrives over several reads
+	f.Fuzz(func(t *testing.T, data []byte, split uint8) {
+		var chunks [][]byte
+		size := int(split)%16 + 1
+		for len(data) > size {
+			chunks = append(chunks, data[:size])
+			data = data[size:]
+		}
+		chunks = append(chunks, data, []byte{0})
+
+		conn := &TlsClientHelloConn{Conn: &chunkConn{chunks: chunks}}
+		p := make([]byte, 512)
+		for {
+			if _, err := conn.Read(p); err != nil {
+				break
+			}
+			_ = conn.ParseClientHello()
+		}
+	})
+}
+
+func TestTlsClientHelloConn_StopsBufferingPlaintext(t *testing.T) {
+	w := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(w)
+
+	conn := &TlsClientHelloConn{Conn: &chunkConn{chunks: [][]byte{
+		[]byte("GET / HTTP/1.1\r\n"),
+		[]byte("Host: example.com\r\n\r\n"),
+	}}}
+	p := make([]byte, 512)
+	for {
+		if _, err := conn.Read(p); err != nil {
+			break
+		}
+	}
+	if conn.buffer.Len() != 0 {
+		t.Fatalf("Expected plaintext not to be buffered, got %d bytes", conn.buffer.Len())
+	}
+
+	// A record longer than any ClientHello is not buffered either
+	conn = &TlsClientHelloConn{Conn: &chunkConn{chunks: [][]byte{{0x16, 0x03, 0x01, 0xff, 0xff}, make([]byte, 256)}}}
+	for {
+		if _, err := conn.Read(p); err != nil {
+			break
+		}
+	}
+	if conn.buffer.Len() != 0 {
+		t.Fatalf("Expected an oversized record not to be buffered, got %d bytes", conn.buffer.Len())
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/engagement"
+)
+
+// EngagementLimits creates middleware that degrades the rest of a source's
+// session once it goes past its engagement limits. Requests past the limits
+// are not passed on, so they are neither answered nor logged. A nil limiter
+// disables it.
+func EngagementLimits(limiter *engagement.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			source := database.SourceIP(r.RemoteAddr)
+			if limiter.Allow(source, time.Now()) {
+				cw := &countingWriter{ResponseWriter: w}
+				defer func() { limiter.Served(source, cw.n) }()
+				next.ServeHTTP(cw, r)
+				return
+			}
+
+			switch limiter.Action() {
+			case config.EngagementActionError:
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			case config.EngagementActionTimeout:
+				select {
+				case <-r.Context().Done():
+				case <-time.After(limiter.Hold()):
+				}
+			}
+			// Drop the connection without a response
+			panic(http.ErrAbortHandler)
+		})
+	}
+}
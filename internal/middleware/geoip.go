@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/davidthuman/service-spoof/internal/geoip"
+)
+
+// GeoIP looks up the source of each request and stores its country and AS in
+// the request context, so endpoints can be matched on them. A nil database
+// passes requests through unchanged.
+func GeoIP(db *geoip.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if db == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rec, ok := db.Lookup(r.RemoteAddr); ok {
+				r = r.WithContext(geoip.NewContext(r.Context(), rec))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/hostheader"
+)
+
+// maxGuardHeaderBytes bounds how much of a request head is buffered before
+// the request is treated as malformed
+const maxGuardHeaderBytes = 64 << 10
+
+// BadRequestResponse is the raw response written for malformed requests, and
+// by Recover for handler panics. Order is the order its headers are written
+// in, as for HeaderOrder; without one the Date comes first and the rest are
+// sorted.
+type BadRequestResponse struct {
+	Status  int
+	Headers map[string]string
+	Body    []byte
+	Order   []string
+}
+
+// defaultOrder is the header order of responses without one
+var defaultOrder = []string{"Date", "*", "Content-Length", "Connection"}
+
+// Write writes the response to w, closing the connection afterwards like
+// Apache and nginx do for unparseable requests
+func (b *BadRequestResponse) Write(w io.Writer) error {
+	h := make(http.Header, len(b.Headers)+3)
+	for k, v := range b.Headers {
+		h[k] = []string{v}
+	}
+	h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	h.Set("Content-Length", strconv.Itoa(len(b.Body)))
+	h.Set("Connection", "close")
+
+	order := b.Order
+	if order == nil {
+		order = defaultOrder
+	}
+
+	var buf bytes.Buffer
+	writeHead(&buf, b.Status, http.StatusText(b.Status), h, order)
+	buf.Write(b.Body)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// GuardListener validates the first request head on each connection before
+// it reaches net/http, which would otherwise answer malformed or non-HTTP
+// input with its own distinctive 400 response and drop the bytes without
+// logging them. If Response is nil, rejected bytes are logged and then
+// passed through to net/http unchanged. AllowHTTP2 passes connections
+// starting with the HTTP/2 preface through, for servers accepting h2c.
+type GuardListener struct {
+	net.Listener
+	Response    *BadRequestResponse
+	OnMalformed func(conn net.Conn, raw []byte, protocol string, err error)
+	AllowHTTP2  bool
+}
+
+func (gl *GuardListener) Accept() (net.Conn, error) {
+	conn, err := gl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &GuardConn{Conn: conn, listener: gl}, nil
+}
+
+// GuardConn buffers the first request head of a connection, replaying it to
+// the HTTP server if it parses and answering it directly if it does not
+type GuardConn struct {
+	net.Conn
+	listener *GuardListener
+	checked  bool
+	pending  []byte
+	rejected bool
+}
+
+// NetConn returns the wrapped connection
+func (c *GuardConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *GuardConn) Read(p []byte) (int, error) {
+	if c.rejected {
+		return 0, io.EOF
+	}
+
+	if !c.checked {
+		c.checked = true
+		if err := c.check(); err != nil {
+			return 0, err
+		}
+	}
+
+	// Replay the buffered request head before reading further
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+
+	return c.Conn.Read(p)
+}
+
+// check reads until the end of the first request head and validates it
+func (c *GuardConn) check() error {
+	buf := make([]byte, 4096)
+	head := make([]byte, 0, 4096)
+
+	for !bytes.Contains(head, []byte("\r\n\r\n")) && !bytes.Contains(head, []byte("\n\n")) {
+		if len(head) > maxGuardHeaderBytes {
+			return c.reject(head, ProtocolHTTP, fmt.Errorf("request head exceeds %d bytes", maxGuardHeaderBytes))
+		}
+
+		n, err := c.Conn.Read(buf)
+		head = append(head, buf[:n]...)
+
+		// Other protocols never send an HTTP head terminator, so they are
+		// rejected on their first bytes
+		protocol := GuessProtocol(head)
+		if protocol == ProtocolHTTP2 && c.listener.AllowHTTP2 {
+			c.pending = head
+			return nil
+		}
+		if len(head) > 0 && !isHTTPGuess(protocol) {
+			return c.reject(head, protocol, fmt.Errorf("non-HTTP data (%s)", protocol))
+		}
+
+		if err != nil {
+			if len(head) == 0 {
+				return err
+			}
+			// The client stopped sending before completing a request head
+			return c.reject(head, ProtocolHTTP, fmt.Errorf("incomplete request head: %w", err))
+		}
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(head)))
+	if err != nil {
+		return c.reject(head, ProtocolHTTP, err)
+	}
+
+	// net/http refuses these Host headers before any handler sees them
+	if req.ProtoAtLeast(1, 1) && req.Host == "" {
+		return c.reject(head, ProtocolHTTP, errors.New("missing Host header"))
+	}
+	if !hostheader.Valid(req.Host) {
+		return c.reject(head, ProtocolHTTP, fmt.Errorf("malformed Host header %q", req.Host))
+	}
+
+	c.pending = head
+	return nil
+}
+
+// reject logs the raw bytes and answers the connection with the configured
+// response, or replays the bytes to net/http if none is configured
+func (c *GuardConn) reject(raw []byte, protocol string, err error) error {
+	if c.listener.OnMalformed != nil {
+		c.listener.OnMalformed(c.Conn, raw, protocol, err)
+	}
+
+	if c.listener.Response == nil {
+		c.pending = raw
+		return nil
+	}
+
+	c.rejected = true
+	if werr := c.listener.Response.Write(c.Conn); werr != nil {
+		return io.EOF
+	}
+
+	// Half-close so the client receives the response before the reset
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+	return io.EOF
+}
+
+// isHTTPGuess reports whether a protocol guess may still turn out to be an
+// HTTP/1.x request once more bytes arrive
+func isHTTPGuess(protocol string) bool {
+	return protocol == ProtocolHTTP || protocol == ProtocolText
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/handoff"
+)
+
+// Handoff creates middleware marking the requests of sources handed off to
+// the high-interaction honeypot in the request context, with the address
+// they go to, for HandoffProxy to forward. It belongs outside Logger, so
+// marked requests are logged as handed off. A nil hand-off disables it.
+func Handoff(h *handoff.Handoff) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if h == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if h.Pinned(database.SourceIP(r.RemoteAddr), time.Now()) {
+				r = r.WithContext(handoff.NewContext(r.Context(), h.Target(LocalPort(r))))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HandoffProxy forwards requests marked by Handoff to the honeypot instead
+// of answering them, falling back to answering them if it cannot be reached.
+// It belongs inside Logger, so the honeypot's responses are logged.
+func HandoffProxy(h *handoff.Handoff) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if h == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			target, ok := handoff.FromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h.Proxy(w, r, target, next)
+		})
+	}
+}
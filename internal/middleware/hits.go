@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// HitStats counts the requests answered on a listener
+type HitStats struct {
+	requests atomic.Uint64
+	errors   atomic.Uint64
+	lastHit  atomic.Int64
+}
+
+// PortStats is a point-in-time snapshot of a listener's HitStats and
+// ConnStats, with the services answering it
+type PortStats struct {
+	Address  string        `json:"address"`
+	Services []string      `json:"services"`
+	Requests uint64        `json:"requests"`
+	Errors   uint64        `json:"errors"`
+	LastHit  *time.Time    `json:"last_hit"`
+	Listener ListenerStats `json:"listener"`
+}
+
+// Hit counts a request or protocol session answered at a time, and whether
+// it failed
+func (h *HitStats) Hit(now time.Time, failed bool) {
+	h.requests.Add(1)
+	if failed {
+		h.errors.Add(1)
+	}
+	h.lastHit.Store(now.UnixNano())
+}
+
+// Snapshot returns the current counters, with no last hit before the first
+func (h *HitStats) Snapshot() PortStats {
+	stats := PortStats{
+		Requests: h.requests.Load(),
+		Errors:   h.errors.Load(),
+	}
+	if last := h.lastHit.Load(); last != 0 {
+		t := time.Unix(0, last)
+		stats.LastHit = &t
+	}
+	return stats
+}
+
+// statusWriter records the status of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// CountHits creates middleware counting the requests answered on a
+// listener, those answered with a server error or aborted as failed
+func CountHits(stats *HitStats) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			failed := true
+			defer func() { stats.Hit(time.Now(), failed) }()
+			next.ServeHTTP(sw, r)
+			failed = sw.status >= http.StatusInternalServerError
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCountHits(t *testing.T) {
+	stats := &HitStats{}
+	if stats.Snapshot().LastHit != nil {
+		t.Fatalf("Expected no last hit before the first request")
+	}
+
+	handler := CountHits(stats)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	for _, path := range []string{"/", "/missing", "/error"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	snapshot := stats.Snapshot()
+	if snapshot.Requests != 3 || snapshot.Errors != 1 {
+		t.Fatalf("Expected 3 requests and 1 error, got %d and %d", snapshot.Requests, snapshot.Errors)
+	}
+	if snapshot.LastHit == nil {
+		t.Fatalf("Expected the last hit to be recorded")
+	}
+}
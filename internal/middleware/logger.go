@@ -1,21 +1,36 @@
 package middleware
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 
+	"github.com/davidthuman/service-spoof/internal/canary"
 	"github.com/davidthuman/service-spoof/internal/database"
 	"github.com/davidthuman/service-spoof/internal/fingerprint"
+	"github.com/davidthuman/service-spoof/internal/handoff"
+	"github.com/davidthuman/service-spoof/internal/logging"
 	"github.com/davidthuman/service-spoof/internal/service"
+	"github.com/davidthuman/service-spoof/internal/websocket"
+)
+
+// middlewareLog logs the requests the services answer, and fingerprintLog
+// the fingerprints taken of their connections
+var (
+	middlewareLog  = logging.Logger("middleware")
+	fingerprintLog = logging.Logger("fingerprint")
 )
 
 // responseWriter wraps http.ResponseWriter to capture status code and template
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
-	template   string
+	statusCode  int
+	wroteHeader bool
+	template    string
 }
 
 func newResponseWriter(w http.ResponseWriter) *responseWriter {
@@ -27,51 +42,140 @@ func newResponseWriter(w http.ResponseWriter) *responseWriter {
 
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
+	rw.wroteHeader = true
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// Logger creates a logging middleware for a specific service
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack takes over the connection, logging the request with a status of 0
+// since no response is sent
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil {
+		rw.statusCode = 0
+	}
+	return conn, brw, err
+}
+
+// Logger creates a logging middleware for a specific service. A serverPort of
+// 0 logs the port each request's connection was accepted on.
 func Logger(requestLogger *database.RequestLogger, svc service.Service, serverPort int) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			port := serverPort
+			if port == 0 {
+				port = LocalPort(r)
+			}
+
+			// Requests the endpoint does not log are still counted, which
+			// happens outside this middleware, but not dumped or stored
+			logging := svc.Router().Logging(r)
+			if logging.Disabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// Dump the full HTTP request
 			dump, err := httputil.DumpRequest(r, true)
 			if err != nil {
-				log.Printf("Error dumping request: %v", err)
+				middlewareLog.Error("failed to dump request", "err", err)
 				http.Error(w, fmt.Sprint(err), http.StatusInternalServerError)
 				return
 			}
 
-			// Log to stdout (preserve existing behavior)
-			log.Println(*r.Context().Value(fingerprint.JA4).(*string))
-			log.Println(r.RemoteAddr, string(dump))
+			// Fingerprint the request itself, which plaintext ports can do
+			// without a ClientHello
+			ja4h := fingerprint.ComputeJA4H(r)
+			r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4H, &ja4h))
+
+			// Log the request itself, as well as storing it
+			logged := dump
+			if logging.NoBody {
+				logged, _, _ = bytes.Cut(dump, []byte("\r\n\r\n"))
+			}
+			middlewareLog.Info("request", "service", svc.Name(), "remote", r.RemoteAddr,
+				"ja4", *r.Context().Value(fingerprint.JA4).(*string), "request", string(logged))
+			r = r.WithContext(database.WithCapture(r.Context(), database.Capture{
+				NoBody: logging.NoBody,
+				NoRaw:  logging.NoRaw,
+			}))
+			r = r.WithContext(database.WithCredentials(r.Context()))
 
 			// Wrap the response writer to capture status code
 			wrappedWriter := newResponseWriter(w)
 
 			// Determine which endpoint will be matched to get the template
-			endpoint, matched := svc.Router().Match(r.Method, r.URL.Path)
+			// and response variant, whether it is a canary, and whether it
+			// captures WebSocket frames. Requests handed off are answered by
+			// the honeypot instead.
 			template := ""
-			if matched {
-				template = endpoint.Template
+			if _, handedOff := handoff.FromContext(r.Context()); !handedOff {
+				if endpoint, matched := svc.Router().MatchRequest(r); matched {
+					template = endpoint.Template
+					if endpoint.Variant != "" {
+						r = r.WithContext(database.WithVariant(r.Context(), endpoint.Variant))
+					}
+					if endpoint.Canary != nil {
+						r = r.WithContext(canary.NewContext(r.Context(), endpoint.Canary))
+					}
+					if endpoint.WebSocket != nil {
+						r = r.WithContext(websocket.NewContext(r.Context()))
+					}
+				}
 			}
 
+			// Log to database once the next handler returns. Requests it
+			// aborted are logged too, with a status of 0 if nothing was sent,
+			// before the abort goes on to net/http.
+			defer func() {
+				aborted := recover()
+				if aborted != nil && aborted != http.ErrAbortHandler {
+					panic(aborted)
+				}
+				if aborted != nil && !wrappedWriter.wroteHeader {
+					wrappedWriter.statusCode = 0
+				}
+				if websocket.FromContext(r.Context()).Upgraded() {
+					wrappedWriter.statusCode = http.StatusSwitchingProtocols
+				}
+
+				err := requestLogger.LogRequest(
+					r,
+					port,
+					svc.Name(),
+					svc.Type(),
+					wrappedWriter.statusCode,
+					template,
+					dump,
+				)
+				if err != nil {
+					middlewareLog.Error("failed to log request to database", "err", err)
+				}
+
+				if aborted != nil {
+					panic(aborted)
+				}
+			}()
+
 			// Call the next handler
 			next.ServeHTTP(wrappedWriter, r)
-
-			// Log to database
-			err = requestLogger.LogRequest(
-				r,
-				serverPort,
-				svc.Name(),
-				svc.Type(),
-				wrappedWriter.statusCode,
-				template,
-				dump,
-			)
-			if err != nil {
-				log.Printf("Error logging request to database: %v", err)
-			}
 		})
 	}
 }
+
+// LocalPort returns the local port of the connection a request arrived on
+func LocalPort(r *http.Request) int {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
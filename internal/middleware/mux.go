@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// sniffBufferSize is how many bytes are read to guess a connection's protocol
+const sniffBufferSize = 4096
+
+// MuxHandler handles a connection whose protocol was guessed from raw, the
+// bytes already read from it. The handler owns the connection and must close it.
+type MuxHandler func(conn net.Conn, raw []byte, protocol string)
+
+// ProtocolMux sniffs the first bytes of each connection accepted on a
+// listener and dispatches it to the listener or handler registered for the
+// guessed protocol, so one port can answer whatever protocol a client speaks
+type ProtocolMux struct {
+	root     net.Listener
+	timeout  time.Duration
+	routes   map[string]*childListener
+	catchAll *childListener
+	handlers map[string]MuxHandler
+	fallback MuxHandler
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewProtocolMux creates a multiplexer over a listener. Clients that send
+// nothing within timeout are dispatched as ProtocolUnknown, which lets
+// server-first protocols be answered with a banner.
+func NewProtocolMux(l net.Listener, timeout time.Duration) *ProtocolMux {
+	return &ProtocolMux{
+		root:     l,
+		timeout:  timeout,
+		routes:   make(map[string]*childListener),
+		handlers: make(map[string]MuxHandler),
+		done:     make(chan struct{}),
+	}
+}
+
+// Listen returns a listener that accepts connections guessed as any of the
+// given protocols. With no protocols, it accepts every connection that has
+// no other route.
+func (m *ProtocolMux) Listen(protocols ...string) net.Listener {
+	ml := newChildListener(m.root.Addr(), m.done)
+
+	if len(protocols) == 0 {
+		m.catchAll = ml
+	}
+	for _, p := range protocols {
+		m.routes[p] = ml
+	}
+	return ml
+}
+
+// Handle registers a handler for connections guessed as protocol
+func (m *ProtocolMux) Handle(protocol string, h MuxHandler) {
+	m.handlers[protocol] = h
+}
+
+// HandleDefault registers the handler for connections that have no other
+// route, including clients that sent nothing before the timeout
+func (m *ProtocolMux) HandleDefault(h MuxHandler) {
+	m.fallback = h
+}
+
+// Serve accepts connections until the underlying listener is closed
+func (m *ProtocolMux) Serve() error {
+	defer m.once.Do(func() { close(m.done) })
+
+	for {
+		conn, err := m.root.Accept()
+		if err != nil {
+			return err
+		}
+		go m.dispatch(conn)
+	}
+}
+
+// dispatch sniffs a connection and hands it to its route
+func (m *ProtocolMux) dispatch(conn net.Conn) {
+	buf := make([]byte, sniffBufferSize)
+
+	conn.SetReadDeadline(time.Now().Add(m.timeout))
+	n, err := conn.Read(buf)
+	conn.SetReadDeadline(time.Time{})
+
+	var netErr net.Error
+	if err != nil && n == 0 && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		conn.Close()
+		return
+	}
+
+	raw := buf[:n]
+	protocol := GuessProtocol(raw)
+	sc := &sniffedConn{Conn: conn, pending: raw}
+
+	if ml, ok := m.routes[protocol]; ok {
+		ml.deliver(sc)
+		return
+	}
+	if h, ok := m.handlers[protocol]; ok {
+		h(sc, raw, protocol)
+		return
+	}
+	if m.fallback != nil {
+		m.fallback(sc, raw, protocol)
+		return
+	}
+	if m.catchAll != nil {
+		m.catchAll.deliver(sc)
+		return
+	}
+	conn.Close()
+}
+
+// sniffedConn replays the bytes read while sniffing before reading further
+type sniffedConn struct {
+	net.Conn
+	pending []byte
+}
+
+// NetConn returns the wrapped connection
+func (c *sniffedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *sniffedConn) Read(p []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+// CloseWrite half-closes the underlying connection if it supports it
+func (c *sniffedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProtocolMux(t *testing.T) {
+	root, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer root.Close()
+
+	mux := NewProtocolMux(root, 200*time.Millisecond)
+	web := mux.Listen(ProtocolHTTP)
+
+	handled := make(chan string, 2)
+	mux.Handle(ProtocolSSH, func(conn net.Conn, raw []byte, protocol string) {
+		defer conn.Close()
+		handled <- protocol + ":" + string(raw)
+	})
+	mux.HandleDefault(func(conn net.Conn, raw []byte, protocol string) {
+		defer conn.Close()
+		conn.Write([]byte("220 ready\r\n"))
+		handled <- protocol
+	})
+	go mux.Serve()
+
+	// HTTP is replayed in full to the web listener
+	go func() {
+		conn, err := net.Dial("tcp", root.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		time.Sleep(100 * time.Millisecond)
+	}()
+
+	conn, err := web.Accept()
+	if err != nil {
+		t.Fatalf("Expected HTTP connection, got error: %v", err)
+	}
+	buf := make([]byte, 64)
+	n, _ := io.ReadAtLeast(conn, buf, len("GET / HTTP/1.1\r\n\r\n"))
+	if got := string(buf[:n]); got != "GET / HTTP/1.1\r\n\r\n" {
+		t.Fatalf("Expected replayed request, got %q", got)
+	}
+	conn.Close()
+
+	// SSH goes to its handler
+	ssh, err := net.Dial("tcp", root.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	ssh.Write([]byte("SSH-2.0-Go\r\n"))
+	if got := <-handled; got != "ssh:SSH-2.0-Go\r\n" {
+		t.Fatalf("Expected SSH handler, got %q", got)
+	}
+	ssh.Close()
+
+	// Silent clients get the default handler after the timeout
+	silent, err := net.Dial("tcp", root.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer silent.Close()
+	silent.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _ = silent.Read(buf)
+	if got := string(buf[:n]); got != "220 ready\r\n" {
+		t.Fatalf("Expected banner, got %q", got)
+	}
+	if got := <-handled; got != ProtocolUnknown {
+		t.Fatalf("Expected %s protocol, got %s", ProtocolUnknown, got)
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// soOriginalDst is SO_ORIGINAL_DST (and IP6T_SO_ORIGINAL_DST), set by
+// netfilter on connections it redirected
+const soOriginalDst = 80
+
+// OriginalDst returns the destination a connection was addressed to before a
+// netfilter REDIRECT or DNAT rule rewrote it
+func OriginalDst(conn net.Conn) (*net.TCPAddr, error) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil, fmt.Errorf("not a TCP connection: %T", conn)
+	}
+
+	raw, err := tcpConn.SyscallConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get raw connection: %w", err)
+	}
+
+	var addr *net.TCPAddr
+	var sockErr error
+	isIPv6 := tcpConn.LocalAddr().(*net.TCPAddr).IP.To4() == nil
+
+	err = raw.Control(func(fd uintptr) {
+		if isIPv6 {
+			// sockaddr_in6 fits in the struct returned for IPV6_MTU_INFO
+			var info syscall.IPv6MTUInfo
+			size := uint32(unsafe.Sizeof(info))
+			_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.IPPROTO_IPV6, soOriginalDst,
+				uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+			if errno != 0 {
+				sockErr = errno
+				return
+			}
+			port := binary.BigEndian.Uint16((*[2]byte)(unsafe.Pointer(&info.Addr.Port))[:])
+			addr = &net.TCPAddr{IP: net.IP(info.Addr.Addr[:]), Port: int(port)}
+			return
+		}
+
+		// sockaddr_in fits in the struct returned for IP_ADD_MEMBERSHIP
+		mreq, err := syscall.GetsockoptIPv6Mreq(int(fd), syscall.IPPROTO_IP, soOriginalDst)
+		if err != nil {
+			sockErr = err
+			return
+		}
+		port := binary.BigEndian.Uint16(mreq.Multiaddr[2:4])
+		addr = &net.TCPAddr{IP: net.IPv4(mreq.Multiaddr[4], mreq.Multiaddr[5], mreq.Multiaddr[6], mreq.Multiaddr[7]), Port: int(port)}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to access socket: %w", err)
+	}
+	if sockErr != nil {
+		return nil, fmt.Errorf("failed to get original destination: %w", sockErr)
+	}
+
+	return addr, nil
+}
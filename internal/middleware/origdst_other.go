@@ -0,0 +1,14 @@
+//go:build !linux
+
+package middleware
+
+import (
+	"errors"
+	"net"
+)
+
+// OriginalDst is only supported on Linux, where netfilter records the
+// destination of redirected connections
+func OriginalDst(conn net.Conn) (*net.TCPAddr, error) {
+	return nil, errors.New("original destination lookup is only supported on linux")
+}
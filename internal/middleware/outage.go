@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/outage"
+)
+
+// halfCloseHold is how long a half-closed connection waits for the client to
+// close its side before it is closed outright
+const halfCloseHold = 30 * time.Second
+
+// Outage creates middleware marking the requests its simulator fails in the
+// request context for OutagePolicy to answer. Marked requests are still
+// logged, tagged. A nil simulator disables it.
+func Outage(sim *outage.Simulator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if sim == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if sim.Fail(time.Now()) {
+				r = r.WithContext(outage.NewContext(r.Context(), sim))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OutagePolicy answers requests marked by Outage as their simulator's mode
+// says. badGateway and unavailable are answered with resp. reset and
+// halfClose, which have no response, take over the connection and drop it,
+// logged with a status of 0. HTTP/2 connections carry other requests and
+// cannot be taken over, so only the request's stream is reset.
+func OutagePolicy(resp *BadRequestResponse) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sim := outage.FromContext(r.Context())
+			if sim == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if resp != nil {
+				h := w.Header()
+				for k := range h {
+					delete(h, k)
+				}
+				for k, v := range resp.Headers {
+					h.Set(k, v)
+				}
+				h.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+				w.WriteHeader(resp.Status)
+				w.Write(resp.Body)
+				return
+			}
+
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				panic(http.ErrAbortHandler)
+			}
+			defer conn.Close()
+
+			if sim.Config().GetMode() == config.OutageModeReset {
+				// Without lingering, closing sends a reset rather than a FIN
+				if tc := tcpConn(conn); tc != nil {
+					tc.SetLinger(0)
+				}
+				return
+			}
+
+			// Send a FIN without a response, then wait for the client to
+			// give up and close its side
+			if tc := tcpConn(conn); tc != nil {
+				tc.CloseWrite()
+			}
+			conn.SetReadDeadline(time.Now().Add(halfCloseHold))
+			io.Copy(io.Discard, conn)
+		})
+	}
+}
+
+// tcpConn returns the TCP connection beneath the listeners' wrappers and
+// TLS, or nil if there is none
+func tcpConn(conn net.Conn) *net.TCPConn {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+}
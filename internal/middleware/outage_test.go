@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/outage"
+)
+
+func TestOutagePolicy(t *testing.T) {
+	handler := func(mode string, resp *BadRequestResponse) http.Handler {
+		sim := outage.New("web", &config.OutageConfig{Enabled: true, Mode: mode, Probability: 1})
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello"))
+		})
+		return Outage(sim)(OutagePolicy(resp)(next))
+	}
+
+	page := &BadRequestResponse{Status: http.StatusBadGateway, Headers: map[string]string{"Server": "nginx"}, Body: []byte("bad gateway")}
+	rec := httptest.NewRecorder()
+	handler(config.OutageModeBadGateway, page).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusBadGateway || rec.Header().Get("Server") != "nginx" || rec.Body.String() != "bad gateway" {
+		t.Fatalf("Expected the 502 page, got %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	// Requests outside outages are answered as usual
+	rec = httptest.NewRecorder()
+	Outage(nil)(OutagePolicy(page)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Fatalf("Expected the response, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	srv := httptest.NewServer(handler(config.OutageModeReset, nil))
+	defer srv.Close()
+	_, err := http.Get(srv.URL)
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("Expected the connection to be reset, got %v", err)
+	}
+
+	srv = httptest.NewServer(handler(config.OutageModeHalfClose, nil))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("Expected no response, got %d", resp.StatusCode)
+	}
+	if errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("Expected the connection to be closed rather than reset, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/davidthuman/service-spoof/internal/profile"
+	"github.com/davidthuman/service-spoof/internal/service"
+)
+
+// Profile creates middleware that answers what a service's endpoints leave
+// to the web server software it emulates: methods no endpoint takes on a
+// path, requests for no endpoint, and endpoints with an error status and no
+// template. A nil profile disables it.
+func Profile(svc service.Service, p *profile.Profile) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if p == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			endpoint, matched := svc.Router().MatchRequest(r)
+			if (!matched || endpoint.IsWildcard()) && p.HandleMethod(w, r) {
+				return
+			}
+			if !matched {
+				p.Error(w, r, http.StatusNotFound)
+				return
+			}
+			if endpoint.Template == "" && endpoint.Render == nil && endpoint.Status >= 400 {
+				for k, v := range endpoint.Headers {
+					w.Header().Set(k, v)
+				}
+				p.Error(w, r, endpoint.Status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
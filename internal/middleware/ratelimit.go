@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/ratelimit"
+)
+
+// RateLimit creates middleware counting each source's requests, marking
+// those past its rate in the request context for RateLimitPolicy to answer,
+// and reporting the source's remaining quota in the limiter's rate limit
+// headers. Marked requests are still logged, tagged. A nil limiter disables
+// it.
+func RateLimit(limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+			quota := limiter.Take(database.SourceIP(r.RemoteAddr), now)
+			limiter.SetHeaders(w.Header(), quota, now)
+			r = r.WithContext(ratelimit.NewContext(r.Context(), limiter, quota))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitPolicy answers requests marked by RateLimit with their limiter's
+// action. Throttled and tarpitted requests get the service's own response, so
+// it belongs after ServiceHeaders. Refused requests are answered with resp.
+func RateLimitPolicy(resp *BadRequestResponse) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter := ratelimit.FromContext(r.Context())
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cfg := limiter.Config()
+
+			switch cfg.GetAction() {
+			case config.RateLimitActionThrottle:
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(cfg.GetDelay()):
+				}
+				next.ServeHTTP(w, r)
+			case config.RateLimitActionTarpit:
+				tarpit(w, r, next, cfg.GetDrip())
+			default:
+				h := w.Header()
+				for k := range h {
+					delete(h, k)
+				}
+				for k, v := range resp.Headers {
+					h.Set(k, v)
+				}
+				if quota, ok := ratelimit.QuotaFromContext(r.Context()); ok {
+					limiter.SetHeaders(h, quota, time.Now())
+				}
+				h.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+				w.WriteHeader(resp.Status)
+				w.Write(resp.Body)
+			}
+		})
+	}
+}
+
+// bufferWriter holds back a response for tarpit to drip out
+type bufferWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (bw *bufferWriter) WriteHeader(code int) {
+	if bw.status == 0 {
+		bw.status = code
+	}
+}
+
+func (bw *bufferWriter) Write(p []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.body.Write(p)
+}
+
+// tarpit answers a request with the service's response dripped out a few
+// bytes at a time, its full length promised up front so the client waits for
+// all of it. Drips stop when the client goes away or after drip.Max, leaving
+// the response cut short.
+func tarpit(w http.ResponseWriter, r *http.Request, next http.Handler, drip config.DripConfig) {
+	bw := &bufferWriter{ResponseWriter: w}
+	next.ServeHTTP(bw, r)
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+
+	// The server's write timeout would cut the drip short
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(drip.Max + drip.Interval))
+
+	body := bw.body.Bytes()
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(bw.status)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	deadline := time.After(drip.Max)
+	ticker := time.NewTicker(drip.Interval)
+	defer ticker.Stop()
+	for len(body) > 0 {
+		n := min(drip.Bytes, len(body))
+		if _, err := w.Write(body[:n]); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		body = body[n:]
+		if len(body) == 0 {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+		}
+	}
+}
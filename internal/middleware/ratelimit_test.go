@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/ratelimit"
+)
+
+func TestRateLimitPolicy(t *testing.T) {
+	page := &BadRequestResponse{Status: http.StatusTooManyRequests, Headers: map[string]string{"Server": "nginx"}}
+	handler := func(cfg *config.RateLimitConfig) http.Handler {
+		cfg.Enabled, cfg.Requests = true, 1
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello"))
+		})
+		return RateLimit(ratelimit.New(cfg))(RateLimitPolicy(page)(next))
+	}
+	serve := func(h http.Handler) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	h := handler(&config.RateLimitConfig{})
+	if rec := serve(h); rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Fatalf("Expected the first request to be answered, got %d %q", rec.Code, rec.Body.String())
+	}
+	rec := serve(h)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Server") != "nginx" || rec.Body.Len() != 0 {
+		t.Fatalf("Expected a 429 with the service headers, got %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	h = handler(&config.RateLimitConfig{
+		Action: config.RateLimitActionTarpit,
+		Drip:   &config.DripConfig{Bytes: 2, Interval: 10 * time.Millisecond},
+	})
+	serve(h)
+	start := time.Now()
+	rec = serve(h)
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" || rec.Header().Get("Content-Length") != "5" {
+		t.Fatalf("Expected the tarpitted response in full, got %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("Expected the response to be dripped in three writes, took %s", elapsed)
+	}
+
+	h = handler(&config.RateLimitConfig{Headers: config.RateLimitHeadersX})
+	rec = serve(h)
+	if rec.Header().Get("X-RateLimit-Limit") != "1" || rec.Header().Get("X-RateLimit-Remaining") != "0" ||
+		rec.Header().Get("X-RateLimit-Reset") == "" || rec.Header().Get("Retry-After") != "" {
+		t.Fatalf("Expected the quota in X-RateLimit headers, got %v", rec.Header())
+	}
+	rec = serve(h)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("X-RateLimit-Remaining") != "0" ||
+		rec.Header().Get("Retry-After") != "60" || rec.Header().Get("Server") != "nginx" {
+		t.Fatalf("Expected a 429 with the quota and Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+
+	h = handler(&config.RateLimitConfig{Headers: config.RateLimitHeadersIETF})
+	if rec := serve(h); rec.Header().Get("RateLimit-Remaining") != "0" || rec.Header().Get("RateLimit-Reset") != "60" {
+		t.Fatalf("Expected the quota in RateLimit headers, got %v", rec.Header())
+	}
+}
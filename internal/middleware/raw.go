@@ -0,0 +1,551 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/profile"
+)
+
+// maxKeepAliveRequests is how many requests a connection answered in raw
+// mode takes before it is closed, the default of Apache's
+// MaxKeepAliveRequests
+const maxKeepAliveRequests = 100
+
+// maxRawDrain bounds how much of a request body left unread by the handler
+// is discarded to keep its connection open
+const maxRawDrain = 256 << 10
+
+// wireNames are the casings servers write headers in where they differ from
+// the canonical form net/http stores them in
+var wireNames = map[string]string{
+	"Content-Md5":            "Content-MD5",
+	"Dnt":                    "DNT",
+	"Etag":                   "ETag",
+	"P3p":                    "P3P",
+	"Te":                     "TE",
+	"Www-Authenticate":       "WWW-Authenticate",
+	"X-Aspnet-Version":       "X-AspNet-Version",
+	"X-Aspnetmvc-Version":    "X-AspNetMvc-Version",
+	"X-Dns-Prefetch-Control": "X-DNS-Prefetch-Control",
+	"X-Ua-Compatible":        "X-UA-Compatible",
+	"X-Xss-Protection":       "X-XSS-Protection",
+}
+
+// writeHead writes a status line and headers the way a server would, with
+// the headers in order and cased as listed. "*" in order stands for the
+// headers it does not list, written sorted and cased as servers write them;
+// without one they come last.
+func writeHead(w io.Writer, status int, reason string, h http.Header, order []string) {
+	fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", status, reason)
+
+	// Keys set directly on the map may not be canonical
+	keys := make(map[string][]string, len(h))
+	for k := range h {
+		name := http.CanonicalHeaderKey(k)
+		keys[name] = append(keys[name], k)
+	}
+	write := func(wire, name string) {
+		for _, k := range keys[name] {
+			for _, v := range h[k] {
+				fmt.Fprintf(w, "%s: %s\r\n", wire, v)
+			}
+		}
+	}
+
+	listed := make(map[string]bool, len(order))
+	for _, name := range order {
+		listed[http.CanonicalHeaderKey(name)] = true
+	}
+	rest := func() {
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			if !listed[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			wire, ok := wireNames[name]
+			if !ok {
+				wire = name
+			}
+			write(wire, name)
+		}
+	}
+
+	placed := false
+	for _, name := range order {
+		if name == "*" {
+			rest()
+			placed = true
+			continue
+		}
+		write(name, http.CanonicalHeaderKey(name))
+	}
+	if !placed {
+		rest()
+	}
+	io.WriteString(w, "\r\n")
+}
+
+// rawKey is the context key of a request's raw response writer
+type rawKey struct{}
+
+// RawResponses creates middleware that writes the HTTP/1.x responses of a
+// listener itself, taking each connection over from net/http after its
+// first request. net/http sorts and canonicalizes headers and adds its own,
+// which response fingerprinting tools tell apart from the servers emulated;
+// HeaderOrder sets how each service's responses are written. Requests on
+// the connection after the first are read and answered until it closes,
+// malformed ones with badRequest if set.
+func RawResponses(badRequest *BadRequestResponse) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// HTTP/2 frames its headers itself
+			if r.ProtoMajor != 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			srv, _ := r.Context().Value(http.ServerContextKey).(*http.Server)
+			c := &rawConn{
+				w:          w,
+				srv:        srv,
+				ctx:        r.Context(),
+				remoteAddr: r.RemoteAddr,
+				tls:        r.TLS,
+				badRequest: badRequest,
+			}
+			defer c.close()
+
+			for served := 1; r != nil; served++ {
+				rw := &rawWriter{c: c, req: r, served: served, header: make(http.Header)}
+				body := &rawBody{ReadCloser: r.Body}
+				if c.conn != nil && strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+					body.expect = c.sendContinue
+				}
+				req := r.WithContext(context.WithValue(c.ctx, rawKey{}, rw))
+				req.Body = body
+				rw.body = body
+
+				next.ServeHTTP(rw, req)
+				if !rw.finish() {
+					return
+				}
+				r = c.next(rw.idle)
+			}
+		})
+	}
+}
+
+// HeaderOrder creates middleware writing a service's responses with headers
+// in order, cased as listed, and with the status lines and connection
+// handling of the software its profile emulates. An empty order takes the
+// profile's. It only has an effect on listeners answering with
+// RawResponses, and none without an order or profile.
+func HeaderOrder(order []string, p *profile.Profile) func(http.Handler) http.Handler {
+	if len(order) == 0 && p != nil {
+		order = p.HeaderOrder()
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(order) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rw, ok := r.Context().Value(rawKey{}).(*rawWriter); ok {
+				rw.order = order
+				if p != nil {
+					rw.reason = p.Reason
+					rw.keepAlive = p.KeepAliveHeaders
+					rw.idle = p.KeepAliveTimeout()
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rawConn is a connection answered in raw mode. It is taken over from
+// net/http when its first response is written.
+type rawConn struct {
+	w          http.ResponseWriter
+	srv        *http.Server
+	ctx        context.Context
+	remoteAddr string
+	tls        *tls.ConnectionState
+	badRequest *BadRequestResponse
+
+	conn net.Conn
+	br   *bufio.Reader
+	bw   *bufio.Writer
+
+	// limit bounds the bytes read of the request head being read, and is
+	// negative while reading bodies
+	limit int64
+}
+
+// Read reads from the connection within the current limit
+func (c *rawConn) Read(p []byte) (int, error) {
+	if c.limit == 0 {
+		return 0, errors.New("request head too large")
+	}
+	if c.limit > 0 && int64(len(p)) > c.limit {
+		p = p[:c.limit]
+	}
+	n, err := c.conn.Read(p)
+	if c.limit > 0 {
+		c.limit -= int64(n)
+	}
+	return n, err
+}
+
+// hijack takes the connection over from net/http, keeping the bytes it has
+// already read of pipelined requests
+func (c *rawConn) hijack() error {
+	conn, brw, err := http.NewResponseController(c.w).Hijack()
+	if err != nil {
+		return err
+	}
+	buffered, _ := brw.Reader.Peek(brw.Reader.Buffered())
+	c.conn = conn
+	c.limit = -1
+	c.br = bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), c))
+	c.bw = bufio.NewWriter(conn)
+	return nil
+}
+
+// close closes the connection once taken over
+func (c *rawConn) close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// sendContinue tells a client waiting to send a request body to go ahead
+func (c *rawConn) sendContinue() {
+	io.WriteString(c.conn, "HTTP/1.1 100 Continue\r\n\r\n")
+}
+
+// next reads the next request on the connection, waiting up to idle for it
+// to start, or the server's idle timeout if idle is 0. It returns nil once
+// the connection is done, answering malformed requests with the 400
+// response first.
+func (c *rawConn) next(idle time.Duration) *http.Request {
+	if idle == 0 && c.srv != nil {
+		idle = c.srv.IdleTimeout
+	}
+	c.conn.SetReadDeadline(deadline(idle))
+	if _, err := c.br.Peek(1); err != nil {
+		return nil
+	}
+
+	var readHeader, read, write time.Duration
+	if c.srv != nil {
+		readHeader, read, write = c.srv.ReadHeaderTimeout, c.srv.ReadTimeout, c.srv.WriteTimeout
+	}
+	c.conn.SetReadDeadline(deadline(readHeader))
+	c.limit = http.DefaultMaxHeaderBytes
+	req, err := http.ReadRequest(c.br)
+	c.limit = -1
+	if err != nil {
+		var netErr net.Error
+		closed := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || (errors.As(err, &netErr) && netErr.Timeout())
+		if !closed && c.badRequest != nil {
+			c.badRequest.Write(c.conn)
+		}
+		return nil
+	}
+	c.conn.SetReadDeadline(deadline(read))
+	c.conn.SetWriteDeadline(deadline(write))
+
+	req.RemoteAddr = c.remoteAddr
+	req.TLS = c.tls
+	return req
+}
+
+// deadline returns the deadline d from now, or none if d is 0
+func deadline(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
+// rawBody is a request body answered in raw mode. It records whether the
+// handler read it, and sends the 100 Continue its client may be waiting for
+// on the first read. Closing it leaves the rest unread for drain.
+type rawBody struct {
+	io.ReadCloser
+	read   bool
+	closed bool
+	expect func()
+}
+
+func (b *rawBody) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, http.ErrBodyReadAfterClose
+	}
+	if !b.read {
+		b.read = true
+		if b.expect != nil {
+			b.expect()
+		}
+	}
+	return b.ReadCloser.Read(p)
+}
+
+func (b *rawBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// drain discards what the handler left unread of the body, reporting
+// whether the next request on the connection can be read after it
+func (b *rawBody) drain(r *http.Request) bool {
+	defer b.ReadCloser.Close()
+
+	// Clients waiting for a 100 Continue never sent the body
+	if !b.read && strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+		return false
+	}
+	_, err := io.CopyN(io.Discard, b.ReadCloser, maxRawDrain+1)
+	return err == io.EOF
+}
+
+// rawWriter buffers a response to write it in raw mode once the handler
+// returns, or streams it from the first flush on
+type rawWriter struct {
+	c      *rawConn
+	req    *http.Request
+	body   *rawBody
+	served int
+
+	header http.Header
+	status int
+	buf    bytes.Buffer
+
+	// How the service answering writes responses, set by HeaderOrder
+	order     []string
+	reason    func(status int) string
+	keepAlive func(remaining int) http.Header
+	idle      time.Duration
+
+	// streaming is set once the head is written, after which writes go to
+	// the connection. direct is set instead when the connection could not
+	// be taken over, and writes go to net/http.
+	streaming bool
+	direct    bool
+	chunked   bool
+	noBody    bool
+	keep      bool
+	hijacked  bool
+}
+
+func (w *rawWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *rawWriter) WriteHeader(code int) {
+	// Informational responses are left to net/http
+	if w.status != 0 || code < 200 {
+		return
+	}
+	w.status = code
+}
+
+func (w *rawWriter) Write(b []byte) (int, error) {
+	if w.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case w.direct:
+		return w.c.w.Write(b)
+	case !w.streaming:
+		return w.buf.Write(b)
+	case w.noBody || len(b) == 0:
+		return len(b), nil
+	case w.chunked:
+		fmt.Fprintf(w.c.bw, "%x\r\n", len(b))
+		n, err := w.c.bw.Write(b)
+		if err != nil {
+			return n, err
+		}
+		_, err = w.c.bw.WriteString("\r\n")
+		return n, err
+	default:
+		return w.c.bw.Write(b)
+	}
+}
+
+// FlushError writes the head and what has been written of the body,
+// streaming the rest of the response
+func (w *rawWriter) FlushError() error {
+	if w.hijacked {
+		return http.ErrHijacked
+	}
+	if !w.streaming && !w.direct {
+		w.commit(true)
+	}
+	if w.direct {
+		return http.NewResponseController(w.c.w).Flush()
+	}
+	return w.c.bw.Flush()
+}
+
+func (w *rawWriter) Flush() {
+	w.FlushError()
+}
+
+// Hijack hands the connection to the handler, which then owns it
+func (w *rawWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.direct {
+		return http.NewResponseController(w.c.w).Hijack()
+	}
+	if w.c.conn == nil {
+		if err := w.c.hijack(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := w.c.bw.Flush(); err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	return w.c.conn, bufio.NewReadWriter(w.c.br, w.c.bw), nil
+}
+
+func (w *rawWriter) SetReadDeadline(t time.Time) error {
+	if w.c.conn == nil {
+		return http.NewResponseController(w.c.w).SetReadDeadline(t)
+	}
+	return w.c.conn.SetReadDeadline(t)
+}
+
+func (w *rawWriter) SetWriteDeadline(t time.Time) error {
+	if w.c.conn == nil {
+		return http.NewResponseController(w.c.w).SetWriteDeadline(t)
+	}
+	return w.c.conn.SetWriteDeadline(t)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *rawWriter) Unwrap() http.ResponseWriter {
+	return w.c.w
+}
+
+// commit writes the head of the response, and the body written so far.
+// Headers net/http adds itself are added as it would: Date, and
+// Content-Length and a sniffed Content-Type unless streaming.
+func (w *rawWriter) commit(streaming bool) {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	h := w.header.Clone()
+	body := w.buf.Bytes()
+	head := w.req.Method == http.MethodHead
+	allowed := status != http.StatusNoContent && status != http.StatusNotModified
+
+	if _, ok := h["Date"]; !ok {
+		h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	if _, ok := h["Content-Type"]; !ok && allowed && len(body) > 0 {
+		h.Set("Content-Type", http.DetectContentType(body))
+	}
+	closing := false
+	if allowed && h.Get("Content-Length") == "" && h.Get("Transfer-Encoding") == "" {
+		switch {
+		case !streaming:
+			if !head || len(body) > 0 {
+				h.Set("Content-Length", strconv.Itoa(len(body)))
+			}
+		case head:
+		case w.req.ProtoAtLeast(1, 1):
+			h.Set("Transfer-Encoding", "chunked")
+			w.chunked = true
+		default:
+			// HTTP/1.0 clients read a body of unknown length to the close
+			closing = true
+		}
+	}
+
+	keep := !w.req.Close && !closing && w.served < maxKeepAliveRequests &&
+		!strings.EqualFold(h.Get("Connection"), "close")
+	keep = keep && w.body.drain(w.req)
+
+	if w.c.conn == nil {
+		if err := w.c.hijack(); err != nil {
+			// Without the connection net/http writes the response as usual
+			w.direct = true
+			for k, v := range w.header {
+				w.c.w.Header()[k] = v
+			}
+			w.c.w.WriteHeader(status)
+			w.c.w.Write(body)
+			return
+		}
+	}
+
+	remaining := 0
+	if keep {
+		remaining = maxKeepAliveRequests - w.served + 1
+	}
+	switch {
+	case w.keepAlive != nil:
+		for k, v := range w.keepAlive(remaining) {
+			h[k] = v
+		}
+	case !keep:
+		h.Set("Connection", "close")
+	case !w.req.ProtoAtLeast(1, 1):
+		h.Set("Connection", "keep-alive")
+	}
+
+	reason := http.StatusText(status)
+	if w.reason != nil {
+		reason = w.reason(status)
+	}
+	writeHead(w.c.bw, status, reason, h, w.order)
+
+	w.keep = keep
+	w.noBody = head || !allowed
+	w.streaming = true
+	w.Write(body)
+}
+
+// finish completes the response once the handler returns, reporting
+// whether the connection takes another request
+func (w *rawWriter) finish() bool {
+	if w.hijacked {
+		return false
+	}
+	if !w.streaming && !w.direct {
+		w.commit(false)
+	}
+	if w.direct {
+		return false
+	}
+	if w.chunked {
+		w.c.bw.WriteString("0\r\n\r\n")
+	}
+	if err := w.c.bw.Flush(); err != nil {
+		return false
+	}
+	return w.keep
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHead(t *testing.T) {
+	h := make(http.Header)
+	h.Set("Date", "Mon, 01 Jan 2024 00:00:00 GMT")
+	h.Set("Server", "Apache")
+	h.Set("Etag", `"abc"`)
+	h.Set("X-Frame-Options", "SAMEORIGIN")
+	h.Set("Content-Length", "5")
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+
+	var buf bytes.Buffer
+	writeHead(&buf, http.StatusOK, "OK", h, []string{"Date", "Server", "*", "ETag", "Content-Length"})
+	want := "HTTP/1.1 200 OK\r\n" +
+		"Date: Mon, 01 Jan 2024 00:00:00 GMT\r\n" +
+		"Server: Apache\r\n" +
+		"Set-Cookie: a=1\r\n" +
+		"Set-Cookie: b=2\r\n" +
+		"X-Frame-Options: SAMEORIGIN\r\n" +
+		"ETag: \"abc\"\r\n" +
+		"Content-Length: 5\r\n\r\n"
+	if buf.String() != want {
+		t.Fatalf("Expected head:\n%q\ngot:\n%q", want, buf.String())
+	}
+}
+
+func TestRawResponses_KeepAlive(t *testing.T) {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx")
+		w.Header().Set("Etag", `"x"`)
+		io.WriteString(w, "hello "+r.URL.Path)
+	})
+	handler = HeaderOrder([]string{"Server", "Date", "Content-Type", "Content-Length", "Connection", "ETag"}, nil)(handler)
+	srv := httptest.NewServer(RawResponses(nil)(handler))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// The second request is pipelined behind the first and asks to close
+	io.WriteString(conn, "GET /a HTTP/1.1\r\nHost: x\r\n\r\nGET /b HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+	raw, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Failed to read responses: %v", err)
+	}
+
+	br := bufio.NewReader(bytes.NewReader(raw))
+	for _, path := range []string{"/a", "/b"} {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("Failed to read response to %s: %v\n%s", path, err, raw)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "hello "+path {
+			t.Fatalf("Expected body of %s, got %q", path, body)
+		}
+	}
+
+	head := string(raw[:strings.Index(string(raw), "\r\n\r\n")])
+	lines := strings.Split(head, "\r\n")
+	names := make([]string, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		names = append(names, line[:strings.Index(line, ":")])
+	}
+	if got := strings.Join(names, ","); got != "Server,Date,Content-Type,Content-Length,ETag" {
+		t.Fatalf("Expected headers in order and cased as listed, got %s", got)
+	}
+	if !strings.Contains(string(raw), "Connection: close\r\n") {
+		t.Fatalf("Expected the last response to close the connection, got:\n%s", raw)
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/davidthuman/service-spoof/internal/service"
+)
+
+// recoverWriter records whether the response has started, after which a
+// panic can no longer be answered with an error page
+type recoverWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *recoverWriter) WriteHeader(code int) {
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recoverWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *recoverWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Recover creates middleware that answers handler panics with the service's
+// 500 page instead of the dropped connection net/http would leave, which
+// fingerprints the honeypot. The stack trace is logged and the request is
+// still logged with the error status by the outer middleware. A nil
+// response answers with an empty 500 and the service headers.
+func Recover(svc service.Service, resp *BadRequestResponse) func(http.Handler) http.Handler {
+	if resp == nil {
+		resp = &BadRequestResponse{Status: http.StatusInternalServerError, Headers: svc.Headers()}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &recoverWriter{ResponseWriter: w}
+
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				middlewareLog.Error("panic serving request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr,
+					"service", svc.Name(), "err", err, "stack", string(debug.Stack()))
+
+				// Once the response has started the client sees it cut short
+				if rw.wroteHeader {
+					return
+				}
+
+				h := w.Header()
+				for k := range h {
+					delete(h, k)
+				}
+				for k, v := range resp.Headers {
+					h.Set(k, v)
+				}
+				h.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+				w.WriteHeader(resp.Status)
+				w.Write(resp.Body)
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/service"
+)
+
+func TestRecover(t *testing.T) {
+	svc, err := service.NewService(&config.ServiceConfig{
+		Name:    "apache2",
+		Type:    "apache2",
+		Headers: map[string]string{"Server": "Apache/2.4.63 (Unix)"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	page := &BadRequestResponse{
+		Status:  http.StatusInternalServerError,
+		Headers: map[string]string{"Server": "Apache/2.4.63 (Unix)"},
+		Body:    []byte("<h1>Internal Server Error</h1>"),
+	}
+
+	handler := Recover(svc, page)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Endpoint", "set before the panic")
+		if r.URL.Path == "/started" {
+			w.WriteHeader(http.StatusOK)
+		}
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError || rec.Body.String() != string(page.Body) {
+		t.Fatalf("Expected the 500 page, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Endpoint") != "" || rec.Header().Get("Server") != "Apache/2.4.63 (Unix)" {
+		t.Fatalf("Expected only the 500 page headers, got %v", rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/started", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("Expected a started response to be left alone, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Fatalf("Expected ErrAbortHandler to propagate, got %v", err)
+		}
+	}()
+	Recover(svc, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"net"
+	"strconv"
+	"sync"
+)
+
+// RedirectListener accepts connections that a firewall REDIRECT rule sent to
+// a single port and dispatches each one to the listener for the port it was
+// originally addressed to
+type RedirectListener struct {
+	root  net.Listener
+	mu    sync.RWMutex
+	addrs map[string]*childListener
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewRedirectListener creates a dispatcher over the listener redirected
+// traffic arrives on
+func NewRedirectListener(l net.Listener) *RedirectListener {
+	return &RedirectListener{
+		root:  l,
+		addrs: make(map[string]*childListener),
+		done:  make(chan struct{}),
+	}
+}
+
+// Listen returns a listener that accepts connections originally addressed to
+// ip and port. An unspecified ip (0.0.0.0 or ::) accepts the port on any
+// address of its family not listened on explicitly, and an empty ip accepts
+// it on any address at all.
+func (rl *RedirectListener) Listen(ip string, port int) net.Listener {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	cl := newChildListener(&net.TCPAddr{IP: net.ParseIP(ip), Port: port}, rl.done)
+	rl.addrs[net.JoinHostPort(ip, strconv.Itoa(port))] = cl
+	return cl
+}
+
+// Serve accepts connections until the underlying listener is closed
+func (rl *RedirectListener) Serve() error {
+	defer rl.once.Do(func() { close(rl.done) })
+
+	for {
+		conn, err := rl.root.Accept()
+		if err != nil {
+			return err
+		}
+		go rl.dispatch(conn)
+	}
+}
+
+// dispatch recovers a connection's original destination and hands it to the
+// listener for that address, or failing that for that port on its family or
+// on any address
+func (rl *RedirectListener) dispatch(conn net.Conn) {
+	dst, err := OriginalDst(conn)
+	if err != nil {
+		middlewareLog.Warn("dropping redirected connection", "remote", conn.RemoteAddr().String(), "err", err)
+		conn.Close()
+		return
+	}
+
+	rl.mu.RLock()
+	unspecified := "::"
+	if dst.IP.To4() != nil {
+		unspecified = "0.0.0.0"
+	}
+	var cl *childListener
+	var ok bool
+	for _, host := range []string{dst.IP.String(), unspecified, ""} {
+		if cl, ok = rl.addrs[net.JoinHostPort(host, strconv.Itoa(dst.Port))]; ok {
+			break
+		}
+	}
+	rl.mu.RUnlock()
+	if !ok {
+		middlewareLog.Warn("dropping redirected connection to unconfigured address", "remote", conn.RemoteAddr().String(), "dst", dst.String())
+		conn.Close()
+		return
+	}
+
+	cl.deliver(&redirectedConn{Conn: conn, original: dst})
+}
+
+// redirectedConn reports the original destination as its local address, so
+// the HTTP server and request logging see the port the client connected to
+type redirectedConn struct {
+	net.Conn
+	original *net.TCPAddr
+}
+
+// NetConn returns the wrapped connection
+func (c *redirectedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *redirectedConn) LocalAddr() net.Addr {
+	return c.original
+}
+
+// CloseWrite half-closes the underlying connection if it supports it
+func (c *redirectedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/davidthuman/service-spoof/internal/scanner"
+)
+
+// DetectScanners tags requests from known research scanners by storing the
+// matching scanner in the request context. A nil set passes requests through
+// unchanged.
+func DetectScanners(set *scanner.Set) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if set == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s := set.Match(r); s != nil {
+				r = r.WithContext(scanner.NewContext(r.Context(), s))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ScannerPolicy applies the policy of the scanner tagged by DetectScanners.
+// Minimal answers keep the headers already set on the response, so it belongs
+// after ServiceHeaders.
+func ScannerPolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := scanner.FromContext(r.Context())
+		if s == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch s.Action {
+		case scanner.ActionMinimal:
+			w.Header().Del("Content-Type")
+			w.Header().Set("Content-Length", "0")
+			w.WriteHeader(s.Status)
+		case scanner.ActionDrop:
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				// Connections that cannot be taken over get a minimal answer
+				w.WriteHeader(s.Status)
+				return
+			}
+			conn.Close()
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"bytes"
+)
+
+// Protocol guesses returned by GuessProtocol
+const (
+	ProtocolHTTP    = "http"
+	ProtocolHTTP2   = "http2"
+	ProtocolTLS     = "tls"
+	ProtocolSSLv2   = "sslv2"
+	ProtocolSSH     = "ssh"
+	ProtocolRDP     = "rdp"
+	ProtocolSMB     = "smb"
+	ProtocolSOCKS4  = "socks4"
+	ProtocolSOCKS5  = "socks5"
+	ProtocolRedis   = "redis"
+	ProtocolSIP     = "sip"
+	ProtocolText    = "text"
+	ProtocolBinary  = "binary"
+	ProtocolUnknown = "unknown"
+)
+
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("HEAD "), []byte("PUT "),
+	[]byte("DELETE "), []byte("OPTIONS "), []byte("TRACE "), []byte("CONNECT "),
+	[]byte("PATCH "), []byte("PROPFIND "), []byte("PROPPATCH "), []byte("MKCOL "),
+	[]byte("COPY "), []byte("MOVE "), []byte("LOCK "), []byte("UNLOCK "),
+	[]byte("SEARCH "),
+}
+
+// GuessProtocol guesses the protocol a client is speaking from the first
+// bytes it sent
+func GuessProtocol(b []byte) string {
+	if len(b) == 0 {
+		return ProtocolUnknown
+	}
+
+	switch {
+	case len(b) >= 3 && b[0] == 0x16 && b[1] == 0x03:
+		return ProtocolTLS
+	case len(b) >= 3 && b[0]&0x80 != 0 && b[2] == 0x01:
+		return ProtocolSSLv2
+	case bytes.HasPrefix(b, []byte("SSH-")):
+		return ProtocolSSH
+	case bytes.HasPrefix(b, []byte("PRI * HTTP/2.0")):
+		return ProtocolHTTP2
+	case bytes.Contains(firstLine(b), []byte(" sip:")) || bytes.Contains(firstLine(b), []byte("SIP/2.0")):
+		return ProtocolSIP
+	case len(b) >= 4 && b[0] == 0x03 && b[1] == 0x00:
+		return ProtocolRDP
+	case len(b) >= 8 && (bytes.Equal(b[4:8], []byte("\xffSMB")) || bytes.Equal(b[4:8], []byte("\xfeSMB"))):
+		return ProtocolSMB
+	case len(b) >= 3 && b[0] == 0x05 && int(b[1])+2 <= len(b) && b[1] > 0 && b[1] < 10:
+		return ProtocolSOCKS5
+	case len(b) >= 8 && b[0] == 0x04 && (b[1] == 0x01 || b[1] == 0x02):
+		return ProtocolSOCKS4
+	case b[0] == '*' && len(b) > 1 && b[1] >= '0' && b[1] <= '9':
+		return ProtocolRedis
+	}
+
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(b, m) {
+			return ProtocolHTTP
+		}
+	}
+
+	// Leading blank lines are tolerated by HTTP servers
+	if b[0] == '\r' || b[0] == '\n' {
+		return ProtocolHTTP
+	}
+
+	if isPrintable(b) {
+		return ProtocolText
+	}
+	return ProtocolBinary
+}
+
+func firstLine(b []byte) []byte {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i]
+	}
+	return b
+}
+
+func isPrintable(b []byte) bool {
+	for _, c := range b {
+		if (c < 0x20 || c > 0x7e) && c != '\r' && c != '\n' && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
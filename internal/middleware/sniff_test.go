@@ -0,0 +1,36 @@
+package middleware
+
+import "testing"
+
+func TestGuessProtocol(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, ProtocolUnknown},
+		{"http get", []byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"), ProtocolHTTP},
+		{"webdav", []byte("PROPFIND / HTTP/1.1\r\n"), ProtocolHTTP},
+		{"leading crlf", []byte("\r\nGET / HTTP/1.1\r\n"), ProtocolHTTP},
+		{"http2 preface", []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"), ProtocolHTTP2},
+		{"tls client hello", []byte{0x16, 0x03, 0x01, 0x02, 0x00, 0x01}, ProtocolTLS},
+		{"sslv2 client hello", []byte{0x80, 0x2e, 0x01, 0x00, 0x02}, ProtocolSSLv2},
+		{"ssh banner", []byte("SSH-2.0-OpenSSH_8.9p1\r\n"), ProtocolSSH},
+		{"rdp", []byte{0x03, 0x00, 0x00, 0x13, 0x0e, 0xe0}, ProtocolRDP},
+		{"smb2", []byte{0x00, 0x00, 0x00, 0x45, 0xfe, 'S', 'M', 'B', 0x40}, ProtocolSMB},
+		{"socks5", []byte{0x05, 0x01, 0x00}, ProtocolSOCKS5},
+		{"socks4", []byte{0x04, 0x01, 0x00, 0x50, 0x7f, 0x00, 0x00, 0x01, 0x00}, ProtocolSOCKS4},
+		{"redis", []byte("*1\r\n$4\r\nPING\r\n"), ProtocolRedis},
+		{"sip", []byte("OPTIONS sip:100@10.0.0.1 SIP/2.0\r\n"), ProtocolSIP},
+		{"text", []byte("HELP\r\n"), ProtocolText},
+		{"binary", []byte{0x00, 0x01, 0x02, 0xff}, ProtocolBinary},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GuessProtocol(tt.data); got != tt.want {
+				t.Errorf("GuessProtocol(%q) = %s, want %s", tt.data, got, tt.want)
+			}
+		})
+	}
+}
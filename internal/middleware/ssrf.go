@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/davidthuman/service-spoof/internal/ssrf"
+)
+
+// SSRF creates middleware that answers the cloud metadata and redirector
+// paths SSRF payloads target before the service sees them. A nil catcher
+// disables it.
+func SSRF(catcher *ssrf.Catcher) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if catcher == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if catcher.Handle(w, r) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// acceptRateWindow is the number of seconds accept rates are averaged over
+const acceptRateWindow = 60
+
+// ConnStats counts connection activity on a listener
+type ConnStats struct {
+	active            atomic.Int64
+	accepted          atomic.Uint64
+	rejected          atomic.Uint64
+	handshakeFailures atomic.Uint64
+	timeouts          atomic.Uint64
+
+	mu      sync.Mutex
+	buckets [acceptRateWindow]uint64
+	seconds [acceptRateWindow]int64
+}
+
+// ListenerStats is a point-in-time snapshot of a listener's ConnStats
+type ListenerStats struct {
+	ActiveConns       int64   `json:"active_conns"`
+	MaxConns          int     `json:"max_conns"`
+	Accepted          uint64  `json:"accepted"`
+	AcceptsPerSecond  float64 `json:"accepts_per_second"`
+	Rejected          uint64  `json:"rejected"`
+	HandshakeFailures uint64  `json:"handshake_failures"`
+	Timeouts          uint64  `json:"timeouts"`
+}
+
+// Snapshot returns the current counters, with the accept rate averaged over
+// the last minute
+func (s *ConnStats) Snapshot() ListenerStats {
+	now := time.Now().Unix()
+
+	s.mu.Lock()
+	var recent uint64
+	for i, sec := range s.seconds {
+		if now-sec < acceptRateWindow {
+			recent += s.buckets[i]
+		}
+	}
+	s.mu.Unlock()
+
+	return ListenerStats{
+		ActiveConns:       s.active.Load(),
+		Accepted:          s.accepted.Load(),
+		AcceptsPerSecond:  float64(recent) / acceptRateWindow,
+		Rejected:          s.rejected.Load(),
+		HandshakeFailures: s.handshakeFailures.Load(),
+		Timeouts:          s.timeouts.Load(),
+	}
+}
+
+// recordAccept counts an accepted connection in the current second's bucket
+func (s *ConnStats) recordAccept() {
+	s.accepted.Add(1)
+
+	now := time.Now().Unix()
+	i := now % acceptRateWindow
+
+	s.mu.Lock()
+	if s.seconds[i] != now {
+		s.seconds[i] = now
+		s.buckets[i] = 0
+	}
+	s.buckets[i]++
+	s.mu.Unlock()
+}
+
+// HandshakeErrorWriter returns a writer for an http.Server's ErrorLog that
+// counts TLS handshake failures before passing each line on to w
+func (s *ConnStats) HandshakeErrorWriter(w io.Writer) io.Writer {
+	return &handshakeErrorWriter{stats: s, out: w}
+}
+
+type handshakeErrorWriter struct {
+	stats *ConnStats
+	out   io.Writer
+}
+
+func (hw *handshakeErrorWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("TLS handshake error")) {
+		hw.stats.handshakeFailures.Add(1)
+	}
+	return hw.out.Write(p)
+}
+
+// ConnLimit bounds the connections open across every listener sharing it
+type ConnLimit struct {
+	max    int64
+	active atomic.Int64
+}
+
+// NewConnLimit creates a limit of max open connections, or returns nil,
+// which allows any number, if max is not positive
+func NewConnLimit(max int) *ConnLimit {
+	if max <= 0 {
+		return nil
+	}
+	return &ConnLimit{max: int64(max)}
+}
+
+// acquire counts a new connection, reporting false without counting it if
+// the limit is reached
+func (l *ConnLimit) acquire() bool {
+	if l == nil {
+		return true
+	}
+	if l.active.Add(1) > l.max {
+		l.active.Add(-1)
+		return false
+	}
+	return true
+}
+
+// release stops counting a closed connection
+func (l *ConnLimit) release() {
+	if l != nil {
+		l.active.Add(-1)
+	}
+}
+
+// StatsListener counts connections on a listener and, if MaxConns is set,
+// closes new connections once that many are open. Connections past the
+// shared Limit, if set, are closed too.
+type StatsListener struct {
+	net.Listener
+	Stats    *ConnStats
+	MaxConns int
+	Limit    *ConnLimit
+}
+
+func (sl *StatsListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := sl.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		sl.Stats.recordAccept()
+
+		if sl.MaxConns > 0 && sl.Stats.active.Load() >= int64(sl.MaxConns) {
+			sl.Stats.rejected.Add(1)
+			conn.Close()
+			continue
+		}
+		if !sl.Limit.acquire() {
+			sl.Stats.rejected.Add(1)
+			conn.Close()
+			continue
+		}
+
+		sl.Stats.active.Add(1)
+		return &statsConn{Conn: conn, stats: sl.Stats, limit: sl.Limit}, nil
+	}
+}
+
+// statsConn tracks a connection's lifetime and I/O timeouts
+type statsConn struct {
+	net.Conn
+	stats *ConnStats
+	limit *ConnLimit
+	once  sync.Once
+}
+
+// NetConn returns the wrapped connection
+func (c *statsConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *statsConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.countTimeout(err)
+	return n, err
+}
+
+func (c *statsConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.countTimeout(err)
+	return n, err
+}
+
+func (c *statsConn) Close() error {
+	c.once.Do(func() {
+		c.stats.active.Add(-1)
+		c.limit.release()
+	})
+	return c.Conn.Close()
+}
+
+// CloseWrite half-closes the underlying connection if it supports it
+func (c *statsConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+func (c *statsConn) countTimeout(err error) {
+	var netErr net.Error
+	if err != nil && errors.As(err, &netErr) && netErr.Timeout() {
+		c.stats.timeouts.Add(1)
+	}
+}
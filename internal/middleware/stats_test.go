@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsListener_MaxConns(t *testing.T) {
+	root, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer root.Close()
+
+	stats := &ConnStats{}
+	sl := &StatsListener{Listener: root, Stats: stats, MaxConns: 1}
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := sl.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	first, err := net.Dial("tcp", root.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer first.Close()
+	conn := <-accepted
+
+	// The second connection exceeds the limit and is closed by the server
+	second, err := net.Dial("tcp", root.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("Expected second connection to be closed")
+	}
+
+	snapshot := stats.Snapshot()
+	if snapshot.ActiveConns != 1 || snapshot.Accepted != 2 || snapshot.Rejected != 1 {
+		t.Fatalf("Expected 1 active, 2 accepted, 1 rejected, got %+v", snapshot)
+	}
+
+	conn.Close()
+	conn.Close()
+	if got := stats.Snapshot().ActiveConns; got != 0 {
+		t.Fatalf("Expected 0 active connections after close, got %d", got)
+	}
+}
+
+func TestConnLimit(t *testing.T) {
+	if NewConnLimit(0) != nil {
+		t.Fatalf("Expected no limit for 0")
+	}
+	var unbounded *ConnLimit
+	if !unbounded.acquire() {
+		t.Fatalf("Expected a nil limit to allow connections")
+	}
+
+	limit := NewConnLimit(2)
+	if !limit.acquire() || !limit.acquire() {
+		t.Fatalf("Expected 2 connections to be allowed")
+	}
+	if limit.acquire() {
+		t.Fatalf("Expected a third connection to be refused")
+	}
+	limit.release()
+	if !limit.acquire() {
+		t.Fatalf("Expected a connection to be allowed after a release")
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/davidthuman/service-spoof/internal/status"
+)
+
+// countingWriter counts the bytes of a response body
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Unwrap returns the wrapped writer, so hijacking and flushing reach it
+func (cw *countingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// CountRequests counts requests and response bytes for server status pages,
+// storing the counters in the request context for status endpoints to show
+func CountRequests(counters *status.Counters) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if counters == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &countingWriter{ResponseWriter: w}
+			counters.Start()
+			defer func() { counters.Done(cw.n) }()
+
+			next.ServeHTTP(cw, r.WithContext(status.NewContext(r.Context(), counters)))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/watermark"
+)
+
+// watermarkWriter holds back a response so it can be marked once complete
+type watermarkWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (ww *watermarkWriter) WriteHeader(code int) {
+	if ww.status == 0 {
+		ww.status = code
+	}
+}
+
+func (ww *watermarkWriter) Write(b []byte) (int, error) {
+	if ww.status == 0 {
+		ww.status = http.StatusOK
+	}
+	return ww.body.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (ww *watermarkWriter) Unwrap() http.ResponseWriter {
+	return ww.ResponseWriter
+}
+
+// Watermark creates middleware that embeds the deployment's token into HTML
+// responses. Other and compressed responses are passed through unchanged.
+// A nil marker disables it.
+func Watermark(marker *watermark.Marker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if marker == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := &watermarkWriter{ResponseWriter: w}
+			next.ServeHTTP(ww, r)
+			if ww.status == 0 {
+				return
+			}
+
+			body := ww.body.Bytes()
+			h := w.Header()
+			if len(body) > 0 && h.Get("Content-Encoding") == "" && isHTML(h, body) {
+				body = marker.Mark(body)
+				if h.Get("Content-Length") != "" {
+					h.Set("Content-Length", strconv.Itoa(len(body)))
+				}
+			}
+
+			w.WriteHeader(ww.status)
+			w.Write(body)
+		})
+	}
+}
+
+// isHTML reports whether a response is HTML by its declared or sniffed
+// content type
+func isHTML(h http.Header, body []byte) bool {
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	return strings.HasPrefix(strings.ToLower(contentType), "text/html")
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/watermark"
+)
+
+func TestWatermark(t *testing.T) {
+	marker, err := watermark.NewMarker("honeypot-eu-1", []string{watermark.MethodComment})
+	if err != nil {
+		t.Fatalf("Failed to create marker: %v", err)
+	}
+
+	handler := Watermark(marker)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := "<html><body>It works!</body></html>"
+		if r.URL.Path == "/api" {
+			w.Header().Set("Content-Type", "application/json")
+			body = `{"ok":true}`
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(body))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	want := "<html><body>It works!<!-- " + marker.Token() + " -->\n</body></html>"
+	if rec.Code != http.StatusForbidden || rec.Body.String() != want {
+		t.Fatalf("Expected marked HTML %q, got %d %q", want, rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Length") != strconv.Itoa(len(want)) {
+		t.Fatalf("Expected Content-Length %d, got %s", len(want), rec.Header().Get("Content-Length"))
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+	if rec.Body.String() != `{"ok":true}` {
+		t.Fatalf("Expected JSON to be left alone, got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/davidthuman/service-spoof/internal/wellknown"
+)
+
+// WellKnown creates middleware that answers a service's /.well-known/ paths
+// before its endpoints. A nil responder disables it.
+func WellKnown(responder *wellknown.Responder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if responder == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if responder.Handle(w, r) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
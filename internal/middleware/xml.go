@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/davidthuman/service-spoof/internal/soap"
+)
+
+// replayBody reads back the inspected start of a body before the rest
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// InspectXML inspects XML request bodies for external entity and entity
+// expansion probes, storing what it finds in the request context so the
+// request is tagged when logged. The body is passed on unchanged.
+func InspectXML(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		head, err := io.ReadAll(io.LimitReader(r.Body, soap.MaxBody))
+		r.Body = replayBody{Reader: io.MultiReader(bytes.NewReader(head), r.Body), Closer: r.Body}
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if probe := soap.Inspect(head); probe != nil {
+			if tags := probe.Tags(); len(tags) > 0 {
+				middlewareLog.Info("XML probe", "tags", tags, "remote", r.RemoteAddr, "method", r.Method,
+					"path", r.URL.Path, "entities", probe.Entities, "external", probe.External)
+			}
+			r = r.WithContext(soap.NewContext(r.Context(), probe))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
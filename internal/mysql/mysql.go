@@ -0,0 +1,413 @@
+// Package mysql answers MySQL clients with a server's initial handshake,
+// reads the login they answer it with, and denies them access, capturing the
+// usernames, databases, and password scrambles of brute-force attempts.
+// Clients asking for the server's public key to send their password with
+// caching_sha2_password are given one, so their password is captured in the
+// clear. No query is ever answered.
+package mysql
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	mathrand "math/rand/v2"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/logging"
+)
+
+// serverLog logs problems setting up the server, as the other listeners do
+var serverLog = logging.Logger("server")
+
+const (
+	// readTimeout bounds how long a client may take to log in, MySQL's
+	// default connect_timeout
+	readTimeout = 10 * time.Second
+
+	// maxPacket bounds the packets read from clients
+	maxPacket = 64 << 10
+
+	// saltLen is the length of the auth plugin data in greetings
+	saltLen = 20
+
+	// maxTranscript bounds the transcript recorded for a session
+	maxTranscript = 16 << 10
+)
+
+// Authentication plugins
+const (
+	nativePassword = "mysql_native_password"
+	cachingSHA2    = "caching_sha2_password"
+	clearPassword  = "mysql_clear_password"
+)
+
+// Markers of caching_sha2_password's full authentication exchange
+const (
+	authMoreData     = 0x01
+	publicKeyRequest = 0x02
+	fullAuth         = 0x04
+)
+
+// release is how a MySQL release greets clients
+type release struct {
+	version      string
+	plugin       string
+	charset      byte
+	capabilities uint32
+}
+
+// releases are the releases a version line stands for. Neither advertises
+// TLS, as servers without certificates configured do not.
+var releases = map[string]release{
+	config.MySQLVersion57: {version: "5.7.44", plugin: nativePassword, charset: 8, capabilities: 0x81fff7ff},
+	config.MySQLVersion80: {version: "8.0.36", plugin: cachingSHA2, charset: 255, capabilities: 0xdffff7ff},
+}
+
+// Server answers MySQL connections
+type Server struct {
+	release release
+	salt    []byte
+	connID  atomic.Uint32
+
+	// key is sent to clients asking for it to encrypt their password with
+	key       *rsa.PrivateKey
+	publicKey []byte
+}
+
+// NewServer creates a server greeting clients as the configured version
+func NewServer(cfg *config.MySQLConfig) *Server {
+	version := cfg.GetVersion()
+	rel, ok := releases[version]
+	if !ok {
+		// Full version strings take the defaults of their line
+		rel = releases[config.MySQLVersion80]
+		if strings.HasPrefix(version, "5.") {
+			rel = releases[config.MySQLVersion57]
+		}
+		rel.version = version
+	}
+
+	s := &Server{release: rel}
+	if cfg != nil {
+		if cfg.Salt != "" {
+			s.salt = []byte(cfg.Salt)
+		}
+		if cfg.Capabilities != 0 {
+			s.release.capabilities = cfg.Capabilities
+		}
+	}
+	s.connID.Store(uint32(mathrand.IntN(1000)) + 1)
+
+	if s.release.plugin == cachingSHA2 {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			serverLog.Error("failed to generate MySQL public key, full authentication disabled", "err", err)
+			return s
+		}
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			serverLog.Error("failed to encode MySQL public key, full authentication disabled", "err", err)
+			return s
+		}
+		s.key = key
+		s.publicKey = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+	return s
+}
+
+// Version returns the server version sent in greetings
+func (s *Server) Version() string {
+	return s.release.version
+}
+
+// Session is what a client did before the connection was closed
+type Session struct {
+	Start    time.Time
+	Duration time.Duration
+
+	// LoggedIn is set once the client's login was read. Username,
+	// Database, and Plugin are from it, and Attributes are the connection
+	// attributes it sent, which name the client library and program.
+	LoggedIn   bool
+	Username   string
+	Database   string
+	Plugin     string
+	Attributes map[string]string
+
+	// Password is the password in the clear, if the client sent it so.
+	// Otherwise Hash is the scramble it sent, in the format hashcat cracks
+	// for mysql_native_password and hex for other plugins.
+	Password string
+	Hash     string
+
+	// Packets is the number of packets the client sent, and Transcript the
+	// exchange, client lines prefixed "C: " and server lines "S: "
+	Packets    int
+	Transcript string
+
+	// Err is why the session ended other than with access denied, if it did
+	Err error
+}
+
+// Handle greets a client, reads its login, and denies it access. The caller
+// closes the connection.
+func (s *Server) Handle(conn net.Conn) *Session {
+	sess := &Session{Start: time.Now()}
+	var transcript strings.Builder
+	defer func() {
+		sess.Duration = time.Since(sess.Start)
+		sess.Transcript = transcript.String()
+	}()
+	record := func(prefix, format string, args ...any) {
+		line := fmt.Sprintf(format, args...)
+		if transcript.Len()+len(line) < maxTranscript {
+			transcript.WriteString(prefix + line + "\n")
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(readTimeout))
+
+	salt := s.salt
+	if salt == nil {
+		salt = newSalt()
+	}
+	var seq byte
+	send := func(payload []byte) error {
+		err := writePacket(conn, seq, payload)
+		seq++
+		return err
+	}
+	read := func() ([]byte, error) {
+		n, payload, err := readPacket(conn)
+		if err != nil {
+			if len(payload) > 0 {
+				record("C: ", "%q", payload)
+			}
+			return nil, err
+		}
+		sess.Packets++
+		seq = n + 1
+		return payload, nil
+	}
+	deny := func() {
+		using := "NO"
+		if sess.Hash != "" || sess.Password != "" {
+			using = "YES"
+		}
+		message := fmt.Sprintf("Access denied for user '%s'@'%s' (using password: %s)", sess.Username, remoteHost(conn), using)
+		record("S: ", "ERR 1045 (28000) %s", message)
+		send(errPacket(1045, "28000", message))
+	}
+
+	record("S: ", "greeting %s, %s, salt %x", s.release.version, s.release.plugin, salt)
+	if sess.Err = send(s.greeting(s.connID.Add(1), salt)); sess.Err != nil {
+		return sess
+	}
+
+	payload, err := read()
+	if err != nil {
+		sess.Err = err
+		s.badHandshake(conn, seq, record)
+		return sess
+	}
+	l, err := parseLogin(payload)
+	if err != nil {
+		record("C: ", "%q", payload)
+		sess.Err = err
+		s.badHandshake(conn, seq, record)
+		return sess
+	}
+	if l.tls {
+		// TLS was not offered, so there is nothing to negotiate
+		record("C: ", "SSL request")
+		sess.Err = fmt.Errorf("client requested TLS")
+		return sess
+	}
+
+	sess.LoggedIn = true
+	sess.Username = l.username
+	sess.Database = l.database
+	sess.Plugin = l.plugin
+	sess.Attributes = l.attributes
+	record("C: ", "login user %q, database %q, plugin %q, capabilities %#08x%s", l.username, l.database, l.plugin, l.capabilities, attributes(l.attributes))
+
+	// Clients answering with another plugin are switched to the server's,
+	// as a server does for accounts it does not know
+	auth := l.auth
+	if l.plugin != "" && l.plugin != s.release.plugin && l.capabilities&clientPluginAuth != 0 {
+		record("S: ", "auth switch to %s", s.release.plugin)
+		switchRequest := append([]byte{0xfe}, s.release.plugin+"\x00"...)
+		switchRequest = append(append(switchRequest, salt...), 0)
+		if sess.Err = send(switchRequest); sess.Err != nil {
+			return sess
+		}
+		if auth, sess.Err = read(); sess.Err != nil {
+			return sess
+		}
+		sess.Plugin = s.release.plugin
+	}
+	if sess.Plugin == "" {
+		sess.Plugin = s.release.plugin
+	}
+	sess.Hash = hash(sess.Plugin, salt, auth)
+	if sess.Plugin == clearPassword {
+		sess.Password, sess.Hash = strings.TrimRight(string(auth), "\x00"), ""
+	}
+	if sess.Hash != "" {
+		record("C: ", "auth %s", sess.Hash)
+	}
+
+	// caching_sha2_password scrambles are checked against a cache the
+	// server starts without, so clients are asked for their password in
+	// full: in the clear over TLS, or encrypted with the server's key
+	if sess.Plugin == cachingSHA2 && len(auth) > 0 && s.key != nil {
+		record("S: ", "perform full authentication")
+		if sess.Err = send([]byte{authMoreData, fullAuth}); sess.Err != nil {
+			return sess
+		}
+		payload, err := read()
+		if err != nil {
+			sess.Err = err
+			return sess
+		}
+		switch {
+		case len(payload) == 1 && payload[0] == publicKeyRequest:
+			record("C: ", "public key request")
+			record("S: ", "public key")
+			if sess.Err = send(append([]byte{authMoreData}, s.publicKey...)); sess.Err != nil {
+				return sess
+			}
+			payload, err := read()
+			if err != nil {
+				sess.Err = err
+				return sess
+			}
+			if password, ok := s.decrypt(payload, salt); ok {
+				sess.Password = password
+				record("C: ", "encrypted password")
+			} else {
+				record("C: ", "%d bytes not decrypting to a password", len(payload))
+			}
+		case len(payload) > 0 && payload[len(payload)-1] == 0:
+			sess.Password = string(payload[:len(payload)-1])
+			record("C: ", "password in the clear")
+		default:
+			record("C: ", "%q", payload)
+		}
+	}
+
+	deny()
+	return sess
+}
+
+// greeting returns the initial handshake packet of a connection
+func (s *Server) greeting(id uint32, salt []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(10)
+	b.WriteString(s.release.version)
+	b.WriteByte(0)
+	binary.Write(&b, binary.LittleEndian, id)
+	b.Write(salt[:8])
+	b.WriteByte(0)
+	binary.Write(&b, binary.LittleEndian, uint16(s.release.capabilities))
+	b.WriteByte(s.release.charset)
+	binary.Write(&b, binary.LittleEndian, uint16(serverStatusAutocommit))
+	binary.Write(&b, binary.LittleEndian, uint16(s.release.capabilities>>16))
+	b.WriteByte(saltLen + 1)
+	b.Write(make([]byte, 10))
+	b.Write(salt[8:])
+	b.WriteByte(0)
+	b.WriteString(s.release.plugin)
+	b.WriteByte(0)
+	return b.Bytes()
+}
+
+// badHandshake answers a client whose login did not parse, as a server
+// answers non-MySQL clients
+func (s *Server) badHandshake(conn net.Conn, seq byte, record func(string, string, ...any)) {
+	record("S: ", "ERR 1043 (08S01) Bad handshake")
+	writePacket(conn, seq, errPacket(1043, "08S01", "Bad handshake"))
+}
+
+// decrypt recovers a password a client encrypted with the server's public
+// key, which is XORed with the salt before encryption
+func (s *Server) decrypt(ciphertext, salt []byte) (string, bool) {
+	plain, err := rsa.DecryptOAEP(sha1.New(), nil, s.key, ciphertext, nil)
+	if err != nil {
+		return "", false
+	}
+	for i := range plain {
+		plain[i] ^= salt[i%len(salt)]
+	}
+	if len(plain) == 0 || plain[len(plain)-1] != 0 {
+		return "", false
+	}
+	return string(plain[:len(plain)-1]), true
+}
+
+// newSalt returns random auth plugin data. Like MySQL's, it is printable
+// ASCII without NUL or '$'.
+func newSalt() []byte {
+	salt := make([]byte, saltLen)
+	rand.Read(salt)
+	for i, b := range salt {
+		b &= 0x7f
+		if b < 0x21 || b == '$' || b == 0x7f {
+			b = 'A' + b%26
+		}
+		salt[i] = b
+	}
+	return salt
+}
+
+// hash formats a client's scramble: mysql_native_password ones as hashcat
+// cracks them with the salt, others in hex. Empty scrambles, sent without a
+// password, are left out.
+func hash(plugin string, salt, auth []byte) string {
+	if len(auth) == 0 {
+		return ""
+	}
+	if plugin == nativePassword && len(auth) == sha1.Size {
+		return fmt.Sprintf("$mysqlna$%x*%x", salt, auth)
+	}
+	return plugin + ":" + hex.EncodeToString(auth)
+}
+
+// attributes formats connection attributes for the transcript
+func attributes(attrs map[string]string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(", attributes")
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%q", k, attrs[k])
+	}
+	return b.String()
+}
+
+// remoteHost returns the host a connection comes from, as MySQL names it
+// in access denied errors
+func remoteHost(conn net.Conn) string {
+	host := conn.RemoteAddr().String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
@@ -0,0 +1,127 @@
+package mysql
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// loginPacket builds a protocol 4.1 handshake response
+func loginPacket(user, db, plugin string, auth []byte, attrs map[string]string) []byte {
+	caps := uint32(clientProtocol41 | clientSecureConnection | clientPluginAuth | clientConnectWithDB | clientConnectAttrs)
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, caps)
+	binary.Write(&b, binary.LittleEndian, uint32(1<<24))
+	b.WriteByte(33)
+	b.Write(make([]byte, 23))
+	b.WriteString(user + "\x00")
+	b.WriteByte(byte(len(auth)))
+	b.Write(auth)
+	b.WriteString(db + "\x00")
+	b.WriteString(plugin + "\x00")
+	var a bytes.Buffer
+	for k, v := range attrs {
+		a.WriteByte(byte(len(k)))
+		a.WriteString(k)
+		a.WriteByte(byte(len(v)))
+		a.WriteString(v)
+	}
+	b.WriteByte(byte(a.Len()))
+	b.Write(a.Bytes())
+	return b.Bytes()
+}
+
+// startSession answers one connection, returning the client end and the
+// session once it ends
+func startSession(t *testing.T, cfg *config.MySQLConfig) (net.Conn, chan *Session, []byte) {
+	t.Helper()
+	server, client := net.Pipe()
+	srv := NewServer(cfg)
+	done := make(chan *Session, 1)
+	go func() {
+		sess := srv.Handle(server)
+		server.Close()
+		done <- sess
+	}()
+
+	seq, greeting, err := readPacket(client)
+	if err != nil || seq != 0 || greeting[0] != 10 {
+		t.Fatalf("Expected a protocol 10 greeting, got %v %q", err, greeting)
+	}
+	return client, done, greeting
+}
+
+func TestServer_Handle(t *testing.T) {
+	salt := "abcdefghijklmnopqrst"
+	client, done, greeting := startSession(t, &config.MySQLConfig{Version: config.MySQLVersion57, Salt: salt})
+	if !bytes.HasPrefix(greeting[1:], []byte("5.7.44\x00")) || !bytes.Contains(greeting, []byte("mysql_native_password\x00")) {
+		t.Fatalf("Expected a 5.7.44 greeting with mysql_native_password, got %q", greeting)
+	}
+
+	scramble := bytes.Repeat([]byte{0xaa}, 20)
+	writePacket(client, 1, loginPacket("root", "mysql", nativePassword, scramble, map[string]string{"_client_name": "libmysql"}))
+	seq, reply, err := readPacket(client)
+	if err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+	if seq != 2 || reply[0] != 0xff || binary.LittleEndian.Uint16(reply[1:]) != 1045 {
+		t.Fatalf("Expected ERR 1045, got %d %q", seq, reply)
+	}
+	if !strings.HasSuffix(string(reply), "Access denied for user 'root'@'pipe' (using password: YES)") {
+		t.Fatalf("Expected an access denied message, got %q", reply[9:])
+	}
+
+	sess := <-done
+	if !sess.LoggedIn || sess.Username != "root" || sess.Database != "mysql" || sess.Attributes["_client_name"] != "libmysql" {
+		t.Fatalf("Expected the login to be recorded, got %+v", sess)
+	}
+	if want := "$mysqlna$6162636465666768696a6b6c6d6e6f7071727374*" + strings.Repeat("aa", 20); sess.Hash != want {
+		t.Fatalf("Expected hash %s, got %s", want, sess.Hash)
+	}
+}
+
+func TestServer_Handle_PublicKey(t *testing.T) {
+	client, done, greeting := startSession(t, &config.MySQLConfig{Version: "8.0.35-0ubuntu0.22.04.1"})
+	salt := append(append([]byte{}, greeting[len("\x0a8.0.35-0ubuntu0.22.04.1\x00")+4:][:8]...), greeting[len(greeting)-len("caching_sha2_password\x00")-13:][:12]...)
+
+	writePacket(client, 1, loginPacket("admin", "", cachingSHA2, bytes.Repeat([]byte{1}, 32), nil))
+	if _, reply, _ := readPacket(client); !bytes.Equal(reply, []byte{authMoreData, fullAuth}) {
+		t.Fatalf("Expected a request for full authentication, got %q", reply)
+	}
+	writePacket(client, 3, []byte{publicKeyRequest})
+	_, reply, _ := readPacket(client)
+	block, _ := pem.Decode(reply[1:])
+	if block == nil {
+		t.Fatalf("Expected a PEM public key, got %q", reply)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse public key: %v", err)
+	}
+
+	password := []byte("hunter2\x00")
+	for i := range password {
+		password[i] ^= salt[i%len(salt)]
+	}
+	ciphertext, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, key.(*rsa.PublicKey), password, nil)
+	if err != nil {
+		t.Fatalf("Failed to encrypt password: %v", err)
+	}
+	writePacket(client, 5, ciphertext)
+	if _, reply, _ := readPacket(client); reply[0] != 0xff {
+		t.Fatalf("Expected access to be denied, got %q", reply)
+	}
+
+	if sess := <-done; sess.Password != "hunter2" {
+		t.Fatalf("Expected the encrypted password to be recovered, got %+v", sess)
+	}
+}
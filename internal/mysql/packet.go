@@ -0,0 +1,209 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Capability flags of the client/server protocol
+const (
+	clientConnectWithDB        = 1 << 3
+	clientProtocol41           = 1 << 9
+	clientSSL                  = 1 << 11
+	clientSecureConnection     = 1 << 15
+	clientPluginAuth           = 1 << 19
+	clientConnectAttrs         = 1 << 20
+	clientPluginAuthLenencData = 1 << 21
+)
+
+// serverStatusAutocommit is the status flag greetings carry by default
+const serverStatusAutocommit = 0x0002
+
+// errMalformed is returned for packets that do not parse
+var errMalformed = errors.New("malformed packet")
+
+// readPacket reads a packet, returning its sequence number and payload
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if n > maxPacket {
+		return header[3], header[:], fmt.Errorf("packet of %d bytes exceeds %d", n, maxPacket)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return header[3], nil, err
+	}
+	return header[3], payload, nil
+}
+
+// writePacket writes a payload as a packet with a sequence number
+func writePacket(w io.Writer, seq byte, payload []byte) error {
+	n := len(payload)
+	packet := append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, payload...)
+	_, err := w.Write(packet)
+	return err
+}
+
+// errPacket returns an ERR packet payload
+func errPacket(code uint16, state, message string) []byte {
+	var b bytes.Buffer
+	b.WriteByte(0xff)
+	binary.Write(&b, binary.LittleEndian, code)
+	b.WriteByte('#')
+	b.WriteString(state)
+	b.WriteString(message)
+	return b.Bytes()
+}
+
+// reader reads the fields of a packet payload
+type reader struct {
+	p   []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil || n > len(r.p) || n < 0 {
+		r.err = errMalformed
+		return nil
+	}
+	b := r.p[:n]
+	r.p = r.p[n:]
+	return b
+}
+
+func (r *reader) uint16() uint16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+// nul reads a string terminated by a NUL byte, or the rest of the payload
+func (r *reader) nul() string {
+	if r.err != nil {
+		return ""
+	}
+	i := bytes.IndexByte(r.p, 0)
+	if i < 0 {
+		s := string(r.p)
+		r.p = nil
+		return s
+	}
+	s := string(r.p[:i])
+	r.p = r.p[i+1:]
+	return s
+}
+
+// lenenc reads a length-encoded integer
+func (r *reader) lenenc() int {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	var n []byte
+	switch b[0] {
+	case 0xfc:
+		n = r.next(2)
+	case 0xfd:
+		n = r.next(3)
+	case 0xfe:
+		n = r.next(8)
+	default:
+		return int(b[0])
+	}
+	v := 0
+	for i := len(n) - 1; i >= 0; i-- {
+		v = v<<8 | int(n[i])
+	}
+	if v < 0 || v > maxPacket {
+		r.err = errMalformed
+		return 0
+	}
+	return v
+}
+
+// lenencBytes reads a length-encoded string
+func (r *reader) lenencBytes() []byte {
+	return r.next(r.lenenc())
+}
+
+// login is a client's handshake response
+type login struct {
+	capabilities uint32
+	username     string
+	auth         []byte
+	database     string
+	plugin       string
+	attributes   map[string]string
+
+	// tls is set for the SSL request clients send before a TLS handshake
+	tls bool
+}
+
+// parseLogin parses a handshake response, of protocol 4.1 or the older one
+// clients fall back to. Fields after the username may be left out.
+func parseLogin(p []byte) (*login, error) {
+	r := &reader{p: p}
+	l := &login{capabilities: uint32(r.uint16())}
+
+	if l.capabilities&clientProtocol41 == 0 {
+		r.next(3)
+		l.username = r.nul()
+		l.auth = bytes.TrimRight(r.p, "\x00")
+		if r.err != nil {
+			return nil, r.err
+		}
+		return l, nil
+	}
+
+	l.capabilities |= uint32(r.uint16()) << 16
+	r.next(4 + 1 + 23)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.p) == 0 && l.capabilities&clientSSL != 0 {
+		l.tls = true
+		return l, nil
+	}
+
+	l.username = r.nul()
+	switch {
+	case l.capabilities&clientPluginAuthLenencData != 0:
+		l.auth = r.lenencBytes()
+	case l.capabilities&clientSecureConnection != 0:
+		if b := r.next(1); b != nil {
+			l.auth = r.next(int(b[0]))
+		}
+	default:
+		l.auth = []byte(r.nul())
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if l.capabilities&clientConnectWithDB != 0 && len(r.p) > 0 {
+		l.database = r.nul()
+	}
+	if l.capabilities&clientPluginAuth != 0 && len(r.p) > 0 {
+		l.plugin = r.nul()
+	}
+	if l.capabilities&clientConnectAttrs != 0 && len(r.p) > 0 {
+		attrs := &reader{p: r.lenencBytes()}
+		l.attributes = make(map[string]string)
+		for attrs.err == nil && len(attrs.p) > 0 {
+			key := attrs.lenencBytes()
+			value := attrs.lenencBytes()
+			if attrs.err == nil {
+				l.attributes[string(key)] = string(value)
+			}
+		}
+	}
+	return l, nil
+}
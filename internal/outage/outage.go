@@ -0,0 +1,81 @@
+// Package outage decides which requests to a service fail as if its backend
+// were down, so the service is not implausibly always up. Outages are
+// scheduled once per period at a time picked from the service's name and the
+// period, so every instance of a deployment agrees on them and they do not
+// recur at the same time of day.
+package outage
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand/v2"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// TagOutage tags requests answered with a simulated outage
+const TagOutage = "outage"
+
+// Simulator decides which requests to a service fail
+type Simulator struct {
+	cfg  config.OutageConfig
+	name string
+}
+
+// New creates the simulator of a service, or nil if it has no outages
+func New(name string, cfg *config.OutageConfig) *Simulator {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	return &Simulator{cfg: *cfg, name: name}
+}
+
+// Config returns the outages the simulator simulates
+func (s *Simulator) Config() *config.OutageConfig {
+	return &s.cfg
+}
+
+// Window returns the scheduled outage of the period holding t, and whether
+// the service has scheduled outages at all
+func (s *Simulator) Window(t time.Time) (start, end time.Time, ok bool) {
+	if s == nil || s.cfg.Every <= 0 {
+		return time.Time{}, time.Time{}, false
+	}
+	every := s.cfg.Every
+	period := t.UnixNano() / int64(every)
+
+	h := fnv.New64a()
+	h.Write([]byte(s.name))
+	binary.Write(h, binary.BigEndian, period)
+	offset := time.Duration(h.Sum64() % uint64(every-s.cfg.Duration+1))
+
+	start = time.Unix(0, period*int64(every)).Add(offset)
+	return start, start.Add(s.cfg.Duration), true
+}
+
+// Fail reports whether a request at t fails: always during a scheduled
+// outage, and with the configured probability otherwise
+func (s *Simulator) Fail(t time.Time) bool {
+	if s == nil {
+		return false
+	}
+	if start, end, ok := s.Window(t); ok && !t.Before(start) && t.Before(end) {
+		return true
+	}
+	return s.cfg.Probability > 0 && rand.Float64() < s.cfg.Probability
+}
+
+type contextKey struct{}
+
+// NewContext returns a context marking its request as failed by s
+func NewContext(ctx context.Context, s *Simulator) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the simulator that failed the request, or nil
+func FromContext(ctx context.Context) *Simulator {
+	s, _ := ctx.Value(contextKey{}).(*Simulator)
+	return s
+}
@@ -0,0 +1,44 @@
+package outage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestWindow(t *testing.T) {
+	cfg := &config.OutageConfig{Enabled: true, Every: 24 * time.Hour, Duration: 10 * time.Minute}
+	sim := New("nginx", cfg)
+
+	now := time.Date(2025, time.March, 14, 12, 0, 0, 0, time.UTC)
+	start, end, ok := sim.Window(now)
+	if !ok {
+		t.Fatalf("Expected a scheduled outage")
+	}
+	day := now.Truncate(24 * time.Hour)
+	if start.Before(day) || end.After(day.Add(24*time.Hour)) || end.Sub(start) != 10*time.Minute {
+		t.Fatalf("Expected a 10 minute outage within the day, got %s to %s", start, end)
+	}
+	if !sim.Fail(start) || !sim.Fail(end.Add(-time.Nanosecond)) || sim.Fail(end) {
+		t.Fatalf("Expected requests to fail during the outage only")
+	}
+
+	// Every instance agrees on the outage, but not every day or service
+	if s, _, _ := New("nginx", cfg).Window(now); !s.Equal(start) {
+		t.Fatalf("Expected the same outage, got %s and %s", start, s)
+	}
+	next, _, _ := sim.Window(now.Add(24 * time.Hour))
+	other, _, _ := New("apache", cfg).Window(now)
+	if next.Sub(start) == 24*time.Hour && other.Equal(start) {
+		t.Fatalf("Expected outages to move between days and services")
+	}
+
+	if New("nginx", &config.OutageConfig{}) != nil {
+		t.Fatalf("Expected no simulator when disabled")
+	}
+	var none *Simulator
+	if none.Fail(now) {
+		t.Fatalf("Expected a nil simulator never to fail")
+	}
+}
@@ -0,0 +1,265 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+const (
+	// linkTypeRaw is the link type of packets that start at their IP header
+	linkTypeRaw = 101
+
+	snapLen = 262144
+
+	// mss is the most payload a segment carries, leaving room for the IP
+	// and TCP headers in a 1500 byte MTU
+	mss = 1440
+
+	// step is the time between packets of an exchange
+	step = 100 * time.Microsecond
+)
+
+// Default server addresses of exchanges, from the documentation ranges, since
+// requests are logged without the address they were sent to
+var (
+	DefaultServer4 = netip.MustParseAddr("192.0.2.1")
+	DefaultServer6 = netip.MustParseAddr("2001:db8::1")
+)
+
+// TCP flags
+const (
+	fin = 0x01
+	syn = 0x02
+	rst = 0x04
+	psh = 0x08
+	ack = 0x10
+)
+
+// Exchange is a request and its response over a TCP connection of its own
+type Exchange struct {
+	Time     time.Time
+	Client   netip.AddrPort
+	Server   netip.AddrPort
+	Request  []byte
+	Response []byte
+
+	// Reset connections are closed by the server with an RST instead of a
+	// response
+	Reset bool
+}
+
+// Writer writes exchanges as packets to a libpcap file
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter writes the file header to w and returns a writer of exchanges
+func NewWriter(w io.Writer) (*Writer, error) {
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], snapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], linkTypeRaw)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, fmt.Errorf("failed to write pcap header: %w", err)
+	}
+	return &Writer{w: w}, nil
+}
+
+// WriteExchange writes the packets of an exchange: the handshake, the request
+// and response in segments each acknowledged, and the close. The last
+// request segment is sent at the exchange's time.
+func (pw *Writer) WriteExchange(e Exchange) error {
+	// Initial sequence numbers are derived from the connection, so that
+	// exports of the same logs are the same
+	h := fnv.New32a()
+	fmt.Fprint(h, e.Client, e.Server, e.Time.UnixNano())
+	clientSeq := h.Sum32()
+	serverSeq := clientSeq ^ 0x5a5a5a5a
+
+	segments := (len(e.Request) + mss - 1) / mss
+	t := e.Time.Add(-time.Duration(segments+2) * step)
+	send := func(fromClient bool, flags byte, payload []byte) error {
+		src, dst, seq, ackNum := e.Client, e.Server, clientSeq, serverSeq
+		if !fromClient {
+			src, dst, seq, ackNum = e.Server, e.Client, serverSeq, clientSeq
+		}
+		if flags&ack == 0 {
+			ackNum = 0
+		}
+		err := pw.writePacket(t, packet(src, dst, seq, ackNum, flags, payload))
+		t = t.Add(step)
+
+		n := uint32(len(payload))
+		if flags&(syn|fin) != 0 {
+			n++
+		}
+		if fromClient {
+			clientSeq += n
+		} else {
+			serverSeq += n
+		}
+		return err
+	}
+
+	steps := []func() error{
+		func() error { return send(true, syn, nil) },
+		func() error { return send(false, syn|ack, nil) },
+		func() error { return send(true, ack, nil) },
+	}
+	for _, s := range split(e.Request) {
+		steps = append(steps, func() error { return send(true, psh|ack, s) })
+	}
+	if e.Reset {
+		steps = append(steps, func() error { return send(false, rst|ack, nil) })
+	} else {
+		steps = append(steps, func() error { return send(false, ack, nil) })
+		for _, s := range split(e.Response) {
+			steps = append(steps, func() error { return send(false, psh|ack, s) })
+		}
+		steps = append(steps,
+			func() error { return send(true, ack, nil) },
+			func() error { return send(false, fin|ack, nil) },
+			func() error { return send(true, fin|ack, nil) },
+			func() error { return send(false, ack, nil) },
+		)
+	}
+	for _, s := range steps {
+		if err := s(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteLog writes a logged request as an exchange with the server at the
+// logged port of server, or of the default address of the client's family if
+// server is not of it. Responses are not logged, so the response is their
+// status line alone, and requests answered with no response are reset.
+func (pw *Writer) WriteLog(l *database.RequestLog, server netip.Addr) error {
+	client, err := netip.ParseAddr(l.SourceIP)
+	if err != nil {
+		client = netip.IPv4Unspecified()
+	}
+	client = client.Unmap()
+	if !server.IsValid() || server.Is4() != client.Is4() {
+		server = DefaultServer4
+		if client.Is6() {
+			server = DefaultServer6
+		}
+	}
+
+	// Sources logged without a port are given an ephemeral one
+	port := l.SourcePort
+	if port == 0 {
+		port = 49152 + int(l.ID%16384)
+	}
+
+	e := Exchange{
+		Time:    l.Timestamp,
+		Client:  netip.AddrPortFrom(client, uint16(port)),
+		Server:  netip.AddrPortFrom(server, uint16(l.ServerPort)),
+		Request: []byte(l.RawRequest),
+		Reset:   l.ResponseStatus == 0,
+	}
+	if !e.Reset {
+		proto := l.Protocol
+		if !strings.HasPrefix(proto, "HTTP/1.") {
+			proto = "HTTP/1.1"
+		}
+		e.Response = fmt.Appendf(nil, "%s %d %s\r\nContent-Length: 0\r\n\r\n", proto, l.ResponseStatus, http.StatusText(l.ResponseStatus))
+	}
+	return pw.WriteExchange(e)
+}
+
+// writePacket writes a packet record
+func (pw *Writer) writePacket(t time.Time, data []byte) error {
+	rec := make([]byte, 16, 16+len(data))
+	binary.LittleEndian.PutUint32(rec[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(data)))
+	if _, err := pw.w.Write(append(rec, data...)); err != nil {
+		return fmt.Errorf("failed to write packet: %w", err)
+	}
+	return nil
+}
+
+// split cuts a payload into segments of at most mss bytes
+func split(payload []byte) [][]byte {
+	segments := make([][]byte, 0, (len(payload)+mss-1)/mss)
+	for len(payload) > 0 {
+		n := min(len(payload), mss)
+		segments = append(segments, payload[:n])
+		payload = payload[n:]
+	}
+	return segments
+}
+
+// packet returns an IP packet carrying a TCP segment, with valid checksums
+func packet(src, dst netip.AddrPort, seq, ackNum uint32, flags byte, payload []byte) []byte {
+	seg := make([]byte, 20+len(payload))
+	binary.BigEndian.PutUint16(seg[0:], src.Port())
+	binary.BigEndian.PutUint16(seg[2:], dst.Port())
+	binary.BigEndian.PutUint32(seg[4:], seq)
+	binary.BigEndian.PutUint32(seg[8:], ackNum)
+	seg[12] = 5 << 4
+	seg[13] = flags
+	binary.BigEndian.PutUint16(seg[14:], 65535)
+	copy(seg[20:], payload)
+
+	srcIP, dstIP := src.Addr().AsSlice(), dst.Addr().AsSlice()
+	var ip, pseudo []byte
+	if src.Addr().Is4() {
+		ip = make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(seg)))
+		binary.BigEndian.PutUint16(ip[6:], 0x4000)
+		ip[8] = 64
+		ip[9] = 6
+		copy(ip[12:], srcIP)
+		copy(ip[16:], dstIP)
+		binary.BigEndian.PutUint16(ip[10:], checksum(ip))
+
+		pseudo = append(append(append([]byte{}, srcIP...), dstIP...), 0, 6, 0, 0)
+		binary.BigEndian.PutUint16(pseudo[10:], uint16(len(seg)))
+	} else {
+		ip = make([]byte, 40)
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(seg)))
+		ip[6] = 6
+		ip[7] = 64
+		copy(ip[8:], srcIP)
+		copy(ip[24:], dstIP)
+
+		pseudo = append(append(append([]byte{}, srcIP...), dstIP...), 0, 0, 0, 0, 0, 0, 0, 6)
+		binary.BigEndian.PutUint32(pseudo[32:], uint32(len(seg)))
+	}
+	binary.BigEndian.PutUint16(seg[16:], checksum(append(pseudo, seg...)))
+
+	return append(ip, seg...)
+}
+
+// checksum returns the Internet checksum of b
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,104 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+// readPackets returns the packets of a libpcap file
+func readPackets(t *testing.T, b []byte) [][]byte {
+	if len(b) < 24 || binary.LittleEndian.Uint32(b) != 0xa1b2c3d4 || binary.LittleEndian.Uint32(b[20:]) != linkTypeRaw {
+		t.Fatalf("Expected a raw IP libpcap header, got %x", b[:min(len(b), 24)])
+	}
+	packets := make([][]byte, 0)
+	for b = b[24:]; len(b) > 0; {
+		n := binary.LittleEndian.Uint32(b[8:])
+		packets = append(packets, b[16:16+n])
+		b = b[16+n:]
+	}
+	return packets
+}
+
+func TestWriteExchange(t *testing.T) {
+	request := []byte("POST /upload HTTP/1.1\r\nHost: example.com\r\n\r\n" + strings.Repeat("A", 3000))
+	e := Exchange{
+		Time:     time.Unix(1700000000, 0),
+		Client:   netip.MustParseAddrPort("203.0.113.7:51000"),
+		Server:   netip.MustParseAddrPort("192.0.2.1:80"),
+		Request:  request,
+		Response: []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+	}
+	var buf bytes.Buffer
+	pw, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	if err := pw.WriteExchange(e); err != nil {
+		t.Fatalf("Failed to write exchange: %v", err)
+	}
+
+	// Handshake, three request segments, an ACK, the response, and the close
+	packets := readPackets(t, buf.Bytes())
+	if len(packets) != 12 {
+		t.Fatalf("Expected 12 packets, got %d", len(packets))
+	}
+	var sent []byte
+	for i, p := range packets {
+		if checksum(p[:20]) != 0 {
+			t.Fatalf("Expected a valid IP checksum on packet %d", i)
+		}
+		seg := p[20:]
+		pseudo := append(append([]byte{}, p[12:20]...), 0, 6, 0, 0)
+		binary.BigEndian.PutUint16(pseudo[10:], uint16(len(seg)))
+		if checksum(append(pseudo, seg...)) != 0 {
+			t.Fatalf("Expected a valid TCP checksum on packet %d", i)
+		}
+		if binary.BigEndian.Uint16(seg[0:]) == 51000 {
+			sent = append(sent, seg[20:]...)
+		}
+	}
+	if !bytes.Equal(sent, request) {
+		t.Fatalf("Expected the client to send the request, got %d bytes", len(sent))
+	}
+	if flags := packets[0][33]; flags != syn {
+		t.Fatalf("Expected the connection to open with a SYN, got flags %#x", flags)
+	}
+}
+
+func TestWriteLog(t *testing.T) {
+	var buf bytes.Buffer
+	pw, _ := NewWriter(&buf)
+	l := &database.RequestLog{
+		ID:         7,
+		Timestamp:  time.Unix(1700000000, 0),
+		SourceIP:   "2001:db8::7",
+		ServerPort: 443,
+		RawRequest: "GET / HTTP/1.1\r\n\r\n",
+	}
+	if err := pw.WriteLog(l, netip.MustParseAddr("198.51.100.1")); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+
+	// An IPv4 server does not fit an IPv6 client, and a request answered
+	// with nothing is reset after it is sent
+	packets := readPackets(t, buf.Bytes())
+	if len(packets) != 5 {
+		t.Fatalf("Expected 5 packets, got %d", len(packets))
+	}
+	last := packets[len(packets)-1]
+	if last[0]>>4 != 6 || netip.AddrFrom16([16]byte(last[8:24])) != DefaultServer6 {
+		t.Fatalf("Expected the reset to come from %s", DefaultServer6)
+	}
+	if flags := last[40+13]; flags != rst|ack {
+		t.Fatalf("Expected the connection to be reset, got flags %#x", flags)
+	}
+	if port := binary.BigEndian.Uint16(packets[0][40:]); port != 49152+7 {
+		t.Fatalf("Expected an ephemeral source port, got %d", port)
+	}
+}
@@ -0,0 +1,460 @@
+// Package profile emulates how the web server software a service claims to
+// run answers by default: its Server header, its error pages, and the
+// methods its static file handler allows. A service selects a release with
+// profileVersion, so its headers and pages agree without each being
+// configured by hand.
+package profile
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Software emulated by profiles
+const (
+	Apache = "apache"
+	Nginx  = "nginx"
+	IIS    = "iis"
+)
+
+// release is a release line of web server software, and the release a
+// profileVersion naming only the line stands for
+type release struct {
+	software string
+	line     string
+	latest   string
+}
+
+var releases = []release{
+	{software: Apache, line: "2.4", latest: "2.4.58"},
+	{software: Nginx, line: "1.18", latest: "1.18.0"},
+	{software: Nginx, line: "1.24", latest: "1.24.0"},
+	{software: IIS, line: "10.0", latest: "10.0"},
+}
+
+// typeSoftware lists the software each service type may run on. Types not
+// listed have no profiles.
+var typeSoftware = map[string][]string{
+	"apache2":   {Apache},
+	"nginx":     {Nginx},
+	"iis":       {IIS},
+	"wordpress": {Apache, Nginx},
+}
+
+// products are the names software gives itself in Server headers
+var products = map[string]string{
+	Apache: "Apache",
+	Nginx:  "nginx",
+	IIS:    "Microsoft-IIS",
+}
+
+// Profile is a release of web server software
+type Profile struct {
+	software string
+	line     string
+	version  string
+}
+
+// New returns the profile a service type's profileVersion selects, or nil if
+// it selects none
+func New(serviceType, version string) *Profile {
+	p, _ := Lookup(serviceType, version)
+	return p
+}
+
+// Lookup returns the profile a service type's profileVersion selects: a
+// release line such as 1.24, which stands for a recent release of it, or a
+// release of one such as 1.24.0. An empty version selects no profile.
+func Lookup(serviceType, version string) (*Profile, error) {
+	if version == "" {
+		return nil, nil
+	}
+	software, ok := typeSoftware[serviceType]
+	if !ok {
+		return nil, fmt.Errorf("service type %s has no profiles", serviceType)
+	}
+
+	lines := make([]string, 0)
+	for _, rel := range releases {
+		if !slices.Contains(software, rel.software) {
+			continue
+		}
+		lines = append(lines, rel.line)
+		if version == rel.line {
+			return &Profile{software: rel.software, line: rel.line, version: rel.latest}, nil
+		}
+		if patch, ok := strings.CutPrefix(version, rel.line+"."); ok {
+			if _, err := strconv.Atoi(patch); err == nil {
+				return &Profile{software: rel.software, line: rel.line, version: version}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%q is not a release of %s %s", version, serviceType, strings.Join(lines, " or "))
+}
+
+// Software returns the software emulated
+func (p *Profile) Software() string {
+	return p.software
+}
+
+// Version returns the release emulated
+func (p *Profile) Version() string {
+	return p.version
+}
+
+// Server returns the Server header the release sends by default
+func (p *Profile) Server() string {
+	if p.software == Apache {
+		return fmt.Sprintf("Apache/%s (Unix)", p.version)
+	}
+	return products[p.software] + "/" + p.version
+}
+
+// Headers returns the headers the release adds to every response by default
+func (p *Profile) Headers() map[string]string {
+	headers := map[string]string{"Server": p.Server()}
+	if p.software == IIS {
+		headers["X-Powered-By"] = "ASP.NET"
+	}
+	return headers
+}
+
+// Consistent reports whether a Server header names the profile's software,
+// and, if it shows a version, one of the profile's release line
+func (p *Profile) Consistent(server string) bool {
+	token, _, _ := strings.Cut(server, " ")
+	product, version, versioned := strings.Cut(token, "/")
+	if !strings.EqualFold(product, products[p.software]) {
+		return false
+	}
+	return !versioned || version == p.line || strings.HasPrefix(version, p.line+".")
+}
+
+// Page is a default error page and how it is sent
+type Page struct {
+	Body        []byte
+	ContentType string
+
+	// Server replaces the Server header of pages sent by the HTTP stack
+	// underneath the server rather than by the server itself
+	Server string
+}
+
+// Page returns the default page of a status for a request with method. Pages
+// naming the server quote server, the Server header they are sent with.
+func (p *Profile) Page(status int, method, server string) Page {
+	if server == "" {
+		server = p.Server()
+	}
+	switch p.software {
+	case Apache:
+		return apachePage(status, method)
+	case Nginx:
+		return nginxPage(status, server)
+	}
+	return iisPage(status)
+}
+
+// Error answers a request with the default page of a status
+func (p *Profile) Error(w http.ResponseWriter, r *http.Request, status int) {
+	page := p.Page(status, r.Method, w.Header().Get("Server"))
+	if page.Server != "" {
+		w.Header().Set("Server", page.Server)
+		w.Header().Del("X-Powered-By")
+	}
+	if status == http.StatusMethodNotAllowed && p.software == Apache {
+		w.Header().Set("Allow", apacheAllow)
+	}
+	w.Header().Set("Content-Type", page.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(page.Body)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(page.Body)
+	}
+}
+
+// Methods allowed by the static file handlers, in the order their Allow
+// headers list them. nginx sends no Allow header.
+const (
+	apacheAllow = "GET,POST,OPTIONS,HEAD,TRACE"
+	iisAllow    = "OPTIONS, TRACE, GET, HEAD, POST"
+)
+
+// HandleMethod answers requests for paths no endpoint takes the method of as
+// the software's static file handler answers them without looking for a
+// file: OPTIONS, TRACE, and methods it does not allow. It reports whether it
+// answered the request.
+func (p *Profile) HandleMethod(w http.ResponseWriter, r *http.Request) bool {
+	switch p.software {
+	case Apache:
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodPost:
+			return false
+		case http.MethodOptions:
+			options(w, apacheAllow)
+		case http.MethodTrace:
+			trace(w, r)
+		default:
+			p.Error(w, r, http.StatusMethodNotAllowed)
+		}
+		return true
+	case Nginx:
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodPost:
+			return false
+		}
+		p.Error(w, r, http.StatusMethodNotAllowed)
+		return true
+	case IIS:
+		if r.Method != http.MethodOptions {
+			return false
+		}
+		w.Header().Set("Public", iisAllow)
+		options(w, iisAllow)
+		return true
+	}
+	return false
+}
+
+// options answers an OPTIONS request with the methods allowed and no body
+func options(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	w.Header().Del("Content-Type")
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+// trace echoes a TRACE request back, as Apache does with TraceEnable on, its
+// default
+func trace(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s\r\n", r.Method, r.RequestURI, r.Proto)
+	if r.Host != "" {
+		fmt.Fprintf(&b, "Host: %s\r\n", r.Host)
+	}
+	r.Header.Write(&b)
+	b.WriteString("\r\n")
+
+	w.Header().Set("Content-Type", "message/http")
+	w.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(b.String()))
+}
+
+// apacheReasons are the reason phrases of Apache's status lines where they
+// differ from net/http's
+var apacheReasons = map[int]string{
+	http.StatusBadGateway: "Proxy Error",
+}
+
+// apacheMessages are the explanations of Apache's default error pages. %s is
+// the request method.
+var apacheMessages = map[int]string{
+	http.StatusBadRequest: "<p>Your browser sent a request that this server could not understand.<br />\n</p>\n",
+	http.StatusUnauthorized: "<p>This server could not verify that you\nare authorized to access the document\nrequested.  Either you supplied the wrong\n" +
+		"credentials (e.g., bad password), or your\nbrowser doesn't understand how to supply\nthe credentials required.</p>\n",
+	http.StatusForbidden:        "<p>You don't have permission to access this resource.</p>\n",
+	http.StatusNotFound:         "<p>The requested URL was not found on this server.</p>\n",
+	http.StatusMethodNotAllowed: "<p>The requested method %s is not allowed for this URL.</p>\n",
+	http.StatusInternalServerError: "<p>The server encountered an internal error or\nmisconfiguration and was unable to complete\nyour request.</p>\n" +
+		"<p>Please contact the server administrator at \n you@example.com to inform them of the time this error occurred,\n" +
+		" and the actions you performed just before this error.</p>\n<p>More information about this error may be available\nin the server error log.</p>\n",
+	http.StatusBadGateway: "<p>The proxy server received an invalid\nresponse from an upstream server.<br />\n" +
+		"The proxy server could not handle the request<p>Reason: <strong>Error reading from remote server</strong></p></p>\n",
+	http.StatusServiceUnavailable: "<p>The server is temporarily unable to service your\nrequest due to maintenance downtime or capacity\nproblems. Please try again later.</p>\n",
+}
+
+// apachePage returns Apache's default page of a status, which leaves out the
+// server signature as Apache does by default
+func apachePage(status int, method string) Page {
+	reason, ok := apacheReasons[status]
+	if !ok {
+		reason = http.StatusText(status)
+	}
+	message := apacheMessages[status]
+	if status == http.StatusMethodNotAllowed {
+		message = fmt.Sprintf(message, html.EscapeString(method))
+	}
+	body := fmt.Sprintf("<!DOCTYPE HTML PUBLIC \"-//IETF//DTD HTML 2.0//EN\">\n<html><head>\n<title>%d %s</title>\n</head><body>\n<h1>%s</h1>\n%s</body></html>\n",
+		status, reason, reason, message)
+	return Page{Body: []byte(body), ContentType: "text/html; charset=iso-8859-1"}
+}
+
+// nginxReasons are the reason phrases of nginx's error pages where they
+// differ from net/http's
+var nginxReasons = map[int]string{
+	http.StatusMethodNotAllowed:      "Not Allowed",
+	http.StatusRequestEntityTooLarge: "Request Entity Too Large",
+	http.StatusRequestURITooLong:     "Request-URI Too Large",
+	http.StatusServiceUnavailable:    "Service Temporarily Unavailable",
+}
+
+// nginxPage returns nginx's default page of a status, signed with the
+// Server header as nginx signs it
+func nginxPage(status int, server string) Page {
+	reason, ok := nginxReasons[status]
+	if !ok {
+		reason = http.StatusText(status)
+	}
+	body := fmt.Sprintf("<html>\r\n<head><title>%d %s</title></head>\r\n<body>\r\n<center><h1>%d %s</h1></center>\r\n<hr><center>%s</center>\r\n</body>\r\n</html>\r\n",
+		status, reason, status, reason, html.EscapeString(server))
+	return Page{Body: []byte(body), ContentType: "text/html"}
+}
+
+// iisError is the heading and explanation of an IIS error page
+type iisError struct {
+	heading string
+	detail  string
+}
+
+var iisErrors = map[int]iisError{
+	http.StatusUnauthorized: {"401 - Unauthorized: Access is denied due to invalid credentials.",
+		"You do not have permission to view this directory or page using the credentials that you supplied."},
+	http.StatusForbidden: {"403 - Forbidden: Access is denied.",
+		"You do not have permission to view this directory or page using the credentials that you supplied."},
+	http.StatusNotFound: {"404 - File or directory not found.",
+		"The resource you are looking for might have been removed, had its name changed, or is temporarily unavailable."},
+	http.StatusMethodNotAllowed: {"405 - HTTP verb used to access this page is not allowed.",
+		"The page you are looking for cannot be displayed because an invalid method (HTTP verb) was used to attempt access."},
+	http.StatusInternalServerError: {"500 - Internal server error.",
+		"There is a problem with the resource you are looking for, and it cannot be displayed."},
+	http.StatusBadGateway: {"502 - Web server received an invalid response while acting as a gateway or proxy server.",
+		"There is a problem with the page you are looking for, and it cannot be displayed. When the Web server (while acting as a gateway or proxy) contacted the upstream content server, it received an invalid response from the content server."},
+}
+
+// httpSysErrors are the errors HTTP.sys answers before a request reaches
+// IIS, with its own Server header
+var httpSysErrors = map[int]iisError{
+	http.StatusBadRequest:         {"Bad Request", "HTTP Error 400. The request is badly formed."},
+	http.StatusServiceUnavailable: {"Service Unavailable", "HTTP Error 503. The service is unavailable."},
+}
+
+const iisTemplate = `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=iso-8859-1"/>
+<title>%[1]s</title>
+<style type="text/css">
+body{margin:0;font-size:.7em;font-family:Verdana, Arial, Helvetica, sans-serif;background:#EEEEEE;}
+fieldset{padding:0 15px 10px 15px;}
+h1{font-size:2.4em;margin:0;color:#FFF;}
+h2{font-size:1.7em;margin:0;color:#CC0000;}
+h3{font-size:1.2em;margin:10px 0 0 0;color:#000000;}
+#header{width:96%%;margin:0 0 0 0;padding:6px 2%% 6px 2%%;font-family:"trebuchet MS", Verdana, sans-serif;color:#FFF;
+background-color:#555555;}
+#content{margin:0 0 0 2%%;position:relative;}
+.content-container{background:#FFF;width:96%%;margin-top:8px;padding:10px;position:relative;}
+</style>
+</head>
+<body>
+<div id="header"><h1>Server Error</h1></div>
+<div id="content">
+ <div class="content-container"><fieldset>
+  <h2>%[1]s</h2>
+  <h3>%[2]s</h3>
+ </fieldset></div>
+</div>
+</body>
+</html>
+`
+
+const httpSysTemplate = "<!DOCTYPE HTML PUBLIC \"-//W3C//DTD HTML 4.01//EN\"\"http://www.w3.org/TR/html4/strict.dtd\">\r\n" +
+	"<HTML><HEAD><TITLE>%[1]s</TITLE>\r\n<META HTTP-EQUIV=\"Content-Type\" Content=\"text/html; charset=us-ascii\"></HEAD>\r\n" +
+	"<BODY><h2>%[1]s</h2>\r\n<hr><p>%[2]s</p>\r\n</BODY></HTML>\r\n"
+
+// iisPage returns the page IIS answers remote clients with for a status,
+// or HTTP.sys for the errors it answers itself
+func iisPage(status int) Page {
+	if e, ok := httpSysErrors[status]; ok {
+		return Page{
+			Body:        []byte(fmt.Sprintf(httpSysTemplate, e.heading, e.detail)),
+			ContentType: "text/html; charset=us-ascii",
+			Server:      "Microsoft-HTTPAPI/2.0",
+		}
+	}
+	e, ok := iisErrors[status]
+	if !ok {
+		e = iisError{heading: fmt.Sprintf("%d - %s.", status, http.StatusText(status))}
+	}
+	return Page{Body: []byte(fmt.Sprintf(iisTemplate, e.heading, e.detail)), ContentType: "text/html"}
+}
+
+// headerOrders are the orders releases write response headers in, with
+// names cased as they write them. "*" stands for the headers without a
+// fixed place, such as those set by applications and configuration.
+var headerOrders = map[string][]string{
+	Apache: {"Date", "Server", "*", "Last-Modified", "ETag", "Accept-Ranges", "Content-Length",
+		"Vary", "Keep-Alive", "Connection", "Transfer-Encoding", "Content-Type"},
+	Nginx: {"Server", "Date", "Content-Type", "Content-Length", "Last-Modified", "Location",
+		"Transfer-Encoding", "Connection", "Keep-Alive", "ETag", "Accept-Ranges", "*"},
+	IIS: {"Transfer-Encoding", "Content-Type", "Content-Encoding", "Last-Modified", "Location", "Accept-Ranges",
+		"ETag", "Vary", "Server", "X-Powered-By", "*", "Date", "Connection", "Content-Length"},
+}
+
+// HeaderOrder returns the order the release writes response headers in,
+// "*" standing for headers it has no fixed place for
+func (p *Profile) HeaderOrder() []string {
+	return slices.Clone(headerOrders[p.software])
+}
+
+// nginxStatusLines are the reason phrases of nginx's status lines where
+// they differ from those of its error pages
+var nginxStatusLines = map[int]string{
+	http.StatusFound:                        "Moved Temporarily",
+	http.StatusRequestedRangeNotSatisfiable: "Requested Range Not Satisfiable",
+}
+
+// Reason returns the reason phrase of a status on the release's status line
+func (p *Profile) Reason(status int) string {
+	switch p.software {
+	case Apache:
+		if reason, ok := apacheReasons[status]; ok {
+			return reason
+		}
+	case Nginx:
+		if reason, ok := nginxStatusLines[status]; ok {
+			return reason
+		}
+		if reason, ok := nginxReasons[status]; ok {
+			return reason
+		}
+	}
+	return http.StatusText(status)
+}
+
+// keepAliveTimeouts are how long releases keep idle connections open by
+// default: Apache's KeepAliveTimeout, nginx's keepalive_timeout, and IIS's
+// connection timeout
+var keepAliveTimeouts = map[string]time.Duration{
+	Apache: 5 * time.Second,
+	Nginx:  75 * time.Second,
+	IIS:    120 * time.Second,
+}
+
+// KeepAliveTimeout returns how long the release keeps an idle connection
+// open between requests
+func (p *Profile) KeepAliveTimeout() time.Duration {
+	return keepAliveTimeouts[p.software]
+}
+
+// KeepAliveHeaders returns the connection headers the release sends with a
+// response, given how many more requests the connection takes including
+// the one answered. 0 closes the connection after the response.
+func (p *Profile) KeepAliveHeaders(remaining int) http.Header {
+	h := make(http.Header)
+	switch {
+	case remaining <= 0:
+		h.Set("Connection", "close")
+	case p.software == Apache:
+		h.Set("Keep-Alive", fmt.Sprintf("timeout=%d, max=%d", int(p.KeepAliveTimeout().Seconds()), remaining))
+		h.Set("Connection", "Keep-Alive")
+	case p.software == Nginx:
+		h.Set("Connection", "keep-alive")
+	}
+	return h
+}
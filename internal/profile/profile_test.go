@@ -0,0 +1,125 @@
+package profile
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	p, err := Lookup("nginx", "1.24")
+	if err != nil || p.Version() != "1.24.0" {
+		t.Fatalf("Expected nginx 1.24.0, got %+v, %v", p, err)
+	}
+	if p, err := Lookup("wordpress", "2.4.41"); err != nil || p.Software() != Apache || p.Server() != "Apache/2.4.41 (Unix)" {
+		t.Fatalf("Expected Apache 2.4.41 for wordpress, got %+v, %v", p, err)
+	}
+	if p, err := Lookup("nginx", ""); p != nil || err != nil {
+		t.Fatalf("Expected no profile without a version, got %+v, %v", p, err)
+	}
+	for _, bad := range [][2]string{{"nginx", "1.25"}, {"nginx", "1.24.x"}, {"iis", "2.4"}, {"generic", "1.0"}} {
+		if _, err := Lookup(bad[0], bad[1]); err == nil {
+			t.Fatalf("Expected %s %s to be rejected", bad[0], bad[1])
+		}
+	}
+}
+
+func TestConsistent(t *testing.T) {
+	p := New("apache2", "2.4")
+	for server, want := range map[string]bool{
+		"Apache/2.4.41 (Ubuntu)": true,
+		"Apache":                 true,
+		"Apache/2.2.34":          false,
+		"nginx/1.24.0":           false,
+	} {
+		if got := p.Consistent(server); got != want {
+			t.Fatalf("Expected Consistent(%q) to be %v", server, want)
+		}
+	}
+}
+
+func TestPage_MatchesTemplates(t *testing.T) {
+	for _, tc := range []struct {
+		p        *Profile
+		status   int
+		template string
+	}{
+		{New("apache2", "2.4"), http.StatusNotFound, "apache2/404.html"},
+		{New("apache2", "2.4"), http.StatusInternalServerError, "apache2/500.html"},
+		{New("apache2", "2.4"), http.StatusServiceUnavailable, "apache2/503.html"},
+		{New("iis", "10.0"), http.StatusNotFound, "iis/404.html"},
+		{New("iis", "10.0"), http.StatusServiceUnavailable, "iis/503.html"},
+	} {
+		want, err := os.ReadFile("../../services/" + tc.template)
+		if err != nil {
+			t.Fatalf("Failed to read template: %v", err)
+		}
+		if got := tc.p.Page(tc.status, http.MethodGet, "").Body; string(got) != string(want) {
+			t.Fatalf("Expected the %d page to match %s, got:\n%s", tc.status, tc.template, got)
+		}
+	}
+
+	page := New("nginx", "1.18").Page(http.StatusMethodNotAllowed, http.MethodPut, "nginx/1.18.0 (Ubuntu)")
+	if !strings.Contains(string(page.Body), "<title>405 Not Allowed</title>") || !strings.Contains(string(page.Body), "<center>nginx/1.18.0 (Ubuntu)</center>") {
+		t.Fatalf("Expected nginx's 405 page signed with the Server header, got:\n%s", page.Body)
+	}
+}
+
+func TestHandleMethod(t *testing.T) {
+	for _, tc := range []struct {
+		serviceType, version, method string
+		handled                      bool
+		status                       int
+		allow                        string
+	}{
+		{"apache2", "2.4", http.MethodGet, false, 0, ""},
+		{"apache2", "2.4", http.MethodOptions, true, http.StatusOK, apacheAllow},
+		{"apache2", "2.4", http.MethodTrace, true, http.StatusOK, ""},
+		{"apache2", "2.4", http.MethodPut, true, http.StatusMethodNotAllowed, apacheAllow},
+		{"nginx", "1.24", http.MethodPost, false, 0, ""},
+		{"nginx", "1.24", http.MethodOptions, true, http.StatusMethodNotAllowed, ""},
+		{"iis", "10.0", http.MethodOptions, true, http.StatusOK, iisAllow},
+		{"iis", "10.0", http.MethodDelete, false, 0, ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tc.method, "/index.html", nil)
+		handled := New(tc.serviceType, tc.version).HandleMethod(w, r)
+		if handled != tc.handled {
+			t.Fatalf("Expected %s %s handled=%v, got %v", tc.serviceType, tc.method, tc.handled, handled)
+		}
+		if !handled {
+			continue
+		}
+		if w.Code != tc.status || w.Header().Get("Allow") != tc.allow {
+			t.Fatalf("Expected %s %s to answer %d with Allow %q, got %d with %q",
+				tc.serviceType, tc.method, tc.status, tc.allow, w.Code, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestKeepAliveHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		serviceType, version string
+		remaining            int
+		connection           string
+		keepAlive            string
+	}{
+		{"apache2", "2.4", 100, "Keep-Alive", "timeout=5, max=100"},
+		{"apache2", "2.4", 0, "close", ""},
+		{"nginx", "1.24", 3, "keep-alive", ""},
+		{"iis", "10.0", 3, "", ""},
+		{"iis", "10.0", 0, "close", ""},
+	} {
+		h := New(tc.serviceType, tc.version).KeepAliveHeaders(tc.remaining)
+		if h.Get("Connection") != tc.connection || h.Get("Keep-Alive") != tc.keepAlive {
+			t.Fatalf("Expected %s with %d remaining to send Connection %q and Keep-Alive %q, got %v",
+				tc.serviceType, tc.remaining, tc.connection, tc.keepAlive, h)
+		}
+	}
+
+	if reason := New("nginx", "1.24").Reason(http.StatusMethodNotAllowed); reason != "Not Allowed" {
+		t.Fatalf("Expected nginx's 405 status line to read Not Allowed, got %q", reason)
+	}
+}
@@ -0,0 +1,158 @@
+// Package ratelimit counts the requests each source sends a service, so
+// requests past the configured rate can be answered as the service's rate
+// limit action says, and each source's remaining quota can be reported in
+// headers as API scanners expect. Requests are counted over fixed windows
+// starting at a source's first request.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// TagRateLimited tags requests past their source's rate limit
+const TagRateLimited = "rate-limited"
+
+// Limiter counts the requests of every source to a service
+type Limiter struct {
+	cfg config.RateLimitConfig
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+// window is a source's requests in its current window
+type window struct {
+	start    time.Time
+	requests int
+}
+
+// New creates the limiter of a service, or nil if it has no rate limit
+func New(cfg *config.RateLimitConfig) *Limiter {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	return &Limiter{
+		cfg:     *cfg,
+		windows: make(map[string]*window),
+	}
+}
+
+// Config returns the rate limit the limiter enforces
+func (l *Limiter) Config() *config.RateLimitConfig {
+	return &l.cfg
+}
+
+// Quota is where a source stands against its rate limit after a request
+type Quota struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+
+	// Exceeded is set on requests past the limit
+	Exceeded bool
+}
+
+// Allow counts a request from a source, reporting whether it is within the
+// source's rate
+func (l *Limiter) Allow(source string, now time.Time) bool {
+	return !l.Take(source, now).Exceeded
+}
+
+// Take counts a request from a source, returning its quota for the rest of
+// the window
+func (l *Limiter) Take(source string, now time.Time) Quota {
+	if l == nil {
+		return Quota{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	length := l.cfg.GetWindow()
+	if now.Sub(l.lastSweep) > length {
+		l.sweep(now, length)
+	}
+
+	w, ok := l.windows[source]
+	if !ok || now.Sub(w.start) >= length {
+		w = &window{start: now}
+		l.windows[source] = w
+	}
+	w.requests++
+	return Quota{
+		Limit:     l.cfg.Requests,
+		Remaining: max(l.cfg.Requests-w.requests, 0),
+		Reset:     w.start.Add(length),
+		Exceeded:  w.requests > l.cfg.Requests,
+	}
+}
+
+// SetHeaders reports a quota in the headers of the configured style, with a
+// Retry-After if it is exceeded. Limiters without a header style set none.
+func (l *Limiter) SetHeaders(h http.Header, q Quota, now time.Time) {
+	if l == nil || l.cfg.Headers == "" {
+		return
+	}
+
+	// Clients are told to come back no sooner than the window resets
+	wait := max(int(math.Ceil(q.Reset.Sub(now).Seconds())), 1)
+	switch l.cfg.Headers {
+	case config.RateLimitHeadersIETF:
+		h.Set("RateLimit-Limit", strconv.Itoa(q.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(q.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(wait))
+	default:
+		h.Set("X-RateLimit-Limit", strconv.Itoa(q.Limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(q.Remaining))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(q.Reset.Unix(), 10))
+	}
+	if q.Exceeded {
+		h.Set("Retry-After", strconv.Itoa(wait))
+	}
+}
+
+// sweep forgets sources whose window has ended
+func (l *Limiter) sweep(now time.Time, length time.Duration) {
+	l.lastSweep = now
+	for source, w := range l.windows {
+		if now.Sub(w.start) >= length {
+			delete(l.windows, source)
+		}
+	}
+}
+
+type contextKey struct{}
+
+// counted is a request's limiter and the quota it left
+type counted struct {
+	limiter *Limiter
+	quota   Quota
+}
+
+// NewContext returns a context carrying the quota a request left, marking
+// it as past the limiter's rate if the quota is exceeded
+func NewContext(ctx context.Context, l *Limiter, q Quota) context.Context {
+	return context.WithValue(ctx, contextKey{}, counted{limiter: l, quota: q})
+}
+
+// FromContext returns the limiter whose rate the request is past, or nil
+func FromContext(ctx context.Context) *Limiter {
+	c, _ := ctx.Value(contextKey{}).(counted)
+	if !c.quota.Exceeded {
+		return nil
+	}
+	return c.limiter
+}
+
+// QuotaFromContext returns the quota a request left, if it was counted
+func QuotaFromContext(ctx context.Context) (Quota, bool) {
+	c, ok := ctx.Value(contextKey{}).(counted)
+	return c.quota, ok
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	l := New(&config.RateLimitConfig{Enabled: true, Requests: 2, Window: time.Minute})
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if !l.Allow("203.0.113.7", now) {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+	if l.Allow("203.0.113.7", now.Add(30*time.Second)) {
+		t.Fatalf("Expected the third request in the window to be limited")
+	}
+	if !l.Allow("198.51.100.9", now.Add(30*time.Second)) {
+		t.Fatalf("Expected other sources to be unaffected")
+	}
+	if !l.Allow("203.0.113.7", now.Add(time.Minute)) {
+		t.Fatalf("Expected a new window to allow requests again")
+	}
+
+	if New(&config.RateLimitConfig{Requests: 2}) != nil {
+		t.Fatalf("Expected no limiter for a disabled rate limit")
+	}
+	l = New(&config.RateLimitConfig{Enabled: true, Requests: 3, Window: time.Minute})
+	l.Take("192.0.2.1", now)
+	q := l.Take("192.0.2.1", now.Add(10*time.Second))
+	if q.Limit != 3 || q.Remaining != 1 || !q.Reset.Equal(now.Add(time.Minute)) || q.Exceeded {
+		t.Fatalf("Expected 1 of 3 requests remaining until the window resets, got %+v", q)
+	}
+
+	var none *Limiter
+	if !none.Allow("203.0.113.7", now) {
+		t.Fatalf("Expected a nil limiter to allow every request")
+	}
+}
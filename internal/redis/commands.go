@@ -0,0 +1,552 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// state is what a session changed, kept only for the connection
+type state struct {
+	id     int64
+	conn   net.Conn
+	authed bool
+	name   string
+
+	// keys are the keys the client set, and config the parameters it
+	// changed with CONFIG SET
+	keys   map[string]string
+	config map[string]string
+
+	// master is the address SLAVEOF or REPLICAOF pointed the server at
+	master string
+}
+
+// configDefaults are the parameters CONFIG GET answers, as Debian and Ubuntu
+// packages configure them, with protected mode off as on the servers
+// attackers go looking for
+var configDefaults = map[string]string{
+	"dir":                         "/var/lib/redis",
+	"dbfilename":                  "dump.rdb",
+	"requirepass":                 "",
+	"masterauth":                  "",
+	"bind":                        "",
+	"protected-mode":              "no",
+	"port":                        "6379",
+	"databases":                   "16",
+	"daemonize":                   "yes",
+	"save":                        "900 1 300 10 60 10000",
+	"appendonly":                  "no",
+	"appendfilename":              "appendonly.aof",
+	"logfile":                     "/var/log/redis/redis-server.log",
+	"pidfile":                     "/run/redis/redis-server.pid",
+	"loglevel":                    "notice",
+	"maxclients":                  "10000",
+	"maxmemory":                   "0",
+	"maxmemory-policy":            "noeviction",
+	"timeout":                     "0",
+	"tcp-keepalive":               "300",
+	"slave-read-only":             "yes",
+	"replica-read-only":           "yes",
+	"stop-writes-on-bgsave-error": "yes",
+	"rdbcompression":              "yes",
+	"unixsocket":                  "",
+	"supervised":                  "no",
+}
+
+// protectedConfigs are the parameters Redis 7 refuses to change at runtime,
+// closing the file writing attacks that set them
+var protectedConfigs = map[string]bool{"dir": true, "dbfilename": true}
+
+// answer replies to a command, reporting whether the connection is to be
+// closed afterwards
+func (s *Server) answer(st *state, name string, args []string) (string, bool) {
+	if name == "quit" {
+		return simpleReply("OK"), true
+	}
+	if !st.authed && name != "auth" && name != "hello" {
+		return errorReply("NOAUTH Authentication required."), false
+	}
+
+	arity := func(min int) bool {
+		return len(args) >= min
+	}
+	wrongArity := errorReply(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+
+	switch name {
+	case "ping":
+		if len(args) > 1 {
+			return wrongArity, false
+		}
+		if len(args) == 1 {
+			return bulkReply(args[0]), false
+		}
+		return simpleReply("PONG"), false
+
+	case "echo":
+		if len(args) != 1 {
+			return wrongArity, false
+		}
+		return bulkReply(args[0]), false
+
+	case "auth":
+		if len(args) < 1 || len(args) > 2 {
+			return wrongArity, false
+		}
+		return s.auth(st, args), false
+
+	case "hello":
+		if s.major < 6 {
+			break
+		}
+		if len(args) >= 4 && strings.EqualFold(args[1], "auth") {
+			if reply := s.auth(st, args[2:4]); reply != simpleReply("OK") {
+				return reply, false
+			}
+		}
+		if !st.authed {
+			return errorReply("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"), false
+		}
+		return arrayReply(bulkReply("server"), bulkReply("redis"),
+			bulkReply("version"), bulkReply(s.version),
+			bulkReply("proto"), intReply(2),
+			bulkReply("id"), intReply(st.id),
+			bulkReply("mode"), bulkReply("standalone"),
+			bulkReply("role"), bulkReply(s.role(st)),
+			bulkReply("modules"), arrayReply()), false
+
+	case "info":
+		return bulkReply(s.info(st, args)), false
+
+	case "config":
+		if !arity(1) {
+			return wrongArity, false
+		}
+		return s.configCommand(st, args), false
+
+	case "client":
+		if !arity(1) {
+			return wrongArity, false
+		}
+		return s.client(st, args), false
+
+	case "command":
+		return arrayReply(), false
+
+	case "select":
+		if len(args) != 1 {
+			return wrongArity, false
+		}
+		if n, err := strconv.Atoi(args[0]); err != nil {
+			return errorReply("ERR value is not an integer or out of range"), false
+		} else if n < 0 || n > 15 {
+			return errorReply("ERR DB index is out of range"), false
+		}
+		return simpleReply("OK"), false
+
+	case "set":
+		if !arity(2) {
+			return wrongArity, false
+		}
+		if _, ok := st.keys[args[0]]; ok || len(st.keys) < maxKeys {
+			st.keys[args[0]] = args[1]
+		}
+		return simpleReply("OK"), false
+
+	case "get":
+		if len(args) != 1 {
+			return wrongArity, false
+		}
+		if v, ok := st.keys[args[0]]; ok {
+			return bulkReply(v), false
+		}
+		return nilReply, false
+
+	case "del", "unlink", "exists":
+		if !arity(1) {
+			return wrongArity, false
+		}
+		n := 0
+		for _, key := range args {
+			if _, ok := st.keys[key]; ok {
+				n++
+				if name != "exists" {
+					delete(st.keys, key)
+				}
+			}
+		}
+		return intReply(int64(n)), false
+
+	case "type":
+		if len(args) != 1 {
+			return wrongArity, false
+		}
+		if _, ok := st.keys[args[0]]; ok {
+			return simpleReply("string"), false
+		}
+		return simpleReply("none"), false
+
+	case "keys":
+		if len(args) != 1 {
+			return wrongArity, false
+		}
+		var keys []string
+		for key := range st.keys {
+			if ok, _ := path.Match(args[0], key); ok {
+				keys = append(keys, bulkReply(key))
+			}
+		}
+		slices.Sort(keys)
+		return arrayReply(keys...), false
+
+	case "dbsize":
+		return intReply(int64(len(st.keys))), false
+
+	case "flushall", "flushdb":
+		clear(st.keys)
+		return simpleReply("OK"), false
+
+	case "save":
+		return simpleReply("OK"), false
+
+	case "bgsave":
+		return simpleReply("Background saving started"), false
+
+	case "lastsave":
+		return intReply(s.start.Unix()), false
+
+	case "time":
+		now := time.Now()
+		return arrayReply(bulkReply(strconv.FormatInt(now.Unix(), 10)),
+			bulkReply(strconv.Itoa(now.Nanosecond()/1000))), false
+
+	case "slaveof", "replicaof":
+		if len(args) != 2 {
+			return wrongArity, false
+		}
+		if strings.EqualFold(args[0], "no") && strings.EqualFold(args[1], "one") {
+			st.master = ""
+		} else if _, err := strconv.Atoi(args[1]); err != nil {
+			return errorReply("ERR Invalid master port"), false
+		} else {
+			st.master = net.JoinHostPort(args[0], args[1])
+		}
+		return simpleReply("OK"), false
+
+	case "module":
+		if !arity(1) {
+			return wrongArity, false
+		}
+		switch strings.ToLower(args[0]) {
+		case "list":
+			return arrayReply(), false
+		case "load", "loadex":
+			if s.major >= 7 {
+				return errorReply("ERR MODULE command not allowed. If the enable-module-command option is set to \"local\", you can run it from a local connection, otherwise you need to set this option in the configuration file, and then restart the server."), false
+			}
+			return errorReply("ERR Error loading the extension. Please check the server logs."), false
+		}
+
+	case "eval", "evalsha":
+		if !arity(2) {
+			return wrongArity, false
+		}
+		return nilReply, false
+	}
+
+	return s.unknown(name, args), false
+}
+
+// auth answers AUTH, logging in only with the configured password for the
+// default user
+func (s *Server) auth(st *state, args []string) string {
+	if s.password == "" {
+		if s.major >= 6 {
+			return errorReply("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		}
+		return errorReply("ERR Client sent AUTH, but no password is set")
+	}
+	password := args[len(args)-1]
+	if password == s.password && (len(args) == 1 || args[0] == "default") {
+		st.authed = true
+		return simpleReply("OK")
+	}
+	if s.major >= 6 {
+		return errorReply("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	return errorReply("ERR invalid password")
+}
+
+// configCommand answers CONFIG and its subcommands
+func (s *Server) configCommand(st *state, args []string) string {
+	sub := strings.ToLower(args[0])
+	switch {
+	case sub == "get" && len(args) >= 2 && (len(args) == 2 || s.major >= 7):
+		var names []string
+		for name := range configDefaults {
+			for _, pattern := range args[1:] {
+				if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+					names = append(names, name)
+					break
+				}
+			}
+		}
+		slices.Sort(names)
+		var reply []string
+		for _, name := range names {
+			reply = append(reply, bulkReply(name), bulkReply(s.config(st, name)))
+		}
+		return arrayReply(reply...)
+
+	case sub == "set" && len(args) >= 3 && len(args)%2 == 1 && (len(args) == 3 || s.major >= 7):
+		for i := 1; i < len(args); i += 2 {
+			name := strings.ToLower(args[i])
+			if _, ok := configDefaults[name]; !ok {
+				return errorReply(fmt.Sprintf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", args[i]))
+			}
+			if s.major >= 7 && protectedConfigs[name] {
+				return errorReply(fmt.Sprintf("ERR CONFIG SET failed (possibly related to argument '%s') - can't set protected config", name))
+			}
+		}
+		for i := 1; i < len(args); i += 2 {
+			st.config[strings.ToLower(args[i])] = args[i+1]
+		}
+		return simpleReply("OK")
+
+	case (sub == "resetstat" || sub == "rewrite") && len(args) == 1:
+		return simpleReply("OK")
+	}
+	return errorReply(fmt.Sprintf("ERR Unknown subcommand or wrong number of arguments for '%s'. Try CONFIG HELP.", args[0]))
+}
+
+// config returns the value of a configuration parameter in a session
+func (s *Server) config(st *state, name string) string {
+	if v, ok := st.config[name]; ok {
+		return v
+	}
+	switch name {
+	case "requirepass":
+		return s.password
+	case "port":
+		return strconv.Itoa(localPort(st.conn))
+	}
+	return configDefaults[name]
+}
+
+// client answers CLIENT and its subcommands
+func (s *Server) client(st *state, args []string) string {
+	switch strings.ToLower(args[0]) {
+	case "setname":
+		if len(args) == 2 {
+			st.name = args[1]
+			return simpleReply("OK")
+		}
+	case "getname":
+		if st.name == "" {
+			return nilReply
+		}
+		return bulkReply(st.name)
+	case "id":
+		return intReply(st.id)
+	case "list", "info":
+		return bulkReply(fmt.Sprintf("id=%d addr=%s laddr=%s fd=8 name=%s age=0 idle=0 flags=N db=0 sub=0 psub=0 multi=-1 qbuf=26 qbuf-free=32742 obl=0 oll=0 omem=0 events=r cmd=client\n",
+			st.id, st.conn.RemoteAddr(), st.conn.LocalAddr(), st.name))
+	}
+	return errorReply(fmt.Sprintf("ERR Unknown subcommand or wrong number of arguments for '%s'. Try CLIENT HELP.", args[0]))
+}
+
+// unknown answers commands the server does not implement, in the wording of
+// its release
+func (s *Server) unknown(name string, args []string) string {
+	quote := func(s string) string { return "`" + s + "`" }
+	if s.major >= 7 {
+		quote = func(s string) string { return "'" + s + "'" }
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "ERR unknown command %s, with args beginning with: ", quote(name))
+	for _, arg := range args {
+		if b.Len() > 128 {
+			break
+		}
+		b.WriteString(quote(arg) + " ")
+	}
+	return errorReply(strings.NewReplacer("\r", " ", "\n", " ").Replace(b.String()))
+}
+
+// role returns the replication role of the server as a session sees it
+func (s *Server) role(st *state) string {
+	if st.master != "" {
+		return "slave"
+	}
+	return "master"
+}
+
+// info returns the sections of INFO requested, or the default ones
+func (s *Server) info(st *state, args []string) string {
+	uptime := int64(time.Since(s.start).Seconds())
+	sections := map[string][]string{
+		"server": {
+			"redis_version:" + s.version,
+			"redis_git_sha1:00000000",
+			"redis_git_dirty:0",
+			"redis_build_id:" + buildID(s.version),
+			"redis_mode:standalone",
+			"os:" + s.os,
+			"arch_bits:64",
+			"multiplexing_api:epoll",
+			"atomicvar_api:atomic-builtin",
+			"gcc_version:11.2.0",
+			fmt.Sprintf("process_id:%d", s.pid),
+			"run_id:" + s.runID,
+			fmt.Sprintf("tcp_port:%d", localPort(st.conn)),
+			fmt.Sprintf("uptime_in_seconds:%d", uptime),
+			fmt.Sprintf("uptime_in_days:%d", uptime/86400),
+			"hz:10",
+			"configured_hz:10",
+			fmt.Sprintf("lru_clock:%d", time.Now().Unix()&(1<<24-1)),
+			"executable:/usr/bin/redis-server",
+			"config_file:/etc/redis/redis.conf",
+		},
+		"clients": {
+			"connected_clients:1",
+			"client_recent_max_input_buffer:16",
+			"client_recent_max_output_buffer:0",
+			"blocked_clients:0",
+			"tracking_clients:0",
+			"clients_in_timeout_table:0",
+		},
+		"memory": {
+			"used_memory:873960",
+			"used_memory_human:853.48K",
+			"used_memory_rss:5812224",
+			"used_memory_rss_human:5.54M",
+			"used_memory_peak:935576",
+			"used_memory_peak_human:913.65K",
+			"maxmemory:0",
+			"maxmemory_human:0B",
+			"maxmemory_policy:noeviction",
+			"mem_fragmentation_ratio:6.65",
+			"mem_allocator:jemalloc-5.2.1",
+		},
+		"persistence": {
+			"loading:0",
+			fmt.Sprintf("rdb_changes_since_last_save:%d", len(st.keys)),
+			"rdb_bgsave_in_progress:0",
+			fmt.Sprintf("rdb_last_save_time:%d", s.start.Unix()),
+			"rdb_last_bgsave_status:ok",
+			"aof_enabled:0",
+			"aof_rewrite_in_progress:0",
+		},
+		"stats": {
+			fmt.Sprintf("total_connections_received:%d", s.connections.Load()),
+			fmt.Sprintf("total_commands_processed:%d", s.commands.Load()),
+			"instantaneous_ops_per_sec:0",
+			"rejected_connections:0",
+			"expired_keys:0",
+			"evicted_keys:0",
+			"keyspace_hits:0",
+			"keyspace_misses:0",
+			"pubsub_channels:0",
+			"pubsub_patterns:0",
+		},
+		"cpu": {
+			fmt.Sprintf("used_cpu_sys:%.6f", float64(uptime)*0.0011),
+			fmt.Sprintf("used_cpu_user:%.6f", float64(uptime)*0.0009),
+		},
+		"cluster": {"cluster_enabled:0"},
+	}
+
+	replication := []string{"role:" + s.role(st)}
+	if host, port, err := net.SplitHostPort(st.master); err == nil {
+		replication = append(replication, "master_host:"+host, "master_port:"+port, "master_link_status:down")
+	}
+	sections["replication"] = append(replication,
+		"connected_slaves:0",
+		"master_replid:"+s.replID,
+		"master_repl_offset:0")
+
+	var keyspace []string
+	if len(st.keys) > 0 {
+		keyspace = append(keyspace, fmt.Sprintf("db0:keys=%d,expires=0,avg_ttl=0", len(st.keys)))
+	}
+	sections["keyspace"] = keyspace
+
+	order := []string{"server", "clients", "memory", "persistence", "stats", "replication", "cpu", "cluster", "keyspace"}
+	requested := order
+	if len(args) > 0 {
+		requested = nil
+		for _, arg := range args {
+			switch arg = strings.ToLower(arg); arg {
+			case "all", "everything", "default":
+				requested = order
+			default:
+				requested = append(requested, arg)
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, name := range requested {
+		lines, ok := sections[name]
+		if !ok {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		title := strings.ToUpper(name[:1]) + name[1:]
+		if name == "cpu" {
+			title = "CPU"
+		}
+		b.WriteString("# " + title + "\r\n")
+		for _, line := range lines {
+			b.WriteString(line + "\r\n")
+		}
+	}
+	return b.String()
+}
+
+// buildID returns the build id a release reports, fixed per version as a
+// packaged binary's is
+func buildID(version string) string {
+	sum := sha1.Sum([]byte("redis-" + version))
+	return hex.EncodeToString(sum[:8])
+}
+
+// localPort returns the port a connection was accepted on
+func localPort(conn net.Conn) int {
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 6379
+}
+
+// nilReply is the null bulk string of missing values
+const nilReply = "$-1\r\n"
+
+func simpleReply(s string) string {
+	return "+" + s + "\r\n"
+}
+
+func errorReply(s string) string {
+	return "-" + s + "\r\n"
+}
+
+func intReply(n int64) string {
+	return ":" + strconv.FormatInt(n, 10) + "\r\n"
+}
+
+func bulkReply(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+// arrayReply returns an array of replies already encoded
+func arrayReply(items ...string) string {
+	return "*" + strconv.Itoa(len(items)) + "\r\n" + strings.Join(items, "")
+}
@@ -0,0 +1,371 @@
+// Package redis answers Redis clients as an unprotected server would,
+// speaking enough RESP to answer the commands scanners and exploits send:
+// PING, INFO, AUTH, CONFIG, and the key, persistence, replication, and module
+// commands of the well-known attacks that write files through CONFIG SET or
+// load modules from a rogue master. Writes are kept for the session only, so
+// nothing an attacker does persists or reaches the host.
+package redis
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+const (
+	// idleTimeout bounds how long a client may take to send a command
+	idleTimeout = 60 * time.Second
+
+	// maxSession bounds how long a session may last
+	maxSession = 10 * time.Minute
+
+	// maxCommands bounds the commands answered in a session
+	maxCommands = 500
+
+	// maxInline bounds the length of inline commands, and maxBulk that of
+	// the arguments of RESP ones
+	maxInline = 64 << 10
+	maxBulk   = 512 << 10
+
+	// maxArgs bounds the arguments of a command
+	maxArgs = 1024
+
+	// maxKeys bounds the keys a session may set
+	maxKeys = 1000
+
+	// maxTranscript bounds the transcript recorded for a session, and
+	// maxRecorded the length of each argument or reply recorded
+	maxTranscript = 64 << 10
+	maxRecorded   = 200
+)
+
+// errCrossProtocol ends sessions of clients sending HTTP, which Redis
+// closes as a possible attack
+var errCrossProtocol = errors.New("possible cross-protocol attack")
+
+// Server answers Redis connections
+type Server struct {
+	version  string
+	major    int
+	os       string
+	password string
+
+	// Process details INFO reports, fixed for the life of the server
+	start  time.Time
+	pid    int
+	runID  string
+	replID string
+
+	connections atomic.Int64
+	commands    atomic.Int64
+	clientID    atomic.Int64
+}
+
+// NewServer creates a server answering as the configured Redis release
+func NewServer(cfg *config.RedisConfig) *Server {
+	s := &Server{
+		version: cfg.GetVersion(),
+		os:      cfg.GetOS(),
+		start:   time.Now(),
+		pid:     500 + mathrand.IntN(4500),
+		runID:   randomHex(20),
+		replID:  randomHex(20),
+	}
+	if cfg != nil {
+		s.password = cfg.Password
+	}
+	s.major, _ = strconv.Atoi(strings.SplitN(s.version, ".", 2)[0])
+	return s
+}
+
+// Version returns the Redis version the server reports
+func (s *Server) Version() string {
+	return s.version
+}
+
+// Session is what a client did before the connection was closed
+type Session struct {
+	Start       time.Time
+	Duration    time.Duration
+	Credentials []database.Credential
+	Commands    int
+	Transcript  string
+
+	// Err is why the session ended other than with QUIT or the client
+	// hanging up, if it did
+	Err error
+}
+
+// Handle answers a client's commands until it quits, goes idle, or reaches
+// the session limits. The caller closes the connection.
+func (s *Server) Handle(conn net.Conn) *Session {
+	sess := &Session{Start: time.Now()}
+	var transcript strings.Builder
+	defer func() {
+		sess.Duration = time.Since(sess.Start)
+		sess.Transcript = transcript.String()
+	}()
+	record := func(prefix, line string) {
+		if transcript.Len()+len(line) < maxTranscript {
+			transcript.WriteString(prefix + line + "\n")
+		}
+	}
+
+	s.connections.Add(1)
+	st := &state{
+		id:     s.clientID.Add(1) + 2,
+		conn:   conn,
+		authed: s.password == "",
+		keys:   make(map[string]string),
+		config: make(map[string]string),
+	}
+
+	r := bufio.NewReaderSize(conn, maxInline)
+	deadline := sess.Start.Add(maxSession)
+	for sess.Commands < maxCommands {
+		conn.SetReadDeadline(minTime(time.Now().Add(idleTimeout), deadline))
+		args, err := readCommand(r)
+		var protoErr protocolError
+		if errors.As(err, &protoErr) {
+			reply := errorReply("ERR Protocol error: " + string(protoErr))
+			record("S: ", summary(reply))
+			io.WriteString(conn, reply)
+			sess.Err = err
+			return sess
+		}
+		if err != nil {
+			var netErr net.Error
+			if !errors.Is(err, io.EOF) && !(errors.As(err, &netErr) && netErr.Timeout()) {
+				sess.Err = err
+			}
+			return sess
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		record("C: ", quoteArgs(args))
+		sess.Commands++
+		s.commands.Add(1)
+
+		name := strings.ToLower(args[0])
+		if name == "post" || name == "host:" {
+			sess.Err = errCrossProtocol
+			return sess
+		}
+		if name == "auth" || (name == "hello" && len(args) >= 5 && strings.EqualFold(args[2], "auth")) {
+			sess.Credentials = append(sess.Credentials, credential(args))
+		}
+
+		reply, quit := s.answer(st, name, args[1:])
+		record("S: ", summary(reply))
+		if _, err := io.WriteString(conn, reply); err != nil {
+			sess.Err = err
+			return sess
+		}
+		if quit {
+			return sess
+		}
+	}
+	return sess
+}
+
+// credential returns the login an AUTH or HELLO command tries. AUTH with a
+// password alone logs in as the default user.
+func credential(args []string) database.Credential {
+	if strings.EqualFold(args[0], "hello") {
+		return database.Credential{Username: args[3], Password: args[4]}
+	}
+	switch len(args) {
+	case 2:
+		return database.Credential{Username: "default", Password: args[1]}
+	case 3:
+		return database.Credential{Username: args[1], Password: args[2]}
+	}
+	return database.Credential{}
+}
+
+// protocolError is a request that does not follow RESP, which Redis answers
+// with an error before closing the connection
+type protocolError string
+
+func (e protocolError) Error() string {
+	return "protocol error: " + string(e)
+}
+
+// readCommand reads a command, sent as a RESP array of bulk strings or
+// inline as a line of words
+func readCommand(r *bufio.Reader) ([]string, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] != '*' {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		return splitInline(line)
+	}
+
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+	args := make([]string, 0, max(n, 0))
+	for range n {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" || line[0] != '$' {
+			return nil, protocolError(fmt.Sprintf("expected '$', got '%.1s'", line))
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulk {
+			return nil, protocolError("invalid bulk length")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a line without its line ending
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", protocolError("too big inline request")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// splitInline splits an inline command into words, honoring double and
+// single quotes as redis-cli and Redis do
+func splitInline(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+				if i+1 < len(line) && line[i+1] != ' ' && line[i+1] != '\t' {
+					return nil, protocolError("unbalanced quotes in request")
+				}
+				continue
+			}
+			if c == '\\' && quote == '"' && i+1 < len(line) {
+				i++
+				switch line[i] {
+				case 'n':
+					c = '\n'
+				case 'r':
+					c = '\r'
+				case 't':
+					c = '\t'
+				default:
+					c = line[i]
+				}
+			}
+			word.WriteByte(c)
+		case c == ' ' || c == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case (c == '"' || c == '\'') && !inWord:
+			quote, inWord = c, true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, protocolError("unbalanced quotes in request")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// quoteArgs formats a command for the transcript, quoting and shortening
+// arguments that would make it hard to read
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if len(arg) > maxRecorded {
+			arg = arg[:maxRecorded] + "..."
+		}
+		if arg == "" || strings.ContainsAny(arg, " \t\r\n\"'\\") || !isPrintable(arg) {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+func isPrintable(s string) bool {
+	for _, c := range []byte(s) {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// summary shortens a reply to its first line for the transcript
+func summary(reply string) string {
+	line, _, _ := strings.Cut(reply, "\r\n")
+	if strings.HasPrefix(line, "$") && line != "$-1" {
+		// Bulk replies are summarized by the start of their content
+		_, rest, _ := strings.Cut(reply, "\r\n")
+		content, _, _ := strings.Cut(rest, "\r\n")
+		line += " " + strconv.Quote(content)
+	}
+	if len(line) > maxRecorded {
+		line = line[:maxRecorded] + "..."
+	}
+	return line
+}
+
+// randomHex returns n random bytes in hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
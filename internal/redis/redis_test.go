@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// startSession answers one connection, returning the client end and the
+// session once it ends
+func startSession(cfg *config.RedisConfig) (net.Conn, *bufio.Reader, chan *Session) {
+	server, client := net.Pipe()
+	srv := NewServer(cfg)
+	done := make(chan *Session, 1)
+	go func() {
+		sess := srv.Handle(server)
+		server.Close()
+		done <- sess
+	}()
+	return client, bufio.NewReader(client), done
+}
+
+// send writes a command and reads the first line of its reply
+func send(t *testing.T, conn net.Conn, r *bufio.Reader, command string) string {
+	t.Helper()
+	if _, err := conn.Write([]byte(command)); err != nil {
+		t.Fatalf("Failed to send %q: %v", command, err)
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read reply to %q: %v", command, err)
+	}
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+func TestServer_Handle(t *testing.T) {
+	client, r, done := startSession(&config.RedisConfig{Version: "7.2.4"})
+
+	if reply := send(t, client, r, "PING\r\n"); reply != "+PONG" {
+		t.Fatalf("Expected +PONG, got %q", reply)
+	}
+	reply := send(t, client, r, "*1\r\n$4\r\nINFO\r\n")
+	n, err := strconv.Atoi(strings.TrimPrefix(reply, "$"))
+	if err != nil {
+		t.Fatalf("Expected a bulk reply to INFO, got %q", reply)
+	}
+	info := make([]byte, n+2)
+	io.ReadFull(r, info)
+	if !strings.HasPrefix(string(info), "# Server\r\nredis_version:7.2.4\r\n") || !strings.Contains(string(info), "\r\nos:Linux 5.15.0-91-generic x86_64\r\n") {
+		t.Fatalf("Expected the configured version and OS, got %q", info)
+	}
+
+	if reply := send(t, client, r, "*3\r\n$6\r\nCONFIG\r\n$3\r\nGET\r\n$3\r\ndir\r\n"); reply != "*2" {
+		t.Fatalf("Expected one parameter, got %q", reply)
+	}
+	r.ReadString('\n')
+	r.ReadString('\n')
+	r.ReadString('\n')
+	if line, _ := r.ReadString('\n'); line != "/var/lib/redis\r\n" {
+		t.Fatalf("Expected the default dir, got %q", line)
+	}
+	if reply := send(t, client, r, "CONFIG SET dir /root/.ssh\r\n"); !strings.Contains(reply, "protected config") {
+		t.Fatalf("Expected Redis 7 to refuse setting dir, got %q", reply)
+	}
+	if reply := send(t, client, r, "AUTH admin hunter2\r\n"); !strings.HasPrefix(reply, "-ERR AUTH <password> called without any password") {
+		t.Fatalf("Expected AUTH to fail without a password configured, got %q", reply)
+	}
+	if reply := send(t, client, r, "FOO bar\r\n"); reply != "-ERR unknown command 'foo', with args beginning with: 'bar' " {
+		t.Fatalf("Expected an unknown command error, got %q", reply)
+	}
+	if reply := send(t, client, r, "QUIT\r\n"); reply != "+OK" {
+		t.Fatalf("Expected +OK, got %q", reply)
+	}
+
+	sess := <-done
+	if sess.Err != nil || sess.Commands != 7 {
+		t.Fatalf("Expected 7 commands and a clean end, got %+v", sess)
+	}
+	if len(sess.Credentials) != 1 || sess.Credentials[0].Username != "admin" || sess.Credentials[0].Password != "hunter2" {
+		t.Fatalf("Expected the AUTH credentials to be recorded, got %+v", sess.Credentials)
+	}
+	if !strings.Contains(sess.Transcript, "C: CONFIG SET dir /root/.ssh\n") {
+		t.Fatalf("Expected the commands in the transcript, got %q", sess.Transcript)
+	}
+}
+
+func TestServer_Handle_Password(t *testing.T) {
+	client, r, done := startSession(&config.RedisConfig{Password: "secret"})
+
+	if reply := send(t, client, r, "CONFIG GET *\r\n"); reply != "-NOAUTH Authentication required." {
+		t.Fatalf("Expected authentication to be required, got %q", reply)
+	}
+	if reply := send(t, client, r, "AUTH guess\r\n"); !strings.HasPrefix(reply, "-WRONGPASS") {
+		t.Fatalf("Expected a wrong password error, got %q", reply)
+	}
+	if reply := send(t, client, r, "AUTH secret\r\n"); reply != "+OK" {
+		t.Fatalf("Expected the configured password to log in, got %q", reply)
+	}
+	if reply := send(t, client, r, "CONFIG SET dir /tmp\r\n"); reply != "+OK" {
+		t.Fatalf("Expected Redis 6 to set dir, got %q", reply)
+	}
+	if reply := send(t, client, r, "unknowncmd\r\n"); reply != "-ERR unknown command `unknowncmd`, with args beginning with: " {
+		t.Fatalf("Expected the Redis 6 wording of unknown commands, got %q", reply)
+	}
+	client.Write([]byte("POST / HTTP/1.1\r\n"))
+
+	sess := <-done
+	if sess.Err != errCrossProtocol {
+		t.Fatalf("Expected HTTP to end the session, got %v", sess.Err)
+	}
+	if len(sess.Credentials) != 2 || sess.Credentials[0].Username != "default" || sess.Credentials[1].Password != "secret" {
+		t.Fatalf("Expected both logins to be recorded, got %+v", sess.Credentials)
+	}
+}
@@ -0,0 +1,274 @@
+package reputation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/geoip"
+	"github.com/davidthuman/service-spoof/internal/logging"
+)
+
+// enrichLog logs the refreshes that fail, as part of enriching sources
+var enrichLog = logging.Logger("enrich")
+
+// fetchTimeout bounds how long downloading a list may take
+const fetchTimeout = 30 * time.Second
+
+// DatacenterASNs are hosting and cloud providers whose address space is
+// flagged as datacenter traffic in addition to any configured ASNs
+var DatacenterASNs = []int{
+	16509, 14618, // Amazon
+	15169, 396982, // Google
+	8075,   // Microsoft
+	31898,  // Oracle
+	14061,  // DigitalOcean
+	16276,  // OVH
+	24940,  // Hetzner
+	63949,  // Linode
+	20473,  // Vultr
+	12876,  // Scaleway
+	51167,  // Contabo
+	45102,  // Alibaba
+	132203, // Tencent
+}
+
+// Flags describe what kind of network a request source belongs to
+type Flags struct {
+	Tor        bool `json:"tor"`
+	Datacenter bool `json:"datacenter"`
+	Proxy      bool `json:"proxy"`
+}
+
+// Any reports whether any flag is set
+func (f Flags) Any() bool {
+	return f.Tor || f.Datacenter || f.Proxy
+}
+
+// Checker flags request sources found on Tor exit and open proxy lists or
+// announced by datacenter ASNs
+type Checker struct {
+	config      *config.ReputationConfig
+	geo         *geoip.DB
+	client      *http.Client
+	datacenters map[int]bool
+
+	mu      sync.RWMutex
+	tor     *addrSet
+	proxies *addrSet
+}
+
+// NewChecker creates a checker for the configured lists. geo resolves the
+// ASN of sources and may be nil, in which case nothing is flagged as
+// datacenter traffic.
+func NewChecker(cfg *config.ReputationConfig, geo *geoip.DB) *Checker {
+	c := &Checker{
+		config:      cfg,
+		geo:         geo,
+		client:      &http.Client{Timeout: fetchTimeout},
+		datacenters: make(map[int]bool),
+		tor:         newAddrSet(),
+		proxies:     newAddrSet(),
+	}
+	for _, asn := range DatacenterASNs {
+		c.datacenters[asn] = true
+	}
+	for _, asn := range cfg.DatacenterASNs {
+		c.datacenters[asn] = true
+	}
+	return c
+}
+
+// Flags returns the flags for a source address, which may include a port
+func (c *Checker) Flags(ip string) Flags {
+	if c == nil {
+		return Flags{}
+	}
+
+	var flags Flags
+	if rec, ok := c.geo.Lookup(ip); ok {
+		flags.Datacenter = c.datacenters[rec.ASN]
+	}
+
+	addr, ok := parseAddr(ip)
+	if !ok {
+		return flags
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	flags.Tor = c.tor.contains(addr)
+	flags.Proxy = c.proxies.contains(addr)
+	return flags
+}
+
+// Counts returns the number of Tor exit and open proxy entries loaded
+func (c *Checker) Counts() (tor, proxies int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tor.len(), c.proxies.len()
+}
+
+// Refresh reloads every configured list. Lists that fail to load keep their
+// previous contents.
+func (c *Checker) Refresh(ctx context.Context) error {
+	var errs []error
+
+	if c.config.TorExitList != "" {
+		set, err := c.load(ctx, c.config.TorExitList)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tor exit list: %w", err))
+		} else {
+			c.mu.Lock()
+			c.tor = set
+			c.mu.Unlock()
+		}
+	}
+
+	if c.config.ProxyList != "" {
+		set, err := c.load(ctx, c.config.ProxyList)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("proxy list: %w", err))
+		} else {
+			c.mu.Lock()
+			c.proxies = set
+			c.mu.Unlock()
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to refresh reputation lists: %v", errs)
+	}
+	return nil
+}
+
+// Start refreshes the lists on the given interval until ctx is cancelled
+func (c *Checker) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil {
+				enrichLog.Warn("failed to refresh reputation lists", "err", err)
+			}
+		}
+	}
+}
+
+// load reads a list of addresses from a URL or file
+func (c *Checker) load(ctx context.Context, source string) (*addrSet, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseList(f)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return parseList(resp.Body)
+}
+
+// parseList reads one address, address and port, or CIDR prefix per line.
+// IPv6 addresses with a port are bracketed. Blank lines, comments, and
+// unparseable lines are skipped, since published lists often carry headers.
+func parseList(r io.Reader) (*addrSet, error) {
+	set := newAddrSet()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexAny(line, "# \t"); i >= 0 {
+			line = line[:i]
+		}
+		if line == "" {
+			continue
+		}
+
+		if prefix, err := netip.ParsePrefix(line); err == nil {
+			set.prefixes = append(set.prefixes, unmapPrefix(prefix).Masked())
+			continue
+		}
+		if addr, ok := parseAddr(line); ok {
+			set.addrs[addr] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// parseAddr parses an address with or without a port. IPv4-mapped IPv6
+// addresses are unmapped and zones dropped, so sources match list entries
+// however either is written.
+func parseAddr(s string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(strings.Trim(s, "[]")); err == nil {
+		return addr.Unmap().WithZone(""), true
+	}
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap().WithZone(""), true
+	}
+	return netip.Addr{}, false
+}
+
+// unmapPrefix turns an IPv4-mapped IPv6 prefix such as ::ffff:192.0.2.0/120
+// into the IPv4 prefix it covers
+func unmapPrefix(p netip.Prefix) netip.Prefix {
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		return netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p
+}
+
+// addrSet is a set of addresses and prefixes
+type addrSet struct {
+	addrs    map[netip.Addr]struct{}
+	prefixes []netip.Prefix
+}
+
+func newAddrSet() *addrSet {
+	return &addrSet{addrs: make(map[netip.Addr]struct{})}
+}
+
+func (s *addrSet) contains(addr netip.Addr) bool {
+	if _, ok := s.addrs[addr]; ok {
+		return true
+	}
+	for _, p := range s.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *addrSet) len() int {
+	return len(s.addrs) + len(s.prefixes)
+}
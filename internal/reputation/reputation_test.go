@@ -0,0 +1,68 @@
+package reputation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/geoip"
+)
+
+func TestChecker_Flags(t *testing.T) {
+	tor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# Tor exit nodes\n198.51.100.7\n2001:db8::7\n")
+	}))
+	defer tor.Close()
+
+	proxies := filepath.Join(t.TempDir(), "proxies.txt")
+	if err := os.WriteFile(proxies, []byte("203.0.113.0/28\n192.0.2.10:3128 http\n[2001:db8:1::10]:8080\n2001:db8:2::/48\n::ffff:198.51.100.128/121\n"), 0644); err != nil {
+		t.Fatalf("Failed to write proxy list: %v", err)
+	}
+
+	geo, err := geoip.Load(strings.NewReader("192.0.2.0\t192.0.2.255\t16509\tUS\tAMAZON-02\n"))
+	if err != nil {
+		t.Fatalf("Failed to load geoip table: %v", err)
+	}
+
+	checker := NewChecker(&config.ReputationConfig{TorExitList: tor.URL, ProxyList: proxies}, geo)
+	if err := checker.Refresh(context.Background()); err != nil {
+		t.Fatalf("Failed to refresh lists: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want Flags
+	}{
+		{"198.51.100.7:5000", Flags{Tor: true}},
+		{"[2001:db8::7]:5000", Flags{Tor: true}},
+		{"203.0.113.9", Flags{Proxy: true}},
+		{"192.0.2.10", Flags{Datacenter: true, Proxy: true}},
+		{"192.0.2.11", Flags{Datacenter: true}},
+		{"203.0.113.16", Flags{}},
+		{"[2001:db8:1::10]:443", Flags{Proxy: true}},
+		{"[2001:db8:2:ffff::1%eth0]:443", Flags{Proxy: true}},
+		{"2001:db8:3::1", Flags{}},
+		{"[::ffff:198.51.100.7]:5000", Flags{Tor: true}},
+		{"198.51.100.200", Flags{Proxy: true}},
+	}
+	for _, tt := range tests {
+		if got := checker.Flags(tt.ip); got != tt.want {
+			t.Fatalf("Expected %+v for %s, got %+v", tt.want, tt.ip, got)
+		}
+	}
+
+	// A failed refresh keeps the previous lists
+	checker.config.TorExitList = "http://127.0.0.1:1/unreachable"
+	if err := checker.Refresh(context.Background()); err == nil {
+		t.Fatalf("Expected error refreshing from an unreachable list")
+	}
+	if !checker.Flags("198.51.100.7").Tor {
+		t.Fatalf("Expected Tor exit list to survive a failed refresh")
+	}
+}
@@ -0,0 +1,141 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// Policy actions
+const (
+	// ActionNormal serves scanners like any other client
+	ActionNormal = "normal"
+
+	// ActionMinimal answers scanners with the service headers, a fixed
+	// status, and no body
+	ActionMinimal = "minimal"
+
+	// ActionDrop closes the connection without answering
+	ActionDrop = "drop"
+)
+
+// defaultMinimalStatus is the status of minimal answers when none is set
+const defaultMinimalStatus = http.StatusNotFound
+
+// builtin are the User-Agent patterns of well-known research scanners
+var builtin = []struct {
+	name      string
+	userAgent string
+}{
+	{"censys", `CensysInspect`},
+	{"shodan", `(?i)shodan`},
+	{"shadowserver", `(?i)shadowserver`},
+	{"binaryedge", `(?i)binaryedge`},
+	{"internet-measurement", `(?i)internet-measurement\.com`},
+	{"expanse", `(?i)expanse, a palo alto networks company`},
+	{"leakix", `(?i)leakix`},
+}
+
+// Scanner is a known scanner and the policy applied to it
+type Scanner struct {
+	Name       string
+	Action     string
+	Status     int
+	MuteAlerts bool
+	userAgent  *regexp.Regexp
+}
+
+// Set matches requests against known scanners
+type Set struct {
+	scanners []*Scanner
+}
+
+// NewSet builds the built-in scanners and the configured ones, applying the
+// default policy and per-scanner overrides. Policies naming a built-in
+// scanner override it; others add a scanner and must give a User-Agent.
+func NewSet(cfg *config.ScannersConfig) (*Set, error) {
+	set := &Set{scanners: make([]*Scanner, 0, len(builtin)+len(cfg.Policies))}
+	byName := make(map[string]*Scanner)
+
+	for _, b := range builtin {
+		s := &Scanner{
+			Name:       b.name,
+			Action:     cfg.Action,
+			Status:     cfg.Status,
+			MuteAlerts: cfg.ExcludeFromAlerts,
+			userAgent:  regexp.MustCompile(b.userAgent),
+		}
+		set.scanners = append(set.scanners, s)
+		byName[s.Name] = s
+	}
+
+	for _, p := range cfg.Policies {
+		s, ok := byName[p.Name]
+		if !ok {
+			if p.UserAgent == "" {
+				return nil, fmt.Errorf("scanner %s: userAgent is required for scanners that are not built in", p.Name)
+			}
+			s = &Scanner{Name: p.Name, Action: cfg.Action, Status: cfg.Status, MuteAlerts: cfg.ExcludeFromAlerts}
+			set.scanners = append(set.scanners, s)
+			byName[s.Name] = s
+		}
+
+		if p.UserAgent != "" {
+			re, err := regexp.Compile(p.UserAgent)
+			if err != nil {
+				return nil, fmt.Errorf("scanner %s: invalid userAgent: %w", p.Name, err)
+			}
+			s.userAgent = re
+		}
+		if p.Action != "" {
+			s.Action = p.Action
+		}
+		if p.Status != 0 {
+			s.Status = p.Status
+		}
+		if p.ExcludeFromAlerts != nil {
+			s.MuteAlerts = *p.ExcludeFromAlerts
+		}
+	}
+
+	for _, s := range set.scanners {
+		if s.Action == "" {
+			s.Action = ActionNormal
+		}
+		if s.Status == 0 {
+			s.Status = defaultMinimalStatus
+		}
+	}
+
+	return set, nil
+}
+
+// Match returns the scanner a request comes from, or nil
+func (set *Set) Match(r *http.Request) *Scanner {
+	ua := r.Header.Get("User-Agent")
+	if ua == "" {
+		return nil
+	}
+	for _, s := range set.scanners {
+		if s.userAgent.MatchString(ua) {
+			return s
+		}
+	}
+	return nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the scanner a request comes from
+func NewContext(ctx context.Context, s *Scanner) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the scanner stored in ctx, or nil
+func FromContext(ctx context.Context) *Scanner {
+	s, _ := ctx.Value(contextKey{}).(*Scanner)
+	return s
+}
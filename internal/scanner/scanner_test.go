@@ -0,0 +1,66 @@
+package scanner
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestSet_Match(t *testing.T) {
+	muted := false
+	set, err := NewSet(&config.ScannersConfig{
+		Action:            ActionMinimal,
+		ExcludeFromAlerts: true,
+		Policies: []config.ScannerPolicy{
+			{Name: "shodan", Action: ActionDrop, ExcludeFromAlerts: &muted},
+			{Name: "acme", UserAgent: `AcmeScan/\d`, Status: 204},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scanner set: %v", err)
+	}
+
+	tests := []struct {
+		userAgent string
+		name      string
+		action    string
+		status    int
+		mute      bool
+	}{
+		{"Mozilla/5.0 (compatible; CensysInspect/1.1; +https://about.censys.io/)", "censys", ActionMinimal, 404, true},
+		{"Mozilla/5.0 (compatible; Shodan)", "shodan", ActionDrop, 404, false},
+		{"AcmeScan/2", "acme", ActionMinimal, 204, true},
+		{"curl/8.5.0", "", "", 0, false},
+		{"", "", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.userAgent != "" {
+			r.Header.Set("User-Agent", tt.userAgent)
+		}
+		s := set.Match(r)
+		if tt.name == "" {
+			if s != nil {
+				t.Fatalf("Expected %q not to match, got %s", tt.userAgent, s.Name)
+			}
+			continue
+		}
+		if s == nil {
+			t.Fatalf("Expected %q to match %s", tt.userAgent, tt.name)
+		}
+		if s.Name != tt.name || s.Action != tt.action || s.Status != tt.status || s.MuteAlerts != tt.mute {
+			t.Fatalf("Expected %s/%s/%d/%v for %q, got %+v", tt.name, tt.action, tt.status, tt.mute, tt.userAgent, s)
+		}
+	}
+}
+
+func TestNewSet_RequiresUserAgent(t *testing.T) {
+	_, err := NewSet(&config.ScannersConfig{
+		Policies: []config.ScannerPolicy{{Name: "unknown"}},
+	})
+	if err == nil {
+		t.Fatal("Expected an error for a new scanner without a userAgent")
+	}
+}
@@ -0,0 +1,274 @@
+package selftest
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// Names of the honeypot-detection heuristics
+const (
+	CheckTimingUniformity = "timing-uniformity"
+	CheckContentLength    = "identical-content-length"
+	CheckDefaultErrors    = "default-error-pages"
+	CheckMalformedRequest = "malformed-request"
+	CheckServerHeader     = "server-header"
+)
+
+// timingSamples is the number of requests used to measure response timing
+const timingSamples = 20
+
+// minTimingVariation is the coefficient of variation below which response
+// times are considered suspiciously uniform
+const minTimingVariation = 0.05
+
+// goDefaultBodies are error bodies written by Go's net/http package
+var goDefaultBodies = []string{
+	"404 page not found\n",
+	"405 method not allowed\n",
+	"Not Found\n",
+	"Method Not Allowed\n",
+	"Internal Server Error\n",
+}
+
+// Detection is the outcome of a single honeypot-detection heuristic
+type Detection struct {
+	Address string
+	Port    int
+	Check   string
+	Passed  bool
+	Detail  string
+}
+
+// RunDetection runs known honeypot-detection heuristics against every
+// configured port and reports which checks pass or fail
+func (c *Checker) RunDetection(ctx context.Context) []Detection {
+	detections := make([]Detection, 0)
+
+	for addr, svcCfgs := range c.config.GetServicesByListener() {
+		if !svcCfgs[0].SpeaksHTTP() {
+			continue
+		}
+		detections = append(detections,
+			c.checkTimingUniformity(ctx, addr),
+			c.checkContentLength(ctx, addr),
+			c.checkDefaultErrors(ctx, addr),
+			c.checkMalformedRequest(ctx, addr),
+			c.checkServerHeader(ctx, addr),
+		)
+	}
+
+	return detections
+}
+
+// fetch performs a request and returns the response with its body read
+func (c *Checker) fetch(ctx context.Context, method string, addr config.ListenAddr, path string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL(addr)+path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Host = c.hostname(addr)
+	req.Header.Set("User-Agent", scannerUserAgents[0])
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// checkTimingUniformity flags listeners whose response times barely vary,
+// as real backends show jitter from disk, scheduling, and processing
+func (c *Checker) checkTimingUniformity(ctx context.Context, addr config.ListenAddr) Detection {
+	d := Detection{Address: addr.IP, Port: addr.Port, Check: CheckTimingUniformity}
+
+	samples := make([]float64, 0, timingSamples)
+	for i := 0; i < timingSamples; i++ {
+		start := time.Now()
+		if _, _, err := c.fetch(ctx, http.MethodGet, addr, "/"); err != nil {
+			d.Detail = fmt.Sprintf("request failed: %v", err)
+			return d
+		}
+		samples = append(samples, float64(time.Since(start)))
+	}
+
+	mean, stddev := meanStddev(samples)
+	cv := 0.0
+	if mean > 0 {
+		cv = stddev / mean
+	}
+
+	d.Passed = cv >= minTimingVariation
+	d.Detail = fmt.Sprintf("mean %s, stddev %s, variation %.3f",
+		time.Duration(mean).Round(time.Microsecond), time.Duration(stddev).Round(time.Microsecond), cv)
+	return d
+}
+
+// checkContentLength flags listeners that answer every kind of request with
+// the exact same body length
+func (c *Checker) checkContentLength(ctx context.Context, addr config.ListenAddr) Detection {
+	d := Detection{Address: addr.IP, Port: addr.Port, Check: CheckContentLength}
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/"},
+		{http.MethodGet, "/" + randomHex(4)},
+		{http.MethodGet, "/" + randomHex(16) + "/" + randomHex(16)},
+		{http.MethodPost, "/" + randomHex(8)},
+		{http.MethodOptions, "/"},
+		{http.MethodDelete, "/"},
+	}
+
+	lengths := make(map[int]bool)
+	for _, req := range requests {
+		_, body, err := c.fetch(ctx, req.method, addr, req.path)
+		if err != nil {
+			d.Detail = fmt.Sprintf("%s %s failed: %v", req.method, req.path, err)
+			return d
+		}
+		lengths[len(body)] = true
+	}
+
+	d.Passed = len(lengths) > 1
+	if d.Passed {
+		d.Detail = fmt.Sprintf("%d distinct body lengths across %d requests", len(lengths), len(requests))
+	} else {
+		for l := range lengths {
+			d.Detail = fmt.Sprintf("all %d requests returned a %d byte body", len(requests), l)
+		}
+	}
+	return d
+}
+
+// checkDefaultErrors flags listeners that expose Go's built-in error pages
+func (c *Checker) checkDefaultErrors(ctx context.Context, addr config.ListenAddr) Detection {
+	d := Detection{Address: addr.IP, Port: addr.Port, Check: CheckDefaultErrors, Passed: true}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, "PROPFIND"} {
+		path := "/" + randomHex(8)
+		resp, body, err := c.fetch(ctx, method, addr, path)
+		if err != nil {
+			d.Passed = false
+			d.Detail = fmt.Sprintf("%s %s failed: %v", method, path, err)
+			return d
+		}
+
+		for _, def := range goDefaultBodies {
+			if string(body) == def {
+				d.Passed = false
+				d.Detail = fmt.Sprintf("%s %s returned Go default body %q", method, path, strings.TrimSpace(def))
+				return d
+			}
+		}
+
+		if resp.Header.Get("X-Content-Type-Options") == "nosniff" &&
+			resp.Header.Get("Content-Type") == "text/plain; charset=utf-8" {
+			d.Passed = false
+			d.Detail = fmt.Sprintf("%s %s returned Go http.Error headers", method, path)
+			return d
+		}
+	}
+
+	d.Detail = "no Go default error pages observed"
+	return d
+}
+
+// checkMalformedRequest sends a request with an invalid header line and
+// flags Go's distinctive 400 response
+func (c *Checker) checkMalformedRequest(ctx context.Context, addr config.ListenAddr) Detection {
+	d := Detection{Address: addr.IP, Port: addr.Port, Check: CheckMalformedRequest}
+
+	target := c.target(addr)
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if c.secure(addr) {
+		conn, err = tls.DialWithDialer(dialer, "tcp", target, &tls.Config{InsecureSkipVerify: true})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", target)
+	}
+	if err != nil {
+		d.Detail = fmt.Sprintf("dial failed: %v", err)
+		return d
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	host, _, _ := net.SplitHostPort(target)
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\nThis is not a header\r\n\r\n", host)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		d.Detail = fmt.Sprintf("no response to malformed request: %v", err)
+		return d
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	// Go writes its own bare 400 response, without Date or Server headers
+	// and with the reason phrase as a plain text body
+	goResponse := resp.StatusCode == http.StatusBadRequest &&
+		strings.HasPrefix(string(body), "400 Bad Request") &&
+		resp.Header.Get("Date") == "" &&
+		resp.Header.Get("Server") == ""
+
+	d.Passed = !goResponse
+	d.Detail = fmt.Sprintf("status %q, body %q", resp.Status, strings.TrimSpace(string(body)))
+	return d
+}
+
+// checkServerHeader flags listeners that do not send a Server header
+func (c *Checker) checkServerHeader(ctx context.Context, addr config.ListenAddr) Detection {
+	d := Detection{Address: addr.IP, Port: addr.Port, Check: CheckServerHeader}
+
+	resp, _, err := c.fetch(ctx, http.MethodGet, addr, "/")
+	if err != nil {
+		d.Detail = fmt.Sprintf("request failed: %v", err)
+		return d
+	}
+
+	server := resp.Header.Get("Server")
+	d.Passed = server != ""
+	if d.Passed {
+		d.Detail = fmt.Sprintf("Server: %s", server)
+	} else {
+		d.Detail = "no Server header"
+	}
+	return d
+}
+
+func meanStddev(samples []float64) (float64, float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, s := range samples {
+		sum += s
+	}
+	mean := sum / float64(len(samples))
+
+	var sq float64
+	for _, s := range samples {
+		sq += (s - mean) * (s - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(samples)))
+}
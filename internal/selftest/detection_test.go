@@ -0,0 +1,92 @@
+package selftest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func newTestChecker(t *testing.T, handler http.Handler) (*Checker, config.ListenAddr) {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	host, portStr, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to parse test server address: %v", err)
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	checker := NewChecker(&config.Config{})
+	checker.SetHost(host)
+	return checker, config.ListenAddr{Port: port}
+}
+
+func TestCheckDefaultErrors_GoDefault404(t *testing.T) {
+	checker, addr := newTestChecker(t, http.NotFoundHandler())
+
+	d := checker.checkDefaultErrors(context.Background(), addr)
+	if d.Passed {
+		t.Fatalf("Expected Go default 404 to be detected, got pass: %s", d.Detail)
+	}
+}
+
+func TestCheckDefaultErrors_CustomPage(t *testing.T) {
+	checker, addr := newTestChecker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<html><body><h1>Not Found</h1></body></html>\n"))
+	}))
+
+	d := checker.checkDefaultErrors(context.Background(), addr)
+	if !d.Passed {
+		t.Fatalf("Expected custom error page to pass, got fail: %s", d.Detail)
+	}
+}
+
+func TestCheckContentLength_Identical(t *testing.T) {
+	checker, addr := newTestChecker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("same body"))
+	}))
+
+	d := checker.checkContentLength(context.Background(), addr)
+	if d.Passed {
+		t.Fatalf("Expected identical body lengths to be detected, got pass: %s", d.Detail)
+	}
+}
+
+func TestCheckMalformedRequest_GoServer(t *testing.T) {
+	checker, addr := newTestChecker(t, http.NotFoundHandler())
+
+	d := checker.checkMalformedRequest(context.Background(), addr)
+	if d.Passed {
+		t.Fatalf("Expected Go 400 response to be detected, got pass: %s", d.Detail)
+	}
+}
+
+func TestCheckServerHeader(t *testing.T) {
+	checker, addr := newTestChecker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.25.3")
+	}))
+
+	d := checker.checkServerHeader(context.Background(), addr)
+	if !d.Passed {
+		t.Fatalf("Expected Server header check to pass, got fail: %s", d.Detail)
+	}
+}
+
+func TestMeanStddev(t *testing.T) {
+	mean, stddev := meanStddev([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	if mean != 5 {
+		t.Fatalf("Expected mean 5, got %f", mean)
+	}
+	if stddev != 2 {
+		t.Fatalf("Expected stddev 2, got %f", stddev)
+	}
+}
@@ -0,0 +1,302 @@
+package selftest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/logging"
+	"github.com/davidthuman/service-spoof/internal/service"
+	"github.com/davidthuman/service-spoof/internal/templates"
+)
+
+// selftestLog logs the results of each check
+var selftestLog = logging.Logger("selftest")
+
+// scannerUserAgents are sent in turn so probes resemble common scanners
+var scannerUserAgents = []string{
+	"curl/8.5.0",
+	"Mozilla/5.0 zgrab/0.x",
+}
+
+// Result describes the outcome of a single probe against a local listener
+type Result struct {
+	Address  string
+	Port     int
+	Service  string
+	Method   string
+	Path     string
+	Problems []string
+}
+
+// OK reports whether the probe matched the expected profile
+func (r Result) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Checker probes the spoof's own listeners and compares responses against
+// the profile described by the configuration
+type Checker struct {
+	config *config.Config
+	host   string
+	client *http.Client
+}
+
+// NewChecker creates a new self-test checker
+func NewChecker(cfg *config.Config) *Checker {
+	return &Checker{
+		config: cfg,
+		host:   "127.0.0.1",
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				// The spoof's certificate is not expected to be trusted locally
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				DisableKeepAlives: true,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Start runs the check on the given interval until the context is cancelled,
+// logging an alert for every probe that does not match its profile
+func (c *Checker) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			failed := 0
+			for _, res := range c.Run(ctx) {
+				if !res.OK() {
+					failed++
+					selftestLog.Warn("ALERT self-test", "addr", config.ListenAddr{IP: res.Address, Port: res.Port}.String(), "service", res.Service,
+						"method", res.Method, "path", res.Path, "problems", strings.Join(res.Problems, "; "))
+				}
+			}
+			if failed == 0 {
+				selftestLog.Info("self-test passed, all listeners match their profiles")
+			}
+		}
+	}
+}
+
+// Run probes every configured port once and returns the results
+func (c *Checker) Run(ctx context.Context) []Result {
+	results := make([]Result, 0)
+
+	// Services that cannot read their templates still answer, so a root that
+	// fails to open is reported as unreadable templates
+	dir, err := templates.Open(c.config.Templates.GetRoot())
+	if err != nil {
+		selftestLog.Error("failed to open templates", "err", err)
+	}
+	defer dir.Close()
+
+	for addr, svcCfgs := range c.config.GetServicesByListener() {
+		// SSH services are not probed, since they do not speak HTTP
+		if len(svcCfgs) == 0 || !svcCfgs[0].SpeaksHTTP() {
+			continue
+		}
+
+		// The manager serves the first service configured on a port
+		svcCfg := svcCfgs[0]
+		svc, err := service.NewService(&svcCfg, dir)
+		if err != nil {
+			results = append(results, Result{
+				Address:  addr.IP,
+				Port:     addr.Port,
+				Service:  svcCfg.Name,
+				Problems: []string{fmt.Sprintf("failed to create service: %v", err)},
+			})
+			continue
+		}
+
+		for i, probe := range probesFor(&svcCfg) {
+			ua := scannerUserAgents[i%len(scannerUserAgents)]
+			results = append(results, c.probe(ctx, addr, svc, dir, probe.method, probe.path, ua))
+		}
+	}
+
+	return results
+}
+
+type probe struct {
+	method string
+	path   string
+}
+
+// probesFor returns a probe for each concrete endpoint path, plus a random
+// path that exercises the not-found handling of the service. Canary
+// endpoints are left out, since probing them would raise real alerts, and
+// so are WebSocket endpoints, which answer an upgrade rather than a page.
+func probesFor(svcCfg *config.ServiceConfig) []probe {
+	probes := make([]probe, 0)
+	for _, ep := range svcCfg.Endpoints {
+		if strings.ContainsAny(ep.Path, "*?[") || ep.Type == config.EndpointTypeCanary || ep.Type == config.EndpointTypeWebSocket {
+			continue
+		}
+		method := ep.Method
+		if method == "*" {
+			method = http.MethodGet
+		}
+		probes = append(probes, probe{method: method, path: ep.Path})
+	}
+	probes = append(probes, probe{method: http.MethodGet, path: "/" + randomHex(8)})
+	return probes
+}
+
+func (c *Checker) probe(ctx context.Context, addr config.ListenAddr, svc service.Service, dir *templates.Dir, method, path, userAgent string) Result {
+	res := Result{Address: addr.IP, Port: addr.Port, Service: svc.Name(), Method: method, Path: path}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL(addr)+path, nil)
+	if err != nil {
+		res.Problems = append(res.Problems, fmt.Sprintf("failed to build request: %v", err))
+		return res
+	}
+	req.Host = c.hostname(addr)
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "*/*")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		res.Problems = append(res.Problems, fmt.Sprintf("request failed: %v", err))
+		return res
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		res.Problems = append(res.Problems, fmt.Sprintf("failed to read body: %v", err))
+		return res
+	}
+
+	res.Problems = append(res.Problems, compare(svc, dir, method, path, resp, body)...)
+	return res
+}
+
+// SetHost changes the host probes are sent to, which defaults to 127.0.0.1
+func (c *Checker) SetHost(host string) {
+	c.host = host
+}
+
+// baseURL returns the scheme, host, and port a listener is reachable at
+func (c *Checker) baseURL(addr config.ListenAddr) string {
+	scheme := "http"
+	if c.secure(addr) {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, c.target(addr))
+}
+
+// target returns the host and port a listener is reachable at. Listeners
+// bound to an alias address are probed there rather than at the checker host,
+// and single-family listeners on the loopback of their own family.
+func (c *Checker) target(addr config.ListenAddr) string {
+	host := addr.IP
+	if host == "" {
+		host = c.host
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			switch addr.Family {
+			case config.FamilyIPv4:
+				host = "127.0.0.1"
+			case config.FamilyIPv6:
+				host = "::1"
+			}
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(addr.Port))
+}
+
+// hostname returns the Host header to probe a listener with, which is the
+// hostname of the personality serving it or empty for the target address
+func (c *Checker) hostname(addr config.ListenAddr) string {
+	svcs := c.config.GetServicesByListener()[addr]
+	if len(svcs) == 0 {
+		return ""
+	}
+	return svcs[0].Hostname
+}
+
+// secure reports whether a listener serves TLS, using the identity of the
+// default service on it
+func (c *Checker) secure(addr config.ListenAddr) bool {
+	svcs := c.config.GetServicesByListener()[addr]
+	if len(svcs) == 0 {
+		return c.config.Tls.CertFilePath != ""
+	}
+	return c.config.GetTls(&svcs[0]).CertFilePath != ""
+}
+
+// compare checks a response against what the service profile should serve
+// and against well-known tells of a Go net/http server
+func compare(svc service.Service, dir *templates.Dir, method, path string, resp *http.Response, body []byte) []string {
+	problems := make([]string, 0)
+
+	endpoint, matched := svc.Router().Match(method, path)
+	if !matched {
+		// Unmatched requests fall through to the generic Go error page,
+		// which is a strong honeypot tell
+		problems = append(problems, "no endpoint matches, Go default error page is served")
+		return problems
+	}
+
+	if resp.StatusCode != endpoint.Status {
+		problems = append(problems, fmt.Sprintf("status: expected %d, got %d", endpoint.Status, resp.StatusCode))
+	}
+
+	// Endpoint headers override service headers
+	expected := make(map[string]string)
+	for k, v := range svc.Headers() {
+		expected[http.CanonicalHeaderKey(k)] = v
+	}
+	for k, v := range endpoint.Headers {
+		expected[http.CanonicalHeaderKey(k)] = v
+	}
+	for k, v := range expected {
+		if got := resp.Header.Get(k); got != v {
+			problems = append(problems, fmt.Sprintf("header %s: expected %q, got %q", k, v, got))
+		}
+	}
+
+	if _, ok := expected["X-Content-Type-Options"]; !ok && resp.Header.Get("X-Content-Type-Options") == "nosniff" {
+		problems = append(problems, "unexpected X-Content-Type-Options header from Go http.Error")
+	}
+
+	// Rendered templates differ from the file by design
+	if endpoint.Template != "" && endpoint.Render == nil {
+		want, err := dir.ReadFile(endpoint.Template)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("cannot read template %s: %v", endpoint.Template, err))
+		} else if string(want) != string(body) {
+			problems = append(problems, fmt.Sprintf("body differs from template %s", endpoint.Template))
+		}
+	}
+
+	if string(body) == "404 page not found\n" {
+		problems = append(problems, "body is the Go default 404 page")
+	}
+
+	return problems
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,27 @@
+package selftest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestProbesFor_SkipsCanaries(t *testing.T) {
+	probes := probesFor(&config.ServiceConfig{Endpoints: []config.EndpointConfig{
+		{Path: "/", Method: "*"},
+		{Path: "/backup.zip", Method: "GET", Type: config.EndpointTypeCanary},
+		{Path: "/ws", Method: "GET", Type: config.EndpointTypeWebSocket},
+		{Path: "/*", Method: "*"},
+	}})
+
+	// The index page, then the random not-found path
+	if len(probes) != 2 || probes[0].path != "/" || probes[0].method != "GET" || !strings.HasPrefix(probes[1].path, "/") {
+		t.Fatalf("Expected only the index and a not-found probe, got %+v", probes)
+	}
+	for _, p := range probes {
+		if p.path == "/backup.zip" || p.path == "/ws" {
+			t.Fatalf("Expected no probe of %s, got %+v", p.path, probes)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+//go:build !httponly
+
+package server
+
+import (
+	"net"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/ftp"
+)
+
+func init() {
+	protocols[config.ServiceTypeFTP] = func(cfg *config.ServiceConfig) protocolHandler {
+		return &ftpHandler{server: ftp.NewServer(cfg.FTP), flavor: cfg.FTP.GetServer()}
+	}
+}
+
+// ftpHandler answers the FTP clients of an ftp service's port
+type ftpHandler struct {
+	server *ftp.Server
+	flavor string
+}
+
+func (h *ftpHandler) Name() string {
+	return "FTP"
+}
+
+func (h *ftpHandler) Describe() string {
+	return "server: " + h.flavor
+}
+
+// Handle answers an FTP session and logs its transcript
+func (h *ftpHandler) Handle(m *Manager, addr config.ListenAddr, conn net.Conn) error {
+	sess := h.server.Handle(conn)
+
+	errText := ""
+	if sess.Err != nil {
+		errText = sess.Err.Error()
+	}
+	for _, c := range sess.Credentials {
+		serverLog.Info("FTP login", "addr", addr.String(), "remote", conn.RemoteAddr().String(), "username", c.Username, "password", c.Password)
+	}
+	serverLog.Info("FTP session", "addr", addr.String(), "remote", conn.RemoteAddr().String(), "commands", sess.Commands, "duration", sess.Duration.Round(time.Millisecond))
+
+	svc := m.services[addr][0]
+	err := m.logger.LogProtocolSession(conn.RemoteAddr().String(), &database.ProtocolSession{
+		Timestamp:   sess.Start,
+		ServerPort:  addr.Port,
+		ServiceName: svc.Name(),
+		ServiceType: svc.Type(),
+		Protocol:    config.ServiceTypeFTP,
+		Credentials: sess.Credentials,
+		Commands:    sess.Commands,
+		Transcript:  sess.Transcript,
+		Duration:    sess.Duration,
+		Error:       errText,
+	})
+	if err != nil {
+		serverLog.Error("failed to log FTP session to database", "err", err)
+	}
+	return sess.Err
+}
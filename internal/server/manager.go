@@ -2,113 +2,600 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"slices"
+	"sort"
 	"sync"
 
+	"github.com/davidthuman/service-spoof/internal/apierror"
+	"github.com/davidthuman/service-spoof/internal/certs"
+	"github.com/davidthuman/service-spoof/internal/cloud"
+	"github.com/davidthuman/service-spoof/internal/cms"
 	"github.com/davidthuman/service-spoof/internal/config"
 	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/engagement"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+	"github.com/davidthuman/service-spoof/internal/geoip"
+	"github.com/davidthuman/service-spoof/internal/handoff"
+	"github.com/davidthuman/service-spoof/internal/logging"
 	"github.com/davidthuman/service-spoof/internal/middleware"
+	"github.com/davidthuman/service-spoof/internal/outage"
+	"github.com/davidthuman/service-spoof/internal/profile"
+	"github.com/davidthuman/service-spoof/internal/ratelimit"
+	"github.com/davidthuman/service-spoof/internal/scanner"
 	"github.com/davidthuman/service-spoof/internal/service"
+	"github.com/davidthuman/service-spoof/internal/ssrf"
+	"github.com/davidthuman/service-spoof/internal/status"
+	"github.com/davidthuman/service-spoof/internal/templates"
+	"github.com/davidthuman/service-spoof/internal/watermark"
+	"github.com/davidthuman/service-spoof/internal/wellknown"
 )
 
-// Manager manages multiple HTTP servers across different ports
+// serverLog logs the listeners and the connections they answer outside
+// HTTP
+var serverLog = logging.Logger("server")
+
+// Manager manages multiple HTTP servers across different ports and addresses
 type Manager struct {
-	servers  map[int]*http.Server
-	services map[int][]service.Service
-	logger   *database.RequestLogger
-	config   *config.Config
+	servers    map[config.ListenAddr]*http.Server
+	tlsServers map[config.ListenAddr]*http.Server
+	services   map[config.ListenAddr][]service.Service
+	guards     map[config.ListenAddr]*guard
+	muxes      map[config.ListenAddr]*config.MuxConfig
+	stats      map[config.ListenAddr]*middleware.ConnStats
+	hits       map[config.ListenAddr]*middleware.HitStats
+	maxConns   map[config.ListenAddr]int
+	connLimit  *middleware.ConnLimit
+	wildcard   map[config.ListenAddr]bool
+	tls        map[config.ListenAddr][]config.TlsConfig
+	redirect   *middleware.RedirectListener
+	redirectLn net.Listener
+	logger     *database.RequestLogger
+	config     *config.Config
+
+	// fingerprints and ja3 hold the JA4 and JA3 fingerprints of recent
+	// connections
+	fingerprints *fingerprint.Store
+	ja3          *fingerprint.Store
+
+	// certificates are the certificates served, as loaded on startup
+	certificates []certs.Certificate
+
+	// catcher answers SSRF payloads, if enabled
+	catcher *ssrf.Catcher
+
+	// counters count the requests of every service for status pages
+	counters *status.Counters
+
+	// limiter degrades the sessions of sources past their engagement
+	// limits, if enabled
+	limiter *engagement.Limiter
+
+	// handoff proxies the requests of sources past the hand-off threshold
+	// to the high-interaction honeypot, if enabled
+	handoff *handoff.Handoff
+
+	// protocols answer the ports of services speaking protocols other than
+	// HTTP, which have no HTTP server
+	protocols map[config.ListenAddr]*protocolListener
+
+	// templates reads response templates from the templates root
+	templates *templates.Dir
+}
+
+// guard holds the malformed request response for a listener's primary service
+type guard struct {
+	response *middleware.BadRequestResponse
+	template string
 }
 
-// NewManager creates a new server manager
-func NewManager(cfg *config.Config, logger *database.RequestLogger) (*Manager, error) {
+// NewManager creates a new server manager. geo may be nil when no GeoIP
+// database is configured.
+func NewManager(cfg *config.Config, logger *database.RequestLogger, geo *geoip.DB) (*Manager, error) {
 	m := &Manager{
-		servers:  make(map[int]*http.Server),
-		services: make(map[int][]service.Service),
-		logger:   logger,
-		config:   cfg,
+		servers:    make(map[config.ListenAddr]*http.Server),
+		tlsServers: make(map[config.ListenAddr]*http.Server),
+		services:   make(map[config.ListenAddr][]service.Service),
+		guards:     make(map[config.ListenAddr]*guard),
+		muxes:      make(map[config.ListenAddr]*config.MuxConfig),
+		stats:      make(map[config.ListenAddr]*middleware.ConnStats),
+		hits:       make(map[config.ListenAddr]*middleware.HitStats),
+		maxConns:   make(map[config.ListenAddr]int),
+		connLimit:  middleware.NewConnLimit(cfg.MaxConnections),
+		wildcard:   make(map[config.ListenAddr]bool),
+		tls:        make(map[config.ListenAddr][]config.TlsConfig),
+		protocols:  make(map[config.ListenAddr]*protocolListener),
+		logger:     logger,
+		config:     cfg,
+
+		fingerprints: fingerprint.NewStore(),
+		ja3:          fingerprint.NewStore(),
+		counters:     status.NewCounters(cfg.Watermark.DeploymentID()),
+		limiter:      engagement.NewLimiter(&cfg.Engagement),
+		handoff:      handoff.New(&cfg.Handoff, database.SessionIdleTimeout),
+	}
+
+	// Hand off sources once their session is deep enough
+	if m.handoff != nil && logger != nil {
+		logger.SetHandoff(m.handoff.Threshold(), func(s database.Session) {
+			m.handoff.Pin(s.SourceIP, s.ID, s.Score, s.LastSeen)
+		})
+		serverLog.Info("handing off sources", "threshold", m.handoff.Threshold())
+	}
+
+	dir, err := templates.Open(cfg.Templates.GetRoot())
+	if err != nil {
+		return nil, err
+	}
+	m.templates = dir
+
+	// Build listener-to-service mapping, answering unused wildcard ports
+	// with a low-interaction generic service
+	listenerMap := cfg.GetServicesByListener()
+	if wildcard := cfg.GetWildcardService(); wildcard != nil {
+		for _, port := range wildcard.Ports {
+			for _, addr := range wildcard.ListenAddrs(port) {
+				listenerMap[addr] = []config.ServiceConfig{*wildcard}
+				m.wildcard[addr] = true
+			}
+		}
+		serverLog.Info("wildcard mode answering unused ports", "ports", len(wildcard.Ports))
 	}
 
-	// Build port-to-service mapping
-	portMap := cfg.GetServicesByPort()
+	// Tag known research scanners so their policy can be applied
+	var scanners *scanner.Set
+	if cfg.Scanners.Enabled {
+		var err error
+		scanners, err = scanner.NewSet(&cfg.Scanners)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create scanner policies: %w", err)
+		}
+	}
 
-	// Create services and servers for each port
-	for port, serviceCfgs := range portMap {
+	// Mark HTML responses with the deployment's token
+	var marker *watermark.Marker
+	if cfg.Watermark.Enabled {
+		var err error
+		marker, err = watermark.NewMarker(cfg.Watermark.DeploymentID(), cfg.Watermark.Methods)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create watermark: %w", err)
+		}
+		serverLog.Info("watermarking HTML responses", "token", marker.Token())
+	}
+
+	// Answer the metadata and redirector paths SSRF payloads target
+	if cfg.SSRF.Enabled {
+		m.catcher = ssrf.NewCatcher(&cfg.SSRF, logger)
+	}
+
+	// Services, handler chains, and malformed request responses are built
+	// once per service and shared by all of its ports, so services spanning
+	// wide port ranges stay cheap
+	instances := make(map[string]service.Service)
+	handlers := make(map[string]http.Handler)
+	guards := make(map[string]*guard)
+
+	// Create services and servers for each listener
+	for addr, serviceCfgs := range listenerMap {
 		services := make([]service.Service, 0)
 
 		// Create service instances
 		for _, svcCfg := range serviceCfgs {
-			svc, err := service.NewService(&svcCfg)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create service %s: %w", svcCfg.Name, err)
+			svc, ok := instances[svcCfg.Name]
+			if !ok {
+				var err error
+				svc, err = service.NewService(&svcCfg, m.templates)
+				if errors.Is(err, service.ErrTemplateMissing) {
+					return nil, fmt.Errorf("failed to create service %s: %w (templates are read from %s)",
+						svcCfg.Name, err, cfg.Templates.GetRoot())
+				}
+				if err != nil {
+					return nil, fmt.Errorf("failed to create service %s: %w", svcCfg.Name, err)
+				}
+				instances[svcCfg.Name] = svc
 			}
 			services = append(services, svc)
 		}
 
-		m.services[port] = services
+		m.services[addr] = services
+		m.stats[addr] = &middleware.ConnStats{}
+		m.hits[addr] = &middleware.HitStats{}
+		m.maxConns[addr] = serviceCfgs[0].MaxConns
+
+		// Services speaking other protocols have their port to themselves
+		if !serviceCfgs[0].SpeaksHTTP() {
+			newHandler, ok := protocols[serviceCfgs[0].Type]
+			if !ok {
+				return nil, fmt.Errorf("service %s: type %s is not compiled into this binary, which was built with the httponly tag",
+					serviceCfgs[0].Name, serviceCfgs[0].Type)
+			}
+			m.protocols[addr] = &protocolListener{handler: newHandler(&serviceCfgs[0])}
+			continue
+		}
 
-		// Create HTTP server for this port
-		mux := http.NewServeMux()
+		m.tls[addr] = listenerTls(cfg, serviceCfgs)
 
-		// For now, use the first service for this port
-		// In a more complex scenario, you could route based on Host header
-		if len(services) > 0 {
-			primaryService := services[0]
+		// The default service answers for the listener, and the listener
+		// settings are its own. Other services sharing the port answer
+		// requests for their virtual hosts.
+		primaryService := services[0]
 
-			// Create middleware chain
-			var handler http.Handler = http.HandlerFunc(primaryService.HandleRequest)
-			handler = middleware.ServiceHeaders(primaryService)(handler)
-			handler = middleware.Logger(logger, primaryService, port)(handler)
+		for i, svc := range services {
+			if _, ok := handlers[svc.Name()]; ok {
+				continue
+			}
+			handler, err := m.newHandler(svc, &serviceCfgs[i], logger, geo, scanners, marker)
+			if err != nil {
+				return nil, err
+			}
+			handlers[svc.Name()] = handler
+		}
+
+		handler := handlers[primaryService.Name()]
+		if len(services) > 1 {
+			router := newVhostRouter(handler)
+			for i, svc := range services[1:] {
+				router.add(serviceCfgs[i+1].Hosts, handlers[svc.Name()])
+			}
+			handler = router
+		}
+
+		// Count what the listener answers, whichever service answers it
+		handler = middleware.CountHits(m.hits[addr])(handler)
+
+		// Build the malformed request response if one is configured
+		if badRequest := serviceCfgs[0].BadRequest; badRequest != nil {
+			g, ok := guards[primaryService.Name()]
+			if !ok {
+				var err error
+				g, err = m.newGuard(primaryService, badRequest)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create bad request response for %s: %w", primaryService.Name(), err)
+				}
+				guards[primaryService.Name()] = g
+			}
+			m.guards[addr] = g
+		} else if prof := profile.New(serviceCfgs[0].Type, serviceCfgs[0].ProfileVersion); prof != nil {
+			m.guards[addr] = &guard{response: newProfileResponse(primaryService, prof, http.StatusBadRequest)}
+		}
+		if g := m.guards[addr]; g != nil {
+			g.response.Order = headerOrder(&serviceCfgs[0])
+		}
+
+		// Write HTTP/1.x responses raw if any service on the listener
+		// orders its headers
+		for i := range serviceCfgs {
+			if headerOrder(&serviceCfgs[i]) != nil {
+				var badRequest *middleware.BadRequestResponse
+				if g := m.guards[addr]; g != nil {
+					badRequest = g.response
+				}
+				handler = middleware.RawResponses(badRequest)(handler)
+				break
+			}
+		}
 
-			mux.Handle("/", handler)
+		if mux := serviceCfgs[0].Mux; mux != nil && mux.Enabled {
+			m.muxes[addr] = mux
 		}
 
-		m.servers[port] = &http.Server{
-			Addr:    fmt.Sprintf(":%d", port),
-			Handler: mux,
+		// Count TLS handshake failures reported by the HTTP server
+		errorLog := log.New(m.stats[addr].HandshakeErrorWriter(logging.Writer(serverLog.With("addr", addr.String()), slog.LevelInfo)), "", 0)
+
+		// Bound how long slow clients can hold connections open
+		timeouts := cfg.GetTimeouts(&serviceCfgs[0])
+
+		protocols := newProtocols(serviceCfgs[0].HTTP2)
+		m.servers[addr] = newServer(addr, handler, errorLog, timeouts, protocols)
+
+		// Dual ports serve HTTPS from a second server on the same listener
+		if serviceCfgs[0].DualScheme {
+			m.tlsServers[addr] = newServer(addr, handler, errorLog, timeouts, protocols)
 		}
 	}
 
+	m.certificates = loadCertificates(m.tls)
+
 	return m, nil
 }
 
+// newHandler builds the middleware chain answering a service's requests
+func (m *Manager) newHandler(svc service.Service, svcCfg *config.ServiceConfig, logger *database.RequestLogger,
+	geo *geoip.DB, scanners *scanner.Set, marker *watermark.Marker) (http.Handler, error) {
+	// Answer handler panics with the service's own 500 page, or that of
+	// the software it emulates
+	prof := profile.New(svcCfg.Type, svcCfg.ProfileVersion)
+	var serverError *middleware.BadRequestResponse
+	if cfg := svcCfg.ServerError; cfg != nil {
+		var err error
+		serverError, err = m.newResponse(svc, cfg, http.StatusInternalServerError)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create server error response for %s: %w", svc.Name(), err)
+		}
+	} else if prof != nil {
+		serverError = newProfileResponse(svc, prof, http.StatusInternalServerError)
+	}
+
+	// Answer requests past the rate limit with a 429 by default
+	limiter := ratelimit.New(svcCfg.RateLimit)
+	var limited *middleware.BadRequestResponse
+	if limiter != nil {
+		cfg := svcCfg.RateLimit.Response
+		if cfg == nil {
+			cfg = &config.ResponseConfig{}
+		}
+		var err error
+		limited, err = m.newResponse(svc, cfg, http.StatusTooManyRequests)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create rate limit response for %s: %w", svc.Name(), err)
+		}
+	}
+
+	// Answer requests failed by a simulated outage with a bare 502 or 503 by
+	// default
+	sim := outage.New(svc.Name(), svcCfg.Outage)
+	var failed *middleware.BadRequestResponse
+	if sim != nil {
+		cfg := svcCfg.Outage.Response
+		if cfg == nil {
+			cfg = &config.ResponseConfig{}
+		}
+		status := map[string]int{
+			config.OutageModeBadGateway:  http.StatusBadGateway,
+			config.OutageModeUnavailable: http.StatusServiceUnavailable,
+		}
+		if code, ok := status[svcCfg.Outage.GetMode()]; ok {
+			var err error
+			failed, err = m.newResponse(svc, cfg, code)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create outage response for %s: %w", svc.Name(), err)
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+
+	// Create middleware chain. The logger takes the port from each
+	// connection, since the chain is shared by every port.
+	var chain http.Handler = http.HandlerFunc(svc.HandleRequest)
+	chain = middleware.Profile(svc, prof)(chain)
+	chain = middleware.APIErrors(svc, apierror.New(svcCfg.API))(chain)
+	chain = middleware.CMS(cms.New(svcCfg))(chain)
+	chain = middleware.WellKnown(wellknown.New(svcCfg))(chain)
+	chain = middleware.SSRF(m.catcher.For(svc.Name()))(chain)
+	chain = middleware.ScannerPolicy(chain)
+	chain = middleware.Watermark(marker)(chain)
+	chain = middleware.ServiceHeaders(svc)(chain)
+	chain = middleware.RateLimitPolicy(limited)(chain)
+	chain = middleware.OutagePolicy(failed)(chain)
+	chain = middleware.HandoffProxy(m.handoff)(chain)
+	chain = middleware.Recover(svc, serverError)(chain)
+	chain = middleware.Cloud(cloud.New(&m.config.Cloud, m.config.GetCloud(svcCfg)))(chain)
+	chain = middleware.Logger(logger, svc, 0)(chain)
+	chain = middleware.Handoff(m.handoff)(chain)
+	chain = middleware.DetectScanners(scanners)(chain)
+	chain = middleware.RateLimit(limiter)(chain)
+	chain = middleware.Outage(sim)(chain)
+	chain = middleware.InspectXML(chain)
+	chain = middleware.CountRequests(m.counters)(chain)
+	chain = middleware.EngagementLimits(m.limiter)(chain)
+	chain = middleware.GeoIP(geo)(chain)
+	chain = middleware.HeaderOrder(svcCfg.HeaderOrder, prof)(chain)
+
+	mux.Handle("/", chain)
+	return mux, nil
+}
+
+// listenerTls returns the TLS identities presented on a listener, the
+// default service's first. Virtual hosts with their own certificate have it
+// served to clients asking for their names.
+func listenerTls(cfg *config.Config, svcCfgs []config.ServiceConfig) []config.TlsConfig {
+	identities := make([]config.TlsConfig, 0, 1)
+	seen := make(map[string]bool)
+	for i := range svcCfgs {
+		tlsCfg := cfg.GetTls(&svcCfgs[i])
+		if i > 0 && (tlsCfg.CertFilePath == "" || seen[tlsCfg.CertFilePath]) {
+			continue
+		}
+		seen[tlsCfg.CertFilePath] = true
+		identities = append(identities, tlsCfg)
+	}
+	return identities
+}
+
+// loadCertificates loads each certificate served by a listener once,
+// recording which listeners serve it. Certificates that fail to load are
+// left out, since their listeners fail to start.
+func loadCertificates(listeners map[config.ListenAddr][]config.TlsConfig) []certs.Certificate {
+	byPath := make(map[string]*certs.Certificate)
+	failed := make(map[string]bool)
+	for addr, identities := range listeners {
+		for _, tlsCfg := range identities {
+			if tlsCfg.CertFilePath == "" {
+				continue
+			}
+			pairs := []certs.Pair{{CertFile: tlsCfg.CertFilePath, KeyFile: tlsCfg.KeyFilePath}}
+			if tlsCfg.CertDir != "" {
+				dirPairs, err := certs.DirPairs(tlsCfg.CertDir)
+				if err != nil {
+					serverLog.Warn("failed to list certificates", "err", err)
+				}
+				pairs = append(pairs, dirPairs...)
+			}
+
+			for _, pair := range pairs {
+				if failed[pair.CertFile] {
+					continue
+				}
+				cert, ok := byPath[pair.CertFile]
+				if !ok {
+					var err error
+					cert, err = certs.Load(pair.CertFile, pair.KeyFile)
+					if err != nil {
+						serverLog.Warn("failed to load certificate", "err", err)
+						failed[pair.CertFile] = true
+						continue
+					}
+					byPath[pair.CertFile] = cert
+				}
+				if !slices.Contains(cert.Listeners, addr.String()) {
+					cert.Listeners = append(cert.Listeners, addr.String())
+				}
+			}
+		}
+	}
+
+	result := make([]certs.Certificate, 0, len(byPath))
+	for _, cert := range byPath {
+		sort.Strings(cert.Listeners)
+		result = append(result, *cert)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
+
+// newServer creates the HTTP server of a listener
+func newServer(addr config.ListenAddr, handler http.Handler, errorLog *log.Logger, timeouts config.TimeoutsConfig, protocols *http.Protocols) *http.Server {
+	return &http.Server{
+		Addr:              addr.String(),
+		Handler:           handler,
+		ErrorLog:          errorLog,
+		ReadHeaderTimeout: timeouts.ReadHeaderTimeout,
+		ReadTimeout:       timeouts.ReadTimeout,
+		WriteTimeout:      timeouts.WriteTimeout,
+		IdleTimeout:       timeouts.IdleTimeout,
+		Protocols:         protocols,
+	}
+}
+
+// newProtocols returns the protocols of a service's servers. Real servers
+// differ here (Apache only speaks h2 with mod_http2 loaded), so a mismatch
+// with the emulated server is a tell. Without HTTP/2 config, h2 is
+// negotiated over TLS as net/http does by default.
+func newProtocols(cfg *config.HTTP2Config) *http.Protocols {
+	p := new(http.Protocols)
+	p.SetHTTP1(true)
+	p.SetHTTP2(cfg == nil || cfg.Enabled)
+	p.SetUnencryptedHTTP2(cfg != nil && cfg.H2C)
+	return p
+}
+
 // Start starts all HTTP servers
 func (m *Manager) Start(ctx context.Context) error {
 	var wg sync.WaitGroup
-	errChan := make(chan error, len(m.servers))
+	errChan := make(chan error, len(m.servers)+len(m.tlsServers)+len(m.protocols)+1)
+
+	// In redirect mode every port is fed by the single listener the
+	// firewall redirects to
+	if m.config.Redirect.Enabled {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", m.config.Redirect.Port))
+		if err != nil {
+			return fmt.Errorf("failed to listen for redirected traffic: %w", err)
+		}
+		serverLog.Info("receiving redirected traffic", "port", m.config.Redirect.Port)
+
+		m.redirectLn = listener
+		m.redirect = middleware.NewRedirectListener(&middleware.RetryListener{Listener: listener})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.redirect.Serve(); err != nil && !errors.Is(err, net.ErrClosed) {
+				errChan <- fmt.Errorf("redirect listener failed: %w", err)
+			}
+		}()
+	}
 
-	for port, server := range m.servers {
+	for addr, server := range m.servers {
 		wg.Add(1)
-		go func(port int, srv *http.Server) {
+		go func(addr config.ListenAddr, srv *http.Server) {
 			defer wg.Done()
 
-			log.Printf("Starting server on port %d (services: %v)", port, m.getServiceNames(port))
+			if !m.wildcard[addr] {
+				serverLog.Info("starting server", "addr", addr.String(), "services", m.getServiceNames(addr))
+			}
 
 			// Configure for TLS-based fingerprinting
-			listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+			listener, err := m.listen(addr)
 			if err != nil {
+				// Wildcard ranges may cover ports other programs own
+				if m.wildcard[addr] {
+					serverLog.Debug("skipping wildcard listener", "addr", addr.String(), "err", err)
+					return
+				}
 				errChan <- err
+				return
 			}
 			defer listener.Close()
 
-			// Wrap the listener to intercept connections
-			wrappedListener := &middleware.TlsClientHelloListener{listener}
+			// Count connections and enforce the listener's connection limit
+			listener = &middleware.StatsListener{
+				Listener: listener,
+				Stats:    m.stats[addr],
+				MaxConns: m.maxConns[addr],
+				Limit:    m.connLimit,
+			}
 
-			// Pass connection fingerprint to request
-			srv.ConnContext = middleware.ConnContextFingerprint
+			// Sniff each connection's protocol so non-HTTP clients can be
+			// answered by their own handlers, and so dual ports can split
+			// plaintext and TLS clients between two servers
+			tlsSrv, dual := m.tlsServers[addr]
+			muxCfg, muxed := m.muxes[addr]
+			if muxed || dual {
+				web, secure := m.muxListener(addr, listener, muxCfg, dual)
+				listener = web
+
+				if dual {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if err := m.serveTLS(addr, tlsSrv, secure); err != nil && err != http.ErrServerClosed {
+							errChan <- fmt.Errorf("tls server on %s failed: %w", addr, err)
+						}
+					}()
+				}
+			}
 
-			if m.config.Tls.CertFilePath != "" {
-				err = srv.ServeTLS(wrappedListener, m.config.Tls.CertFilePath, m.config.Tls.KeyFilePath)
+			if m.tls[addr][0].CertFilePath != "" && !dual {
+				err = m.serveTLS(addr, srv, listener)
 			} else {
-				err = srv.Serve(wrappedListener)
+				err = m.serve(addr, srv, listener)
 			}
 
 			if err != nil && err != http.ErrServerClosed {
-				errChan <- fmt.Errorf("server on port %d failed: %w", port, err)
+				errChan <- fmt.Errorf("server on %s failed: %w", addr, err)
 			}
-		}(port, server)
+		}(addr, server)
+	}
+
+	for addr, pl := range m.protocols {
+		wg.Add(1)
+		go func(addr config.ListenAddr, pl *protocolListener) {
+			defer wg.Done()
+
+			serverLog.Info("starting server", "protocol", pl.handler.Name(), "addr", addr.String(), "services", m.getServiceNames(addr), "handler", pl.handler.Describe())
+
+			listener, err := m.listen(addr)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			listener = &middleware.StatsListener{
+				Listener: listener,
+				Stats:    m.stats[addr],
+				MaxConns: m.maxConns[addr],
+				Limit:    m.connLimit,
+			}
+
+			if err := m.serveProtocol(addr, pl, listener); err != nil {
+				errChan <- fmt.Errorf("%s server on %s failed: %w", pl.handler.Name(), addr, err)
+			}
+		}(addr, pl)
 	}
 
 	// Wait for context cancellation or error
@@ -125,22 +612,108 @@ func (m *Manager) Start(ctx context.Context) error {
 	return nil
 }
 
+// listen opens the listener for an address, which in redirect mode is fed by
+// the shared redirect listener. Accept errors such as running out of file
+// descriptors are retried rather than stopping the listener.
+func (m *Manager) listen(addr config.ListenAddr) (net.Listener, error) {
+	if m.redirect != nil {
+		return m.redirect.Listen(addr.Host(), addr.Port), nil
+	}
+	listener, err := net.Listen(addr.Network(), addr.String())
+	if err != nil {
+		return nil, err
+	}
+	return &middleware.RetryListener{Listener: listener}, nil
+}
+
+// serve serves plaintext HTTP, guarding the listener against malformed and
+// non-HTTP requests
+func (m *Manager) serve(addr config.ListenAddr, srv *http.Server, listener net.Listener) error {
+	listener = m.guardListener(addr, listener, m.guards[addr], srv.Protocols.UnencryptedHTTP2())
+
+	// Wrap the listener to intercept connections
+	wrappedListener := &middleware.TlsClientHelloListener{Listener: listener, Store: m.fingerprints, JA3Store: m.ja3}
+
+	// Pass connection fingerprint to request
+	srv.ConnContext = middleware.ConnContextFingerprint
+
+	return srv.Serve(wrappedListener)
+}
+
+// serveTLS serves HTTPS. The listener is left unguarded, since net/http only
+// negotiates TLS features on an unwrapped *tls.Conn, but connections that
+// do not start with a TLS handshake are still logged.
+func (m *Manager) serveTLS(addr config.ListenAddr, srv *http.Server, listener net.Listener) error {
+	wrappedListener := &middleware.TlsClientHelloListener{
+		Listener: listener,
+		OnNonTLS: func(conn net.Conn, raw []byte, protocol string) {
+			m.logNonHTTP(addr, conn, raw, protocol, http.StatusBadRequest, "",
+				fmt.Errorf("non-TLS data (%s)", protocol))
+		},
+		Store:    m.fingerprints,
+		JA3Store: m.ja3,
+	}
+
+	srv.ConnContext = middleware.ConnContextFingerprint
+
+	// Services aliased to their own address may present their own identity
+	identities := m.tls[addr]
+	if len(identities) == 1 && identities[0].CertDir == "" {
+		return srv.ServeTLS(wrappedListener, identities[0].CertFilePath, identities[0].KeyFilePath)
+	}
+
+	// Virtual hosts with their own certificates, and the certificates of
+	// their directories after them, are chosen by SNI, falling back to the
+	// default service's
+	var pairs, dirPairs []certs.Pair
+	for _, identity := range identities {
+		pairs = append(pairs, certs.Pair{CertFile: identity.CertFilePath, KeyFile: identity.KeyFilePath})
+		if identity.CertDir != "" {
+			found, err := certs.DirPairs(identity.CertDir)
+			if err != nil {
+				return err
+			}
+			dirPairs = append(dirPairs, found...)
+		}
+	}
+	var certificates []tls.Certificate
+	for _, pair := range append(pairs, dirPairs...) {
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate %s: %w", pair.CertFile, err)
+		}
+		certificates = append(certificates, cert)
+	}
+	selector, err := certs.NewSelector(certificates)
+	if err != nil {
+		return fmt.Errorf("failed to select certificates: %w", err)
+	}
+	srv.TLSConfig = &tls.Config{GetCertificate: selector.GetCertificate}
+	return srv.ServeTLS(wrappedListener, "", "")
+}
+
 // Shutdown gracefully shuts down all servers
 func (m *Manager) Shutdown(ctx context.Context) error {
 	var wg sync.WaitGroup
-	errChan := make(chan error, len(m.servers))
+	errChan := make(chan error, len(m.servers)+len(m.tlsServers))
 
-	for port, server := range m.servers {
+	for addr, server := range m.servers {
 		wg.Add(1)
-		go func(port int, srv *http.Server) {
+		go func(addr config.ListenAddr, srv *http.Server) {
 			defer wg.Done()
 
-			log.Printf("Shutting down server on port %d", port)
+			serverLog.Info("shutting down server", "addr", addr.String())
 
 			if err := srv.Shutdown(ctx); err != nil {
-				errChan <- fmt.Errorf("failed to shutdown server on port %d: %w", port, err)
+				errChan <- fmt.Errorf("failed to shutdown server on %s: %w", addr, err)
 			}
-		}(port, server)
+
+			if tlsSrv, ok := m.tlsServers[addr]; ok {
+				if err := tlsSrv.Shutdown(ctx); err != nil {
+					errChan <- fmt.Errorf("failed to shutdown tls server on %s: %w", addr, err)
+				}
+			}
+		}(addr, server)
 	}
 
 	go func() {
@@ -148,31 +721,196 @@ func (m *Manager) Shutdown(ctx context.Context) error {
 		close(errChan)
 	}()
 
+	for addr, pl := range m.protocols {
+		serverLog.Info("shutting down server", "protocol", pl.handler.Name(), "addr", addr.String())
+		pl.close()
+	}
+
+	if m.redirectLn != nil {
+		m.redirectLn.Close()
+	}
+
+	m.templates.Close()
+
 	// Collect all errors
-	var errors []error
+	var errs []error
 	for err := range errChan {
-		errors = append(errors, err)
+		errs = append(errs, err)
+	}
+	m.handoff.Close()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("shutdown errors: %v", errs)
+	}
+
+	return nil
+}
+
+// GetListenerServiceMap returns a mapping of listen addresses to service names
+func (m *Manager) GetListenerServiceMap() map[config.ListenAddr][]string {
+	result := make(map[config.ListenAddr][]string)
+	for addr := range m.services {
+		result[addr] = m.getServiceNames(addr)
+	}
+	return result
+}
+
+// newGuard builds the malformed request response for a service, layering the
+// configured headers over the service headers
+func (m *Manager) newGuard(svc service.Service, cfg *config.ResponseConfig) (*guard, error) {
+	resp, err := m.newResponse(svc, cfg, http.StatusBadRequest)
+	if err != nil {
+		return nil, err
+	}
+	return &guard{response: resp, template: cfg.Template}, nil
+}
+
+// newResponse builds a fixed response from configuration, with the service
+// headers and the given status if the configuration sets none
+func (m *Manager) newResponse(svc service.Service, cfg *config.ResponseConfig, status int) (*middleware.BadRequestResponse, error) {
+	resp := &middleware.BadRequestResponse{
+		Status:  cfg.Status,
+		Headers: make(map[string]string),
+	}
+	if resp.Status == 0 {
+		resp.Status = status
+	}
+
+	for k, v := range svc.Headers() {
+		resp.Headers[k] = v
+	}
+	for k, v := range cfg.Headers {
+		resp.Headers[k] = v
 	}
 
-	if len(errors) > 0 {
-		return fmt.Errorf("shutdown errors: %v", errors)
+	if cfg.Template != "" {
+		f, err := service.OpenTemplate(m.templates, cfg.Template)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = f.Content
+	}
+
+	return resp, nil
+}
+
+// newProfileResponse builds a fixed response from the default page of a
+// status of the software a service emulates
+func newProfileResponse(svc service.Service, p *profile.Profile, status int) *middleware.BadRequestResponse {
+	resp := &middleware.BadRequestResponse{
+		Status:  status,
+		Headers: make(map[string]string),
+	}
+	for k, v := range svc.Headers() {
+		resp.Headers[k] = v
 	}
 
+	page := p.Page(status, "", resp.Headers["Server"])
+	if page.Server != "" {
+		resp.Headers["Server"] = page.Server
+		delete(resp.Headers, "X-Powered-By")
+	}
+	resp.Headers["Content-Type"] = page.ContentType
+	resp.Body = page.Body
+	return resp
+}
+
+// headerOrder returns the order a service's response headers are written
+// in, configured or that of its profile, or nil if net/http writes them
+func headerOrder(svcCfg *config.ServiceConfig) []string {
+	if len(svcCfg.HeaderOrder) > 0 {
+		return svcCfg.HeaderOrder
+	}
+	if prof := profile.New(svcCfg.Type, svcCfg.ProfileVersion); prof != nil {
+		return prof.HeaderOrder()
+	}
 	return nil
 }
 
-// GetPortServiceMap returns a mapping of ports to service names
-func (m *Manager) GetPortServiceMap() map[int][]string {
-	result := make(map[int][]string)
-	for port := range m.services {
-		result[port] = m.getServiceNames(port)
+// guardListener wraps a listener so malformed and non-HTTP requests are
+// logged with their raw bytes and, if the service configures one, answered
+// with its realistic 400 page
+func (m *Manager) guardListener(addr config.ListenAddr, listener net.Listener, g *guard, h2c bool) net.Listener {
+	gl := &middleware.GuardListener{Listener: listener, AllowHTTP2: h2c}
+
+	status, template := http.StatusBadRequest, ""
+	if g != nil {
+		gl.Response = g.response
+		status, template = g.response.Status, g.template
+	}
+
+	gl.OnMalformed = func(conn net.Conn, raw []byte, protocol string, err error) {
+		m.logNonHTTP(addr, conn, raw, protocol, status, template, err)
+	}
+
+	return gl
+}
+
+// logNonHTTP logs the raw bytes of a connection that did not carry a valid
+// request for the listener's protocol
+func (m *Manager) logNonHTTP(addr config.ListenAddr, conn net.Conn, raw []byte, protocol string, status int, template string, reason error) {
+	serverLog.Info("malformed request", "addr", addr.String(), "remote", conn.RemoteAddr().String(), "reason", reason)
+	m.logRaw(addr, conn, raw, protocol, status, template)
+}
+
+// ListenerStats returns connection statistics for each listener, keyed by
+// its listen address
+func (m *Manager) ListenerStats() map[string]middleware.ListenerStats {
+	result := make(map[string]middleware.ListenerStats)
+	for addr, stats := range m.stats {
+		snapshot := stats.Snapshot()
+		snapshot.MaxConns = m.maxConns[addr]
+		result[addr.String()] = snapshot
+	}
+	return result
+}
+
+// Stats returns what each listener has answered and its connection
+// statistics, the busiest first
+func (m *Manager) Stats() []middleware.PortStats {
+	result := make([]middleware.PortStats, 0, len(m.hits))
+	for addr, hits := range m.hits {
+		stats := hits.Snapshot()
+		stats.Address = addr.String()
+		stats.Services = m.getServiceNames(addr)
+		stats.Listener = m.stats[addr].Snapshot()
+		stats.Listener.MaxConns = m.maxConns[addr]
+		result = append(result, stats)
 	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Requests != result[j].Requests {
+			return result[i].Requests > result[j].Requests
+		}
+		return result[i].Address < result[j].Address
+	})
 	return result
 }
 
-func (m *Manager) getServiceNames(port int) []string {
+// Certificates returns the certificates served by the listeners, as loaded
+// on startup
+func (m *Manager) Certificates() []certs.Certificate {
+	return m.certificates
+}
+
+// Fingerprints returns the store of JA4 fingerprints seen on every listener
+func (m *Manager) Fingerprints() *fingerprint.Store {
+	return m.fingerprints
+}
+
+// SSRFCatcher returns the SSRF catcher, or nil if it is disabled
+func (m *Manager) SSRFCatcher() *ssrf.Catcher {
+	return m.catcher
+}
+
+// JA3Fingerprints returns the store of JA3 fingerprints seen on every
+// listener
+func (m *Manager) JA3Fingerprints() *fingerprint.Store {
+	return m.ja3
+}
+
+func (m *Manager) getServiceNames(addr config.ListenAddr) []string {
 	names := make([]string, 0)
-	for _, svc := range m.services[port] {
+	for _, svc := range m.services[addr] {
 		names = append(names, svc.Name())
 	}
 	return names
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+func TestManager_ClosesSlowClients(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	port := freePort(t)
+	cfg := &config.Config{
+		Services: []config.ServiceConfig{{
+			Name:     "generic",
+			Type:     "generic",
+			Enabled:  true,
+			Ports:    config.PortList{port},
+			Timeouts: &config.TimeoutsConfig{ReadHeaderTimeout: 200 * time.Millisecond},
+			Endpoints: []config.EndpointConfig{
+				{Path: "/*", Method: "*", Status: 200},
+			},
+		}},
+	}
+
+	manager, err := NewManager(cfg, database.NewRequestLogger(db), nil)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	go manager.Start(context.Background())
+	defer manager.Shutdown(context.Background())
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	waitForListener(t, addr)
+
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Send the request line and never finish the headers
+	start := time.Now()
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: spoof.test\r\n")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	for {
+		if _, err = conn.Read(buf); err != nil {
+			break
+		}
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatalf("Expected the server to close the connection, it was still open after %s", time.Since(start))
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Expected the connection closed after the header timeout, took %s", elapsed)
+	}
+}
+
+func TestManager_NegotiatesHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir)
+
+	db, err := database.New(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	logger := database.NewRequestLogger(db)
+
+	endpoints := []config.EndpointConfig{{Path: "/*", Method: "*", Status: 200}}
+	h2Port, h1Port, h2cPort := freePort(t), freePort(t), freePort(t)
+
+	secure, err := NewManager(&config.Config{
+		Tls: config.TlsConfig{CertFilePath: certFile, KeyFilePath: keyFile},
+		Services: []config.ServiceConfig{
+			{Name: "nginx", Type: "generic", Enabled: true, Ports: config.PortList{h2Port}, Endpoints: endpoints},
+			{Name: "apache2", Type: "generic", Enabled: true, Ports: config.PortList{h1Port}, Endpoints: endpoints,
+				HTTP2: &config.HTTP2Config{Enabled: false}},
+		},
+	}, logger, nil)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	go secure.Start(context.Background())
+	defer secure.Shutdown(context.Background())
+
+	plain, err := NewManager(&config.Config{
+		Services: []config.ServiceConfig{
+			{Name: "h2c", Type: "generic", Enabled: true, Ports: config.PortList{h2cPort}, Endpoints: endpoints,
+				HTTP2: &config.HTTP2Config{H2C: true}, BadRequest: &config.ResponseConfig{Status: 400}},
+		},
+	}, logger, nil)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	go plain.Start(context.Background())
+	defer plain.Shutdown(context.Background())
+
+	// Clients only use h2c with prior knowledge when HTTP/1.1 is off
+	h2c := new(http.Protocols)
+	h2c.SetUnencryptedHTTP2(true)
+	clients := map[string]*http.Client{
+		"https": {Timeout: 5 * time.Second, Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		}},
+		"http": {Timeout: 5 * time.Second, Transport: &http.Transport{Protocols: h2c}},
+	}
+
+	cases := []struct {
+		scheme string
+		port   int
+		path   string
+		proto  string
+	}{
+		{"https", h2Port, "/h2", "HTTP/2.0"},
+		{"https", h1Port, "/h1", "HTTP/1.1"},
+		{"http", h2cPort, "/h2c", "HTTP/2.0"},
+	}
+	for _, tc := range cases {
+		host := fmt.Sprintf("127.0.0.1:%d", tc.port)
+		waitForListener(t, host)
+
+		resp, err := clients[tc.scheme].Get(tc.scheme + "://" + host + tc.path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", tc.path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.Proto != tc.proto {
+			t.Fatalf("Expected %s for %s, got %s", tc.proto, tc.path, resp.Proto)
+		}
+
+		// Streams are logged with the same detail as HTTP/1.1 requests
+		var proto, loggedHost, raw string
+		err = db.GetConn().QueryRow(`SELECT protocol, host, raw_request FROM request_logs WHERE path = ?`, tc.path).Scan(&proto, &loggedHost, &raw)
+		if err != nil {
+			t.Fatalf("Failed to query logged request: %v", err)
+		}
+		if proto != tc.proto || loggedHost != host || raw == "" {
+			t.Fatalf("Expected %s request to %s logged, got %s to %s with raw request %q", tc.proto, host, proto, loggedHost, raw)
+		}
+	}
+}
+
+func TestManager_RoutesVirtualHosts(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	port := freePort(t)
+	endpoints := []config.EndpointConfig{{Path: "/*", Method: "*", Status: 200}}
+	service := func(name string, hosts ...string) config.ServiceConfig {
+		return config.ServiceConfig{Name: name, Type: "generic", Enabled: true, Ports: config.PortList{port},
+			Endpoints: endpoints, Headers: map[string]string{"X-Service": name}, Hosts: hosts}
+	}
+	www := service("www")
+	www.Default = true
+	cfg := &config.Config{
+		Services: []config.ServiceConfig{
+			service("intranet", "intranet.corp.test"),
+			service("apps", "*.apps.test"),
+			www,
+		},
+	}
+
+	manager, err := NewManager(cfg, database.NewRequestLogger(db), nil)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	go manager.Start(context.Background())
+	defer manager.Shutdown(context.Background())
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	waitForListener(t, addr)
+
+	cases := map[string]string{
+		"intranet.corp.test":                       "intranet",
+		fmt.Sprintf("INTRANET.corp.test:%d", port): "intranet",
+		"portal.apps.test":                         "apps",
+		"a.portal.apps.test":                       "www",
+		"apps.test":                                "www",
+		addr:                                       "www",
+	}
+	for host, expected := range cases {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/", nil)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", host, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if got := resp.Header.Get("X-Service"); got != expected {
+			t.Fatalf("Expected %s to be answered by %s, got %s", host, expected, got)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/middleware"
+)
+
+const (
+	// defaultMuxTimeout is how long a client may stay silent before it is
+	// treated as waiting for a server banner
+	defaultMuxTimeout = 3 * time.Second
+
+	// bannerReadTimeout bounds how long a handler waits for the client's reply
+	bannerReadTimeout = 10 * time.Second
+
+	// maxCapturedBytes bounds how much a banner handler reads from a client
+	maxCapturedBytes = 64 << 10
+)
+
+// muxListener multiplexes a listener by protocol, returning the
+// listeners the HTTP servers should accept web connections from. On dual
+// ports TLS clients get their own listener; otherwise secure is nil and TLS
+// goes to web. SSH clients and, if a banner is configured, every other
+// protocol are answered directly. cfg may be nil on dual ports without a mux.
+func (m *Manager) muxListener(addr config.ListenAddr, listener net.Listener, cfg *config.MuxConfig, dual bool) (web, secure net.Listener) {
+	if cfg == nil {
+		cfg = &config.MuxConfig{}
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultMuxTimeout
+	}
+
+	mux := middleware.NewProtocolMux(listener, timeout)
+
+	webProtocols := []string{middleware.ProtocolHTTP, middleware.ProtocolHTTP2, middleware.ProtocolText}
+	if dual {
+		secure = mux.Listen(middleware.ProtocolTLS)
+	} else {
+		webProtocols = append(webProtocols, middleware.ProtocolTLS)
+	}
+
+	// Without a banner, anything unrecognised still goes to the plaintext
+	// HTTP server, whose guard logs and rejects it
+	if cfg.Banner != "" {
+		web = mux.Listen(webProtocols...)
+		mux.HandleDefault(m.bannerHandler(addr, cfg.Banner))
+	} else {
+		web = mux.Listen()
+	}
+
+	if cfg.SSH != "" {
+		mux.Handle(middleware.ProtocolSSH, m.bannerHandler(addr, cfg.SSH))
+	}
+
+	go func() {
+		if err := mux.Serve(); err != nil && !errors.Is(err, net.ErrClosed) {
+			serverLog.Error("protocol mux stopped", "addr", addr.String(), "err", err)
+		}
+	}()
+
+	return web, secure
+}
+
+// bannerHandler answers a connection with a raw banner, then logs what the
+// client sent before and after it
+func (m *Manager) bannerHandler(addr config.ListenAddr, banner string) middleware.MuxHandler {
+	if !strings.HasSuffix(banner, "\n") {
+		banner += "\r\n"
+	}
+
+	return func(conn net.Conn, raw []byte, protocol string) {
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte(banner)); err != nil {
+			m.logRaw(addr, conn, raw, protocol, 0, "")
+			return
+		}
+
+		// Read past the bytes already sniffed to capture the client's reply
+		conn.SetReadDeadline(time.Now().Add(bannerReadTimeout))
+		buf := make([]byte, 4096)
+		captured := make([]byte, 0, len(raw))
+		for len(captured) < maxCapturedBytes {
+			n, err := conn.Read(buf)
+			captured = append(captured, buf[:n]...)
+			if err != nil {
+				break
+			}
+		}
+
+		serverLog.Info("answered connection with banner", "protocol", protocol, "addr", addr.String(), "remote", conn.RemoteAddr().String())
+		if len(captured) > 0 && protocol == middleware.ProtocolUnknown {
+			protocol = middleware.GuessProtocol(captured)
+		}
+		m.logRaw(addr, conn, captured, protocol, 0, "")
+	}
+}
+
+// logRaw logs the raw bytes of a non-HTTP connection to the database
+func (m *Manager) logRaw(addr config.ListenAddr, conn net.Conn, raw []byte, protocol string, status int, template string) {
+	svc := m.services[addr][0]
+	err := m.logger.LogMalformed(
+		conn.RemoteAddr().String(),
+		addr.Port,
+		svc.Name(),
+		svc.Type(),
+		status,
+		template,
+		protocol,
+		raw,
+	)
+	if err != nil {
+		serverLog.Error("failed to log connection to database", "protocol", protocol, "err", err)
+	}
+}
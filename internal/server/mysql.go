@@ -0,0 +1,71 @@
+//go:build !httponly
+
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/mysql"
+)
+
+func init() {
+	protocols[config.ServiceTypeMySQL] = func(cfg *config.ServiceConfig) protocolHandler {
+		return &mysqlHandler{server: mysql.NewServer(cfg.MySQL)}
+	}
+}
+
+// mysqlHandler answers the MySQL clients of a mysql service's port
+type mysqlHandler struct {
+	server *mysql.Server
+}
+
+func (h *mysqlHandler) Name() string {
+	return "MySQL"
+}
+
+func (h *mysqlHandler) Describe() string {
+	return "version: " + h.server.Version()
+}
+
+// Handle answers a MySQL login attempt and logs the credentials tried
+func (h *mysqlHandler) Handle(m *Manager, addr config.ListenAddr, conn net.Conn) error {
+	sess := h.server.Handle(conn)
+
+	errText := ""
+	if sess.Err != nil {
+		errText = sess.Err.Error()
+	}
+	var credentials []database.Credential
+	if sess.LoggedIn {
+		credentials = []database.Credential{{Username: sess.Username, Password: sess.Password}}
+		serverLog.Info("MySQL login", "addr", addr.String(), "remote", conn.RemoteAddr().String(),
+			"user", sess.Username, "database", sess.Database, "plugin", sess.Plugin, "client", sess.Attributes["_client_name"])
+	}
+
+	svc := m.services[addr][0]
+	err := m.logger.LogProtocolSession(conn.RemoteAddr().String(), &database.ProtocolSession{
+		Timestamp:   sess.Start,
+		ServerPort:  addr.Port,
+		ServiceName: svc.Name(),
+		ServiceType: svc.Type(),
+		Protocol:    config.ServiceTypeMySQL,
+		Credentials: credentials,
+		Commands:    sess.Packets,
+		Transcript:  sess.Transcript,
+		Duration:    sess.Duration,
+		Error:       errText,
+	})
+	if err != nil {
+		serverLog.Error("failed to log MySQL session to database", "err", err)
+	}
+	// Clients hanging up after the greeting, as port scanners do, did not
+	// fail
+	if errors.Is(sess.Err, io.EOF) {
+		return nil
+	}
+	return sess.Err
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// protocolHandler answers the connections of a service speaking a protocol
+// other than HTTP
+type protocolHandler interface {
+	// Name names the protocol in logs
+	Name() string
+
+	// Describe returns what the service presents, for the startup log
+	Describe() string
+
+	// Handle answers a connection and logs it, leaving it for the caller to
+	// close. It returns why the exchange stopped short, if it did.
+	Handle(m *Manager, addr config.ListenAddr, conn net.Conn) error
+}
+
+// protocols holds the constructors of the protocol handlers compiled into
+// the binary, by service type. Builds tagged httponly leave them all out.
+var protocols = make(map[string]func(*config.ServiceConfig) protocolHandler)
+
+// protocolListener answers the clients of a port whose service speaks a
+// protocol other than HTTP
+type protocolListener struct {
+	handler protocolHandler
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+// serveProtocol accepts connections until the listener is closed, handing
+// each to the service's protocol handler
+func (m *Manager) serveProtocol(addr config.ListenAddr, pl *protocolListener, listener net.Listener) error {
+	pl.mu.Lock()
+	if pl.closed {
+		pl.mu.Unlock()
+		listener.Close()
+		return nil
+	}
+	pl.listener = listener
+	pl.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			pl.mu.Lock()
+			closed := pl.closed
+			pl.mu.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			err := pl.handler.Handle(m, addr, conn)
+			m.hits[addr].Hit(time.Now(), err != nil)
+		}()
+	}
+}
+
+// close stops the listener, leaving connections being answered to finish
+func (pl *protocolListener) close() {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.closed = true
+	if pl.listener != nil {
+		pl.listener.Close()
+	}
+}
@@ -0,0 +1,61 @@
+//go:build !httponly
+
+package server
+
+import (
+	"net"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/redis"
+)
+
+func init() {
+	protocols[config.ServiceTypeRedis] = func(cfg *config.ServiceConfig) protocolHandler {
+		return &redisHandler{server: redis.NewServer(cfg.Redis)}
+	}
+}
+
+// redisHandler answers the Redis clients of a redis service's port
+type redisHandler struct {
+	server *redis.Server
+}
+
+func (h *redisHandler) Name() string {
+	return "Redis"
+}
+
+func (h *redisHandler) Describe() string {
+	return "version: " + h.server.Version()
+}
+
+// Handle answers a Redis client and logs every command it sent
+func (h *redisHandler) Handle(m *Manager, addr config.ListenAddr, conn net.Conn) error {
+	sess := h.server.Handle(conn)
+
+	errText := ""
+	if sess.Err != nil {
+		errText = sess.Err.Error()
+	}
+	for _, cred := range sess.Credentials {
+		serverLog.Info("Redis AUTH", "addr", addr.String(), "remote", conn.RemoteAddr().String(), "user", cred.Username)
+	}
+
+	svc := m.services[addr][0]
+	err := m.logger.LogProtocolSession(conn.RemoteAddr().String(), &database.ProtocolSession{
+		Timestamp:   sess.Start,
+		ServerPort:  addr.Port,
+		ServiceName: svc.Name(),
+		ServiceType: svc.Type(),
+		Protocol:    config.ServiceTypeRedis,
+		Credentials: sess.Credentials,
+		Commands:    sess.Commands,
+		Transcript:  sess.Transcript,
+		Duration:    sess.Duration,
+		Error:       errText,
+	})
+	if err != nil {
+		serverLog.Error("failed to log Redis session to database", "err", err)
+	}
+	return sess.Err
+}
@@ -0,0 +1,71 @@
+//go:build !httponly
+
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/middleware"
+	"github.com/davidthuman/service-spoof/internal/ssh"
+)
+
+func init() {
+	protocols[config.ServiceTypeSSH] = func(cfg *config.ServiceConfig) protocolHandler {
+		return &sshHandler{server: ssh.NewServer(cfg.SSH)}
+	}
+}
+
+// sshHandler answers the SSH clients of an ssh service's port
+type sshHandler struct {
+	server *ssh.Server
+}
+
+func (h *sshHandler) Name() string {
+	return "SSH"
+}
+
+func (h *sshHandler) Describe() string {
+	return "banner: " + h.server.Banner()
+}
+
+// Handle answers an SSH connection and logs what the client revealed
+func (h *sshHandler) Handle(m *Manager, addr config.ListenAddr, conn net.Conn) error {
+	attempt := h.server.Handle(conn)
+
+	// Clients that never identified themselves may be speaking another
+	// protocol
+	protocol := middleware.ProtocolSSH
+	if attempt.ClientVersion == "" && len(attempt.Raw) > 0 {
+		protocol = middleware.GuessProtocol(attempt.Raw)
+	}
+	errText := ""
+	if attempt.Err != nil {
+		errText = attempt.Err.Error()
+	}
+	serverLog.Info("SSH connection", "addr", addr.String(), "remote", conn.RemoteAddr().String(), "version", attempt.ClientVersion, "hassh", attempt.HASSH)
+
+	svc := m.services[addr][0]
+	err := m.logger.LogConnection(conn.RemoteAddr().String(), &database.ConnectionLog{
+		ServerPort:     addr.Port,
+		ServiceName:    svc.Name(),
+		ServiceType:    svc.Type(),
+		Protocol:       protocol,
+		ClientVersion:  attempt.ClientVersion,
+		Fingerprint:    attempt.HASSH,
+		FingerprintRaw: attempt.HASSHRaw,
+		Raw:            string(attempt.Raw),
+		Error:          errText,
+	})
+	if err != nil {
+		serverLog.Error("failed to log SSH connection to database", "err", err)
+	}
+	// Clients hanging up after reading the banner did not fail
+	if errors.Is(attempt.Err, io.EOF) {
+		return nil
+	}
+	return attempt.Err
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+// chromeExtensions returns the extensions of the Chrome ClientHello used as
+// the reference example of the JA4 specification, without GREASE
+func chromeExtensions() []utls.TLSExtension {
+	return []utls.TLSExtension{
+		&utls.SNIExtension{},
+		&utls.ExtendedMasterSecretExtension{},
+		&utls.RenegotiationInfoExtension{Renegotiation: utls.RenegotiateOnceAsClient},
+		&utls.SupportedCurvesExtension{Curves: []utls.CurveID{utls.GREASE_PLACEHOLDER, utls.X25519, utls.CurveP256, utls.CurveP384}},
+		&utls.SupportedPointsExtension{SupportedPoints: []byte{0}},
+		&utls.SessionTicketExtension{},
+		&utls.ALPNExtension{AlpnProtocols: []string{"h2", "http/1.1"}},
+		&utls.StatusRequestExtension{},
+		&utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []utls.SignatureScheme{
+			utls.ECDSAWithP256AndSHA256, utls.PSSWithSHA256, utls.PKCS1WithSHA256,
+			utls.ECDSAWithP384AndSHA384, utls.PSSWithSHA384, utls.PKCS1WithSHA384,
+			utls.PSSWithSHA512, utls.PKCS1WithSHA512,
+		}},
+		&utls.SCTExtension{},
+		&utls.KeyShareExtension{KeyShares: []utls.KeyShare{
+			{Group: utls.CurveID(utls.GREASE_PLACEHOLDER), Data: []byte{0}},
+			{Group: utls.X25519},
+		}},
+		&utls.PSKKeyExchangeModesExtension{Modes: []uint8{utls.PskModeDHE}},
+		&utls.SupportedVersionsExtension{Versions: []uint16{utls.GREASE_PLACEHOLDER, utls.VersionTLS13, utls.VersionTLS12}},
+		&utls.UtlsCompressCertExtension{Algorithms: []utls.CertCompressionAlgo{utls.CertCompressionBrotli}},
+		&utls.ApplicationSettingsExtension{SupportedProtocols: []string{"h2"}},
+		&utls.UtlsPaddingExtension{GetPaddingLen: utls.BoringPaddingStyle},
+	}
+}
+
+// chromeCiphers are the cipher suites of the reference Chrome ClientHello
+var chromeCiphers = []uint16{
+	utls.GREASE_PLACEHOLDER,
+	utls.TLS_AES_128_GCM_SHA256, utls.TLS_AES_256_GCM_SHA384, utls.TLS_CHACHA20_POLY1305_SHA256,
+	utls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, utls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	utls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, utls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	utls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, utls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+	utls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, utls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	utls.TLS_RSA_WITH_AES_128_GCM_SHA256, utls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	utls.TLS_RSA_WITH_AES_128_CBC_SHA, utls.TLS_RSA_WITH_AES_256_CBC_SHA,
+}
+
+// clientHelloCases are synthetic ClientHellos and their JA4 fingerprints.
+// The Chrome fingerprint is the published example of the JA4 specification,
+// and the others were derived from the specification by hand.
+var clientHelloCases = []struct {
+	name string
+	spec func() *utls.ClientHelloSpec
+	want string
+	h1   bool // negotiates HTTP/1.1, so a request can be logged
+}{
+	{
+		name: "chrome",
+		spec: func() *utls.ClientHelloSpec {
+			exts := append([]utls.TLSExtension{&utls.UtlsGREASEExtension{}}, chromeExtensions()...)
+			exts = append(exts[:len(exts)-1], &utls.UtlsGREASEExtension{}, exts[len(exts)-1])
+			return &utls.ClientHelloSpec{
+				CipherSuites:       chromeCiphers,
+				CompressionMethods: []byte{0},
+				Extensions:         exts,
+			}
+		},
+		want: "t13d1516h2_8daaf6152771_e5627efa2ab1",
+	},
+	{
+		// Chrome shuffles its extensions, which JA4 sorts away, and GREASE
+		// values are ignored wherever they appear
+		name: "chrome-shuffled",
+		spec: func() *utls.ClientHelloSpec {
+			exts := chromeExtensions()
+			for i, j := 0, len(exts)-2; i < j; i, j = i+1, j-1 {
+				exts[i], exts[j] = exts[j], exts[i]
+			}
+			exts = append(exts[:5], append([]utls.TLSExtension{&utls.UtlsGREASEExtension{}}, exts[5:]...)...)
+			ciphers := append([]uint16{}, chromeCiphers[1:8]...)
+			ciphers = append(ciphers, utls.GREASE_PLACEHOLDER)
+			ciphers = append(ciphers, chromeCiphers[8:]...)
+			return &utls.ClientHelloSpec{
+				CipherSuites:       ciphers,
+				CompressionMethods: []byte{0},
+				Extensions:         exts,
+			}
+		},
+		want: "t13d1516h2_8daaf6152771_e5627efa2ab1",
+	},
+	{
+		name: "tls12-no-sni",
+		spec: func() *utls.ClientHelloSpec {
+			return &utls.ClientHelloSpec{
+				TLSVersMin: utls.VersionTLS12,
+				TLSVersMax: utls.VersionTLS12,
+				CipherSuites: []uint16{
+					utls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, utls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+					utls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, utls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				},
+				CompressionMethods: []byte{0},
+				Extensions: []utls.TLSExtension{
+					&utls.SupportedCurvesExtension{Curves: []utls.CurveID{utls.X25519, utls.CurveP256}},
+					&utls.SupportedPointsExtension{SupportedPoints: []byte{0}},
+					&utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []utls.SignatureScheme{
+						utls.ECDSAWithP256AndSHA256, utls.PSSWithSHA256, utls.PKCS1WithSHA256,
+					}},
+					&utls.ExtendedMasterSecretExtension{},
+					&utls.RenegotiationInfoExtension{Renegotiation: utls.RenegotiateOnceAsClient},
+					&utls.ALPNExtension{AlpnProtocols: []string{"http/1.1"}},
+				},
+			}
+		},
+		want: "t12i0406h1_dd22d19553a2_aae4d1db17ec",
+		h1:   true,
+	},
+	{
+		name: "tls13-no-alpn",
+		spec: func() *utls.ClientHelloSpec {
+			return &utls.ClientHelloSpec{
+				CipherSuites: []uint16{
+					utls.TLS_AES_128_GCM_SHA256, utls.TLS_AES_256_GCM_SHA384, utls.TLS_CHACHA20_POLY1305_SHA256,
+				},
+				CompressionMethods: []byte{0},
+				Extensions: []utls.TLSExtension{
+					&utls.SNIExtension{},
+					&utls.SupportedCurvesExtension{Curves: []utls.CurveID{utls.X25519}},
+					&utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []utls.SignatureScheme{
+						utls.ECDSAWithP256AndSHA256, utls.PSSWithSHA256,
+					}},
+					&utls.KeyShareExtension{KeyShares: []utls.KeyShare{{Group: utls.X25519}}},
+					&utls.SupportedVersionsExtension{Versions: []uint16{utls.VersionTLS13}},
+					&utls.PSKKeyExchangeModesExtension{Modes: []uint8{utls.PskModeDHE}},
+				},
+			}
+		},
+		want: "t13d030600_55b375c5d22e_1472448224a5",
+		h1:   true,
+	},
+}
+
+// newClientHello builds a client for a synthetic ClientHello
+func newClientHello(t *testing.T, conn net.Conn, spec *utls.ClientHelloSpec) *utls.UConn {
+	t.Helper()
+
+	client := utls.UClient(conn, &utls.Config{ServerName: "spoof.test", InsecureSkipVerify: true}, utls.HelloCustom)
+	if err := client.ApplyPreset(spec); err != nil {
+		t.Fatalf("Failed to apply ClientHello spec: %v", err)
+	}
+	return client
+}
+
+func TestParseJA4_SyntheticClientHellos(t *testing.T) {
+	for _, tc := range clientHelloCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newClientHello(t, nil, tc.spec())
+			if err := client.BuildHandshakeState(); err != nil {
+				t.Fatalf("Failed to build ClientHello: %v", err)
+			}
+
+			// Wrap the handshake message in a TLS record
+			hello := client.HandshakeState.Hello.Raw
+			record := append([]byte{0x16, 0x03, 0x01, byte(len(hello) >> 8), byte(len(hello))}, hello...)
+
+			got, err := fingerprint.ParseJA4(record, 't')
+			if err != nil {
+				t.Fatalf("Failed to parse ClientHello: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("Expected JA4 %s, got %s", tc.want, got)
+			}
+
+			var j fingerprint.JA4Fingerprint
+			if err := j.UnmarshalBytes(record, 't'); err != nil {
+				t.Fatalf("Failed to unmarshal ClientHello: %v", err)
+			}
+			if j.String() != tc.want {
+				t.Fatalf("Expected JA4 %s from utls parser, got %s", tc.want, j.String())
+			}
+		})
+	}
+}
+
+func TestManager_StoresJA4OfClientHellos(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir)
+
+	db, err := database.New(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	port := freePort(t)
+	cfg := &config.Config{
+		Tls: config.TlsConfig{CertFilePath: certFile, KeyFilePath: keyFile},
+		Services: []config.ServiceConfig{{
+			Name:    "generic",
+			Type:    "generic",
+			Enabled: true,
+			Ports:   config.PortList{port},
+			Endpoints: []config.EndpointConfig{
+				{Path: "/*", Method: "*", Status: 200},
+			},
+		}},
+	}
+
+	manager, err := NewManager(cfg, database.NewRequestLogger(db), nil)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	if certificates := manager.Certificates(); len(certificates) != 1 || certificates[0].Path != certFile || len(certificates[0].Listeners) != 1 {
+		t.Fatalf("Expected %s served on one listener, got %+v", certFile, certificates)
+	}
+
+	go manager.Start(context.Background())
+	defer manager.Shutdown(context.Background())
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	waitForListener(t, addr)
+
+	for _, tc := range clientHelloCases {
+		t.Run(tc.name, func(t *testing.T) {
+			manager.Fingerprints().Clear()
+
+			conn, err := net.DialTimeout("tcp", addr, time.Second)
+			if err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			client := newClientHello(t, conn, tc.spec())
+			if err := client.Handshake(); err != nil {
+				t.Fatalf("Handshake failed: %v", err)
+			}
+
+			if tc.h1 {
+				path := "/ja4/" + tc.name
+				fmt.Fprintf(client, "GET %s HTTP/1.1\r\nHost: spoof.test\r\nConnection: close\r\n\r\n", path)
+				resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+				if err != nil {
+					t.Fatalf("Failed to read response: %v", err)
+				}
+				resp.Body.Close()
+
+				var got, raw, original string
+				err = db.GetConn().QueryRow(`SELECT fingerprint, ja4_r, ja4_o FROM request_logs WHERE path = ?`, path).Scan(&got, &raw, &original)
+				if err != nil {
+					t.Fatalf("Failed to query logged request: %v", err)
+				}
+				if got != tc.want {
+					t.Fatalf("Expected logged JA4 %s, got %s", tc.want, got)
+				}
+				prefix := tc.want[:strings.Index(tc.want, "_")+1]
+				if !strings.HasPrefix(raw, prefix) || !strings.HasPrefix(original, prefix) {
+					t.Fatalf("Expected logged JA4_r and JA4_o starting %s, got %s and %s", prefix, raw, original)
+				}
+			}
+
+			// The fingerprint is recorded once the server reads past the
+			// ClientHello, which may be just after the handshake returns
+			deadline := time.Now().Add(2 * time.Second)
+			var entries []fingerprint.Entry
+			for time.Now().Before(deadline) {
+				if entries = manager.Fingerprints().Search(""); len(entries) > 0 {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if len(entries) != 1 || entries[0].Fingerprint != tc.want {
+				t.Fatalf("Expected stored JA4 %s, got %+v", tc.want, entries)
+			}
+		})
+	}
+}
+
+// writeTestCert writes a self-signed ECDSA certificate and key to dir
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "spoof.test"},
+		DNSNames:     []string{"spoof.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+// freePort returns a TCP port that was free a moment ago
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// waitForListener waits until addr accepts connections
+func waitForListener(t *testing.T, addr string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Server on %s did not start", addr)
+}
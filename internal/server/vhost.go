@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// vhostRouter routes the requests of a listener shared by several services
+// to the service whose virtual hosts match the Host header, or the TLS server
+// name when the Host header matches none, as scanners often connect by
+// address with the name only in the SNI. Requests matching no service go to
+// the default one.
+type vhostRouter struct {
+	hosts    []vhost
+	fallback http.Handler
+}
+
+// vhost is a virtual host name or "*." pattern and the handler answering it.
+// Patterns match names one label deeper than their suffix.
+type vhost struct {
+	pattern string
+	handler http.Handler
+}
+
+// newVhostRouter creates a router answering unmatched requests with fallback.
+// Hosts are added in order, and exact names take precedence over patterns.
+func newVhostRouter(fallback http.Handler) *vhostRouter {
+	return &vhostRouter{fallback: fallback}
+}
+
+// add routes the given virtual hosts to a handler
+func (v *vhostRouter) add(hosts []string, handler http.Handler) {
+	for _, host := range hosts {
+		v.hosts = append(v.hosts, vhost{pattern: strings.ToLower(host), handler: handler})
+	}
+}
+
+func (v *vhostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h := v.match(r.Host); h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+	if r.TLS != nil {
+		if h := v.match(r.TLS.ServerName); h != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+	}
+	v.fallback.ServeHTTP(w, r)
+}
+
+// match returns the handler of the virtual host a name falls under, or nil
+func (v *vhostRouter) match(name string) http.Handler {
+	if host, _, err := net.SplitHostPort(name); err == nil {
+		name = host
+	}
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if name == "" {
+		return nil
+	}
+
+	for _, h := range v.hosts {
+		if h.pattern == name {
+			return h.handler
+		}
+	}
+
+	// A pattern matches one label, as a wildcard certificate does, so the
+	// names it routes are the names its certificate is presented for
+	_, parent, ok := strings.Cut(name, ".")
+	if !ok {
+		return nil
+	}
+	for _, h := range v.hosts {
+		if suffix, ok := strings.CutPrefix(h.pattern, "*."); ok && suffix == parent {
+			return h.handler
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/davidthuman/service-spoof/internal/expr"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+	"github.com/davidthuman/service-spoof/internal/geoip"
+	"github.com/davidthuman/service-spoof/internal/hostheader"
+	"github.com/davidthuman/service-spoof/internal/scanner"
+	"github.com/davidthuman/service-spoof/internal/soap"
+)
+
+// RequestVars are the variables endpoint conditions can read
+var RequestVars = []string{
+	"source_ip", "method", "path", "query", "host", "user_agent", "protocol",
+	"scheme", "ja4", "ja4h", "country", "asn", "scanner", "tags", "headers",
+}
+
+// RequestEnv returns the variables of a request for evaluating endpoint
+// conditions. Headers hold the first value of each request header, and tags
+// list the attacks found in its body and the anomalies in its Host header.
+func RequestEnv(req *http.Request) expr.Env {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+
+	ja4 := ""
+	if fp, ok := req.Context().Value(fingerprint.JA4).(*string); ok && fp != nil {
+		ja4 = *fp
+	}
+	ja4h := ""
+	if fp, ok := req.Context().Value(fingerprint.JA4H).(*string); ok && fp != nil {
+		ja4h = *fp
+	} else {
+		ja4h = fingerprint.ComputeJA4H(req)
+	}
+
+	headers := make(map[string]string, len(req.Header))
+	for k, v := range req.Header {
+		if len(v) > 0 {
+			headers[k] = v[0]
+		}
+	}
+
+	// Match sources in the form they are logged in
+	sourceIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		sourceIP = req.RemoteAddr
+	}
+	if addr, err := netip.ParseAddr(sourceIP); err == nil {
+		sourceIP = addr.Unmap().WithZone("").String()
+	}
+
+	tags := make([]any, 0)
+	if probe := soap.FromContext(req.Context()); probe != nil {
+		for _, tag := range probe.Tags() {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range hostheader.Check(req, 0) {
+		tags = append(tags, tag)
+	}
+
+	env := expr.Env{
+		"source_ip":  sourceIP,
+		"method":     req.Method,
+		"path":       req.URL.Path,
+		"query":      req.URL.RawQuery,
+		"host":       req.Host,
+		"user_agent": req.UserAgent(),
+		"protocol":   req.Proto,
+		"scheme":     scheme,
+		"ja4":        ja4,
+		"ja4h":       ja4h,
+		"country":    "",
+		"asn":        0,
+		"scanner":    "",
+		"tags":       tags,
+		"headers":    headers,
+	}
+	if rec, ok := geoip.FromContext(req.Context()); ok {
+		env["country"] = rec.Country
+		env["asn"] = rec.ASN
+	}
+	if s := scanner.FromContext(req.Context()); s != nil {
+		env["scanner"] = s.Name
+	}
+	return env
+}
+
+// compileCondition compiles an endpoint condition, returning nil for an empty
+// one
+func compileCondition(source string) (*expr.Program, error) {
+	if source == "" {
+		return nil, nil
+	}
+	prog, err := expr.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := prog.Check(RequestVars); err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
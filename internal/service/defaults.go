@@ -0,0 +1,132 @@
+package service
+
+import (
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/templates"
+)
+
+// defaultPath is a path a server software answers out of the box
+type defaultPath struct {
+	path     string
+	status   int
+	template string
+
+	// render renders the template for each request, for files the software
+	// generates, and contentType is their type
+	render      bool
+	contentType string
+}
+
+// defaultPaths are the paths each service type's software answers as
+// installed: the icons directory of Debian and Ubuntu's Apache, the pages of
+// nginx's default document root, the files of WordPress's wp-includes and
+// the robots.txt it generates, and the default document of IIS
+var defaultPaths = map[string][]defaultPath{
+	"apache2": {
+		{path: "/icons/", status: http.StatusForbidden, template: "apache2/403.html"},
+		{path: "/icons/README", status: http.StatusOK, template: "apache2/icons/README"},
+	},
+	"nginx": {
+		{path: "/index.html", status: http.StatusOK, template: "nginx/index.html"},
+		{path: "/50x.html", status: http.StatusOK, template: "nginx/50x.html"},
+	},
+	"wordpress": {
+		{path: "/robots.txt", status: http.StatusOK, template: "wordpress/robots.txt", render: true, contentType: "text/plain; charset=UTF-8"},
+		{path: "/wp-includes/", status: http.StatusForbidden, template: "apache2/403.html"},
+		{path: "/wp-includes/wlwmanifest.xml", status: http.StatusOK, template: "wordpress/wlwmanifest.xml"},
+	},
+	"iis": {
+		{path: "/iisstart.htm", status: http.StatusOK, template: "iis/default.html"},
+	},
+}
+
+// mimeTypes are the content types each software's default configuration
+// sends by extension, where it differs from commonTypes. Files with other
+// extensions get the service's own.
+var mimeTypes = map[string]map[string]string{
+	"apache2":   {".xml": "application/xml", ".ico": "image/vnd.microsoft.icon"},
+	"nginx":     {".xml": "text/xml", ".ico": "image/x-icon"},
+	"wordpress": {".xml": "application/xml", ".ico": "image/vnd.microsoft.icon"},
+	"iis":       {".xml": "text/xml", ".ico": "image/x-icon"},
+}
+
+// commonTypes are the content types every software sends by extension
+var commonTypes = map[string]string{
+	".html": "text/html",
+	".htm":  "text/html",
+	".txt":  "text/plain",
+	".css":  "text/css",
+	".js":   "application/javascript",
+	".json": "application/json",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".jpg":  "image/jpeg",
+	".svg":  "image/svg+xml",
+}
+
+// endpoints returns the endpoints of a service: those it configures, each
+// after its variants, then the files and built-in default paths it answers at
+// paths none of them takes
+func endpoints(cfg *config.ServiceConfig) []config.EndpointConfig {
+	eps := expandVariants(cfg.Endpoints)
+	taken := make(map[string]bool, len(eps))
+	for _, ep := range eps {
+		taken[ep.Path] = true
+	}
+
+	var files map[string]string
+	if cfg.DefaultPaths != nil {
+		files = cfg.DefaultPaths.Files
+	}
+	for _, p := range slices.Sorted(maps.Keys(files)) {
+		if taken[p] {
+			continue
+		}
+		taken[p] = true
+		if files[p] != "" {
+			eps = append(eps, defaultEndpoint(cfg, defaultPath{path: p, status: http.StatusOK, template: files[p]}))
+		}
+	}
+
+	if !cfg.DefaultPaths.GetEnabled() {
+		return eps
+	}
+	for _, d := range defaultPaths[cfg.Type] {
+		if !taken[d.path] {
+			d.template = templates.BuiltinPrefix + d.template
+			eps = append(eps, defaultEndpoint(cfg, d))
+		}
+	}
+	return eps
+}
+
+// defaultEndpoint returns the endpoint answering GET requests for a default
+// path, typed as the service's software types the file
+func defaultEndpoint(cfg *config.ServiceConfig, d defaultPath) config.EndpointConfig {
+	ep := config.EndpointConfig{
+		Path:     d.path,
+		Method:   http.MethodGet,
+		Status:   d.status,
+		Template: d.template,
+	}
+	if d.render {
+		ep.Type = config.EndpointTypeTemplate
+	}
+
+	ct := d.contentType
+	if ct == "" && d.status == http.StatusOK {
+		ext := path.Ext(d.path)
+		if ct = mimeTypes[cfg.Type][ext]; ct == "" {
+			ct = commonTypes[ext]
+		}
+	}
+	if ct != "" {
+		ep.Headers = map[string]string{"Content-Type": ct}
+	}
+	return ep
+}
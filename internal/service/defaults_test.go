@@ -0,0 +1,67 @@
+package service
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/templates"
+)
+
+func TestService_DefaultPaths(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "favicon.ico"), []byte("\x00\x00\x01\x00"), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	dir, err := templates.Open(root)
+	if err != nil {
+		t.Fatalf("Failed to open templates: %v", err)
+	}
+	defer dir.Close()
+
+	svc, err := NewService(&config.ServiceConfig{
+		Name: "blog",
+		Type: "wordpress",
+		Endpoints: []config.EndpointConfig{
+			{Path: "/wp-includes/", Method: "GET", Status: 404},
+			{Path: "/*", Method: "*", Status: 404},
+		},
+		DefaultPaths: &config.DefaultPathsConfig{
+			Files: map[string]string{"/favicon.ico": "favicon.ico", "/wp-includes/wlwmanifest.xml": ""},
+		},
+	}, dir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"/robots.txt", 200, "text/plain; charset=UTF-8", "Disallow: /wp-admin/\nAllow: /wp-admin/admin-ajax.php\n\nSitemap: http://blog.example/wp-sitemap.xml\n"},
+		{"/favicon.ico", 200, "image/vnd.microsoft.icon", "\x00\x00\x01\x00"},
+		{"/wp-includes/", 404, "", ""},
+		{"/wp-includes/wlwmanifest.xml", 404, "", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.Host = "blog.example"
+		svc.HandleRequest(w, r)
+
+		if w.Code != tt.status {
+			t.Fatalf("Expected %s to answer %d, got %d", tt.path, tt.status, w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); tt.contentType != "" && got != tt.contentType {
+			t.Fatalf("Expected %s to be typed %s, got %s", tt.path, tt.contentType, got)
+		}
+		if !strings.HasSuffix(w.Body.String(), tt.body) {
+			t.Fatalf("Expected %s to answer %q, got %q", tt.path, tt.body, w.Body.String())
+		}
+	}
+}
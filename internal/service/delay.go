@@ -0,0 +1,69 @@
+package service
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// Delay is how long an endpoint takes to answer, since real backends take
+// time to build responses and instant answers give a spoof away
+type Delay struct {
+	Base   time.Duration
+	Jitter time.Duration
+
+	// Median, Sigma, and Max describe a lognormal distribution further
+	// delays are drawn from, if Median is set
+	Median time.Duration
+	Sigma  float64
+	Max    time.Duration
+}
+
+// newDelay returns the delay of an endpoint of a service, or nil if it
+// answers at once
+func newDelay(cfg *config.ServiceConfig, ep *config.EndpointConfig) *Delay {
+	base, jitter, latency := cfg.GetDelay(ep)
+	d := &Delay{Base: base, Jitter: jitter}
+	if latency != nil {
+		d.Median, d.Sigma, d.Max = latency.GetParams()
+	}
+	if d.Base <= 0 && d.Jitter <= 0 && d.Median <= 0 {
+		return nil
+	}
+	return d
+}
+
+// Duration returns how long to wait before answering a request: the base
+// delay, plus up to the jitter more, plus a draw from the distribution
+func (d *Delay) Duration() time.Duration {
+	if d == nil {
+		return 0
+	}
+	wait := d.Base
+	if d.Jitter > 0 {
+		wait += rand.N(d.Jitter + 1)
+	}
+	if d.Median > 0 {
+		draw := time.Duration(float64(d.Median) * math.Exp(d.Sigma*rand.NormFloat64()))
+		wait += min(draw, d.Max)
+	}
+	return wait
+}
+
+// Wait waits out the delay before a request is answered, returning early if
+// the client goes away
+func (d *Delay) Wait(r *http.Request) {
+	wait := d.Duration()
+	if wait <= 0 {
+		return
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-r.Context().Done():
+	}
+}
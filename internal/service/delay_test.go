@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestDelay(t *testing.T) {
+	cfg := &config.ServiceConfig{Delay: 100 * time.Millisecond, DelayJitter: 50 * time.Millisecond}
+	inherited := &config.EndpointConfig{}
+	own := &config.EndpointConfig{Delay: 2 * time.Second}
+
+	d := newDelay(cfg, inherited)
+	for range 100 {
+		if wait := d.Duration(); wait < 100*time.Millisecond || wait > 150*time.Millisecond {
+			t.Fatalf("Expected a delay between 100ms and 150ms, got %s", wait)
+		}
+	}
+	if wait := newDelay(cfg, own).Duration(); wait != 2*time.Second {
+		t.Fatalf("Expected the endpoint's own delay of 2s, got %s", wait)
+	}
+	if d := newDelay(&config.ServiceConfig{}, inherited); d != nil {
+		t.Fatalf("Expected no delay, got %+v", d)
+	}
+
+	// A client going away cuts the wait short
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	start := time.Now()
+	newDelay(cfg, own).Wait(r)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected the wait to end with the request, took %s", elapsed)
+	}
+}
+
+func TestDelay_Lognormal(t *testing.T) {
+	cfg := &config.ServiceConfig{Latency: &config.LatencyConfig{Profile: config.LatencyProfilePHP, Max: 400 * time.Millisecond}}
+	d := newDelay(cfg, &config.EndpointConfig{})
+
+	const n = 2001
+	waits := make([]time.Duration, n)
+	for i := range waits {
+		waits[i] = d.Duration()
+		if waits[i] <= 0 || waits[i] > 400*time.Millisecond {
+			t.Fatalf("Expected a delay up to the 400ms cap, got %s", waits[i])
+		}
+	}
+	slices.Sort(waits)
+	if median := waits[n/2]; median < 90*time.Millisecond || median > 130*time.Millisecond {
+		t.Fatalf("Expected a median near the PHP profile's 110ms, got %s", median)
+	}
+	if waits[n-1] != 400*time.Millisecond {
+		t.Fatalf("Expected the slowest of %d draws to reach the cap, got %s", n, waits[n-1])
+	}
+
+	// An endpoint's own fixed delay replaces the service's distribution
+	if wait := newDelay(cfg, &config.EndpointConfig{Delay: time.Millisecond}).Duration(); wait != time.Millisecond {
+		t.Fatalf("Expected the endpoint's 1ms delay, got %s", wait)
+	}
+}
@@ -1,12 +1,23 @@
 package service
 
 import (
+	"net/http"
 	"path/filepath"
+
+	"github.com/davidthuman/service-spoof/internal/canary"
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/expr"
+	"github.com/davidthuman/service-spoof/internal/soap"
+	"github.com/davidthuman/service-spoof/internal/status"
+	"github.com/davidthuman/service-spoof/internal/websocket"
 )
 
 // Router handles endpoint matching for a service
 type Router struct {
 	endpoints []*Endpoint
+
+	// logging is what is stored of requests matching no endpoint
+	logging Logging
 }
 
 // Endpoint represents a single endpoint configuration
@@ -16,6 +27,57 @@ type Endpoint struct {
 	Status   int
 	Template string
 	Headers  map[string]string
+
+	// When restricts the endpoint to requests the condition holds for,
+	// including the request sources it is restricted to
+	When *expr.Program
+
+	// Variant names the response variant the endpoint serves, and Match
+	// restricts it to the requests the variant is for
+	Variant string
+	Match   *Matcher
+
+	// SOAP answers posted XML with faults on SOAP endpoints
+	SOAP *soap.Endpoint
+
+	// StatusPage answers status endpoints with a server status page
+	StatusPage *status.Page
+
+	// Canary alerts on every request to canary endpoints
+	Canary *canary.Token
+
+	// WebSocket completes WebSocket handshakes on websocket endpoints
+	WebSocket *websocket.Endpoint
+
+	// Render renders the template of template endpoints for each request
+	Render *Template
+
+	// Delay is how long the endpoint takes to answer
+	Delay *Delay
+
+	// Required are the body fields requests to an API endpoint must carry
+	Required []string
+
+	// Logging is what is stored of requests to the endpoint
+	Logging Logging
+}
+
+// Logging is what is stored of requests. The zero value stores everything.
+type Logging struct {
+	// Disabled requests are counted but not stored
+	Disabled bool
+
+	// NoBody leaves request bodies out of raw dumps, and NoRaw stores no
+	// raw dump at all
+	NoBody bool
+	NoRaw  bool
+}
+
+// newLogging returns what is stored of requests to an endpoint of a service,
+// or to paths matching none if ep is nil
+func newLogging(cfg *config.ServiceConfig, ep *config.EndpointConfig) Logging {
+	enabled, body, raw := cfg.GetLogging(ep)
+	return Logging{Disabled: !enabled, NoBody: !body, NoRaw: !raw}
 }
 
 // NewRouter creates a new router
@@ -25,29 +87,76 @@ func NewRouter() *Router {
 	}
 }
 
+// SetLogging sets what is stored of requests matching no endpoint
+func (r *Router) SetLogging(l Logging) {
+	r.logging = l
+}
+
+// Logging returns what is stored of a request: its endpoint's setting, or
+// the router's if it matches none
+func (r *Router) Logging(req *http.Request) Logging {
+	if ep, ok := r.MatchRequest(req); ok {
+		return ep.Logging
+	}
+	return r.logging
+}
+
 // AddEndpoint adds an endpoint to the router
 func (r *Router) AddEndpoint(ep *Endpoint) {
 	r.endpoints = append(r.endpoints, ep)
 }
 
-// Match finds the first matching endpoint for the given method and path
+// Match finds the first matching endpoint for the given method and path,
+// skipping endpoints restricted to request sources or conditions
 // Priority: exact match > pattern match > wildcard match
 func (r *Router) Match(method, path string) (*Endpoint, bool) {
+	return r.match(method, path, nil)
+}
+
+// MatchRequest finds the first matching endpoint for a request, evaluating
+// endpoint conditions against it
+func (r *Router) MatchRequest(req *http.Request) (*Endpoint, bool) {
+	return r.match(req.Method, req.URL.Path, req)
+}
+
+func (r *Router) match(method, path string, req *http.Request) (*Endpoint, bool) {
 	var wildcardMatch *Endpoint
 
+	// The condition environment is built once, on the first endpoint that
+	// needs it
+	var env expr.Env
+
 	for _, ep := range r.endpoints {
 		// Check method match
 		if ep.Method != "*" && ep.Method != method {
 			continue
 		}
 
+		// Check condition match
+		if ep.When != nil {
+			if req == nil {
+				continue
+			}
+			if env == nil {
+				env = RequestEnv(req)
+			}
+			if !ep.When.Eval(env) {
+				continue
+			}
+		}
+
+		// Check variant match
+		if ep.Match != nil && (req == nil || !ep.Match.Matches(req)) {
+			continue
+		}
+
 		// Exact path match - return immediately
 		if ep.Path == path {
 			return ep, true
 		}
 
 		// Wildcard match - save but continue looking for exact/pattern match
-		if ep.Path == "/*" || ep.Path == "*" {
+		if ep.IsWildcard() {
 			if wildcardMatch == nil {
 				wildcardMatch = ep
 			}
@@ -67,3 +176,41 @@ func (r *Router) Match(method, path string) (*Endpoint, bool) {
 
 	return nil, false
 }
+
+// Allowed returns the methods of the endpoints whose path matches, ignoring
+// wildcard endpoints and source restrictions, for Allow headers. Endpoints
+// answering any method make every method allowed and return nil.
+func (r *Router) Allowed(path string) []string {
+	methods := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, ep := range r.endpoints {
+		if ep.IsWildcard() {
+			continue
+		}
+		if matched, _ := filepath.Match(ep.Path, path); ep.Path != path && !matched {
+			continue
+		}
+		if ep.Method == "*" {
+			return nil
+		}
+		if !seen[ep.Method] {
+			seen[ep.Method] = true
+			methods = append(methods, ep.Method)
+		}
+	}
+	return methods
+}
+
+// IsWildcard reports whether the endpoint matches every path
+func (ep *Endpoint) IsWildcard() bool {
+	return ep.Path == "/*" || ep.Path == "*"
+}
+
+// newSOAPEndpoint returns the SOAP handling of an endpoint, or nil if it is
+// not a SOAP endpoint
+func newSOAPEndpoint(cfg *config.EndpointConfig) *soap.Endpoint {
+	if cfg.Type != config.EndpointTypeSOAP {
+		return nil
+	}
+	return soap.NewEndpoint(cfg.SOAP)
+}
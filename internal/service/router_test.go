@@ -0,0 +1,125 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/geoip"
+)
+
+func TestRouter_MatchRequestByOrigin(t *testing.T) {
+	// Source restrictions are conditions on the request's country and ASN
+	german, err := compileCondition((&config.EndpointConfig{Countries: []string{"DE", "at"}}).GetWhen())
+	if err != nil {
+		t.Fatalf("Failed to compile countries: %v", err)
+	}
+	denied, err := compileCondition((&config.EndpointConfig{Countries: []string{"!US"}, ASNs: []int{64500}}).GetWhen())
+	if err != nil {
+		t.Fatalf("Failed to compile countries and asns: %v", err)
+	}
+
+	router := NewRouter()
+	router.AddEndpoint(&Endpoint{Path: "/", Method: "GET", Status: 200, Template: "de.html", When: german})
+	router.AddEndpoint(&Endpoint{Path: "/*", Method: "*", Status: 403, When: denied})
+	router.AddEndpoint(&Endpoint{Path: "/", Method: "GET", Status: 200, Template: "en.html"})
+	router.AddEndpoint(&Endpoint{Path: "/*", Method: "*", Status: 404})
+
+	tests := []struct {
+		name   string
+		origin *geoip.Record
+		path   string
+		status int
+		tmpl   string
+	}{
+		{"unknown origin", nil, "/", 200, "en.html"},
+		{"unknown origin not excluded", nil, "/admin", 404, ""},
+		{"country match", &geoip.Record{Country: "AT", ASN: 1}, "/", 200, "de.html"},
+		{"country mismatch", &geoip.Record{Country: "FR", ASN: 1}, "/", 200, "en.html"},
+		{"asn denied", &geoip.Record{Country: "FR", ASN: 64500}, "/admin", 403, ""},
+		{"excluded country", &geoip.Record{Country: "US", ASN: 64500}, "/admin", 404, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.path, nil)
+			if tt.origin != nil {
+				r = r.WithContext(geoip.NewContext(r.Context(), *tt.origin))
+			}
+
+			ep, ok := router.MatchRequest(r)
+			if !ok {
+				t.Fatalf("Expected a match for %s", tt.path)
+			}
+			if ep.Status != tt.status || ep.Template != tt.tmpl {
+				t.Fatalf("Expected %d %q, got %d %q", tt.status, tt.tmpl, ep.Status, ep.Template)
+			}
+		})
+	}
+}
+
+func TestRouter_MatchRequestByCondition(t *testing.T) {
+	when, err := compileCondition(`user_agent contains "sqlmap" || headers["X-Api-Key"] == "test"`)
+	if err != nil {
+		t.Fatalf("Failed to compile condition: %v", err)
+	}
+
+	router := NewRouter()
+	router.AddEndpoint(&Endpoint{Path: "/*", Method: "*", Status: 403, When: when})
+	router.AddEndpoint(&Endpoint{Path: "/*", Method: "*", Status: 404})
+
+	req := httptest.NewRequest("GET", "/api", nil)
+	req.Header.Set("User-Agent", "sqlmap/1.8")
+	if ep, _ := router.MatchRequest(req); ep.Status != 403 {
+		t.Fatalf("Expected 403 for sqlmap, got %d", ep.Status)
+	}
+
+	req = httptest.NewRequest("GET", "/api", nil)
+	req.Header.Set("x-api-key", "test")
+	if ep, _ := router.MatchRequest(req); ep.Status != 403 {
+		t.Fatalf("Expected 403 for the API key, got %d", ep.Status)
+	}
+
+	if ep, _ := router.MatchRequest(httptest.NewRequest("GET", "/api", nil)); ep.Status != 404 {
+		t.Fatalf("Expected 404 without a match, got %d", ep.Status)
+	}
+	if ep, _ := router.Match("GET", "/api"); ep.Status != 404 {
+		t.Fatalf("Expected conditional endpoints to be skipped without a request, got %d", ep.Status)
+	}
+
+	if _, err := compileCondition(`useragent == "x"`); err == nil {
+		t.Fatal("Expected an error for an unknown variable")
+	}
+}
+
+func TestRouter_Logging(t *testing.T) {
+	off, on := false, true
+	cfg := &config.ServiceConfig{
+		Logging: &config.LoggingConfig{Body: &off},
+		Endpoints: []config.EndpointConfig{
+			{Path: "/healthz", Method: "GET", Logging: &config.LoggingConfig{Enabled: &off}},
+			{Path: "/upload", Method: "POST", Logging: &config.LoggingConfig{Body: &on, Raw: &off}},
+			{Path: "/", Method: "GET"},
+		},
+	}
+	router := NewRouter()
+	for _, ep := range cfg.Endpoints {
+		router.AddEndpoint(&Endpoint{Path: ep.Path, Method: ep.Method, Logging: newLogging(cfg, &ep)})
+	}
+	router.SetLogging(newLogging(cfg, nil))
+
+	tests := []struct {
+		method, path string
+		want         Logging
+	}{
+		{"GET", "/healthz", Logging{Disabled: true, NoBody: true}},
+		{"POST", "/upload", Logging{NoRaw: true}},
+		{"GET", "/", Logging{NoBody: true}},
+		{"GET", "/missing", Logging{NoBody: true}},
+	}
+	for _, tt := range tests {
+		if got := router.Logging(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+			t.Fatalf("Expected %s %s to log %+v, got %+v", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"net/http"
 
 	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/logging"
+	"github.com/davidthuman/service-spoof/internal/templates"
 )
 
+// serviceLog logs the responses that cannot be answered as configured
+var serviceLog = logging.Logger("service")
+
 // Service represents a spoofable service
 type Service interface {
 	// Name returns the service identifier
@@ -24,18 +29,19 @@ type Service interface {
 	HandleRequest(w http.ResponseWriter, r *http.Request)
 }
 
-// NewService creates a new service from configuration
-func NewService(cfg *config.ServiceConfig) (Service, error) {
+// NewService creates a new service from configuration, reading its templates
+// from dir
+func NewService(cfg *config.ServiceConfig, dir *templates.Dir) (Service, error) {
 	switch cfg.Type {
 	case "apache2":
-		return NewApache2Service(cfg)
+		return NewApache2Service(cfg, dir)
 	case "nginx":
-		return NewNginxService(cfg)
+		return NewNginxService(cfg, dir)
 	case "wordpress":
-		return NewWordPressService(cfg)
+		return NewWordPressService(cfg, dir)
 	case "iis":
-		return NewIISService(cfg)
+		return NewIISService(cfg, dir)
 	default:
-		return NewGenericService(cfg)
+		return NewGenericService(cfg, dir)
 	}
 }
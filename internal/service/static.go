@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/templates"
+)
+
+// etagFunc formats the entity tag a server sends for a static file
+type etagFunc func(f *templates.File) string
+
+// apacheETag is Apache's default entity tag: the size and modification time
+// in microseconds, in hex
+func apacheETag(f *templates.File) string {
+	return fmt.Sprintf(`"%x-%x"`, len(f.Content), f.ModTime.UnixMicro())
+}
+
+// nginxETag is nginx's entity tag: the modification time in seconds and the
+// size, in hex
+func nginxETag(f *templates.File) string {
+	return fmt.Sprintf(`"%x-%x"`, f.ModTime.Unix(), len(f.Content))
+}
+
+// iisETag is IIS's entity tag: the modification time as a Windows FILETIME,
+// in hex, and the change number
+func iisETag(f *templates.File) string {
+	const epochDiff = 116444736000000000 // 100ns intervals from 1601 to 1970
+	return fmt.Sprintf(`"%x:0"`, f.ModTime.UnixNano()/100+epochDiff)
+}
+
+// serveTemplate answers with an endpoint's template as it is on disk. With an
+// etag function, successful responses carry the validators a static file
+// server sends, and a request whose If-None-Match or If-Modified-Since
+// matches them is answered with a 304, as the server would. Error pages carry
+// none, as real servers' do not.
+func serveTemplate(w http.ResponseWriter, r *http.Request, dir *templates.Dir, endpoint *Endpoint, etag etagFunc) {
+	if endpoint.Template == "" {
+		w.WriteHeader(endpoint.Status)
+		return
+	}
+
+	f, err := OpenTemplate(dir, endpoint.Template)
+	if errors.Is(err, ErrTemplateMissing) {
+		// As a server whose file was removed from under it would
+		serviceLog.Error("failed to serve template", "path", r.URL.Path, "err", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusInternalServerError)
+		return
+	}
+
+	if etag != nil && endpoint.Status == http.StatusOK {
+		tag := etag(f)
+		h := w.Header()
+		h.Set("Last-Modified", f.ModTime.UTC().Format(http.TimeFormat))
+		h.Set("ETag", tag)
+		if h.Get("Accept-Ranges") == "" {
+			h.Set("Accept-Ranges", "bytes")
+		}
+		if notModified(r, tag, f.ModTime) {
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.WriteHeader(endpoint.Status)
+	w.Write(f.Content)
+}
+
+// notModified reports whether a GET or HEAD request's conditional headers
+// match a file's validators. If-None-Match takes precedence over
+// If-Modified-Since, as RFC 9110 requires.
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modTime.Truncate(time.Second).After(t)
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/templates"
+)
+
+func TestService_ServesStaticValidators(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "index.html")
+	if err := os.WriteFile(path, []byte("It works!"), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 500000000, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	dir, err := templates.Open(root)
+	if err != nil {
+		t.Fatalf("Failed to open templates: %v", err)
+	}
+	defer dir.Close()
+
+	svc, err := NewService(&config.ServiceConfig{
+		Name: "web",
+		Type: "apache2",
+		Endpoints: []config.EndpointConfig{
+			{Path: "/", Method: "GET", Status: 200, Template: "index.html"},
+			{Path: "/*", Method: "*", Status: 404, Template: "index.html"},
+		},
+	}, dir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		svc.HandleRequest(w, r)
+		return w
+	}
+
+	w := get("/", nil)
+	etag := `"9-612981d8ef120"`
+	if w.Code != 200 || w.Body.String() != "It works!" || w.Header().Get("ETag") != etag ||
+		w.Header().Get("Last-Modified") != "Fri, 01 Mar 2024 12:00:00 GMT" || w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("Expected the page with Apache validators, got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	if w := get("/", http.Header{"If-None-Match": {`"other", ` + etag}}); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("Expected a 304 for a matching ETag, got %d %q", w.Code, w.Body.String())
+	}
+	if w := get("/", http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {"Fri, 01 Mar 2024 12:00:00 GMT"}}); w.Code != 200 {
+		t.Fatalf("Expected If-None-Match to take precedence, got %d", w.Code)
+	}
+	if w := get("/", http.Header{"If-Modified-Since": {"Fri, 01 Mar 2024 12:00:00 GMT"}}); w.Code != http.StatusNotModified {
+		t.Fatalf("Expected a 304 for an unmodified file, got %d", w.Code)
+	}
+
+	if w := get("/missing", nil); w.Code != 404 || w.Header().Get("ETag") != "" {
+		t.Fatalf("Expected a 404 without validators, got %d %v", w.Code, w.Header())
+	}
+
+	// Changing the file invalidates the cached copy
+	if err := os.WriteFile(path, []byte("Changed"), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if w := get("/", http.Header{"If-None-Match": {etag}}); w.Code != 200 || w.Body.String() != "Changed" {
+		t.Fatalf("Expected the changed page, got %d %q", w.Code, w.Body.String())
+	}
+}
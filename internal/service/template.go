@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"text/template"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/templates"
+)
+
+// ErrTemplateMissing is wrapped by errors of templates that do not exist
+// under the templates root
+var ErrTemplateMissing = errors.New("template is missing")
+
+// OpenTemplate opens a template of dir, failing with an error wrapping
+// ErrTemplateMissing if it does not exist
+func OpenTemplate(dir *templates.Dir, name string) (*templates.File, error) {
+	f, err := dir.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrTemplateMissing, err)
+	}
+	return f, err
+}
+
+// Template is an endpoint template rendered with text/template for every
+// request, so pages show the request and per-service values
+type Template struct {
+	tmpl     *template.Template
+	service  string
+	server   string
+	hostname string
+	values   map[string]string
+}
+
+// newTemplate parses the template of an endpoint of type template from dir,
+// returning nil for other endpoints
+func newTemplate(cfg *config.ServiceConfig, ep *config.EndpointConfig, dir *templates.Dir) (*Template, error) {
+	if ep.Type != config.EndpointTypeTemplate {
+		return nil, nil
+	}
+
+	f, err := OpenTemplate(dir, ep.Template)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(path.Base(ep.Template)).Option("missingkey=zero").Parse(string(f.Content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	hostname := cfg.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	server := ""
+	for k, v := range cfg.Headers {
+		if http.CanonicalHeaderKey(k) == "Server" {
+			server = v
+		}
+	}
+
+	return &Template{
+		tmpl:     tmpl,
+		service:  cfg.Name,
+		server:   server,
+		hostname: hostname,
+		values:   cfg.Values,
+	}, nil
+}
+
+// TemplateData is what templates are rendered with
+type TemplateData struct {
+	// The request being answered
+	RemoteIP string
+	Host     string
+	Method   string
+	Path     string
+	Query    string
+	Now      time.Time
+
+	// The service answering it: its name, Server header, hostname, and the
+	// values it configures
+	Service  string
+	Server   string
+	Hostname string
+	Values   map[string]string
+}
+
+// RandHex returns n random bytes, hex-encoded, different for every request
+func (d TemplateData) RandHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// StableHex returns n bytes derived from the hostname, service, and name,
+// hex-encoded, so identifiers such as build IDs stay the same across requests
+// and restarts of a deployment
+func (d TemplateData) StableHex(n int, name string) string {
+	var out []byte
+	for i := 0; len(out) < n; i++ {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%d", d.Hostname, d.Service, name, i)))
+		out = append(out, sum[:]...)
+	}
+	return hex.EncodeToString(out[:n])
+}
+
+// Execute renders the template for a request. Rendering only fails on
+// templates calling functions that fail, so a failure is logged and the
+// output so far written.
+func (t *Template) Execute(w http.ResponseWriter, r *http.Request) {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	data := TemplateData{
+		RemoteIP: remoteIP,
+		Host:     host,
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Query:    r.URL.RawQuery,
+		Now:      time.Now(),
+		Service:  t.service,
+		Server:   t.server,
+		Hostname: t.hostname,
+		Values:   t.values,
+	}
+
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		serviceLog.Error("failed to render template", "template", t.tmpl.Name(), "service", t.service, "err", err)
+	}
+	w.Write(buf.Bytes())
+}
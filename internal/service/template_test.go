@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/templates"
+)
+
+func TestService_RendersTemplate(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "index.html")
+	content := `{{.Server}} on {{.Hostname}}:{{.Values.port}} for {{.RemoteIP}} at {{.Host}}{{.Path}} {{len (.RandHex 4)}} {{.StableHex 4 "build"}}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	dir, err := templates.Open(root)
+	if err != nil {
+		t.Fatalf("Failed to open templates: %v", err)
+	}
+	defer dir.Close()
+
+	svc, err := NewService(&config.ServiceConfig{
+		Name:     "web",
+		Type:     "apache2",
+		Headers:  map[string]string{"server": "Apache/2.4.58 (Ubuntu)"},
+		Hostname: "www.corp.example",
+		Values:   map[string]string{"port": "80"},
+		Endpoints: []config.EndpointConfig{
+			{Path: "/*", Method: "GET", Status: 200, Template: path, Type: config.EndpointTypeTemplate},
+		},
+	}, dir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	render := func() string {
+		r := httptest.NewRequest("GET", "http://10.0.0.5:8080/index.php", nil)
+		r.RemoteAddr = "203.0.113.7:40000"
+		w := httptest.NewRecorder()
+		svc.HandleRequest(w, r)
+		return w.Body.String()
+	}
+
+	stable := (TemplateData{Hostname: "www.corp.example", Service: "web"}).StableHex(4, "build")
+	want := "Apache/2.4.58 (Ubuntu) on www.corp.example:80 for 203.0.113.7 at 10.0.0.5/index.php 8 " + stable
+	if got := render(); got != want {
+		t.Fatalf("Expected %q, got %q", want, got)
+	}
+	if got := render(); got != want {
+		t.Fatalf("Expected stable output across requests, got %q", got)
+	}
+}
+
+func TestService_MissingTemplate(t *testing.T) {
+	root := t.TempDir()
+	dir, err := templates.Open(root)
+	if err != nil {
+		t.Fatalf("Failed to open templates: %v", err)
+	}
+	defer dir.Close()
+
+	missing := filepath.Join(root, "missing.html")
+	_, err = NewService(&config.ServiceConfig{
+		Name: "web",
+		Type: "apache2",
+		Endpoints: []config.EndpointConfig{
+			{Path: "/*", Method: "GET", Status: 200, Template: missing, Type: config.EndpointTypeTemplate},
+		},
+	}, dir)
+	if !errors.Is(err, ErrTemplateMissing) {
+		t.Fatalf("Expected ErrTemplateMissing, got %v", err)
+	}
+
+	// A static template removed after startup is answered as not found
+	svc, err := NewService(&config.ServiceConfig{
+		Name: "web",
+		Type: "apache2",
+		Endpoints: []config.EndpointConfig{
+			{Path: "/*", Method: "GET", Status: 200, Template: missing},
+		},
+	}, dir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	w := httptest.NewRecorder()
+	svc.HandleRequest(w, httptest.NewRequest("GET", "/index.html", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/netip"
+	"path"
+	"regexp"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+// Matcher picks out the requests a response variant is served to
+type Matcher struct {
+	userAgent *regexp.Regexp
+	ja4       []string
+	sources   []netip.Prefix
+	headers   []string
+}
+
+// newMatcher compiles the matchers of a variant, returning nil for an
+// endpoint that is not one
+func newMatcher(cfg *config.MatchConfig) (*Matcher, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	m := &Matcher{ja4: cfg.JA4, headers: cfg.Headers}
+	if cfg.UserAgent != "" {
+		re, err := regexp.Compile(cfg.UserAgent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile userAgent: %w", err)
+		}
+		m.userAgent = re
+	}
+	for _, source := range cfg.Sources {
+		prefix, err := netip.ParsePrefix(source)
+		if err != nil {
+			addr, err := netip.ParseAddr(source)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse source %q: %w", source, err)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		m.sources = append(m.sources, prefix.Masked())
+	}
+	return m, nil
+}
+
+// Matches reports whether every matcher holds for a request
+func (m *Matcher) Matches(req *http.Request) bool {
+	if m.userAgent != nil && !m.userAgent.MatchString(req.UserAgent()) {
+		return false
+	}
+	if len(m.ja4) > 0 && !m.matchesJA4(req) {
+		return false
+	}
+	if len(m.sources) > 0 && !m.matchesSource(req) {
+		return false
+	}
+	for _, name := range m.headers {
+		if _, ok := req.Header[http.CanonicalHeaderKey(name)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesJA4 reports whether the JA4 fingerprint of a request's connection
+// matches one of the patterns. Plaintext requests have none.
+func (m *Matcher) matchesJA4(req *http.Request) bool {
+	fp, ok := req.Context().Value(fingerprint.JA4).(*string)
+	if !ok || fp == nil || *fp == "" {
+		return false
+	}
+	for _, pattern := range m.ja4 {
+		if matched, _ := path.Match(pattern, *fp); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSource reports whether a request's source is in one of the
+// prefixes, matching IPv4 clients of dual-stack listeners as IPv4
+func (m *Matcher) matchesSource(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap().WithZone("")
+	for _, prefix := range m.sources {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandVariants returns the endpoints with the variants of each before it,
+// as endpoints of their own answering only the requests they match
+func expandVariants(eps []config.EndpointConfig) []config.EndpointConfig {
+	expanded := make([]config.EndpointConfig, 0, len(eps))
+	for _, ep := range eps {
+		for _, v := range ep.Variants {
+			variant := ep
+			variant.Variants = nil
+			variant.Variant = v.Name
+			variant.Match = &v.Match
+			if v.Status != 0 {
+				variant.Status = v.Status
+			}
+			if v.Template != "" {
+				variant.Template = v.Template
+			}
+			if len(v.Headers) > 0 {
+				variant.Headers = maps.Clone(ep.Headers)
+				if variant.Headers == nil {
+					variant.Headers = make(map[string]string, len(v.Headers))
+				}
+				maps.Copy(variant.Headers, v.Headers)
+			}
+			expanded = append(expanded, variant)
+		}
+		expanded = append(expanded, ep)
+	}
+	return expanded
+}
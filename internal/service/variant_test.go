@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/fingerprint"
+)
+
+func TestService_Variants(t *testing.T) {
+	svc, err := NewService(&config.ServiceConfig{
+		Name:    "nginx",
+		Type:    "nginx",
+		Headers: map[string]string{"Server": "nginx"},
+		Endpoints: []config.EndpointConfig{
+			{
+				Path: "/", Method: "GET", Status: 200, Template: "nginx/index.html",
+				Headers: map[string]string{"Content-Type": "text/html"},
+				Variants: []config.VariantConfig{
+					{Name: "curl", Match: config.MatchConfig{UserAgent: "^curl/"}, Status: 403,
+						Headers: map[string]string{"X-Frame-Options": "DENY"}},
+					{Name: "chrome-lan", Match: config.MatchConfig{JA4: []string{"t13d1516h2_*"}, Sources: []string{"10.0.0.0/8"}}},
+					{Name: "scanner", Match: config.MatchConfig{Headers: []string{"X-Scanner"}}, Status: 404},
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		ja4       string
+		source    string
+		header    string
+		variant   string
+		status    int
+	}{
+		{"curl", "curl/8.5.0", "", "192.0.2.1:4000", "", "curl", 403},
+		{"chrome on the LAN", "Mozilla/5.0", "t13d1516h2_8daaf6152771_02713d6af862", "10.1.2.3:4000", "", "chrome-lan", 200},
+		{"chrome elsewhere", "Mozilla/5.0", "t13d1516h2_8daaf6152771_02713d6af862", "192.0.2.1:4000", "", "", 200},
+		{"scanner header", "Mozilla/5.0", "", "192.0.2.1:4000", "X-Scanner", "scanner", 404},
+		{"plain", "Mozilla/5.0", "", "[::ffff:10.0.0.1]:4000", "", "", 200},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.source
+		r.Header.Set("User-Agent", tt.userAgent)
+		if tt.header != "" {
+			r.Header.Set(tt.header, "1")
+		}
+		r = r.WithContext(context.WithValue(r.Context(), fingerprint.JA4, &tt.ja4))
+
+		ep, ok := svc.Router().MatchRequest(r)
+		if !ok || ep.Variant != tt.variant || ep.Status != tt.status {
+			t.Fatalf("%s: Expected variant %q with %d, got %+v", tt.name, tt.variant, tt.status, ep)
+		}
+		if ep.Template != "nginx/index.html" || ep.Headers["Content-Type"] != "text/html" {
+			t.Fatalf("%s: Expected the endpoint's template and headers, got %+v", tt.name, ep)
+		}
+	}
+
+	if ep, _ := svc.Router().Match("GET", "/"); ep.Variant != "" {
+		t.Fatalf("Expected requests without a client to get the endpoint's own response, got variant %q", ep.Variant)
+	}
+}
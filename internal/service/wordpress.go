@@ -3,38 +3,74 @@ package service
 import (
 	"fmt"
 	"net/http"
-	"os"
 
+	"github.com/davidthuman/service-spoof/internal/canary"
 	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/status"
+	"github.com/davidthuman/service-spoof/internal/templates"
+	"github.com/davidthuman/service-spoof/internal/websocket"
 )
 
 // WordPressService implements the WordPress service
 type WordPressService struct {
-	name    string
-	sType   string
-	headers map[string]string
-	router  *Router
+	name      string
+	sType     string
+	headers   map[string]string
+	router    *Router
+	templates *templates.Dir
+	login     *wpLogin
 }
 
 // NewWordPressService creates a new WordPress service instance
-func NewWordPressService(cfg *config.ServiceConfig) (*WordPressService, error) {
+func NewWordPressService(cfg *config.ServiceConfig, dir *templates.Dir) (*WordPressService, error) {
+	login, err := newWPLogin(cfg, dir)
+	if err != nil {
+		return nil, err
+	}
 	s := &WordPressService{
-		name:    cfg.Name,
-		sType:   cfg.Type,
-		headers: cfg.Headers,
-		router:  NewRouter(),
+		name:      cfg.Name,
+		sType:     cfg.Type,
+		headers:   cfg.Headers,
+		router:    NewRouter(),
+		templates: dir,
+		login:     login,
 	}
 
-	// Build router from config endpoints
-	for _, ep := range cfg.Endpoints {
+	// Build router from config endpoints and default paths
+	for _, ep := range endpoints(cfg) {
+		when, err := compileCondition(ep.GetWhen())
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %s %s: %w", ep.Method, ep.Path, err)
+		}
+		match, err := newMatcher(ep.Match)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %s %s: %w", ep.Method, ep.Path, err)
+		}
+		render, err := newTemplate(cfg, &ep, dir)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %s %s: %w", ep.Method, ep.Path, err)
+		}
 		s.router.AddEndpoint(&Endpoint{
 			Path:     ep.Path,
 			Method:   ep.Method,
 			Status:   ep.Status,
 			Template: ep.Template,
 			Headers:  ep.Headers,
+
+			When:       when,
+			Variant:    ep.Variant,
+			Match:      match,
+			SOAP:       newSOAPEndpoint(&ep),
+			StatusPage: status.NewPage(ep.Type),
+			Canary:     canary.NewToken(&ep),
+			WebSocket:  websocket.NewEndpoint(&ep),
+			Render:     render,
+			Delay:      newDelay(cfg, &ep),
+			Required:   ep.Required,
+			Logging:    newLogging(cfg, &ep),
 		})
 	}
+	s.router.SetLogging(newLogging(cfg, nil))
 
 	return s, nil
 }
@@ -62,27 +98,47 @@ func (s *WordPressService) Router() *Router {
 // HandleRequest handles an HTTP request
 func (s *WordPressService) HandleRequest(w http.ResponseWriter, r *http.Request) {
 	// Match the request to an endpoint
-	endpoint, matched := s.router.Match(r.Method, r.URL.Path)
+	endpoint, matched := s.router.MatchRequest(r)
 	if !matched {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
 
+	// Take as long to answer as the backend would
+	endpoint.Delay.Wait(r)
+
 	// Apply endpoint-specific headers
 	for k, v := range endpoint.Headers {
 		w.Header().Set(k, v)
 	}
 
-	// Set the status code
-	w.WriteHeader(endpoint.Status)
+	// Logins are failed and their credentials captured, and the login page
+	// sets the test cookie
+	if s.login.Handle(w, r) {
+		return
+	}
 
-	// Load and serve the template if specified
-	if endpoint.Template != "" {
-		content, err := os.ReadFile(endpoint.Template)
-		if err != nil {
-			http.Error(w, fmt.Sprint(err), http.StatusInternalServerError)
-			return
-		}
-		w.Write(content)
+	// SOAP endpoints answer posted XML with faults
+	if endpoint.SOAP.Handle(w, r) {
+		return
+	}
+
+	// WebSocket endpoints complete handshakes and capture the frames sent
+	if endpoint.WebSocket.Handle(w, r) {
+		return
+	}
+
+	// Status endpoints answer with live server status pages
+	if endpoint.StatusPage.Handle(w, r) {
+		return
+	}
+
+	// Render the template for the request, or serve it as is. WordPress
+	// pages come from PHP, so they carry no validators.
+	if endpoint.Render != nil {
+		w.WriteHeader(endpoint.Status)
+		endpoint.Render.Execute(w, r)
+		return
 	}
+	serveTemplate(w, r, s.templates, endpoint, nil)
 }
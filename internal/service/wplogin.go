@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/templates"
+)
+
+const (
+	// wpLoginPath is where WordPress's login form is submitted
+	wpLoginPath = "/wp-login.php"
+
+	// wpTestCookie is the cookie WordPress sets on the login page to tell
+	// whether the browser accepts cookies, URL-encoded as PHP sends it
+	wpTestCookie      = "wordpress_test_cookie"
+	wpTestCookieValue = "WP%20Cookie%20check"
+)
+
+// wpLoginErrors are the messages WordPress shows for failed logins
+var wpLoginErrors = map[string]string{
+	"empty_username":     `<strong>Error:</strong> The username field is empty.`,
+	"empty_password":     `<strong>Error:</strong> The password field is empty.`,
+	"invalid_username":   `<strong>Error:</strong> The username <strong>%s</strong> is not registered on this site. If you are unsure of your username, try your email address instead.`,
+	"invalid_email":      `<strong>Error:</strong> Unknown email address. Check again or try your username.`,
+	"incorrect_password": `<strong>Error:</strong> The password you entered for the username <strong>%s</strong> is incorrect. <a href="/wp-login.php?action=lostpassword">Lost your password?</a>`,
+	"incorrect_email":    `<strong>Error:</strong> The password you entered for the email address <strong>%s</strong> is incorrect. <a href="/wp-login.php?action=lostpassword">Lost your password?</a>`,
+	"test_cookie":        `<strong>Error:</strong> Cookies are blocked or not supported by your browser. You must <a href="https://wordpress.org/documentation/article/cookies/#enable-cookies-in-your-browser">enable cookies</a> to use WordPress.`,
+}
+
+// wpLogin answers the login form of a WordPress service, failing every login
+// as WordPress fails a wrong password and capturing what was submitted
+type wpLogin struct {
+	users map[string]bool
+	page  *template.Template
+}
+
+// wpLoginPage is what the page answering a failed login is given
+type wpLoginPage struct {
+	Error    template.HTML
+	Username string
+}
+
+// newWPLogin returns the login form of a WordPress service, or nil if it is
+// disabled
+func newWPLogin(cfg *config.ServiceConfig, dir *templates.Dir) (*wpLogin, error) {
+	if !cfg.Login.GetEnabled() {
+		return nil, nil
+	}
+
+	name := cfg.Login.GetTemplate()
+	f, err := OpenTemplate(dir, name)
+	if err != nil {
+		return nil, fmt.Errorf("login: %w", err)
+	}
+	page, err := template.New(path.Base(name)).Parse(string(f.Content))
+	if err != nil {
+		return nil, fmt.Errorf("login: failed to parse template: %w", err)
+	}
+
+	var users []string
+	switch {
+	case cfg.Login != nil && len(cfg.Login.Users) > 0:
+		users = cfg.Login.Users
+	case cfg.CMS != nil && len(cfg.CMS.Users) > 0:
+		users = cfg.CMS.Users
+	default:
+		users = []string{"admin"}
+	}
+	l := &wpLogin{users: make(map[string]bool, len(users)), page: page}
+	for _, u := range users {
+		l.users[strings.ToLower(u)] = true
+	}
+	return l, nil
+}
+
+// Handle answers a login submitted to /wp-login.php, reporting whether it
+// did. Requests for the login page itself are given the test cookie and left
+// to be answered from the endpoint's template.
+func (l *wpLogin) Handle(w http.ResponseWriter, r *http.Request) bool {
+	if l == nil || r.URL.Path != wpLoginPath {
+		return false
+	}
+	if action := r.URL.Query().Get("action"); action != "" && action != "login" {
+		return false
+	}
+
+	cookie := wpTestCookie + "=" + wpTestCookieValue + "; path=/"
+	if r.TLS != nil {
+		cookie += "; secure"
+	}
+	w.Header().Add("Set-Cookie", cookie)
+	if r.Method != http.MethodPost {
+		return false
+	}
+
+	r.ParseForm()
+	username, password := r.PostForm.Get("log"), r.PostForm.Get("pwd")
+	if username != "" || password != "" {
+		database.CaptureCredential(r.Context(), database.Credential{Username: username, Password: password})
+	}
+
+	codes := l.fail(strings.TrimSpace(username), strings.TrimSpace(password))
+	if _, err := r.Cookie(wpTestCookie); err != nil && r.PostForm.Has("testcookie") {
+		codes = []string{"test_cookie"}
+	}
+
+	// WordPress fills the username back in only when the password was wrong
+	// or missing
+	data := wpLoginPage{}
+	for _, code := range codes {
+		msg := wpLoginErrors[code]
+		if strings.Contains(msg, "%s") {
+			msg = fmt.Sprintf(msg, html.EscapeString(strings.TrimSpace(username)))
+		}
+		data.Error += template.HTML("\t" + msg + "<br />\n")
+		if code == "incorrect_password" || code == "incorrect_email" || code == "empty_password" {
+			data.Username = username
+		}
+	}
+
+	var body bytes.Buffer
+	if err := l.page.Execute(&body, data); err != nil {
+		serviceLog.Error("failed to render login page", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return true
+	}
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("Expires", "Wed, 11 Jan 1984 05:00:00 GMT")
+	w.Header().Set("Cache-Control", "no-cache, must-revalidate, max-age=0, no-store, private")
+	w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+	return true
+}
+
+// fail returns the codes of the errors WordPress gives for a login with a
+// wrong password: the fields left empty, or whether the account exists
+func (l *wpLogin) fail(username, password string) []string {
+	if username == "" || password == "" {
+		var codes []string
+		if username == "" {
+			codes = append(codes, "empty_username")
+		}
+		if password == "" {
+			codes = append(codes, "empty_password")
+		}
+		return codes
+	}
+
+	email := strings.Contains(username, "@")
+	switch {
+	case l.users[strings.ToLower(username)] && email:
+		return []string{"incorrect_email"}
+	case l.users[strings.ToLower(username)]:
+		return []string{"incorrect_password"}
+	case email:
+		return []string{"invalid_email"}
+	}
+	return []string{"invalid_username"}
+}
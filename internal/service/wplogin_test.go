@@ -0,0 +1,72 @@
+package service
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/templates"
+)
+
+func TestWordPress_Login(t *testing.T) {
+	dir, err := templates.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open templates: %v", err)
+	}
+	defer dir.Close()
+
+	svc, err := NewService(&config.ServiceConfig{
+		Name:      "blog",
+		Type:      "wordpress",
+		Endpoints: []config.EndpointConfig{{Path: "/*", Method: "*", Status: 404}},
+		CMS:       &config.CMSConfig{Users: []string{"editor"}},
+	}, dir)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	tests := []struct {
+		form     url.Values
+		cookie   bool
+		error    string
+		username string
+	}{
+		{url.Values{"log": {"Editor"}, "pwd": {"hunter2"}, "testcookie": {"1"}}, true, "The password you entered for the username <strong>Editor</strong> is incorrect.", `value="Editor"`},
+		{url.Values{"log": {"<b>admin</b>"}, "pwd": {"hunter2"}}, false, "The username <strong>&lt;b&gt;admin&lt;/b&gt;</strong> is not registered on this site.", `value=""`},
+		{url.Values{"log": {"root@example.com"}, "pwd": {"toor"}}, false, "Unknown email address.", `value=""`},
+		{url.Values{"log": {"editor"}, "pwd": {""}}, false, "The password field is empty.", `value="editor"`},
+		{url.Values{"log": {"editor"}, "pwd": {"hunter2"}, "testcookie": {"1"}}, false, "Cookies are blocked or not supported by your browser.", `value=""`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/wp-login.php", strings.NewReader(tt.form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.cookie {
+			r.Header.Set("Cookie", "wordpress_test_cookie=WP%20Cookie%20check")
+		}
+		svc.HandleRequest(w, r)
+
+		if w.Code != 200 {
+			t.Fatalf("Expected a failed login to answer 200, got %d", w.Code)
+		}
+		if got := w.Header().Get("Set-Cookie"); got != "wordpress_test_cookie=WP%20Cookie%20check; path=/" {
+			t.Fatalf("Expected the test cookie to be set, got %q", got)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, tt.error) {
+			t.Fatalf("Expected %v to fail with %q, got %s", tt.form, tt.error, body)
+		}
+		if !strings.Contains(body, `name="log" id="user_login" aria-describedby="login_error" class="input" `+tt.username) {
+			t.Fatalf("Expected %v to fill in %s, got %s", tt.form, tt.username, body)
+		}
+	}
+
+	// The login page itself is answered by its endpoint, with the test cookie
+	w := httptest.NewRecorder()
+	svc.HandleRequest(w, httptest.NewRequest("GET", "/wp-login.php", nil))
+	if w.Code != 404 || w.Header().Get("Set-Cookie") == "" {
+		t.Fatalf("Expected the endpoint's 404 with the test cookie, got %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,83 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+// Email mails each request log as a JSON object through an SMTP server,
+// upgrading to TLS when the server offers STARTTLS
+type Email struct {
+	address string
+	from    string
+	to      []string
+	auth    smtp.Auth
+	enc     *encoder
+}
+
+// NewEmail creates a sink mailing the given fields of each request log from
+// one address to others through the SMTP server at address. A username
+// authenticates with PLAIN, which net/smtp only sends over TLS or to
+// localhost.
+func NewEmail(address, from string, to []string, username, password string, fields []string) (*Email, error) {
+	enc, err := newEncoder(fields)
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp address %q: %w", address, err)
+	}
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &Email{address: address, from: from, to: to, auth: auth, enc: enc}, nil
+}
+
+// Write mails one request log, with a subject naming the request and the
+// canary it touched, if any
+func (s *Email) Write(entry *database.RequestLog) error {
+	body, err := s.enc.encode(entry)
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("service-spoof: %s %s from %s", entry.Method, entry.Path, entry.SourceIP)
+	if entry.Canary != "" {
+		subject = fmt.Sprintf("service-spoof canary %s: %s %s from %s", entry.Canary, entry.Method, entry.Path, entry.SourceIP)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", headerSafe(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", entry.Timestamp.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: application/json; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.Write(body)
+	msg.WriteString("\r\n")
+
+	if err := smtp.SendMail(s.address, s.auth, s.from, s.to, msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// headerSafe strips line breaks and other control characters from a header
+// value, since request paths are attacker controlled
+func headerSafe(v string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, v)
+}
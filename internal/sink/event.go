@@ -0,0 +1,167 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+const (
+	// eventVendor is the device vendor and product of CEF and LEEF events
+	eventVendor = "service-spoof"
+
+	// maxEventName bounds the name of a CEF event, as the format does
+	maxEventName = 512
+
+	// leefTimeFormat is how LEEF events give their time, declared to the
+	// SIEM in Java's notation through devTimeFormat
+	leefTimeFormat     = "2006-01-02T15:04:05.000Z07:00"
+	leefTimeFormatJava = "yyyy-MM-dd'T'HH:mm:ss.SSSXXX"
+)
+
+// cefKeys and leefKeys are the dictionary keys of the request log fields
+// their format has one for. Other fields keep their JSON names.
+var (
+	cefKeys = map[string]string{
+		"timestamp":   "rt",
+		"source_ip":   "src",
+		"source_port": "spt",
+		"server_port": "dpt",
+		"host":        "dhost",
+		"method":      "requestMethod",
+		"user_agent":  "requestClientApplication",
+	}
+	leefKeys = map[string]string{
+		"timestamp":   "devTime",
+		"source_ip":   "src",
+		"source_port": "srcPort",
+		"server_port": "dstPort",
+	}
+)
+
+var (
+	cefHeaderEscaper  = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r", " ", "\n", " ")
+	cefValueEscaper   = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r", `\r`, "\n", `\n`)
+	leefHeaderEscaper = strings.NewReplacer("|", " ", "\t", " ", "\r", " ", "\n", " ")
+	leefValueEscaper  = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\r", `\r`, "\n", `\n`)
+)
+
+// eventEncoder renders request logs as CEF or LEEF events, for SIEMs such as
+// ArcSight, Splunk, and QRadar that parse those rather than JSON
+type eventEncoder struct {
+	fields  []string
+	leef    bool
+	version string
+}
+
+// newEventEncoder creates an encoder of events in a format holding the given
+// fields. No fields selects all of Fields.
+func newEventEncoder(format string, fields []string) (*eventEncoder, error) {
+	enc, err := newEncoder(fields)
+	if err != nil {
+		return nil, err
+	}
+	version := "0"
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+	return &eventEncoder{fields: enc.fields, leef: format == config.SyslogFormatLEEF, version: version}, nil
+}
+
+// encode renders one request log as an event
+func (e *eventEncoder) encode(entry *database.RequestLog) ([]byte, error) {
+	values, err := fieldValues(entry)
+	if err != nil {
+		return nil, err
+	}
+	id, name, severity := eventClass(entry)
+
+	var b bytes.Buffer
+	var attrs []string
+	keys := cefKeys
+	if e.leef {
+		keys = leefKeys
+		fmt.Fprintf(&b, "LEEF:1.0|%s|%s|%s|%s|", eventVendor, eventVendor,
+			leefHeaderEscaper.Replace(e.version), leefHeaderEscaper.Replace(id))
+		attrs = append(attrs, e.attr("sev", strconv.Itoa(severity)), e.attr("cat", id))
+	} else {
+		if len(name) > maxEventName {
+			name = strings.ToValidUTF8(name[:maxEventName], "")
+		}
+		fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|", eventVendor, eventVendor,
+			cefHeaderEscaper.Replace(e.version), cefHeaderEscaper.Replace(id), cefHeaderEscaper.Replace(name), severity)
+	}
+
+	for _, f := range e.fields {
+		key, ok := keys[f]
+		if !ok {
+			key = f
+		}
+		value := fieldText(values[f])
+		if f == "timestamp" {
+			if e.leef {
+				value = entry.Timestamp.Format(leefTimeFormat)
+				attrs = append(attrs, e.attr("devTimeFormat", leefTimeFormatJava))
+			} else {
+				value = strconv.FormatInt(entry.Timestamp.UnixMilli(), 10)
+			}
+		}
+		if value != "" {
+			attrs = append(attrs, e.attr(key, value))
+		}
+	}
+
+	// LEEF attributes are separated by tabs, and CEF extensions by spaces
+	sep := " "
+	if e.leef {
+		sep = "\t"
+	}
+	b.WriteString(strings.Join(attrs, sep))
+	return b.Bytes(), nil
+}
+
+// attr returns a key=value attribute with the value escaped for the format
+func (e *eventEncoder) attr(key, value string) string {
+	if e.leef {
+		return key + "=" + leefValueEscaper.Replace(value)
+	}
+	return key + "=" + cefValueEscaper.Replace(value)
+}
+
+// eventClass returns the ID, name, and severity out of 10 of a request log's
+// event: canary hits are the most severe, then malformed and tagged
+// requests, and requests from known research scanners the least
+func eventClass(entry *database.RequestLog) (string, string, int) {
+	name := entry.Method + " " + entry.Path
+	switch {
+	case entry.Canary != "":
+		return "canary", name, 9
+	case entry.Malformed:
+		return "malformed", "malformed request", 5
+	case len(entry.Tags) > 0:
+		return entry.Tags[0], name, 6
+	case entry.Scanner != "":
+		return "scanner", name, 1
+	}
+	return "request", name, 3
+}
+
+// fieldText returns a field's JSON value as plain text: strings unquoted,
+// lists of strings joined by commas, and anything else as JSON
+func fieldText(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return strings.Join(list, ",")
+	}
+	return string(raw)
+}
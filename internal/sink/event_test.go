@@ -0,0 +1,81 @@
+package sink
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+func TestSyslog_CEF(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	s, err := NewSyslog("tcp", ln.Addr().String(), "", config.SyslogFormatCEF,
+		[]string{"timestamp", "source_ip", "method", "path", "tags"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	defer s.Close()
+
+	entry := &database.RequestLog{
+		Timestamp: time.UnixMilli(1700000000123),
+		SourceIP:  "203.0.113.7",
+		Method:    "GET",
+		Path:      "/a|b?x=1",
+		Tags:      []string{"traversal", "lfi"},
+	}
+	if err := s.Write(entry); err != nil {
+		t.Fatalf("Failed to write entry: %v", err)
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Messages are framed by their length
+	r := bufio.NewReader(conn)
+	length, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatalf("Failed to read message length: %v", err)
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(length))
+	line := make([]byte, n)
+	if _, err := io.ReadFull(r, line); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+
+	want := `CEF:0|service-spoof|service-spoof|0|traversal|GET /a\|b?x=1|6|rt=1700000000123 src=203.0.113.7 requestMethod=GET path=/a|b?x\=1 tags=traversal,lfi`
+	_, msg, _ := strings.Cut(string(line), " - - ")
+	if msg != want {
+		t.Fatalf("Expected %q, got %q", want, line)
+	}
+}
+
+func TestEventEncoder_LEEF(t *testing.T) {
+	enc, err := newEventEncoder(config.SyslogFormatLEEF, []string{"source_ip", "server_port", "user_agent"})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+
+	body, err := enc.encode(&database.RequestLog{SourceIP: "203.0.113.7", ServerPort: 8080, UserAgent: "curl\t8", Canary: "aws-key"})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	want := "LEEF:1.0|service-spoof|service-spoof|0|canary|sev=9\tcat=canary\tsrc=203.0.113.7\tdstPort=8080\tuser_agent=curl\\t8"
+	if string(body) != want {
+		t.Fatalf("Expected %q, got %q", want, body)
+	}
+}
@@ -0,0 +1,123 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+// Fields are the request log fields sinks can emit, in the order they are
+// written
+var Fields = fieldNames()
+
+func fieldNames() []string {
+	t := reflect.TypeOf(database.RequestLog{})
+	fields := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// encoder renders request logs as JSON objects holding a selection of fields
+type encoder struct {
+	fields []string
+}
+
+// newEncoder creates an encoder for the given fields. No fields selects all
+// of Fields.
+func newEncoder(fields []string) (*encoder, error) {
+	if len(fields) == 0 {
+		return &encoder{fields: Fields}, nil
+	}
+
+	known := make(map[string]bool, len(Fields))
+	for _, f := range Fields {
+		known[f] = true
+	}
+	for _, f := range fields {
+		if !known[f] {
+			return nil, fmt.Errorf("unknown field %q (available: %s)", f, strings.Join(Fields, ", "))
+		}
+	}
+
+	return &encoder{fields: fields}, nil
+}
+
+// fieldValues returns the JSON value of each field of a request log
+func fieldValues(entry *database.RequestLog) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request log: %w", err)
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request log: %w", err)
+	}
+	return values, nil
+}
+
+// encode renders one request log without a trailing newline
+func (e *encoder) encode(entry *database.RequestLog) ([]byte, error) {
+	values, err := fieldValues(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are written in the configured order rather than the sorted order
+	// of a marshalled map
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for i, f := range e.fields {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		key, _ := json.Marshal(f)
+		out.Write(key)
+		out.WriteByte(':')
+		out.Write(values[f])
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+// JSON writes each logged request as a single line JSON object, so captures
+// can be collected from stdout by docker logs or journald
+type JSON struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *encoder
+}
+
+// NewJSON creates a sink writing the given fields of each request log to w.
+// No fields selects all of Fields.
+func NewJSON(w io.Writer, fields []string) (*JSON, error) {
+	enc, err := newEncoder(fields)
+	if err != nil {
+		return nil, err
+	}
+	return &JSON{w: w, enc: enc}, nil
+}
+
+// Write emits one request log as a line of JSON
+func (s *JSON) Write(entry *database.RequestLog) error {
+	line, err := s.enc.encode(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(line); err != nil {
+		return fmt.Errorf("failed to write request log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package sink
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+func TestJSON_Fields(t *testing.T) {
+	var buf bytes.Buffer
+	s, err := NewJSON(&buf, []string{"source_ip", "path", "flags"})
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+
+	entry := &database.RequestLog{SourceIP: "203.0.113.7", Path: "/wp-login.php", Method: "GET"}
+	entry.Flags.Tor = true
+	if err := s.Write(entry); err != nil {
+		t.Fatalf("Failed to write entry: %v", err)
+	}
+
+	want := `{"source_ip":"203.0.113.7","path":"/wp-login.php","flags":{"tor":true,"datacenter":false,"proxy":false}}` + "\n"
+	if buf.String() != want {
+		t.Fatalf("Expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestNewJSON_UnknownField(t *testing.T) {
+	if _, err := NewJSON(&bytes.Buffer{}, []string{"password"}); err == nil {
+		t.Fatal("Expected an error for an unknown field")
+	}
+}
@@ -0,0 +1,35 @@
+package sink
+
+import (
+	"strconv"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/loki"
+)
+
+// Loki ships request logs to Loki, labelled by service, port, source country,
+// and JA4 fingerprint
+type Loki struct {
+	client *loki.Client
+	enc    *encoder
+}
+
+// NewLoki creates a sink pushing every request log through client
+func NewLoki(client *loki.Client) *Loki {
+	return &Loki{client: client, enc: &encoder{fields: Fields}}
+}
+
+// Write queues one request log for the next push
+func (s *Loki) Write(entry *database.RequestLog) error {
+	line, err := s.enc.encode(entry)
+	if err != nil {
+		return err
+	}
+	s.client.Push(map[string]string{
+		"service":     entry.ServiceName,
+		"port":        strconv.Itoa(entry.ServerPort),
+		"country":     entry.Country,
+		"fingerprint": entry.JA4Fingerprint,
+	}, entry.Timestamp, string(line))
+	return nil
+}
@@ -0,0 +1,56 @@
+package sink
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/expr"
+)
+
+// New creates the sink described by a sink configuration
+func New(cfg *config.SinkConfig) (database.Sink, error) {
+	switch cfg.Type {
+	case config.SinkTypeStdout:
+		return NewJSON(os.Stdout, cfg.Fields)
+	case config.SinkTypeWebhook:
+		return NewWebhook(cfg.URL, cfg.Headers, cfg.Fields)
+	case config.SinkTypeSyslog:
+		network := cfg.Network
+		if network == "" {
+			network = "udp"
+		}
+		var tlsConfig *tls.Config
+		if network == "tls" {
+			var err error
+			if tlsConfig, err = SyslogTLSConfig(cfg.CAFile); err != nil {
+				return nil, err
+			}
+		}
+		return NewSyslog(network, cfg.Address, cfg.Tag, cfg.Format, cfg.Fields, tlsConfig)
+	case config.SinkTypeEmail:
+		return NewEmail(cfg.Address, cfg.From, cfg.To, cfg.Username, cfg.Password, cfg.Fields)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+}
+
+// NewFilter compiles a filter expression over request log variables such as
+// service_name, country, and scanner. An empty expression passes everything
+// and returns nil.
+func NewFilter(source string) (database.Filter, error) {
+	if source == "" {
+		return nil, nil
+	}
+	prog, err := expr.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := prog.Check(database.EnvVars); err != nil {
+		return nil, err
+	}
+	return func(entry *database.RequestLog) bool {
+		return prog.Eval(entry.Env())
+	}, nil
+}
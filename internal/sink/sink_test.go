@@ -0,0 +1,31 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+func TestNewFilter(t *testing.T) {
+	filter, err := NewFilter(`service_name == "wordpress" && !scanner && response_status < 500`)
+	if err != nil {
+		t.Fatalf("Failed to create filter: %v", err)
+	}
+
+	if !filter(&database.RequestLog{ServiceName: "wordpress", ResponseStatus: 200}) {
+		t.Fatal("Expected a wordpress request to pass")
+	}
+	if filter(&database.RequestLog{ServiceName: "wordpress", ResponseStatus: 200, Scanner: "censys"}) {
+		t.Fatal("Expected a scanner request not to pass")
+	}
+	if filter(&database.RequestLog{ServiceName: "nginx", ResponseStatus: 200}) {
+		t.Fatal("Expected an nginx request not to pass")
+	}
+
+	if f, err := NewFilter(""); err != nil || f != nil {
+		t.Fatalf("Expected no filter for an empty expression, got %v", err)
+	}
+	if _, err := NewFilter(`service == "nginx"`); err == nil {
+		t.Fatal("Expected an error for an unknown variable")
+	}
+}
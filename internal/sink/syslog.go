@@ -0,0 +1,140 @@
+package sink
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+const (
+	// syslogPriority is facility local0 with severity informational
+	syslogPriority = 16*8 + 6
+
+	// syslogTimeout bounds connecting to and writing to the collector
+	syslogTimeout = 10 * time.Second
+
+	// defaultSyslogTag is the APP-NAME used when no tag is configured
+	defaultSyslogTag = "service-spoof"
+)
+
+// bodyEncoder renders the body of a message sent for a request log
+type bodyEncoder interface {
+	encode(entry *database.RequestLog) ([]byte, error)
+}
+
+// Syslog sends each request log as an RFC 5424 message to a collector over
+// UDP, TCP, or TLS, with a JSON, CEF, or LEEF body. TCP and TLS messages are
+// framed by octet counting (RFC 6587, RFC 5425), and dropped connections are
+// redialed on the next write.
+type Syslog struct {
+	network   string
+	address   string
+	tag       string
+	hostname  string
+	enc       bodyEncoder
+	tlsConfig *tls.Config
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslog creates a sink for the collector at address. A tlsConfig is
+// required for the tls network.
+func NewSyslog(network, address, tag, format string, fields []string, tlsConfig *tls.Config) (*Syslog, error) {
+	var enc bodyEncoder
+	var err error
+	switch format {
+	case "", config.SyslogFormatJSON:
+		enc, err = newEncoder(fields)
+	case config.SyslogFormatCEF, config.SyslogFormatLEEF:
+		enc, err = newEventEncoder(format, fields)
+	default:
+		err = fmt.Errorf("unknown syslog format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &Syslog{network: network, address: address, tag: tag, hostname: hostname, enc: enc, tlsConfig: tlsConfig}, nil
+}
+
+// SyslogTLSConfig returns the TLS configuration verifying collectors
+// against the CA certificates in caFile, or the system roots if it is empty
+func SyslogTLSConfig(caFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	cfg.RootCAs = x509.NewCertPool()
+	if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+	}
+	return cfg, nil
+}
+
+// Write sends one request log
+func (s *Syslog) Write(entry *database.RequestLog) error {
+	body, err := s.enc.encode(entry)
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		syslogPriority, entry.Timestamp.UTC().Format(time.RFC3339Nano), s.hostname, s.tag, os.Getpid(), body)
+	if s.network != "udp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		var conn net.Conn
+		var err error
+		if s.network == "tls" {
+			conn, err = tls.DialWithDialer(&net.Dialer{Timeout: syslogTimeout}, "tcp", s.address, s.tlsConfig)
+		} else {
+			conn, err = net.DialTimeout(s.network, s.address, syslogTimeout)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog collector: %w", err)
+		}
+		s.conn = conn
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("failed to write to syslog collector: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection to the collector
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+// webhookTimeout bounds each webhook request
+const webhookTimeout = 10 * time.Second
+
+// Webhook posts each request log as a JSON object to a URL
+type Webhook struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	enc     *encoder
+}
+
+// NewWebhook creates a sink posting the given fields of each request log to
+// url with the extra headers
+func NewWebhook(url string, headers map[string]string, fields []string) (*Webhook, error) {
+	enc, err := newEncoder(fields)
+	if err != nil {
+		return nil, err
+	}
+	return &Webhook{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: webhookTimeout},
+		enc:     enc,
+	}, nil
+}
+
+// Write posts one request log
+func (s *Webhook) Write(entry *database.RequestLog) error {
+	body, err := s.enc.encode(entry)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
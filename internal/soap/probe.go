@@ -0,0 +1,224 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Tags given to requests carrying XML attacks
+const (
+	TagXXE     = "xxe"
+	TagXMLBomb = "xml-bomb"
+	TagDTD     = "dtd"
+)
+
+// Envelope namespaces of SOAP 1.1 and 1.2
+const (
+	Namespace11 = "http://schemas.xmlsoap.org/soap/envelope/"
+	Namespace12 = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// xincludeNamespace is the namespace of XInclude elements
+const xincludeNamespace = "http://www.w3.org/2001/XInclude"
+
+// maxExpansion is how far entities may expand before a document counts as an
+// entity expansion (billion laughs) attack
+const maxExpansion = 1 << 20
+
+var (
+	entityPattern    = regexp.MustCompile(`<!ENTITY\s+(%\s+)?([^\s%>]+)\s+(?:(SYSTEM|PUBLIC)\s+)?("[^"]*"|'[^']*')(?:\s*("[^"]*"|'[^']*'))?`)
+	doctypePattern   = regexp.MustCompile(`^DOCTYPE\s+[^\s\[>]+\s+(SYSTEM|PUBLIC)\s+("[^"]*"|'[^']*')(?:\s*("[^"]*"|'[^']*'))?`)
+	referencePattern = regexp.MustCompile(`[&%]([^\s;&%]+);`)
+)
+
+// Probe is what a posted XML document reveals about the attacks it carries.
+// Documents are only tokenized, so DTDs are never processed and entities
+// never expanded or fetched.
+type Probe struct {
+	// Doctype is set for documents with a DOCTYPE, which SOAP forbids
+	Doctype bool
+
+	// Entities are the names of the entities the DTD declares, and
+	// Parameter is set if any are parameter entities, as blind XXE uses
+	Entities  []string
+	Parameter bool
+
+	// External are the URIs of external entities, DTDs, and XIncludes
+	External []string
+	XInclude bool
+
+	// Expansion is the size in bytes the largest entity would expand to
+	Expansion int64
+
+	// Root is the document element. Namespace and Operation are the
+	// envelope namespace and the first element of the body of SOAP envelopes.
+	Root      xml.Name
+	Namespace string
+	Operation xml.Name
+
+	// Err is the syntax error the document was rejected with, if any
+	Err error
+}
+
+// Tags returns the attack tags of a probe
+func (p *Probe) Tags() []string {
+	tags := make([]string, 0)
+	if len(p.Entities) > 0 || len(p.External) > 0 || p.XInclude {
+		tags = append(tags, TagXXE)
+	} else if p.Doctype {
+		tags = append(tags, TagDTD)
+	}
+	if p.Expansion > maxExpansion {
+		tags = append(tags, TagXMLBomb)
+	}
+	return tags
+}
+
+// Inspect tokenizes a request body, returning nil if it is not XML
+func Inspect(body []byte) *Probe {
+	body = bytes.TrimLeft(body, " \t\r\n\ufeff")
+	if !bytes.HasPrefix(body, []byte("<")) {
+		return nil
+	}
+
+	p := &Probe{Entities: make([]string, 0), External: make([]string, 0)}
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.Entity = make(map[string]string)
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	depth := 0
+	inBody := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			p.Err = err
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.Directive:
+			if bytes.HasPrefix(t, []byte("DOCTYPE")) {
+				p.Doctype = true
+				p.inspectDTD(string(t), d.Entity)
+			}
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				p.Root = t.Name
+			}
+			switch {
+			case t.Name.Space == xincludeNamespace && t.Name.Local == "include":
+				p.XInclude = true
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "href" {
+						p.External = append(p.External, attr.Value)
+					}
+				}
+			case depth == 1 && t.Name.Local == "Envelope" && (t.Name.Space == Namespace11 || t.Name.Space == Namespace12):
+				p.Namespace = t.Name.Space
+			case depth == 2 && p.Namespace != "" && t.Name.Space == p.Namespace && t.Name.Local == "Body":
+				inBody = true
+			case depth == 3 && inBody && p.Operation.Local == "":
+				p.Operation = t.Name
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	return p
+}
+
+// inspectDTD records the entities a DOCTYPE declares, and makes them known
+// to the decoder so references to them are not syntax errors
+func (p *Probe) inspectDTD(doctype string, known map[string]string) {
+	if m := doctypePattern.FindStringSubmatch(doctype); m != nil {
+		p.External = append(p.External, systemID(m[1], m[2], m[3]))
+	}
+
+	values := make(map[string]string)
+	for _, m := range entityPattern.FindAllStringSubmatch(doctype, -1) {
+		name := m[2]
+		p.Entities = append(p.Entities, name)
+		if m[1] != "" {
+			p.Parameter = true
+		} else {
+			known[name] = ""
+		}
+		if m[3] != "" {
+			p.External = append(p.External, systemID(m[3], m[4], m[5]))
+			continue
+		}
+		values[name] = unquote(m[4])
+	}
+
+	sizes := make(map[string]int64)
+	for name := range values {
+		if size := expansion(name, values, sizes, make(map[string]bool)); size > p.Expansion {
+			p.Expansion = size
+		}
+	}
+}
+
+// expansion returns the size an entity expands to, capped past maxExpansion
+func expansion(name string, values map[string]string, sizes map[string]int64, visiting map[string]bool) int64 {
+	if size, ok := sizes[name]; ok {
+		return size
+	}
+	value, ok := values[name]
+	if !ok || visiting[name] {
+		return 0
+	}
+	visiting[name] = true
+
+	size := int64(len(value))
+	for _, ref := range referencePattern.FindAllStringSubmatch(value, -1) {
+		if _, ok := values[ref[1]]; !ok {
+			continue
+		}
+		size += expansion(ref[1], values, sizes, visiting) - int64(len(ref[0]))
+		if size > maxExpansion {
+			size = maxExpansion + 1
+			break
+		}
+	}
+
+	delete(visiting, name)
+	sizes[name] = size
+	return size
+}
+
+// systemID returns the URI of an external identifier, which for PUBLIC
+// identifiers follows the public ID
+func systemID(kind, first, second string) string {
+	if kind == "PUBLIC" && second != "" {
+		return unquote(second)
+	}
+	return unquote(first)
+}
+
+func unquote(s string) string {
+	return strings.Trim(s, `"'`)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the probe of a request's body
+func NewContext(ctx context.Context, p *Probe) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the probe of a request's body, or nil if it is not XML
+func FromContext(ctx context.Context) *Probe {
+	p, _ := ctx.Value(contextKey{}).(*Probe)
+	return p
+}
@@ -0,0 +1,153 @@
+// Package soap emulates SOAP web service endpoints and inspects posted XML
+// for the external entity (XXE) and entity expansion probes attackers send
+// them
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// MaxBody bounds how much of a request body is inspected
+const MaxBody = 1 << 20
+
+// Endpoint answers posted XML with the faults of a SOAP stack
+type Endpoint struct {
+	stack string
+}
+
+// NewEndpoint creates a SOAP endpoint. A nil config imitates ASP.NET.
+func NewEndpoint(cfg *config.SOAPConfig) *Endpoint {
+	e := &Endpoint{stack: config.SOAPStackDotNet}
+	if cfg != nil && cfg.Stack != "" {
+		e.stack = cfg.Stack
+	}
+	return e
+}
+
+// Handle answers a request with a SOAP fault, reporting whether it did.
+// GET and HEAD requests, such as for the ?wsdl description, are left to be
+// answered from the endpoint's template.
+func (e *Endpoint) Handle(w http.ResponseWriter, r *http.Request) bool {
+	if e == nil || r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return false
+	}
+
+	probe := FromContext(r.Context())
+	if probe == nil && r.Body != nil {
+		body, _ := io.ReadAll(io.LimitReader(r.Body, MaxBody))
+		probe = Inspect(body)
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	soap12 := mediaType == "application/soap+xml"
+	if probe != nil && probe.Namespace != "" {
+		soap12 = probe.Namespace == Namespace12
+	}
+
+	action := strings.Trim(r.Header.Get("SOAPAction"), `"`)
+	if soap12 {
+		action = params["action"]
+	}
+
+	writeFault(w, e.stack, soap12, e.reason(probe, action))
+	return true
+}
+
+// reason returns the fault string the stack rejects a request body with
+func (e *Endpoint) reason(p *Probe, action string) string {
+	if e.stack == config.SOAPStackCXF {
+		switch {
+		case p == nil:
+			return "Error reading XMLStreamReader: Unexpected EOF in prolog\n at [row,col {unknown-source}]: [1,0]"
+		case p.Doctype:
+			return "Error reading XMLStreamReader: Received event DTD, when expecting a start element."
+		case p.Err != nil:
+			return fmt.Sprintf("Error reading XMLStreamReader: Unexpected character in markup\n at [row,col {unknown-source}]: [%d,1]", syntaxLine(p.Err))
+		case p.Namespace == "":
+			return fmt.Sprintf("Error reading XMLStreamReader: Unexpected element %s, expected {%s}Envelope", clark(p.Root), Namespace11)
+		}
+		return fmt.Sprintf("Message part %s was not recognized.  (Does it exist in service WSDL?)", clark(p.Operation))
+	}
+
+	const unreadable = "Server was unable to read request. ---> There is an error in XML document (%d, %d). ---> %s"
+	switch {
+	case p == nil:
+		return fmt.Sprintf(unreadable, 0, 0, "Root element is missing.")
+	case p.Doctype:
+		return fmt.Sprintf(unreadable, 1, 1, "For security reasons DTD is prohibited in this XML document. "+
+			"To enable DTD processing set the DtdProcessing property on XmlReaderSettings to Parse and pass the settings into XmlReader.Create method.")
+	case p.Err != nil:
+		line := syntaxLine(p.Err)
+		return fmt.Sprintf(unreadable, line, 1, fmt.Sprintf("Data at the root level is invalid. Line %d, position 1.", line))
+	case p.Namespace == "":
+		return fmt.Sprintf("Possible SOAP version mismatch: Envelope namespace %s was unexpected. Expecting %s.", p.Root.Space, Namespace11)
+	}
+	return fmt.Sprintf("Server did not recognize the value of HTTP Header SOAPAction: %s.", action)
+}
+
+// writeFault writes a client fault in the envelope and formatting of a stack
+func writeFault(w http.ResponseWriter, stack string, soap12 bool, reason string) {
+	var buf bytes.Buffer
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(reason))
+
+	namespace, contentType := Namespace11, "text/xml"
+	if soap12 {
+		namespace, contentType = Namespace12, "application/soap+xml"
+	}
+
+	if stack == config.SOAPStackCXF {
+		contentType += ";charset=UTF-8"
+		fmt.Fprintf(&buf, `<soap:Envelope xmlns:soap="%s"><soap:Body><soap:Fault>`, namespace)
+	} else {
+		contentType += "; charset=utf-8"
+		fmt.Fprintf(&buf, `<?xml version="1.0" encoding="utf-8"?><soap:Envelope xmlns:soap="%s" `+
+			`xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema">`+
+			`<soap:Body><soap:Fault>`, namespace)
+	}
+
+	if soap12 {
+		fmt.Fprintf(&buf, `<soap:Code><soap:Value>soap:Sender</soap:Value></soap:Code>`+
+			`<soap:Reason><soap:Text xml:lang="en">%s</soap:Text></soap:Reason>`, escaped.String())
+		if stack != config.SOAPStackCXF {
+			buf.WriteString(`<soap:Detail />`)
+		}
+	} else {
+		fmt.Fprintf(&buf, `<faultcode>soap:Client</faultcode><faultstring>%s</faultstring>`, escaped.String())
+		if stack != config.SOAPStackCXF {
+			buf.WriteString(`<detail />`)
+		}
+	}
+	buf.WriteString(`</soap:Fault></soap:Body></soap:Envelope>`)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(buf.Bytes())
+}
+
+// syntaxLine returns the line of a syntax error, or 1
+func syntaxLine(err error) int {
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Line
+	}
+	return 1
+}
+
+// clark formats a name in Clark notation, as Java stacks print names
+func clark(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
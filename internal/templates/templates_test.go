@@ -0,0 +1,67 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDir_ReadFile(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "services", "web"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "services", "web", "index.html"), []byte("It works!"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "services", "web", "link.html")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	dir, err := Open(root)
+	if err != nil {
+		t.Fatalf("Failed to open templates: %v", err)
+	}
+	defer dir.Close()
+
+	for _, name := range []string{
+		"./services/web/index.html",
+		"services/web/../web/index.html",
+		filepath.Join(root, "services", "web", "index.html"),
+	} {
+		content, err := dir.ReadFile(name)
+		if err != nil || string(content) != "It works!" {
+			t.Fatalf("Expected %s to read the template, got %q, %v", name, content, err)
+		}
+	}
+
+	for _, name := range []string{
+		"../secret",
+		"services/../../secret",
+		outside,
+		"/etc/passwd",
+		"services/web/link.html",
+		"builtin:../config.yaml",
+	} {
+		if content, err := dir.ReadFile(name); err == nil {
+			t.Fatalf("Expected %s to be refused, got %q", name, content)
+		}
+	}
+
+	content, err := dir.ReadFile("builtin:nginx/404.html")
+	if err != nil || !strings.Contains(string(content), "nginx") {
+		t.Fatalf("Expected the built-in nginx 404 page, got %q, %v", content, err)
+	}
+
+	if err := Check(root, "builtin:nginx/missing.html"); err == nil {
+		t.Fatalf("Expected a missing built-in template to be rejected")
+	}
+	if err := Check(root, "../secret"); err == nil {
+		t.Fatalf("Expected a path outside the root to be rejected")
+	}
+}
@@ -0,0 +1,147 @@
+package watermark
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Marking methods
+const (
+	MethodComment    = "comment"
+	MethodWhitespace = "whitespace"
+)
+
+// tokenBytes is the length of a token, encoded in 16 hex digits or 64
+// whitespace characters
+const tokenBytes = 8
+
+var (
+	commentPattern    = regexp.MustCompile(`<!-- ([0-9a-f]{16}) -->`)
+	whitespacePattern = regexp.MustCompile(`(?m)(?:^|[^ \t])([ \t]{64})\r?$`)
+)
+
+// Token derives the token marking the responses of a deployment from its
+// identifier
+func Token(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:tokenBytes])
+}
+
+// Marker embeds a deployment's token into HTML documents, so that content
+// scraped from the spoof and reposted elsewhere can be attributed to it
+type Marker struct {
+	token      string
+	comment    bool
+	whitespace bool
+}
+
+// NewMarker creates a marker for the deployment id using the given methods,
+// all of them if none are given
+func NewMarker(id string, methods []string) (*Marker, error) {
+	m := &Marker{token: Token(id)}
+	if len(methods) == 0 {
+		methods = []string{MethodComment, MethodWhitespace}
+	}
+	for _, method := range methods {
+		switch method {
+		case MethodComment:
+			m.comment = true
+		case MethodWhitespace:
+			m.whitespace = true
+		default:
+			return nil, fmt.Errorf("unknown watermark method %q", method)
+		}
+	}
+	return m, nil
+}
+
+// Token returns the token the marker embeds
+func (m *Marker) Token() string {
+	return m.token
+}
+
+// Mark returns the document with the token embedded. The comment is placed
+// before the closing body tag, or at the end of documents without one, and
+// the whitespace marker trails the first line.
+func (m *Marker) Mark(doc []byte) []byte {
+	if m == nil {
+		return doc
+	}
+
+	if m.comment {
+		comment := []byte("<!-- " + m.token + " -->\n")
+		i := bytes.LastIndex(bytes.ToLower(doc), []byte("</body>"))
+		if i < 0 {
+			i = len(doc)
+		}
+		doc = append(doc[:i:i], append(comment, doc[i:]...)...)
+	}
+
+	if m.whitespace {
+		i := bytes.IndexByte(doc, '\n')
+		if i < 0 {
+			i = len(doc)
+		}
+		// Strip trailing whitespace so the marker is the whole run
+		j := len(bytes.TrimRight(doc[:i], " \t"))
+		doc = append(doc[:j:j], append([]byte(encodeWhitespace(m.token)), doc[i:]...)...)
+	}
+
+	return doc
+}
+
+// Find returns the distinct tokens embedded in content by any method, in
+// the order they appear
+func Find(content []byte) []string {
+	tokens := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(token string) {
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	for _, match := range commentPattern.FindAllSubmatch(content, -1) {
+		add(string(match[1]))
+	}
+	for _, match := range whitespacePattern.FindAllSubmatch(content, -1) {
+		add(decodeWhitespace(string(match[1])))
+	}
+	return tokens
+}
+
+// encodeWhitespace encodes a hex token in its bits, most significant first,
+// as spaces for zeros and tabs for ones
+func encodeWhitespace(token string) string {
+	raw, _ := hex.DecodeString(token)
+	var b strings.Builder
+	for _, c := range raw {
+		for bit := 7; bit >= 0; bit-- {
+			if c>>bit&1 == 1 {
+				b.WriteByte('\t')
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+	}
+	return b.String()
+}
+
+// decodeWhitespace decodes a run of whitespace written by encodeWhitespace
+func decodeWhitespace(run string) string {
+	raw := make([]byte, len(run)/8)
+	for i := range raw {
+		for _, c := range run[i*8 : i*8+8] {
+			raw[i] <<= 1
+			if c == '\t' {
+				raw[i] |= 1
+			}
+		}
+	}
+	return hex.EncodeToString(raw)
+}
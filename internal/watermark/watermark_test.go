@@ -0,0 +1,44 @@
+package watermark
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMarker_MarkFind(t *testing.T) {
+	doc := []byte("<!DOCTYPE html>\n<html><body>\n<h1>It works!</h1>\n</BODY></html>\n")
+
+	m, err := NewMarker("honeypot-eu-1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create marker: %v", err)
+	}
+	marked := m.Mark(append([]byte(nil), doc...))
+
+	if !bytes.Contains(marked, []byte("<!-- "+m.Token()+" -->\n</BODY>")) {
+		t.Fatalf("Expected the comment before the closing body tag, got %q", marked)
+	}
+	if !strings.HasPrefix(string(marked), "<!DOCTYPE html>"+encodeWhitespace(m.Token())+"\n") {
+		t.Fatalf("Expected whitespace trailing the first line, got %q", marked)
+	}
+	if tokens := Find(marked); len(tokens) != 1 || tokens[0] != Token("honeypot-eu-1") {
+		t.Fatalf("Expected to find token %s, got %v", m.Token(), tokens)
+	}
+
+	// Whitespace alone survives scrapers that strip comments
+	m, _ = NewMarker("honeypot-eu-1", []string{MethodWhitespace})
+	stripped := strings.ReplaceAll(string(m.Mark([]byte(string(doc)))), "\n", "\r\n")
+	if tokens := Find([]byte(stripped)); len(tokens) != 1 || tokens[0] != m.Token() {
+		t.Fatalf("Expected to find token %s in whitespace, got %v", m.Token(), tokens)
+	}
+
+	if tokens := Find(doc); len(tokens) != 0 {
+		t.Fatalf("Expected no tokens in an unmarked document, got %v", tokens)
+	}
+	if Token("honeypot-eu-2") == m.Token() {
+		t.Fatalf("Expected deployments to get distinct tokens")
+	}
+	if _, err := NewMarker("x", []string{"zero-width"}); err == nil {
+		t.Fatalf("Expected an unknown method to be rejected")
+	}
+}
@@ -0,0 +1,386 @@
+// Package websocket completes the WebSocket handshakes of websocket
+// endpoints and captures every frame clients send over the connection for a
+// while before closing it, so what scanners probing for WebSocket APIs send
+// once upgraded is seen as well as the handshake
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+// TagUpgraded tags requests whose connection was upgraded to WebSocket
+const TagUpgraded = "websocket"
+
+const (
+	// acceptGUID is what keys are hashed with into Sec-WebSocket-Accept
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// maxFrames bounds the frames captured on a connection
+	maxFrames = 1000
+
+	// maxPayload bounds the payload of a frame, past which the connection is
+	// closed as a real server closes it, and maxStored the payload stored of
+	// each frame
+	maxPayload = 1 << 20
+	maxStored  = 64 << 10
+
+	// writeTimeout bounds each write, and closeWait how long the client has
+	// to answer the close frame ending a capture
+	writeTimeout = 5 * time.Second
+	closeWait    = 2 * time.Second
+)
+
+// Opcodes of frames
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xa
+)
+
+// Close status codes sent
+const (
+	closeNormal        = 1000
+	closeProtocolError = 1002
+	closeTooBig        = 1009
+)
+
+// opcodeNames name the opcodes of frames
+var opcodeNames = map[byte]string{
+	OpContinuation: "continuation",
+	OpText:         "text",
+	OpBinary:       "binary",
+	OpClose:        "close",
+	OpPing:         "ping",
+	OpPong:         "pong",
+}
+
+// Frame is a frame a client sent
+type Frame struct {
+	Time   time.Time
+	Opcode byte
+	Fin    bool
+
+	// Length is the length of the payload sent, and Payload its unmasked
+	// content, up to the first 64 KiB
+	Length  int64
+	Payload []byte
+}
+
+// Type names the frame's opcode, or "unknown" for reserved opcodes
+func (f *Frame) Type() string {
+	if name, ok := opcodeNames[f.Opcode]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Capture is what happened on a request's connection once upgraded
+type Capture struct {
+	upgraded bool
+	protocol string
+	frames   []Frame
+}
+
+// Upgraded reports whether the handshake completed
+func (c *Capture) Upgraded() bool {
+	return c != nil && c.upgraded
+}
+
+// Protocol returns the subprotocol selected, if any
+func (c *Capture) Protocol() string {
+	if c == nil {
+		return ""
+	}
+	return c.protocol
+}
+
+// Frames returns the frames the client sent
+func (c *Capture) Frames() []Frame {
+	if c == nil {
+		return nil
+	}
+	return c.frames
+}
+
+type contextKey struct{}
+
+// NewContext returns a context capturing the frames of its request's
+// connection
+func NewContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, &Capture{})
+}
+
+// FromContext returns the capture of a request's connection, or nil if it is
+// not captured
+func FromContext(ctx context.Context) *Capture {
+	c, _ := ctx.Value(contextKey{}).(*Capture)
+	return c
+}
+
+// Endpoint accepts WebSocket handshakes
+type Endpoint struct {
+	duration     time.Duration
+	subprotocols []string
+	greeting     string
+}
+
+// NewEndpoint returns the WebSocket handling of an endpoint, or nil if it is
+// not a websocket endpoint
+func NewEndpoint(ep *config.EndpointConfig) *Endpoint {
+	if ep.Type != config.EndpointTypeWebSocket {
+		return nil
+	}
+	e := &Endpoint{duration: ep.WebSocket.GetDuration()}
+	if ep.WebSocket != nil {
+		e.subprotocols = ep.WebSocket.Subprotocols
+		e.greeting = ep.WebSocket.Greeting
+	}
+	return e
+}
+
+// IsUpgrade reports whether a request asks to upgrade to WebSocket
+func IsUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodGet && r.ProtoAtLeast(1, 1) && r.ProtoMajor == 1 &&
+		headerHasToken(r.Header, "Connection", "upgrade") && headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+// Handle completes a WebSocket handshake and captures the frames the client
+// sends until the endpoint's duration is up, the client closes, or it breaks
+// the protocol, reporting whether it answered the request. Requests that do
+// not ask for an upgrade are left to be answered from the endpoint's
+// template. Headers already set on w are sent with the handshake.
+func (e *Endpoint) Handle(w http.ResponseWriter, r *http.Request) bool {
+	if e == nil || !IsUpgrade(r) {
+		return false
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		w.WriteHeader(http.StatusUpgradeRequired)
+		return true
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if nonce, err := base64.StdEncoding.DecodeString(key); err != nil || len(nonce) != 16 {
+		w.WriteHeader(http.StatusBadRequest)
+		return true
+	}
+
+	header := w.Header().Clone()
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	capture := FromContext(r.Context())
+	if capture == nil {
+		capture = &Capture{}
+	}
+	capture.protocol = e.subprotocol(r)
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := conn.Write(handshake(header, key, capture.protocol)); err != nil {
+		return true
+	}
+	capture.upgraded = true
+
+	c := &session{conn: conn, r: brw.Reader, capture: capture}
+	if e.greeting != "" {
+		c.write(OpText, []byte(e.greeting))
+	}
+	c.run(time.Now().Add(e.duration))
+	return true
+}
+
+// subprotocol returns the first subprotocol the client offers that the
+// endpoint accepts
+func (e *Endpoint) subprotocol(r *http.Request) string {
+	for _, offered := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(offered, ",") {
+			if p = strings.TrimSpace(p); slices.Contains(e.subprotocols, p) {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// handshake returns the 101 response completing a handshake, with the
+// headers set for the endpoint other than those describing a body
+func handshake(header http.Header, key, protocol string) []byte {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	for _, name := range slices.Sorted(maps.Keys(header)) {
+		switch name {
+		case "Content-Type", "Content-Length", "Transfer-Encoding", "Connection", "Upgrade", "Date":
+			continue
+		}
+		for _, v := range header[name] {
+			fmt.Fprintf(&b, "%s: %s\r\n", name, v)
+		}
+	}
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(http.TimeFormat))
+	b.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+	fmt.Fprintf(&b, "Sec-WebSocket-Accept: %s\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if protocol != "" {
+		fmt.Fprintf(&b, "Sec-WebSocket-Protocol: %s\r\n", protocol)
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// session is an upgraded connection whose frames are captured
+type session struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	capture *Capture
+	closing bool
+}
+
+// run captures frames until the deadline, then closes the connection
+// cleanly, giving the client a moment to answer the close frame
+func (s *session) run(deadline time.Time) {
+	s.conn.SetReadDeadline(deadline)
+	for len(s.capture.frames) < maxFrames {
+		f, err := s.readFrame()
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && !s.closing {
+			s.close(closeNormal)
+			s.conn.SetReadDeadline(time.Now().Add(closeWait))
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		switch {
+		case f.Opcode == OpClose:
+			if !s.closing {
+				// Echo the client's status code, as servers acknowledge it
+				s.write(OpClose, f.Payload[:min(len(f.Payload), 2)])
+			}
+			return
+		case f.Opcode == OpPing && !s.closing:
+			s.write(OpPong, f.Payload)
+		case f.Opcode > OpBinary && f.Opcode < OpClose, f.Opcode > OpPong:
+			s.close(closeProtocolError)
+			return
+		}
+	}
+	if !s.closing {
+		s.close(closeNormal)
+	}
+}
+
+// readFrame reads and records a frame. Frames too large to accept are
+// recorded without their payload before the connection is closed.
+func (s *session) readFrame() (*Frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(s.r, head[:]); err != nil {
+		return nil, err
+	}
+	f := Frame{Fin: head[0]&0x80 != 0, Opcode: head[0] & 0x0f}
+	masked := head[1]&0x80 != 0
+
+	f.Length = int64(head[1] & 0x7f)
+	switch f.Length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(s.r, ext[:]); err != nil {
+			return nil, err
+		}
+		f.Length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(s.r, ext[:]); err != nil {
+			return nil, err
+		}
+		f.Length = int64(binary.BigEndian.Uint64(ext[:]) & (1<<63 - 1))
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(s.r, mask[:]); err != nil {
+			return nil, err
+		}
+	}
+	f.Time = time.Now()
+	if f.Length > maxPayload {
+		s.capture.frames = append(s.capture.frames, f)
+		s.close(closeTooBig)
+		return nil, fmt.Errorf("frame of %d bytes exceeds %d", f.Length, maxPayload)
+	}
+
+	f.Payload = make([]byte, min(f.Length, maxStored))
+	if _, err := io.ReadFull(s.r, f.Payload); err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, s.r, f.Length-int64(len(f.Payload))); err != nil {
+		return nil, err
+	}
+	if masked {
+		for i := range f.Payload {
+			f.Payload[i] ^= mask[i%4]
+		}
+	}
+	s.capture.frames = append(s.capture.frames, f)
+
+	// Clients must mask their frames
+	if !masked {
+		s.close(closeProtocolError)
+		return nil, errors.New("unmasked client frame")
+	}
+	return &f, nil
+}
+
+// close sends a close frame with a status code
+func (s *session) close(code uint16) {
+	s.closing = true
+	s.write(OpClose, binary.BigEndian.AppendUint16(nil, code))
+}
+
+// write sends an unmasked frame, as servers send them
+func (s *session) write(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 127), uint64(n))
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := s.conn.Write(append(frame, payload...))
+	return err
+}
+
+// headerHasToken reports whether a comma-separated header holds a token
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package websocket
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestEndpoint_Handle(t *testing.T) {
+	ep := NewEndpoint(&config.EndpointConfig{
+		Type: config.EndpointTypeWebSocket,
+		WebSocket: &config.WebSocketConfig{
+			Duration:     time.Second,
+			Subprotocols: []string{"graphql-ws"},
+			Greeting:     "hello",
+		},
+	})
+	captured := make(chan *Capture, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(NewContext(r.Context()))
+		w.Header().Set("Server", "nginx")
+		if !ep.Handle(w, r) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		captured <- FromContext(r.Context())
+	}))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: example.test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Protocol: chat, graphql-ws\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", resp.StatusCode)
+	}
+	// The accept value of the sample handshake in RFC 6455
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected the RFC 6455 accept value, got %s", got)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != "graphql-ws" {
+		t.Fatalf("Expected subprotocol graphql-ws, got %q", got)
+	}
+	if got := resp.Header.Get("Server"); got != "nginx" {
+		t.Fatalf("Expected the service's Server header, got %q", got)
+	}
+
+	if head, payload := readServerFrame(t, br); head != 0x80|OpText || payload != "hello" {
+		t.Fatalf("Expected the greeting, got %#x %q", head, payload)
+	}
+
+	conn.Write(clientFrame(OpText, "whoami"))
+	conn.Write(clientFrame(OpPing, "p"))
+	if head, payload := readServerFrame(t, br); head != 0x80|OpPong || payload != "p" {
+		t.Fatalf("Expected a pong, got %#x %q", head, payload)
+	}
+	conn.Write(clientFrame(OpClose, "\x03\xe8"))
+	if head, payload := readServerFrame(t, br); head != 0x80|OpClose || payload != "\x03\xe8" {
+		t.Fatalf("Expected the close to be echoed, got %#x %q", head, payload)
+	}
+
+	c := <-captured
+	if !c.Upgraded() || c.Protocol() != "graphql-ws" {
+		t.Fatalf("Expected an upgrade to graphql-ws, got %+v", c)
+	}
+	var types []string
+	for _, f := range c.Frames() {
+		types = append(types, f.Type())
+	}
+	if got := strings.Join(types, ","); got != "text,ping,close" {
+		t.Fatalf("Expected text,ping,close frames, got %s", got)
+	}
+	if got := string(c.Frames()[0].Payload); got != "whoami" {
+		t.Fatalf("Expected the text frame to be unmasked, got %q", got)
+	}
+}
+
+func TestEndpoint_Handle_Version(t *testing.T) {
+	ep := NewEndpoint(&config.EndpointConfig{Type: config.EndpointTypeWebSocket})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "8")
+
+	if !ep.Handle(w, r) {
+		t.Fatalf("Expected the upgrade to be answered")
+	}
+	if w.Code != http.StatusUpgradeRequired || w.Header().Get("Sec-WebSocket-Version") != "13" {
+		t.Fatalf("Expected 426 asking for version 13, got %d", w.Code)
+	}
+
+	if ep.Handle(httptest.NewRecorder(), httptest.NewRequest("GET", "/ws", nil)) {
+		t.Fatalf("Expected a plain request to be left to the template")
+	}
+}
+
+// clientFrame returns a final, masked frame
+func clientFrame(opcode byte, payload string) []byte {
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask...)
+	for i := range len(payload) {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	return frame
+}
+
+// readServerFrame reads a short, unmasked frame
+func readServerFrame(t *testing.T, br *bufio.Reader) (byte, string) {
+	var head [2]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	payload := make([]byte, head[1])
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	return head[0], string(payload)
+}
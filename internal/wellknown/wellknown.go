@@ -0,0 +1,160 @@
+// Package wellknown answers the /.well-known/ paths of a service: its
+// security.txt, and the well-known and ACME challenge directories as a server
+// with a webroot certbot manages answers them. Requests for ACME challenge
+// tokens are left to the service, which answers them as unknown, but are
+// logged and tagged, since a token probed on a host that never asked for a
+// certificate is an attempt to get one issued for it.
+package wellknown
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/logging"
+)
+
+// serviceLog logs the probes answered, as the services do
+var serviceLog = logging.Logger("service")
+
+// TagACMEChallenge tags requests for ACME HTTP-01 challenge tokens
+const TagACMEChallenge = "acme-challenge"
+
+const (
+	prefix           = "/.well-known/"
+	acmeChallenge    = prefix + "acme-challenge/"
+	securityTxtPath  = prefix + "security.txt"
+	securityTxtMedia = "text/plain; charset=utf-8"
+)
+
+// Responder answers the well-known paths of a service
+type Responder struct {
+	serviceType string
+	directories bool
+	securityTxt *config.SecurityTxtConfig
+
+	// endpoints are paths the service has its own endpoints for, which are
+	// left to it
+	endpoints map[string]bool
+}
+
+// New creates the responder of a service
+func New(cfg *config.ServiceConfig) *Responder {
+	wk := cfg.WellKnown
+	r := &Responder{
+		serviceType: cfg.Type,
+		directories: wk.GetDirectories(),
+		endpoints:   make(map[string]bool),
+	}
+	if wk != nil {
+		r.securityTxt = wk.SecurityTxt
+	}
+	for _, ep := range cfg.Endpoints {
+		r.endpoints[ep.Path] = true
+	}
+	return r
+}
+
+// IsACMEChallenge reports whether a path requests an ACME challenge token
+func IsACMEChallenge(path string) bool {
+	return strings.HasPrefix(path, acmeChallenge) && len(path) > len(acmeChallenge)
+}
+
+// Handle answers a request for a well-known path, reporting whether it did
+func (wk *Responder) Handle(w http.ResponseWriter, r *http.Request) bool {
+	if wk == nil || !strings.HasPrefix(r.URL.Path, prefix) {
+		return false
+	}
+	path := r.URL.Path
+
+	if IsACMEChallenge(path) {
+		serviceLog.Info("ACME challenge probe", "remote", r.RemoteAddr, "token", strings.TrimPrefix(path, acmeChallenge), "host", r.Host)
+		return false
+	}
+	if wk.endpoints[path] {
+		return false
+	}
+
+	switch {
+	case path == securityTxtPath && wk.securityTxt != nil:
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return false
+		}
+		w.Header().Set("Content-Type", securityTxtMedia)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write([]byte(wk.SecurityTxt(r.Host, time.Now())))
+		}
+		return true
+	case wk.directories && (path == prefix || path == acmeChallenge):
+		body, contentType := forbidden(wk.serviceType, w.Header().Get("Server"))
+		if body == "" {
+			return false
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(body))
+		return true
+	}
+	return false
+}
+
+// SecurityTxt returns the security.txt served for a host at a time, its
+// canonical URL on the default port
+func (wk *Responder) SecurityTxt(host string, now time.Time) string {
+	cfg := wk.securityTxt
+	expires := cfg.Expires
+	if expires.IsZero() {
+		// A file refreshed yearly, never closer than a month to expiring
+		year := now.Year() + 1
+		if now.Month() == time.December {
+			year++
+		}
+		expires = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	var b strings.Builder
+	for _, contact := range cfg.Contact {
+		fmt.Fprintf(&b, "Contact: %s\n", contact)
+	}
+	fmt.Fprintf(&b, "Expires: %s\n", expires.UTC().Format("2006-01-02T15:04:05.000Z"))
+	if cfg.Encryption != "" {
+		fmt.Fprintf(&b, "Encryption: %s\n", cfg.Encryption)
+	}
+	if cfg.Policy != "" {
+		fmt.Fprintf(&b, "Policy: %s\n", cfg.Policy)
+	}
+	if cfg.Hiring != "" {
+		fmt.Fprintf(&b, "Hiring: %s\n", cfg.Hiring)
+	}
+	if cfg.PreferredLanguages != "" {
+		fmt.Fprintf(&b, "Preferred-Languages: %s\n", cfg.PreferredLanguages)
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host != "" {
+		fmt.Fprintf(&b, "Canonical: https://%s%s\n", host, securityTxtPath)
+	}
+	return b.String()
+}
+
+// forbidden returns the page a service type's server answers directories
+// without an index with and its content type, or "" for types with no default
+func forbidden(serviceType, server string) (string, string) {
+	switch serviceType {
+	case "apache2", "wordpress":
+		return "<!DOCTYPE HTML PUBLIC \"-//IETF//DTD HTML 2.0//EN\">\n<html><head>\n<title>403 Forbidden</title>\n" +
+			"</head><body>\n<h1>Forbidden</h1>\n<p>You don't have permission to access this resource.</p>\n</body></html>\n", "text/html; charset=iso-8859-1"
+	case "nginx":
+		if server == "" {
+			server = "nginx"
+		}
+		return "<html>\r\n<head><title>403 Forbidden</title></head>\r\n<body>\r\n<center><h1>403 Forbidden</h1></center>\r\n" +
+			"<hr><center>" + server + "</center>\r\n</body>\r\n</html>\r\n", "text/html"
+	}
+	return "", ""
+}
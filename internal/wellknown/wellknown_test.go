@@ -0,0 +1,79 @@
+package wellknown
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/config"
+)
+
+func TestResponder_Handle(t *testing.T) {
+	wk := New(&config.ServiceConfig{
+		Type: "nginx",
+		WellKnown: &config.WellKnownConfig{
+			SecurityTxt: &config.SecurityTxtConfig{
+				Contact:            []string{"mailto:security@example.com"},
+				PreferredLanguages: "en",
+			},
+		},
+		Endpoints: []config.EndpointConfig{{Path: "/.well-known/openid-configuration"}},
+	})
+
+	tests := []struct {
+		path       string
+		handled    bool
+		wantStatus int
+		wantBody   string
+	}{
+		{"/.well-known/security.txt", true, http.StatusOK, "Contact: mailto:security@example.com\n"},
+		{"/.well-known/", true, http.StatusForbidden, "<hr><center>nginx/1.25.3</center>"},
+		{"/.well-known/acme-challenge/", true, http.StatusForbidden, "403 Forbidden"},
+		{"/.well-known/acme-challenge/Vx3Y0oyG8MeHTl_0wHGuAX3jXWqLbqdLrW1fPSrQTEc", false, 0, ""},
+		{"/.well-known/openid-configuration", false, 0, ""},
+		{"/index.html", false, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			w.Header().Set("Server", "nginx/1.25.3")
+			r := httptest.NewRequest("GET", tt.path, nil)
+
+			if handled := wk.Handle(w, r); handled != tt.handled {
+				t.Fatalf("Expected handled %v, got %v", tt.handled, handled)
+			}
+			if !tt.handled {
+				return
+			}
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Fatalf("Expected body containing %q, got %q", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	if !IsACMEChallenge("/.well-known/acme-challenge/token") || IsACMEChallenge("/.well-known/acme-challenge/") {
+		t.Fatalf("Expected only token paths to be ACME challenges")
+	}
+}
+
+func TestResponder_SecurityTxt(t *testing.T) {
+	wk := New(&config.ServiceConfig{
+		WellKnown: &config.WellKnownConfig{
+			SecurityTxt: &config.SecurityTxtConfig{Contact: []string{"https://example.com/security"}},
+		},
+	})
+
+	got := wk.SecurityTxt("www.example.com:8443", time.Date(2026, time.December, 3, 0, 0, 0, 0, time.UTC))
+	want := "Contact: https://example.com/security\n" +
+		"Expires: 2028-01-01T00:00:00.000Z\n" +
+		"Canonical: https://www.example.com/.well-known/security.txt\n"
+	if got != want {
+		t.Fatalf("Expected %q, got %q", want, got)
+	}
+}
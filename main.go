@@ -1,88 +1,98 @@
 package main
 
 import (
-	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/davidthuman/service-spoof/internal/config"
-	"github.com/davidthuman/service-spoof/internal/database"
-	"github.com/davidthuman/service-spoof/internal/server"
 )
 
-func main() {
-	// Load configuration
-	cfg, err := config.LoadConfig("./config.yaml")
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
-	}
-
-	log.Printf("Loaded configuration version %s", cfg.Version)
+// commands are the subcommands of the binary, in the order usage lists them
+var commands = []struct {
+	name    string
+	summary string
+	run     func(args []string)
+}{
+	{"serve", "run the spoofed services (the default)", runServe},
+	{"init", "lay out a new deployment in a directory", runInit},
+	{"migrate", "inspect, apply, or roll back database migrations", runMigrate},
+	{"query", "print logged requests", runQuery},
+	{"export", "write logged requests as JSON, CSV, or PCAP", runExport},
+	{"doctor", "check that the spoof would start cleanly", runDoctor},
+	{"detect", "run honeypot-detection checks against a running instance", runDetect},
+	{"compare", "compare the banner indexed for a real host to the spoof", runCompare},
+	{"import", "convert scans or recordings of a real host into services", runImport},
+	{"redirect-rules", "print firewall rules for redirect mode", runRedirectRules},
+	{"fingerprints", "inspect fingerprints through the admin API", runFingerprints},
+	{"refingerprint", "recompute fingerprints from stored ClientHellos", runRefingerprint},
+	{"watermark", "print or check the deployment watermark", runWatermark},
+	{"fidelity", "score services against the software they spoof", runFidelity},
+	{"conformance", "check services against their conformance corpora", runConformance},
+}
 
-	// Initialize database
-	db, err := database.New(cfg.Database.Path)
-	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+func main() {
+	// Without a subcommand, or with only flags, the services are run
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") && !isHelp(os.Args[1]) {
+		runServe(os.Args[1:])
+		return
 	}
-	defer db.Close()
 
-	// Run database migrations
-	if err := db.RunMigrations("./migrations"); err != nil {
-		log.Fatalf("Failed to run database migrations: %v", err)
+	name := os.Args[1]
+	switch {
+	case name == "pcap":
+		// pcap is kept from before export took formats
+		runExport(append([]string{"-format", "pcap"}, os.Args[2:]...))
+		return
+	case name == "help" || isHelp(name):
+		usage(os.Stdout)
+		return
 	}
-
-	// Log migration version
-	version, dirty, err := db.GetMigrationVersion()
-	if err != nil {
-		log.Printf("Warning: could not get migration version: %v", err)
-	} else if dirty {
-		log.Fatalf("Database is in dirty state at version %d", version)
-	} else {
-		log.Printf("Database initialized at %s (migration version: %d)", cfg.Database.Path, version)
+	for _, c := range commands {
+		if c.name == name {
+			c.run(os.Args[2:])
+			return
+		}
 	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage(os.Stderr)
+	os.Exit(2)
+}
 
-	// Create request logger
-	requestLogger := database.NewRequestLogger(db)
+// isHelp reports whether arg asks for usage
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
 
-	// Create server manager
-	manager, err := server.NewManager(cfg, requestLogger)
-	if err != nil {
-		log.Fatalf("Failed to create server manager: %v", err)
+// usage lists the subcommands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: service-spoof [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
 	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run service-spoof COMMAND -h for the flags of a command.")
+}
 
-	// Start servers
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	go func() {
-		if err := manager.Start(ctx); err != nil {
-			log.Fatalf("Server error: %v", err)
-		}
-	}()
-
-	log.Println("Service spoof started successfully")
-	portServiceMap := manager.GetPortServiceMap()
-	for port, services := range portServiceMap {
-		log.Printf("Port %d: %v", port, services)
+// mustLoadConfig loads the configuration at path, or exits 2 if it is not
+// valid, so scripts can tell a configuration to fix from one that could not
+// be read, which exits 1
+func mustLoadConfig(path string) *config.Config {
+	cfg, err := config.LoadConfig(path)
+	if errors.Is(err, config.ErrValidation) {
+		log.Printf("Invalid config %s: %v", path, err)
+		os.Exit(2)
 	}
-
-	// Wait for shutdown signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
-
-	log.Println("Shutting down...")
-
-	// Graceful shutdown with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer shutdownCancel()
-
-	if err := manager.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Shutdown error: %v", err)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
 	}
-
-	log.Println("Shutdown complete")
+	return cfg
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+// runMigrate inspects and repairs the database schema version without
+// starting the spoof
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the config file")
+	migrations := fs.String("migrations", "./migrations", "path to the migrations directory")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-spoof migrate [flags] version | up | down [N] | recover | force VERSION")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg := mustLoadConfig(*configPath)
+
+	db, err := database.Open(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	switch fs.Arg(0) {
+	case "version":
+	case "up":
+		if err := db.RunMigrations(*migrations); err != nil {
+			log.Fatalf("%v", err)
+		}
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			n, err := strconv.Atoi(fs.Arg(1))
+			if err != nil || n < 1 {
+				fs.Usage()
+				os.Exit(2)
+			}
+			steps = n
+		}
+		if err := db.RollbackMigrations(*migrations, steps); err != nil {
+			log.Fatalf("%v", err)
+		}
+	case "recover":
+		recovered, err := db.RecoverDirtyMigration(*migrations)
+		if err != nil {
+			log.Fatalf("Failed to recover dirty database: %v", err)
+		}
+		if recovered == 0 {
+			fmt.Println("Database is not dirty")
+		} else {
+			fmt.Printf("Reset database left dirty by migration %d\n", recovered)
+		}
+	case "force":
+		version, err := strconv.ParseUint(fs.Arg(1), 10, 0)
+		if err != nil {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if err := db.ForceMigrationVersion(*migrations, uint(version)); err != nil {
+			log.Fatalf("%v", err)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	version, dirty, err := db.GetMigrationVersion()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	state := "clean"
+	if dirty {
+		state = "dirty"
+	}
+	fmt.Printf("Migration version %d (%s)\n", version, state)
+}
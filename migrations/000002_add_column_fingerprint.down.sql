@@ -1,5 +1,5 @@
--- Drop Column fingerprint to request_logs table
--- Not implemented in SQLite
+-- Drop indexes
+DROP INDEX IF EXISTS idx_fingerprint;
 
--- Create indexes
-DROP INDEX IF EXISTS idx_fingerprint;
\ No newline at end of file
+-- Drop Column fingerprint from request_logs table
+ALTER TABLE request_logs DROP COLUMN fingerprint;
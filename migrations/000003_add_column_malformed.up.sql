@@ -0,0 +1,5 @@
+-- Add Column malformed to request_logs table
+ALTER TABLE request_logs ADD COLUMN malformed INTEGER NOT NULL DEFAULT 0;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_malformed ON request_logs(malformed);
@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_protocol_guess;
+
+-- Drop Column protocol_guess from request_logs table
+ALTER TABLE request_logs DROP COLUMN protocol_guess;
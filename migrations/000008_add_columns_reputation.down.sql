@@ -0,0 +1,9 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_proxy;
+DROP INDEX IF EXISTS idx_datacenter;
+DROP INDEX IF EXISTS idx_tor;
+
+-- Drop Columns tor, datacenter, and proxy from request_logs table
+ALTER TABLE request_logs DROP COLUMN proxy;
+ALTER TABLE request_logs DROP COLUMN datacenter;
+ALTER TABLE request_logs DROP COLUMN tor;
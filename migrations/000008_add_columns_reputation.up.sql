@@ -0,0 +1,9 @@
+-- Add Columns tor, datacenter, and proxy to request_logs table
+ALTER TABLE request_logs ADD COLUMN tor INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE request_logs ADD COLUMN datacenter INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE request_logs ADD COLUMN proxy INTEGER NOT NULL DEFAULT 0;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_tor ON request_logs(tor);
+CREATE INDEX IF NOT EXISTS idx_datacenter ON request_logs(datacenter);
+CREATE INDEX IF NOT EXISTS idx_proxy ON request_logs(proxy);
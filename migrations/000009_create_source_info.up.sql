@@ -0,0 +1,9 @@
+-- Create source_info table caching reverse DNS and RDAP lookups
+CREATE TABLE IF NOT EXISTS source_info (
+    ip TEXT PRIMARY KEY,
+    ptr TEXT NOT NULL DEFAULT "",
+    network TEXT NOT NULL DEFAULT "",
+    org TEXT NOT NULL DEFAULT "",
+    country TEXT NOT NULL DEFAULT "",
+    looked_up_at DATETIME NOT NULL
+);
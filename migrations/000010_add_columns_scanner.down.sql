@@ -0,0 +1,9 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_sessions_scanner;
+DROP INDEX IF EXISTS idx_scanner;
+
+-- Drop Column scanner from request_logs table and Columns scanner and
+-- alerts_muted from sessions table
+ALTER TABLE sessions DROP COLUMN alerts_muted;
+ALTER TABLE sessions DROP COLUMN scanner;
+ALTER TABLE request_logs DROP COLUMN scanner;
@@ -0,0 +1,10 @@
+-- Add Column scanner to request_logs table
+ALTER TABLE request_logs ADD COLUMN scanner TEXT NOT NULL DEFAULT '';
+
+-- Add Columns scanner and alerts_muted to sessions table
+ALTER TABLE sessions ADD COLUMN scanner TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN alerts_muted INTEGER NOT NULL DEFAULT 0;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_scanner ON request_logs(scanner);
+CREATE INDEX IF NOT EXISTS idx_sessions_scanner ON sessions(scanner);
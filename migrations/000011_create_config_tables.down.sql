@@ -0,0 +1,11 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_config_id;
+DROP INDEX IF EXISTS idx_endpoints_service_id;
+
+-- Drop Column config_id from request_logs table
+ALTER TABLE request_logs DROP COLUMN config_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS endpoints;
+DROP TABLE IF EXISTS services;
+DROP TABLE IF EXISTS configs;
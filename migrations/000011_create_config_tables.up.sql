@@ -0,0 +1,41 @@
+-- Create configs table, one row per distinct loaded configuration
+CREATE TABLE IF NOT EXISTS configs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    hash TEXT NOT NULL UNIQUE,
+    first_loaded DATETIME NOT NULL,
+    last_loaded DATETIME NOT NULL
+);
+
+-- Create services table holding the services of each configuration
+CREATE TABLE IF NOT EXISTS services (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    config_id INTEGER NOT NULL REFERENCES configs(id),
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    address TEXT NOT NULL DEFAULT "",
+    ports TEXT NOT NULL,
+    headers TEXT NOT NULL,
+    personality TEXT NOT NULL DEFAULT "",
+    UNIQUE (config_id, name)
+);
+
+-- Create endpoints table holding the endpoints of each service
+CREATE TABLE IF NOT EXISTS endpoints (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    service_id INTEGER NOT NULL REFERENCES services(id),
+    position INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    method TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    template TEXT NOT NULL DEFAULT "",
+    template_hash TEXT NOT NULL DEFAULT "",
+    headers TEXT NOT NULL,
+    condition TEXT NOT NULL DEFAULT ""
+);
+
+-- Add Column config_id to request_logs table
+ALTER TABLE request_logs ADD COLUMN config_id INTEGER;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_endpoints_service_id ON endpoints(service_id);
+CREATE INDEX IF NOT EXISTS idx_config_id ON request_logs(config_id, service_name);
@@ -0,0 +1,8 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_config_loads_config_id;
+
+-- Drop Column snapshot from configs table
+ALTER TABLE configs DROP COLUMN snapshot;
+
+-- Drop table
+DROP TABLE IF EXISTS config_loads;
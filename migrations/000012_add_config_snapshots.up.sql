@@ -0,0 +1,12 @@
+-- Add Column snapshot to configs table
+ALTER TABLE configs ADD COLUMN snapshot TEXT NOT NULL DEFAULT '';
+
+-- Create config_loads table recording every time a configuration is loaded
+CREATE TABLE IF NOT EXISTS config_loads (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    config_id INTEGER NOT NULL REFERENCES configs(id),
+    loaded_at DATETIME NOT NULL
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_config_loads_config_id ON config_loads(config_id);
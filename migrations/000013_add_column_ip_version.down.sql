@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_ip_version;
+
+-- Drop Column ip_version from request_logs table
+ALTER TABLE request_logs DROP COLUMN ip_version;
@@ -0,0 +1,34 @@
+-- Create ssrf_hits table, one row per token handed out by the SSRF catcher
+CREATE TABLE IF NOT EXISTS ssrf_hits (
+    token TEXT PRIMARY KEY,
+    parent TEXT NOT NULL DEFAULT "",
+    source_ip TEXT NOT NULL,
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    host TEXT NOT NULL DEFAULT "",
+    user_agent TEXT NOT NULL DEFAULT "",
+    redirect_target TEXT NOT NULL DEFAULT "",
+
+    -- Origin analysis
+    provider TEXT NOT NULL DEFAULT "",
+    via TEXT NOT NULL DEFAULT "",
+    client TEXT NOT NULL DEFAULT "",
+    internal_headers TEXT NOT NULL DEFAULT "",
+    private_forwarded BOOLEAN NOT NULL DEFAULT 0,
+
+    issued_at DATETIME NOT NULL
+);
+
+-- Create ssrf_callbacks table holding sightings of handed out tokens
+CREATE TABLE IF NOT EXISTS ssrf_callbacks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token TEXT NOT NULL REFERENCES ssrf_hits(token),
+    source TEXT NOT NULL DEFAULT "",
+    protocol TEXT NOT NULL DEFAULT "",
+    data TEXT NOT NULL DEFAULT "",
+    received_at DATETIME NOT NULL
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_ssrf_hits_issued_at ON ssrf_hits(issued_at);
+CREATE INDEX IF NOT EXISTS idx_ssrf_callbacks_token ON ssrf_callbacks(token);
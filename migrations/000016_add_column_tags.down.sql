@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_tags;
+
+-- Drop Column tags from request_logs table
+ALTER TABLE request_logs DROP COLUMN tags;
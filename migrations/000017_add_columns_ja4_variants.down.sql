@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_ja4_o;
+
+-- Drop Columns ja4_r and ja4_o from request_logs table
+ALTER TABLE request_logs DROP COLUMN ja4_o;
+ALTER TABLE request_logs DROP COLUMN ja4_r;
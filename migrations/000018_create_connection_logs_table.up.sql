@@ -0,0 +1,34 @@
+-- Create connection_logs table, one row per connection to a service that
+-- does not speak HTTP
+CREATE TABLE IF NOT EXISTS connection_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp DATETIME NOT NULL,
+    source_ip TEXT NOT NULL,
+    source_port INTEGER NOT NULL,
+    ip_version INTEGER NOT NULL DEFAULT 4,
+    server_port INTEGER NOT NULL,
+    service_name TEXT NOT NULL,
+    service_type TEXT NOT NULL,
+    protocol TEXT NOT NULL,
+
+    -- What the client revealed
+    client_version TEXT NOT NULL DEFAULT "",
+    fingerprint TEXT NOT NULL DEFAULT "",
+    fingerprint_raw TEXT NOT NULL DEFAULT "",
+    raw_data TEXT NOT NULL DEFAULT "",
+    error TEXT NOT NULL DEFAULT "",
+
+    -- Source analysis
+    session_id INTEGER NOT NULL DEFAULT 0,
+    country TEXT NOT NULL DEFAULT "",
+    asn INTEGER NOT NULL DEFAULT 0,
+    tor BOOLEAN NOT NULL DEFAULT 0,
+    datacenter BOOLEAN NOT NULL DEFAULT 0,
+    proxy BOOLEAN NOT NULL DEFAULT 0,
+    config_id INTEGER NOT NULL DEFAULT 0
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_connection_logs_timestamp ON connection_logs(timestamp);
+CREATE INDEX IF NOT EXISTS idx_connection_logs_source_ip ON connection_logs(source_ip);
+CREATE INDEX IF NOT EXISTS idx_connection_logs_fingerprint ON connection_logs(fingerprint);
@@ -0,0 +1,34 @@
+-- Create protocol_sessions table, one row per session with a service
+-- speaking an interactive protocol other than HTTP, such as FTP
+CREATE TABLE IF NOT EXISTS protocol_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp DATETIME NOT NULL,
+    source_ip TEXT NOT NULL,
+    source_port INTEGER NOT NULL,
+    ip_version INTEGER NOT NULL DEFAULT 4,
+    server_port INTEGER NOT NULL,
+    service_name TEXT NOT NULL,
+    service_type TEXT NOT NULL,
+    protocol TEXT NOT NULL,
+
+    -- What the client did: the credentials it tried as a JSON array of
+    -- {"username", "password"} objects, and every line exchanged
+    credentials TEXT NOT NULL DEFAULT "[]",
+    commands INTEGER NOT NULL DEFAULT 0,
+    transcript TEXT NOT NULL DEFAULT "",
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT "",
+
+    -- Source analysis
+    session_id INTEGER NOT NULL DEFAULT 0,
+    country TEXT NOT NULL DEFAULT "",
+    asn INTEGER NOT NULL DEFAULT 0,
+    tor BOOLEAN NOT NULL DEFAULT 0,
+    datacenter BOOLEAN NOT NULL DEFAULT 0,
+    proxy BOOLEAN NOT NULL DEFAULT 0,
+    config_id INTEGER NOT NULL DEFAULT 0
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_protocol_sessions_timestamp ON protocol_sessions(timestamp);
+CREATE INDEX IF NOT EXISTS idx_protocol_sessions_source_ip ON protocol_sessions(source_ip);
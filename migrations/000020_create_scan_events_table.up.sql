@@ -0,0 +1,24 @@
+-- Create scan_events table, one row per source seen hitting several spoofed
+-- ports, correlated across listeners
+CREATE TABLE IF NOT EXISTS scan_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    source_ip TEXT NOT NULL,
+    first_seen DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL,
+
+    -- The ports hit, in the order first hit, as a JSON array of
+    -- {"port", "offset_ms"} objects timed from first_seen
+    ports TEXT NOT NULL DEFAULT "[]",
+    port_count INTEGER NOT NULL DEFAULT 0,
+
+    -- How the scan was paced: fast for SYN-scan-like sweeps, slow otherwise,
+    -- judged by the median gap between new ports
+    pattern TEXT NOT NULL DEFAULT "",
+    median_gap_ms INTEGER NOT NULL DEFAULT 0,
+
+    session_id INTEGER NOT NULL DEFAULT 0
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_scan_events_last_seen ON scan_events(last_seen);
+CREATE INDEX IF NOT EXISTS idx_scan_events_source_ip ON scan_events(source_ip);
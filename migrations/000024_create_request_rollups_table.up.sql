@@ -0,0 +1,24 @@
+-- Create request_rollups table, the requests of each hour counted by country
+-- and attack tag, for the dashboard's activity charts. Every request counts
+-- once under the empty tag and once under each of its tags.
+CREATE TABLE IF NOT EXISTS request_rollups (
+    -- The start of the hour, in seconds since the Unix epoch
+    bucket INTEGER NOT NULL,
+    country TEXT NOT NULL DEFAULT '',
+    tag TEXT NOT NULL DEFAULT '',
+    requests INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, country, tag)
+);
+
+-- Backfill the requests already logged
+INSERT INTO request_rollups (bucket, country, tag, requests)
+WITH RECURSIVE split(bucket, country, tag, rest) AS (
+    SELECT CAST(strftime('%s', timestamp) AS INTEGER) / 3600 * 3600, country, '',
+        CASE WHEN tags = '' THEN '' ELSE tags || ',' END
+    FROM request_logs
+    UNION ALL
+    SELECT bucket, country, substr(rest, 1, instr(rest, ',') - 1), substr(rest, instr(rest, ',') + 1)
+    FROM split
+    WHERE rest != ''
+)
+SELECT bucket, country, tag, COUNT(*) FROM split GROUP BY bucket, country, tag;
@@ -0,0 +1,4 @@
+-- Drop Columns alpn, tls_version, and tls_cipher from request_logs table
+ALTER TABLE request_logs DROP COLUMN tls_cipher;
+ALTER TABLE request_logs DROP COLUMN tls_version;
+ALTER TABLE request_logs DROP COLUMN alpn;
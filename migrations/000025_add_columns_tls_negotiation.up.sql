@@ -0,0 +1,5 @@
+-- Add Columns alpn, tls_version, and tls_cipher to request_logs table, what
+-- the TLS handshake of each request's connection settled on
+ALTER TABLE request_logs ADD COLUMN alpn TEXT NOT NULL DEFAULT '';
+ALTER TABLE request_logs ADD COLUMN tls_version TEXT NOT NULL DEFAULT '';
+ALTER TABLE request_logs ADD COLUMN tls_cipher TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_client_hello_hash;
+
+-- Drop Column client_hello_hash from request_logs table
+ALTER TABLE request_logs DROP COLUMN client_hello_hash;
+
+-- Drop table
+DROP TABLE IF EXISTS client_hellos;
@@ -0,0 +1,15 @@
+-- Create client_hellos table, the raw ClientHello of TLS connections stored
+-- once per distinct hello, so fingerprints can be recomputed from them later
+CREATE TABLE IF NOT EXISTS client_hellos (
+    -- SHA-256 of the raw hello, in hex
+    hash TEXT PRIMARY KEY,
+    raw BLOB NOT NULL,
+    first_seen DATETIME NOT NULL
+);
+
+-- Add Column client_hello_hash to request_logs table, the hello of each
+-- request's connection
+ALTER TABLE request_logs ADD COLUMN client_hello_hash TEXT NOT NULL DEFAULT '';
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_client_hello_hash ON request_logs(client_hello_hash);
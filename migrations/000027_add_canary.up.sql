@@ -0,0 +1,6 @@
+-- Add Column canary to request_logs table, the canary token each request
+-- touched
+ALTER TABLE request_logs ADD COLUMN canary TEXT NOT NULL DEFAULT '';
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_canary ON request_logs(canary);
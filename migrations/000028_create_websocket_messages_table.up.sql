@@ -0,0 +1,23 @@
+-- Create websocket_messages table, one row per frame a client sent over a
+-- connection a websocket endpoint upgraded
+CREATE TABLE IF NOT EXISTS websocket_messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+    -- The request_logs row of the handshake, and the frame's position among
+    -- those sent after it
+    request_id INTEGER NOT NULL,
+    seq INTEGER NOT NULL,
+    received_at DATETIME NOT NULL,
+
+    -- The frame: its opcode and the name of it (text, binary, continuation,
+    -- close, ping, pong, or unknown), whether it ends a message, the length
+    -- of its payload, and the unmasked payload, up to the first 64 KiB
+    opcode INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    fin BOOLEAN NOT NULL DEFAULT 1,
+    length INTEGER NOT NULL,
+    payload BLOB NOT NULL
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_websocket_messages_request_id ON websocket_messages(request_id);
@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_malformed;
+
+-- Drop Column malformed from request_logs table
+ALTER TABLE request_logs DROP COLUMN IF EXISTS malformed;
@@ -0,0 +1,5 @@
+-- Add Column protocol_guess to request_logs table
+ALTER TABLE request_logs ADD COLUMN protocol_guess TEXT NOT NULL DEFAULT '';
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_protocol_guess ON request_logs(protocol_guess);
@@ -0,0 +1,5 @@
+-- Add Column scheme to request_logs table
+ALTER TABLE request_logs ADD COLUMN scheme TEXT NOT NULL DEFAULT '';
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_scheme ON request_logs(scheme);
@@ -0,0 +1,10 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_session_id;
+DROP INDEX IF EXISTS idx_sessions_score;
+DROP INDEX IF EXISTS idx_sessions_source_ip;
+
+-- Drop Column session_id from request_logs table
+ALTER TABLE request_logs DROP COLUMN IF EXISTS session_id;
+
+-- Drop table
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,23 @@
+-- Create sessions table
+CREATE TABLE IF NOT EXISTS sessions (
+    id BIGSERIAL PRIMARY KEY,
+    source_ip TEXT NOT NULL,
+    first_seen TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+
+    -- Interaction depth
+    request_count INTEGER NOT NULL DEFAULT 0,
+    endpoint_count INTEGER NOT NULL DEFAULT 0,
+    credential_count INTEGER NOT NULL DEFAULT 0,
+    upload_count INTEGER NOT NULL DEFAULT 0,
+    upload_bytes BIGINT NOT NULL DEFAULT 0,
+    score INTEGER NOT NULL DEFAULT 0
+);
+
+-- Add Column session_id to request_logs table
+ALTER TABLE request_logs ADD COLUMN session_id BIGINT;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_sessions_source_ip ON sessions(source_ip, last_seen);
+CREATE INDEX IF NOT EXISTS idx_sessions_score ON sessions(score);
+CREATE INDEX IF NOT EXISTS idx_session_id ON request_logs(session_id, method, path);
@@ -0,0 +1,7 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_asn;
+DROP INDEX IF EXISTS idx_country;
+
+-- Drop Columns country and asn from request_logs table
+ALTER TABLE request_logs DROP COLUMN IF EXISTS asn;
+ALTER TABLE request_logs DROP COLUMN IF EXISTS country;
@@ -0,0 +1,7 @@
+-- Add Columns country and asn to request_logs table
+ALTER TABLE request_logs ADD COLUMN country TEXT NOT NULL DEFAULT '';
+ALTER TABLE request_logs ADD COLUMN asn BIGINT NOT NULL DEFAULT 0;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_country ON request_logs(country);
+CREATE INDEX IF NOT EXISTS idx_asn ON request_logs(asn);
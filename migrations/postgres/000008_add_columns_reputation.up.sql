@@ -0,0 +1,9 @@
+-- Add Columns tor, datacenter, and proxy to request_logs table
+ALTER TABLE request_logs ADD COLUMN tor BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE request_logs ADD COLUMN datacenter BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE request_logs ADD COLUMN proxy BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_tor ON request_logs(tor);
+CREATE INDEX IF NOT EXISTS idx_datacenter ON request_logs(datacenter);
+CREATE INDEX IF NOT EXISTS idx_proxy ON request_logs(proxy);
@@ -0,0 +1,16 @@
+-- Add Column ip_version to request_logs table
+ALTER TABLE request_logs ADD COLUMN ip_version INTEGER NOT NULL DEFAULT 0;
+
+-- Store IPv4-mapped IPv6 sources as IPv4, as new requests are
+UPDATE request_logs SET source_ip = substr(source_ip, 8) WHERE source_ip LIKE '::ffff:%.%';
+UPDATE sessions SET source_ip = substr(source_ip, 8) WHERE source_ip LIKE '::ffff:%.%';
+
+-- Backfill the IP version of existing requests
+UPDATE request_logs SET ip_version = CASE
+    WHEN source_ip LIKE '%:%' THEN 6
+    WHEN source_ip LIKE '%.%.%.%' THEN 4
+    ELSE 0
+END;
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_ip_version ON request_logs(ip_version);
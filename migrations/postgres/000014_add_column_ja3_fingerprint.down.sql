@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_ja3_fingerprint;
+
+-- Drop Column ja3_fingerprint from request_logs table
+ALTER TABLE request_logs DROP COLUMN IF EXISTS ja3_fingerprint;
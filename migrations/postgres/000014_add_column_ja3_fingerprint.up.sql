@@ -0,0 +1,5 @@
+-- Add Column ja3_fingerprint to request_logs table
+ALTER TABLE request_logs ADD COLUMN ja3_fingerprint TEXT NOT NULL DEFAULT '';
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_ja3_fingerprint ON request_logs(ja3_fingerprint);
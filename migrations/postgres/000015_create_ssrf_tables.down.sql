@@ -0,0 +1,3 @@
+-- Drop tables
+DROP TABLE IF EXISTS ssrf_callbacks;
+DROP TABLE IF EXISTS ssrf_hits;
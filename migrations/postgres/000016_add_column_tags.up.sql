@@ -0,0 +1,6 @@
+-- Add Column tags to request_logs table, the comma-separated attack tags of
+-- each request
+ALTER TABLE request_logs ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_tags ON request_logs(tags);
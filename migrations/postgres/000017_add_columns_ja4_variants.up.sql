@@ -0,0 +1,7 @@
+-- Add Columns ja4_r and ja4_o to request_logs table, the raw and original
+-- order JA4 fingerprints of each connection
+ALTER TABLE request_logs ADD COLUMN ja4_r TEXT NOT NULL DEFAULT '';
+ALTER TABLE request_logs ADD COLUMN ja4_o TEXT NOT NULL DEFAULT '';
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_ja4_o ON request_logs(ja4_o);
@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_ja4h;
+
+-- Drop Column ja4h from request_logs table
+ALTER TABLE request_logs DROP COLUMN IF EXISTS ja4h;
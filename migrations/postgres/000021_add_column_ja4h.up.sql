@@ -0,0 +1,6 @@
+-- Add Column ja4h to request_logs table, the JA4H fingerprint of each
+-- request, computed from the request itself on plaintext and TLS ports alike
+ALTER TABLE request_logs ADD COLUMN ja4h TEXT NOT NULL DEFAULT '';
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_ja4h ON request_logs(ja4h);
@@ -0,0 +1,14 @@
+-- Create saved_reports table, one row per report saved through the admin API.
+-- Reports defined in the configuration are not stored.
+CREATE TABLE IF NOT EXISTS saved_reports (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    query TEXT NOT NULL,
+
+    -- The declared parameters, as a JSON array of
+    -- {"name", "type", "default", "required"} objects
+    params TEXT NOT NULL DEFAULT '[]',
+
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Drop tables
+DROP INDEX IF EXISTS idx_fidelity_runs_service;
+DROP TABLE IF EXISTS fidelity_runs;
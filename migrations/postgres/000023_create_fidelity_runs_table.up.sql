@@ -0,0 +1,17 @@
+-- Create fidelity_runs table, one row per service compared to a reference
+-- server by the fidelity subcommand, so regressions in realism show over time
+CREATE TABLE IF NOT EXISTS fidelity_runs (
+    id BIGSERIAL PRIMARY KEY,
+    timestamp TIMESTAMPTZ NOT NULL,
+    service_name TEXT NOT NULL,
+    image TEXT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    probes INTEGER NOT NULL,
+    compared INTEGER NOT NULL,
+
+    -- The fields that differed, as a JSON array of
+    -- {"probe", "field", "want", "got"} objects
+    differences TEXT NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX IF NOT EXISTS idx_fidelity_runs_service ON fidelity_runs(service_name, timestamp);
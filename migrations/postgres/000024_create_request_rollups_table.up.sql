@@ -0,0 +1,21 @@
+-- Create request_rollups table, the requests of each hour counted by country
+-- and attack tag, for the dashboard's activity charts. Every request counts
+-- once under the empty tag and once under each of its tags.
+CREATE TABLE IF NOT EXISTS request_rollups (
+    -- The start of the hour, in seconds since the Unix epoch
+    bucket BIGINT NOT NULL,
+    country TEXT NOT NULL DEFAULT '',
+    tag TEXT NOT NULL DEFAULT '',
+    requests BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, country, tag)
+);
+
+-- Backfill the requests already logged
+INSERT INTO request_rollups (bucket, country, tag, requests)
+SELECT FLOOR(EXTRACT(EPOCH FROM timestamp) / 3600)::BIGINT * 3600, country, tag, COUNT(*)
+FROM (
+    SELECT timestamp, country, '' AS tag FROM request_logs
+    UNION ALL
+    SELECT timestamp, country, unnest(string_to_array(tags, ',')) FROM request_logs WHERE tags != ''
+) AS split
+GROUP BY 1, 2, 3;
@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_canary;
+
+-- Drop Column canary from request_logs table
+ALTER TABLE request_logs DROP COLUMN IF EXISTS canary;
@@ -0,0 +1,2 @@
+-- Drop Column variant from request_logs table
+ALTER TABLE request_logs DROP COLUMN variant;
@@ -0,0 +1,3 @@
+-- Add Column variant to request_logs table, the response variant each
+-- request was answered with
+ALTER TABLE request_logs ADD COLUMN variant TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,19 @@
+-- Create credentials table, one row per username and password a client
+-- submitted to an HTTP service's login form
+CREATE TABLE IF NOT EXISTS credentials (
+    id BIGSERIAL PRIMARY KEY,
+
+    -- The request_logs row of the submission, and where it came from
+    request_id BIGINT NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    source_ip TEXT NOT NULL,
+    service_name TEXT NOT NULL,
+    path TEXT NOT NULL,
+
+    username TEXT NOT NULL,
+    password TEXT NOT NULL
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_credentials_request_id ON credentials(request_id);
+CREATE INDEX IF NOT EXISTS idx_credentials_timestamp ON credentials(timestamp);
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/database"
+)
+
+// logFilterFlags defines the flags selecting logged requests on fs, looking
+// back window by default and returning at most limit, and returns a function
+// to read them once fs is parsed
+func logFilterFlags(fs *flag.FlagSet, window time.Duration, limit int) func() database.LogFilter {
+	ip := fs.String("ip", "", "only requests from this source address")
+	service := fs.String("service", "", "only requests to this service")
+	port := fs.Int("port", 0, "only requests to this server port")
+	method := fs.String("method", "", "only requests with this method")
+	path := fs.String("path", "", "only requests for this path")
+	pathPrefix := fs.String("path-prefix", "", "only requests for paths starting with this")
+	status := fs.Int("status", 0, "only requests answered with this status")
+	country := fs.String("country", "", "only requests from this country")
+	tag := fs.String("tag", "", "only requests carrying this attack tag")
+	ja4 := fs.String("ja4", "", "only requests with this JA4 fingerprint")
+	since := fs.Duration("window", window, "lookback window, 0 for all requests")
+	maxLogs := fs.Int("limit", limit, "maximum number of requests, 0 for all")
+
+	return func() database.LogFilter {
+		f := database.LogFilter{
+			Service:    *service,
+			Port:       *port,
+			Method:     *method,
+			Path:       *path,
+			PathPrefix: *pathPrefix,
+			Status:     *status,
+			Country:    *country,
+			Tag:        *tag,
+			JA4:        *ja4,
+			Limit:      *maxLogs,
+		}
+		if *since > 0 {
+			f.Since = time.Now().Add(-*since)
+		}
+
+		// Source IPs are stored in canonical form
+		if *ip != "" {
+			addr, err := netip.ParseAddr(*ip)
+			if err != nil {
+				log.Fatalf("Invalid source address %q", *ip)
+			}
+			f.SourceIP = addr.Unmap().WithZone("").String()
+		}
+		return f
+	}
+}
+
+// queryLogs opens the database of the config at path and returns the
+// requests logged matching f
+func queryLogs(path string, f database.LogFilter) []database.RequestLog {
+	cfg := mustLoadConfig(path)
+
+	db, err := database.Open(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	logs, err := database.NewRequestLogger(db).Query(f)
+	if err != nil {
+		log.Fatalf("Failed to query request logs: %v", err)
+	}
+	return logs
+}
+
+// runQuery prints the requests logged in the database, newest first, without
+// the admin API
+func runQuery(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the config file")
+	filter := logFilterFlags(fs, 24*time.Hour, 50)
+	raw := fs.Bool("raw", false, "print the raw dump of each request")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-spoof query [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	logs := queryLogs(*configPath, filter())
+
+	if *raw {
+		for _, l := range logs {
+			fmt.Printf("# %d %s %s:%d -> %s:%d %d\n", l.ID, l.Timestamp.Format(time.RFC3339), l.SourceIP, l.SourcePort, l.ServiceName, l.ServerPort, l.ResponseStatus)
+			fmt.Println(l.RawRequest)
+		}
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "ID\tTIME\tSOURCE\tCOUNTRY\tSERVICE\tPORT\tMETHOD\tPATH\tSTATUS\tTAGS")
+	for _, l := range logs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%d\t%s\n", l.ID, l.Timestamp.Format(time.RFC3339),
+			l.SourceIP, l.Country, l.ServiceName, l.ServerPort, l.Method, l.Path, l.ResponseStatus, strings.Join(l.Tags, ","))
+	}
+}
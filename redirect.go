@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/davidthuman/service-spoof/internal/firewall"
+)
+
+// runRedirectRules prints firewall rules that redirect every configured
+// service port to the redirect listener
+func runRedirectRules(args []string) {
+	fs := flag.NewFlagSet("redirect-rules", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the config file")
+	format := fs.String("format", "nft", "rule format: nft or iptables")
+	fs.Parse(args)
+
+	cfg := mustLoadConfig(*configPath)
+	if cfg.Redirect.Port == 0 {
+		log.Fatalf("redirect.port is not set in %s", *configPath)
+	}
+
+	ports := make([]int, 0)
+	for port := range cfg.GetServicesByPort() {
+		ports = append(ports, port)
+	}
+	if wildcard := cfg.GetWildcardService(); wildcard != nil {
+		ports = append(ports, wildcard.Ports...)
+	}
+
+	// The redirect listener itself must stay reachable
+	filtered := ports[:0]
+	for _, port := range ports {
+		if port != cfg.Redirect.Port {
+			filtered = append(filtered, port)
+		}
+	}
+
+	switch *format {
+	case "nft":
+		fmt.Print(firewall.NFTables(filtered, cfg.Redirect.Port))
+	case "iptables":
+		fmt.Print(firewall.IPTables(filtered, cfg.Redirect.Port))
+	default:
+		log.Fatalf("Unknown format %q", *format)
+	}
+}
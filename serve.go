@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/davidthuman/service-spoof/internal/api"
+	"github.com/davidthuman/service-spoof/internal/audit"
+	"github.com/davidthuman/service-spoof/internal/certs"
+	"github.com/davidthuman/service-spoof/internal/config"
+	"github.com/davidthuman/service-spoof/internal/database"
+	"github.com/davidthuman/service-spoof/internal/enrich"
+	"github.com/davidthuman/service-spoof/internal/expr"
+	"github.com/davidthuman/service-spoof/internal/geoip"
+	"github.com/davidthuman/service-spoof/internal/logging"
+	"github.com/davidthuman/service-spoof/internal/loki"
+	"github.com/davidthuman/service-spoof/internal/reputation"
+	"github.com/davidthuman/service-spoof/internal/selftest"
+	"github.com/davidthuman/service-spoof/internal/server"
+	"github.com/davidthuman/service-spoof/internal/sink"
+)
+
+// serverLog logs the server's startup and shutdown
+var serverLog = logging.Logger("server")
+
+// runServe runs the spoofed services, and the admin API if enabled, until
+// interrupted
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the config file")
+	migrations := fs.String("migrations", "./migrations", "path to the migrations directory")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-spoof serve [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// Load configuration
+	cfg := mustLoadConfig(*configPath)
+
+	// Write the server's own logs as configured from here on
+	logFile, err := logging.Setup(&cfg.Logging)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+	serverLog.Info("loaded configuration", "version", cfg.Version)
+
+	// Cross-check service banners for contradictions a scanner would notice
+	findings := audit.Run(cfg)
+	for _, f := range findings {
+		serverLog.Warn("banner audit", "finding", f.String())
+	}
+	if audit.Failed(findings, cfg.Audit.Strict) {
+		fatal("banner audit failed", "findings", len(findings))
+	}
+
+	// Initialize database
+	db, err := database.Open(&cfg.Database)
+	if err != nil {
+		fatal("failed to initialize database", "err", err)
+	}
+	defer db.Close()
+
+	// Recover from a migration that crashed on a previous run
+	if cfg.Database.AutoRecover {
+		recovered, err := db.RecoverDirtyMigration(*migrations)
+		if err != nil {
+			fatal("failed to recover dirty database", "err", err)
+		}
+		if recovered > 0 {
+			serverLog.Warn("recovered database left dirty by migration, retrying it", "migration", recovered)
+		}
+	}
+
+	// Run database migrations
+	if err := db.RunMigrations(*migrations); err != nil {
+		fatal("failed to run database migrations", "err", err)
+	}
+
+	// Log migration version
+	version, dirty, err := db.GetMigrationVersion()
+	if err != nil {
+		serverLog.Warn("failed to get migration version", "err", err)
+	} else if dirty {
+		fatal("database is in dirty state", "version", version)
+	} else {
+		serverLog.Info("database initialized", "target", cfg.Database.Target(), "version", version)
+	}
+
+	// Create request logger
+	requestLogger := database.NewRequestLogger(db)
+	requestLogger.SetAlertThreshold(cfg.Scoring.AlertThreshold)
+	requestLogger.SetScanDetection(cfg.Scans.MinPorts, cfg.Scans.GetWindow())
+	requestLogger.SetClientHelloMaxSize(cfg.Database.GetClientHelloMaxSize())
+	if cfg.Database.Writer.Enabled {
+		requestLogger.StartWriter(&cfg.Database.Writer)
+		serverLog.Info("writing request logs in batches",
+			"size", cfg.Database.Writer.GetBatchSize(), "interval", cfg.Database.Writer.GetFlushInterval())
+	}
+
+	// Record the configuration so logs can be joined back to it
+	configID, err := db.SaveConfig(cfg)
+	if err != nil {
+		fatal("failed to save configuration", "err", err)
+	}
+	requestLogger.SetConfigID(configID)
+	serverLog.Info("running configuration generation", "config_id", configID)
+
+	// Load the GeoIP database used to log and route on request sources
+	var geo *geoip.DB
+	if cfg.GeoIP.DatabasePath != "" {
+		geo, err = geoip.Open(cfg.GeoIP.DatabasePath)
+		if err != nil {
+			fatal("failed to load GeoIP database", "err", err)
+		}
+		serverLog.Info("loaded GeoIP ranges", "ranges", geo.Len(), "path", cfg.GeoIP.DatabasePath)
+		requestLogger.SetGeoIP(geo)
+	}
+
+	// Flag Tor exit nodes, open proxies, and datacenter sources
+	var checker *reputation.Checker
+	if cfg.Reputation.Enabled {
+		checker = reputation.NewChecker(&cfg.Reputation, geo)
+		if err := checker.Refresh(context.Background()); err != nil {
+			serverLog.Warn("failed to load reputation lists", "err", err)
+		}
+		tor, proxies := checker.Counts()
+		serverLog.Info("loaded reputation lists", "tor_exits", tor, "open_proxies", proxies)
+		requestLogger.SetReputation(checker)
+	}
+
+	// Look up reverse DNS and RDAP data for session sources
+	var enricher *enrich.Enricher
+	if cfg.Enrichment.Enabled {
+		enricher = enrich.NewEnricher(&cfg.Enrichment, requestLogger)
+		requestLogger.SetEnricher(enricher)
+	}
+
+	// Copy captures to stdout, Loki, and the configured sinks, each with its
+	// own filter and queue
+	filter := func(name, source string) database.Filter {
+		f, err := sink.NewFilter(source)
+		if err != nil {
+			fatal("invalid sink filter", "sink", name, "err", err)
+		}
+		return f
+	}
+
+	if cfg.Stdout.Enabled {
+		stream, err := sink.NewJSON(os.Stdout, cfg.Stdout.Fields)
+		if err != nil {
+			fatal("failed to create stdout stream", "err", err)
+		}
+		requestLogger.AddSink("stdout", stream, filter("stdout", cfg.Stdout.Filter))
+	}
+
+	var lokiClient *loki.Client
+	if cfg.Loki.Enabled {
+		lokiClient = loki.NewClient(&cfg.Loki)
+		requestLogger.AddSink("loki", sink.NewLoki(lokiClient), filter("loki", cfg.Loki.Filter))
+	}
+
+	for i := range cfg.Sinks {
+		sinkCfg := &cfg.Sinks[i]
+		s, err := sink.New(sinkCfg)
+		if err != nil {
+			fatal("failed to create sink", "sink", sinkCfg.Name, "err", err)
+		}
+		requestLogger.AddSink(sinkCfg.Name, s, filter(sinkCfg.Name, sinkCfg.Filter))
+	}
+
+	// Send requests to canary endpoints to the alert destinations
+	for i := range cfg.Alerts.Destinations {
+		destCfg := &cfg.Alerts.Destinations[i]
+		s, err := sink.New(destCfg)
+		if err != nil {
+			fatal("failed to create alert destination", "destination", destCfg.Name, "err", err)
+		}
+		requestLogger.AddCanaryAlert(destCfg.Name, s, filter(destCfg.Name, destCfg.Filter))
+	}
+
+	// Log an alert for every capture matching an alert rule
+	rules := make([]database.AlertRule, 0, len(cfg.Alerts.Rules))
+	for _, rule := range cfg.Alerts.Rules {
+		when, err := expr.Compile(rule.When)
+		if err == nil {
+			err = when.Check(database.EnvVars)
+		}
+		if err != nil {
+			fatal("invalid alert rule", "rule", rule.Name, "err", err)
+		}
+		rules = append(rules, database.AlertRule{Name: rule.Name, When: when})
+	}
+	requestLogger.SetAlertRules(rules)
+
+	// Create server manager
+	manager, err := server.NewManager(cfg, requestLogger, geo)
+	if err != nil {
+		fatal("failed to create server manager", "err", err)
+	}
+
+	// Start servers
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		if err := manager.Start(ctx); err != nil {
+			fatal("server error", "err", err)
+		}
+	}()
+
+	// Start admin API
+	var adminServer *api.Server
+	if cfg.Admin.Enabled {
+		for _, report := range cfg.Admin.Reports {
+			if err := requestLogger.CheckReport(report.Query); err != nil {
+				fatal("invalid report", "report", report.Name, "err", err)
+			}
+		}
+		adminServer = api.NewServer(&cfg.Admin, requestLogger, manager)
+		adminServer.SetFingerprints(manager.Fingerprints())
+		adminServer.SetJA3Fingerprints(manager.JA3Fingerprints())
+		adminServer.SetSSRFCatcher(manager.SSRFCatcher())
+		go func() {
+			if err := adminServer.Start(ctx); err != nil {
+				fatal("admin API error", "err", err)
+			}
+		}()
+	}
+
+	// Periodically refresh the Tor exit and open proxy lists
+	if checker != nil {
+		go checker.Start(ctx, cfg.Reputation.RefreshInterval)
+	}
+
+	if enricher != nil {
+		go enricher.Start(ctx)
+	}
+
+	if lokiClient != nil {
+		go lokiClient.Start(ctx)
+	}
+
+	// Prune old request logs, vacuuming the database now and then
+	if cfg.Database.Retention.Enabled {
+		go requestLogger.StartRetention(ctx, &cfg.Database.Retention)
+	}
+
+	// Alert ahead of served certificates expiring, daily
+	go certs.NewMonitor(manager.Certificates(), cfg.Alerts.CertExpiry).Start(ctx, 24*time.Hour)
+
+	// Start scheduled self-fingerprinting check
+	if cfg.SelfTest.Enabled {
+		go selftest.NewChecker(cfg).Start(ctx, cfg.SelfTest.Interval)
+	}
+
+	serverLog.Info("service spoof started successfully")
+	listenerServiceMap := manager.GetListenerServiceMap()
+	for addr, services := range listenerServiceMap {
+		// Wildcard ports are summarized when the manager is created
+		if services[0] == config.WildcardServiceName {
+			continue
+		}
+		serverLog.Info("listener", "addr", addr.String(), "services", services)
+	}
+
+	// Wait for shutdown signal
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+
+	serverLog.Info("shutting down")
+
+	// Graceful shutdown with timeout
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
+
+	if err := manager.Shutdown(shutdownCtx); err != nil {
+		serverLog.Error("shutdown error", "err", err)
+	}
+
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			serverLog.Error("admin API shutdown error", "err", err)
+		}
+	}
+
+	// Write request logs still queued, then ship captures still queued, once
+	// the listeners have stopped
+	if err := requestLogger.CloseWriter(shutdownCtx); err != nil {
+		serverLog.Error("request log writer shutdown error", "err", err)
+	}
+	if err := requestLogger.CloseSinks(shutdownCtx); err != nil {
+		serverLog.Error("sink shutdown error", "err", err)
+	}
+	if lokiClient != nil {
+		if err := lokiClient.Close(shutdownCtx); err != nil {
+			serverLog.Error("Loki shutdown error", "err", err)
+		}
+	}
+
+	serverLog.Info("shutdown complete")
+}
+
+// fatal logs an error the server cannot start or run with, and exits
+func fatal(msg string, args ...any) {
+	serverLog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,11 @@
+// Package services holds the response templates of the built-in profiles,
+// compiled into the binary so configs can serve them without the template
+// tree on disk
+package services
+
+import "embed"
+
+// FS holds the built-in profiles' templates, one directory per profile
+//
+//go:embed apache2 iis nginx wordpress
+var FS embed.FS
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/davidthuman/service-spoof/internal/watermark"
+)
+
+// runWatermark prints the token this deployment marks HTML responses with,
+// or checks whether content found elsewhere carries it. It exits non-zero
+// if no checked file carries the deployment's token.
+func runWatermark(args []string) {
+	fs := flag.NewFlagSet("watermark", flag.ExitOnError)
+	configPath := fs.String("config", "./config.yaml", "path to the config file")
+	id := fs.String("id", "", "deployment identifier, overriding watermark.id in the config")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service-spoof watermark [flags] token | check FILE...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *id == "" {
+		cfg := mustLoadConfig(*configPath)
+		*id = cfg.Watermark.DeploymentID()
+	}
+	token := watermark.Token(*id)
+
+	switch fs.Arg(0) {
+	case "token":
+		fmt.Println(token)
+	case "check":
+		if fs.NArg() < 2 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		found := false
+		for _, path := range fs.Args()[1:] {
+			content, err := readContent(path)
+			if err != nil {
+				log.Fatalf("Failed to read %s: %v", path, err)
+			}
+			tokens := watermark.Find(content)
+			match := false
+			for _, t := range tokens {
+				match = match || t == token
+			}
+			found = found || match
+
+			switch {
+			case match:
+				fmt.Printf("%s: carries this deployment's token %s\n", path, token)
+			case len(tokens) > 0:
+				fmt.Printf("%s: carries other tokens %s\n", path, strings.Join(tokens, ", "))
+			default:
+				fmt.Printf("%s: no tokens found\n", path)
+			}
+		}
+		if !found {
+			os.Exit(1)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// readContent reads a file, or stdin for "-"
+func readContent(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}